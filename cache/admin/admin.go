@@ -0,0 +1,243 @@
+// Package admin 提供缓存的运维 http 接口，用于查看统计、实例状态、热点 key，以及手动失效与预热，
+// 避免直接登录生产 redis 排查问题
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/cache/value"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// Op 接口对应的操作，鉴权时用于区分只读与写操作
+type Op string
+
+const (
+	OpStats      Op = "stats"
+	OpInstances  Op = "instances"
+	OpHotKeys    Op = "hotkeys"
+	OpInvalidate Op = "invalidate"
+	OpWarm       Op = "warm"
+)
+
+// Writable 是否为会修改缓存的操作
+func (o Op) Writable() bool {
+	return o == OpInvalidate || o == OpWarm
+}
+
+var errNoAuth = errors.New("write op requires auth, call Admin.Use first")
+
+// AuthFunc 请求鉴权，返回非 nil 时拒绝请求并返回 403
+type AuthFunc func(r *http.Request, op Op) error
+
+// KeyParser 将 http 参数中的 key 转换为 load 需要的 key 类型
+type KeyParser func(key string) (interface{}, error)
+
+type entry struct {
+	cache *value.Cache
+	parse KeyParser
+}
+
+// Admin 注册的 Cache 与鉴权规则，通过 Handler 挂载到服务的 http server 上
+type Admin struct {
+	mu     sync.RWMutex
+	caches map[string]*entry
+	auths  []AuthFunc
+}
+
+func New() *Admin {
+	return &Admin{
+		caches: make(map[string]*entry),
+	}
+}
+
+// Register 以 name 注册 Cache，parse 为 nil 时 key 按字符串处理
+func (m *Admin) Register(name string, c *value.Cache, parse KeyParser) *Admin {
+	if parse == nil {
+		parse = func(key string) (interface{}, error) {
+			return key, nil
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.caches[name] = &entry{cache: c, parse: parse}
+	return m
+}
+
+// Use 添加鉴权规则，所有规则都通过时才处理请求；
+// 未设置时只开放只读操作，invalidate、warm 一律拒绝
+func (m *Admin) Use(auth AuthFunc) *Admin {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.auths = append(m.auths, auth)
+	return m
+}
+
+// Handler 返回运维接口，挂载到子路径时需要配合 http.StripPrefix 使用：
+//
+//	GET  /stats                          所有 Cache 的统计
+//	GET  /instances                      已创建的 redis 实例及健康状态
+//	GET  /hotkeys?cache=name             热点 key
+//	POST /invalidate?cache=name&key=k    删除 key，key 可以重复
+//	POST /warm?cache=name&key=k          重新 load 并写入缓存，key 可以重复
+//
+// 写操作可以通过 group 参数指定路由分组
+func (m *Admin) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/stats", m.handle(OpStats, http.MethodGet, m.stats))
+	mux.Handle("/instances", m.handle(OpInstances, http.MethodGet, m.instances))
+	mux.Handle("/hotkeys", m.handle(OpHotKeys, http.MethodGet, m.hotKeys))
+	mux.Handle("/invalidate", m.handle(OpInvalidate, http.MethodPost, m.invalidate))
+	mux.Handle("/warm", m.handle(OpWarm, http.MethodPost, m.warm))
+	return mux
+}
+
+type handlerFunc func(r *http.Request) (interface{}, int, error)
+
+func (m *Admin) handle(op Op, method string, fn handlerFunc) http.Handler {
+	fun := "Admin.handle -->"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			writeJSON(w, http.StatusMethodNotAllowed, errBody(fmt.Errorf("method %s not allowed", r.Method)))
+			return
+		}
+
+		m.mu.RLock()
+		auths := m.auths
+		m.mu.RUnlock()
+		if op.Writable() && len(auths) == 0 {
+			writeJSON(w, http.StatusForbidden, errBody(errNoAuth))
+			return
+		}
+		for _, auth := range auths {
+			if err := auth(r, op); err != nil {
+				writeJSON(w, http.StatusForbidden, errBody(err))
+				return
+			}
+		}
+
+		if op.Writable() {
+			slog.Infof(r.Context(), "%s op: %s remote: %s query: %s", fun, op, r.RemoteAddr, r.URL.RawQuery)
+		}
+		body, code, err := fn(r)
+		if err != nil {
+			writeJSON(w, code, errBody(err))
+			return
+		}
+		writeJSON(w, code, body)
+	})
+}
+
+func (m *Admin) stats(r *http.Request) (interface{}, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := make(map[string]value.Stats, len(m.caches))
+	for name, e := range m.caches {
+		stats[name] = e.cache.Stats()
+	}
+	return stats, http.StatusOK, nil
+}
+
+func (m *Admin) instances(r *http.Request) (interface{}, int, error) {
+	return redis.DefaultInstanceManager.Health(r.Context()), http.StatusOK, nil
+}
+
+func (m *Admin) hotKeys(r *http.Request) (interface{}, int, error) {
+	e, err := m.lookup(r)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	keys := e.cache.HotKeys()
+	if keys == nil {
+		keys = []string{}
+	}
+	return keys, http.StatusOK, nil
+}
+
+// keyResult 写操作中单个 key 的结果
+type keyResult struct {
+	Key string `json:"key"`
+	Err string `json:"err,omitempty"`
+}
+
+func (m *Admin) invalidate(r *http.Request) (interface{}, int, error) {
+	return m.eachKey(r, func(ctx context.Context, c *value.Cache, key interface{}) error {
+		return c.Del(ctx, key)
+	})
+}
+
+func (m *Admin) warm(r *http.Request) (interface{}, int, error) {
+	return m.eachKey(r, func(ctx context.Context, c *value.Cache, key interface{}) error {
+		return c.Load(ctx, key)
+	})
+}
+
+func (m *Admin) eachKey(r *http.Request, fn func(ctx context.Context, c *value.Cache, key interface{}) error) (interface{}, int, error) {
+	e, err := m.lookup(r)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	keys := r.URL.Query()["key"]
+	if len(keys) == 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("key is required")
+	}
+
+	ctx := r.Context()
+	if group := r.URL.Query().Get("group"); group != "" {
+		ctx = value.WithRouteGroup(ctx, group)
+	}
+
+	code := http.StatusOK
+	results := make([]keyResult, 0, len(keys))
+	for _, k := range keys {
+		res := keyResult{Key: k}
+		key, err := e.parse(k)
+		if err == nil {
+			err = fn(ctx, e.cache, key)
+		}
+		if err != nil {
+			res.Err = err.Error()
+			code = http.StatusInternalServerError
+		}
+		results = append(results, res)
+	}
+	return results, code, nil
+}
+
+func (m *Admin) lookup(r *http.Request) (*entry, error) {
+	name := r.URL.Query().Get("cache")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.caches[name]
+	if !ok {
+		return nil, fmt.Errorf("cache %q not registered, registered: %v", name, m.names())
+	}
+	return e, nil
+}
+
+func (m *Admin) names() []string {
+	names := make([]string, 0, len(m.caches))
+	for name := range m.caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func errBody(err error) interface{} {
+	return map[string]string{"err": err.Error()}
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,87 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shawnfeng/sutil/cache/value"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmin_Handler(t *testing.T) {
+	c := value.NewCache("base/test", "test", time.Minute, nil)
+	h := New().Register("test", c, nil).Use(func(r *http.Request, op Op) error {
+		if op.Writable() && r.Header.Get("X-Token") != "secret" {
+			return errors.New("forbidden")
+		}
+		return nil
+	}).Handler()
+
+	serve := func(method, target string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("X-Token", token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodGet, "/stats", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats map[string]value.Stats
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, "base/test", stats["test"].Namespace)
+
+	w = serve(http.MethodGet, "/hotkeys?cache=test", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[]\n", w.Body.String())
+
+	w = serve(http.MethodGet, "/hotkeys?cache=unknown", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve(http.MethodGet, "/invalidate?cache=test&key=1", "secret")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = serve(http.MethodPost, "/invalidate?cache=test&key=1", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = serve(http.MethodPost, "/warm?cache=test", "secret")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAdmin_parse(t *testing.T) {
+	c := value.NewCache("base/test", "test", time.Minute, nil)
+	m := New().Register("test", c, func(key string) (interface{}, error) {
+		return nil, errors.New("invalid key")
+	}).Use(func(r *http.Request, op Op) error {
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/warm?cache=test&key=a&key=b", nil)
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	var results []keyResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+	assert.Equal(t, []keyResult{{Key: "a", Err: "invalid key"}, {Key: "b", Err: "invalid key"}}, results)
+}
+
+func TestAdmin_noAuth(t *testing.T) {
+	c := value.NewCache("base/test", "test", time.Minute, nil)
+	h := New().Register("test", c, nil).Handler()
+
+	for _, target := range []string{"/invalidate?cache=test&key=1", "/warm?cache=test&key=1"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, nil))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -2,13 +2,15 @@ package constants
 
 import (
 	"fmt"
+	"sync"
 	"time"
 )
 
 const (
-	SpanLogKeyKey    = "key"
-	SpanLogCacheType = "cache"
-	SpanLogOp        = "op"
+	SpanLogKeyKey       = "key"
+	SpanLogKeyOriginKey = "origin_key"
+	SpanLogCacheType    = "cache"
+	SpanLogOp           = "op"
 )
 
 const (
@@ -49,8 +51,60 @@ func (c ConfigerType) String() string {
 	case ConfigerTypeApollo:
 		return "apollo"
 	default:
+		if name, ok := customConfigerTypeName(c); ok {
+			return name
+		}
 		return "unkown"
 	}
 }
 
+// 通过 RegisterConfigerType 注册的配置中心类型
+var customConfigerTypes = struct {
+	sync.RWMutex
+	names map[ConfigerType]string
+}{names: make(map[ConfigerType]string)}
+
+// RegisterConfigerType 为自定义配置中心分配类型，同名重复注册返回同一个类型，内置类型返回对应的值
+func RegisterConfigerType(name string) ConfigerType {
+	if t, ok := ConfigerTypeOf(name); ok {
+		return t
+	}
+
+	customConfigerTypes.Lock()
+	defer customConfigerTypes.Unlock()
+	for t, n := range customConfigerTypes.names {
+		if n == name {
+			return t
+		}
+	}
+	t := ConfigerTypeApollo + 1 + ConfigerType(len(customConfigerTypes.names))
+	customConfigerTypes.names[t] = name
+	return t
+}
+
+// ConfigerTypeOf 按名称查找配置中心类型，包括内置类型与自定义类型
+func ConfigerTypeOf(name string) (ConfigerType, bool) {
+	for _, t := range []ConfigerType{ConfigerTypeSimple, ConfigerTypeEtcd, ConfigerTypeApollo} {
+		if t.String() == name {
+			return t, true
+		}
+	}
+
+	customConfigerTypes.RLock()
+	defer customConfigerTypes.RUnlock()
+	for t, n := range customConfigerTypes.names {
+		if n == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+func customConfigerTypeName(t ConfigerType) (string, bool) {
+	customConfigerTypes.RLock()
+	defer customConfigerTypes.RUnlock()
+	name, ok := customConfigerTypes.names[t]
+	return name, ok
+}
+
 const DefaultRouteGroup = "default"
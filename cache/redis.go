@@ -4,9 +4,8 @@ import (
 	"context"
 	"time"
 
-	go_redis "github.com/go-redis/redis"
+	go_redis "github.com/redis/go-redis/v9"
 	"github.com/shawnfeng/sutil/cache/redis"
-	"github.com/shawnfeng/sutil/scontext"
 	"github.com/shawnfeng/sutil/slog/slog"
 )
 
@@ -36,7 +35,7 @@ func NewRedisByNamespace(ctx context.Context, namespace string) (*RedisClient, e
 
 func getInstanceConf(ctx context.Context, namespace string) *redis.InstanceConf {
 	return &redis.InstanceConf{
-		Group:     scontext.GetControlRouteGroupWithDefault(ctx, DefaultRouteGroup),
+		Group:     redis.RouteGroup(ctx),
 		Namespace: namespace,
 		Wrapper:   WrapperTypeCache,
 	}
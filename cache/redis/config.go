@@ -6,11 +6,13 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"github.com/shawnfeng/sutil/cache/constants"
 	"github.com/shawnfeng/sutil/sconf/center"
-	"github.com/shawnfeng/sutil/scontext"
 	"github.com/shawnfeng/sutil/slog/slog"
+	"io/ioutil"
 	"strings"
 	"sync"
 	"time"
@@ -23,6 +25,41 @@ const (
 	apolloConfigKeyPoolSize   = "poolsize"
 	apolloConfigKeyTimeout    = "timeout"
 	apolloConfigKeyUseWrapper = "usewrapper"
+	apolloConfigKeyMasterName = "mastername"
+	apolloConfigKeySentinels  = "sentineladdrs"
+	apolloConfigKeyReplicas   = "replicaaddrs"
+	apolloConfigKeyCluster    = "clusteraddrs"
+	apolloConfigKeyUsername   = "username"
+	apolloConfigKeyPassword   = "password"
+	apolloConfigKeyTLS        = "tls"
+	apolloConfigKeyTLSCAFile  = "tlscafile"
+	apolloConfigKeyTLSSkip    = "tlsskipverify"
+
+	// 连接池相关配置，超时单位均为毫秒，未配置时由 timeout 推导
+	apolloConfigKeyMinIdleConns   = "minidleconns"
+	apolloConfigKeyDialTimeoutMs  = "dialtimeoutms"
+	apolloConfigKeyReadTimeoutMs  = "readtimeoutms"
+	apolloConfigKeyWriteTimeoutMs = "writetimeoutms"
+	apolloConfigKeyPoolTimeoutMs  = "pooltimeoutms"
+	apolloConfigKeyIdleTimeoutMs  = "idletimeoutms"
+
+	// 单次操作的超时，单位毫秒，未配置时不限制
+	apolloConfigKeyGetTimeoutMs = "gettimeoutms"
+	apolloConfigKeySetTimeoutMs = "settimeoutms"
+	apolloConfigKeyDelTimeoutMs = "deltimeoutms"
+
+	// 拼接前缀后超过该长度的 key 会被 hash，未配置时不处理
+	apolloConfigKeyMaxKeyLength = "maxkeylength"
+	// 编码后超过该字节数的值拒绝写入，未配置时不限制
+	apolloConfigKeyMaxValueSize = "maxvaluesize"
+
+	// 缓存策略，单位均为秒，未配置时使用代码中的默认值
+	apolloConfigKeyExpire         = "expire"
+	apolloConfigKeyStaleWindow    = "stalewindow"
+	apolloConfigKeyJitter         = "jitter"
+	apolloConfigKeyNegativeExpire = "negativeexpire"
+
+	sentinelAddrsSep = ","
 
 	defaultPoolSize          = 128
 	defaultTimeoutNumSeconds = 3
@@ -35,6 +72,94 @@ type Config struct {
 	poolSize   int
 	timeout    time.Duration
 	useWrapper bool
+	// sentinel 模式下的 master 名称与 sentinel 地址列表，配置了 masterName 时忽略 addr
+	masterName    string
+	sentinelAddrs []string
+	// 只读从库地址，Get/MGet 在从库间轮询，写入和删除仍然访问 addr
+	replicaAddrs []string
+	// cluster 模式下的节点地址，配置了 clusterAddrs 时忽略 addr、sentinel 与从库配置
+	clusterAddrs []string
+	// 认证信息，username 仅在 redis 6 ACL 下需要
+	username string
+	password string
+	// tls 配置，tlsCAFile 为自定义 CA 证书路径，tlsSkipVerify 仅用于测试环境
+	tlsEnabled    bool
+	tlsCAFile     string
+	tlsSkipVerify bool
+	// 连接池参数，零值表示使用由 timeout 推导的默认值
+	minIdleConns int
+	dialTimeout  time.Duration
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	poolTimeout  time.Duration
+	idleTimeout  time.Duration
+	// 单次操作的超时
+	opTimeouts OpTimeouts
+	// key 的最大长度，零值表示不限制
+	maxKeyLength int
+	// 值的最大字节数，零值表示不限制
+	maxValueSize int
+	// 缓存策略
+	policy CachePolicy
+}
+
+func (m *Config) useSentinel() bool {
+	return len(m.masterName) > 0
+}
+
+func (m *Config) useCluster() bool {
+	return len(m.clusterAddrs) > 0
+}
+
+func (m *Config) getDialTimeout() time.Duration {
+	if m.dialTimeout > 0 {
+		return m.dialTimeout
+	}
+	return 3 * m.timeout
+}
+
+func (m *Config) getReadTimeout() time.Duration {
+	if m.readTimeout > 0 {
+		return m.readTimeout
+	}
+	return m.timeout
+}
+
+func (m *Config) getWriteTimeout() time.Duration {
+	if m.writeTimeout > 0 {
+		return m.writeTimeout
+	}
+	return m.timeout
+}
+
+func (m *Config) getPoolTimeout() time.Duration {
+	if m.poolTimeout > 0 {
+		return m.poolTimeout
+	}
+	return 2 * m.timeout
+}
+
+func (m *Config) tlsConfig() (*tls.Config, error) {
+	fun := "Config.tlsConfig-->"
+	if !m.tlsEnabled {
+		return nil, nil
+	}
+
+	conf := &tls.Config{
+		InsecureSkipVerify: m.tlsSkipVerify,
+	}
+	if len(m.tlsCAFile) > 0 {
+		pem, err := ioutil.ReadFile(m.tlsCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s read ca file:%s err:%v", fun, m.tlsCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s no valid cert found in ca file:%s", fun, m.tlsCAFile)
+		}
+		conf.RootCAs = pool
+	}
+	return conf, nil
 }
 
 type KeyParts struct {
@@ -49,6 +174,8 @@ type Configer interface {
 	GetConfig(ctx context.Context, namespace string) (*Config, error)
 	ParseKey(ctx context.Context, key string) (*KeyParts, error)
 	Watch(ctx context.Context) <-chan *center.ChangeEvent
+	// Validate 检查配置中心里所有 namespace 的配置，包括取值是否合理以及地址是否可达、认证是否通过
+	Validate(ctx context.Context) []*ValidateResult
 }
 
 func NewConfiger(configType constants.ConfigerType) (Configer, error) {
@@ -60,10 +187,41 @@ func NewConfiger(configType constants.ConfigerType) (Configer, error) {
 	case constants.ConfigerTypeApollo:
 		return NewApolloConfiger(), nil
 	default:
+		configerFactories.RLock()
+		factory, ok := configerFactories.m[configType]
+		configerFactories.RUnlock()
+		if ok {
+			return factory()
+		}
 		return nil, fmt.Errorf("configType %d error", configType)
 	}
 }
 
+// ConfigerFactory 创建自定义配置中心
+type ConfigerFactory func() (Configer, error)
+
+var configerFactories = struct {
+	sync.RWMutex
+	m map[constants.ConfigerType]ConfigerFactory
+}{m: make(map[constants.ConfigerType]ConfigerFactory)}
+
+// RegisterConfiger 注册自定义配置中心（如 consul、nacos、本地文件），返回的类型可以传给 SetConfiger，
+// 同名重复注册时覆盖之前的 factory，不能覆盖内置类型
+func RegisterConfiger(name string, factory ConfigerFactory) (constants.ConfigerType, error) {
+	if t, ok := constants.ConfigerTypeOf(name); ok && t <= constants.ConfigerTypeApollo {
+		return 0, fmt.Errorf("configer %s is builtin", name)
+	}
+	if factory == nil {
+		return 0, fmt.Errorf("configer %s factory is nil", name)
+	}
+
+	t := constants.RegisterConfigerType(name)
+	configerFactories.Lock()
+	defer configerFactories.Unlock()
+	configerFactories.m[t] = factory
+	return t, nil
+}
+
 type SimpleConfig struct {
 }
 
@@ -109,43 +267,13 @@ func (m *SimpleConfig) Watch(ctx context.Context) <-chan *center.ChangeEvent {
 	return nil
 }
 
-type EtcdConfig struct {
-	etcdAddr []string
-}
-
-func NewEtcdConfiger() Configer {
-	return &EtcdConfig{
-		etcdAddr: []string{}, //todo
-	}
-}
-
-func (m *EtcdConfig) Init(ctx context.Context) error {
-	fun := "EtcdConfig.Init-->"
-	slog.Infof(ctx, "%s start", fun)
-	// TODO
-	return nil
-}
-
-func (m *EtcdConfig) GetConfig(ctx context.Context, namespace string) (*Config, error) {
-	fun := "EtcdConfig.GetConfig-->"
-	slog.Infof(ctx, "%s get etcd config namespace:%s", fun, namespace)
-	//todo etcd router
-	return nil, fmt.Errorf("%s etcd config not supported", fun)
-}
-
-func (m *EtcdConfig) ParseKey(ctx context.Context, key string) (*KeyParts, error) {
-	fun := "EtcdConfig.ParseKey-->"
-	return nil, fmt.Errorf("%s not implemented", fun)
-}
-
-func (m *EtcdConfig) Watch(ctx context.Context) <-chan *center.ChangeEvent {
-	fun := "EtcdConfig.Watch-->"
-	slog.Infof(ctx, "%s start", fun)
-	// TODO
-	return nil
+func (m *SimpleConfig) Validate(ctx context.Context) []*ValidateResult {
+	return validateConfigs(ctx, m, []*KeyParts{
+		{Namespace: "base/report", Group: defaultGroup},
+		{Namespace: "base/growthsystem", Group: defaultGroup},
+	})
 }
 
-
 type ApolloConfig struct {
 	watchOnce sync.Once
 	ch        chan *center.ChangeEvent
@@ -174,23 +302,10 @@ func (m *ApolloConfig) Init(ctx context.Context) error {
 	return err
 }
 
-type simpleContextControlRouter struct {
-	group string
-}
-
-func (s simpleContextControlRouter) GetControlRouteGroup() (string, bool) {
-	return s.group, true
-}
-
-func (s simpleContextControlRouter) SetControlRouteGroup(group string) error {
-	s.group = group
-	return nil
-}
-
 func (m *ApolloConfig) getConfigStringItemWithFallback(ctx context.Context, namespace, name string) (string, bool) {
 	val, ok := m.center.GetStringWithNamespace(ctx, center.DefaultApolloCacheNamespace, m.buildKey(ctx, namespace, name))
 	if !ok {
-		defaultCtx := context.WithValue(ctx, scontext.ContextKeyControl, simpleContextControlRouter{defaultGroup})
+		defaultCtx := WithRouteGroup(ctx, defaultGroup)
 		val, ok = m.center.GetStringWithNamespace(defaultCtx, center.DefaultApolloCacheNamespace, m.buildKey(defaultCtx, namespace, name))
 	}
 	return val, ok
@@ -199,7 +314,7 @@ func (m *ApolloConfig) getConfigStringItemWithFallback(ctx context.Context, name
 func (m *ApolloConfig) getConfigIntItemWithFallback(ctx context.Context, namespace, name string) (int, bool) {
 	val, ok := m.center.GetIntWithNamespace(ctx, center.DefaultApolloCacheNamespace, m.buildKey(ctx, namespace, name))
 	if !ok {
-		defaultCtx := context.WithValue(ctx, scontext.ContextKeyControl, simpleContextControlRouter{defaultGroup})
+		defaultCtx := WithRouteGroup(ctx, defaultGroup)
 		val, ok = m.center.GetIntWithNamespace(defaultCtx, center.DefaultApolloCacheNamespace, m.buildKey(defaultCtx, namespace, name))
 	}
 	return val, ok
@@ -208,7 +323,7 @@ func (m *ApolloConfig) getConfigIntItemWithFallback(ctx context.Context, namespa
 func (m *ApolloConfig) getConfigBoolItemWithFallback(ctx context.Context, namespace, name string) (bool, bool) {
 	val, ok := m.center.GetBoolWithNamespace(ctx, center.DefaultApolloCacheNamespace, m.buildKey(ctx, namespace, name))
 	if !ok {
-		defaultCtx := context.WithValue(ctx, scontext.ContextKeyControl, simpleContextControlRouter{defaultGroup})
+		defaultCtx := WithRouteGroup(ctx, defaultGroup)
 		val, ok = m.center.GetBoolWithNamespace(defaultCtx, center.DefaultApolloCacheNamespace, m.buildKey(defaultCtx, namespace, name))
 	}
 	return val, ok
@@ -218,12 +333,34 @@ func (m *ApolloConfig) GetConfig(ctx context.Context, namespace string) (*Config
 	fun := "ApolloConfig.GetConfig-->"
 	slog.Infof(ctx, "%s get apollo config namespace:%s", fun, namespace)
 
+	clusterVal, _ := m.getConfigStringItemWithFallback(ctx, namespace, apolloConfigKeyCluster)
+	clusterAddrs := splitAddrs(clusterVal)
+	slog.Infof(ctx, "%s got config cluster addrs:%v", fun, clusterAddrs)
+
+	masterName, _ := m.getConfigStringItemWithFallback(ctx, namespace, apolloConfigKeyMasterName)
+	var sentinelAddrs []string
+	if len(masterName) > 0 && len(clusterAddrs) == 0 {
+		sentinelsVal, ok := m.getConfigStringItemWithFallback(ctx, namespace, apolloConfigKeySentinels)
+		if !ok {
+			return nil, fmt.Errorf("%s no sentinel addrs config found, master name:%s", fun, masterName)
+		}
+		sentinelAddrs = splitAddrs(sentinelsVal)
+		if len(sentinelAddrs) == 0 {
+			return nil, fmt.Errorf("%s empty sentinel addrs config, master name:%s", fun, masterName)
+		}
+		slog.Infof(ctx, "%s got config master name:%s sentinel addrs:%v", fun, masterName, sentinelAddrs)
+	}
+
 	addr, ok := m.getConfigStringItemWithFallback(ctx, namespace, apolloConfigKeyAddr)
-	if !ok {
+	if !ok && len(masterName) == 0 && len(clusterAddrs) == 0 {
 		return nil, fmt.Errorf("%s no addr config found", fun)
 	}
 	slog.Infof(ctx, "%s got config addr:%s", fun, addr)
 
+	replicasVal, _ := m.getConfigStringItemWithFallback(ctx, namespace, apolloConfigKeyReplicas)
+	replicaAddrs := splitAddrs(replicasVal)
+	slog.Infof(ctx, "%s got config replica addrs:%v", fun, replicaAddrs)
+
 	poolSize, ok := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyPoolSize)
 	if !ok {
 		poolSize = defaultPoolSize
@@ -246,15 +383,86 @@ func (m *ApolloConfig) GetConfig(ctx context.Context, namespace string) (*Config
 	}
 	slog.Infof(ctx, "%s got config usewrapper:%v", fun, useWrapper)
 
+	username, _ := m.getConfigStringItemWithFallback(ctx, namespace, apolloConfigKeyUsername)
+	password, _ := m.getConfigStringItemWithFallback(ctx, namespace, apolloConfigKeyPassword)
+	slog.Infof(ctx, "%s got config username:%s with password:%v", fun, username, len(password) > 0)
+
+	tlsEnabled, _ := m.getConfigBoolItemWithFallback(ctx, namespace, apolloConfigKeyTLS)
+	tlsCAFile, _ := m.getConfigStringItemWithFallback(ctx, namespace, apolloConfigKeyTLSCAFile)
+	tlsSkipVerify, _ := m.getConfigBoolItemWithFallback(ctx, namespace, apolloConfigKeyTLSSkip)
+	slog.Infof(ctx, "%s got config tls:%v cafile:%s skipverify:%v", fun, tlsEnabled, tlsCAFile, tlsSkipVerify)
+
+	minIdleConns, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyMinIdleConns)
+	dialTimeoutMs, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyDialTimeoutMs)
+	readTimeoutMs, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyReadTimeoutMs)
+	writeTimeoutMs, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyWriteTimeoutMs)
+	poolTimeoutMs, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyPoolTimeoutMs)
+	idleTimeoutMs, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyIdleTimeoutMs)
+	slog.Infof(ctx, "%s got config minidleconns:%d dialtimeout:%dms readtimeout:%dms writetimeout:%dms pooltimeout:%dms idletimeout:%dms",
+		fun, minIdleConns, dialTimeoutMs, readTimeoutMs, writeTimeoutMs, poolTimeoutMs, idleTimeoutMs)
+
+	getTimeoutMs, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyGetTimeoutMs)
+	setTimeoutMs, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeySetTimeoutMs)
+	delTimeoutMs, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyDelTimeoutMs)
+	slog.Infof(ctx, "%s got config gettimeout:%dms settimeout:%dms deltimeout:%dms", fun, getTimeoutMs, setTimeoutMs, delTimeoutMs)
+
+	maxKeyLength, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyMaxKeyLength)
+	maxValueSize, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyMaxValueSize)
+	slog.Infof(ctx, "%s got config maxkeylength:%d maxvaluesize:%d", fun, maxKeyLength, maxValueSize)
+
+	expire, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyExpire)
+	staleWindow, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyStaleWindow)
+	jitter, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyJitter)
+	negativeExpire, _ := m.getConfigIntItemWithFallback(ctx, namespace, apolloConfigKeyNegativeExpire)
+	slog.Infof(ctx, "%s got config expire:%ds stalewindow:%ds jitter:%ds negativeexpire:%ds", fun, expire, staleWindow, jitter, negativeExpire)
+
 	return &Config{
-		addr:       addr,
-		namespace:  namespace,
-		poolSize:   poolSize,
-		timeout:    time.Duration(timeout) * time.Second,
-		useWrapper: useWrapper,
+		addr:          addr,
+		namespace:     namespace,
+		poolSize:      poolSize,
+		timeout:       time.Duration(timeout) * time.Second,
+		useWrapper:    useWrapper,
+		masterName:    masterName,
+		sentinelAddrs: sentinelAddrs,
+		replicaAddrs:  replicaAddrs,
+		clusterAddrs:  clusterAddrs,
+		username:      username,
+		password:      password,
+		tlsEnabled:    tlsEnabled,
+		tlsCAFile:     tlsCAFile,
+		tlsSkipVerify: tlsSkipVerify,
+		minIdleConns:  minIdleConns,
+		dialTimeout:   time.Duration(dialTimeoutMs) * time.Millisecond,
+		readTimeout:   time.Duration(readTimeoutMs) * time.Millisecond,
+		writeTimeout:  time.Duration(writeTimeoutMs) * time.Millisecond,
+		poolTimeout:   time.Duration(poolTimeoutMs) * time.Millisecond,
+		idleTimeout:   time.Duration(idleTimeoutMs) * time.Millisecond,
+		opTimeouts: OpTimeouts{
+			Get: time.Duration(getTimeoutMs) * time.Millisecond,
+			Set: time.Duration(setTimeoutMs) * time.Millisecond,
+			Del: time.Duration(delTimeoutMs) * time.Millisecond,
+		},
+		maxKeyLength: maxKeyLength,
+		maxValueSize: maxValueSize,
+		policy: CachePolicy{
+			Expire:         time.Duration(expire) * time.Second,
+			StaleWindow:    time.Duration(staleWindow) * time.Second,
+			Jitter:         time.Duration(jitter) * time.Second,
+			NegativeExpire: time.Duration(negativeExpire) * time.Second,
+		},
 	}, nil
 }
 
+func splitAddrs(s string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(s, sentinelAddrsSep) {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
 func (m *ApolloConfig) ParseKey(ctx context.Context, key string) (*KeyParts, error) {
 	fun := "ApolloConfig.ParseKey-->"
 	parts := strings.Split(key, apolloConfigSep)
@@ -302,10 +510,20 @@ func (m *ApolloConfig) Watch(ctx context.Context) <-chan *center.ChangeEvent {
 	return m.ch
 }
 
+func (m *ApolloConfig) Validate(ctx context.Context) []*ValidateResult {
+	var keys []string
+	for _, key := range m.center.GetAllKeysWithNamespace(ctx, center.DefaultApolloCacheNamespace) {
+		if strings.Contains(key, apolloConfigSep+fmt.Sprint(constants.CacheTypeRedis)+apolloConfigSep) {
+			keys = append(keys, key)
+		}
+	}
+	return validateConfigs(ctx, m, uniqueKeyParts(ctx, m, keys))
+}
+
 func (m *ApolloConfig) buildKey(ctx context.Context, namespace, item string) string {
 	return strings.Join([]string{
 		namespace,
-		scontext.GetControlRouteGroupWithDefault(ctx, defaultGroup),
+		RouteGroup(ctx),
 		fmt.Sprint(constants.CacheTypeRedis),
 		item,
 	}, apolloConfigSep)
@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitAddrs(t *testing.T) {
+	cases := []struct {
+		s      string
+		expect []string
+	}{
+		{"", nil},
+		{"127.0.0.1:26379", []string{"127.0.0.1:26379"}},
+		{"127.0.0.1:26379, 127.0.0.2:26379,,", []string{"127.0.0.1:26379", "127.0.0.2:26379"}},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expect, splitAddrs(c.s))
+	}
+}
+
+func TestConfig_useSentinel(t *testing.T) {
+	assert.False(t, (&Config{addr: "127.0.0.1:6379"}).useSentinel())
+	assert.True(t, (&Config{masterName: "mymaster", sentinelAddrs: []string{"127.0.0.1:26379"}}).useSentinel())
+}
+
+func TestConfig_tlsConfig(t *testing.T) {
+	conf, err := (&Config{}).tlsConfig()
+	assert.NoError(t, err)
+	assert.Nil(t, conf)
+
+	conf, err = (&Config{tlsEnabled: true, tlsSkipVerify: true}).tlsConfig()
+	assert.NoError(t, err)
+	assert.True(t, conf.InsecureSkipVerify)
+
+	_, err = (&Config{tlsEnabled: true, tlsCAFile: "/path/not/exist.pem"}).tlsConfig()
+	assert.Error(t, err)
+}
+
+func TestConfig_timeouts(t *testing.T) {
+	conf := &Config{timeout: time.Second}
+	assert.Equal(t, 3*time.Second, conf.getDialTimeout())
+	assert.Equal(t, time.Second, conf.getReadTimeout())
+	assert.Equal(t, time.Second, conf.getWriteTimeout())
+	assert.Equal(t, 2*time.Second, conf.getPoolTimeout())
+
+	conf = &Config{
+		timeout:      time.Second,
+		dialTimeout:  100 * time.Millisecond,
+		readTimeout:  200 * time.Millisecond,
+		writeTimeout: 300 * time.Millisecond,
+		poolTimeout:  400 * time.Millisecond,
+	}
+	assert.Equal(t, 100*time.Millisecond, conf.getDialTimeout())
+	assert.Equal(t, 200*time.Millisecond, conf.getReadTimeout())
+	assert.Equal(t, 300*time.Millisecond, conf.getWriteTimeout())
+	assert.Equal(t, 400*time.Millisecond, conf.getPoolTimeout())
+}
+
+func TestRegisterConfiger(t *testing.T) {
+	_, err := RegisterConfiger("apollo", func() (Configer, error) {
+		return NewSimpleConfiger(), nil
+	})
+	assert.Error(t, err)
+	_, err = RegisterConfiger("file", nil)
+	assert.Error(t, err)
+
+	typ, err := RegisterConfiger("file", func() (Configer, error) {
+		return NewSimpleConfiger(), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "file", typ.String())
+	again, err := RegisterConfiger("file", func() (Configer, error) {
+		return NewSimpleConfiger(), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, typ, again)
+
+	configer, err := NewConfiger(typ)
+	assert.NoError(t, err)
+	_, ok := configer.(*SimpleConfig)
+	assert.True(t, ok)
+
+	_, err = NewConfiger(typ + 100)
+	assert.Error(t, err)
+}
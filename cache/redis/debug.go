@@ -0,0 +1,226 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/redis/go-redis/v9"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	defaultDebugMaxRequests = 1000
+	defaultDebugMaxCommands = 100
+)
+
+// 参数全部为 key 的命令，脱敏时保留所有参数
+var debugKeyOnlyCommands = map[string]bool{
+	"mget":   true,
+	"del":    true,
+	"unlink": true,
+	"exists": true,
+	"touch":  true,
+}
+
+type debugCtxKey struct{}
+
+// WithDebug 强制记录 ctx 中的所有命令，不受采样率限制，requestID 为空时使用 trace id
+func WithDebug(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, debugCtxKey{}, requestID)
+}
+
+// DebugOptions 调试记录的参数
+type DebugOptions struct {
+	// SampleRate 按请求采样的比例，0 到 1，同一个请求的命令要么全部记录要么全部不记录
+	SampleRate float64
+	// MaxRequests 最多保留的请求数，超出时淘汰最早的请求，默认 1000
+	MaxRequests int
+	// MaxCommands 每个请求最多保留的命令数，默认 100
+	MaxCommands int
+	// NoRedact 记录完整参数，默认只保留命令名与 key，其余参数替换为长度
+	NoRedact bool
+}
+
+// DebugCommand 一条命令的记录
+type DebugCommand struct {
+	Time     time.Time     `json:"time"`
+	Name     string        `json:"name"`
+	Args     []string      `json:"args"`
+	Duration time.Duration `json:"duration"`
+	Err      string        `json:"err,omitempty"`
+}
+
+// DebugHook 命令级别的调试记录，通过 InstanceManager.AddHook 注册，
+// 命令同时以 span log 的形式记录到请求的 span 中，按请求 id 查询，请求 id 默认为 trace id
+type DebugHook struct {
+	opts DebugOptions
+
+	mu       sync.Mutex
+	requests map[string][]DebugCommand
+	order    []string
+}
+
+func NewDebugHook(opts DebugOptions) *DebugHook {
+	if opts.MaxRequests <= 0 {
+		opts.MaxRequests = defaultDebugMaxRequests
+	}
+	if opts.MaxCommands <= 0 {
+		opts.MaxCommands = defaultDebugMaxCommands
+	}
+	return &DebugHook{
+		opts:     opts,
+		requests: make(map[string][]DebugCommand),
+	}
+}
+
+// requestID 返回 ctx 对应的请求 id，未被采样时返回 false
+func (h *DebugHook) requestID(ctx context.Context) (string, bool) {
+	forced, ok := ctx.Value(debugCtxKey{}).(string)
+	id := forced
+	if id == "" {
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			if sc, ok := span.Context().(jaeger.SpanContext); ok {
+				id = sc.TraceID().String()
+			}
+		}
+	}
+	if id == "" {
+		return "", false
+	}
+	if ok {
+		return id, true
+	}
+	return id, sampled(id, h.opts.SampleRate)
+}
+
+// sampled 按请求 id 的哈希采样，保证同一个请求的结果一致
+func sampled(id string, rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	if rate >= 1 {
+		return true
+	}
+	return float64(crc32.ChecksumIEEE([]byte(id))%10000) < rate*10000
+}
+
+func (h *DebugHook) redact(cmd redis.Cmder) []string {
+	args := cmd.Args()
+	res := make([]string, len(args))
+	keyOnly := debugKeyOnlyCommands[cmd.Name()]
+	for i, arg := range args {
+		if h.opts.NoRedact || i < 2 || keyOnly {
+			res[i] = fmt.Sprint(arg)
+			continue
+		}
+		switch v := arg.(type) {
+		case string:
+			res[i] = fmt.Sprintf("<%d bytes>", len(v))
+		case []byte:
+			res[i] = fmt.Sprintf("<%d bytes>", len(v))
+		default:
+			res[i] = "<redacted>"
+		}
+	}
+	return res
+}
+
+func (h *DebugHook) record(ctx context.Context, id string, start time.Time, cost time.Duration, cmds ...redis.Cmder) {
+	span := opentracing.SpanFromContext(ctx)
+	records := make([]DebugCommand, 0, len(cmds))
+	for _, cmd := range cmds {
+		c := DebugCommand{
+			Time:     start,
+			Name:     cmd.Name(),
+			Args:     h.redact(cmd),
+			Duration: cost,
+		}
+		if err := cmd.Err(); err != nil {
+			c.Err = err.Error()
+		}
+		records = append(records, c)
+		if span != nil {
+			span.LogFields(
+				log.String("redis.debug.cmd", fmt.Sprint(c.Args)),
+				log.Int64("redis.debug.duration_us", cost.Microseconds()),
+				log.String("redis.debug.err", c.Err))
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	old, ok := h.requests[id]
+	if !ok {
+		if len(h.order) >= h.opts.MaxRequests {
+			delete(h.requests, h.order[0])
+			h.order = h.order[1:]
+		}
+		h.order = append(h.order, id)
+	}
+	if n := h.opts.MaxCommands - len(old); n < len(records) {
+		if n < 0 {
+			n = 0
+		}
+		records = records[:n]
+	}
+	h.requests[id] = append(old, records...)
+}
+
+// Commands 返回请求 id 对应的命令记录
+func (h *DebugHook) Commands(requestID string) []DebugCommand {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cmds := h.requests[requestID]
+	res := make([]DebugCommand, len(cmds))
+	copy(res, cmds)
+	return res
+}
+
+// Handler 以 json 返回请求的命令记录，请求参数 request_id
+func (h *DebugHook) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h.Commands(r.URL.Query().Get("request_id")))
+	})
+}
+
+func (h *DebugHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *DebugHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		id, ok := h.requestID(ctx)
+		if !ok {
+			return next(ctx, cmd)
+		}
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.record(ctx, id, start, time.Since(start), cmd)
+		return err
+	}
+}
+
+// ProcessPipelineHook pipeline 中的命令记录为整个 pipeline 的耗时
+func (h *DebugHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		id, ok := h.requestID(ctx)
+		if !ok {
+			return next(ctx, cmds)
+		}
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.record(ctx, id, start, time.Since(start), cmds...)
+		return err
+	}
+}
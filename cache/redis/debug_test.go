@@ -0,0 +1,62 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampled(t *testing.T) {
+	assert.False(t, sampled("a", 0))
+	assert.True(t, sampled("a", 1))
+
+	n := 0
+	for i := 0; i < 10000; i++ {
+		if sampled(fmt.Sprint(i), 0.1) {
+			n++
+		}
+	}
+	assert.True(t, n > 800 && n < 1200, n)
+}
+
+func TestDebugHook(t *testing.T) {
+	h := NewDebugHook(DebugOptions{MaxRequests: 2, MaxCommands: 2})
+	ctx := context.TODO()
+	process := h.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+		if cmd.Name() == "get" {
+			cmd.SetErr(errors.New("timeout"))
+			return cmd.Err()
+		}
+		return nil
+	})
+
+	// 未被采样
+	_ = process(ctx, redis.NewStatusCmd(ctx, "set", "k", "v"))
+	assert.Empty(t, h.Commands(""))
+
+	ctx1 := WithDebug(ctx, "req1")
+	_ = process(ctx1, redis.NewStatusCmd(ctx1, "set", "k", "value", "ex", 10))
+	_ = process(ctx1, redis.NewStringCmd(ctx1, "get", "k"))
+	_ = process(ctx1, redis.NewIntCmd(ctx1, "del", "k1", "k2"))
+	cmds := h.Commands("req1")
+	assert.Len(t, cmds, 2)
+	assert.Equal(t, []string{"set", "k", "<5 bytes>", "<2 bytes>", "<redacted>"}, cmds[0].Args)
+	assert.Equal(t, "get", cmds[1].Name)
+	assert.Equal(t, "timeout", cmds[1].Err)
+
+	pipeline := h.ProcessPipelineHook(func(ctx context.Context, cmds []redis.Cmder) error {
+		return nil
+	})
+	ctx2 := WithDebug(ctx, "req2")
+	_ = pipeline(ctx2, []redis.Cmder{redis.NewIntCmd(ctx2, "del", "k1", "k2")})
+	assert.Equal(t, []string{"del", "k1", "k2"}, h.Commands("req2")[0].Args)
+
+	ctx3 := WithDebug(ctx, "req3")
+	_ = process(ctx3, redis.NewStringCmd(ctx3, "get", "k"))
+	assert.Empty(t, h.Commands("req1"))
+	assert.Len(t, h.Commands("req3"), 1)
+}
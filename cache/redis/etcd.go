@@ -0,0 +1,288 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/client"
+	"github.com/shawnfeng/sutil/sconf/center"
+	"github.com/shawnfeng/sutil/setcd"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+const (
+	// 每个 namespace 在每个 group 下的配置为一个节点：/roc/cache/redis/{namespace}/{group}，
+	// 值为 json，字段名与 apollo 配置项一致
+	etcdConfigPrefix = "/roc/cache/redis"
+	etcdPathSep      = "/"
+
+	etcdInitTimeout = 5 * time.Second
+)
+
+var defaultEtcdAddrs = []string{"http://infra0.etcd.ibanyu.com:20002", "http://infra1.etcd.ibanyu.com:20002", "http://infra2.etcd.ibanyu.com:20002", "http://infra3.etcd.ibanyu.com:20002", "http://infra4.etcd.ibanyu.com:20002", "http://old0.etcd.ibanyu.com:20002", "http://old1.etcd.ibanyu.com:20002", "http://old2.etcd.ibanyu.com:20002"}
+
+type etcdRedisConfig struct {
+	Addr           string `json:"addr"`
+	PoolSize       int    `json:"poolsize"`
+	Timeout        int    `json:"timeout"`
+	UseWrapper     *bool  `json:"usewrapper"`
+	MasterName     string `json:"mastername"`
+	SentinelAddrs  string `json:"sentineladdrs"`
+	ReplicaAddrs   string `json:"replicaaddrs"`
+	ClusterAddrs   string `json:"clusteraddrs"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	TLS            bool   `json:"tls"`
+	TLSCAFile      string `json:"tlscafile"`
+	TLSSkipVerify  bool   `json:"tlsskipverify"`
+	MinIdleConns   int    `json:"minidleconns"`
+	DialTimeoutMs  int    `json:"dialtimeoutms"`
+	ReadTimeoutMs  int    `json:"readtimeoutms"`
+	WriteTimeoutMs int    `json:"writetimeoutms"`
+	PoolTimeoutMs  int    `json:"pooltimeoutms"`
+	IdleTimeoutMs  int    `json:"idletimeoutms"`
+	GetTimeoutMs   int    `json:"gettimeoutms"`
+	SetTimeoutMs   int    `json:"settimeoutms"`
+	DelTimeoutMs   int    `json:"deltimeoutms"`
+	MaxKeyLength   int    `json:"maxkeylength"`
+	MaxValueSize   int    `json:"maxvaluesize"`
+	Expire         int    `json:"expire"`
+	StaleWindow    int    `json:"stalewindow"`
+	Jitter         int    `json:"jitter"`
+	NegativeExpire int    `json:"negativeexpire"`
+}
+
+func (m *etcdRedisConfig) toConfig(namespace string) (*Config, error) {
+	clusterAddrs := splitAddrs(m.ClusterAddrs)
+	var sentinelAddrs []string
+	if len(clusterAddrs) > 0 {
+		// cluster 模式不需要 addr 与 sentinel 配置
+	} else if len(m.MasterName) > 0 {
+		sentinelAddrs = splitAddrs(m.SentinelAddrs)
+		if len(sentinelAddrs) == 0 {
+			return nil, fmt.Errorf("empty sentinel addrs config, master name:%s", m.MasterName)
+		}
+	} else if len(m.Addr) == 0 {
+		return nil, fmt.Errorf("no addr config found")
+	}
+
+	poolSize := m.PoolSize
+	if poolSize <= 0 {
+		poolSize = defaultPoolSize
+	}
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeoutNumSeconds
+	}
+	useWrapper := defaultUseWrapper
+	if m.UseWrapper != nil {
+		useWrapper = *m.UseWrapper
+	}
+
+	return &Config{
+		addr:          m.Addr,
+		namespace:     namespace,
+		poolSize:      poolSize,
+		timeout:       time.Duration(timeout) * time.Second,
+		useWrapper:    useWrapper,
+		masterName:    m.MasterName,
+		sentinelAddrs: sentinelAddrs,
+		replicaAddrs:  splitAddrs(m.ReplicaAddrs),
+		clusterAddrs:  clusterAddrs,
+		username:      m.Username,
+		password:      m.Password,
+		tlsEnabled:    m.TLS,
+		tlsCAFile:     m.TLSCAFile,
+		tlsSkipVerify: m.TLSSkipVerify,
+		minIdleConns:  m.MinIdleConns,
+		dialTimeout:   time.Duration(m.DialTimeoutMs) * time.Millisecond,
+		readTimeout:   time.Duration(m.ReadTimeoutMs) * time.Millisecond,
+		writeTimeout:  time.Duration(m.WriteTimeoutMs) * time.Millisecond,
+		poolTimeout:   time.Duration(m.PoolTimeoutMs) * time.Millisecond,
+		idleTimeout:   time.Duration(m.IdleTimeoutMs) * time.Millisecond,
+		opTimeouts: OpTimeouts{
+			Get: time.Duration(m.GetTimeoutMs) * time.Millisecond,
+			Set: time.Duration(m.SetTimeoutMs) * time.Millisecond,
+			Del: time.Duration(m.DelTimeoutMs) * time.Millisecond,
+		},
+		maxKeyLength: m.MaxKeyLength,
+		maxValueSize: m.MaxValueSize,
+		policy: CachePolicy{
+			Expire:         time.Duration(m.Expire) * time.Second,
+			StaleWindow:    time.Duration(m.StaleWindow) * time.Second,
+			Jitter:         time.Duration(m.Jitter) * time.Second,
+			NegativeExpire: time.Duration(m.NegativeExpire) * time.Second,
+		},
+	}, nil
+}
+
+type EtcdConfig struct {
+	etcdAddr []string
+	ch       chan *center.ChangeEvent
+
+	mu    sync.RWMutex
+	nodes map[string]string
+}
+
+func NewEtcdConfiger() Configer {
+	return &EtcdConfig{
+		etcdAddr: defaultEtcdAddrs,
+		ch:       make(chan *center.ChangeEvent, 1),
+	}
+}
+
+// Init 建立对配置前缀的 watch，等待第一次读取完成，之后的变化通过 Watch 返回的 channel 通知
+func (m *EtcdConfig) Init(ctx context.Context) error {
+	fun := "EtcdConfig.Init-->"
+	slog.Infof(ctx, "%s start", fun)
+
+	etcdInstance, err := setcd.NewEtcdInstance(m.etcdAddr)
+	if err != nil {
+		slog.Errorf(ctx, "%s create etcd instance err:%v", fun, err)
+		return err
+	}
+
+	initCh := make(chan struct{}, 1)
+	var initOnce sync.Once
+	etcdInstance.Watch(ctx, etcdConfigPrefix, func(response *client.Response) {
+		nodes := map[string]string{}
+		flattenEtcdNode(response.Node, nodes)
+
+		if ce := m.setNodes(nodes); ce != nil && len(ce.Changes) > 0 {
+			m.ch <- ce
+		}
+
+		initOnce.Do(func() {
+			initCh <- struct{}{}
+		})
+	})
+
+	select {
+	case <-initCh:
+		return nil
+	case <-time.After(etcdInitTimeout):
+		return fmt.Errorf("%s wait etcd config timeout, path:%s", fun, etcdConfigPrefix)
+	}
+}
+
+func flattenEtcdNode(node *client.Node, nodes map[string]string) {
+	if node == nil {
+		return
+	}
+	if !node.Dir {
+		nodes[node.Key] = node.Value
+		return
+	}
+	for _, n := range node.Nodes {
+		flattenEtcdNode(n, nodes)
+	}
+}
+
+// setNodes 替换配置快照，返回与旧快照的差异，第一次载入时返回 nil
+func (m *EtcdConfig) setNodes(nodes map[string]string) *center.ChangeEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.nodes
+	m.nodes = nodes
+	if old == nil {
+		return nil
+	}
+
+	changes := map[string]*center.Change{}
+	for k, v := range nodes {
+		ov, ok := old[k]
+		if !ok {
+			changes[k] = &center.Change{NewValue: v, ChangeType: center.ADD}
+		} else if ov != v {
+			changes[k] = &center.Change{OldValue: ov, NewValue: v, ChangeType: center.MODIFY}
+		}
+	}
+	for k, ov := range old {
+		if _, ok := nodes[k]; !ok {
+			changes[k] = &center.Change{OldValue: ov, ChangeType: center.DELETE}
+		}
+	}
+
+	return &center.ChangeEvent{
+		Source:    center.Etcd,
+		Namespace: etcdConfigPrefix,
+		Changes:   changes,
+	}
+}
+
+func (m *EtcdConfig) buildKey(namespace, group string) string {
+	return strings.Join([]string{etcdConfigPrefix, namespace, group}, etcdPathSep)
+}
+
+func (m *EtcdConfig) getNode(key string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	val, ok := m.nodes[key]
+	return val, ok
+}
+
+func (m *EtcdConfig) GetConfig(ctx context.Context, namespace string) (*Config, error) {
+	fun := "EtcdConfig.GetConfig-->"
+	slog.Infof(ctx, "%s get etcd config namespace:%s", fun, namespace)
+
+	group := RouteGroup(ctx)
+	val, ok := m.getNode(m.buildKey(namespace, group))
+	if !ok {
+		val, ok = m.getNode(m.buildKey(namespace, defaultGroup))
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s no config found, namespace:%s group:%s", fun, namespace, group)
+	}
+
+	var conf etcdRedisConfig
+	if err := json.Unmarshal([]byte(val), &conf); err != nil {
+		return nil, fmt.Errorf("%s unmarshal config namespace:%s err:%v", fun, namespace, err)
+	}
+
+	config, err := conf.toConfig(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("%s namespace:%s err:%v", fun, namespace, err)
+	}
+	slog.Infof(ctx, "%s got config addr:%s mastername:%s poolsize:%d", fun, config.addr, config.masterName, config.poolSize)
+	return config, nil
+}
+
+// ParseKey key 格式为 /roc/cache/redis/{namespace}/{group}
+func (m *EtcdConfig) ParseKey(ctx context.Context, key string) (*KeyParts, error) {
+	fun := "EtcdConfig.ParseKey-->"
+	if !strings.HasPrefix(key, etcdConfigPrefix+etcdPathSep) {
+		return nil, fmt.Errorf("%s invalid key:%s", fun, key)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(key, etcdConfigPrefix+etcdPathSep), etcdPathSep)
+	numParts := len(parts)
+	if numParts < 2 {
+		return nil, fmt.Errorf("%s invalid key:%s", fun, key)
+	}
+
+	return &KeyParts{
+		Namespace: strings.Join(parts[:numParts-1], etcdPathSep),
+		Group:     parts[numParts-1],
+	}, nil
+}
+
+func (m *EtcdConfig) Validate(ctx context.Context) []*ValidateResult {
+	m.mu.RLock()
+	var keys []string
+	for key := range m.nodes {
+		keys = append(keys, key)
+	}
+	m.mu.RUnlock()
+	return validateConfigs(ctx, m, uniqueKeyParts(ctx, m, keys))
+}
+
+func (m *EtcdConfig) Watch(ctx context.Context) <-chan *center.ChangeEvent {
+	fun := "EtcdConfig.Watch-->"
+	slog.Infof(ctx, "%s start", fun)
+	return m.ch
+}
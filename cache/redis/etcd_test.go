@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coreos/etcd/client"
+	"github.com/shawnfeng/sutil/sconf/center"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEtcdConfig_ParseKey(t *testing.T) {
+	m := &EtcdConfig{}
+	parts, err := m.ParseKey(context.TODO(), "/roc/cache/redis/base/report/default")
+	assert.NoError(t, err)
+	assert.Equal(t, &KeyParts{Namespace: "base/report", Group: "default"}, parts)
+
+	_, err = m.ParseKey(context.TODO(), "/roc/cache/redis/default")
+	assert.Error(t, err)
+	_, err = m.ParseKey(context.TODO(), "/roc/db/route")
+	assert.Error(t, err)
+}
+
+func TestEtcdConfig_setNodes(t *testing.T) {
+	m := &EtcdConfig{}
+	nodes := map[string]string{}
+	flattenEtcdNode(&client.Node{
+		Key: "/roc/cache/redis",
+		Dir: true,
+		Nodes: client.Nodes{
+			{Key: "/roc/cache/redis/base/report/default", Value: `{"addr":"127.0.0.1:6379"}`},
+			{Key: "/roc/cache/redis/base/test", Dir: true, Nodes: client.Nodes{
+				{Key: "/roc/cache/redis/base/test/default", Value: `{"addr":"127.0.0.1:6379"}`},
+			}},
+		},
+	}, nodes)
+	assert.Len(t, nodes, 2)
+	assert.Nil(t, m.setNodes(nodes))
+
+	ce := m.setNodes(map[string]string{
+		"/roc/cache/redis/base/report/default": `{"addr":"127.0.0.1:6380"}`,
+		"/roc/cache/redis/base/new/default":    `{"addr":"127.0.0.1:6379"}`,
+	})
+	assert.Equal(t, center.MODIFY, ce.Changes["/roc/cache/redis/base/report/default"].ChangeType)
+	assert.Equal(t, center.ADD, ce.Changes["/roc/cache/redis/base/new/default"].ChangeType)
+	assert.Equal(t, center.DELETE, ce.Changes["/roc/cache/redis/base/test/default"].ChangeType)
+
+	conf, err := m.GetConfig(context.TODO(), "base/report")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:6380", conf.addr)
+	assert.Equal(t, defaultPoolSize, conf.poolSize)
+	assert.True(t, conf.useWrapper)
+
+	_, err = m.GetConfig(context.TODO(), "base/test")
+	assert.Error(t, err)
+}
@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const healthPingTimeout = time.Second
+
+// Health 单个实例的健康状态
+type Health struct {
+	Group     string `json:"group"`
+	Namespace string `json:"namespace"`
+	Wrapper   string `json:"wrapper"`
+	Reachable bool   `json:"reachable"`
+	// PING 往返耗时，单位毫秒
+	RTTMs int64  `json:"rtt_ms"`
+	Err   string `json:"err,omitempty"`
+
+	Pool PoolStats `json:"pool"`
+}
+
+// PoolStats 连接池统计，含义与 go-redis PoolStats 一致
+type PoolStats struct {
+	Hits       uint32 `json:"hits"`
+	Misses     uint32 `json:"misses"`
+	Timeouts   uint32 `json:"timeouts"`
+	TotalConns uint32 `json:"total_conns"`
+	IdleConns  uint32 `json:"idle_conns"`
+	StaleConns uint32 `json:"stale_conns"`
+}
+
+func fromRedisPoolStats(stats *redis.PoolStats) PoolStats {
+	if stats == nil {
+		return PoolStats{}
+	}
+	return PoolStats{
+		Hits:       stats.Hits,
+		Misses:     stats.Misses,
+		Timeouts:   stats.Timeouts,
+		TotalConns: stats.TotalConns,
+		IdleConns:  stats.IdleConns,
+		StaleConns: stats.StaleConns,
+	}
+}
+
+func (m *Client) Ping(ctx context.Context) *redis.StatusCmd {
+	return m.client.Ping(ctx)
+}
+
+func (m *Client) PoolStats() PoolStats {
+	return fromRedisPoolStats(m.client.PoolStats())
+}
+
+func (m *Client) health(ctx context.Context) *Health {
+	ctx, cancel := context.WithTimeout(ctx, healthPingTimeout)
+	defer cancel()
+
+	h := &Health{
+		Namespace: m.namespace,
+		Wrapper:   m.wrapper,
+	}
+	st := time.Now()
+	err := m.Ping(ctx).Err()
+	h.RTTMs = time.Since(st).Milliseconds()
+	h.Reachable = err == nil
+	if err != nil {
+		h.Err = err.Error()
+	}
+	h.Pool = m.PoolStats()
+	return h
+}
+
+// Health 并发 PING 所有已创建的实例，按 namespace、group 排序返回
+func (m *InstanceManager) Health(ctx context.Context) []*Health {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var healths []*Health
+	m.instances.Range(func(key, value interface{}) bool {
+		client, ok := value.(*Client)
+		if !ok {
+			return true
+		}
+		conf, err := instanceConfFromString(key.(string))
+		if err != nil {
+			return true
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h := client.health(ctx)
+			h.Group = conf.Group
+			mu.Lock()
+			healths = append(healths, h)
+			mu.Unlock()
+		}()
+		return true
+	})
+	wg.Wait()
+
+	sort.Slice(healths, func(i, j int) bool {
+		if healths[i].Namespace != healths[j].Namespace {
+			return healths[i].Namespace < healths[j].Namespace
+		}
+		if healths[i].Group != healths[j].Group {
+			return healths[i].Group < healths[j].Group
+		}
+		return healths[i].Wrapper < healths[j].Wrapper
+	})
+	return healths
+}
+
+// HealthHandler 以 json 返回所有实例的健康状态，有实例不可达时返回 503，可用于 /healthz 与 readiness 检查
+func (m *InstanceManager) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		healths := m.Health(r.Context())
+		code := http.StatusOK
+		for _, h := range healths {
+			if !h.Reachable {
+				code = http.StatusServiceUnavailable
+				break
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(healths)
+	})
+}
@@ -0,0 +1,28 @@
+package redis
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstanceManager_Health(t *testing.T) {
+	m := NewInstanceManager()
+	client, _ := NewDefaultClient(context.TODO(), "base/test", "127.0.0.1:0", "cache", 1, false, 10*time.Millisecond)
+	m.add(m.buildKey(&InstanceConf{Group: "default", Namespace: "base/test", Wrapper: "cache"}), client)
+
+	healths := m.Health(context.TODO())
+	assert.Len(t, healths, 1)
+	assert.Equal(t, "default", healths[0].Group)
+	assert.Equal(t, "base/test", healths[0].Namespace)
+	assert.False(t, healths[0].Reachable)
+	assert.NotEmpty(t, healths[0].Err)
+
+	w := httptest.NewRecorder()
+	m.HealthHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -0,0 +1,65 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 关闭实例时检查执行中命令的间隔
+const closeWaitInterval = 10 * time.Millisecond
+
+var ErrClosed = errors.New("cache: instance closed")
+
+// inflightHook 统计执行中的命令，实例关闭后拒绝新的命令
+type inflightHook struct {
+	client *Client
+}
+
+// NOTE: 先计数再检查关闭标记，保证 Close 看到计数为零之后不会再有命令使用连接池
+func (h *inflightHook) enter() bool {
+	atomic.AddInt64(&h.client.inflight, 1)
+	if atomic.LoadInt32(&h.client.closed) == 1 {
+		h.exit()
+		return false
+	}
+	return true
+}
+
+func (h *inflightHook) exit() {
+	atomic.AddInt64(&h.client.inflight, -1)
+}
+
+func (h *inflightHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *inflightHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if !h.enter() {
+			cmd.SetErr(ErrClosed)
+			return ErrClosed
+		}
+		defer h.exit()
+		return next(ctx, cmd)
+	}
+}
+
+func (h *inflightHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if !h.enter() {
+			for _, cmd := range cmds {
+				cmd.SetErr(ErrClosed)
+			}
+			return ErrClosed
+		}
+		defer h.exit()
+		return next(ctx, cmds)
+	}
+}
@@ -10,7 +10,10 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/shawnfeng/sutil/cache/constants"
 	"github.com/shawnfeng/sutil/sconf/center"
 	"github.com/shawnfeng/sutil/slog/slog"
@@ -50,8 +53,25 @@ var DefaultInstanceManager = NewInstanceManager()
 type InstanceManager struct {
 	instances sync.Map
 	watchOnce sync.Once
+
+	hookMu     sync.RWMutex
+	hooks      []redis.Hook
+	eventHooks []InstanceEventHook
+
+	closed int32
+}
+
+// InstanceEvent 配置变更引起的实例重建或移除
+type InstanceEvent struct {
+	Conf *InstanceConf
+	// MODIFY 表示重建，DELETE 表示配置被删除后移除了实例
+	Type center.ChangeType
+	// 重建失败时的错误，此时保留旧实例
+	Err error
 }
 
+type InstanceEventHook func(ctx context.Context, event *InstanceEvent)
+
 func NewInstanceManager() *InstanceManager {
 	return &InstanceManager{}
 }
@@ -68,13 +88,50 @@ func (m *InstanceManager) add(key string, client *Client) {
 	m.instances.Store(key, client)
 }
 
+// AddHook 为之后创建的所有实例注册 go-redis hook，配置变更重建的实例同样生效，
+// 需要在第一次 GetInstance 之前调用
+func (m *InstanceManager) AddHook(hook redis.Hook) {
+	m.hookMu.Lock()
+	defer m.hookMu.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// OnInstanceEvent 注册实例重建、移除的回调，用于记录日志或报警
+func (m *InstanceManager) OnInstanceEvent(hook InstanceEventHook) {
+	m.hookMu.Lock()
+	defer m.hookMu.Unlock()
+	m.eventHooks = append(m.eventHooks, hook)
+}
+
+func (m *InstanceManager) notify(ctx context.Context, event *InstanceEvent) {
+	m.hookMu.RLock()
+	hooks := m.eventHooks
+	m.hookMu.RUnlock()
+	for _, hook := range hooks {
+		hook(ctx, event)
+	}
+}
+
 func (m *InstanceManager) newInstance(ctx context.Context, conf *InstanceConf) (*Client, error) {
-	return NewClient(ctx, conf.Namespace, conf.Wrapper)
+	// NOTE: 配置变更时在 watch 的 ctx 中重建实例，需要显式指定 group
+	client, err := NewClient(WithRouteGroup(ctx, conf.Group), conf.Namespace, conf.Wrapper)
+	if client != nil {
+		m.hookMu.RLock()
+		for _, hook := range m.hooks {
+			client.AddHook(hook)
+		}
+		m.hookMu.RUnlock()
+	}
+	return client, err
 }
 
 func (m *InstanceManager) GetInstance(ctx context.Context, conf *InstanceConf) (*Client, error) {
 	fun := "InstanceManager.GetInstance -->"
 
+	if atomic.LoadInt32(&m.closed) == 1 {
+		return nil, ErrClosed
+	}
+
 	var err error
 	var in interface{}
 	key := m.buildKey(conf)
@@ -101,48 +158,92 @@ func (m *InstanceManager) GetInstance(ctx context.Context, conf *InstanceConf) (
 	return client, nil
 }
 
-func (m *InstanceManager) applyChange(ctx context.Context, key string, change *center.Change) {
-	fun := "InstanceManager.applyChange-->"
-	slog.Infof(ctx, "%s apply change:%v to key:%v", fun, change, key)
-	m.instances.Range(func(k, v interface{}) (ret bool) {
-		ret = true
+// 配置变更时旧实例延迟关闭，等待已经取到旧实例的请求执行完
+const instanceDrainDelay = 10 * time.Second
+
+// NOTE: 只要 namespace 和 group 相同，即认为相关的配置发生了变化
+func changeMatched(keyParts *KeyParts, conf *InstanceConf) bool {
+	return (keyParts.Group == conf.Group || keyParts.Group == constants.DefaultRouteGroup) && keyParts.Namespace == conf.Namespace
+}
+
+// matchChange 返回受 key 变化影响的实例
+func (m *InstanceManager) matchChange(ctx context.Context, key string) []string {
+	fun := "InstanceManager.matchChange-->"
+
+	keyParts, err := DefaultConfiger.ParseKey(ctx, key)
+	if err != nil {
+		slog.Errorf(ctx, "%s parse change key:%s err:%v", fun, key, err)
+		return nil
+	}
 
+	var keys []string
+	m.instances.Range(func(k, v interface{}) bool {
 		sk, ok := k.(string)
 		if !ok {
-			slog.Errorf(ctx, "%s key:%v should be string", fun, key)
-			return
+			slog.Errorf(ctx, "%s key:%v should be string", fun, k)
+			return true
 		}
 
 		conf, err := instanceConfFromString(sk)
 		if err != nil {
 			slog.Errorf(ctx, "%s convert instances key:%s err:%v", fun, sk, err)
-			return
+			return true
 		}
 
-		keyParts, err := DefaultConfiger.ParseKey(ctx, key)
-		if err != nil {
-			slog.Errorf(ctx, "%s parse change key:%s err:%v", fun, key, err)
-			return
+		if changeMatched(keyParts, conf) {
+			keys = append(keys, sk)
 		}
+		return true
+	})
+	return keys
+}
 
-		// NOTE: 只要 namespace 和 group 相同，即认为相关的配置发生了变化
-		//       为了逻辑简单，不论什么变化，都重新载入一次 instance，不对不同的 ChangeType 单独处理
-		if (keyParts.Group == conf.Group || keyParts.Group == constants.DefaultRouteGroup) && keyParts.Namespace == conf.Namespace {
-			slog.Infof(ctx, "%s update instance:%v", fun, v)
-			// NOTE: 关闭旧实例，重新载入新实例，若旧实例关闭失败打印日志
-			if err = m.closeInstance(ctx, v); err != nil {
-				slog.Errorf(ctx, "%s close instance err:%v", fun, err)
-			}
+// reloadInstance 先创建新实例再替换，旧实例在 instanceDrainDelay 后关闭，
+// 新实例创建失败时保留旧实例继续服务，若变更中有配置被删除则移除实例
+func (m *InstanceManager) reloadInstance(ctx context.Context, key string, deleted bool) {
+	fun := "InstanceManager.reloadInstance-->"
+	if atomic.LoadInt32(&m.closed) == 1 {
+		return
+	}
 
-			in, err := m.newInstance(ctx, conf)
-			if err != nil {
-				m.instances.Delete(k)
-				return
-			}
-			m.instances.Store(k, in)
-		}
+	conf, err := instanceConfFromString(key)
+	if err != nil {
+		slog.Errorf(ctx, "%s convert instances key:%s err:%v", fun, key, err)
+		return
+	}
 
+	in, err := m.newInstance(ctx, conf)
+	if err != nil && deleted {
+		slog.Infof(ctx, "%s config of instance:%v deleted, remove instance, err:%v", fun, conf, err)
+		old, loaded := m.instances.Load(key)
+		m.instances.Delete(key)
+		m.notify(ctx, &InstanceEvent{Conf: conf, Type: center.DELETE})
+		if loaded {
+			m.drainInstance(ctx, old)
+		}
+		return
+	}
+	if err != nil {
+		slog.Errorf(ctx, "%s new instance:%v err:%v, keep old instance", fun, conf, err)
+		m.notify(ctx, &InstanceEvent{Conf: conf, Type: center.MODIFY, Err: err})
 		return
+	}
+
+	old, loaded := m.instances.Load(key)
+	m.instances.Store(key, in)
+	slog.Infof(ctx, "%s instance:%v reloaded", fun, conf)
+	m.notify(ctx, &InstanceEvent{Conf: conf, Type: center.MODIFY})
+	if loaded {
+		m.drainInstance(ctx, old)
+	}
+}
+
+func (m *InstanceManager) drainInstance(ctx context.Context, old interface{}) {
+	fun := "InstanceManager.drainInstance-->"
+	time.AfterFunc(instanceDrainDelay, func() {
+		if err := m.closeInstance(ctx, old); err != nil {
+			slog.Errorf(ctx, "%s close instance err:%v", fun, err)
+		}
 	})
 }
 
@@ -150,12 +251,18 @@ func (m *InstanceManager) applyChangeEvent(ctx context.Context, ce *center.Chang
 	fun := "InstanceManager.applyChangeEvent-->"
 	slog.Infof(ctx, "%s got new change event:%v", fun, ce)
 
+	// NOTE: 为了逻辑简单，不论什么变化，都重新载入一次 instance，不对不同的 ChangeType 单独处理，
+	//       同一事件中多个 key 的变化只重新载入一次
+	reloads := map[string]bool{}
 	for key, change := range ce.Changes {
-		if change.ChangeType != center.MODIFY && change.ChangeType != center.DELETE {
-			continue
+		slog.Infof(ctx, "%s apply change:%v to key:%v", fun, change, key)
+		for _, k := range m.matchChange(ctx, key) {
+			reloads[k] = reloads[k] || change.ChangeType == center.DELETE
 		}
+	}
 
-		m.applyChange(ctx, key, change)
+	for k, deleted := range reloads {
+		m.reloadInstance(ctx, k, deleted)
 	}
 }
 
@@ -188,23 +295,35 @@ func (m *InstanceManager) Watch(ctx context.Context) {
 	})
 }
 
-func (m *InstanceManager) Close() {
+// Close 用于服务退出，之后 GetInstance 返回 ErrClosed，各实例等待执行中的命令完成后关闭，
+// ctx 结束时不再等待，返回第一个关闭失败的错误
+func (m *InstanceManager) Close(ctx context.Context) error {
 	fun := "InstanceManager.Close -->"
+	atomic.StoreInt32(&m.closed, 1)
 
-	ctx := context.TODO()
-
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
 	m.instances.Range(func(key, value interface{}) bool {
 		slog.Infof(ctx, "%s key:%v", fun, key)
-
-		err := m.closeInstance(ctx, value)
-		if err != nil {
-			slog.Errorf(ctx, "%s close instance err:%v", fun, err)
-			return false
-		}
-
 		m.instances.Delete(key)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.closeInstance(ctx, value); err != nil {
+				slog.Errorf(ctx, "%s close instance key:%v err:%v", fun, key, err)
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
 		return true
 	})
+	wg.Wait()
+	return firstErr
 }
 
 func (m *InstanceManager) closeInstance(ctx context.Context, instance interface{}) error {
@@ -0,0 +1,15 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeMatched(t *testing.T) {
+	conf := &InstanceConf{Group: "gray", Namespace: "base/test", Wrapper: "cache"}
+	assert.True(t, changeMatched(&KeyParts{Group: "gray", Namespace: "base/test"}, conf))
+	assert.True(t, changeMatched(&KeyParts{Group: "default", Namespace: "base/test"}, conf))
+	assert.False(t, changeMatched(&KeyParts{Group: "blue", Namespace: "base/test"}, conf))
+	assert.False(t, changeMatched(&KeyParts{Group: "gray", Namespace: "base/other"}, conf))
+}
@@ -0,0 +1,221 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type pipelineOp struct {
+	op  string
+	key string
+}
+
+// Pipeline 对 go-redis pipeline 的封装，保证 key 的修正规则与 Client 一致，
+// 排队的命令在 Exec 时统一记录到 span 中
+type Pipeline struct {
+	client *Client
+	pipe   redis.Pipeliner
+
+	mu  sync.Mutex
+	ops []pipelineOp
+}
+
+func (m *Client) Pipeline() *Pipeline {
+	return &Pipeline{
+		client: m,
+		pipe:   m.client.Pipeline(),
+	}
+}
+
+// TxPipeline 与 Pipeline 相同，Exec 时使用 MULTI/EXEC 原子执行
+func (m *Client) TxPipeline() *Pipeline {
+	return &Pipeline{
+		client: m,
+		pipe:   m.client.TxPipeline(),
+	}
+}
+
+func (p *Pipeline) queue(op string, keys ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ops = append(p.ops, pipelineOp{op, strings.Join(keys, ",")})
+}
+
+func (p *Pipeline) fixKey(ctx context.Context, op, key string) string {
+	k := p.client.fixKey(ctx, key)
+	p.queue(op, k)
+	return k
+}
+
+func (p *Pipeline) Get(ctx context.Context, key string) *redis.StringCmd {
+	return p.pipe.Get(ctx, p.fixKey(ctx, "Get", key))
+}
+
+func (p *Pipeline) MGet(ctx context.Context, keys ...string) *redis.SliceCmd {
+	tkeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		tkeys = append(tkeys, p.client.fixKey(ctx, key))
+	}
+	p.queue("MGet", tkeys...)
+	return p.pipe.MGet(ctx, tkeys...)
+}
+
+func (p *Pipeline) MSet(ctx context.Context, pairs ...interface{}) *redis.StatusCmd {
+	tpairs := make([]interface{}, len(pairs))
+	var tkeys []string
+	for i, v := range pairs {
+		if i%2 == 0 {
+			k := p.client.fixKey(ctx, v.(string))
+			tkeys = append(tkeys, k)
+			tpairs[i] = k
+		} else {
+			tpairs[i] = v
+		}
+	}
+	p.queue("MSet", tkeys...)
+	return p.pipe.MSet(ctx, tpairs...)
+}
+
+func (p *Pipeline) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	return p.pipe.Set(ctx, p.fixKey(ctx, "Set", key), value, expiration)
+}
+
+func (p *Pipeline) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	return p.pipe.SetNX(ctx, p.fixKey(ctx, "SetNX", key), value, expiration)
+}
+
+func (p *Pipeline) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	var tkeys []string
+	for _, key := range keys {
+		tkeys = append(tkeys, p.client.fixKey(ctx, key))
+	}
+	p.queue("Del", tkeys...)
+	return p.pipe.Del(ctx, tkeys...)
+}
+
+func (p *Pipeline) Unlink(ctx context.Context, keys ...string) *redis.IntCmd {
+	var tkeys []string
+	for _, key := range keys {
+		tkeys = append(tkeys, p.client.fixKey(ctx, key))
+	}
+	p.queue("Unlink", tkeys...)
+	return p.pipe.Unlink(ctx, tkeys...)
+}
+
+func (p *Pipeline) Exists(ctx context.Context, key string) *redis.IntCmd {
+	return p.pipe.Exists(ctx, p.fixKey(ctx, "Exists", key))
+}
+
+func (p *Pipeline) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	return p.pipe.Expire(ctx, p.fixKey(ctx, "Expire", key), expiration)
+}
+
+func (p *Pipeline) TTL(ctx context.Context, key string) *redis.DurationCmd {
+	return p.pipe.TTL(ctx, p.fixKey(ctx, "TTL", key))
+}
+
+func (p *Pipeline) PTTL(ctx context.Context, key string) *redis.DurationCmd {
+	return p.pipe.PTTL(ctx, p.fixKey(ctx, "PTTL", key))
+}
+
+func (p *Pipeline) Incr(ctx context.Context, key string) *redis.IntCmd {
+	return p.pipe.Incr(ctx, p.fixKey(ctx, "Incr", key))
+}
+
+func (p *Pipeline) IncrBy(ctx context.Context, key string, value int64) *redis.IntCmd {
+	return p.pipe.IncrBy(ctx, p.fixKey(ctx, "IncrBy", key), value)
+}
+
+func (p *Pipeline) Decr(ctx context.Context, key string) *redis.IntCmd {
+	return p.pipe.Decr(ctx, p.fixKey(ctx, "Decr", key))
+}
+
+func (p *Pipeline) DecrBy(ctx context.Context, key string, value int64) *redis.IntCmd {
+	return p.pipe.DecrBy(ctx, p.fixKey(ctx, "DecrBy", key), value)
+}
+
+func (p *Pipeline) HSet(ctx context.Context, key string, field string, value interface{}) *redis.IntCmd {
+	return p.pipe.HSet(ctx, p.fixKey(ctx, "HSet", key), field, value)
+}
+
+func (p *Pipeline) HGet(ctx context.Context, key string, field string) *redis.StringCmd {
+	return p.pipe.HGet(ctx, p.fixKey(ctx, "HGet", key), field)
+}
+
+func (p *Pipeline) HGetAll(ctx context.Context, key string) *redis.MapStringStringCmd {
+	return p.pipe.HGetAll(ctx, p.fixKey(ctx, "HGetAll", key))
+}
+
+func (p *Pipeline) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
+	return p.pipe.HDel(ctx, p.fixKey(ctx, "HDel", key), fields...)
+}
+
+func (p *Pipeline) HIncrBy(ctx context.Context, key string, field string, incr int64) *redis.IntCmd {
+	return p.pipe.HIncrBy(ctx, p.fixKey(ctx, "HIncrBy", key), field, incr)
+}
+
+func (p *Pipeline) HMSet(ctx context.Context, key string, fields map[string]interface{}) *redis.BoolCmd {
+	return p.pipe.HMSet(ctx, p.fixKey(ctx, "HMSet", key), fields)
+}
+
+func (p *Pipeline) LPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	return p.pipe.LPush(ctx, p.fixKey(ctx, "LPush", key), values...)
+}
+
+func (p *Pipeline) RPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	return p.pipe.RPush(ctx, p.fixKey(ctx, "RPush", key), values...)
+}
+
+func (p *Pipeline) LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
+	return p.pipe.LRange(ctx, p.fixKey(ctx, "LRange", key), start, stop)
+}
+
+func (p *Pipeline) ZAdd(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd {
+	return p.pipe.ZAdd(ctx, p.fixKey(ctx, "ZAdd", key), members...)
+}
+
+func (p *Pipeline) ZIncrBy(ctx context.Context, key string, increment float64, member string) *redis.FloatCmd {
+	return p.pipe.ZIncrBy(ctx, p.fixKey(ctx, "ZIncrBy", key), increment, member)
+}
+
+func (p *Pipeline) ZScore(ctx context.Context, key string, member string) *redis.FloatCmd {
+	return p.pipe.ZScore(ctx, p.fixKey(ctx, "ZScore", key), member)
+}
+
+func (p *Pipeline) ZRem(ctx context.Context, key string, members []interface{}) *redis.IntCmd {
+	return p.pipe.ZRem(ctx, p.fixKey(ctx, "ZRem", key), members...)
+}
+
+func (p *Pipeline) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	tkeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		tkeys = append(tkeys, p.client.fixKey(ctx, key))
+	}
+	p.queue("Eval", tkeys...)
+	return p.pipe.Eval(ctx, script, tkeys, args...)
+}
+
+// Exec 发送所有排队的命令，返回的 cmds 与入队顺序一致
+func (p *Pipeline) Exec(ctx context.Context) ([]redis.Cmder, error) {
+	p.mu.Lock()
+	ops := p.ops
+	p.ops = nil
+	p.mu.Unlock()
+
+	for _, op := range ops {
+		p.client.logSpan(ctx, "Pipeline."+op.op, op.key)
+	}
+	return p.pipe.Exec(ctx)
+}
+
+// Discard 丢弃所有排队的命令
+func (p *Pipeline) Discard() {
+	p.mu.Lock()
+	p.ops = nil
+	p.mu.Unlock()
+	p.pipe.Discard()
+}
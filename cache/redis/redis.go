@@ -2,24 +2,61 @@ package redis
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/go-redis/redis"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/log"
+	"github.com/redis/go-redis/v9"
 	"github.com/shawnfeng/sutil/cache/constants"
 	"github.com/shawnfeng/sutil/slog/slog"
 )
 
 var RedisNil = fmt.Sprintf("redis: nil")
 
+// 超长 key hash 后前缀与 hash 之间的分隔符
+const longKeyHashSep = "#"
+
 type Client struct {
-	client     *redis.Client
-	namespace  string
-	wrapper    string
-	useWrapper bool
+	client       redis.UniversalClient
+	namespace    string
+	wrapper      string
+	useWrapper   bool
+	opTimeouts   OpTimeouts
+	maxKeyLength int
+	maxValueSize int
+	policy       CachePolicy
+	// 只读从库，未配置时为 nil
+	replicas *replicaSet
+
+	// 执行中的命令数与关闭标记，由 inflightHook 维护
+	inflight int64
+	closed   int32
+}
+
+// CachePolicy 配置中心下发的 namespace 级别缓存策略，零值表示使用代码中的默认值
+type CachePolicy struct {
+	// 缓存过期时间
+	Expire time.Duration
+	// 过期前的 stale 窗口，窗口内读取返回旧值并异步刷新
+	StaleWindow time.Duration
+	// 过期时间随机增加 [0, Jitter)，避免同时过期
+	Jitter time.Duration
+	// load 失败时的缓存时间
+	NegativeExpire time.Duration
+}
+
+// OpTimeouts namespace 级别的单次操作超时，零值表示不限制
+type OpTimeouts struct {
+	Get time.Duration
+	Set time.Duration
+	Del time.Duration
 }
 
 func NewClient(ctx context.Context, namespace string, wrapper string) (*Client, error) {
@@ -30,26 +67,95 @@ func NewClient(ctx context.Context, namespace string, wrapper string) (*Client,
 		return nil, err
 	}
 
-	client := redis.NewClient(&redis.Options{
-		Addr:         config.addr,
-		DialTimeout:  3 * config.timeout,
-		ReadTimeout:  config.timeout,
-		WriteTimeout: config.timeout,
-		PoolSize:     config.poolSize,
-		PoolTimeout:  2 * config.timeout,
-	})
+	client, err := newRedisClient(config)
+	if err != nil {
+		return nil, err
+	}
 
-	pong, err := client.Ping().Result()
+	pong, err := client.Ping(ctx).Result()
 	if err != nil {
 		slog.Errorf(ctx, "%s ping:%s err:%s", fun, pong, err)
 	}
 
-	return &Client{
-		client:     client,
-		namespace:  namespace,
-		wrapper:    wrapper,
-		useWrapper: config.useWrapper,
-	}, err
+	c := &Client{
+		client:       client,
+		namespace:    namespace,
+		wrapper:      wrapper,
+		useWrapper:   config.useWrapper,
+		opTimeouts:   config.opTimeouts,
+		maxKeyLength: config.maxKeyLength,
+		maxValueSize: config.maxValueSize,
+		policy:       config.policy,
+	}
+	hook := &inflightHook{client: c}
+	c.client.AddHook(hook)
+
+	// NOTE: sentinel 与 cluster 模式下忽略从库配置
+	if len(config.replicaAddrs) > 0 && !config.useSentinel() && !config.useCluster() {
+		replicas, rerr := newReplicaSet(config, hook)
+		if rerr != nil {
+			_ = client.Close()
+			return nil, rerr
+		}
+		c.replicas = replicas
+	}
+	return c, err
+}
+
+// newRedisClient 根据配置创建 redis 客户端，配置了 sentinel 时创建 failover 客户端，
+// master 切换由 go-redis 通过 sentinel 自动发现，无需重建实例；配置了 cluster 节点时创建 cluster 客户端
+func newRedisClient(config *Config) (redis.UniversalClient, error) {
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.useCluster() {
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:           config.clusterAddrs,
+			Username:        config.username,
+			Password:        config.password,
+			DialTimeout:     config.getDialTimeout(),
+			ReadTimeout:     config.getReadTimeout(),
+			WriteTimeout:    config.getWriteTimeout(),
+			PoolSize:        config.poolSize,
+			MinIdleConns:    config.minIdleConns,
+			PoolTimeout:     config.getPoolTimeout(),
+			ConnMaxIdleTime: config.idleTimeout,
+			TLSConfig:       tlsConfig,
+		}), nil
+	}
+
+	if config.useSentinel() {
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:      config.masterName,
+			SentinelAddrs:   config.sentinelAddrs,
+			Username:        config.username,
+			Password:        config.password,
+			DialTimeout:     config.getDialTimeout(),
+			ReadTimeout:     config.getReadTimeout(),
+			WriteTimeout:    config.getWriteTimeout(),
+			PoolSize:        config.poolSize,
+			MinIdleConns:    config.minIdleConns,
+			PoolTimeout:     config.getPoolTimeout(),
+			ConnMaxIdleTime: config.idleTimeout,
+			TLSConfig:       tlsConfig,
+		}), nil
+	}
+
+	return redis.NewClient(&redis.Options{
+		Addr:            config.addr,
+		Username:        config.username,
+		Password:        config.password,
+		DialTimeout:     config.getDialTimeout(),
+		ReadTimeout:     config.getReadTimeout(),
+		WriteTimeout:    config.getWriteTimeout(),
+		PoolSize:        config.poolSize,
+		MinIdleConns:    config.minIdleConns,
+		PoolTimeout:     config.getPoolTimeout(),
+		ConnMaxIdleTime: config.idleTimeout,
+		TLSConfig:       tlsConfig,
+	}), nil
 }
 
 func NewDefaultClient(ctx context.Context, namespace, addr, wrapper string, poolSize int, useWrapper bool, timeout time.Duration) (*Client, error) {
@@ -64,20 +170,45 @@ func NewDefaultClient(ctx context.Context, namespace, addr, wrapper string, pool
 		PoolTimeout:  2 * timeout,
 	})
 
-	pong, err := client.Ping().Result()
+	pong, err := client.Ping(ctx).Result()
 	if err != nil {
 		slog.Errorf(ctx, "%s Ping: %s err: %s", fun, pong, err)
 	}
 
-	return &Client{
+	c := &Client{
 		client:     client,
 		namespace:  namespace,
 		wrapper:    wrapper,
 		useWrapper: useWrapper,
-	}, err
+	}
+	c.client.AddHook(&inflightHook{client: c})
+	return c, err
+}
+
+// AddHook 注册 go-redis hook，如 OpenTelemetry 的 tracing/metrics hook
+func (m *Client) AddHook(hook redis.Hook) {
+	m.client.AddHook(hook)
+	if m.replicas != nil {
+		for _, r := range m.replicas.replicas {
+			r.client.AddHook(hook)
+		}
+	}
+}
+
+func (m *Client) OpTimeouts() OpTimeouts {
+	return m.opTimeouts
+}
+
+// MaxValueSize 配置中心下发的值的最大字节数，0 表示不限制
+func (m *Client) MaxValueSize() int {
+	return m.maxValueSize
+}
+
+func (m *Client) Policy() CachePolicy {
+	return m.policy
 }
 
-func (m *Client) fixKey(key string) string {
+func (m *Client) joinKey(key string) string {
 	parts := []string{
 		m.namespace,
 		m.wrapper,
@@ -92,6 +223,34 @@ func (m *Client) fixKey(key string) string {
 	return strings.Join(parts, ".")
 }
 
+// fixKey 拼接 namespace 前缀，配置了 maxKeyLength 时超长的 key 会被 hash，原始 key 记录在 span 中
+func (m *Client) fixKey(ctx context.Context, key string) string {
+	k := m.joinKey(key)
+	if m.maxKeyLength <= 0 || len(k) <= m.maxKeyLength {
+		return k
+	}
+
+	hk := hashLongKey(k, m.maxKeyLength)
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		span.LogFields(
+			log.String(constants.SpanLogKeyOriginKey, k),
+			log.String(constants.SpanLogKeyKey, hk))
+	}
+	return hk
+}
+
+// hashLongKey 保留可读的前缀，其余部分替换为完整 key 的 sha1，结果长度不超过 maxLength；
+// maxLength 不足以保留前缀时只返回 sha1
+func hashLongKey(key string, maxLength int) string {
+	sum := sha1.Sum([]byte(key))
+	hash := hex.EncodeToString(sum[:])
+	keep := maxLength - len(hash) - len(longKeyHashSep)
+	if keep <= 0 {
+		return hash
+	}
+	return key[:keep] + longKeyHashSep + hash
+}
+
 func (m *Client) logSpan(ctx context.Context, op, key string) {
 	if span := opentracing.SpanFromContext(ctx); span != nil {
 		span.LogFields(
@@ -101,26 +260,36 @@ func (m *Client) logSpan(ctx context.Context, op, key string) {
 	}
 }
 
-func (m *Client) Get(ctx context.Context, key string) *redis.StringCmd {
-	k := m.fixKey(key)
+// Get 配置了从库时从从库读取
+func (m *Client) Get(ctx context.Context, key string) (cmd *redis.StringCmd) {
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "Get", k)
-	return m.client.Get(k)
+	m.readFrom(ctx, func(client redis.UniversalClient) redis.Cmder {
+		cmd = client.Get(ctx, k)
+		return cmd
+	})
+	return
 }
 
-func (m *Client) MGet(ctx context.Context, keys ...string) *redis.SliceCmd {
+// MGet 配置了从库时从从库读取
+func (m *Client) MGet(ctx context.Context, keys ...string) (cmd *redis.SliceCmd) {
 	var fixKeys = make([]string, len(keys))
 	for k, v := range keys {
-		key := m.fixKey(v)
+		key := m.fixKey(ctx, v)
 		fixKeys[k] = key
 	}
 	m.logSpan(ctx, "MGet", strings.Join(fixKeys, "||"))
-	return m.client.MGet(fixKeys...)
+	m.readFrom(ctx, func(client redis.UniversalClient) redis.Cmder {
+		cmd = client.MGet(ctx, fixKeys...)
+		return cmd
+	})
+	return
 }
 
 func (m *Client) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "Set", k)
-	return m.client.Set(k, value, expiration)
+	return m.client.Set(ctx, k, value, expiration)
 }
 
 func (m *Client) MSet(ctx context.Context, pairs ...interface{}) *redis.StatusCmd {
@@ -128,7 +297,7 @@ func (m *Client) MSet(ctx context.Context, pairs ...interface{}) *redis.StatusCm
 	var keys []string
 	for k, v := range pairs {
 		if (k & 1) == 0 {
-			key := m.fixKey(v.(string))
+			key := m.fixKey(ctx, v.(string))
 			keys = append(keys, key)
 			fixPairs[k] = key
 		} else {
@@ -136,393 +305,642 @@ func (m *Client) MSet(ctx context.Context, pairs ...interface{}) *redis.StatusCm
 		}
 	}
 	m.logSpan(ctx, "MSet", strings.Join(keys, "||"))
-	return m.client.MSet(fixPairs...)
+	return m.client.MSet(ctx, fixPairs...)
 }
 
 func (m *Client) GetBit(ctx context.Context, key string, offset int64) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "GetBit", k)
-	return m.client.GetBit(k, offset)
+	return m.client.GetBit(ctx, k, offset)
 }
 
 func (m *Client) SetBit(ctx context.Context, key string, offset int64, value int) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "SetBit", k)
-	return m.client.SetBit(k, offset, value)
+	return m.client.SetBit(ctx, k, offset, value)
 }
 
 func (m *Client) Exists(ctx context.Context, key string) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "Exists", k)
-	return m.client.Exists(k)
+	return m.client.Exists(ctx, k)
 }
 
 func (m *Client) Del(ctx context.Context, keys ...string) *redis.IntCmd {
 	var tkeys []string
 	for _, key := range keys {
-		tkeys = append(tkeys, m.fixKey(key))
+		tkeys = append(tkeys, m.fixKey(ctx, key))
 	}
 
 	m.logSpan(ctx, "Del", strings.Join(tkeys, ","))
-	return m.client.Del(tkeys...)
+	return m.client.Del(ctx, tkeys...)
+}
+
+// Unlink 与 Del 相同，但在后台线程中释放内存，适合批量删除大 key
+func (m *Client) Unlink(ctx context.Context, keys ...string) *redis.IntCmd {
+	var tkeys []string
+	for _, key := range keys {
+		tkeys = append(tkeys, m.fixKey(ctx, key))
+	}
+
+	m.logSpan(ctx, "Unlink", strings.Join(tkeys, ","))
+	return m.client.Unlink(ctx, tkeys...)
 }
 
 func (m *Client) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "Expire", k)
-	return m.client.Expire(k, expiration)
+	return m.client.Expire(ctx, k, expiration)
 }
 
 func (m *Client) Incr(ctx context.Context, key string) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "Incr", k)
-	return m.client.Incr(k)
+	return m.client.Incr(ctx, k)
 }
 
 func (m *Client) IncrBy(ctx context.Context, key string, value int64) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "IncrBy", k)
-	return m.client.IncrBy(k, value)
+	return m.client.IncrBy(ctx, k, value)
 }
 
 func (m *Client) Decr(ctx context.Context, key string) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "Decr", k)
-	return m.client.Decr(k)
+	return m.client.Decr(ctx, k)
 }
 
 func (m *Client) DecrBy(ctx context.Context, key string, value int64) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "DecrBy", k)
-	return m.client.DecrBy(k, value)
+	return m.client.DecrBy(ctx, k, value)
 }
 
 func (m *Client) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "SetNX", k)
-	return m.client.SetNX(k, value, expiration)
+	return m.client.SetNX(ctx, k, value, expiration)
 }
 
-func (m *Client) HSet(ctx context.Context, key string, field string, value interface{}) *redis.BoolCmd {
-	k := m.fixKey(key)
+func (m *Client) HSet(ctx context.Context, key string, field string, value interface{}) *redis.IntCmd {
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "HSet", k)
-	return m.client.HSet(k, field, value)
+	return m.client.HSet(ctx, k, field, value)
 }
 
 func (m *Client) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "HDel", k)
-	return m.client.HDel(k, fields...)
+	return m.client.HDel(ctx, k, fields...)
 }
 
 func (m *Client) HExists(ctx context.Context, key string, field string) *redis.BoolCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "HExists", k)
-	return m.client.HExists(k, field)
+	return m.client.HExists(ctx, k, field)
 }
 
 func (m *Client) HGet(ctx context.Context, key string, field string) *redis.StringCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "HGet", k)
-	return m.client.HGet(k, field)
+	return m.client.HGet(ctx, k, field)
 }
 
-func (m *Client) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
-	k := m.fixKey(key)
+func (m *Client) HGetAll(ctx context.Context, key string) *redis.MapStringStringCmd {
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "HGetAll", k)
-	return m.client.HGetAll(k)
+	return m.client.HGetAll(ctx, k)
 }
 
 func (m *Client) HIncrBy(ctx context.Context, key string, field string, incr int64) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "HIncrBy", k)
-	return m.client.HIncrBy(k, field, incr)
+	return m.client.HIncrBy(ctx, k, field, incr)
 }
 
 func (m *Client) HIncrByFloat(ctx context.Context, key string, field string, incr float64) *redis.FloatCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "HIncrByFloat", k)
-	return m.client.HIncrByFloat(k, field, incr)
+	return m.client.HIncrByFloat(ctx, k, field, incr)
 }
 
 func (m *Client) HKeys(ctx context.Context, key string) *redis.StringSliceCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "HKeys", k)
-	return m.client.HKeys(k)
+	return m.client.HKeys(ctx, k)
 }
 
 func (m *Client) HLen(ctx context.Context, key string) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "HLen", k)
-	return m.client.HLen(k)
+	return m.client.HLen(ctx, k)
 }
 
 func (m *Client) HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "HMGet", k)
-	return m.client.HMGet(k, fields...)
+	return m.client.HMGet(ctx, k, fields...)
 }
 
-func (m *Client) HMSet(ctx context.Context, key string, fields map[string]interface{}) *redis.StatusCmd {
-	k := m.fixKey(key)
+func (m *Client) HMSet(ctx context.Context, key string, fields map[string]interface{}) *redis.BoolCmd {
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "HMSet", k)
-	return m.client.HMSet(k, fields)
+	return m.client.HMSet(ctx, k, fields)
 }
 
 func (m *Client) HSetNX(ctx context.Context, key string, field string, val interface{}) *redis.BoolCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "HSetNX", k)
-	return m.client.HSetNX(k, field, val)
+	return m.client.HSetNX(ctx, k, field, val)
 }
 
 func (m *Client) HVals(ctx context.Context, key string) *redis.StringSliceCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "HVals", k)
-	return m.client.HVals(k)
+	return m.client.HVals(ctx, k)
 }
 
 func (m *Client) ZAdd(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZAdd", k)
-	return m.client.ZAdd(k, members...)
+	return m.client.ZAdd(ctx, k, members...)
 }
 
 func (m *Client) ZAddNX(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZAddNX", k)
-	return m.client.ZAddNX(k, members...)
+	return m.client.ZAddNX(ctx, k, members...)
 }
 
 func (m *Client) ZAddNXCh(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZAddNXCh", k)
-	return m.client.ZAddNXCh(k, members...)
+	return m.client.ZAddArgs(ctx, k, redis.ZAddArgs{NX: true, Ch: true, Members: members})
 }
 
 func (m *Client) ZAddXX(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZAddXX", k)
-	return m.client.ZAddXX(k, members...)
+	return m.client.ZAddXX(ctx, k, members...)
 }
 
 func (m *Client) ZAddXXCh(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZAddXXCh", k)
-	return m.client.ZAddXXCh(k, members...)
+	return m.client.ZAddArgs(ctx, k, redis.ZAddArgs{XX: true, Ch: true, Members: members})
 }
 
 func (m *Client) ZAddCh(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZAddCh", k)
-	return m.client.ZAddCh(k, members...)
+	return m.client.ZAddArgs(ctx, k, redis.ZAddArgs{Ch: true, Members: members})
 }
 
 func (m *Client) ZCard(ctx context.Context, key string) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZCard", k)
-	return m.client.ZCard(k)
+	return m.client.ZCard(ctx, k)
 }
 
 func (m *Client) ZCount(ctx context.Context, key, min, max string) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZCount", k)
-	return m.client.ZCount(k, min, max)
+	return m.client.ZCount(ctx, k, min, max)
 }
 
 func (m *Client) ZRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZRange", k)
-	return m.client.ZRange(k, start, stop)
+	return m.client.ZRange(ctx, k, start, stop)
 }
 
 func (m *Client) ZRangeByLex(ctx context.Context, key string, by redis.ZRangeBy) *redis.StringSliceCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZRangeByLex", k)
-	return m.client.ZRangeByLex(k, by)
+	return m.client.ZRangeByLex(ctx, k, &by)
 }
 
 func (m *Client) ZRangeByScore(ctx context.Context, key string, by redis.ZRangeBy) *redis.StringSliceCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZRangeByScore", k)
-	return m.client.ZRangeByScore(k, by)
+	return m.client.ZRangeByScore(ctx, k, &by)
 }
 
 func (m *Client) ZRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZRangeWithScores", k)
-	return m.client.ZRangeWithScores(k, start, stop)
+	return m.client.ZRangeWithScores(ctx, k, start, stop)
 }
 
 func (m *Client) ZRevRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZRevRange", k)
-	return m.client.ZRevRange(k, start, stop)
+	return m.client.ZRevRange(ctx, k, start, stop)
 }
 
 func (m *Client) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZRevRangeWithScores", k)
-	return m.client.ZRevRangeWithScores(k, start, stop)
+	return m.client.ZRevRangeWithScores(ctx, k, start, stop)
 }
 
 func (m *Client) ZRank(ctx context.Context, key string, member string) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZRank", k)
-	return m.client.ZRank(k, member)
+	return m.client.ZRank(ctx, k, member)
 }
 
 func (m *Client) ZRevRank(ctx context.Context, key string, member string) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZRevRank", k)
-	return m.client.ZRevRank(k, member)
+	return m.client.ZRevRank(ctx, k, member)
 }
 
 func (m *Client) ZRem(ctx context.Context, key string, members []interface{}) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZRem", k)
-	return m.client.ZRem(k, members...)
+	return m.client.ZRem(ctx, k, members...)
 }
 
 func (m *Client) ZIncr(ctx context.Context, key string, member redis.Z) *redis.FloatCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZIncr", k)
-	return m.client.ZIncr(k, member)
+	return m.client.ZAddArgsIncr(ctx, k, redis.ZAddArgs{Members: []redis.Z{member}})
 }
 
 func (m *Client) ZIncrNX(ctx context.Context, key string, member redis.Z) *redis.FloatCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZIncrNX", k)
-	return m.client.ZIncrNX(k, member)
+	return m.client.ZAddArgsIncr(ctx, k, redis.ZAddArgs{NX: true, Members: []redis.Z{member}})
 }
 
 func (m *Client) ZIncrXX(ctx context.Context, key string, member redis.Z) *redis.FloatCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZIncrXX", k)
-	return m.client.ZIncrXX(k, member)
+	return m.client.ZAddArgsIncr(ctx, k, redis.ZAddArgs{XX: true, Members: []redis.Z{member}})
 }
 
 func (m *Client) ZIncrBy(ctx context.Context, key string, increment float64, member string) *redis.FloatCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZIncrBy", k)
-	return m.client.ZIncrBy(k, increment, member)
+	return m.client.ZIncrBy(ctx, k, increment, member)
 }
 
 func (m *Client) ZScore(ctx context.Context, key string, member string) *redis.FloatCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "ZScore", k)
-	return m.client.ZScore(k, member)
+	return m.client.ZScore(ctx, k, member)
 }
 
 func (m *Client) LIndex(ctx context.Context, key string, index int64) *redis.StringCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "LIndex", k)
-	return m.client.LIndex(k, index)
+	return m.client.LIndex(ctx, k, index)
 }
 
 func (m *Client) LInsert(ctx context.Context, key, op string, pivot, value interface{}) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "LInsert", k)
-	return m.client.LInsert(k, op, pivot, value)
+	return m.client.LInsert(ctx, k, op, pivot, value)
 }
 
 func (m *Client) LLen(ctx context.Context, key string) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "LLen", k)
-	return m.client.LLen(k)
+	return m.client.LLen(ctx, k)
 }
 
 func (m *Client) LPop(ctx context.Context, key string) *redis.StringCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "LPop", k)
-	return m.client.LPop(k)
+	return m.client.LPop(ctx, k)
 }
 
 func (m *Client) LPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "LPush", k)
-	return m.client.LPush(k, values...)
+	return m.client.LPush(ctx, k, values...)
 }
 
 func (m *Client) LPushX(ctx context.Context, key string, value interface{}) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "LPushX", k)
-	return m.client.LPushX(k, value)
+	return m.client.LPushX(ctx, k, value)
 }
 
 func (m *Client) LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "LRange", k)
-	return m.client.LRange(k, start, stop)
+	return m.client.LRange(ctx, k, start, stop)
 }
 
 func (m *Client) LRem(ctx context.Context, key string, count int64, value interface{}) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "LRem", k)
-	return m.client.LRem(k, count, value)
+	return m.client.LRem(ctx, k, count, value)
 }
 
 func (m *Client) LSet(ctx context.Context, key string, index int64, value interface{}) *redis.StatusCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "LSet", k)
-	return m.client.LSet(k, index, value)
+	return m.client.LSet(ctx, k, index, value)
 }
 
 func (m *Client) LTrim(ctx context.Context, key string, start, stop int64) *redis.StatusCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "LTrim", k)
-	return m.client.LTrim(k, start, stop)
+	return m.client.LTrim(ctx, k, start, stop)
 }
 
 func (m *Client) RPop(ctx context.Context, key string) *redis.StringCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "RPop", k)
-	return m.client.RPop(k)
+	return m.client.RPop(ctx, k)
 }
 
 func (m *Client) RPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "RPush", k)
-	return m.client.RPush(k, values...)
+	return m.client.RPush(ctx, k, values...)
 }
 
 func (m *Client) RPushX(ctx context.Context, key string, value interface{}) *redis.IntCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "RPushX", k)
-	return m.client.RPushX(k, value)
+	return m.client.RPushX(ctx, k, value)
+}
+
+func (m *Client) BLPop(ctx context.Context, timeout time.Duration, keys ...string) *redis.StringSliceCmd {
+	var fixKeys = make([]string, len(keys))
+	for k, v := range keys {
+		fixKeys[k] = m.fixKey(ctx, v)
+	}
+	m.logSpan(ctx, "BLPop", strings.Join(fixKeys, "||"))
+	return m.client.BLPop(ctx, timeout, fixKeys...)
+}
+
+func (m *Client) BRPop(ctx context.Context, timeout time.Duration, keys ...string) *redis.StringSliceCmd {
+	var fixKeys = make([]string, len(keys))
+	for k, v := range keys {
+		fixKeys[k] = m.fixKey(ctx, v)
+	}
+	m.logSpan(ctx, "BRPop", strings.Join(fixKeys, "||"))
+	return m.client.BRPop(ctx, timeout, fixKeys...)
+}
+
+func (m *Client) SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "SAdd", k)
+	return m.client.SAdd(ctx, k, members...)
+}
+
+func (m *Client) SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "SRem", k)
+	return m.client.SRem(ctx, k, members...)
+}
+
+func (m *Client) SCard(ctx context.Context, key string) *redis.IntCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "SCard", k)
+	return m.client.SCard(ctx, k)
+}
+
+func (m *Client) SIsMember(ctx context.Context, key string, member interface{}) *redis.BoolCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "SIsMember", k)
+	return m.client.SIsMember(ctx, k, member)
+}
+
+func (m *Client) SMembers(ctx context.Context, key string) *redis.StringSliceCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "SMembers", k)
+	return m.client.SMembers(ctx, k)
+}
+
+func (m *Client) SPop(ctx context.Context, key string) *redis.StringCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "SPop", k)
+	return m.client.SPop(ctx, k)
+}
+
+func (m *Client) SPopN(ctx context.Context, key string, count int64) *redis.StringSliceCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "SPopN", k)
+	return m.client.SPopN(ctx, k, count)
+}
+
+func (m *Client) SRandMemberN(ctx context.Context, key string, count int64) *redis.StringSliceCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "SRandMemberN", k)
+	return m.client.SRandMemberN(ctx, k, count)
+}
+
+func (m *Client) GeoAdd(ctx context.Context, key string, geoLocation ...*redis.GeoLocation) *redis.IntCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "GeoAdd", k)
+	return m.client.GeoAdd(ctx, k, geoLocation...)
+}
+
+func (m *Client) GeoDist(ctx context.Context, key string, member1, member2, unit string) *redis.FloatCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "GeoDist", k)
+	return m.client.GeoDist(ctx, k, member1, member2, unit)
+}
+
+func (m *Client) GeoPos(ctx context.Context, key string, members ...string) *redis.GeoPosCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "GeoPos", k)
+	return m.client.GeoPos(ctx, k, members...)
+}
+
+func (m *Client) GeoHash(ctx context.Context, key string, members ...string) *redis.StringSliceCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "GeoHash", k)
+	return m.client.GeoHash(ctx, k, members...)
+}
+
+// GeoRadius 使用只读的 GEORADIUS_RO，不支持 STORE
+func (m *Client) GeoRadius(ctx context.Context, key string, longitude, latitude float64, query *redis.GeoRadiusQuery) *redis.GeoLocationCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "GeoRadius", k)
+	return m.client.GeoRadius(ctx, k, longitude, latitude, query)
+}
+
+// GeoRadiusByMember 使用只读的 GEORADIUSBYMEMBER_RO，不支持 STORE
+func (m *Client) GeoRadiusByMember(ctx context.Context, key, member string, query *redis.GeoRadiusQuery) *redis.GeoLocationCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "GeoRadiusByMember", k)
+	return m.client.GeoRadiusByMember(ctx, k, member, query)
+}
+
+// GeoSearch 对应 GEOSEARCH，中心点与范围由 query 指定
+func (m *Client) GeoSearch(ctx context.Context, key string, query *redis.GeoSearchQuery) *redis.StringSliceCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "GeoSearch", k)
+	return m.client.GeoSearch(ctx, k, query)
+}
+
+func (m *Client) GeoSearchLocation(ctx context.Context, key string, query *redis.GeoSearchLocationQuery) *redis.GeoSearchLocationCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "GeoSearchLocation", k)
+	return m.client.GeoSearchLocation(ctx, k, query)
+}
+
+func (m *Client) PFAdd(ctx context.Context, key string, els ...interface{}) *redis.IntCmd {
+	k := m.fixKey(ctx, key)
+	m.logSpan(ctx, "PFAdd", k)
+	return m.client.PFAdd(ctx, k, els...)
+}
+
+func (m *Client) PFCount(ctx context.Context, keys ...string) *redis.IntCmd {
+	var fixKeys = make([]string, len(keys))
+	for k, v := range keys {
+		fixKeys[k] = m.fixKey(ctx, v)
+	}
+	m.logSpan(ctx, "PFCount", strings.Join(fixKeys, "||"))
+	return m.client.PFCount(ctx, fixKeys...)
+}
+
+func (m *Client) PFMerge(ctx context.Context, dest string, keys ...string) *redis.StatusCmd {
+	var fixKeys = make([]string, len(keys))
+	for k, v := range keys {
+		fixKeys[k] = m.fixKey(ctx, v)
+	}
+	d := m.fixKey(ctx, dest)
+	m.logSpan(ctx, "PFMerge", d+"||"+strings.Join(fixKeys, "||"))
+	return m.client.PFMerge(ctx, d, fixKeys...)
+}
+
+// Scan 返回的 key 带有 namespace 前缀，一般使用 Iterate
+func (m *Client) Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd {
+	k := m.joinKey(match)
+	m.logSpan(ctx, "Scan", k)
+	return m.client.Scan(ctx, cursor, k, count)
+}
+
+// Iterate 使用 SCAN 遍历匹配 match 的 key，每批 key 去掉 namespace 前缀后回调 fn，
+// fn 返回错误或 ctx 结束时停止遍历；SCAN 可能返回重复的 key，fn 需要能够重入；
+// cluster 模式下依次遍历每个 master 节点，fn 不会被并发调用
+// NOTE: 因超长被 hash 过的 key 无法还原，会以 hash 后的形式返回
+func (m *Client) Iterate(ctx context.Context, match string, count int64, fn func(keys []string) error) error {
+	k := m.joinKey(match)
+	m.logSpan(ctx, "Iterate", k)
+	cluster, ok := m.client.(*redis.ClusterClient)
+	if !ok {
+		return m.iterateNode(ctx, m.client, k, count, fn)
+	}
+
+	var nodes []*redis.Client
+	var mu sync.Mutex
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		mu.Lock()
+		defer mu.Unlock()
+		nodes = append(nodes, node)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// 按地址排序，保证遍历顺序稳定
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Options().Addr < nodes[j].Options().Addr
+	})
+	for _, node := range nodes {
+		if err := m.iterateNode(ctx, node, k, count, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iterateNode 在单个节点上 SCAN，match 为带有 namespace 前缀的 pattern
+func (m *Client) iterateNode(ctx context.Context, node redis.Cmdable, match string, count int64, fn func(keys []string) error) error {
+	prefix := m.joinKey("")
+	var cursor uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		keys, next, err := node.Scan(ctx, cursor, match, count).Result()
+		if err != nil {
+			return err
+		}
+
+		if len(keys) > 0 {
+			for i, key := range keys {
+				keys[i] = strings.TrimPrefix(key, prefix)
+			}
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
 }
 
 func (m *Client) TTL(ctx context.Context, key string) *redis.DurationCmd {
-	k := m.fixKey(key)
+	k := m.fixKey(ctx, key)
 	m.logSpan(ctx, "TTL", k)
-	return m.client.TTL(k)
+	return m.client.TTL(ctx, k)
 }
 
 func (m *Client) ScriptLoad(ctx context.Context, script string) *redis.StringCmd {
 	m.logSpan(ctx, "ScriptLoad", script)
-	return m.client.ScriptLoad(script)
+	return m.client.ScriptLoad(ctx, script)
 }
 
 func (m *Client) ScriptExists(ctx context.Context, scriptHash string) *redis.BoolSliceCmd {
 	m.logSpan(ctx, "ScriptExists", scriptHash)
-	return m.client.ScriptExists(scriptHash)
+	return m.client.ScriptExists(ctx, scriptHash)
 }
 
 func (m *Client) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
 	m.logSpan(ctx, "Eval", script)
 	for i, key := range keys {
-		keys[i] = m.fixKey(key)
+		keys[i] = m.fixKey(ctx, key)
 	}
-	return m.client.Eval(script, keys, args...)
+	return m.client.Eval(ctx, script, keys, args...)
 }
 
 func (m *Client) EvalSha(ctx context.Context, scriptHash string, keys []string, args ...interface{}) *redis.Cmd {
 	m.logSpan(ctx, "EvalSha", scriptHash)
 	for i, key := range keys {
-		keys[i] = m.fixKey(key)
+		keys[i] = m.fixKey(ctx, key)
 	}
-	return m.client.EvalSha(scriptHash, keys, args...)
+	return m.client.EvalSha(ctx, scriptHash, keys, args...)
 }
 
+// Close 停止接收新命令，等待执行中的命令完成后关闭连接池，ctx 结束时不再等待直接关闭
 func (m *Client) Close(ctx context.Context) error {
-	return m.client.Close()
+	atomic.StoreInt32(&m.closed, 1)
+
+	ticker := time.NewTicker(closeWaitInterval)
+	defer ticker.Stop()
+	var err error
+Loop:
+	for atomic.LoadInt64(&m.inflight) > 0 {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break Loop
+		case <-ticker.C:
+		}
+	}
+
+	if m.replicas != nil {
+		if cerr := m.replicas.close(); cerr != nil {
+			return cerr
+		}
+	}
+	if cerr := m.client.Close(); cerr != nil {
+		return cerr
+	}
+	return err
 }
@@ -0,0 +1,179 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashLongKey(t *testing.T) {
+	key := "base/report.cache." + strings.Repeat("x", 200)
+	hk := hashLongKey(key, 64)
+	assert.Equal(t, 64, len(hk))
+	assert.True(t, strings.HasPrefix(hk, "base/report.cache.xxx"))
+	assert.Equal(t, hk, hashLongKey(key, 64))
+	assert.NotEqual(t, hk, hashLongKey(key+"y", 64))
+
+	assert.Equal(t, 40, len(hashLongKey(key, 10)))
+}
+
+func TestClient_fixKey(t *testing.T) {
+	ctx := context.Background()
+	client := &Client{namespace: "base/report", wrapper: "cache", useWrapper: true}
+	long := strings.Repeat("x", 200)
+	assert.Equal(t, "base/report.cache.test", client.fixKey(ctx, "test"))
+	assert.Equal(t, "base/report.cache."+long, client.fixKey(ctx, long))
+
+	client.maxKeyLength = 64
+	assert.Equal(t, "base/report.cache.test", client.fixKey(ctx, "test"))
+	assert.Equal(t, 64, len(client.fixKey(ctx, long)))
+}
+
+func TestClient_Close(t *testing.T) {
+	client, _ := NewDefaultClient(context.TODO(), "base/test", "127.0.0.1:0", "cache", 1, false, 10*time.Millisecond)
+
+	atomic.AddInt64(&client.inflight, 1)
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, client.Close(ctx))
+
+	err := client.Get(context.TODO(), "test").Err()
+	assert.Equal(t, ErrClosed, err)
+}
+
+// newScanServer 启动只支持 SCAN 的 redis 节点，keys 分两批返回，其他命令返回 OK
+func newScanServer(t *testing.T, keys []string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveScan(conn, keys)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveScan(conn net.Conn, keys []string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "HELLO":
+			reply = "-ERR unknown command\r\n"
+		case "SCAN":
+			match := strings.TrimSuffix(args[3], "*")
+			var matched []string
+			for _, key := range keys {
+				if strings.HasPrefix(key, match) {
+					matched = append(matched, key)
+				}
+			}
+			next, batch := "1", matched[:len(matched)/2]
+			if args[1] != "0" {
+				next, batch = "0", matched[len(matched)/2:]
+			}
+			reply = fmt.Sprintf("*2\r\n$%d\r\n%s\r\n*%d\r\n", len(next), next, len(batch))
+			for _, key := range batch {
+				reply += fmt.Sprintf("$%d\r\n%s\r\n", len(key), key)
+			}
+		default:
+			reply = "+OK\r\n"
+		}
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSpace(arg)
+	}
+	return args, nil
+}
+
+func TestClient_IterateCluster(t *testing.T) {
+	ctx := context.Background()
+	addr1 := newScanServer(t, []string{"base/test.cache.k1", "base/test.cache.k2", "base/test.other"})
+	addr2 := newScanServer(t, []string{"base/test.cache.k3", "base/test.cache.k4"})
+	cluster := redis.NewClusterClient(&redis.ClusterOptions{
+		ClusterSlots: func(ctx context.Context) ([]redis.ClusterSlot, error) {
+			return []redis.ClusterSlot{
+				{Start: 0, End: 8191, Nodes: []redis.ClusterNode{{Addr: addr1}}},
+				{Start: 8192, End: SlotCount - 1, Nodes: []redis.ClusterNode{{Addr: addr2}}},
+			}, nil
+		},
+	})
+	defer cluster.Close()
+	client := &Client{client: cluster, namespace: "base/test", wrapper: "cache", useWrapper: true}
+
+	var got []string
+	err := client.Iterate(ctx, "*", 10, func(keys []string) error {
+		got = append(got, keys...)
+		return nil
+	})
+	assert.NoError(t, err)
+	sort.Strings(got)
+	assert.Equal(t, []string{"k1", "k2", "k3", "k4"}, got)
+
+	// 单节点只遍历当前节点
+	single := redis.NewClient(&redis.Options{Addr: addr1})
+	defer single.Close()
+	client.client = single
+	got = nil
+	err = client.Iterate(ctx, "*", 10, func(keys []string) error {
+		got = append(got, keys...)
+		return nil
+	})
+	assert.NoError(t, err)
+	sort.Strings(got)
+	assert.Equal(t, []string{"k1", "k2"}, got)
+	client.client = cluster
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = client.Iterate(cctx, "*", 10, func(keys []string) error {
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+}
@@ -0,0 +1,123 @@
+package redis
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+const (
+	// 从库健康检查间隔
+	replicaCheckInterval = 3 * time.Second
+	replicaPingTimeout   = time.Second
+)
+
+type replica struct {
+	addr    string
+	client  redis.UniversalClient
+	healthy int32
+}
+
+// replicaSet 只读从库，读请求在健康的从库间轮询，全部不可用时由主库处理
+type replicaSet struct {
+	replicas []*replica
+	next     uint32
+	stop     chan struct{}
+}
+
+func newReplicaSet(config *Config, hook redis.Hook) (*replicaSet, error) {
+	s := &replicaSet{
+		stop: make(chan struct{}),
+	}
+	for _, addr := range config.replicaAddrs {
+		rconfig := *config
+		rconfig.addr = addr
+		client, err := newRedisClient(&rconfig)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		client.AddHook(hook)
+		s.replicas = append(s.replicas, &replica{addr: addr, client: client, healthy: 1})
+	}
+	go s.checkLoop()
+	return s, nil
+}
+
+// pick 轮询选择健康的从库，没有可用从库时返回 nil
+func (s *replicaSet) pick() *replica {
+	n := uint32(len(s.replicas))
+	start := atomic.AddUint32(&s.next, 1)
+	for i := uint32(0); i < n; i++ {
+		r := s.replicas[(start+i)%n]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *replicaSet) check() {
+	fun := "replicaSet.check -->"
+	for _, r := range s.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaPingTimeout)
+		err := r.client.Ping(ctx).Err()
+		cancel()
+
+		healthy := int32(1)
+		if err != nil {
+			healthy = 0
+		}
+		if atomic.SwapInt32(&r.healthy, healthy) != healthy {
+			slog.Warnf(context.Background(), "%s replica:%s healthy:%v err:%v", fun, r.addr, err == nil, err)
+		}
+	}
+}
+
+func (s *replicaSet) checkLoop() {
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.check()
+		}
+	}
+}
+
+func (s *replicaSet) close() error {
+	close(s.stop)
+	var firstErr error
+	for _, r := range s.replicas {
+		if err := r.client.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// readFrom 在从库上执行只读命令，从库出错（非 redis: nil）时标记为不可用并由主库重试
+func (m *Client) readFrom(ctx context.Context, fn func(client redis.UniversalClient) redis.Cmder) {
+	if m.replicas == nil {
+		fn(m.client)
+		return
+	}
+	r := m.replicas.pick()
+	if r == nil {
+		fn(m.client)
+		return
+	}
+
+	err := fn(r.client).Err()
+	if err == nil || err == redis.Nil || err == ErrClosed {
+		return
+	}
+	atomic.StoreInt32(&r.healthy, 0)
+	slog.Warnf(ctx, "Client.readFrom --> replica:%s err:%v, retry on master", r.addr, err)
+	fn(m.client)
+}
@@ -0,0 +1,29 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicaSet_pick(t *testing.T) {
+	s := &replicaSet{
+		replicas: []*replica{
+			{addr: "r0", healthy: 1},
+			{addr: "r1", healthy: 1},
+			{addr: "r2", healthy: 0},
+		},
+	}
+
+	picked := map[string]int{}
+	for i := 0; i < 10; i++ {
+		picked[s.pick().addr]++
+	}
+	assert.Equal(t, 0, picked["r2"])
+	assert.True(t, picked["r0"] > 0 && picked["r1"] > 0)
+
+	for _, r := range s.replicas {
+		r.healthy = 0
+	}
+	assert.Nil(t, s.pick())
+}
@@ -0,0 +1,23 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/shawnfeng/sutil/scontext"
+)
+
+type routeGroupKey struct{}
+
+// WithRouteGroup 指定 ctx 中的缓存请求路由到 group 对应的实例（如灰度集群、租户独立集群），
+// 优先于 ctx 中流量控制信息携带的路由 group
+func WithRouteGroup(ctx context.Context, group string) context.Context {
+	return context.WithValue(ctx, routeGroupKey{}, group)
+}
+
+// RouteGroup 返回缓存请求的路由 group，依次取 WithRouteGroup 指定的 group、流量控制信息中的 group、默认 group
+func RouteGroup(ctx context.Context) string {
+	if group, ok := ctx.Value(routeGroupKey{}).(string); ok && len(group) > 0 {
+		return group
+	}
+	return scontext.GetControlRouteGroupWithDefault(ctx, defaultGroup)
+}
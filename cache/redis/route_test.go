@@ -0,0 +1,33 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shawnfeng/sutil/scontext"
+	"github.com/stretchr/testify/assert"
+)
+
+type testControlRouter struct {
+	group string
+}
+
+func (s *testControlRouter) GetControlRouteGroup() (string, bool) {
+	return s.group, true
+}
+
+func (s *testControlRouter) SetControlRouteGroup(group string) error {
+	s.group = group
+	return nil
+}
+
+func TestRouteGroup(t *testing.T) {
+	ctx := context.TODO()
+	assert.Equal(t, defaultGroup, RouteGroup(ctx))
+
+	ctx = context.WithValue(ctx, scontext.ContextKeyControl, &testControlRouter{"gray"})
+	assert.Equal(t, "gray", RouteGroup(ctx))
+
+	assert.Equal(t, "tenant1", RouteGroup(WithRouteGroup(ctx, "tenant1")))
+	assert.Equal(t, "gray", RouteGroup(WithRouteGroup(ctx, "")))
+}
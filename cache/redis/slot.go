@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"context"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SlotCount redis cluster 的 slot 数
+const SlotCount = 16384
+
+// Slot 按 redis cluster 的规则计算 key 所在的 slot，key 中包含非空的 {tag} 时只对 tag 计算
+func Slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % SlotCount)
+}
+
+// KeySlot 返回 key 加上 namespace 前缀之后所在的 slot
+func (m *Client) KeySlot(key string) int {
+	return Slot(m.fixKey(context.Background(), key))
+}
+
+// IsCluster 是否为 cluster 模式的实例
+func (m *Client) IsCluster() bool {
+	_, ok := m.client.(*redis.ClusterClient)
+	return ok
+}
+
+// SlotGroups cluster 模式下 keys 按 slot 分组，返回每组 key 在 keys 中的下标，组的顺序为 slot 第一次出现的顺序，
+// 用于跨 slot 的多 key 命令按组拆分后在同一个 pipeline 中发送；非 cluster 模式或所有 key 在同一个 slot 时返回 nil
+func (m *Client) SlotGroups(keys []string) [][]int {
+	if !m.IsCluster() || len(keys) < 2 {
+		return nil
+	}
+
+	index := make(map[int]int)
+	var groups [][]int
+	for i, key := range keys {
+		slot := m.KeySlot(key)
+		g, ok := index[slot]
+		if !ok {
+			g = len(groups)
+			index[slot] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	if len(groups) < 2 {
+		return nil
+	}
+	return groups
+}
+
+// crc16 CRC16-CCITT (XMODEM)，与 redis cluster 一致
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,39 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlot(t *testing.T) {
+	// 与 CLUSTER KEYSLOT 的结果一致
+	assert.Equal(t, 12182, Slot("foo"))
+	assert.Equal(t, 5061, Slot("bar"))
+	assert.Equal(t, 0, Slot(""))
+	assert.Equal(t, 0x31c3, int(crc16("123456789")))
+
+	assert.Equal(t, Slot("user1000"), Slot("{user1000}.following"))
+	assert.Equal(t, Slot("user1000"), Slot("foo{user1000}.followers"))
+	// 空 tag 时对整个 key 计算
+	assert.Equal(t, Slot("foo{}{bar}"), int(crc16("foo{}{bar}")%SlotCount))
+	assert.Equal(t, Slot("bar"), Slot("foo{bar}{zap}"))
+}
+
+func TestClient_SlotGroups(t *testing.T) {
+	keys := []string{"{a}.1", "{b}.1", "{a}.2", "{c}.1", "{b}.2"}
+
+	single := &Client{client: redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"}), namespace: "base/test"}
+	defer single.client.Close()
+	assert.False(t, single.IsCluster())
+	assert.Nil(t, single.SlotGroups(keys))
+
+	cluster := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{"127.0.0.1:0"}})
+	defer cluster.Close()
+	client := &Client{client: cluster, namespace: "base/test"}
+	assert.True(t, client.IsCluster())
+	assert.Nil(t, client.SlotGroups(keys[:1]))
+	assert.Nil(t, client.SlotGroups([]string{"{a}.1", "{a}.2"}))
+	assert.Equal(t, [][]int{{0, 2}, {1, 4}, {3}}, client.SlotGroups(keys))
+}
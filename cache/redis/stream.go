@@ -0,0 +1,76 @@
+package redis
+
+import (
+	"context"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NOTE: stream 相关命令只修正 stream 的 key，消息 id 与 group 名保持原样
+
+func (m *Client) XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd {
+	args := *a
+	args.Stream = m.fixKey(ctx, a.Stream)
+	m.logSpan(ctx, "XAdd", args.Stream)
+	return m.client.XAdd(ctx, &args)
+}
+
+func (m *Client) XLen(ctx context.Context, stream string) *redis.IntCmd {
+	k := m.fixKey(ctx, stream)
+	m.logSpan(ctx, "XLen", k)
+	return m.client.XLen(ctx, k)
+}
+
+func (m *Client) XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd {
+	k := m.fixKey(ctx, stream)
+	m.logSpan(ctx, "XGroupCreateMkStream", k)
+	return m.client.XGroupCreateMkStream(ctx, k, group, start)
+}
+
+func (m *Client) XGroupSetID(ctx context.Context, stream, group, start string) *redis.StatusCmd {
+	k := m.fixKey(ctx, stream)
+	m.logSpan(ctx, "XGroupSetID", k)
+	return m.client.XGroupSetID(ctx, k, group, start)
+}
+
+func (m *Client) XGroupDestroy(ctx context.Context, stream, group string) *redis.IntCmd {
+	k := m.fixKey(ctx, stream)
+	m.logSpan(ctx, "XGroupDestroy", k)
+	return m.client.XGroupDestroy(ctx, k, group)
+}
+
+// XReadGroup a.Streams 前一半为 stream，后一半为对应的起始 id，返回结果中的 stream 为修正后的 key
+func (m *Client) XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd {
+	args := *a
+	args.Streams = make([]string, len(a.Streams))
+	copy(args.Streams, a.Streams)
+	for i := 0; i < len(args.Streams)/2; i++ {
+		args.Streams[i] = m.fixKey(ctx, args.Streams[i])
+	}
+	m.logSpan(ctx, "XReadGroup", joinStreamKeys(args.Streams))
+	return m.client.XReadGroup(ctx, &args)
+}
+
+func (m *Client) XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd {
+	k := m.fixKey(ctx, stream)
+	m.logSpan(ctx, "XAck", k)
+	return m.client.XAck(ctx, k, group, ids...)
+}
+
+func (m *Client) XAutoClaim(ctx context.Context, a *redis.XAutoClaimArgs) *redis.XAutoClaimCmd {
+	args := *a
+	args.Stream = m.fixKey(ctx, a.Stream)
+	m.logSpan(ctx, "XAutoClaim", args.Stream)
+	return m.client.XAutoClaim(ctx, &args)
+}
+
+func joinStreamKeys(streams []string) string {
+	return strings.Join(streams[:len(streams)/2], "||")
+}
+
+func (p *Pipeline) XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd {
+	args := *a
+	args.Stream = p.fixKey(ctx, "XAdd", a.Stream)
+	return p.pipe.XAdd(ctx, &args)
+}
@@ -0,0 +1,150 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+const validatePingTimeout = 3 * time.Second
+
+// ValidateResult 单个 namespace 在某个 group 下的配置检查结果，Err 为 nil 表示配置可用
+type ValidateResult struct {
+	Namespace string
+	Group     string
+	// 实例地址，sentinel 模式下为 master 名称
+	Addr string
+	Err  error
+}
+
+func (m *ValidateResult) String() string {
+	return fmt.Sprintf("namespace:%s group:%s addr:%s err:%v", m.Namespace, m.Group, m.Addr, m.Err)
+}
+
+// check 检查配置项取值是否合理，不访问 redis
+func (m *Config) check() error {
+	if !m.useSentinel() && !m.useCluster() && len(m.addr) == 0 {
+		return fmt.Errorf("empty addr")
+	}
+	if m.poolSize <= 0 {
+		return fmt.Errorf("invalid poolsize:%d", m.poolSize)
+	}
+	if m.timeout <= 0 {
+		return fmt.Errorf("invalid timeout:%v", m.timeout)
+	}
+	if m.minIdleConns < 0 || m.minIdleConns > m.poolSize {
+		return fmt.Errorf("invalid minidleconns:%d with poolsize:%d", m.minIdleConns, m.poolSize)
+	}
+	for _, d := range []time.Duration{m.dialTimeout, m.readTimeout, m.writeTimeout, m.poolTimeout, m.idleTimeout,
+		m.opTimeouts.Get, m.opTimeouts.Set, m.opTimeouts.Del} {
+		if d < 0 {
+			return fmt.Errorf("negative timeout:%v", d)
+		}
+	}
+	for _, d := range []time.Duration{m.policy.Expire, m.policy.StaleWindow, m.policy.Jitter, m.policy.NegativeExpire} {
+		if d < 0 {
+			return fmt.Errorf("negative expire:%v", d)
+		}
+	}
+	if m.policy.Expire > 0 && m.policy.NegativeExpire > m.policy.Expire {
+		return fmt.Errorf("negativeexpire:%v longer than expire:%v", m.policy.NegativeExpire, m.policy.Expire)
+	}
+	// NOTE: hash 之后的 key 至少包含完整的 sha1 值
+	if m.maxKeyLength < 0 || (m.maxKeyLength > 0 && m.maxKeyLength < 2*sha1.Size) {
+		return fmt.Errorf("invalid maxkeylength:%d, should be 0 or at least %d", m.maxKeyLength, 2*sha1.Size)
+	}
+	if m.maxValueSize < 0 {
+		return fmt.Errorf("invalid maxvaluesize:%d", m.maxValueSize)
+	}
+	return nil
+}
+
+// ping 按配置建立连接并执行 PING，用于检查地址（包括从库）可达以及认证信息是否正确
+func (m *Config) ping(ctx context.Context) error {
+	client, err := newRedisClient(m)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	pctx, cancel := context.WithTimeout(ctx, validatePingTimeout)
+	defer cancel()
+	if err := client.Ping(pctx).Err(); err != nil {
+		return err
+	}
+
+	for _, addr := range m.replicaAddrs {
+		rconfig := *m
+		rconfig.addr = addr
+		rconfig.replicaAddrs = nil
+		if err := rconfig.ping(ctx); err != nil {
+			return fmt.Errorf("replica:%s err:%v", addr, err)
+		}
+	}
+	return nil
+}
+
+// validateConfigs 依次检查 keyParts 对应的配置，结果按 namespace、group 排序
+func validateConfigs(ctx context.Context, configer Configer, keyParts []*KeyParts) []*ValidateResult {
+	fun := "validateConfigs-->"
+
+	sort.Slice(keyParts, func(i, j int) bool {
+		if keyParts[i].Namespace != keyParts[j].Namespace {
+			return keyParts[i].Namespace < keyParts[j].Namespace
+		}
+		return keyParts[i].Group < keyParts[j].Group
+	})
+
+	var results []*ValidateResult
+	for _, parts := range keyParts {
+		result := &ValidateResult{
+			Namespace: parts.Namespace,
+			Group:     parts.Group,
+		}
+		results = append(results, result)
+
+		groupCtx := WithRouteGroup(ctx, parts.Group)
+		config, err := configer.GetConfig(groupCtx, parts.Namespace)
+		if err != nil {
+			result.Err = err
+			continue
+		}
+
+		result.Addr = config.addr
+		if config.useSentinel() {
+			result.Addr = config.masterName
+		}
+		if err = config.check(); err != nil {
+			result.Err = err
+			continue
+		}
+		result.Err = config.ping(ctx)
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			slog.Errorf(ctx, "%s invalid config %s", fun, result)
+		} else {
+			slog.Infof(ctx, "%s valid config %s", fun, result)
+		}
+	}
+	return results
+}
+
+func uniqueKeyParts(ctx context.Context, configer Configer, keys []string) []*KeyParts {
+	seen := map[KeyParts]bool{}
+	var keyParts []*KeyParts
+	for _, key := range keys {
+		parts, err := configer.ParseKey(ctx, key)
+		if err != nil || seen[*parts] {
+			continue
+		}
+		seen[*parts] = true
+		keyParts = append(keyParts, parts)
+	}
+	return keyParts
+}
@@ -0,0 +1,53 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_check(t *testing.T) {
+	valid := Config{addr: "127.0.0.1:6379", poolSize: 8, timeout: time.Second}
+	assert.NoError(t, valid.check())
+
+	cases := []func(c *Config){
+		func(c *Config) { c.addr = "" },
+		func(c *Config) { c.poolSize = 0 },
+		func(c *Config) { c.timeout = 0 },
+		func(c *Config) { c.minIdleConns = 16 },
+		func(c *Config) { c.opTimeouts.Get = -time.Second },
+		func(c *Config) { c.maxKeyLength = 32 },
+		func(c *Config) { c.maxValueSize = -1 },
+	}
+	for _, fn := range cases {
+		c := valid
+		fn(&c)
+		assert.Error(t, c.check())
+	}
+
+	c := valid
+	c.addr = ""
+	c.masterName = "mymaster"
+	c.sentinelAddrs = []string{"127.0.0.1:26379"}
+	assert.NoError(t, c.check())
+
+	c = valid
+	c.addr = ""
+	c.clusterAddrs = []string{"127.0.0.1:7000", "127.0.0.1:7001"}
+	assert.NoError(t, c.check())
+}
+
+func TestUniqueKeyParts(t *testing.T) {
+	keyParts := uniqueKeyParts(context.TODO(), &EtcdConfig{}, []string{
+		"/roc/cache/redis/base/report/default",
+		"/roc/cache/redis/base/report/default",
+		"/roc/cache/redis/base/report/gray",
+		"/roc/db/route",
+	})
+	assert.Equal(t, []*KeyParts{
+		{Namespace: "base/report", Group: "default"},
+		{Namespace: "base/report", Group: "gray"},
+	}, keyParts)
+}
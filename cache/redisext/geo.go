@@ -0,0 +1,259 @@
+package redisext
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	redis2 "github.com/redis/go-redis/v9"
+	"github.com/shawnfeng/sutil/stime"
+)
+
+type GeoLocation struct {
+	Name                      string
+	Longitude, Latitude, Dist float64
+	GeoHash                   int64
+}
+
+// GeoRadiusQuery 半径查询条件，Unit 可选 m、km、ft、mi，默认 km；Sort 可选 ASC、DESC
+// NOTE: 不支持 STORE，查询统一走只读命令
+type GeoRadiusQuery struct {
+	Radius      float64
+	Unit        string
+	WithCoord   bool
+	WithDist    bool
+	WithGeoHash bool
+	Count       int
+	Sort        string
+}
+
+// GeoSearchQuery GEOSEARCH 查询条件
+// Member 非空时以该成员为中心，否则以 Longitude、Latitude 为中心；
+// Radius 大于 0 时按半径查询，否则按 BoxWidth*BoxHeight 矩形查询；Unit 默认 km
+type GeoSearchQuery struct {
+	Member              string
+	Longitude, Latitude float64
+	Radius              float64
+	RadiusUnit          string
+	BoxWidth, BoxHeight float64
+	BoxUnit             string
+	Sort                string
+	Count               int
+	CountAny            bool
+}
+
+type GeoSearchLocationQuery struct {
+	GeoSearchQuery
+	WithCoord bool
+	WithDist  bool
+	WithHash  bool
+}
+
+type GeoPos struct {
+	Longitude, Latitude float64
+}
+
+func toRedisGeoLocations(locs []GeoLocation) (rlocs []*redis2.GeoLocation) {
+	for _, loc := range locs {
+		rlocs = append(rlocs, &redis2.GeoLocation{
+			Name:      loc.Name,
+			Longitude: loc.Longitude,
+			Latitude:  loc.Latitude,
+		})
+	}
+	return
+}
+
+func fromRedisGeoLocations(rlocs []redis2.GeoLocation) (locs []GeoLocation) {
+	for _, rloc := range rlocs {
+		locs = append(locs, GeoLocation{
+			Name:      rloc.Name,
+			Longitude: rloc.Longitude,
+			Latitude:  rloc.Latitude,
+			Dist:      rloc.Dist,
+			GeoHash:   rloc.GeoHash,
+		})
+	}
+	return
+}
+
+func toRedisGeoRadiusQuery(query GeoRadiusQuery) *redis2.GeoRadiusQuery {
+	return &redis2.GeoRadiusQuery{
+		Radius:      query.Radius,
+		Unit:        query.Unit,
+		WithCoord:   query.WithCoord,
+		WithDist:    query.WithDist,
+		WithGeoHash: query.WithGeoHash,
+		Count:       query.Count,
+		Sort:        query.Sort,
+	}
+}
+
+func toRedisGeoSearchQuery(query GeoSearchQuery) redis2.GeoSearchQuery {
+	return redis2.GeoSearchQuery{
+		Member:     query.Member,
+		Longitude:  query.Longitude,
+		Latitude:   query.Latitude,
+		Radius:     query.Radius,
+		RadiusUnit: query.RadiusUnit,
+		BoxWidth:   query.BoxWidth,
+		BoxHeight:  query.BoxHeight,
+		BoxUnit:    query.BoxUnit,
+		Sort:       query.Sort,
+		Count:      query.Count,
+		CountAny:   query.CountAny,
+	}
+}
+
+func (m *RedisExt) GeoAdd(ctx context.Context, key string, locations []GeoLocation) (n int64, err error) {
+	command := "redisext.GeoAdd"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		n, err = client.GeoAdd(ctx, m.prefixKey(key), toRedisGeoLocations(locations)...).Result()
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+// GeoDist 两个成员之间的距离，unit 为空时默认 m
+func (m *RedisExt) GeoDist(ctx context.Context, key string, member1, member2, unit string) (dist float64, err error) {
+	command := "redisext.GeoDist"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		dist, err = client.GeoDist(ctx, m.prefixKey(key), member1, member2, unit).Result()
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+// GeoPos 成员不存在时对应位置为 nil
+func (m *RedisExt) GeoPos(ctx context.Context, key string, members ...string) (r []*GeoPos, err error) {
+	command := "redisext.GeoPos"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		var rr []*redis2.GeoPos
+		rr, err = client.GeoPos(ctx, m.prefixKey(key), members...).Result()
+		for _, pos := range rr {
+			if pos == nil {
+				r = append(r, nil)
+				continue
+			}
+			r = append(r, &GeoPos{Longitude: pos.Longitude, Latitude: pos.Latitude})
+		}
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+func (m *RedisExt) GeoHash(ctx context.Context, key string, members ...string) (r []string, err error) {
+	command := "redisext.GeoHash"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		r, err = client.GeoHash(ctx, m.prefixKey(key), members...).Result()
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+// GeoRadius 以经纬度为中心按半径查询
+func (m *RedisExt) GeoRadius(ctx context.Context, key string, longitude, latitude float64, query GeoRadiusQuery) (r []GeoLocation, err error) {
+	command := "redisext.GeoRadius"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		var rr []redis2.GeoLocation
+		rr, err = client.GeoRadius(ctx, m.prefixKey(key), longitude, latitude, toRedisGeoRadiusQuery(query)).Result()
+		r = fromRedisGeoLocations(rr)
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+// GeoRadiusByMember 以已有成员为中心按半径查询，结果包含该成员本身
+func (m *RedisExt) GeoRadiusByMember(ctx context.Context, key, member string, query GeoRadiusQuery) (r []GeoLocation, err error) {
+	command := "redisext.GeoRadiusByMember"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		var rr []redis2.GeoLocation
+		rr, err = client.GeoRadiusByMember(ctx, m.prefixKey(key), member, toRedisGeoRadiusQuery(query)).Result()
+		r = fromRedisGeoLocations(rr)
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+// GeoSearch 按 GEOSEARCH 查询，只返回成员名
+func (m *RedisExt) GeoSearch(ctx context.Context, key string, query GeoSearchQuery) (r []string, err error) {
+	command := "redisext.GeoSearch"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		q := toRedisGeoSearchQuery(query)
+		r, err = client.GeoSearch(ctx, m.prefixKey(key), &q).Result()
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+// GeoSearchLocation 按 GEOSEARCH 查询，按 WithCoord/WithDist/WithHash 附带坐标、距离和 geohash
+func (m *RedisExt) GeoSearchLocation(ctx context.Context, key string, query GeoSearchLocationQuery) (r []GeoLocation, err error) {
+	command := "redisext.GeoSearchLocation"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		var rr []redis2.GeoLocation
+		rr, err = client.GeoSearchLocation(ctx, m.prefixKey(key), &redis2.GeoSearchLocationQuery{
+			GeoSearchQuery: toRedisGeoSearchQuery(query.GeoSearchQuery),
+			WithCoord:      query.WithCoord,
+			WithDist:       query.WithDist,
+			WithHash:       query.WithHash,
+		}).Result()
+		r = fromRedisGeoLocations(rr)
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
@@ -0,0 +1,73 @@
+package redisext
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var (
+	geoName = "unittest_geo"
+)
+
+func TestRedisExt_GeoAdd(t *testing.T) {
+	ctx := context.Background()
+	client := NewRedisExt("base/report", "test")
+	client.Del(ctx, geoName)
+	n, err := client.GeoAdd(ctx, geoName, []GeoLocation{
+		{Name: "Palermo", Longitude: 13.361389, Latitude: 38.115556},
+		{Name: "Catania", Longitude: 15.087269, Latitude: 37.502669},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	dist, err := client.GeoDist(ctx, geoName, "Palermo", "Catania", "km")
+	assert.NoError(t, err)
+	assert.InDelta(t, 166.2742, dist, 0.01)
+	pos, err := client.GeoPos(ctx, geoName, "Palermo", "NonExisting")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(pos))
+	assert.Nil(t, pos[1])
+	client.Del(ctx, geoName)
+}
+
+func TestRedisExt_GeoRadius(t *testing.T) {
+	ctx := context.Background()
+	client := NewRedisExt("base/report", "test")
+	client.Del(ctx, geoName)
+	_, err := client.GeoAdd(ctx, geoName, []GeoLocation{
+		{Name: "Palermo", Longitude: 13.361389, Latitude: 38.115556},
+		{Name: "Catania", Longitude: 15.087269, Latitude: 37.502669},
+	})
+	assert.NoError(t, err)
+	r, err := client.GeoRadius(ctx, geoName, 15, 37, GeoRadiusQuery{Radius: 100, Unit: "km", WithDist: true, Sort: "ASC"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(r))
+	assert.Equal(t, "Catania", r[0].Name)
+	r, err = client.GeoRadiusByMember(ctx, geoName, "Palermo", GeoRadiusQuery{Radius: 200, Unit: "km", Sort: "ASC"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(r))
+	assert.Equal(t, "Palermo", r[0].Name)
+	client.Del(ctx, geoName)
+}
+
+func TestRedisExt_GeoSearch(t *testing.T) {
+	ctx := context.Background()
+	client := NewRedisExt("base/report", "test")
+	client.Del(ctx, geoName)
+	_, err := client.GeoAdd(ctx, geoName, []GeoLocation{
+		{Name: "Palermo", Longitude: 13.361389, Latitude: 38.115556},
+		{Name: "Catania", Longitude: 15.087269, Latitude: 37.502669},
+	})
+	assert.NoError(t, err)
+	names, err := client.GeoSearch(ctx, geoName, GeoSearchQuery{Longitude: 15, Latitude: 37, Radius: 100, RadiusUnit: "km", Sort: "ASC"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Catania"}, names)
+	r, err := client.GeoSearchLocation(ctx, geoName, GeoSearchLocationQuery{
+		GeoSearchQuery: GeoSearchQuery{Member: "Palermo", BoxWidth: 400, BoxHeight: 400, BoxUnit: "km", Sort: "ASC"},
+		WithDist:       true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(r))
+	assert.Equal(t, "Palermo", r[0].Name)
+	client.Del(ctx, geoName)
+}
@@ -0,0 +1,58 @@
+package redisext
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/shawnfeng/sutil/stime"
+)
+
+// PFAdd 返回 1 表示基数估计值发生了变化
+func (m *RedisExt) PFAdd(ctx context.Context, key string, els ...interface{}) (n int64, err error) {
+	command := "redisext.PFAdd"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		n, err = client.PFAdd(ctx, m.prefixKey(key), els...).Result()
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+// PFCount 多个 key 时返回并集的基数估计值
+func (m *RedisExt) PFCount(ctx context.Context, keys ...string) (n int64, err error) {
+	command := "redisext.PFCount"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		n, err = client.PFCount(ctx, m.prefixKeys(keys)...).Result()
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+func (m *RedisExt) PFMerge(ctx context.Context, dest string, keys ...string) (s string, err error) {
+	command := "redisext.PFMerge"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		s, err = client.PFMerge(ctx, m.prefixKey(dest), m.prefixKeys(keys)...).Result()
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
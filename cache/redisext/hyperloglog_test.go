@@ -0,0 +1,36 @@
+package redisext
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRedisExt_PFAdd(t *testing.T) {
+	ctx := context.Background()
+	client := NewRedisExt("base/report", "test")
+	key1, key2, dest := "unittest_hll1", "unittest_hll2", "unittest_hll_dest"
+	client.Del(ctx, key1)
+	client.Del(ctx, key2)
+	client.Del(ctx, dest)
+	n, err := client.PFAdd(ctx, key1, "a", "b", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	_, err = client.PFAdd(ctx, key2, "c", "d")
+	assert.NoError(t, err)
+	n, err = client.PFCount(ctx, key1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	n, err = client.PFCount(ctx, key1, key2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	s, err := client.PFMerge(ctx, dest, key1, key2)
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", s)
+	n, err = client.PFCount(ctx, dest)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	client.Del(ctx, key1)
+	client.Del(ctx, key2)
+	client.Del(ctx, dest)
+}
@@ -2,6 +2,8 @@ package redisext
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/shawnfeng/sutil/stime"
@@ -214,3 +216,58 @@ func (m *RedisExt) RPushX(ctx context.Context, key string, value interface{}) (n
 	statReqErr(m.namespace, command, err)
 	return
 }
+
+// BLPop 阻塞弹出，timeout 为 0 时一直阻塞，key 为弹出元素所在的原始 key（不带前缀）
+func (m *RedisExt) BLPop(ctx context.Context, timeout time.Duration, keys ...string) (key, element string, err error) {
+	command := "redisext.BLPop"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		var r []string
+		r, err = client.BLPop(ctx, timeout, m.prefixKeys(keys)...).Result()
+		key, element = m.popResult(keys, r)
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+// BRPop 阻塞弹出，语义同 BLPop
+func (m *RedisExt) BRPop(ctx context.Context, timeout time.Duration, keys ...string) (key, element string, err error) {
+	command := "redisext.BRPop"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		var r []string
+		r, err = client.BRPop(ctx, timeout, m.prefixKeys(keys)...).Result()
+		key, element = m.popResult(keys, r)
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+// redis 返回的 key 带有 namespace 及前缀，这里还原为调用方传入的 key
+func (m *RedisExt) popResult(keys []string, r []string) (key, element string) {
+	if len(r) != 2 {
+		return
+	}
+	element = r[1]
+	// 取最长的匹配，避免 a.b 与 b 这类 key 互为后缀时误判
+	var matched int
+	for _, k := range keys {
+		pk := m.prefixKey(k)
+		if strings.HasSuffix(r[0], pk) && len(pk) > matched {
+			key, matched = k, len(pk)
+		}
+	}
+	return
+}
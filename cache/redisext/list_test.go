@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 var (
@@ -131,3 +132,20 @@ func TestRedisExt_RPop(t *testing.T) {
 	assert.Equal(t, []string{"one", "two"}, r2)
 	client.Del(ctx, listName)
 }
+
+func TestRedisExt_BLPop(t *testing.T) {
+	ctx := context.Background()
+	client := NewRedisExt("base/report", "test")
+	client.Del(ctx, listName)
+	_, err := client.RPush(ctx, listName, "one", "two")
+	assert.NoError(t, err)
+	key, r, err := client.BLPop(ctx, time.Second, "unittest_empty", listName)
+	assert.NoError(t, err)
+	assert.Equal(t, listName, key)
+	assert.Equal(t, "one", r)
+	key, r, err = client.BRPop(ctx, time.Second, listName)
+	assert.NoError(t, err)
+	assert.Equal(t, listName, key)
+	assert.Equal(t, "two", r)
+	client.Del(ctx, listName)
+}
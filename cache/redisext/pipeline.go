@@ -0,0 +1,219 @@
+package redisext
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	redis2 "github.com/redis/go-redis/v9"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/stime"
+)
+
+// Pipeline 批量发送命令，key 前缀规则与 RedisExt 一致，
+// 每条排队命令在排队时创建子 span，Exec 返回时结束；Exec 时对每条排队命令分别统计错误，并统计整体耗时
+type Pipeline struct {
+	ext  *RedisExt
+	pipe *redis.Pipeline
+
+	mu       sync.Mutex
+	commands []queuedCommand
+}
+
+type queuedCommand struct {
+	command string
+	span    opentracing.Span
+}
+
+// Pipeline 创建 pipeline，Exec 之后可以继续复用
+func (m *RedisExt) Pipeline(ctx context.Context) (*Pipeline, error) {
+	client, err := m.getRedisInstance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Pipeline{
+		ext:  m,
+		pipe: client.Pipeline(),
+	}, nil
+}
+
+// Pipelined 在 fn 中排队命令，fn 返回后统一执行
+func (m *RedisExt) Pipelined(ctx context.Context, fn func(*Pipeline) error) ([]redis2.Cmder, error) {
+	pipe, err := m.Pipeline(ctx)
+	if err != nil {
+		statReqErr(m.namespace, "redisext.Pipelined", err)
+		return nil, err
+	}
+	if err := fn(pipe); err != nil {
+		return nil, err
+	}
+	return pipe.Exec(ctx)
+}
+
+// queue 记录排队的命令并创建子 span，返回的 ctx 用于排队，key 等信息记录在子 span 中
+func (p *Pipeline) queue(ctx context.Context, command string) context.Context {
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.commands = append(p.commands, queuedCommand{command: command, span: span})
+	return ctx
+}
+
+func (p *Pipeline) takeCommands() []queuedCommand {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	commands := p.commands
+	p.commands = nil
+	return commands
+}
+
+func (p *Pipeline) Get(ctx context.Context, key string) *redis2.StringCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.Get")
+	return p.pipe.Get(ctx, p.ext.prefixKey(key))
+}
+
+func (p *Pipeline) Set(ctx context.Context, key string, val interface{}, exp time.Duration) *redis2.StatusCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.Set")
+	return p.pipe.Set(ctx, p.ext.prefixKey(key), val, exp)
+}
+
+func (p *Pipeline) SetNX(ctx context.Context, key string, val interface{}, exp time.Duration) *redis2.BoolCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.SetNX")
+	return p.pipe.SetNX(ctx, p.ext.prefixKey(key), val, exp)
+}
+
+func (p *Pipeline) Del(ctx context.Context, key string) *redis2.IntCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.Del")
+	return p.pipe.Del(ctx, p.ext.prefixKey(key))
+}
+
+func (p *Pipeline) Exists(ctx context.Context, key string) *redis2.IntCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.Exists")
+	return p.pipe.Exists(ctx, p.ext.prefixKey(key))
+}
+
+func (p *Pipeline) Expire(ctx context.Context, key string, expiration time.Duration) *redis2.BoolCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.Expire")
+	return p.pipe.Expire(ctx, p.ext.prefixKey(key), expiration)
+}
+
+func (p *Pipeline) TTL(ctx context.Context, key string) *redis2.DurationCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.TTL")
+	return p.pipe.TTL(ctx, p.ext.prefixKey(key))
+}
+
+func (p *Pipeline) Incr(ctx context.Context, key string) *redis2.IntCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.Incr")
+	return p.pipe.Incr(ctx, p.ext.prefixKey(key))
+}
+
+func (p *Pipeline) IncrBy(ctx context.Context, key string, val int64) *redis2.IntCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.IncrBy")
+	return p.pipe.IncrBy(ctx, p.ext.prefixKey(key), val)
+}
+
+func (p *Pipeline) Decr(ctx context.Context, key string) *redis2.IntCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.Decr")
+	return p.pipe.Decr(ctx, p.ext.prefixKey(key))
+}
+
+func (p *Pipeline) DecrBy(ctx context.Context, key string, val int64) *redis2.IntCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.DecrBy")
+	return p.pipe.DecrBy(ctx, p.ext.prefixKey(key), val)
+}
+
+func (p *Pipeline) HSet(ctx context.Context, key string, field string, value interface{}) *redis2.IntCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.HSet")
+	return p.pipe.HSet(ctx, p.ext.prefixKey(key), field, value)
+}
+
+func (p *Pipeline) HGet(ctx context.Context, key string, field string) *redis2.StringCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.HGet")
+	return p.pipe.HGet(ctx, p.ext.prefixKey(key), field)
+}
+
+func (p *Pipeline) HGetAll(ctx context.Context, key string) *redis2.MapStringStringCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.HGetAll")
+	return p.pipe.HGetAll(ctx, p.ext.prefixKey(key))
+}
+
+func (p *Pipeline) HDel(ctx context.Context, key string, fields ...string) *redis2.IntCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.HDel")
+	return p.pipe.HDel(ctx, p.ext.prefixKey(key), fields...)
+}
+
+func (p *Pipeline) HIncrBy(ctx context.Context, key string, field string, incr int64) *redis2.IntCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.HIncrBy")
+	return p.pipe.HIncrBy(ctx, p.ext.prefixKey(key), field, incr)
+}
+
+func (p *Pipeline) HMSet(ctx context.Context, key string, fields map[string]interface{}) *redis2.BoolCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.HMSet")
+	return p.pipe.HMSet(ctx, p.ext.prefixKey(key), fields)
+}
+
+func (p *Pipeline) LPush(ctx context.Context, key string, values ...interface{}) *redis2.IntCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.LPush")
+	return p.pipe.LPush(ctx, p.ext.prefixKey(key), values...)
+}
+
+func (p *Pipeline) RPush(ctx context.Context, key string, values ...interface{}) *redis2.IntCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.RPush")
+	return p.pipe.RPush(ctx, p.ext.prefixKey(key), values...)
+}
+
+func (p *Pipeline) LRange(ctx context.Context, key string, start, stop int64) *redis2.StringSliceCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.LRange")
+	return p.pipe.LRange(ctx, p.ext.prefixKey(key), start, stop)
+}
+
+func (p *Pipeline) ZAdd(ctx context.Context, key string, members []Z) *redis2.IntCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.ZAdd")
+	return p.pipe.ZAdd(ctx, p.ext.prefixKey(key), toRedisZSlice(members)...)
+}
+
+func (p *Pipeline) ZIncrBy(ctx context.Context, key string, increment float64, member string) *redis2.FloatCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.ZIncrBy")
+	return p.pipe.ZIncrBy(ctx, p.ext.prefixKey(key), increment, member)
+}
+
+func (p *Pipeline) ZScore(ctx context.Context, key string, member string) *redis2.FloatCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.ZScore")
+	return p.pipe.ZScore(ctx, p.ext.prefixKey(key), member)
+}
+
+func (p *Pipeline) ZRem(ctx context.Context, key string, members []interface{}) *redis2.IntCmd {
+	ctx = p.queue(ctx, "redisext.Pipeline.ZRem")
+	return p.pipe.ZRem(ctx, p.ext.prefixKey(key), members)
+}
+
+// Exec 执行所有排队的命令，err 为第一个失败命令的错误
+func (p *Pipeline) Exec(ctx context.Context) (cmds []redis2.Cmder, err error) {
+	command := "redisext.Pipeline.Exec"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(p.ext.namespace, command, st.Millisecond())
+	}()
+
+	commands := p.takeCommands()
+	cmds, err = p.pipe.Exec(ctx)
+	for i, c := range commands {
+		if i < len(cmds) {
+			statReqErr(p.ext.namespace, c.command, cmds[i].Err())
+		}
+		c.span.Finish()
+	}
+	statReqErr(p.ext.namespace, command, err)
+	return
+}
+
+// Discard 丢弃所有排队的命令
+func (p *Pipeline) Discard() {
+	for _, c := range p.takeCommands() {
+		c.span.Finish()
+	}
+	p.pipe.Discard()
+}
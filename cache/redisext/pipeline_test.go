@@ -0,0 +1,70 @@
+package redisext
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	redis2 "github.com/redis/go-redis/v9"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisExt_Pipelined(t *testing.T) {
+	ctx := context.Background()
+	client := NewRedisExt("base/report", "test")
+	key := "unittest_pipeline"
+	client.Del(ctx, key)
+
+	var incr *redis2.IntCmd
+	cmds, err := client.Pipelined(ctx, func(pipe *Pipeline) error {
+		pipe.Set(ctx, key, 1, time.Minute)
+		incr = pipe.IncrBy(ctx, key, 2)
+		pipe.Get(ctx, key)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(cmds))
+	assert.Equal(t, int64(3), incr.Val())
+
+	s, err := client.Get(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, "3", s)
+	client.Del(ctx, key)
+}
+
+func TestPipeline_spans(t *testing.T) {
+	tracer := mocktracer.New()
+	oldTracer := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(oldTracer)
+
+	// 连接不可用，Exec 失败时子 span 同样结束
+	client, _ := redis.NewDefaultClient(context.TODO(), "base/test", "127.0.0.1:0", "cache", 1, false, 10*time.Millisecond)
+	pipe := &Pipeline{ext: NewRedisExt("base/test", "test"), pipe: client.Pipeline()}
+
+	root, ctx := opentracing.StartSpanFromContext(context.TODO(), "root")
+	pipe.Set(ctx, "unittest_pipeline", 1, time.Minute)
+	pipe.Get(ctx, "unittest_pipeline")
+	assert.Empty(t, tracer.FinishedSpans())
+
+	_, err := pipe.Exec(ctx)
+	assert.Error(t, err)
+	root.Finish()
+
+	var names []string
+	rootID := root.(*mocktracer.MockSpan).SpanContext.SpanID
+	for _, span := range tracer.FinishedSpans() {
+		if span.ParentID == rootID {
+			names = append(names, span.OperationName)
+		}
+	}
+	assert.Equal(t, []string{"redisext.Pipeline.Set", "redisext.Pipeline.Get", "redisext.Pipeline.Exec"}, names)
+
+	pipe.Del(ctx, "unittest_pipeline")
+	pipe.Discard()
+	spans := tracer.FinishedSpans()
+	assert.Equal(t, "redisext.Pipeline.Del", spans[len(spans)-1].OperationName)
+}
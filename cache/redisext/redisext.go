@@ -5,12 +5,11 @@ import (
 	"fmt"
 	"time"
 
-	redis2 "github.com/go-redis/redis"
 	"github.com/opentracing/opentracing-go"
+	redis2 "github.com/redis/go-redis/v9"
 	"github.com/shawnfeng/sutil/cache"
 	"github.com/shawnfeng/sutil/cache/constants"
 	"github.com/shawnfeng/sutil/cache/redis"
-	"github.com/shawnfeng/sutil/scontext"
 	"github.com/shawnfeng/sutil/slog/slog"
 	"github.com/shawnfeng/sutil/stime"
 )
@@ -18,10 +17,12 @@ import (
 type RedisExt struct {
 	namespace string
 	prefix    string
+	// 多 key 命令按 slot 拆分
+	slotSplit bool
 }
 
 func NewRedisExt(namespace, prefix string) *RedisExt {
-	return &RedisExt{namespace, prefix}
+	return &RedisExt{namespace: namespace, prefix: prefix}
 }
 
 type Z struct {
@@ -78,6 +79,14 @@ func (m *RedisExt) prefixKey(key string) string {
 	return key
 }
 
+func (m *RedisExt) prefixKeys(keys []string) []string {
+	var prefixKeys = make([]string, len(keys))
+	for k, v := range keys {
+		prefixKeys[k] = m.prefixKey(v)
+	}
+	return prefixKeys
+}
+
 func (m *RedisExt) getRedisInstance(ctx context.Context) (client *redis.Client, err error) {
 	conf := m.getInstanceConf(ctx)
 	return redis.DefaultInstanceManager.GetInstance(ctx, conf)
@@ -85,7 +94,7 @@ func (m *RedisExt) getRedisInstance(ctx context.Context) (client *redis.Client,
 
 func (m *RedisExt) getInstanceConf(ctx context.Context) *redis.InstanceConf {
 	return &redis.InstanceConf{
-		Group:     scontext.GetControlRouteGroupWithDefault(ctx, constants.DefaultRouteGroup),
+		Group:     redis.RouteGroup(ctx),
 		Namespace: m.namespace,
 		Wrapper:   cache.WrapperTypeRedisExt,
 	}
@@ -121,7 +130,11 @@ func (m *RedisExt) MGet(ctx context.Context, keys ...string) (v []interface{}, e
 		for k, v := range keys {
 			prefixKey[k] = m.prefixKey(v)
 		}
-		v, err = client.MGet(ctx, prefixKey...).Result()
+		if groups := m.slotGroups(client, prefixKey); len(groups) > 1 {
+			v, err = mgetBySlot(ctx, client, prefixKey, groups)
+		} else {
+			v, err = client.MGet(ctx, prefixKey...).Result()
+		}
 	}
 	statReqErr(m.namespace, command, err)
 	return
@@ -154,14 +167,20 @@ func (m *RedisExt) MSet(ctx context.Context, pairs ...interface{}) (s string, er
 	client, err := m.getRedisInstance(ctx)
 	if err == nil {
 		var prefixPairs = make([]interface{}, len(pairs))
+		var prefixKeys = make([]string, 0, len(pairs)/2)
 		for k, v := range pairs {
 			if (k & 1) == 0 {
 				prefixPairs[k] = m.prefixKey(v.(string))
+				prefixKeys = append(prefixKeys, prefixPairs[k].(string))
 			} else {
 				prefixPairs[k] = v
 			}
 		}
-		s, err = client.MSet(ctx, prefixPairs...).Result()
+		if groups := m.slotGroups(client, prefixKeys); len(groups) > 1 {
+			s, err = msetBySlot(ctx, client, prefixPairs, groups)
+		} else {
+			s, err = client.MSet(ctx, prefixPairs...).Result()
+		}
 	}
 	statReqErr(m.namespace, command, err)
 	return
@@ -338,7 +357,9 @@ func (m *RedisExt) HSet(ctx context.Context, key string, field string, value int
 	}()
 	client, err := m.getRedisInstance(ctx)
 	if err == nil {
-		b, err = client.HSet(ctx, m.prefixKey(key), field, value).Result()
+		var n int64
+		n, err = client.HSet(ctx, m.prefixKey(key), field, value).Result()
+		b = n > 0
 	}
 	statReqErr(m.namespace, command, err)
 	return
@@ -498,7 +519,12 @@ func (m *RedisExt) HMSet(ctx context.Context, key string, fields map[string]inte
 	}()
 	client, err := m.getRedisInstance(ctx)
 	if err == nil {
-		s, err = client.HMSet(ctx, m.prefixKey(key), fields).Result()
+		var ok bool
+		ok, err = client.HMSet(ctx, m.prefixKey(key), fields).Result()
+		// NOTE: go-redis v9 的 HMSet 返回 bool，这里保持原有的 "OK" 返回值
+		if ok {
+			s = "OK"
+		}
 	}
 	statReqErr(m.namespace, command, err)
 	return
@@ -514,7 +540,7 @@ func (m *RedisExt) HSetNX(ctx context.Context, key string, field string, val int
 	}()
 	client, err := m.getRedisInstance(ctx)
 	if err == nil {
-		b, err = client.HSet(ctx, m.prefixKey(key), field, val).Result()
+		b, err = client.HSetNX(ctx, m.prefixKey(key), field, val).Result()
 	}
 	statReqErr(m.namespace, command, err)
 	return
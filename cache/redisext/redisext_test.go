@@ -249,3 +249,18 @@ func TestRedisExt_MGet(t *testing.T) {
 	assert.Contains(t, []string{"getvalue1", "getvalue2"}, resp[0])
 	assert.Contains(t, []string{"getvalue1", "getvalue2"}, resp[1])
 }
+
+func TestRedisExt_SlotSplit(t *testing.T) {
+	ctx := context.Background()
+	re := NewRedisExt("test/test", "test").EnableSlotSplit()
+
+	_, err := re.MSet(ctx, "{a}.1", "1", "{b}.1", "2", "{a}.2", "3")
+	assert.NoError(t, err)
+	v, err := re.MGet(ctx, "{a}.1", "{b}.1", "{a}.2", "{c}.1")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"1", "2", "3", nil}, v)
+
+	n, err := re.DelMulti(ctx, "{a}.1", "{b}.1", "{a}.2", "{c}.1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+}
@@ -0,0 +1,35 @@
+package redisext
+
+import (
+	"context"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/shawnfeng/sutil/stime"
+)
+
+// Iterate 使用 SCAN 分批遍历匹配 pattern 的 key，避免 KEYS 阻塞 redis，
+// 回调的 key 为不带前缀的原始 key，batchSize 为每次 SCAN 的 COUNT 提示值；
+// fn 返回错误或 ctx 被取消时停止遍历并返回该错误；namespace 配置为 cluster 时依次遍历每个 master 节点
+// NOTE: SCAN 只保证遍历开始前已存在且期间未删除的 key 一定会被返回，同一个 key 可能被返回多次
+func (m *RedisExt) Iterate(ctx context.Context, pattern string, batchSize int64, fn func(keys []string) error) (err error) {
+	command := "redisext.Iterate"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		prefix := m.prefixKey("")
+		err = client.Iterate(ctx, m.prefixKey(pattern), batchSize, func(keys []string) error {
+			for i, key := range keys {
+				keys[i] = strings.TrimPrefix(key, prefix)
+			}
+			return fn(keys)
+		})
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
@@ -0,0 +1,55 @@
+package redisext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestRedisExt_Iterate(t *testing.T) {
+	ctx := context.Background()
+	client := NewRedisExt("base/report", "test")
+	var expected []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("unittest_scan_%02d", i)
+		expected = append(expected, key)
+		_, err := client.Set(ctx, key, i, time.Minute)
+		assert.NoError(t, err)
+	}
+
+	seen := map[string]bool{}
+	err := client.Iterate(ctx, "unittest_scan_*", 5, func(keys []string) error {
+		for _, key := range keys {
+			seen[key] = true
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	var got []string
+	for key := range seen {
+		got = append(got, key)
+	}
+	sort.Strings(got)
+	assert.Equal(t, expected, got)
+
+	stop := errors.New("stop")
+	err = client.Iterate(ctx, "unittest_scan_*", 5, func(keys []string) error {
+		return stop
+	})
+	assert.Equal(t, stop, err)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = client.Iterate(cctx, "unittest_scan_*", 5, func(keys []string) error {
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+
+	for _, key := range expected {
+		client.Del(ctx, key)
+	}
+}
@@ -0,0 +1,120 @@
+package redisext
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/shawnfeng/sutil/stime"
+)
+
+func (m *RedisExt) SAdd(ctx context.Context, key string, members ...interface{}) (n int64, err error) {
+	command := "redisext.SAdd"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		n, err = client.SAdd(ctx, m.prefixKey(key), members...).Result()
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+func (m *RedisExt) SRem(ctx context.Context, key string, members ...interface{}) (n int64, err error) {
+	command := "redisext.SRem"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		n, err = client.SRem(ctx, m.prefixKey(key), members...).Result()
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+func (m *RedisExt) SCard(ctx context.Context, key string) (n int64, err error) {
+	command := "redisext.SCard"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		n, err = client.SCard(ctx, m.prefixKey(key)).Result()
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+func (m *RedisExt) SIsMember(ctx context.Context, key string, member interface{}) (b bool, err error) {
+	command := "redisext.SIsMember"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		b, err = client.SIsMember(ctx, m.prefixKey(key), member).Result()
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+func (m *RedisExt) SMembers(ctx context.Context, key string) (r []string, err error) {
+	command := "redisext.SMembers"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		r, err = client.SMembers(ctx, m.prefixKey(key)).Result()
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+func (m *RedisExt) SPop(ctx context.Context, key string) (member string, err error) {
+	command := "redisext.SPop"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		member, err = client.SPop(ctx, m.prefixKey(key)).Result()
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+func (m *RedisExt) SRandMemberN(ctx context.Context, key string, count int64) (r []string, err error) {
+	command := "redisext.SRandMemberN"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		r, err = client.SRandMemberN(ctx, m.prefixKey(key), count).Result()
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
@@ -0,0 +1,54 @@
+package redisext
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var (
+	setName = "unittest_set"
+)
+
+func TestRedisExt_SAdd(t *testing.T) {
+	ctx := context.Background()
+	client := NewRedisExt("base/report", "test")
+	client.Del(ctx, setName)
+	n, err := client.SAdd(ctx, setName, "one", "two", "two")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = client.SCard(ctx, setName)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	client.Del(ctx, setName)
+}
+
+func TestRedisExt_SIsMember(t *testing.T) {
+	ctx := context.Background()
+	client := NewRedisExt("base/report", "test")
+	client.Del(ctx, setName)
+	_, err := client.SAdd(ctx, setName, "one")
+	assert.NoError(t, err)
+	b, err := client.SIsMember(ctx, setName, "one")
+	assert.NoError(t, err)
+	assert.True(t, b)
+	b, err = client.SIsMember(ctx, setName, "two")
+	assert.NoError(t, err)
+	assert.False(t, b)
+	client.Del(ctx, setName)
+}
+
+func TestRedisExt_SMembers(t *testing.T) {
+	ctx := context.Background()
+	client := NewRedisExt("base/report", "test")
+	client.Del(ctx, setName)
+	_, err := client.SAdd(ctx, setName, "one", "two")
+	assert.NoError(t, err)
+	n, err := client.SRem(ctx, setName, "two")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	r, err := client.SMembers(ctx, setName)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"one"}, r)
+	client.Del(ctx, setName)
+}
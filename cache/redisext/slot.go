@@ -0,0 +1,128 @@
+package redisext
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	redis2 "github.com/redis/go-redis/v9"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/stime"
+)
+
+// EnableSlotSplit 多 key 命令（MGet、MSet、DelMulti）跨 slot 时按 slot 拆分，
+// 在同一个 pipeline 中发送并按原顺序合并结果，调用方式不变；
+// cluster 模式的实例总是拆分，其他实例如转发到 cluster 且不支持跨 slot 的代理需要调用
+func (m *RedisExt) EnableSlotSplit() *RedisExt {
+	m.slotSplit = true
+	return m
+}
+
+// slotGroups 按 slot 分组，返回每组 key 在 keys 中的下标，组的顺序为 slot 第一次出现的顺序；
+// 不需要拆分时返回 nil
+func (m *RedisExt) slotGroups(client *redis.Client, keys []string) [][]int {
+	if client.IsCluster() {
+		return client.SlotGroups(keys)
+	}
+	if !m.slotSplit || len(keys) < 2 {
+		return nil
+	}
+
+	index := make(map[int]int)
+	var groups [][]int
+	for i, key := range keys {
+		slot := client.KeySlot(key)
+		g, ok := index[slot]
+		if !ok {
+			g = len(groups)
+			index[slot] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+func mgetBySlot(ctx context.Context, client *redis.Client, keys []string, groups [][]int) ([]interface{}, error) {
+	pipe := client.Pipeline()
+	cmds := make([]*redis2.SliceCmd, len(groups))
+	for g, group := range groups {
+		gkeys := make([]string, len(group))
+		for j, i := range group {
+			gkeys[j] = keys[i]
+		}
+		cmds[g] = pipe.MGet(ctx, gkeys...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	v := make([]interface{}, len(keys))
+	for g, group := range groups {
+		vals := cmds[g].Val()
+		for j, i := range group {
+			if j < len(vals) {
+				v[i] = vals[j]
+			}
+		}
+	}
+	return v, nil
+}
+
+// msetBySlot NOTE: 跨 slot 时不再是原子操作，部分 slot 可能写入成功
+func msetBySlot(ctx context.Context, client *redis.Client, pairs []interface{}, groups [][]int) (string, error) {
+	pipe := client.Pipeline()
+	for _, group := range groups {
+		gpairs := make([]interface{}, 0, len(group)*2)
+		for _, i := range group {
+			gpairs = append(gpairs, pairs[2*i], pairs[2*i+1])
+		}
+		pipe.MSet(ctx, gpairs...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+// DelMulti 删除多个 key，返回删除的数量，开启 EnableSlotSplit 时按 slot 拆分
+func (m *RedisExt) DelMulti(ctx context.Context, keys ...string) (n int64, err error) {
+	command := "redisext.DelMulti"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+	client, err := m.getRedisInstance(ctx)
+	if err == nil {
+		prefixKeys := m.prefixKeys(keys)
+		if groups := m.slotGroups(client, prefixKeys); len(groups) > 1 {
+			n, err = delBySlot(ctx, client, prefixKeys, groups)
+		} else {
+			n, err = client.Del(ctx, prefixKeys...).Result()
+		}
+	}
+	statReqErr(m.namespace, command, err)
+	return
+}
+
+func delBySlot(ctx context.Context, client *redis.Client, keys []string, groups [][]int) (int64, error) {
+	pipe := client.Pipeline()
+	cmds := make([]*redis2.IntCmd, len(groups))
+	for g, group := range groups {
+		gkeys := make([]string, len(group))
+		for j, i := range group {
+			gkeys[j] = keys[i]
+		}
+		cmds[g] = pipe.Del(ctx, gkeys...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for _, cmd := range cmds {
+		n += cmd.Val()
+	}
+	return n, nil
+}
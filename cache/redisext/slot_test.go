@@ -0,0 +1,21 @@
+package redisext
+
+import (
+	"testing"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisExt_slotGroups(t *testing.T) {
+	client := &redis.Client{}
+	keys := []string{"{a}.1", "{b}.1", "{a}.2", "{c}.1", "{b}.2"}
+
+	m := NewRedisExt("base/test", "test")
+	assert.Nil(t, m.slotGroups(client, keys))
+
+	m.EnableSlotSplit()
+	assert.Nil(t, m.slotGroups(client, keys[:1]))
+	assert.Equal(t, [][]int{{0, 2}, {1, 4}, {3}}, m.slotGroups(client, keys))
+	assert.Equal(t, [][]int{{0, 1}}, m.slotGroups(client, []string{"{a}.1", "{a}.2"}))
+}
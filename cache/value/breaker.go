@@ -0,0 +1,238 @@
+package value
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 熔断的默认配置
+const (
+	breakerWindow        = time.Second            // 统计窗口
+	breakerThreshold     = 10                     // 窗口内失败次数超过该值时熔断
+	breakerGap           = 10 * time.Second       // 熔断持续时间
+	breakerSlowThreshold = 200 * time.Millisecond // 超过该耗时的请求视为失败
+)
+
+var ErrBreakerOpen = errors.New("cache breaker open, redis is unavailable")
+
+// BreakerOptions 熔断配置，零值字段使用默认值
+type BreakerOptions struct {
+	// Disable 关闭熔断，redis 出错时不再降级为直接 load
+	Disable bool
+	// Window 统计窗口
+	Window time.Duration
+	// Threshold 窗口内失败次数超过该值时熔断
+	Threshold int
+	// Gap 熔断持续时间
+	Gap time.Duration
+	// SlowThreshold 超过该耗时的请求视为失败
+	SlowThreshold time.Duration
+}
+
+func (o BreakerOptions) withDefaults() BreakerOptions {
+	if o.Window <= 0 {
+		o.Window = breakerWindow
+	}
+	if o.Threshold <= 0 {
+		o.Threshold = breakerThreshold
+	}
+	if o.Gap <= 0 {
+		o.Gap = breakerGap
+	}
+	if o.SlowThreshold <= 0 {
+		o.SlowThreshold = breakerSlowThreshold
+	}
+	return o
+}
+
+// 简单计数法熔断，按 namespace 统计，同一个 namespace 的 Cache 共享同一个 redis 实例
+// 熔断结束后进入半开状态，每个统计窗口只放行一个探测请求，探测成功后恢复，失败则继续熔断
+type breaker struct {
+	mu          sync.Mutex
+	opts        BreakerOptions
+	windowStart time.Time
+	failures    int
+	openUntil   time.Time
+	halfOpen    bool
+	probeUntil  time.Time
+}
+
+func newBreaker(opts BreakerOptions) *breaker {
+	return &breaker{opts: opts.withDefaults()}
+}
+
+var breakers = struct {
+	sync.Mutex
+	m map[string]*breaker
+}{m: make(map[string]*breaker)}
+
+func getBreaker(namespace string) *breaker {
+	breakers.Lock()
+	defer breakers.Unlock()
+	b, ok := breakers.m[namespace]
+	if !ok {
+		b = newBreaker(BreakerOptions{})
+		breakers.m[namespace] = b
+	}
+	return b
+}
+
+// SetBreaker 修改 namespace 的熔断配置，同一个 namespace 的 Cache 共享熔断状态与配置，以最后一次设置为准；
+// redis 响应较慢的 namespace 可以调大 SlowThreshold，或通过 Disable 关闭熔断
+func (m *Cache) SetBreaker(opts BreakerOptions) *Cache {
+	getBreaker(m.namespace).setOptions(opts)
+	return m
+}
+
+func (b *breaker) setOptions(opts BreakerOptions) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.opts = opts.withDefaults()
+	b.windowStart = time.Time{}
+	b.failures = 0
+	if b.opts.Disable {
+		b.openUntil = time.Time{}
+		b.halfOpen = false
+		b.probeUntil = time.Time{}
+	}
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.opts.Disable {
+		return true
+	}
+	now := time.Now()
+	if now.Before(b.openUntil) {
+		return false
+	}
+	if !b.halfOpen {
+		return true
+	}
+	// 探测请求的结果没有记录时，下一个窗口再放行一个
+	if now.Before(b.probeUntil) {
+		return false
+	}
+	b.probeUntil = now.Add(b.opts.Window)
+	return true
+}
+
+// isBreakerFailure key 不存在与调用方取消或超时不算失败
+func isBreakerFailure(err error) bool {
+	if err == nil || err.Error() == redis.RedisNil {
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// record 记录一次 redis 请求的结果，返回是否开始熔断
+func (b *breaker) record(err error, cost time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.opts.Disable {
+		return false
+	}
+	failed := isBreakerFailure(err) || cost >= b.opts.SlowThreshold
+	now := time.Now()
+
+	if b.halfOpen && !now.Before(b.openUntil) {
+		if failed {
+			b.openUntil = now.Add(b.opts.Gap)
+			b.probeUntil = time.Time{}
+			return true
+		}
+		b.halfOpen = false
+		b.probeUntil = time.Time{}
+		b.windowStart = time.Time{}
+		b.failures = 0
+		return false
+	}
+	if !failed {
+		return false
+	}
+
+	if now.Sub(b.windowStart) > b.opts.Window {
+		b.windowStart = now
+		b.failures = 0
+	}
+	b.failures++
+	if b.failures > b.opts.Threshold && !now.Before(b.openUntil) {
+		b.openUntil = now.Add(b.opts.Gap)
+		b.halfOpen = true
+		b.failures = 0
+		return true
+	}
+	return false
+}
+
+func (m *Cache) recordBreaker(ctx context.Context, err error, cost time.Duration) {
+	fun := "Cache.recordBreaker -->"
+	// NOTE: 值过大在发送到 redis 之前拒绝，不代表 redis 异常
+	if err == ErrValueTooLarge {
+		err = nil
+	}
+	if getBreaker(m.namespace).record(err, cost) {
+		_metricBreakerOpen.With("namespace", m.namespace).Inc()
+		slog.Errorf(ctx, "%s breaker open, namespace: %s last err: %v cost: %v", fun, m.namespace, err, cost)
+	}
+}
+
+// getInstance 熔断期间直接返回 ErrBreakerOpen，不再尝试连接 redis；
+// 获取实例的错误来自配置，不代表 redis 异常，不计入熔断
+func (m *Cache) getInstance(ctx context.Context) (*redis.Client, error) {
+	if !getBreaker(m.namespace).allow() {
+		return nil, ErrBreakerOpen
+	}
+	return redis.DefaultInstanceManager.GetInstance(ctx, m.getInstanceConf(ctx))
+}
+
+// getInvalidateInstance 删除缓存不受熔断限制，熔断期间跳过删除会在 redis 恢复后读到旧值
+func (m *Cache) getInvalidateInstance(ctx context.Context) (*redis.Client, error) {
+	return redis.DefaultInstanceManager.GetInstance(ctx, m.getInstanceConf(ctx))
+}
+
+// EnableLocalFallback 熔断期间将 load 的结果缓存在本地内存中，最多缓存 size 个 key，每个 key 缓存 expire
+func (m *Cache) EnableLocalFallback(size int, expire time.Duration) *Cache {
+	m.fallback = newLocalCache(size, expire)
+	return m
+}
+
+// loadFallback 熔断期间绕过 redis 直接调用 load，结果不写入 redis
+func (m *Cache) loadFallback(ctx context.Context, key, value interface{}) error {
+	fun := "Cache.loadFallback -->"
+
+	skey, err := m.prefixKey(key)
+	if err != nil {
+		return err
+	}
+
+	if m.fallback != nil {
+		if data, ok := m.fallback.get(skey); ok {
+			return json.Unmarshal(data, value)
+		}
+	}
+
+	v, err := m.load(ctx, key)
+	if err != nil {
+		slog.Warnf(ctx, "%s load err, cache key:%v err:%v", fun, key, err)
+		return err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Errorf(ctx, "%s marshal err, cache key:%v err:%v", fun, key, err)
+		return err
+	}
+
+	if m.fallback != nil {
+		m.fallback.set(skey, data)
+	}
+	return json.Unmarshal(data, value)
+}
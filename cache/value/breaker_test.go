@@ -0,0 +1,85 @@
+package value
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(BreakerOptions{})
+	assert.True(t, b.allow())
+
+	for i := 0; i < breakerThreshold; i++ {
+		assert.False(t, b.record(errors.New("dial tcp: i/o timeout"), time.Millisecond))
+	}
+	assert.False(t, b.record(errors.New("redis: nil"), time.Millisecond))
+	assert.False(t, b.record(nil, time.Millisecond))
+	assert.True(t, b.allow())
+
+	assert.True(t, b.record(nil, breakerSlowThreshold))
+	assert.False(t, b.allow())
+
+	// 半开状态只放行一个探测请求，探测失败时继续熔断
+	b.openUntil = time.Now()
+	assert.True(t, b.allow())
+	assert.False(t, b.allow())
+	assert.True(t, b.record(errors.New("dial tcp: i/o timeout"), time.Millisecond))
+	assert.False(t, b.allow())
+
+	// 探测成功后恢复
+	b.openUntil = time.Now()
+	assert.True(t, b.allow())
+	assert.False(t, b.record(nil, time.Millisecond))
+	assert.True(t, b.allow())
+	assert.True(t, b.allow())
+}
+
+func TestBreaker_contextErr(t *testing.T) {
+	b := newBreaker(BreakerOptions{Threshold: 1})
+	for i := 0; i < breakerThreshold; i++ {
+		assert.False(t, b.record(context.Canceled, time.Millisecond))
+		assert.False(t, b.record(fmt.Errorf("get: %w", context.DeadlineExceeded), time.Millisecond))
+	}
+	assert.True(t, b.allow())
+}
+
+func TestBreaker_options(t *testing.T) {
+	b := newBreaker(BreakerOptions{Threshold: 2, SlowThreshold: time.Second, Gap: time.Minute})
+	assert.False(t, b.record(nil, breakerSlowThreshold))
+	assert.False(t, b.record(errors.New("dial tcp: i/o timeout"), time.Millisecond))
+	assert.False(t, b.record(errors.New("dial tcp: i/o timeout"), time.Millisecond))
+	assert.True(t, b.record(nil, time.Second))
+	assert.False(t, b.allow())
+
+	// 关闭后立即恢复，不再熔断
+	b.setOptions(BreakerOptions{Disable: true})
+	assert.True(t, b.allow())
+	for i := 0; i < breakerThreshold*2; i++ {
+		assert.False(t, b.record(errors.New("dial tcp: i/o timeout"), time.Second))
+	}
+	assert.True(t, b.allow())
+
+	c := NewCache("base/testbreaker", "test", time.Minute, nil).SetBreaker(BreakerOptions{Disable: true})
+	assert.True(t, getBreaker(c.namespace).opts.Disable)
+}
+
+func TestLocalCache(t *testing.T) {
+	c := newLocalCache(2, time.Minute)
+	c.set("a", []byte("1"))
+	c.set("b", []byte("2"))
+	c.set("c", []byte("3"))
+	assert.Equal(t, 2, len(c.items))
+	data, ok := c.get("c")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("3"), data)
+
+	c = newLocalCache(2, -time.Second)
+	c.set("a", []byte("1"))
+	_, ok = c.get("a")
+	assert.False(t, ok)
+}
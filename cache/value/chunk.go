@@ -0,0 +1,179 @@
+package value
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	redis2 "github.com/redis/go-redis/v9"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 分片存储时主 key 保存的索引记录前缀，json 编码的值不会以 \x00 开头
+const chunkIndexPrefix = "\x00chunk:"
+
+type chunkIndex struct {
+	Count    int    `json:"count"`
+	Size     int    `json:"size"`
+	Checksum uint32 `json:"checksum"`
+}
+
+// EnableChunk 开启分片存储，编码后超过 chunkSize 字节的值拆分为 key.part.N 存储，
+// 主 key 保存分片数与校验和，读取时拼接并校验，分片缺失或校验失败时视为未命中重新 load；
+// 超过 maxChunkCount 个分片的值返回 ErrValueTooLarge；Del 时先读取主 key 的索引，与分片一起删除
+// NOTE: 分片逐个读写，cluster 模式下分片与主 key 可以在不同的 slot
+func (m *Cache) EnableChunk(chunkSize int) *Cache {
+	m.chunkSize = chunkSize
+	return m
+}
+
+func chunkKey(skey string, i int) string {
+	return fmt.Sprintf("%s.part.%d", skey, i)
+}
+
+// setData 写入缓存，依次记录数据版本、压缩、加密，超过 chunkSize 时分片写入，索引最后写入，保证读到索引时分片已经存在，
+// 指定 tags 时在同一个 pipeline 中记录 tag 与 key 的关系
+func (m *Cache) setData(ctx context.Context, client *redis.Client, skey string, data []byte, expire time.Duration, tags []string) error {
+	data, err := m.encodeData(ctx, data)
+	if err != nil {
+		return err
+	}
+	if err := m.checkValueSize(ctx, client, skey, data); err != nil {
+		return err
+	}
+
+	if len(tags) == 0 && (m.chunkSize <= 0 || len(data) <= m.chunkSize) {
+		return client.Set(ctx, skey, data, expire).Err()
+	}
+
+	pipe := client.Pipeline()
+	if err := m.queueData(ctx, pipe, skey, data, expire); err != nil {
+		pipe.Discard()
+		return err
+	}
+	queueTags(ctx, pipe, skey, tags, expire)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// encodeData 依次记录数据版本、压缩、加密
+func (m *Cache) encodeData(ctx context.Context, data []byte) ([]byte, error) {
+	data, err := m.compressData(m.wrapSchema(data))
+	if err != nil {
+		return nil, err
+	}
+	return m.encryptData(ctx, data)
+}
+
+// unwrapData 与 setData 相反，依次拼接分片、解密、解压、校验数据版本
+func (m *Cache) unwrapData(ctx context.Context, client *redis.Client, key interface{}, skey string, data []byte) ([]byte, error) {
+	data, err := m.readChunks(ctx, client, skey, data)
+	if err != nil {
+		return nil, err
+	}
+	data, err = m.decryptData(ctx, skey, data)
+	if err != nil {
+		return nil, err
+	}
+	data, err = m.decompressData(ctx, skey, data)
+	if err != nil {
+		return nil, err
+	}
+	return m.checkSchema(ctx, key, skey, data)
+}
+
+// queueData 将已经编码的 data 写入 pipe，超过 chunkSize 时分片，多个 key 需要在同一个 pipeline 中写入时使用
+func (m *Cache) queueData(ctx context.Context, pipe *redis.Pipeline, skey string, data []byte, expire time.Duration) error {
+	if m.chunkSize <= 0 || len(data) <= m.chunkSize {
+		pipe.Set(ctx, skey, data, expire)
+		return nil
+	}
+
+	index := chunkIndex{
+		Count:    (len(data) + m.chunkSize - 1) / m.chunkSize,
+		Size:     len(data),
+		Checksum: crc32.ChecksumIEEE(data),
+	}
+	indexData, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < index.Count; i++ {
+		end := (i + 1) * m.chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		pipe.Set(ctx, chunkKey(skey, i), data[i*m.chunkSize:end], expire)
+	}
+	pipe.Set(ctx, skey, append([]byte(chunkIndexPrefix), indexData...), expire)
+	return nil
+}
+
+// readChunks data 为分片索引时读取并拼接分片，否则原样返回
+func (m *Cache) readChunks(ctx context.Context, client *redis.Client, skey string, data []byte) ([]byte, error) {
+	fun := "Cache.readChunks -->"
+	if !bytes.HasPrefix(data, []byte(chunkIndexPrefix)) {
+		return data, nil
+	}
+
+	var index chunkIndex
+	if err := json.Unmarshal(data[len(chunkIndexPrefix):], &index); err != nil {
+		slog.Errorf(ctx, "%s invalid chunk index, key: %s err: %v", fun, skey, err)
+		return nil, errors.New(redis.RedisNil)
+	}
+
+	pipe := client.Pipeline()
+	cmds := make([]*redis2.StringCmd, index.Count)
+	for i := range cmds {
+		cmds[i] = pipe.Get(ctx, chunkKey(skey, i))
+	}
+	// NOTE: 分片缺失时 Exec 返回 redis.Nil，在下面逐个检查
+	_, _ = pipe.Exec(ctx)
+
+	buf := make([]byte, 0, index.Size)
+	for i, cmd := range cmds {
+		part, err := cmd.Bytes()
+		if err != nil {
+			if err.Error() != redis.RedisNil {
+				return nil, err
+			}
+			slog.Warnf(ctx, "%s chunk missing, key: %s", fun, chunkKey(skey, i))
+			return nil, errors.New(redis.RedisNil)
+		}
+		buf = append(buf, part...)
+	}
+
+	if len(buf) != index.Size || crc32.ChecksumIEEE(buf) != index.Checksum {
+		slog.Warnf(ctx, "%s checksum mismatch, key: %s size: %d expect: %d", fun, skey, len(buf), index.Size)
+		return nil, errors.New(redis.RedisNil)
+	}
+	return buf, nil
+}
+
+// delData 删除 skey，开启分片存储时读取索引并删除分片
+func (m *Cache) delData(ctx context.Context, client *redis.Client, skey string) error {
+	if m.chunkSize <= 0 {
+		return client.Del(ctx, skey).Err()
+	}
+
+	data, err := client.Get(ctx, skey).Bytes()
+	if err != nil && err.Error() != redis.RedisNil {
+		return err
+	}
+	pipe := client.Pipeline()
+	pipe.Del(ctx, skey)
+	var index chunkIndex
+	if bytes.HasPrefix(data, []byte(chunkIndexPrefix)) && json.Unmarshal(data[len(chunkIndexPrefix):], &index) == nil {
+		for i := 0; i < index.Count; i++ {
+			pipe.Del(ctx, chunkKey(skey, i))
+		}
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,20 @@
+package value
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkKey(t *testing.T) {
+	assert.Equal(t, "test/1.part.0", chunkKey("test/1", 0))
+	assert.Equal(t, "test/1.part.12", chunkKey("test/1", 12))
+}
+
+func TestReadChunks_notIndex(t *testing.T) {
+	c := NewCache("base/test", "test", 60, nil).EnableChunk(4)
+	data, err := c.readChunks(context.TODO(), nil, "test/1", []byte(`"abcdefgh"`))
+	assert.NoError(t, err)
+	assert.Equal(t, `"abcdefgh"`, string(data))
+}
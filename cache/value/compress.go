@@ -0,0 +1,64 @@
+package value
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 压缩后的值前缀，后面为 gzip 数据
+const compressPrefix = "\x00gz:"
+
+// EnableCompression 开启 gzip 压缩，记录数据版本之后、加密之前压缩（加密后的数据无法压缩），
+// 只压缩不小于 minSize 字节的值；读取时按前缀判断，开启前写入的未压缩值仍可读取
+func (m *Cache) EnableCompression(minSize int) *Cache {
+	if minSize <= 0 {
+		minSize = 1
+	}
+	m.compressMinSize = minSize
+	return m
+}
+
+func (m *Cache) compressData(data []byte) ([]byte, error) {
+	if m.compressMinSize <= 0 || len(data) < m.compressMinSize {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(compressPrefix)
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	// 压缩后没有变小时保存原值
+	if buf.Len() >= len(data) {
+		return data, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressData 不带压缩前缀的值原样返回，解压失败时视为未命中，重新 load
+func (m *Cache) decompressData(ctx context.Context, skey string, data []byte) ([]byte, error) {
+	fun := "Cache.decompressData -->"
+	if !bytes.HasPrefix(data, []byte(compressPrefix)) {
+		return data, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data[len(compressPrefix):]))
+	if err == nil {
+		data, err = ioutil.ReadAll(r)
+	}
+	if err != nil {
+		slog.Warnf(ctx, "%s decompress err, key: %s err: %v", fun, skey, err)
+		return nil, errors.New(redis.RedisNil)
+	}
+	return data, nil
+}
@@ -0,0 +1,65 @@
+package value
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_compressData(t *testing.T) {
+	ctx := context.TODO()
+	c := NewCache("base/test", "test", time.Minute, nil).EnableCompression(64)
+
+	small := []byte(`{"Id":1}`)
+	data, err := c.compressData(small)
+	assert.NoError(t, err)
+	assert.Equal(t, small, data)
+
+	large := []byte(`{"name":"` + strings.Repeat("test", 100) + `"}`)
+	data, err = c.compressData(large)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte(compressPrefix)))
+	assert.True(t, len(data) < len(large))
+
+	plain, err := c.decompressData(ctx, "test.1", data)
+	assert.NoError(t, err)
+	assert.Equal(t, large, plain)
+
+	// 开启前写入的值原样返回
+	plain, err = c.decompressData(ctx, "test.1", small)
+	assert.NoError(t, err)
+	assert.Equal(t, small, plain)
+
+	_, err = c.decompressData(ctx, "test.1", []byte(compressPrefix+"invalid"))
+	assert.EqualError(t, err, redis.RedisNil)
+}
+
+func TestCache_compressWithEncryption(t *testing.T) {
+	ctx := context.TODO()
+	keyFunc := func(ctx context.Context, keyID string) ([]byte, error) {
+		return []byte("0123456789abcdef"), nil
+	}
+	c := NewCache("base/test", "test", time.Minute, nil).
+		EnableCompression(64).
+		EnableEncryption("k1", keyFunc)
+
+	// 先压缩再加密，加密后的值不再压缩
+	large := []byte(`{"name":"` + strings.Repeat("test", 100) + `"}`)
+	data, err := c.encodeData(ctx, large)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte(encryptPrefix)))
+	assert.True(t, len(data) < len(large))
+
+	compressed, err := c.decryptData(ctx, "test.1", data)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(compressed, []byte(compressPrefix)))
+
+	plain, err := c.unwrapData(ctx, nil, 1, "test.1", data)
+	assert.NoError(t, err)
+	assert.Equal(t, large, plain)
+}
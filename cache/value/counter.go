@@ -0,0 +1,107 @@
+package value
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+	"github.com/shawnfeng/sutil/stime"
+)
+
+// 计数器没有过期时间时（第一次增加）设置过期时间，过期时间为 0 时不过期
+const counterIncrScript = "local v = redis.call('incrby', KEYS[1], ARGV[1]) if tonumber(ARGV[2]) > 0 and redis.call('pttl', KEYS[1]) == -1 then redis.call('pexpire', KEYS[1], ARGV[2]) end return v"
+
+// Incr 计数器加一，key 不存在时从 0 开始，第一次增加时设置过期时间，过期时间与缓存一致
+// NOTE: 计数器直接存储整数，不经过分片、加密，也不会触发 load
+func (m *Cache) Incr(ctx context.Context, key interface{}) (int64, error) {
+	return m.incrBy(ctx, "cache.value.Incr", key, 1)
+}
+
+// Decr 计数器减一
+func (m *Cache) Decr(ctx context.Context, key interface{}) (int64, error) {
+	return m.incrBy(ctx, "cache.value.Decr", key, -1)
+}
+
+// IncrBy 计数器增加 delta，delta 可以为负数
+func (m *Cache) IncrBy(ctx context.Context, key interface{}, delta int64) (int64, error) {
+	return m.incrBy(ctx, "cache.value.IncrBy", key, delta)
+}
+
+// GetCounter 读取计数器，key 不存在时返回 0
+func (m *Cache) GetCounter(ctx context.Context, key interface{}) (int64, error) {
+	fun := "Cache.GetCounter -->"
+	command := "cache.value.GetCounter"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+
+	skey, err := m.prefixKey(key)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		return 0, err
+	}
+
+	client, err := m.getInstance(ctx)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.namespace)
+		return 0, err
+	}
+
+	now := time.Now()
+	opCtx, cancel := opContext(ctx, client, opGet)
+	defer cancel()
+	n, err := client.Get(opCtx, skey).Int64()
+	m.recordBreaker(ctx, err, time.Since(now))
+	if err != nil && err.Error() == redis.RedisNil {
+		return 0, nil
+	}
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		m.fireRedisError(ctx, key, time.Since(now), err)
+		return 0, fmt.Errorf("get counter key: %v err: %s", key, err.Error())
+	}
+	return n, nil
+}
+
+func (m *Cache) incrBy(ctx context.Context, command string, key interface{}, delta int64) (int64, error) {
+	fun := "Cache.incrBy -->"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+
+	skey, err := m.prefixKey(key)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		return 0, err
+	}
+
+	client, err := m.getInstance(ctx)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.namespace)
+		return 0, err
+	}
+
+	now := time.Now()
+	opCtx, cancel := opContext(ctx, client, opSet)
+	defer cancel()
+	expire := expireOf(m.policy(client), false)
+	n, err := client.Eval(opCtx, counterIncrScript, []string{skey}, delta, expire.Milliseconds()).Int64()
+	m.recordBreaker(ctx, err, time.Since(now))
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		m.fireRedisError(ctx, key, time.Since(now), err)
+		return 0, fmt.Errorf("incr cache key: %v err: %s", key, err.Error())
+	}
+	return n, nil
+}
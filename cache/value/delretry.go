@@ -0,0 +1,295 @@
+package value
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	redis2 "github.com/redis/go-redis/v9"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+	"gitlab.pri.ibanyu.com/middleware/seaweed/xstat/xmetric/xprometheus"
+)
+
+const (
+	defaultDelRetryMaxRetries = 10
+	defaultDelRetryBackoff    = 100 * time.Millisecond
+	defaultDelRetryMaxBackoff = 30 * time.Second
+	defaultDelRetryQueueSize  = 10000
+	delRetryTick              = 100 * time.Millisecond
+	delRetryRecoverInterval   = 10 * time.Second // 开启持久化时从 redis 恢复待重试 key 的间隔
+)
+
+var (
+	_metricDelPending = xprometheus.NewGauge(&xprometheus.GaugeVecOpts{
+		Namespace:  namespace,
+		Subsystem:  subsystem,
+		Name:       "del_pending",
+		Help:       "cache.value failed deletes waiting for retry",
+		LabelNames: []string{"namespace"},
+	})
+	_metricDelDropped = xprometheus.NewCounter(&xprometheus.CounterVecOpts{
+		Namespace:  namespace,
+		Subsystem:  subsystem,
+		Name:       "del_dropped_total",
+		Help:       "cache.value failed deletes given up after retries or queue full",
+		LabelNames: []string{"namespace"},
+	})
+)
+
+// DelRetryOptions Del 失败后的重试参数，零值使用默认值
+type DelRetryOptions struct {
+	// MaxRetries 最大重试次数，超过后放弃并计入 del_dropped_total
+	MaxRetries int
+	// Backoff 首次重试的间隔，之后每次翻倍，不超过 MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// QueueSize 内存中最多等待重试的 key 数，超出时直接放弃
+	QueueSize int
+	// Persist 同时将待重试的 key 记录到 redis，进程重启后由任意实例继续重试，
+	// 记录失败时只在内存中重试
+	Persist bool
+}
+
+type delRetryItem struct {
+	Group string `json:"group"`
+	Key   string `json:"key"`
+
+	attempts int
+	next     time.Time
+}
+
+func (i *delRetryItem) id() string {
+	return i.Group + "\x00" + i.Key
+}
+
+// delRetryQueue 异步重试失败的删除，避免 redis 抖动时旧值一直保留到过期
+type delRetryQueue struct {
+	cache *Cache
+	opts  DelRetryOptions
+
+	mu          sync.Mutex
+	pending     map[string]*delRetryItem
+	lastRecover time.Time
+}
+
+// EnableDelRetry 开启 Del 失败重试，Del 失败时仍然返回错误，同时在后台按退避间隔重试删除
+func (m *Cache) EnableDelRetry(opts *DelRetryOptions) *Cache {
+	o := DelRetryOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = defaultDelRetryMaxRetries
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = defaultDelRetryBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = defaultDelRetryMaxBackoff
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaultDelRetryQueueSize
+	}
+
+	m.delRetry = &delRetryQueue{
+		cache:   m,
+		opts:    o,
+		pending: make(map[string]*delRetryItem),
+	}
+	go m.delRetry.loop()
+	return m
+}
+
+// PendingDeletes 返回等待重试删除的 key 数
+func (m *Cache) PendingDeletes() int {
+	if m.delRetry == nil {
+		return 0
+	}
+	m.delRetry.mu.Lock()
+	defer m.delRetry.mu.Unlock()
+	return len(m.delRetry.pending)
+}
+
+func (q *delRetryQueue) persistKey() string {
+	return fmt.Sprintf("__delretry.%s", q.cache.prefix)
+}
+
+func (q *delRetryQueue) backoff(attempts int) time.Duration {
+	d := q.opts.Backoff
+	for i := 1; i < attempts && d < q.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > q.opts.MaxBackoff {
+		d = q.opts.MaxBackoff
+	}
+	return d
+}
+
+// add 记录一次失败的删除
+func (q *delRetryQueue) add(ctx context.Context, skey string) {
+	fun := "delRetryQueue.add -->"
+	item := &delRetryItem{Group: redis.RouteGroup(ctx), Key: skey}
+	if !q.push(item) {
+		_metricDelDropped.With("namespace", q.cache.namespace).Inc()
+		slog.Errorf(ctx, "%s queue full, drop key: %s", fun, skey)
+		return
+	}
+	if q.opts.Persist {
+		q.persist(ctx, item)
+	}
+}
+
+func (q *delRetryQueue) push(item *delRetryItem) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.pending[item.id()]; ok {
+		return true
+	}
+	if len(q.pending) >= q.opts.QueueSize {
+		return false
+	}
+	item.next = time.Now().Add(q.backoff(1))
+	q.pending[item.id()] = item
+	_metricDelPending.With("namespace", q.cache.namespace).Set(float64(len(q.pending)))
+	return true
+}
+
+func (q *delRetryQueue) remove(item *delRetryItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.pending, item.id())
+	_metricDelPending.With("namespace", q.cache.namespace).Set(float64(len(q.pending)))
+}
+
+// due 返回到达重试时间的 key
+func (q *delRetryQueue) due(now time.Time) []*delRetryItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var items []*delRetryItem
+	for _, item := range q.pending {
+		if !now.Before(item.next) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (q *delRetryQueue) loop() {
+	ticker := time.NewTicker(delRetryTick)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if q.opts.Persist && now.Sub(q.lastRecover) >= delRetryRecoverInterval {
+			q.lastRecover = now
+			q.recover()
+		}
+		for _, item := range q.due(now) {
+			q.retry(item)
+		}
+	}
+}
+
+func (q *delRetryQueue) retry(item *delRetryItem) {
+	fun := "delRetryQueue.retry -->"
+	ctx := redis.WithRouteGroup(context.Background(), item.Group)
+	err := q.del(ctx, item.Key)
+	if err == nil {
+		q.remove(item)
+		if q.opts.Persist {
+			q.unpersist(ctx, item)
+		}
+		return
+	}
+
+	q.mu.Lock()
+	item.attempts++
+	giveUp := item.attempts >= q.opts.MaxRetries
+	item.next = time.Now().Add(q.backoff(item.attempts + 1))
+	q.mu.Unlock()
+	if !giveUp {
+		return
+	}
+
+	slog.Errorf(ctx, "%s give up, key: %s attempts: %d err: %v", fun, item.Key, item.attempts, err)
+	_metricDelDropped.With("namespace", q.cache.namespace).Inc()
+	q.remove(item)
+	if q.opts.Persist {
+		q.unpersist(ctx, item)
+	}
+}
+
+func (q *delRetryQueue) del(ctx context.Context, skey string) error {
+	client, err := q.cache.getInvalidateInstance(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	opCtx, cancel := opContext(ctx, client, opDel)
+	defer cancel()
+	err = q.cache.delData(opCtx, client, skey)
+	q.cache.recordBreaker(ctx, err, time.Since(now))
+	if q.cache.hotKeys != nil {
+		q.cache.hotKeys.remove(skey)
+	}
+	return err
+}
+
+// persist 记录待重试的 key，记录统一保存在默认分组的实例中
+func (q *delRetryQueue) persist(ctx context.Context, item *delRetryItem) {
+	fun := "delRetryQueue.persist -->"
+	member, err := json.Marshal(item)
+	if err != nil {
+		return
+	}
+	client, err := q.cache.getInvalidateInstance(context.Background())
+	if err != nil {
+		return
+	}
+	opCtx, cancel := opContext(ctx, client, opSet)
+	defer cancel()
+	if err := client.ZAdd(opCtx, q.persistKey(), redis2.Z{Score: float64(time.Now().Unix()), Member: string(member)}).Err(); err != nil {
+		slog.Warnf(ctx, "%s key: %s err: %v", fun, item.Key, err)
+	}
+}
+
+func (q *delRetryQueue) unpersist(ctx context.Context, item *delRetryItem) {
+	member, err := json.Marshal(item)
+	if err != nil {
+		return
+	}
+	client, err := q.cache.getInvalidateInstance(context.Background())
+	if err != nil {
+		return
+	}
+	opCtx, cancel := opContext(ctx, client, opDel)
+	defer cancel()
+	_ = client.ZRem(opCtx, q.persistKey(), []interface{}{string(member)}).Err()
+}
+
+// recover 读取 redis 中记录的待重试 key，包括其他进程未完成的删除，
+// 记录统一保存在默认分组的实例中
+func (q *delRetryQueue) recover() {
+	fun := "delRetryQueue.recover -->"
+	ctx := context.Background()
+	client, err := q.cache.getInvalidateInstance(context.Background())
+	if err != nil {
+		return
+	}
+	opCtx, cancel := opContext(ctx, client, opGet)
+	defer cancel()
+	members, err := client.ZRange(opCtx, q.persistKey(), 0, int64(q.opts.QueueSize)-1).Result()
+	if err != nil {
+		slog.Warnf(ctx, "%s err: %v", fun, err)
+		return
+	}
+	for _, member := range members {
+		item := &delRetryItem{}
+		if err := json.Unmarshal([]byte(member), item); err != nil {
+			continue
+		}
+		q.push(item)
+	}
+}
@@ -0,0 +1,47 @@
+package value
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelRetryQueue_backoff(t *testing.T) {
+	c := NewCache("base/test", "test", time.Minute, nil).EnableDelRetry(&DelRetryOptions{
+		Backoff:    100 * time.Millisecond,
+		MaxBackoff: time.Second,
+	})
+	q := c.delRetry
+	assert.Equal(t, defaultDelRetryMaxRetries, q.opts.MaxRetries)
+	assert.Equal(t, 100*time.Millisecond, q.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, q.backoff(2))
+	assert.Equal(t, 800*time.Millisecond, q.backoff(4))
+	assert.Equal(t, time.Second, q.backoff(5))
+	assert.Equal(t, time.Second, q.backoff(100))
+}
+
+func TestDelRetryQueue_push(t *testing.T) {
+	c := NewCache("base/test", "test", time.Minute, nil)
+	q := &delRetryQueue{
+		cache:   c,
+		opts:    DelRetryOptions{QueueSize: 2, Backoff: time.Hour, MaxBackoff: time.Hour},
+		pending: make(map[string]*delRetryItem),
+	}
+	c.delRetry = q
+
+	ctx := redis.WithRouteGroup(context.TODO(), "g1")
+	assert.True(t, q.push(&delRetryItem{Group: redis.RouteGroup(ctx), Key: "test.1"}))
+	assert.True(t, q.push(&delRetryItem{Group: "g1", Key: "test.1"}))
+	assert.True(t, q.push(&delRetryItem{Group: "g2", Key: "test.1"}))
+	assert.False(t, q.push(&delRetryItem{Group: "g1", Key: "test.2"}))
+	assert.Equal(t, 2, c.PendingDeletes())
+
+	assert.Empty(t, q.due(time.Now()))
+	assert.Len(t, q.due(time.Now().Add(2*time.Hour)), 2)
+
+	q.remove(&delRetryItem{Group: "g1", Key: "test.1"})
+	assert.Equal(t, 1, c.PendingDeletes())
+}
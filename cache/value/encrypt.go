@@ -0,0 +1,114 @@
+package value
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 加密后的值前缀，格式为 prefix + len(keyID) + keyID + nonce + ciphertext
+const encryptPrefix = "\x00enc:"
+
+// KeyFunc 根据密钥 ID 返回 AES 密钥（16/24/32 字节），通常从配置或密钥服务中读取
+type KeyFunc func(ctx context.Context, keyID string) ([]byte, error)
+
+type encryptor struct {
+	keyID string
+	keys  KeyFunc
+}
+
+// EnableEncryption 开启 AES-GCM 加密，序列化及 EnableCompression 压缩之后、分片之前加密，
+// 写入时使用 keyID 对应的密钥，读取时按值中记录的 keyID 取密钥解密，
+// 轮换密钥时只需修改 keyID 并保证旧密钥在缓存过期前仍可通过 keys 取到
+func (m *Cache) EnableEncryption(keyID string, keys KeyFunc) *Cache {
+	m.encryptor = &encryptor{
+		keyID: keyID,
+		keys:  keys,
+	}
+	return m
+}
+
+func (e *encryptor) aead(ctx context.Context, keyID string) (cipher.AEAD, error) {
+	key, err := e.keys(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (e *encryptor) encrypt(ctx context.Context, data []byte) ([]byte, error) {
+	if len(e.keyID) > 255 {
+		return nil, fmt.Errorf("key id too long: %d", len(e.keyID))
+	}
+	gcm, err := e.aead(ctx, e.keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, len(encryptPrefix)+1+len(e.keyID)+len(nonce)+len(data)+gcm.Overhead())
+	buf = append(buf, encryptPrefix...)
+	buf = append(buf, byte(len(e.keyID)))
+	buf = append(buf, e.keyID...)
+	buf = append(buf, nonce...)
+	// keyID 作为附加数据参与认证，防止被篡改为其他密钥
+	return gcm.Seal(buf, nonce, data, []byte(e.keyID)), nil
+}
+
+func (e *encryptor) decrypt(ctx context.Context, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(encryptPrefix)) {
+		return nil, errors.New("value not encrypted")
+	}
+	data = data[len(encryptPrefix):]
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return nil, errors.New("invalid encrypted value")
+	}
+	keyID := string(data[1 : 1+int(data[0])])
+	data = data[1+int(data[0]):]
+
+	gcm, err := e.aead(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("invalid encrypted value")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(keyID))
+}
+
+func (m *Cache) encryptData(ctx context.Context, data []byte) ([]byte, error) {
+	if m.encryptor == nil {
+		return data, nil
+	}
+	return m.encryptor.encrypt(ctx, data)
+}
+
+// decryptData 解密失败（密钥缺失、开启加密前写入的明文等）时视为未命中，重新 load
+func (m *Cache) decryptData(ctx context.Context, skey string, data []byte) ([]byte, error) {
+	fun := "Cache.decryptData -->"
+	if m.encryptor == nil {
+		return data, nil
+	}
+	plain, err := m.encryptor.decrypt(ctx, data)
+	if err != nil {
+		slog.Warnf(ctx, "%s decrypt err, key: %s err: %v", fun, skey, err)
+		return nil, errors.New(redis.RedisNil)
+	}
+	return plain, nil
+}
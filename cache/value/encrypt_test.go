@@ -0,0 +1,45 @@
+package value
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptor(t *testing.T) {
+	ctx := context.TODO()
+	keys := map[string][]byte{
+		"k1": []byte("0123456789abcdef"),
+		"k2": []byte("0123456789abcdef0123456789abcdef"),
+	}
+	keyFunc := func(ctx context.Context, keyID string) ([]byte, error) {
+		if key, ok := keys[keyID]; ok {
+			return key, nil
+		}
+		return nil, errors.New("key not found")
+	}
+
+	e1 := &encryptor{keyID: "k1", keys: keyFunc}
+	data, err := e1.encrypt(ctx, []byte(`{"name":"test"}`))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "test")
+
+	// 轮换后仍可解密旧密钥写入的值
+	e2 := &encryptor{keyID: "k2", keys: keyFunc}
+	plain, err := e2.decrypt(ctx, data)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"test"}`, string(plain))
+
+	data[len(data)-1] ^= 0xff
+	_, err = e2.decrypt(ctx, data)
+	assert.Error(t, err)
+
+	_, err = e2.decrypt(ctx, []byte(`{"name":"test"}`))
+	assert.Error(t, err)
+
+	delete(keys, "k2")
+	_, err = e2.encrypt(ctx, []byte("test"))
+	assert.Error(t, err)
+}
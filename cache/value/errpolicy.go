@@ -0,0 +1,113 @@
+package value
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// ErrorPolicy load 或序列化失败时如何处理缓存
+type ErrorPolicy int
+
+const (
+	// ErrorPolicyDefault load 失败时写入占位，序列化失败时不写缓存
+	ErrorPolicyDefault ErrorPolicy = iota
+	// ErrorPolicySkipWrite 出错时不写缓存，下次请求重新 load
+	ErrorPolicySkipWrite
+	// ErrorPolicyTombstone 出错时写入占位，NegativeExpire 内的请求直接返回该错误，不再 load
+	ErrorPolicyTombstone
+	// ErrorPolicyFailFast 出错时不写缓存并删除已有的缓存，避免 Load 失败后继续读到旧值
+	ErrorPolicyFailFast
+)
+
+func (p ErrorPolicy) String() string {
+	switch p {
+	case ErrorPolicyDefault:
+		return "default"
+	case ErrorPolicySkipWrite:
+		return "skipwrite"
+	case ErrorPolicyTombstone:
+		return "tombstone"
+	case ErrorPolicyFailFast:
+		return "failfast"
+	default:
+		return "unknown"
+	}
+}
+
+// 占位值前缀，后面为错误信息
+const tombstonePrefix = "\x00err:"
+
+// SetErrorPolicy 设置出错时的缓存策略
+func (m *Cache) SetErrorPolicy(policy ErrorPolicy) *Cache {
+	m.errorPolicy = policy
+	return m
+}
+
+// tombstoneOnError 返回出错时是否写入占位，marshal 表示序列化失败
+func (m *Cache) tombstoneOnError(marshal bool) bool {
+	switch m.errorPolicy {
+	case ErrorPolicyTombstone:
+		return true
+	case ErrorPolicyDefault:
+		return !marshal
+	default:
+		return false
+	}
+}
+
+func tombstone(err error) []byte {
+	return append([]byte(tombstonePrefix), err.Error()...)
+}
+
+// cachedLoadError 占位值中记录的 load 错误，读到占位值属于缓存命中，不是 redis 出错
+type cachedLoadError struct {
+	msg string
+}
+
+func (e *cachedLoadError) Error() string {
+	return e.msg
+}
+
+func isCachedLoadError(err error) bool {
+	_, ok := err.(*cachedLoadError)
+	return ok
+}
+
+// decodeValue 解析缓存的值，占位值返回其中记录的错误
+// NOTE: 兼容旧版本直接缓存的错误信息，无法解析时以原始内容作为错误返回
+func decodeValue(data []byte, value interface{}) error {
+	if bytes.HasPrefix(data, []byte(tombstonePrefix)) {
+		return &cachedLoadError{msg: string(data[len(tombstonePrefix):])}
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return &cachedLoadError{msg: string(data)}
+	}
+	return nil
+}
+
+// delOnError 删除已有的缓存，失败时只打印日志
+func (m *Cache) delOnError(ctx context.Context, key interface{}, skey string) {
+	fun := "Cache.delOnError -->"
+	client, err := m.getInvalidateInstance(ctx)
+	if err != nil {
+		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.namespace)
+		return
+	}
+
+	now := time.Now()
+	opCtx, cancel := opContext(ctx, client, opDel)
+	defer cancel()
+	err = m.delData(opCtx, client, skey)
+	m.recordBreaker(ctx, err, time.Since(now))
+	if m.hotKeys != nil {
+		m.hotKeys.remove(skey)
+	}
+	if err != nil {
+		m.fireRedisError(ctx, key, time.Since(now), err)
+		slog.Errorf(ctx, "%s del err, cache key:%v err:%v", fun, key, err)
+	}
+}
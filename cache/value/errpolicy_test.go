@@ -0,0 +1,64 @@
+package value
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_tombstoneOnError(t *testing.T) {
+	c := NewCache("base/test", "test", time.Minute, nil)
+	assert.True(t, c.tombstoneOnError(false))
+	assert.False(t, c.tombstoneOnError(true))
+
+	c.SetErrorPolicy(ErrorPolicyTombstone)
+	assert.True(t, c.tombstoneOnError(true))
+
+	for _, p := range []ErrorPolicy{ErrorPolicySkipWrite, ErrorPolicyFailFast} {
+		c.SetErrorPolicy(p)
+		assert.False(t, c.tombstoneOnError(false))
+		assert.False(t, c.tombstoneOnError(true))
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	var test Test
+	assert.NoError(t, decodeValue([]byte(`{"Id":1}`), &test))
+	assert.Equal(t, int64(1), test.Id)
+
+	err := decodeValue(tombstone(errors.New("not found")), &test)
+	assert.EqualError(t, err, "not found")
+	assert.True(t, isCachedLoadError(err))
+
+	err = decodeValue([]byte("not found"), &test)
+	assert.EqualError(t, err, "not found")
+	assert.True(t, isCachedLoadError(err))
+}
+
+func TestCache_GetTombstone(t *testing.T) {
+	c := NewCache("base/test", "test", time.Minute, nil).EnableHotKey(1, time.Minute)
+	var hits, redisErrs int
+	c.OnHit(func(ctx context.Context, key interface{}, latency time.Duration, err error) {
+		hits++
+	})
+	c.OnRedisError(func(ctx context.Context, key interface{}, latency time.Duration, err error) {
+		redisErrs++
+	})
+
+	// 通过热点 key 的本地副本读到占位值，不访问 redis
+	skey, err := c.prefixKey("tombstone")
+	assert.NoError(t, err)
+	for i := 0; i < hotKeySampleRate*2; i++ {
+		c.hotKeys.access(skey)
+	}
+	c.hotKeys.store(skey, tombstone(errors.New("not found")))
+
+	var test Test
+	err = c.Get(context.Background(), "tombstone", &test)
+	assert.EqualError(t, err, "not found")
+	assert.Equal(t, 1, hits)
+	assert.Equal(t, 0, redisErrs)
+}
@@ -0,0 +1,350 @@
+package value
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+	"github.com/shawnfeng/sutil/stime"
+)
+
+// 只在 hash 已存在时更新字段，避免生成只有部分字段的缓存
+const hashSetFieldScript = "if redis.call('exists', KEYS[1]) == 1 then return redis.call('hset', KEYS[1], ARGV[1], ARGV[2]) else return -1 end"
+
+// HashCache 将 load 返回的结构体按 json 字段拆分存储为 redis hash，
+// 每个字段的值为该字段的 json 编码，支持按字段读取与局部更新；
+// 只提供适用于 hash 的方法，Cache 的 Set、Warm 等方法写入 string，之后的 HGETALL 会返回 WRONGTYPE
+type HashCache struct {
+	cache *Cache
+}
+
+// load 需要返回可被 json 序列化为对象的值（struct 或 map）
+func NewHashCache(namespace, prefix string, expire time.Duration, load LoadFunc) *HashCache {
+	return &HashCache{
+		cache: NewCache(namespace, prefix, expire, load),
+	}
+}
+
+// SetBreaker 同 Cache.SetBreaker
+func (m *HashCache) SetBreaker(opts BreakerOptions) *HashCache {
+	m.cache.SetBreaker(opts)
+	return m
+}
+
+// OnHit 同 Cache.OnHit
+func (m *HashCache) OnHit(fn HookFunc) *HashCache {
+	m.cache.OnHit(fn)
+	return m
+}
+
+// OnMiss 同 Cache.OnMiss
+func (m *HashCache) OnMiss(fn HookFunc) *HashCache {
+	m.cache.OnMiss(fn)
+	return m
+}
+
+// OnLoadError 同 Cache.OnLoadError
+func (m *HashCache) OnLoadError(fn HookFunc) *HashCache {
+	m.cache.OnLoadError(fn)
+	return m
+}
+
+// OnRedisError 同 Cache.OnRedisError
+func (m *HashCache) OnRedisError(fn HookFunc) *HashCache {
+	m.cache.OnRedisError(fn)
+	return m
+}
+
+func (m *HashCache) Stats() Stats {
+	return m.cache.Stats()
+}
+
+// Del 删除整个 hash
+func (m *HashCache) Del(ctx context.Context, key interface{}) error {
+	return m.cache.Del(ctx, key)
+}
+
+func (m *HashCache) Exists(ctx context.Context, key interface{}) (bool, error) {
+	return m.cache.Exists(ctx, key)
+}
+
+func (m *HashCache) TTL(ctx context.Context, key interface{}) (time.Duration, error) {
+	return m.cache.TTL(ctx, key)
+}
+
+func (m *HashCache) Get(ctx context.Context, key, value interface{}) error {
+	fun := "HashCache.Get -->"
+	command := "cache.value.hash.Get"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.cache.namespace, command, st.Millisecond())
+	}()
+
+	now := time.Now()
+	fields, err := m.getFieldsFromCache(ctx, key)
+	if err == ErrBreakerOpen {
+		statReqErr(m.cache.namespace, command, err)
+		m.cache.fireRedisError(ctx, key, time.Since(now), err)
+		return m.cache.loadFallback(ctx, key, value)
+	}
+	if err != nil {
+		statReqErr(m.cache.namespace, command, err)
+		m.cache.fireRedisError(ctx, key, time.Since(now), err)
+		slog.Errorf(ctx, "%s cache key: %v err: %v", fun, key, err)
+		return fmt.Errorf("%s cache key: %v err: %v", fun, key, err)
+	}
+
+	if len(fields) > 0 {
+		_metricHits.With("namespace", m.cache.namespace, "command", command).Inc()
+		m.cache.fireHit(ctx, key, time.Since(now))
+		return fieldsToValue(fields, value)
+	}
+	_metricMiss.With("namespace", m.cache.namespace, "command", command).Inc()
+	m.cache.fireMiss(ctx, key, time.Since(now))
+
+	fields, err = m.loadFieldsToCache(ctx, key)
+	if err != nil {
+		statReqErr(m.cache.namespace, command, err)
+		slog.Errorf(ctx, "%s loadFieldsToCache key: %v err: %v", fun, key, err)
+		return err
+	}
+
+	return fieldsToValue(fields, value)
+}
+
+// GetField 读取单个字段，field 为结构体的 json 字段名，缓存未命中时会加载整个对象
+func (m *HashCache) GetField(ctx context.Context, key interface{}, field string, value interface{}) error {
+	fun := "HashCache.GetField -->"
+	command := "cache.value.hash.GetField"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.cache.namespace, command, st.Millisecond())
+	}()
+
+	skey, err := m.cache.prefixKey(key)
+	if err != nil {
+		statReqErr(m.cache.namespace, command, err)
+		return err
+	}
+
+	client, err := m.cache.getInstance(ctx)
+	if err == ErrBreakerOpen {
+		statReqErr(m.cache.namespace, command, err)
+		m.cache.fireRedisError(ctx, key, st.Duration(), err)
+		var raws map[string]json.RawMessage
+		if err := m.cache.loadFallback(ctx, key, &raws); err != nil {
+			return err
+		}
+		data, ok := raws[field]
+		if !ok {
+			return fmt.Errorf("%s cache key: %v field: %s not found", fun, key, field)
+		}
+		return json.Unmarshal(data, value)
+	}
+	if err != nil {
+		statReqErr(m.cache.namespace, command, err)
+		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.cache.namespace)
+		return err
+	}
+
+	opCtx, cancel := opContext(ctx, client, opGet)
+	defer cancel()
+	data, err := client.HGet(opCtx, skey, field).Result()
+	if err == nil {
+		_metricHits.With("namespace", m.cache.namespace, "command", command).Inc()
+		return json.Unmarshal([]byte(data), value)
+	}
+	if err.Error() != redis.RedisNil {
+		statReqErr(m.cache.namespace, command, err)
+		slog.Errorf(ctx, "%s cache key: %v field: %s err: %v", fun, key, field, err)
+		return fmt.Errorf("%s cache key: %v field: %s err: %v", fun, key, field, err)
+	}
+	_metricMiss.With("namespace", m.cache.namespace, "command", command).Inc()
+
+	// NOTE: 字段不存在可能是整个 key 未命中，也可能是对象本身没有该字段
+	exists, err := client.Exists(opCtx, skey).Result()
+	if err != nil {
+		statReqErr(m.cache.namespace, command, err)
+		return err
+	}
+	fields := map[string]string{}
+	if exists == 0 {
+		fields, err = m.loadFieldsToCache(ctx, key)
+		if err != nil {
+			statReqErr(m.cache.namespace, command, err)
+			slog.Errorf(ctx, "%s loadFieldsToCache key: %v err: %v", fun, key, err)
+			return err
+		}
+	}
+
+	data, ok := fields[field]
+	if !ok {
+		return fmt.Errorf("%s cache key: %v field: %s not found", fun, key, field)
+	}
+	return json.Unmarshal([]byte(data), value)
+}
+
+// SetField 更新单个字段，缓存不存在时不写入，返回值表示是否更新了缓存
+func (m *HashCache) SetField(ctx context.Context, key interface{}, field string, value interface{}) (bool, error) {
+	fun := "HashCache.SetField -->"
+	command := "cache.value.hash.SetField"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.cache.namespace, command, st.Millisecond())
+	}()
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		statReqErr(m.cache.namespace, command, err)
+		return false, err
+	}
+
+	skey, err := m.cache.prefixKey(key)
+	if err != nil {
+		statReqErr(m.cache.namespace, command, err)
+		return false, err
+	}
+
+	client, err := m.cache.getInstance(ctx)
+	if err != nil {
+		statReqErr(m.cache.namespace, command, err)
+		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.cache.namespace)
+		return false, err
+	}
+
+	opCtx, cancel := opContext(ctx, client, opSet)
+	defer cancel()
+	r, err := client.Eval(opCtx, hashSetFieldScript, []string{skey}, field, string(data)).Int64()
+	if err != nil {
+		statReqErr(m.cache.namespace, command, err)
+		slog.Errorf(ctx, "%s cache key: %v field: %s err: %v", fun, key, field, err)
+		return false, err
+	}
+	return r >= 0, nil
+}
+
+func (m *HashCache) Load(ctx context.Context, key interface{}) error {
+	command := "cache.value.hash.Load"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.cache.namespace, command, st.Millisecond())
+	}()
+
+	_, err := m.loadFieldsToCache(ctx, key)
+	statReqErr(m.cache.namespace, command, err)
+
+	return err
+}
+
+func (m *HashCache) getFieldsFromCache(ctx context.Context, key interface{}) (map[string]string, error) {
+	fun := "HashCache.getFieldsFromCache -->"
+
+	skey, err := m.cache.prefixKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := m.cache.getInstance(ctx)
+	if err != nil {
+		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.cache.namespace)
+		return nil, err
+	}
+
+	opCtx, cancel := opContext(ctx, client, opGet)
+	defer cancel()
+	return client.HGetAll(opCtx, skey).Result()
+}
+
+func (m *HashCache) loadFieldsToCache(ctx context.Context, key interface{}) (map[string]string, error) {
+	fun := "HashCache.loadFieldsToCache -->"
+
+	now := time.Now()
+	value, err := m.cache.load(ctx, key)
+	if err != nil {
+		m.cache.fireLoadError(ctx, key, time.Since(now), err)
+		slog.Warnf(ctx, "%s load err, cache key:%v err:%v", fun, key, err)
+		return nil, err
+	}
+
+	fields, err := valueToFields(value)
+	if err != nil {
+		slog.Errorf(ctx, "%s marshal err, cache key:%v err:%v", fun, key, err)
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return fields, nil
+	}
+
+	skey, err := m.cache.prefixKey(key)
+	if err != nil {
+		slog.Errorf(ctx, "%s fixkey, key: %v err:%v", fun, key, err)
+		return nil, err
+	}
+
+	client, err := m.cache.getInstance(ctx)
+	if err != nil {
+		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.cache.namespace)
+		return nil, err
+	}
+
+	hfields := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		hfields[k] = v
+	}
+
+	// MULTI/EXEC 保证读取方不会看到删除后或只写入一部分的 hash，也不会丢失过期时间
+	pipe := client.TxPipeline()
+	opCtx, cancel := opContext(ctx, client, opSet)
+	defer cancel()
+	pipe.Del(opCtx, skey)
+	pipe.HMSet(opCtx, skey, hfields)
+	pipe.Expire(opCtx, skey, expireOf(m.cache.policy(client), false))
+	if _, rerr := pipe.Exec(opCtx); rerr != nil {
+		slog.Errorf(ctx, "%s set err, cache key:%v rerr:%v", fun, key, rerr)
+	}
+
+	return fields, nil
+}
+
+func valueToFields(value interface{}) (map[string]string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var raws map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, fmt.Errorf("value should be a struct or map, err: %v", err)
+	}
+
+	fields := make(map[string]string, len(raws))
+	for k, v := range raws {
+		fields[k] = string(v)
+	}
+	return fields, nil
+}
+
+func fieldsToValue(fields map[string]string, value interface{}) error {
+	raws := make(map[string]json.RawMessage, len(fields))
+	for k, v := range fields {
+		raws[k] = json.RawMessage(v)
+	}
+
+	data, err := json.Marshal(raws)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
@@ -0,0 +1,47 @@
+package value
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type hashTest struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestValueToFields(t *testing.T) {
+	fields, err := valueToFields(&hashTest{Id: 1, Name: "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"id": "1", "name": `"a"`}, fields)
+
+	_, err = valueToFields(1)
+	assert.Error(t, err)
+
+	var v hashTest
+	err = fieldsToValue(fields, &v)
+	assert.NoError(t, err)
+	assert.Equal(t, hashTest{Id: 1, Name: "a"}, v)
+}
+
+func TestHashCache_breakerFallback(t *testing.T) {
+	ctx := context.TODO()
+	c := NewHashCache("base/testhashbreaker", "test", time.Minute, func(ctx context.Context, key interface{}) (interface{}, error) {
+		return &hashTest{Id: 1, Name: "a"}, nil
+	})
+	b := getBreaker("base/testhashbreaker")
+	b.openUntil = time.Now().Add(time.Minute)
+	defer b.setOptions(BreakerOptions{Disable: true})
+
+	var v hashTest
+	assert.NoError(t, c.Get(ctx, 1, &v))
+	assert.Equal(t, hashTest{Id: 1, Name: "a"}, v)
+
+	var name string
+	assert.NoError(t, c.GetField(ctx, 1, "name", &name))
+	assert.Equal(t, "a", name)
+	assert.Error(t, c.GetField(ctx, 1, "age", &name))
+}
@@ -0,0 +1,47 @@
+package value
+
+import (
+	"context"
+	"time"
+)
+
+// HookFunc 缓存事件回调，latency 为事件对应操作的耗时，err 仅在错误事件中非 nil，
+// 回调在请求 goroutine 中同步执行，不应阻塞
+type HookFunc func(ctx context.Context, key interface{}, latency time.Duration, err error)
+
+type hooks struct {
+	onHit        []HookFunc
+	onMiss       []HookFunc
+	onLoadError  []HookFunc
+	onRedisError []HookFunc
+}
+
+func fireHooks(fns []HookFunc, ctx context.Context, key interface{}, latency time.Duration, err error) {
+	for _, fn := range fns {
+		fn(ctx, key, latency, err)
+	}
+}
+
+// OnHit 注册缓存命中回调，与其他 On* 方法一样需要在使用 Cache 之前注册
+func (m *Cache) OnHit(fn HookFunc) *Cache {
+	m.hooks.onHit = append(m.hooks.onHit, fn)
+	return m
+}
+
+// OnMiss 注册缓存未命中回调
+func (m *Cache) OnMiss(fn HookFunc) *Cache {
+	m.hooks.onMiss = append(m.hooks.onMiss, fn)
+	return m
+}
+
+// OnLoadError 注册 load 失败回调，latency 为 load 的耗时
+func (m *Cache) OnLoadError(fn HookFunc) *Cache {
+	m.hooks.onLoadError = append(m.hooks.onLoadError, fn)
+	return m
+}
+
+// OnRedisError 注册 redis 操作失败回调，包括熔断打开
+func (m *Cache) OnRedisError(fn HookFunc) *Cache {
+	m.hooks.onRedisError = append(m.hooks.onRedisError, fn)
+	return m
+}
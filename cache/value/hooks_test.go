@@ -0,0 +1,30 @@
+package value
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+	var hits, loadErrs int
+	c := NewCache("base/test", "test", time.Minute, nil).
+		OnHit(func(ctx context.Context, key interface{}, latency time.Duration, err error) {
+			hits++
+			assert.Equal(t, 1, key)
+			assert.NoError(t, err)
+		}).
+		OnLoadError(func(ctx context.Context, key interface{}, latency time.Duration, err error) {
+			loadErrs++
+			assert.Error(t, err)
+		})
+
+	fireHooks(c.hooks.onHit, context.TODO(), 1, time.Millisecond, nil)
+	fireHooks(c.hooks.onLoadError, context.TODO(), 1, time.Millisecond, errors.New("load err"))
+	fireHooks(c.hooks.onMiss, context.TODO(), 1, time.Millisecond, nil)
+	assert.Equal(t, 1, hits)
+	assert.Equal(t, 1, loadErrs)
+}
@@ -0,0 +1,119 @@
+package value
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	hotKeyWindow     = time.Second // 统计窗口
+	hotKeySampleRate = 10          // 每 hotKeySampleRate 次访问采样一次
+	hotKeyMaxTracked = 10000       // 单个窗口内最多统计的 key 数，超出后新 key 不再统计
+	hotKeyLocalSize  = 1000        // 本地副本最多缓存的 key 数
+)
+
+// hotKeys 按窗口采样统计访问次数，窗口内估算访问次数超过阈值的 key 视为热点，
+// 热点 key 在本地保存一份短期副本，直到副本过期
+type hotKeys struct {
+	threshold int64
+	sampled   uint64
+
+	mu          sync.Mutex
+	windowStart time.Time
+	counts      map[string]int64
+	hot         map[string]time.Time
+
+	local *localCache
+}
+
+func newHotKeys(threshold int64, localExpire time.Duration) *hotKeys {
+	return &hotKeys{
+		threshold: threshold,
+		counts:    make(map[string]int64),
+		hot:       make(map[string]time.Time),
+		local:     newLocalCache(hotKeyLocalSize, localExpire),
+	}
+}
+
+// EnableHotKey 开启热点 key 本地副本，每秒访问次数超过 threshold 的 key 会在本地缓存 localExpire，
+// 副本过期前其他进程对该 key 的更新不可见，localExpire 应尽量短
+func (m *Cache) EnableHotKey(threshold int64, localExpire time.Duration) *Cache {
+	m.hotKeys = newHotKeys(threshold, localExpire)
+	return m
+}
+
+// HotKeys 返回当前的热点 key（带前缀），按字典序排列
+func (m *Cache) HotKeys() []string {
+	if m.hotKeys == nil {
+		return nil
+	}
+	return m.hotKeys.list()
+}
+
+// access 记录一次访问，返回该 key 的本地副本
+func (h *hotKeys) access(key string) ([]byte, bool) {
+	if atomic.AddUint64(&h.sampled, 1)%hotKeySampleRate == 0 {
+		h.record(key)
+	}
+	return h.local.get(key)
+}
+
+func (h *hotKeys) record(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(h.windowStart) > hotKeyWindow {
+		h.windowStart = now
+		h.counts = make(map[string]int64)
+		for k, expireAt := range h.hot {
+			if now.After(expireAt) {
+				delete(h.hot, k)
+			}
+		}
+	}
+
+	count, ok := h.counts[key]
+	if !ok && len(h.counts) >= hotKeyMaxTracked {
+		return
+	}
+	count += hotKeySampleRate
+	h.counts[key] = count
+	if count >= h.threshold {
+		h.hot[key] = now.Add(h.local.expire)
+	}
+}
+
+func (h *hotKeys) isHot(key string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	expireAt, ok := h.hot[key]
+	return ok && time.Now().Before(expireAt)
+}
+
+// store 热点 key 写入本地副本
+func (h *hotKeys) store(key string, data []byte) {
+	if h.isHot(key) {
+		h.local.set(key, data)
+	}
+}
+
+func (h *hotKeys) remove(key string) {
+	h.local.del(key)
+}
+
+func (h *hotKeys) list() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	var keys []string
+	for k, expireAt := range h.hot {
+		if now.Before(expireAt) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
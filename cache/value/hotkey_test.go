@@ -0,0 +1,43 @@
+package value
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHotKeys(t *testing.T) {
+	h := newHotKeys(100, time.Minute)
+
+	for i := 0; i < 50; i++ {
+		_, ok := h.access("test.cold")
+		assert.False(t, ok)
+	}
+	h.store("test.cold", []byte("1"))
+	_, ok := h.local.get("test.cold")
+	assert.False(t, ok)
+
+	for i := 0; i < 200; i++ {
+		h.access("test.hot")
+	}
+	assert.Equal(t, []string{"test.hot"}, h.list())
+
+	h.store("test.hot", []byte("2"))
+	data, ok := h.access("test.hot")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("2"), data)
+
+	h.remove("test.hot")
+	_, ok = h.access("test.hot")
+	assert.False(t, ok)
+}
+
+func TestHotKeys_maxTracked(t *testing.T) {
+	h := newHotKeys(1, time.Minute)
+	for i := 0; i < hotKeyMaxTracked+10; i++ {
+		h.record(fmt.Sprintf("test.%d", i))
+	}
+	assert.Equal(t, hotKeyMaxTracked, len(h.counts))
+}
@@ -0,0 +1,71 @@
+package value
+
+import (
+	"sync"
+	"time"
+)
+
+type localItem struct {
+	data     []byte
+	expireAt time.Time
+}
+
+type localCache struct {
+	mu     sync.Mutex
+	size   int
+	expire time.Duration
+	items  map[string]localItem
+}
+
+func newLocalCache(size int, expire time.Duration) *localCache {
+	return &localCache{
+		size:   size,
+		expire: expire,
+		items:  make(map[string]localItem, size),
+	}
+}
+
+func (c *localCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(item.expireAt) {
+		delete(c.items, key)
+		return nil, false
+	}
+	return item.data, true
+}
+
+func (c *localCache) set(key string, data []byte) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[key]; !ok && len(c.items) >= c.size {
+		// 满了先清理过期的，仍然满时随机淘汰
+		now := time.Now()
+		for k, item := range c.items {
+			if now.After(item.expireAt) {
+				delete(c.items, k)
+			}
+		}
+		for k := range c.items {
+			if len(c.items) < c.size {
+				break
+			}
+			delete(c.items, k)
+		}
+	}
+	c.items[key] = localItem{data: data, expireAt: time.Now().Add(c.expire)}
+}
+
+func (c *localCache) del(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, key)
+}
@@ -41,6 +41,13 @@ var (
 		Help:       "cache.value miss total",
 		LabelNames: []string{"namespace", "command"},
 	})
+	_metricBreakerOpen = xprometheus.NewCounter(&xprometheus.CounterVecOpts{
+		Namespace:  namespace,
+		Subsystem:  subsystem,
+		Name:       "breaker_open_total",
+		Help:       "cache.value breaker open total",
+		LabelNames: []string{"namespace"},
+	})
 )
 
 func statReqDuration(namespace, command string, durationMS int64) {
@@ -0,0 +1,222 @@
+package value
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+	"github.com/shawnfeng/sutil/stime"
+)
+
+// MultiResult GetMulti 的结果，缓存命中与 load 成功的 key 通过 Decode 读取
+type MultiResult struct {
+	data map[interface{}][]byte
+	// Errs 失败的 key 及对应错误，包括 key 类型错误、解析失败与 load 失败
+	Errs map[interface{}]error
+	// Loaded 未命中缓存、通过 load 回源的 key
+	Loaded []interface{}
+}
+
+func newMultiResult(n int) *MultiResult {
+	return &MultiResult{
+		data: make(map[interface{}][]byte, n),
+		Errs: make(map[interface{}]error),
+	}
+}
+
+// Found key 是否读取成功
+func (r *MultiResult) Found(key interface{}) bool {
+	_, ok := r.data[key]
+	return ok
+}
+
+// Decode 将 key 的值解析到 value 中，key 失败时返回对应的错误
+func (r *MultiResult) Decode(key, value interface{}) error {
+	if err, ok := r.Errs[key]; ok {
+		return err
+	}
+	data, ok := r.data[key]
+	if !ok {
+		return errors.New(redis.RedisNil)
+	}
+	return decodeValue(data, value)
+}
+
+// GetMulti 批量读取，缓存通过一次 MGET 读取（cluster 模式下按 slot 拆分），未命中的 key 以 WithLoadParallel 限制的并发数 load，
+// 再在同一个 pipeline 中写回缓存；单个 key 的错误记录在 MultiResult.Errs 中，
+// 只有获取实例或 MGET 失败时返回 error
+func (m *Cache) GetMulti(ctx context.Context, keys []interface{}, opts ...Option) (*MultiResult, error) {
+	fun := "Cache.GetMulti -->"
+	command := "cache.value.GetMulti"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+
+	res := newMultiResult(len(keys))
+	var valid []interface{}
+	var skeys []string
+	for _, key := range keys {
+		skey, err := m.prefixKey(key)
+		if err != nil {
+			res.Errs[key] = err
+			continue
+		}
+		valid = append(valid, key)
+		skeys = append(skeys, skey)
+	}
+	if len(skeys) == 0 {
+		return res, nil
+	}
+
+	client, err := m.getInstance(ctx)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s get instance err, namespace: %s err: %v", fun, m.namespace, err)
+		return nil, err
+	}
+
+	now := time.Now()
+	opCtx, cancel := opContext(ctx, client, opGet)
+	defer cancel()
+	vals, err := mget(opCtx, client, skeys)
+	m.recordBreaker(ctx, err, time.Since(now))
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		m.fireRedisError(ctx, keys, time.Since(now), err)
+		slog.Errorf(ctx, "%s mget err, namespace: %s err: %v", fun, m.namespace, err)
+		return nil, err
+	}
+
+	var missKeys []interface{}
+	var missSkeys []string
+	for i, key := range valid {
+		s, ok := vals[i].(string)
+		if ok {
+			data, err := m.unwrapData(opCtx, client, key, skeys[i], []byte(s))
+			if err == nil {
+				_metricHits.With("namespace", m.namespace, "command", command).Inc()
+				m.fireHit(ctx, key, time.Since(now))
+				res.data[key] = data
+				continue
+			}
+			if err.Error() != redis.RedisNil {
+				res.Errs[key] = err
+				continue
+			}
+		}
+		_metricMiss.With("namespace", m.namespace, "command", command).Inc()
+		m.fireMiss(ctx, key, time.Since(now))
+		missKeys = append(missKeys, key)
+		missSkeys = append(missSkeys, skeys[i])
+	}
+
+	if len(missKeys) > 0 {
+		m.loadMulti(ctx, client, missKeys, missSkeys, res, opts...)
+	}
+	for _, err := range res.Errs {
+		statReqErr(m.namespace, command, err)
+	}
+	return res, nil
+}
+
+type multiLoaded struct {
+	key      interface{}
+	skey     string
+	data     []byte
+	negative bool
+}
+
+// loadMulti 并发 load 未命中的 key，结果记录到 res 中，并通过一个 pipeline 写回缓存
+func (m *Cache) loadMulti(ctx context.Context, client *redis.Client, keys []interface{}, skeys []string, res *MultiResult, opts ...Option) {
+	fun := "Cache.loadMulti -->"
+
+	parallel := newOptions(opts).parallel
+	if parallel <= 0 {
+		parallel = defaultWarmParallel
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var loaded []multiLoaded
+	sem := make(chan struct{}, parallel)
+	for i, key := range keys {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(key interface{}, skey string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			now := time.Now()
+			value, err := m.load(ctx, key)
+			m.xfetch.observe(time.Since(now))
+			var data []byte
+			marshalFailed := false
+			if err != nil {
+				m.fireLoadError(ctx, key, time.Since(now), err)
+				slog.Warnf(ctx, "%s load err, cache key:%v err:%v", fun, key, err)
+			} else if data, err = json.Marshal(value); err != nil {
+				slog.Errorf(ctx, "%s marshal err, cache key:%v err:%v", fun, key, err)
+				marshalFailed = true
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				res.Errs[key] = err
+				if m.tombstoneOnError(marshalFailed) {
+					loaded = append(loaded, multiLoaded{key: key, skey: skey, data: tombstone(err), negative: true})
+				}
+				return
+			}
+			res.data[key] = data
+			res.Loaded = append(res.Loaded, key)
+			loaded = append(loaded, multiLoaded{key: key, skey: skey, data: data})
+		}(key, skeys[i])
+	}
+	wg.Wait()
+
+	if len(loaded) == 0 {
+		return
+	}
+
+	p := m.policy(client, opts...)
+	tags := newOptions(opts).tags
+	now := time.Now()
+	opCtx, cancel := opContext(ctx, client, opSet)
+	defer cancel()
+	pipe := client.Pipeline()
+	for _, l := range loaded {
+		data, err := m.encodeData(ctx, l.data)
+		if err == nil {
+			err = m.checkValueSize(ctx, client, l.skey, data)
+		}
+		if err == nil {
+			err = m.queueData(opCtx, pipe, l.skey, data, expireOf(p, l.negative))
+		}
+		if err == nil {
+			queueTags(opCtx, pipe, l.skey, tags, expireOf(p, l.negative))
+		}
+		if err != nil {
+			slog.Errorf(ctx, "%s encode err, cache key:%v err:%v", fun, l.key, err)
+		}
+		if m.hotKeys != nil {
+			m.hotKeys.remove(l.skey)
+		}
+	}
+	_, err := pipe.Exec(opCtx)
+	m.recordBreaker(ctx, err, time.Since(now))
+	if err != nil {
+		m.fireRedisError(ctx, keys, time.Since(now), err)
+		slog.Errorf(ctx, "%s set err, keys: %d err: %v", fun, len(loaded), err)
+	}
+}
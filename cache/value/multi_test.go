@@ -0,0 +1,27 @@
+package value
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiResult_Decode(t *testing.T) {
+	res := newMultiResult(3)
+	res.data[1] = []byte(`{"Id":1}`)
+	res.data[2] = tombstone(errors.New("not found"))
+	res.Errs[3] = errors.New("load err")
+
+	var test Test
+	assert.True(t, res.Found(1))
+	assert.NoError(t, res.Decode(1, &test))
+	assert.Equal(t, int64(1), test.Id)
+
+	assert.EqualError(t, res.Decode(2, &test), "not found")
+	assert.EqualError(t, res.Decode(3, &test), "load err")
+
+	assert.False(t, res.Found(4))
+	assert.EqualError(t, res.Decode(4, &test), redis.RedisNil)
+}
@@ -0,0 +1,45 @@
+package value
+
+import (
+	"time"
+)
+
+// Option 单次调用的可选参数
+type Option func(*options)
+
+type options struct {
+	expire   time.Duration
+	parallel int
+	tags     []string
+}
+
+// WithExpire 本次写入缓存使用 expire 作为过期时间，优先于配置中心与 NewCache 中的过期时间，
+// Get 中仅在未命中重新 load 时生效
+func WithExpire(expire time.Duration) Option {
+	return func(o *options) {
+		o.expire = expire
+	}
+}
+
+// WithLoadParallel GetMulti 中未命中的 key 最多 parallel 个并发 load，默认与 Warm 一致
+func WithLoadParallel(parallel int) Option {
+	return func(o *options) {
+		o.parallel = parallel
+	}
+}
+
+// WithTags 本次写入的 key 关联到 tags，之后可以通过 InvalidateTag 删除 tag 关联的所有 key，
+// Get 中仅在未命中重新 load 时生效
+func WithTags(tags ...string) Option {
+	return func(o *options) {
+		o.tags = append(o.tags, tags...)
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
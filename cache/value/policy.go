@@ -0,0 +1,118 @@
+package value
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"time"
+
+	"github.com/shawnfeng/sutil/cache/constants"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// policy 合并单次调用的参数、配置中心下发的策略与 NewCache 中的默认值，依次优先
+func (m *Cache) policy(client *redis.Client, opts ...Option) redis.CachePolicy {
+	p := client.Policy()
+	if p.Expire <= 0 {
+		p.Expire = m.expire
+	}
+	if o := newOptions(opts); o.expire > 0 {
+		p.Expire = o.expire
+	}
+	if p.NegativeExpire <= 0 {
+		p.NegativeExpire = constants.CacheDirtyExpireTime
+	}
+	return p
+}
+
+// expireOf 写入缓存使用的过期时间，正常值包含 jitter 与 stale 窗口
+func expireOf(p redis.CachePolicy, negative bool) time.Duration {
+	if negative {
+		return p.NegativeExpire
+	}
+	expire := p.Expire + p.StaleWindow
+	if p.Jitter > 0 {
+		expire += time.Duration(rand.Int63n(int64(p.Jitter)))
+	}
+	return expire
+}
+
+// getData 读取缓存，withTTL 时在同一个 pipeline 中读取剩余过期时间，否则 ttl 为 -1
+func getData(ctx context.Context, client *redis.Client, skey string, withTTL bool) (data []byte, ttl time.Duration, err error) {
+	ttl = -1
+	if !withTTL {
+		data, err = client.Get(ctx, skey).Bytes()
+		return
+	}
+
+	pipe := client.Pipeline()
+	get := pipe.Get(ctx, skey)
+	ttlCmd := pipe.TTL(ctx, skey)
+	// NOTE: 错误由各命令返回，未命中时 Get 返回 redis: nil
+	_, _ = pipe.Exec(ctx)
+	data, err = get.Bytes()
+	if err != nil {
+		return
+	}
+	if ttlCmd.Val() >= 0 {
+		ttl = ttlCmd.Val()
+	}
+	return
+}
+
+// needRefresh 剩余过期时间为 ttl 的 key 是否需要异步刷新：处于 stale 窗口内，或 XFetch 判定提前过期
+func (m *Cache) needRefresh(p redis.CachePolicy, ttl time.Duration) bool {
+	if ttl < 0 {
+		return false
+	}
+	if p.StaleWindow > 0 && ttl < p.StaleWindow {
+		return true
+	}
+	return m.xfetch.early(ttl - p.StaleWindow)
+}
+
+// refreshAsync 异步重新 load 处于 stale 窗口内或提前过期的 key，同一个 key 同时只刷新一次，
+// load 失败时保留旧值直到过期
+func (m *Cache) refreshAsync(ctx context.Context, key interface{}, skey string, opts ...Option) {
+	fun := "Cache.refreshAsync -->"
+	if _, loaded := m.refreshing.LoadOrStore(skey, struct{}{}); loaded {
+		return
+	}
+
+	ctx = redis.WithRouteGroup(context.Background(), redis.RouteGroup(ctx))
+	go func() {
+		defer m.refreshing.Delete(skey)
+
+		now := time.Now()
+		value, err := m.load(ctx, key)
+		m.xfetch.observe(time.Since(now))
+		if err != nil {
+			slog.Warnf(ctx, "%s load err, cache key:%v err:%v", fun, key, err)
+			return
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			slog.Errorf(ctx, "%s marshal err, cache key:%v err:%v", fun, key, err)
+			return
+		}
+
+		client, err := m.getInstance(ctx)
+		if err != nil {
+			slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.namespace)
+			return
+		}
+
+		now = time.Now()
+		opCtx, cancel := opContext(ctx, client, opSet)
+		defer cancel()
+		err = m.setData(opCtx, client, skey, data, expireOf(m.policy(client, opts...), false), newOptions(opts).tags)
+		m.recordBreaker(ctx, err, time.Since(now))
+		if m.hotKeys != nil {
+			m.hotKeys.remove(skey)
+		}
+		if err != nil {
+			slog.Errorf(ctx, "%s set err, cache key:%v err:%v", fun, key, err)
+		}
+	}()
+}
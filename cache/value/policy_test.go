@@ -0,0 +1,38 @@
+package value
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shawnfeng/sutil/cache/constants"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpireOf(t *testing.T) {
+	p := redis.CachePolicy{
+		Expire:         time.Minute,
+		NegativeExpire: 5 * time.Second,
+	}
+	assert.Equal(t, time.Minute, expireOf(p, false))
+	assert.Equal(t, 5*time.Second, expireOf(p, true))
+
+	p.StaleWindow = 10 * time.Second
+	p.Jitter = time.Second
+	for i := 0; i < 100; i++ {
+		expire := expireOf(p, false)
+		assert.True(t, expire >= 70*time.Second && expire < 71*time.Second)
+	}
+}
+
+func TestCache_policy(t *testing.T) {
+	c := NewCache("base/test", "test", time.Minute, nil)
+	client := &redis.Client{}
+
+	p := c.policy(client)
+	assert.Equal(t, time.Minute, p.Expire)
+	assert.Equal(t, constants.CacheDirtyExpireTime, p.NegativeExpire)
+
+	p = c.policy(client, WithExpire(time.Hour))
+	assert.Equal(t, time.Hour, p.Expire)
+}
@@ -0,0 +1,117 @@
+package value
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/shawnfeng/sutil/slog/slog"
+	"github.com/shawnfeng/sutil/stime"
+)
+
+const defaultDelPrefixBatchSize = 100
+
+// DelPrefixOptions DelPrefix 的可选参数，nil 表示使用默认值
+type DelPrefixOptions struct {
+	// 每次 SCAN 的 count，默认 100
+	BatchSize int64
+	// 只统计匹配的 key 数量，不删除
+	DryRun bool
+	// 每批处理完成后回调，scanned 为已遍历的 key 数，deleted 为已删除的 key 数
+	Progress func(scanned, deleted int64)
+}
+
+// DelPrefix 使用 SCAN + UNLINK 分批删除 key 以 keyPrefix 开头的缓存（如下线租户时清理其全部数据），
+// 返回删除的数量，DryRun 时返回匹配的数量（SCAN 可能重复返回同一个 key，仅作参考）
+// NOTE: cluster 模式下依次 SCAN 每个 master 节点，每批 key 按 slot 拆分 UNLINK；codis 等不支持 SCAN 的代理会返回错误
+func (m *Cache) DelPrefix(ctx context.Context, keyPrefix string, opts *DelPrefixOptions) (int64, error) {
+	fun := "Cache.DelPrefix -->"
+	command := "cache.value.DelPrefix"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+
+	if opts == nil {
+		opts = &DelPrefixOptions{}
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultDelPrefixBatchSize
+	}
+
+	match := m.matchPrefix(keyPrefix)
+
+	client, err := m.getInvalidateInstance(ctx)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.namespace)
+		return 0, err
+	}
+
+	var scanned, deleted int64
+	err = client.Iterate(ctx, match, batchSize, func(keys []string) error {
+		scanned += int64(len(keys))
+		if opts.DryRun {
+			deleted += int64(len(keys))
+		} else {
+			now := time.Now()
+			opCtx, cancel := opContext(ctx, client, opDel)
+			n, err := unlink(opCtx, client, keys)
+			cancel()
+			m.recordBreaker(ctx, err, time.Since(now))
+			if err != nil {
+				return err
+			}
+			deleted += n
+
+			if m.hotKeys != nil {
+				for _, key := range keys {
+					m.hotKeys.remove(key)
+				}
+			}
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(scanned, deleted)
+		}
+		return nil
+	})
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s key prefix: %s scanned: %d deleted: %d err: %v", fun, keyPrefix, scanned, deleted, err)
+		return deleted, err
+	}
+
+	slog.Infof(ctx, "%s key prefix: %s dryrun: %v scanned: %d deleted: %d", fun, keyPrefix, opts.DryRun, scanned, deleted)
+	return deleted, nil
+}
+
+// matchPrefix 返回 key 以 keyPrefix 开头的 SCAN MATCH 表达式
+func (m *Cache) matchPrefix(keyPrefix string) string {
+	match := escapeGlob(keyPrefix) + "*"
+	if m.template != nil {
+		return escapeGlob(m.template.before) + match + escapeGlob(m.template.after)
+	}
+	if len(m.prefix) > 0 {
+		return fmt.Sprintf("%s.%s", escapeGlob(m.prefix), match)
+	}
+	return match
+}
+
+// escapeGlob 转义 SCAN MATCH 中的通配符
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,12 @@
+package value
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeGlob(t *testing.T) {
+	assert.Equal(t, "tenant1:", escapeGlob("tenant1:"))
+	assert.Equal(t, `a\*b\?c\[d\]\\`, escapeGlob(`a*b?c[d]\`))
+}
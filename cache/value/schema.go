@@ -0,0 +1,94 @@
+package value
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 带版本的值前缀，格式为 prefix + version + ":" + json
+const schemaPrefix = "\x00v:"
+
+// MigrateFunc 将 version 版本的 json 数据转换为当前版本的 json 数据，
+// 开启版本前写入的数据 version 为 0
+type MigrateFunc func(ctx context.Context, key interface{}, version int, data []byte) ([]byte, error)
+
+type schema struct {
+	version int
+	migrate MigrateFunc
+}
+
+// EnableSchemaVersion 写入时记录数据结构的版本，读取到旧版本时调用 migrate 转换，
+// migrate 为 nil 或转换失败时视为未命中重新 load，读取到比当前更新的版本时同样视为未命中
+func (m *Cache) EnableSchemaVersion(version int, migrate MigrateFunc) *Cache {
+	m.schema = &schema{
+		version: version,
+		migrate: migrate,
+	}
+	return m
+}
+
+func (s *schema) wrap(data []byte) []byte {
+	buf := make([]byte, 0, len(schemaPrefix)+len(data)+8)
+	buf = append(buf, schemaPrefix...)
+	buf = strconv.AppendInt(buf, int64(s.version), 10)
+	buf = append(buf, ':')
+	return append(buf, data...)
+}
+
+// unwrapSchema 返回数据的版本与去掉版本信息的数据
+func unwrapSchema(data []byte) (int, []byte, error) {
+	if !bytes.HasPrefix(data, []byte(schemaPrefix)) {
+		return 0, data, nil
+	}
+	data = data[len(schemaPrefix):]
+	i := bytes.IndexByte(data, ':')
+	if i < 0 {
+		return 0, nil, errors.New("invalid schema version")
+	}
+	version, err := strconv.Atoi(string(data[:i]))
+	if err != nil {
+		return 0, nil, err
+	}
+	return version, data[i+1:], nil
+}
+
+func (m *Cache) wrapSchema(data []byte) []byte {
+	if m.schema == nil {
+		return data
+	}
+	return m.schema.wrap(data)
+}
+
+// checkSchema 去掉版本信息，旧版本的数据尝试转换，无法使用时返回 redis: nil
+func (m *Cache) checkSchema(ctx context.Context, key interface{}, skey string, data []byte) ([]byte, error) {
+	fun := "Cache.checkSchema -->"
+	if m.schema == nil {
+		return data, nil
+	}
+
+	version, data, err := unwrapSchema(data)
+	if err != nil {
+		slog.Warnf(ctx, "%s key: %s err: %v", fun, skey, err)
+		return nil, errors.New(redis.RedisNil)
+	}
+	// NOTE: 占位值不包含数据结构，不需要转换
+	if version == m.schema.version || bytes.HasPrefix(data, []byte(tombstonePrefix)) {
+		return data, nil
+	}
+	if version > m.schema.version || m.schema.migrate == nil {
+		slog.Infof(ctx, "%s key: %s version: %d current: %d, treat as miss", fun, skey, version, m.schema.version)
+		return nil, errors.New(redis.RedisNil)
+	}
+
+	data, err = m.schema.migrate(ctx, key, version, data)
+	if err != nil {
+		slog.Warnf(ctx, "%s migrate key: %s version: %d current: %d err: %v", fun, skey, version, m.schema.version, err)
+		return nil, errors.New(redis.RedisNil)
+	}
+	return data, nil
+}
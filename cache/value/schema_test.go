@@ -0,0 +1,45 @@
+package value
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_checkSchema(t *testing.T) {
+	ctx := context.TODO()
+	c := NewCache("base/test", "test", time.Minute, nil)
+
+	// 未开启版本时原样返回
+	data, err := c.checkSchema(ctx, 1, "test.1", []byte(`{"Id":1}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Id":1}`, string(data))
+
+	c.EnableSchemaVersion(2, nil)
+	data, err = c.checkSchema(ctx, 1, "test.1", c.wrapSchema([]byte(`{"Id":1}`)))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Id":1}`, string(data))
+
+	_, err = c.checkSchema(ctx, 1, "test.1", []byte(`{"Id":1}`))
+	assert.EqualError(t, err, redis.RedisNil)
+
+	c.EnableSchemaVersion(3, func(ctx context.Context, key interface{}, version int, data []byte) ([]byte, error) {
+		if version == 2 {
+			return []byte(`{"Id":2}`), nil
+		}
+		return nil, errors.New("unsupported version")
+	})
+	data, err = c.checkSchema(ctx, 1, "test.1", (&schema{version: 2}).wrap([]byte(`{"Id":1}`)))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Id":2}`, string(data))
+
+	_, err = c.checkSchema(ctx, 1, "test.1", []byte(`{"Id":1}`))
+	assert.EqualError(t, err, redis.RedisNil)
+
+	_, err = c.checkSchema(ctx, 1, "test.1", (&schema{version: 4}).wrap([]byte(`{"Id":1}`)))
+	assert.EqualError(t, err, redis.RedisNil)
+}
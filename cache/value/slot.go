@@ -0,0 +1,69 @@
+package value
+
+import (
+	"context"
+
+	redis2 "github.com/redis/go-redis/v9"
+	"github.com/shawnfeng/sutil/cache/redis"
+)
+
+// cluster 模式下跨 slot 的多 key 命令返回 CROSSSLOT，按 slot 拆分后在同一个 pipeline 中发送
+
+func groupKeys(keys []string, group []int) []string {
+	gkeys := make([]string, len(group))
+	for j, i := range group {
+		gkeys[j] = keys[i]
+	}
+	return gkeys
+}
+
+// mget 结果与 keys 的顺序一致
+func mget(ctx context.Context, client *redis.Client, keys []string) ([]interface{}, error) {
+	groups := client.SlotGroups(keys)
+	if groups == nil {
+		return client.MGet(ctx, keys...).Result()
+	}
+
+	pipe := client.Pipeline()
+	cmds := make([]*redis2.SliceCmd, len(groups))
+	for g, group := range groups {
+		cmds[g] = pipe.MGet(ctx, groupKeys(keys, group)...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	vals := make([]interface{}, len(keys))
+	for g, group := range groups {
+		gvals := cmds[g].Val()
+		for j, i := range group {
+			if j < len(gvals) {
+				vals[i] = gvals[j]
+			}
+		}
+	}
+	return vals, nil
+}
+
+// unlink 返回删除的数量，跨 slot 时不再是原子操作，部分 slot 可能已经删除
+func unlink(ctx context.Context, client *redis.Client, keys []string) (int64, error) {
+	groups := client.SlotGroups(keys)
+	if groups == nil {
+		return client.Unlink(ctx, keys...).Result()
+	}
+
+	pipe := client.Pipeline()
+	cmds := make([]*redis2.IntCmd, len(groups))
+	for g, group := range groups {
+		cmds[g] = pipe.Unlink(ctx, groupKeys(keys, group)...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for _, cmd := range cmds {
+		n += cmd.Val()
+	}
+	return n, nil
+}
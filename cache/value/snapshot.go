@@ -0,0 +1,228 @@
+package value
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	redis2 "github.com/redis/go-redis/v9"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+	"github.com/shawnfeng/sutil/stime"
+)
+
+const defaultSnapshotBatchSize = 100
+
+// snapshotEntry 快照中的一条记录，每行一个 json，value 为 redis 中保存的原始内容（包括加密与分片）
+type snapshotEntry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+	// 导出时的剩余过期时间，0 表示不过期
+	TTLMs int64 `json:"ttl_ms"`
+}
+
+// ImportOptions Import 的可选参数，nil 表示使用默认值
+type ImportOptions struct {
+	// 每个 pipeline 写入的 key 数，默认 100
+	BatchSize int
+	// 覆盖已存在的 key，默认只写入不存在的 key
+	Overwrite bool
+	// 使用 expire 作为过期时间，而不是导出时的剩余过期时间
+	Expire time.Duration
+}
+
+// Export 将 key 以 keyPrefix 开头的缓存导出到 w，只读取不修改缓存，返回导出的数量，
+// 用于新集群预热或在测试环境复现线上缓存；导出期间过期或类型不是 string 的 key 会被跳过
+func (m *Cache) Export(ctx context.Context, w io.Writer, keyPrefix string) (int64, error) {
+	fun := "Cache.Export -->"
+	command := "cache.value.Export"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+
+	client, err := m.getInstance(ctx)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.namespace)
+		return 0, err
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	var exported int64
+	err = client.Iterate(ctx, m.matchPrefix(keyPrefix), defaultSnapshotBatchSize, func(keys []string) error {
+		opCtx, cancel := opContext(ctx, client, opGet)
+		defer cancel()
+
+		pipe := client.Pipeline()
+		gets := make([]*redis2.StringCmd, len(keys))
+		ttls := make([]*redis2.DurationCmd, len(keys))
+		for i, key := range keys {
+			gets[i] = pipe.Get(opCtx, key)
+			ttls[i] = pipe.PTTL(opCtx, key)
+		}
+		// NOTE: 单个 key 的错误（过期、类型不是 string）在下面逐个检查
+		_, _ = pipe.Exec(opCtx)
+
+		for i, key := range keys {
+			data, err := gets[i].Bytes()
+			if err != nil {
+				continue
+			}
+			entry := snapshotEntry{Key: key, Value: data}
+			if ttl := ttls[i].Val(); ttl > 0 {
+				entry.TTLMs = ttl.Milliseconds()
+			}
+			if err := enc.Encode(entry); err != nil {
+				return err
+			}
+			exported++
+		}
+		return nil
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s key prefix: %s exported: %d err: %v", fun, keyPrefix, exported, err)
+		return exported, err
+	}
+
+	slog.Infof(ctx, "%s key prefix: %s exported: %d", fun, keyPrefix, exported)
+	return exported, nil
+}
+
+// Import 导入 Export 生成的快照，返回写入的数量，过期时间为导出时的剩余过期时间
+// NOTE: 记录按原始内容写入，开启加密时需要使用相同的密钥读取
+func (m *Cache) Import(ctx context.Context, r io.Reader, opts *ImportOptions) (int64, error) {
+	fun := "Cache.Import -->"
+	command := "cache.value.Import"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultSnapshotBatchSize
+	}
+
+	client, err := m.getInstance(ctx)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.namespace)
+		return 0, err
+	}
+
+	var imported int64
+	var batch []snapshotEntry
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := m.importBatch(ctx, client, batch, opts)
+		imported += n
+		batch = batch[:0]
+		return err
+	}
+
+	dec := json.NewDecoder(r)
+	for {
+		var entry snapshotEntry
+		err = dec.Decode(&entry)
+		if err == io.EOF {
+			err = flush()
+			break
+		}
+		if err != nil {
+			break
+		}
+		batch = append(batch, entry)
+		if len(batch) >= batchSize {
+			if err = flush(); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s imported: %d err: %v", fun, imported, err)
+		return imported, err
+	}
+
+	slog.Infof(ctx, "%s imported: %d", fun, imported)
+	return imported, nil
+}
+
+func (m *Cache) importBatch(ctx context.Context, client *redis.Client, batch []snapshotEntry, opts *ImportOptions) (int64, error) {
+	now := time.Now()
+	opCtx, cancel := opContext(ctx, client, opSet)
+	defer cancel()
+
+	pipe := client.Pipeline()
+	var sets []*redis2.StatusCmd
+	var setNXs []*redis2.BoolCmd
+	for _, entry := range batch {
+		expire := time.Duration(entry.TTLMs) * time.Millisecond
+		if opts.Expire > 0 {
+			expire = opts.Expire
+		}
+		if opts.Overwrite {
+			sets = append(sets, pipe.Set(opCtx, entry.Key, entry.Value, expire))
+		} else {
+			setNXs = append(setNXs, pipe.SetNX(opCtx, entry.Key, entry.Value, expire))
+		}
+		if m.hotKeys != nil {
+			m.hotKeys.remove(entry.Key)
+		}
+	}
+	_, err := pipe.Exec(opCtx)
+	m.recordBreaker(ctx, err, time.Since(now))
+	if err != nil {
+		return 0, err
+	}
+
+	n := int64(len(sets))
+	for _, cmd := range setNXs {
+		if cmd.Val() {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ExportFile 同 Export，导出到文件 path
+func (m *Cache) ExportFile(ctx context.Context, path, keyPrefix string) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := m.Export(ctx, f, keyPrefix)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// ImportFile 同 Import，从文件 path 导入
+func (m *Cache) ImportFile(ctx context.Context, path string, opts *ImportOptions) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return m.Import(ctx, f, opts)
+}
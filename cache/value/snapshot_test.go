@@ -0,0 +1,29 @@
+package value
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_matchPrefix(t *testing.T) {
+	c := NewCache("base/test", "test", time.Minute, nil)
+	assert.Equal(t, "test.user\\**", c.matchPrefix("user*"))
+
+	c, err := NewCacheWithTemplate("base/test", "user:%d:profile", time.Minute, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "user:1*:profile", c.matchPrefix("1"))
+}
+
+func TestSnapshotEntry(t *testing.T) {
+	var buf bytes.Buffer
+	entry := snapshotEntry{Key: "test.1", Value: []byte("\x00enc:raw"), TTLMs: 1000}
+	assert.NoError(t, json.NewEncoder(&buf).Encode(entry))
+
+	var got snapshotEntry
+	assert.NoError(t, json.NewDecoder(&buf).Decode(&got))
+	assert.Equal(t, entry, got)
+}
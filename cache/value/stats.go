@@ -0,0 +1,58 @@
+package value
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Stats 单个 Cache 自进程启动以来的累计统计
+type Stats struct {
+	Namespace   string `json:"namespace"`
+	Prefix      string `json:"prefix"`
+	Hits        int64  `json:"hits"`
+	Misses      int64  `json:"misses"`
+	LoadErrors  int64  `json:"load_errors"`
+	RedisErrors int64  `json:"redis_errors"`
+	HotKeys     int    `json:"hot_keys"`
+}
+
+type stats struct {
+	hits        int64
+	misses      int64
+	loadErrors  int64
+	redisErrors int64
+}
+
+// Stats 返回当前的累计统计，与 prometheus 指标不同，只统计本 Cache
+func (m *Cache) Stats() Stats {
+	return Stats{
+		Namespace:   m.namespace,
+		Prefix:      m.prefix,
+		Hits:        atomic.LoadInt64(&m.stats.hits),
+		Misses:      atomic.LoadInt64(&m.stats.misses),
+		LoadErrors:  atomic.LoadInt64(&m.stats.loadErrors),
+		RedisErrors: atomic.LoadInt64(&m.stats.redisErrors),
+		HotKeys:     len(m.HotKeys()),
+	}
+}
+
+func (m *Cache) fireHit(ctx context.Context, key interface{}, latency time.Duration) {
+	atomic.AddInt64(&m.stats.hits, 1)
+	fireHooks(m.hooks.onHit, ctx, key, latency, nil)
+}
+
+func (m *Cache) fireMiss(ctx context.Context, key interface{}, latency time.Duration) {
+	atomic.AddInt64(&m.stats.misses, 1)
+	fireHooks(m.hooks.onMiss, ctx, key, latency, nil)
+}
+
+func (m *Cache) fireLoadError(ctx context.Context, key interface{}, latency time.Duration, err error) {
+	atomic.AddInt64(&m.stats.loadErrors, 1)
+	fireHooks(m.hooks.onLoadError, ctx, key, latency, err)
+}
+
+func (m *Cache) fireRedisError(ctx context.Context, key interface{}, latency time.Duration, err error) {
+	atomic.AddInt64(&m.stats.redisErrors, 1)
+	fireHooks(m.hooks.onRedisError, ctx, key, latency, err)
+}
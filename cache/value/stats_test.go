@@ -0,0 +1,35 @@
+package value
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_Stats(t *testing.T) {
+	c := NewCache("base/test", "test", time.Minute, nil)
+	var misses int
+	c.OnMiss(func(ctx context.Context, key interface{}, latency time.Duration, err error) {
+		misses++
+	})
+
+	ctx := context.TODO()
+	c.fireHit(ctx, 1, time.Millisecond)
+	c.fireHit(ctx, 1, time.Millisecond)
+	c.fireMiss(ctx, 1, time.Millisecond)
+	c.fireLoadError(ctx, 1, time.Millisecond, errors.New("load err"))
+	c.fireRedisError(ctx, 1, time.Millisecond, errors.New("redis err"))
+
+	assert.Equal(t, Stats{
+		Namespace:   "base/test",
+		Prefix:      "test",
+		Hits:        2,
+		Misses:      1,
+		LoadErrors:  1,
+		RedisErrors: 1,
+	}, c.Stats())
+	assert.Equal(t, 1, misses)
+}
@@ -0,0 +1,112 @@
+package value
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+	"github.com/shawnfeng/sutil/stime"
+)
+
+const tagBatchSize = 100
+
+// 将 key 加入 tag 集合，tag 集合的过期时间不短于其中任意 key，expire 为 0 时不过期
+const tagAddScript = `local new = redis.call('exists', KEYS[1]) == 0
+redis.call('sadd', KEYS[1], ARGV[1])
+local expire = tonumber(ARGV[2])
+if expire <= 0 then
+	redis.call('persist', KEYS[1])
+	return 0
+end
+local ttl = redis.call('pttl', KEYS[1])
+if new or (ttl >= 0 and ttl < expire) then
+	redis.call('pexpire', KEYS[1], expire)
+end
+return 0`
+
+// tagKey tag 集合的 key，同一 namespace 下的 Cache 共享 tag，可以跨 Cache 失效
+func tagKey(tag string) string {
+	return "__tag." + tag
+}
+
+func queueTags(ctx context.Context, pipe *redis.Pipeline, skey string, tags []string, expire time.Duration) {
+	for _, tag := range tags {
+		pipe.Eval(ctx, tagAddScript, []string{tagKey(tag)}, skey, expire.Milliseconds())
+	}
+}
+
+// InvalidateTag 删除 tag 关联的所有 key，返回删除的数量
+// NOTE: tag 集合中的 key 在过期或 Del 后不会立即移除，随 tag 集合过期或下次 InvalidateTag 清理
+func (m *Cache) InvalidateTag(ctx context.Context, tag string) (int64, error) {
+	fun := "Cache.InvalidateTag -->"
+	command := "cache.value.InvalidateTag"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+
+	client, err := m.getInvalidateInstance(ctx)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.namespace)
+		return 0, err
+	}
+
+	var deleted int64
+	for {
+		n, done, err := m.invalidateTagBatch(ctx, client, tag)
+		deleted += n
+		if err != nil {
+			statReqErr(m.namespace, command, err)
+			m.fireRedisError(ctx, tag, st.Duration(), err)
+			slog.Errorf(ctx, "%s tag: %s deleted: %d err: %v", fun, tag, deleted, err)
+			return deleted, err
+		}
+		if done {
+			break
+		}
+	}
+	return deleted, nil
+}
+
+// invalidateTagBatch 从 tag 集合中取出一批 key 删除，删除失败时将 key 放回集合
+// NOTE: 使用 SPOP 而不是 SMEMBERS + DEL，执行期间新关联的 key 不会丢失
+func (m *Cache) invalidateTagBatch(ctx context.Context, client *redis.Client, tag string) (int64, bool, error) {
+	now := time.Now()
+	opCtx, cancel := opContext(ctx, client, opDel)
+	defer cancel()
+
+	keys, err := client.SPopN(opCtx, tagKey(tag), tagBatchSize).Result()
+	if err != nil && err.Error() != redis.RedisNil {
+		m.recordBreaker(ctx, err, time.Since(now))
+		return 0, false, err
+	}
+	if len(keys) == 0 {
+		return 0, true, nil
+	}
+
+	n, err := unlink(opCtx, client, keys)
+	m.recordBreaker(ctx, err, time.Since(now))
+	if err != nil {
+		members := make([]interface{}, len(keys))
+		for i, key := range keys {
+			members[i] = key
+		}
+		_ = client.SAdd(opCtx, tagKey(tag), members...).Err()
+		if expire := expireOf(m.policy(client), false); expire > 0 {
+			_ = client.Expire(opCtx, tagKey(tag), expire).Err()
+		}
+		return 0, false, err
+	}
+
+	if m.hotKeys != nil {
+		for _, key := range keys {
+			m.hotKeys.remove(key)
+		}
+	}
+	return n, len(keys) < tagBatchSize, nil
+}
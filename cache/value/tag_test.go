@@ -0,0 +1,14 @@
+package value
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTags(t *testing.T) {
+	o := newOptions([]Option{WithTags("user:42"), WithTags("org:7", "org:8")})
+	assert.Equal(t, []string{"user:42", "org:7", "org:8"}, o.tags)
+	assert.Nil(t, newOptions(nil).tags)
+	assert.Equal(t, "__tag.user:42", tagKey("user:42"))
+}
@@ -0,0 +1,71 @@
+package value
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// keyTemplate 形如 user:%d:profile 的 key 模板，只能包含一个 %d 或 %s，%% 表示 %
+type keyTemplate struct {
+	before string
+	after  string
+	verb   byte
+}
+
+func parseKeyTemplate(tpl string) (*keyTemplate, error) {
+	t := &keyTemplate{}
+	var buf strings.Builder
+	for i := 0; i < len(tpl); i++ {
+		if tpl[i] != '%' {
+			buf.WriteByte(tpl[i])
+			continue
+		}
+		if i+1 >= len(tpl) {
+			return nil, fmt.Errorf("key template %q: trailing %%", tpl)
+		}
+		i++
+		switch c := tpl[i]; c {
+		case '%':
+			buf.WriteByte('%')
+		case 'd', 's':
+			if t.verb != 0 {
+				return nil, fmt.Errorf("key template %q: more than one verb", tpl)
+			}
+			t.verb = c
+			t.before = buf.String()
+			buf.Reset()
+		default:
+			return nil, fmt.Errorf("key template %q: unsupported verb %%%c", tpl, c)
+		}
+	}
+	if t.verb == 0 {
+		return nil, fmt.Errorf("key template %q: missing %%d or %%s", tpl)
+	}
+	t.after = buf.String()
+	return t, nil
+}
+
+// format %d 只接受整数类型的 key，%s 只接受 string
+func (t *keyTemplate) format(key interface{}, skey string) (string, error) {
+	_, isString := key.(string)
+	if t.verb == 'd' && isString {
+		return "", fmt.Errorf("key err: %%d expects integer key, got string %q", skey)
+	}
+	if t.verb == 's' && !isString {
+		return "", fmt.Errorf("key err: %%s expects string key, got %T", key)
+	}
+	return t.before + skey + t.after, nil
+}
+
+// NewCacheWithTemplate 与 NewCache 相同，key 按 template 生成而不是 prefix.key，
+// 用于与其他语言客户端约定的 key 格式保持一致，例如 user:%d:profile
+func NewCacheWithTemplate(namespace, template string, expire time.Duration, load LoadFunc) (*Cache, error) {
+	t, err := parseKeyTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	c := NewCache(namespace, template, expire, load)
+	c.template = t
+	return c, nil
+}
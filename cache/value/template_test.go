@@ -0,0 +1,44 @@
+package value
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeyTemplate(t *testing.T) {
+	tpl, err := parseKeyTemplate("user:%d:profile")
+	assert.NoError(t, err)
+	assert.Equal(t, &keyTemplate{before: "user:", after: ":profile", verb: 'd'}, tpl)
+
+	tpl, err = parseKeyTemplate("100%%:%s")
+	assert.NoError(t, err)
+	assert.Equal(t, &keyTemplate{before: "100%:", verb: 's'}, tpl)
+
+	for _, s := range []string{"user", "user:%d:%d", "user:%v", "user:%d%"} {
+		_, err := parseKeyTemplate(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestCache_template(t *testing.T) {
+	_, err := NewCacheWithTemplate("base/test", "user:%x", time.Minute, nil)
+	assert.Error(t, err)
+
+	c, err := NewCacheWithTemplate("base/test", "user:%d:profile", time.Minute, nil)
+	assert.NoError(t, err)
+	skey, err := c.prefixKey(int64(42))
+	assert.NoError(t, err)
+	assert.Equal(t, "user:42:profile", skey)
+	_, err = c.prefixKey("42")
+	assert.Error(t, err)
+
+	c, err = NewCacheWithTemplate("base/test", "session:%s", time.Minute, nil)
+	assert.NoError(t, err)
+	skey, err = c.prefixKey("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "session:abc", skey)
+	_, err = c.prefixKey(1)
+	assert.Error(t, err)
+}
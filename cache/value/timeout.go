@@ -0,0 +1,45 @@
+package value
+
+import (
+	"context"
+	"time"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+)
+
+type opType int
+
+const (
+	opGet opType = iota
+	opSet
+	opDel
+)
+
+type opTimeoutKey struct{}
+
+// WithOpTimeout 指定本次调用中每个 redis 操作的超时时间，优先级高于 namespace 配置，
+// 只作用于 redis 读写，不影响 load 的执行时间
+func WithOpTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, opTimeoutKey{}, timeout)
+}
+
+// opContext 为单个 redis 操作派生带 deadline 的 ctx，未配置超时时直接返回原 ctx
+func opContext(ctx context.Context, client *redis.Client, op opType) (context.Context, context.CancelFunc) {
+	timeout, ok := ctx.Value(opTimeoutKey{}).(time.Duration)
+	if !ok {
+		timeouts := client.OpTimeouts()
+		switch op {
+		case opGet:
+			timeout = timeouts.Get
+		case opSet:
+			timeout = timeouts.Set
+		case opDel:
+			timeout = timeouts.Del
+		}
+	}
+
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,26 @@
+package value
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpContext(t *testing.T) {
+	ctx := context.Background()
+	client := &redis.Client{}
+
+	opCtx, cancel := opContext(ctx, client, opGet)
+	_, ok := opCtx.Deadline()
+	assert.False(t, ok)
+	cancel()
+
+	opCtx, cancel = opContext(WithOpTimeout(ctx, time.Second), client, opDel)
+	deadline, ok := opCtx.Deadline()
+	assert.True(t, ok)
+	assert.True(t, time.Until(deadline) <= time.Second)
+	cancel()
+}
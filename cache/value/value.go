@@ -17,9 +17,10 @@ import (
 	"github.com/shawnfeng/sutil/cache"
 	"github.com/shawnfeng/sutil/cache/constants"
 	"github.com/shawnfeng/sutil/cache/redis"
-	"github.com/shawnfeng/sutil/scontext"
 	"github.com/shawnfeng/sutil/slog/slog"
 	"github.com/shawnfeng/sutil/stime"
+	"net/http"
+	"sync"
 	"time"
 )
 
@@ -31,6 +32,25 @@ type Cache struct {
 	prefix    string
 	load      LoadFunc
 	expire    time.Duration
+	fallback  *localCache
+	hotKeys   *hotKeys
+	chunkSize int
+	encryptor *encryptor
+	// 不小于该字节数的值压缩后写入，0 表示不压缩
+	compressMinSize int
+	// stale 窗口内正在异步刷新的 key
+	refreshing sync.Map
+	hooks      hooks
+	// load 或序列化失败时的缓存策略
+	errorPolicy ErrorPolicy
+	schema      *schema
+	xfetch      *xfetch
+	stats       stats
+	// 通过 NewCacheWithTemplate 创建时 key 按模板生成
+	template *keyTemplate
+	delRetry *delRetryQueue
+	// 值的最大字节数，0 表示不限制
+	maxValueSize int
 }
 
 func NewCache(namespace, prefix string, expire time.Duration, load LoadFunc) *Cache {
@@ -42,15 +62,20 @@ func NewCache(namespace, prefix string, expire time.Duration, load LoadFunc) *Ca
 	}
 }
 
+// WithRouteGroup 指定 ctx 中的缓存请求路由到 group 对应的实例，同一 namespace 可以按请求路由到不同集群
+func WithRouteGroup(ctx context.Context, group string) context.Context {
+	return redis.WithRouteGroup(ctx, group)
+}
+
 func (m *Cache) getInstanceConf(ctx context.Context) *redis.InstanceConf {
 	return &redis.InstanceConf{
-		Group:     scontext.GetControlRouteGroupWithDefault(ctx, constants.DefaultRouteGroup),
+		Group:     redis.RouteGroup(ctx),
 		Namespace: m.namespace,
 		Wrapper:   cache.WrapperTypeCache,
 	}
 }
 
-func (m *Cache) Get(ctx context.Context, key, value interface{}) error {
+func (m *Cache) Get(ctx context.Context, key, value interface{}, opts ...Option) error {
 	fun := "Cache.Get -->"
 	// TODO 目前统计的是cache层的Get，后面需要拆分为redis层、cache层
 	command := "cache.value.Get"
@@ -61,30 +86,96 @@ func (m *Cache) Get(ctx context.Context, key, value interface{}) error {
 		statReqDuration(m.namespace, command, st.Millisecond())
 	}()
 
-	err := m.getValueFromCache(ctx, key, value)
+	now := time.Now()
+	err := m.getValueFromCache(ctx, key, value, opts...)
 	if err == nil {
 		_metricHits.With("namespace", m.namespace, "command", command).Inc()
+		m.fireHit(ctx, key, time.Since(now))
 		return nil
 	}
 
+	if err == ErrBreakerOpen {
+		statReqErr(m.namespace, command, err)
+		m.fireRedisError(ctx, key, time.Since(now), err)
+		return m.loadFallback(ctx, key, value)
+	}
+
+	// 命中占位值，返回其中记录的 load 错误
+	if isCachedLoadError(err) {
+		_metricHits.With("namespace", m.namespace, "command", command).Inc()
+		m.fireHit(ctx, key, time.Since(now))
+		return err
+	}
+
 	if err.Error() != redis.RedisNil {
 		statReqErr(m.namespace, command, err)
+		m.fireRedisError(ctx, key, time.Since(now), err)
 		slog.Errorf(ctx, "%s cache key: %v err: %v", fun, key, err)
 		return fmt.Errorf("%s cache key: %v err: %v", fun, key, err)
 	}
 	_metricMiss.With("namespace", m.namespace, "command", command).Inc()
+	m.fireMiss(ctx, key, time.Since(now))
 
-	data, err := m.loadValueToCache(ctx, key)
+	data, err := m.loadValueToCache(ctx, key, opts...)
 	if err != nil {
 		statReqErr(m.namespace, command, err)
 		slog.Errorf(ctx, "%s loadValueToCache key: %v err: %v", fun, key, err)
 		return err
 	}
 
-	err = json.Unmarshal(data, value)
+	err = decodeValue(data, value)
 	if err != nil {
 		statReqErr(m.namespace, command, err)
-		return errors.New(string(data))
+		return err
+	}
+
+	return nil
+}
+
+// Set 将 value 按 json 编码写入缓存，过期时间与 load 写入时一致（可通过 WithExpire 单独指定），用于更新数据后的 write-through
+func (m *Cache) Set(ctx context.Context, key, value interface{}, opts ...Option) error {
+	fun := "Cache.Set -->"
+	command := "cache.value.Set"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s marshal err, cache key: %v err: %v", fun, key, err)
+		return err
+	}
+
+	skey, err := m.prefixKey(key)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s fixkey, key: %v err: %v", fun, key, err)
+		return err
+	}
+
+	client, err := m.getInstance(ctx)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.namespace)
+		return err
+	}
+
+	now := time.Now()
+	opCtx, cancel := opContext(ctx, client, opSet)
+	defer cancel()
+	err = m.setData(opCtx, client, skey, data, expireOf(m.policy(client, opts...), false), newOptions(opts).tags)
+	m.recordBreaker(ctx, err, time.Since(now))
+	if m.hotKeys != nil {
+		m.hotKeys.remove(skey)
+	}
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		m.fireRedisError(ctx, key, time.Since(now), err)
+		return fmt.Errorf("set cache key: %v err: %s", key, err.Error())
 	}
 
 	return nil
@@ -108,23 +199,115 @@ func (m *Cache) Del(ctx context.Context, key interface{}) error {
 		return err
 	}
 
-	client, err := redis.DefaultInstanceManager.GetInstance(ctx, m.getInstanceConf(ctx))
+	client, err := m.getInvalidateInstance(ctx)
 	if err != nil {
 		statReqErr(m.namespace, command, err)
 		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.namespace)
+		if m.delRetry != nil {
+			m.delRetry.add(ctx, skey)
+		}
 		return err
 	}
 
-	err = client.Del(ctx, skey).Err()
+	now := time.Now()
+	opCtx, cancel := opContext(ctx, client, opDel)
+	defer cancel()
+	err = m.delData(opCtx, client, skey)
+	m.recordBreaker(ctx, err, time.Since(now))
+	if m.hotKeys != nil {
+		m.hotKeys.remove(skey)
+	}
 	if err != nil {
 		statReqErr(m.namespace, command, err)
+		m.fireRedisError(ctx, key, time.Since(now), err)
+		if m.delRetry != nil {
+			m.delRetry.add(ctx, skey)
+		}
 		return fmt.Errorf("del cache key: %v err: %s", key, err.Error())
 	}
 
 	return nil
 }
 
-func (m *Cache) Load(ctx context.Context, key interface{}) error {
+// Exists 只检查缓存中是否存在 key，不会触发 load
+// NOTE: load 失败时写入的短期脏数据同样视为存在
+func (m *Cache) Exists(ctx context.Context, key interface{}) (bool, error) {
+	fun := "Cache.Exists -->"
+	command := "cache.value.Exists"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+
+	skey, err := m.prefixKey(key)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s fixkey, key: %v err: %v", fun, key, err)
+		return false, err
+	}
+
+	client, err := m.getInstance(ctx)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.namespace)
+		return false, err
+	}
+
+	opCtx, cancel := opContext(ctx, client, opGet)
+	defer cancel()
+	n, err := client.Exists(opCtx, skey).Result()
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		return false, fmt.Errorf("exists cache key: %v err: %s", key, err.Error())
+	}
+
+	return n > 0, nil
+}
+
+// TTL 返回 key 的剩余过期时间，不会触发 load；
+// 与 redis TTL 语义一致，key 不存在时返回 -2s，key 没有设置过期时间时返回 -1s
+func (m *Cache) TTL(ctx context.Context, key interface{}) (time.Duration, error) {
+	fun := "Cache.TTL -->"
+	command := "cache.value.TTL"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+
+	skey, err := m.prefixKey(key)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s fixkey, key: %v err: %v", fun, key, err)
+		return 0, err
+	}
+
+	client, err := m.getInstance(ctx)
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.namespace)
+		return 0, err
+	}
+
+	opCtx, cancel := opContext(ctx, client, opGet)
+	defer cancel()
+	ttl, err := client.TTL(opCtx, skey).Result()
+	if err != nil {
+		statReqErr(m.namespace, command, err)
+		return 0, fmt.Errorf("ttl cache key: %v err: %s", key, err.Error())
+	}
+
+	// NOTE: go-redis v9 对 -2、-1 不再乘以精度，这里保持以秒为单位的返回值
+	if ttl < 0 {
+		ttl = ttl * time.Second
+	}
+	return ttl, nil
+}
+
+func (m *Cache) Load(ctx context.Context, key interface{}, opts ...Option) error {
 	command := "cache.value.Load"
 	span, ctx := opentracing.StartSpanFromContext(ctx, command)
 	st := stime.NewTimeStat()
@@ -133,7 +316,7 @@ func (m *Cache) Load(ctx context.Context, key interface{}) error {
 		statReqDuration(m.namespace, command, st.Millisecond())
 	}()
 
-	_, err := m.loadValueToCache(ctx, key)
+	_, err := m.loadValueToCache(ctx, key, opts...)
 	statReqErr(m.namespace, command, err)
 
 	return err
@@ -175,6 +358,10 @@ func (m *Cache) prefixKey(key interface{}) (string, error) {
 		return "", err
 	}
 
+	if m.template != nil {
+		return m.template.format(key, skey)
+	}
+
 	if len(m.prefix) > 0 {
 		return fmt.Sprintf("%s.%s", m.prefix, skey), nil
 	}
@@ -182,7 +369,7 @@ func (m *Cache) prefixKey(key interface{}) (string, error) {
 	return skey, nil
 }
 
-func (m *Cache) getValueFromCache(ctx context.Context, key, value interface{}) error {
+func (m *Cache) getValueFromCache(ctx context.Context, key, value interface{}, opts ...Option) error {
 	fun := "Cache.getValueFromCache -->"
 
 	skey, err := m.prefixKey(key)
@@ -190,45 +377,70 @@ func (m *Cache) getValueFromCache(ctx context.Context, key, value interface{}) e
 		return err
 	}
 
-	client, err := redis.DefaultInstanceManager.GetInstance(ctx, m.getInstanceConf(ctx))
+	if m.hotKeys != nil {
+		if data, ok := m.hotKeys.access(skey); ok {
+			return decodeValue(data, value)
+		}
+	}
+
+	client, err := m.getInstance(ctx)
+	if err == ErrBreakerOpen {
+		return err
+	}
 	if err != nil {
 		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.namespace)
 		return err
 	}
 
-	data, err := client.Get(ctx, skey).Bytes()
+	now := time.Now()
+	opCtx, cancel := opContext(ctx, client, opGet)
+	defer cancel()
+	p := m.policy(client)
+	data, ttl, err := getData(opCtx, client, skey, p.StaleWindow > 0 || m.xfetch != nil)
+	m.recordBreaker(ctx, err, time.Since(now))
 	if err != nil {
 		return err
 	}
 
+	data, err = m.unwrapData(opCtx, client, key, skey, data)
+	if err != nil {
+		return err
+	}
+
+	if m.hotKeys != nil {
+		m.hotKeys.store(skey, data)
+	}
+
 	//slog.Infof(ctx, "%s key: %v data: %s", fun, key, string(data))
 
-	err = json.Unmarshal(data, value)
+	err = decodeValue(data, value)
 	if err != nil {
-		return errors.New(string(data))
+		return err
+	}
+
+	if m.needRefresh(p, ttl) {
+		m.refreshAsync(ctx, key, skey, opts...)
 	}
 
 	return nil
 }
 
-func (m *Cache) loadValueToCache(ctx context.Context, key interface{}) (data []byte, err error) {
+func (m *Cache) loadValueToCache(ctx context.Context, key interface{}, opts ...Option) ([]byte, error) {
 	fun := "Cache.loadValueToCache -->"
-	expire := m.expire
 
+	now := time.Now()
 	value, err := m.load(ctx, key)
+	m.xfetch.observe(time.Since(now))
+	var data []byte
+	marshalFailed := false
 	if err != nil {
+		m.fireLoadError(ctx, key, time.Since(now), err)
 		slog.Warnf(ctx, "%s load err, cache key:%v err:%v", fun, key, err)
-		data = []byte(err.Error())
-		expire = constants.CacheDirtyExpireTime
-
-	} else {
-		data, err = json.Marshal(value)
-		if err != nil {
-			slog.Errorf(ctx, "%s marshal err, cache key:%v err:%v", fun, key, err)
-			data = []byte(err.Error())
-			expire = constants.CacheDirtyExpireTime
-		}
+	} else if data, err = json.Marshal(value); err != nil {
+		slog.Errorf(ctx, "%s marshal err, cache key:%v err:%v", fun, key, err)
+		marshalFailed = true
 	}
+	loadErr := err
 
 	skey, err := m.prefixKey(key)
 	if err != nil {
@@ -236,21 +448,35 @@ func (m *Cache) loadValueToCache(ctx context.Context, key interface{}) (data []b
 		return nil, err
 	}
 
-	client, err := redis.DefaultInstanceManager.GetInstance(ctx, m.getInstanceConf(ctx))
+	if loadErr != nil && !m.tombstoneOnError(marshalFailed) {
+		if m.errorPolicy == ErrorPolicyFailFast {
+			m.delOnError(ctx, key, skey)
+		}
+		return nil, loadErr
+	}
+	if loadErr != nil {
+		data = tombstone(loadErr)
+	}
+
+	client, err := m.getInstance(ctx)
 	if err != nil {
 		slog.Errorf(ctx, "%s get instance err, namespace: %s", fun, m.namespace)
 		return nil, err
 	}
 
-	rerr := client.Set(ctx, skey, data, expire).Err()
+	now = time.Now()
+	opCtx, cancel := opContext(ctx, client, opSet)
+	defer cancel()
+	rerr := m.setData(opCtx, client, skey, data, expireOf(m.policy(client, opts...), loadErr != nil), newOptions(opts).tags)
+	m.recordBreaker(ctx, rerr, time.Since(now))
 	if rerr != nil {
+		m.fireRedisError(ctx, key, time.Since(now), rerr)
 		slog.Errorf(ctx, "%s set err, cache key:%v rerr:%v", fun, key, rerr)
 	}
 
-	if err != nil {
-		return nil, err
+	if loadErr != nil {
+		return nil, loadErr
 	}
-
 	return data, nil
 }
 
@@ -270,6 +496,45 @@ func SetConfiger(ctx context.Context, configerType constants.ConfigerType) error
 	return err
 }
 
+// SetConfigerDryRun 创建并初始化 configer，检查其中所有 namespace 的配置并返回将会创建的实例，
+// 不替换当前使用的 configer，用于上线前确认配置
+func SetConfigerDryRun(ctx context.Context, configerType constants.ConfigerType) ([]*redis.ValidateResult, error) {
+	fun := "Cache.SetConfigerDryRun-->"
+	configer, err := redis.NewConfiger(configerType)
+	if err != nil {
+		slog.Errorf(ctx, "%s create configer err:%v", fun, err)
+		return nil, err
+	}
+	err = configer.Init(ctx)
+	if err != nil {
+		slog.Errorf(ctx, "%s init configer err:%v", fun, err)
+		return nil, err
+	}
+
+	results := configer.Validate(ctx)
+	for _, result := range results {
+		if result.Err == nil {
+			slog.Infof(ctx, "%s %v configer would create instance %s", fun, configerType, result)
+		}
+	}
+	return results, nil
+}
+
+// ValidateConfig 检查当前 configer 中所有 namespace 的配置
+func ValidateConfig(ctx context.Context) []*redis.ValidateResult {
+	return redis.DefaultConfiger.Validate(ctx)
+}
+
+// Close 在服务退出时调用，等待执行中的缓存命令完成后关闭所有连接
+func Close(ctx context.Context) error {
+	return redis.DefaultInstanceManager.Close(ctx)
+}
+
+// HealthHandler 返回所有缓存实例健康状态的 http handler，用于 /healthz 与 readiness 检查
+func HealthHandler() http.Handler {
+	return redis.DefaultInstanceManager.HealthHandler()
+}
+
 func WatchUpdate(ctx context.Context) {
 	go redis.DefaultInstanceManager.Watch(ctx)
 }
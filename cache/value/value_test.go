@@ -1,6 +1,7 @@
 package value
 
 import (
+	"bytes"
 	"context"
 	"github.com/shawnfeng/sutil/trace"
 
@@ -46,3 +47,214 @@ func TestGet(t *testing.T) {
 
 	time.Sleep(2 * time.Second)
 }
+
+func TestExistsTTL(t *testing.T) {
+	ctx := context.Background()
+	_ = trace.InitDefaultTracer("cache.test")
+
+	c := NewCache("test/test", "test", 60*time.Second, load)
+
+	c.Del(ctx, 8)
+	exists, err := c.Exists(ctx, 8)
+	if err != nil || exists {
+		t.Errorf("exists: %v err: %v", exists, err)
+	}
+	ttl, err := c.TTL(ctx, 8)
+	if err != nil || ttl != -2*time.Second {
+		t.Errorf("ttl: %v err: %v", ttl, err)
+	}
+
+	c.Load(ctx, 8)
+	exists, err = c.Exists(ctx, 8)
+	if err != nil || !exists {
+		t.Errorf("exists: %v err: %v", exists, err)
+	}
+	ttl, err = c.TTL(ctx, 8)
+	if err != nil || ttl <= 0 || ttl > 60*time.Second {
+		t.Errorf("ttl: %v err: %v", ttl, err)
+	}
+	c.Del(ctx, 8)
+}
+
+func TestWarm(t *testing.T) {
+	ctx := context.Background()
+	_ = trace.InitDefaultTracer("cache.test")
+
+	c := NewCache("test/test", "test", 60*time.Second, load)
+
+	keys := []interface{}{21, 22, 23, "24"}
+	errs := c.WarmWithParallel(ctx, keys, 2)
+	if len(errs) > 0 {
+		t.Errorf("warm errs: %v", errs)
+	}
+	for _, key := range keys {
+		exists, err := c.Exists(ctx, key)
+		if err != nil || !exists {
+			t.Errorf("key: %v exists: %v err: %v", key, exists, err)
+		}
+		c.Del(ctx, key)
+	}
+
+	errs = c.Warm(ctx, []interface{}{1.5})
+	if len(errs) != 1 {
+		t.Errorf("warm errs: %v", errs)
+	}
+}
+
+func TestSet(t *testing.T) {
+	ctx := context.Background()
+	_ = trace.InitDefaultTracer("cache.test")
+
+	c := NewCache("test/test", "test", 60*time.Second, load)
+
+	err := c.Set(ctx, 9, &Test{Id: 9})
+	if err != nil {
+		t.Errorf("set err: %v", err)
+	}
+
+	var test Test
+	err = c.Get(ctx, 9, &test)
+	if err != nil || test.Id != 9 {
+		t.Errorf("get: %v err: %v", test, err)
+	}
+	c.Del(ctx, 9)
+}
+
+func TestDelPrefix(t *testing.T) {
+	ctx := context.Background()
+	_ = trace.InitDefaultTracer("cache.test")
+
+	c := NewCache("test/test", "test", 60*time.Second, load)
+	for _, key := range []string{"tenant1:1", "tenant1:2", "tenant2:1"} {
+		if err := c.Set(ctx, key, &Test{Id: 1}); err != nil {
+			t.Errorf("set err: %v", err)
+		}
+	}
+
+	n, err := c.DelPrefix(ctx, "tenant1:", &DelPrefixOptions{DryRun: true})
+	if err != nil || n != 2 {
+		t.Errorf("dry run: %d err: %v", n, err)
+	}
+
+	var progress int64
+	n, err = c.DelPrefix(ctx, "tenant1:", &DelPrefixOptions{Progress: func(scanned, deleted int64) { progress = deleted }})
+	if err != nil || n != 2 || progress != 2 {
+		t.Errorf("del: %d progress: %d err: %v", n, progress, err)
+	}
+
+	exists, err := c.Exists(ctx, "tenant2:1")
+	if err != nil || !exists {
+		t.Errorf("exists: %v err: %v", exists, err)
+	}
+	c.Del(ctx, "tenant2:1")
+}
+
+func TestCounter(t *testing.T) {
+	ctx := context.Background()
+	_ = trace.InitDefaultTracer("cache.test")
+
+	c := NewCache("test/test", "test", 60*time.Second, load)
+	c.Del(ctx, "counter")
+
+	n, err := c.Incr(ctx, "counter")
+	if err != nil || n != 1 {
+		t.Errorf("incr: %d err: %v", n, err)
+	}
+	n, err = c.IncrBy(ctx, "counter", 5)
+	if err != nil || n != 6 {
+		t.Errorf("incrby: %d err: %v", n, err)
+	}
+	n, err = c.Decr(ctx, "counter")
+	if err != nil || n != 5 {
+		t.Errorf("decr: %d err: %v", n, err)
+	}
+	n, err = c.GetCounter(ctx, "counter")
+	if err != nil || n != 5 {
+		t.Errorf("get counter: %d err: %v", n, err)
+	}
+
+	ttl, err := c.TTL(ctx, "counter")
+	if err != nil || ttl <= 0 || ttl > 60*time.Second {
+		t.Errorf("ttl: %v err: %v", ttl, err)
+	}
+	c.Del(ctx, "counter")
+}
+
+func TestGetMulti(t *testing.T) {
+	ctx := context.Background()
+	_ = trace.InitDefaultTracer("cache.test")
+
+	c := NewCache("test/test", "test", 60*time.Second, load)
+	c.Del(ctx, 21)
+	c.Load(ctx, 22)
+
+	res, err := c.GetMulti(ctx, []interface{}{21, 22, 1.5}, WithLoadParallel(2))
+	if err != nil {
+		t.Errorf("get multi err: %v", err)
+		return
+	}
+	for _, key := range []interface{}{21, 22} {
+		var test Test
+		if err := res.Decode(key, &test); err != nil || test.Id != 1 {
+			t.Errorf("decode key: %v test: %v err: %v", key, test, err)
+		}
+	}
+	if len(res.Loaded) != 1 || res.Loaded[0] != 21 {
+		t.Errorf("loaded: %v", res.Loaded)
+	}
+	if _, ok := res.Errs[1.5]; !ok {
+		t.Errorf("errs: %v", res.Errs)
+	}
+	if ok, err := c.Exists(ctx, 21); err != nil || !ok {
+		t.Errorf("exists: %v err: %v", ok, err)
+	}
+}
+
+func TestInvalidateTag(t *testing.T) {
+	ctx := context.Background()
+	_ = trace.InitDefaultTracer("cache.test")
+
+	c := NewCache("test/test", "test", 60*time.Second, load)
+	other := NewCache("test/test", "other", 60*time.Second, load)
+	c.Set(ctx, 31, &Test{Id: 31}, WithTags("org:7"))
+	other.Load(ctx, 32, WithTags("org:7", "user:32"))
+
+	n, err := c.InvalidateTag(ctx, "org:7")
+	if err != nil || n != 2 {
+		t.Errorf("invalidate tag: %d err: %v", n, err)
+	}
+	if ok, _ := c.Exists(ctx, 31); ok {
+		t.Errorf("key 31 should be deleted")
+	}
+	if ok, _ := other.Exists(ctx, 32); ok {
+		t.Errorf("key 32 should be deleted")
+	}
+	c.InvalidateTag(ctx, "user:32")
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	_ = trace.InitDefaultTracer("cache.test")
+
+	c := NewCache("test/test", "test", 60*time.Second, load)
+	c.Load(ctx, "snapshot1")
+	c.Load(ctx, "snapshot2")
+
+	var buf bytes.Buffer
+	n, err := c.Export(ctx, &buf, "snapshot")
+	if err != nil || n != 2 {
+		t.Errorf("export: %d err: %v", n, err)
+	}
+
+	c.DelPrefix(ctx, "snapshot", nil)
+	n, err = c.Import(ctx, &buf, nil)
+	if err != nil || n != 2 {
+		t.Errorf("import: %d err: %v", n, err)
+	}
+
+	var test Test
+	if err := c.getValueFromCache(ctx, "snapshot1", &test); err != nil || test.Id != 1 {
+		t.Errorf("get: %v err: %v", test, err)
+	}
+	c.DelPrefix(ctx, "snapshot", nil)
+}
@@ -0,0 +1,53 @@
+package value
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+	"gitlab.pri.ibanyu.com/middleware/seaweed/xstat/xmetric/xprometheus"
+)
+
+var ErrValueTooLarge = errors.New("cache value too large")
+
+// 开启分片存储时一个值最多的分片数
+const maxChunkCount = 64
+
+var _metricValueTooLarge = xprometheus.NewCounter(&xprometheus.CounterVecOpts{
+	Namespace:  namespace,
+	Subsystem:  subsystem,
+	Name:       "value_too_large_total",
+	Help:       "cache.value writes rejected by max value size",
+	LabelNames: []string{"namespace"},
+})
+
+// SetMaxValueSize 编码后超过 size 字节的值拒绝写入并返回 ErrValueTooLarge，配置中心的 maxvaluesize 优先；
+// 开启 EnableChunk 时超出的值改为分片写入，超过 maxChunkCount 个分片的值仍然拒绝写入
+func (m *Cache) SetMaxValueSize(size int) *Cache {
+	m.maxValueSize = size
+	return m
+}
+
+func (m *Cache) maxValueSizeOf(client *redis.Client) int {
+	if size := client.MaxValueSize(); size > 0 {
+		return size
+	}
+	return m.maxValueSize
+}
+
+// checkValueSize data 为编码后写入 redis 的内容
+func (m *Cache) checkValueSize(ctx context.Context, client *redis.Client, skey string, data []byte) error {
+	fun := "Cache.checkValueSize -->"
+	size := m.maxValueSizeOf(client)
+	if m.chunkSize > 0 {
+		size = maxChunkCount * m.chunkSize
+	}
+	if size <= 0 || len(data) <= size {
+		return nil
+	}
+
+	_metricValueTooLarge.With("namespace", m.namespace).Inc()
+	slog.Errorf(ctx, "%s reject key: %s size: %d max: %d", fun, skey, len(data), size)
+	return ErrValueTooLarge
+}
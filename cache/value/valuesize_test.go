@@ -0,0 +1,29 @@
+package value
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_checkValueSize(t *testing.T) {
+	ctx := context.TODO()
+	client := &redis.Client{}
+	data := make([]byte, 100)
+
+	c := NewCache("base/test", "test", time.Minute, nil)
+	assert.NoError(t, c.checkValueSize(ctx, client, "test.1", data))
+
+	c.SetMaxValueSize(64)
+	assert.Equal(t, ErrValueTooLarge, c.checkValueSize(ctx, client, "test.1", data))
+	assert.NoError(t, c.checkValueSize(ctx, client, "test.1", data[:64]))
+
+	// 开启分片时超出的值分片写入，分片数不超过 maxChunkCount
+	c.EnableChunk(32)
+	assert.NoError(t, c.checkValueSize(ctx, client, "test.1", data))
+	assert.NoError(t, c.checkValueSize(ctx, client, "test.1", make([]byte, maxChunkCount*32)))
+	assert.Equal(t, ErrValueTooLarge, c.checkValueSize(ctx, client, "test.1", make([]byte, maxChunkCount*32+1)))
+}
@@ -0,0 +1,79 @@
+package value
+
+import (
+	"context"
+	"sync"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/shawnfeng/sutil/slog/slog"
+	"github.com/shawnfeng/sutil/stime"
+)
+
+// Warm 默认的并发加载数
+const defaultWarmParallel = 16
+
+// Warm 并发调用 load 并写入缓存，用于发布时预热，返回加载失败的 key 及对应错误，全部成功时返回 nil
+func (m *Cache) Warm(ctx context.Context, keys []interface{}) map[interface{}]error {
+	return m.WarmWithParallel(ctx, keys, defaultWarmParallel)
+}
+
+// WarmWithParallel 同 Warm，parallel 为最大并发加载数，小于等于 0 时使用默认值
+// ctx 结束后未开始加载的 key 直接以 ctx.Err() 作为错误返回
+func (m *Cache) WarmWithParallel(ctx context.Context, keys []interface{}, parallel int) map[interface{}]error {
+	fun := "Cache.Warm -->"
+	command := "cache.value.Warm"
+	span, ctx := opentracing.StartSpanFromContext(ctx, command)
+	st := stime.NewTimeStat()
+	defer func() {
+		span.Finish()
+		statReqDuration(m.namespace, command, st.Millisecond())
+	}()
+
+	if parallel <= 0 {
+		parallel = defaultWarmParallel
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs map[interface{}]error
+	)
+	addErr := func(key interface{}, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if errs == nil {
+			errs = make(map[interface{}]error)
+		}
+		errs[key] = err
+	}
+
+	sem := make(chan struct{}, parallel)
+	for _, key := range keys {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			addErr(key, ctx.Err())
+			continue
+		}
+
+		wg.Add(1)
+		go func(key interface{}) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if _, err := m.loadValueToCache(ctx, key); err != nil {
+				addErr(key, err)
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		slog.Warnf(ctx, "%s namespace: %s total: %d failed: %d", fun, m.namespace, len(keys), len(errs))
+		for _, err := range errs {
+			statReqErr(m.namespace, command, err)
+		}
+	}
+	return errs
+}
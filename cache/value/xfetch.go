@@ -0,0 +1,58 @@
+package value
+
+import (
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// xfetch 概率提前过期（XFetch），剩余过期时间越短、load 耗时越长，
+// Get 越可能提前触发异步 load，避免多实例部署时 key 同时过期导致回源尖峰
+type xfetch struct {
+	beta float64
+	// load 耗时的滑动平均，单位 ns
+	delta int64
+}
+
+// EnableXFetch 开启概率提前过期，beta 越大越倾向提前刷新，通常取 1
+func (m *Cache) EnableXFetch(beta float64) *Cache {
+	if beta <= 0 {
+		beta = 1
+	}
+	m.xfetch = &xfetch{beta: beta}
+	return m
+}
+
+// observe 记录一次 load 的耗时
+func (x *xfetch) observe(cost time.Duration) {
+	if x == nil {
+		return
+	}
+	old := atomic.LoadInt64(&x.delta)
+	if old == 0 {
+		atomic.StoreInt64(&x.delta, int64(cost))
+		return
+	}
+	// NOTE: 并发更新时可能丢失部分样本，对估算影响不大
+	atomic.StoreInt64(&x.delta, old-old/8+int64(cost)/8)
+}
+
+// early 剩余过期时间为 remain 时，本次读取是否需要提前刷新
+func (x *xfetch) early(remain time.Duration) bool {
+	if x == nil || remain < 0 {
+		return false
+	}
+	return shouldEarlyRefresh(time.Duration(atomic.LoadInt64(&x.delta)), x.beta, remain, rand.Float64())
+}
+
+// shouldEarlyRefresh delta * beta * -ln(r) >= remain 时提前刷新，r 为 (0, 1] 上的随机数
+func shouldEarlyRefresh(delta time.Duration, beta float64, remain time.Duration, r float64) bool {
+	if delta <= 0 {
+		return false
+	}
+	if r <= 0 {
+		r = math.SmallestNonzeroFloat64
+	}
+	return float64(delta)*beta*-math.Log(r) >= float64(remain)
+}
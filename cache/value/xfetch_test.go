@@ -0,0 +1,52 @@
+package value
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldEarlyRefresh(t *testing.T) {
+	delta := 100 * time.Millisecond
+	assert.False(t, shouldEarlyRefresh(0, 1, time.Millisecond, 0.5))
+	assert.False(t, shouldEarlyRefresh(delta, 1, time.Minute, 0.5))
+	assert.True(t, shouldEarlyRefresh(delta, 1, 10*time.Millisecond, 0.5))
+	// r 越小越倾向提前刷新
+	assert.True(t, shouldEarlyRefresh(delta, 1, time.Second, 1e-9))
+	assert.False(t, shouldEarlyRefresh(delta, 1, time.Second, 0.99))
+	// beta 越大越倾向提前刷新
+	assert.True(t, shouldEarlyRefresh(delta, 100, time.Second, 0.5))
+}
+
+func TestXFetch(t *testing.T) {
+	var x *xfetch
+	x.observe(time.Second)
+	assert.False(t, x.early(0))
+
+	c := NewCache("base/test", "test", time.Minute, nil).EnableXFetch(0)
+	assert.Equal(t, float64(1), c.xfetch.beta)
+	assert.False(t, c.xfetch.early(0))
+
+	c.xfetch.observe(800 * time.Millisecond)
+	assert.Equal(t, 800*time.Millisecond, time.Duration(c.xfetch.delta))
+	c.xfetch.observe(0)
+	assert.Equal(t, 700*time.Millisecond, time.Duration(c.xfetch.delta))
+	assert.False(t, c.xfetch.early(-1))
+	assert.True(t, c.xfetch.early(0))
+}
+
+func TestCache_needRefresh(t *testing.T) {
+	c := NewCache("base/test", "test", time.Minute, nil)
+	p := redis.CachePolicy{Expire: time.Minute}
+	assert.False(t, c.needRefresh(p, -1))
+	assert.False(t, c.needRefresh(p, time.Second))
+
+	p.StaleWindow = 10 * time.Second
+	assert.True(t, c.needRefresh(p, time.Second))
+	assert.False(t, c.needRefresh(p, 20*time.Second))
+
+	c.EnableXFetch(1).xfetch.observe(time.Hour)
+	assert.True(t, c.needRefresh(p, 10*time.Second))
+}
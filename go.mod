@@ -1,30 +1,36 @@
 module github.com/shawnfeng/sutil
 
 require (
+	github.com/IBM/sarama v1.43.3
 	github.com/ZhengHe-MD/agollo/v4 v4.1.4
 	github.com/ZhengHe-MD/properties v0.2.2
+	github.com/apache/pulsar-client-go v0.6.0
 	github.com/bitly/go-simplejson v0.5.0
 	github.com/coreos/etcd v3.3.17+incompatible
 	github.com/fzzy/radix v0.4.9-0.20141113025130-a3a55de9c594
-	github.com/go-redis/redis v6.15.1+incompatible
-	github.com/go-sql-driver/mysql v1.4.1
-	github.com/golang/protobuf v1.3.3
-	github.com/google/uuid v1.1.1
+	github.com/go-sql-driver/mysql v1.5.0
+	github.com/golang/protobuf v1.4.2
+	github.com/google/uuid v1.1.2
 	github.com/jinzhu/gorm v1.9.10
 	github.com/jmoiron/sqlx v1.2.0
 	github.com/julienschmidt/httprouter v1.2.0
 	github.com/kaneshin/go-pkg v0.0.0-20150919125626-a8e1479186cf
 	github.com/lib/pq v1.1.1
-	github.com/opentracing/opentracing-go v1.1.0
-	github.com/pkg/errors v0.8.1
-	github.com/prometheus/client_golang v1.2.1
-	github.com/prometheus/common v0.7.0
+	github.com/linkedin/goavro/v2 v2.10.0
+	github.com/nsqio/go-nsq v1.0.8
+	github.com/opentracing/opentracing-go v1.2.0
+	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.7.1
+	github.com/prometheus/common v0.10.0
+	github.com/redis/go-redis/v9 v9.5.1
 	github.com/sdming/gosnow v0.0.0-20130403030620-3a05c415e886
 	github.com/segmentio/kafka-go v0.3.4
 	github.com/shawnfeng/lumberjack.v2 v0.0.0-20181226094728-63d76296ede8
-	github.com/stretchr/testify v1.4.0
+	github.com/streadway/amqp v1.0.0
+	github.com/stretchr/testify v1.5.1
 	github.com/uber/jaeger-client-go v2.20.1+incompatible
 	github.com/vaughan0/go-ini v0.0.0-20130923145212-a98ad7ee00ec
+	github.com/xdg/scram v0.0.0-20180814205039-7eeb5667e42c
 	gitlab.pri.ibanyu.com/middleware/delayqueue v0.0.0-20200213090847-cd24af2bd1f2
 	gitlab.pri.ibanyu.com/middleware/seaweed v1.0.20
 	go.uber.org/zap v1.10.0
@@ -0,0 +1,241 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// topic 管理，目前仅 kafka 支持，使用 topic 所在集群的 brokers 与认证配置
+// 服务启动时调用 EnsureTopics 检查依赖的 topic，配置项 autocreate 为 true 时按配置项 partitions、replication、retention 创建缺少的 topic
+// NOTE: segmentio/kafka-go v0.3.4 没有 CreatePartitions 与 AlterConfigs 请求，暂不支持修改已有 topic 的 partition 数与配置，
+// 需要更换 kafka 客户端后再支持；另外 broker 开启 auto.create.topics.enable 时，查询不存在的 topic 会按 broker 的默认配置创建
+const (
+	kafkaRetentionKey = "retention.ms"
+)
+
+// TopicSpec 创建 topic 的参数，Partitions 与 ReplicationFactor <= 0 时使用 broker 的默认值
+type TopicSpec struct {
+	Topic             string
+	Partitions        int
+	ReplicationFactor int
+	Retention         time.Duration
+	Configs           map[string]string
+}
+
+func (m *TopicSpec) kafkaTopicConfig(topic string) kafka.TopicConfig {
+	config := kafka.TopicConfig{
+		Topic:             topic,
+		NumPartitions:     m.Partitions,
+		ReplicationFactor: m.ReplicationFactor,
+	}
+	if config.NumPartitions <= 0 {
+		config.NumPartitions = -1
+	}
+	if config.ReplicationFactor <= 0 {
+		config.ReplicationFactor = -1
+	}
+	if m.Retention > 0 {
+		config.ConfigEntries = append(config.ConfigEntries, kafka.ConfigEntry{
+			ConfigName:  kafkaRetentionKey,
+			ConfigValue: strconv.FormatInt(int64(m.Retention/time.Millisecond), 10),
+		})
+	}
+	for k, v := range m.Configs {
+		config.ConfigEntries = append(config.ConfigEntries, kafka.ConfigEntry{
+			ConfigName:  k,
+			ConfigValue: v,
+		})
+	}
+	return config
+}
+
+// PartitionInfo Leader 与 Replicas 为 broker 的 host:port
+type PartitionInfo struct {
+	ID       int
+	Leader   string
+	Replicas []string
+	Isr      []string
+}
+
+type TopicInfo struct {
+	Topic      string
+	Partitions []PartitionInfo
+}
+
+func kafkaBrokerAddr(broker kafka.Broker) string {
+	return net.JoinHostPort(broker.Host, strconv.Itoa(broker.Port))
+}
+
+func kafkaBrokerAddrs(brokers []kafka.Broker) []string {
+	addrs := make([]string, 0, len(brokers))
+	for _, broker := range brokers {
+		addrs = append(addrs, kafkaBrokerAddr(broker))
+	}
+	return addrs
+}
+
+func newTopicInfo(topic string, partitions []kafka.Partition) *TopicInfo {
+	info := &TopicInfo{Topic: topic}
+	for _, p := range partitions {
+		info.Partitions = append(info.Partitions, PartitionInfo{
+			ID:       p.ID,
+			Leader:   kafkaBrokerAddr(p.Leader),
+			Replicas: kafkaBrokerAddrs(p.Replicas),
+			Isr:      kafkaBrokerAddrs(p.Isr),
+		})
+	}
+	return info
+}
+
+// getAdminConfig topic 需要配置在 kafka 下
+func getAdminConfig(ctx context.Context, topic string) (*Config, *kafka.Dialer, error) {
+	config, err := getReadWriteConfig(ctx, topic)
+	if err != nil {
+		return nil, nil, err
+	}
+	if config.MQType != MQTypeKafka {
+		return nil, nil, fmt.Errorf("topic admin not supported for mqType: %v, topic: %s", config.MQType, topic)
+	}
+	if len(config.MQAddr) == 0 {
+		return nil, nil, fmt.Errorf("no brokers, topic: %s", topic)
+	}
+
+	dialer, err := kafkaDialer(config.Auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dialer == nil {
+		dialer = kafka.DefaultDialer
+	}
+	return config, dialer, nil
+}
+
+// dialKafka 依次尝试 brokers
+func dialKafka(ctx context.Context, dialer *kafka.Dialer, brokers []string) (conn *kafka.Conn, err error) {
+	for _, broker := range brokers {
+		if conn, err = dialer.DialContext(ctx, "tcp", broker); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// dialKafkaController 创建 topic 需要发送到 controller
+func dialKafkaController(ctx context.Context, dialer *kafka.Dialer, brokers []string) (*kafka.Conn, error) {
+	conn, err := dialKafka(ctx, dialer, brokers)
+	if err != nil {
+		return nil, err
+	}
+	controller, err := conn.Controller()
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+	return dialer.DialContext(ctx, "tcp", kafkaBrokerAddr(controller))
+}
+
+// CreateTopic 创建 topic，已存在时返回 nil
+func CreateTopic(ctx context.Context, spec TopicSpec) error {
+	fun := "mq.CreateTopic -->"
+
+	config, dialer, err := getAdminConfig(ctx, spec.Topic)
+	if err != nil {
+		slog.Errorf(ctx, "%s getAdminConfig err: %v, topic: %s", fun, err, spec.Topic)
+		return err
+	}
+
+	conn, err := dialKafkaController(ctx, dialer, config.MQAddr)
+	if err != nil {
+		slog.Errorf(ctx, "%s dial controller err: %v, topic: %s", fun, err, spec.Topic)
+		return err
+	}
+	defer conn.Close()
+
+	topic := wrapTopicFromContext(ctx, spec.Topic)
+	err = conn.CreateTopics(spec.kafkaTopicConfig(topic))
+	if err != nil {
+		slog.Errorf(ctx, "%s create err: %v, topic: %s", fun, err, topic)
+		return err
+	}
+	slog.Infof(ctx, "%s created topic: %s, partitions: %d, replication: %d", fun, topic, spec.Partitions, spec.ReplicationFactor)
+	return nil
+}
+
+// DescribeTopic 返回 topic 的 partition 分布，topic 不存在时返回 kafka.UnknownTopicOrPartition
+func DescribeTopic(ctx context.Context, topic string) (*TopicInfo, error) {
+	fun := "mq.DescribeTopic -->"
+
+	config, dialer, err := getAdminConfig(ctx, topic)
+	if err != nil {
+		slog.Errorf(ctx, "%s getAdminConfig err: %v, topic: %s", fun, err, topic)
+		return nil, err
+	}
+
+	conn, err := dialKafka(ctx, dialer, config.MQAddr)
+	if err != nil {
+		slog.Errorf(ctx, "%s dial err: %v, topic: %s", fun, err, topic)
+		return nil, err
+	}
+	defer conn.Close()
+
+	topic = wrapTopicFromContext(ctx, topic)
+	partitions, err := conn.ReadPartitions(topic)
+	if err != nil {
+		return nil, err
+	}
+	return newTopicInfo(topic, partitions), nil
+}
+
+// EnsureTopics 检查 topics 都已存在，配置了 autocreate 的 topic 不存在时创建，返回所有不存在或检查失败的 topic
+func EnsureTopics(ctx context.Context, topics ...string) error {
+	fun := "mq.EnsureTopics -->"
+
+	var errs []string
+	for _, topic := range topics {
+		_, err := DescribeTopic(ctx, topic)
+		if err == nil {
+			continue
+		}
+		if err != kafka.UnknownTopicOrPartition {
+			errs = append(errs, fmt.Sprintf("%s: %v", topic, err))
+			continue
+		}
+
+		config, err := getReadWriteConfig(ctx, topic)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", topic, err))
+			continue
+		}
+		if !config.AutoCreate {
+			errs = append(errs, fmt.Sprintf("%s: not exist", topic))
+			continue
+		}
+
+		err = CreateTopic(ctx, TopicSpec{
+			Topic:             topic,
+			Partitions:        config.Partitions,
+			ReplicationFactor: config.Replication,
+			Retention:         config.Retention,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", topic, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		slog.Errorf(ctx, "%s topics check failed: %s", fun, strings.Join(errs, "; "))
+		return fmt.Errorf("%s topics check failed: %s", fun, strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package mq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func TestTopicSpec_kafkaTopicConfig(t *testing.T) {
+	spec := TopicSpec{Topic: "test"}
+	config := spec.kafkaTopicConfig("test_g1")
+	assert.Equal(t, "test_g1", config.Topic)
+	assert.Equal(t, -1, config.NumPartitions)
+	assert.Equal(t, -1, config.ReplicationFactor)
+	assert.Equal(t, 0, len(config.ConfigEntries))
+
+	spec = TopicSpec{
+		Topic:             "test",
+		Partitions:        6,
+		ReplicationFactor: 3,
+		Retention:         72 * time.Hour,
+		Configs:           map[string]string{"cleanup.policy": "compact"},
+	}
+	config = spec.kafkaTopicConfig("test")
+	assert.Equal(t, 6, config.NumPartitions)
+	assert.Equal(t, 3, config.ReplicationFactor)
+	assert.Equal(t, 2, len(config.ConfigEntries))
+	assert.Equal(t, kafka.ConfigEntry{ConfigName: kafkaRetentionKey, ConfigValue: "259200000"}, config.ConfigEntries[0])
+	assert.Equal(t, kafka.ConfigEntry{ConfigName: "cleanup.policy", ConfigValue: "compact"}, config.ConfigEntries[1])
+}
+
+func TestNewTopicInfo(t *testing.T) {
+	b1 := kafka.Broker{Host: "10.0.0.1", Port: 9092, ID: 1}
+	b2 := kafka.Broker{Host: "10.0.0.2", Port: 9092, ID: 2}
+	info := newTopicInfo("test", []kafka.Partition{
+		{Topic: "test", ID: 0, Leader: b1, Replicas: []kafka.Broker{b1, b2}, Isr: []kafka.Broker{b1}},
+	})
+	assert.Equal(t, "test", info.Topic)
+	assert.Equal(t, 1, len(info.Partitions))
+	assert.Equal(t, "10.0.0.1:9092", info.Partitions[0].Leader)
+	assert.Equal(t, []string{"10.0.0.1:9092", "10.0.0.2:9092"}, info.Partitions[0].Replicas)
+	assert.Equal(t, []string{"10.0.0.1:9092"}, info.Partitions[0].Isr)
+}
@@ -0,0 +1,306 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// 调用 RegisterAvroSchema 的 topic，写入时 Payload.Value 按 avro 编码，格式与 confluent 的 wire format 一致：
+// 1 字节 magic 0 + 4 字节大端的 schema id + avro binary，再经 base64 编码后放入 Payload.Value，
+// 读取时根据 schema id 从 schema registry 获取 schema 解码，对调用方透明
+//
+//	mq.SetSchemaRegistry("http://schema-registry.ibanyu.com:8081")
+//	mq.RegisterAvroSchema(ctx, topic, schema, mq.TopicNameStrategy)
+//
+// NOTE: 消息先序列化为 json 再按 avro 的 json 编码解析，union 类型的字段需要按 avro 的 json 编码，如 {"string": "a"}
+const (
+	payloadCodecAvro = "avro"
+
+	avroMagicByte  = 0
+	avroHeaderSize = 5
+
+	schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+)
+
+// SubjectNameStrategy 与 confluent 的 subject 命名策略一致
+type SubjectNameStrategy int
+
+const (
+	// <topic>-value
+	TopicNameStrategy SubjectNameStrategy = iota
+	// <record 全名>
+	RecordNameStrategy
+	// <topic>-<record 全名>
+	TopicRecordNameStrategy
+)
+
+func (s SubjectNameStrategy) String() string {
+	switch s {
+	case TopicNameStrategy:
+		return "topic"
+	case RecordNameStrategy:
+		return "record"
+	case TopicRecordNameStrategy:
+		return "topic_record"
+	default:
+		return ""
+	}
+}
+
+func (s SubjectNameStrategy) subject(topic, recordName string) string {
+	switch s {
+	case RecordNameStrategy:
+		return recordName
+	case TopicRecordNameStrategy:
+		return topic + "-" + recordName
+	default:
+		return topic + "-value"
+	}
+}
+
+// avroRecordName 返回 schema 中 record 的全名，name 中已包含 namespace 时直接使用
+func avroRecordName(schema string) (string, error) {
+	var s struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	}
+	if err := json.Unmarshal([]byte(schema), &s); err != nil {
+		return "", err
+	}
+	if s.Name == "" {
+		return "", fmt.Errorf("avro schema has no record name")
+	}
+	if s.Namespace == "" || strings.Contains(s.Name, ".") {
+		return s.Name, nil
+	}
+	return s.Namespace + "." + s.Name, nil
+}
+
+type SchemaRegistryClient struct {
+	url    string
+	client *http.Client
+
+	mu     sync.RWMutex
+	codecs map[int]*goavro.Codec
+}
+
+func NewSchemaRegistryClient(url string) *SchemaRegistryClient {
+	return &SchemaRegistryClient{
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{Timeout: defaultTimeout},
+		codecs: make(map[int]*goavro.Codec),
+	}
+}
+
+func (m *SchemaRegistryClient) do(ctx context.Context, method, path string, req, resp interface{}) error {
+	var body []byte
+	if req != nil {
+		var err error
+		if body, err = json.Marshal(req); err != nil {
+			return err
+		}
+	}
+
+	hreq, err := http.NewRequest(method, m.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	hreq = hreq.WithContext(ctx)
+	hreq.Header.Set("Content-Type", schemaRegistryContentType)
+	hreq.Header.Set("Accept", schemaRegistryContentType)
+
+	hresp, err := m.client.Do(hreq)
+	if err != nil {
+		return err
+	}
+	defer hresp.Body.Close()
+
+	data, err := ioutil.ReadAll(hresp.Body)
+	if err != nil {
+		return err
+	}
+	if hresp.StatusCode != http.StatusOK {
+		return fmt.Errorf("schema registry %s %s status: %d, body: %s", method, path, hresp.StatusCode, data)
+	}
+	return json.Unmarshal(data, resp)
+}
+
+// Register 注册 schema 并返回 schema id，已注册过的 schema 返回原来的 id，与 subject 已有版本不兼容时返回错误
+func (m *SchemaRegistryClient) Register(ctx context.Context, subject, schema string) (int, error) {
+	var resp struct {
+		ID int `json:"id"`
+	}
+	err := m.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions",
+		map[string]string{"schema": schema}, &resp)
+	if err != nil {
+		return 0, err
+	}
+	return resp.ID, nil
+}
+
+// GetSchema 根据 schema id 获取 schema
+func (m *SchemaRegistryClient) GetSchema(ctx context.Context, id int) (string, error) {
+	var resp struct {
+		Schema string `json:"schema"`
+	}
+	err := m.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.Schema, nil
+}
+
+// codec schema 不会变化，按 id 缓存
+func (m *SchemaRegistryClient) codec(ctx context.Context, id int) (*goavro.Codec, error) {
+	m.mu.RLock()
+	codec, ok := m.codecs[id]
+	m.mu.RUnlock()
+	if ok {
+		return codec, nil
+	}
+
+	schema, err := m.GetSchema(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	codec, err = goavro.NewCodec(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.codecs[id] = codec
+	m.mu.Unlock()
+	return codec, nil
+}
+
+func (m *SchemaRegistryClient) addCodec(id int, codec *goavro.Codec) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codecs[id] = codec
+}
+
+var DefaultSchemaRegistry *SchemaRegistryClient
+
+// SetSchemaRegistry 设置读写 avro 消息使用的 schema registry
+func SetSchemaRegistry(url string) {
+	DefaultSchemaRegistry = NewSchemaRegistryClient(url)
+}
+
+type avroTopicSchema struct {
+	id    int
+	codec *goavro.Codec
+}
+
+// topic -> *avroTopicSchema
+var avroSchemas sync.Map
+
+// RegisterAvroSchema 校验 schema 并注册到 DefaultSchemaRegistry，之后写入 topic 的消息按 schema 编码，
+// 不符合 schema 的消息写入失败
+func RegisterAvroSchema(ctx context.Context, topic, schema string, strategy SubjectNameStrategy) error {
+	fun := "mq.RegisterAvroSchema -->"
+
+	registry := DefaultSchemaRegistry
+	if registry == nil {
+		return fmt.Errorf("%s schema registry not set, topic: %s", fun, topic)
+	}
+
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return fmt.Errorf("%s invalid schema: %v, topic: %s", fun, err, topic)
+	}
+	recordName, err := avroRecordName(schema)
+	if err != nil {
+		return fmt.Errorf("%s invalid schema: %v, topic: %s", fun, err, topic)
+	}
+
+	subject := strategy.subject(topic, recordName)
+	id, err := registry.Register(ctx, subject, schema)
+	if err != nil {
+		return fmt.Errorf("%s register err: %v, subject: %s", fun, err, subject)
+	}
+
+	registry.addCodec(id, codec)
+	avroSchemas.Store(topic, &avroTopicSchema{
+		id:    id,
+		codec: codec,
+	})
+	return nil
+}
+
+// UnregisterAvroSchema 之后写入 topic 的消息恢复为 json 编码，已注册的 schema 不会从 registry 删除
+func UnregisterAvroSchema(topic string) {
+	avroSchemas.Delete(topic)
+}
+
+func encodeAvroValue(s *avroTopicSchema, value string) (string, error) {
+	native, _, err := s.codec.NativeFromTextual([]byte(value))
+	if err != nil {
+		return "", err
+	}
+
+	header := make([]byte, avroHeaderSize)
+	header[0] = avroMagicByte
+	binary.BigEndian.PutUint32(header[1:], uint32(s.id))
+	body, err := s.codec.BinaryFromNative(header, native)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(body), nil
+}
+
+func decodeAvroValue(ctx context.Context, value string) ([]byte, error) {
+	registry := DefaultSchemaRegistry
+	if registry == nil {
+		return nil, fmt.Errorf("schema registry not set")
+	}
+
+	body, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < avroHeaderSize || body[0] != avroMagicByte {
+		return nil, fmt.Errorf("invalid avro value")
+	}
+
+	codec, err := registry.codec(ctx, int(binary.BigEndian.Uint32(body[1:avroHeaderSize])))
+	if err != nil {
+		return nil, err
+	}
+	native, _, err := codec.NativeFromBinary(body[avroHeaderSize:])
+	if err != nil {
+		return nil, err
+	}
+	return codec.TextualFromNative(nil, native)
+}
+
+// encodeAvroPayloadValue topic 注册了 avro schema 时将 json 编码的 Payload.Value 编码为 avro
+func encodeAvroPayloadValue(topic string, payload *Payload) error {
+	v, ok := avroSchemas.Load(topic)
+	if !ok {
+		return nil
+	}
+
+	value, err := encodeAvroValue(v.(*avroTopicSchema), payload.Value)
+	if err != nil {
+		return err
+	}
+	payload.Value = value
+	payload.Codec = payloadCodecAvro
+	return nil
+}
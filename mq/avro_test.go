@@ -0,0 +1,89 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+const testAvroSchema = `{"type":"record","name":"TestMsg","namespace":"palfish.test","fields":[{"name":"id","type":"int"},{"name":"name","type":"string"}]}`
+
+func newTestSchemaRegistry(subjects map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/subjects/"):
+			var req struct {
+				Schema string `json:"schema"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			subject := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/subjects/"), "/versions")
+			subjects[subject] = req.Schema
+			w.Write([]byte(`{"id":7}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/schemas/ids/7":
+			json.NewEncoder(w).Encode(map[string]string{"schema": testAvroSchema})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error_code":40403,"message":"Schema not found"}`))
+		}
+	}))
+}
+
+func TestAvroSubject(t *testing.T) {
+	name, err := avroRecordName(testAvroSchema)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, name, "palfish.test.TestMsg")
+
+	name, err = avroRecordName(`{"type":"record","name":"a.b.C","namespace":"x"}`)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, name, "a.b.C")
+
+	_, err = avroRecordName(`{"type":"string"}`)
+	assert.True(t, err != nil)
+
+	assert.Equal(t, TopicNameStrategy.subject("t", "r"), "t-value")
+	assert.Equal(t, RecordNameStrategy.subject("t", "r"), "r")
+	assert.Equal(t, TopicRecordNameStrategy.subject("t", "r"), "t-r")
+}
+
+func TestAvroPayload(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	subjects := map[string]string{}
+	server := newTestSchemaRegistry(subjects)
+	defer server.Close()
+
+	old := DefaultSchemaRegistry
+	defer func() { DefaultSchemaRegistry = old }()
+	SetSchemaRegistry(server.URL + "/")
+
+	topic := "palfish.test.avro"
+	err := RegisterAvroSchema(context.TODO(), topic, testAvroSchema, TopicRecordNameStrategy)
+	assert.Equal(t, err, nil)
+	defer UnregisterAvroSchema(topic)
+	assert.Equal(t, subjects[topic+"-palfish.test.TestMsg"], testAvroSchema)
+
+	err = WriteMsg(context.TODO(), topic, "k1", &memoryTestMsg{ID: 1, Name: "a"})
+	assert.Equal(t, err, nil)
+
+	var payload Payload
+	err = NewMemoryReader(topic, "raw").ReadMsg(context.TODO(), &payload, &payload)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, payload.Codec, payloadCodecAvro)
+
+	// 新的 registry 没有缓存，从 registry 获取 schema 解码
+	SetSchemaRegistry(server.URL)
+	var msg memoryTestMsg
+	_, err = ReadMsgByGroup(context.TODO(), topic, "g1", &msg)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, msg.ID, 1)
+	assert.Equal(t, msg.Name, "a")
+
+	DefaultSchemaRegistry = nil
+	err = RegisterAvroSchema(context.TODO(), topic, testAvroSchema, TopicNameStrategy)
+	assert.True(t, err != nil)
+}
@@ -0,0 +1,117 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/shawnfeng/sutil/slog/slog"
+	"github.com/shawnfeng/sutil/stime"
+)
+
+// 批量写入的攒批参数通过配置项 batchsize 与 linger 指定，batchsize 为一批最多的消息数，
+// linger 为一批最长的等待时间，如 10ms，未配置时使用各后端的默认值
+const (
+	unknownPartition = -1
+	unknownOffset    = -1
+)
+
+// MsgResult 单条消息的写入结果，后端无法获取 partition 或 offset 时为 -1
+type MsgResult struct {
+	Key       string
+	Partition int
+	Offset    int64
+	Err       error
+}
+
+// BatchWriter 由能够返回每条消息写入结果的后端实现，results 与 msgs 一一对应
+type BatchWriter interface {
+	WriteMsgsResult(ctx context.Context, msgs ...Message) []MsgResult
+}
+
+// newMsgResults 所有消息使用同一个写入结果，用于不支持逐条返回结果的后端
+func newMsgResults(msgs []Message, err error) []MsgResult {
+	results := make([]MsgResult, len(msgs))
+	for i, msg := range msgs {
+		results[i] = MsgResult{
+			Key:       msg.Key,
+			Partition: unknownPartition,
+			Offset:    unknownOffset,
+			Err:       err,
+		}
+	}
+	return results
+}
+
+// writeMsgsResult 后端不支持逐条返回结果时整批写入
+func writeMsgsResult(ctx context.Context, writer Writer, msgs []Message) []MsgResult {
+	if bw, ok := writer.(BatchWriter); ok {
+		return bw.WriteMsgsResult(ctx, msgs...)
+	}
+	return newMsgResults(msgs, writer.WriteMsgs(ctx, msgs...))
+}
+
+// WriteMsgsResult 批量写入并返回每条消息的写入结果，部分消息失败时 error 为第一个失败的原因，
+// 调用方可以根据 results 只重试失败的消息；interceptor 没有调用 next 时 results 为 nil
+func WriteMsgsResult(ctx context.Context, topic string, msgs ...Message) ([]MsgResult, error) {
+	var results []MsgResult
+	err := publish(ctx, topic, msgs, func(ctx context.Context, topic string, msgs ...Message) error {
+		var err error
+		results, err = writeTopicMsgsResult(ctx, topic, msgs...)
+		return err
+	})
+	return results, err
+}
+
+func writeTopicMsgsResult(ctx context.Context, topic string, msgs ...Message) ([]MsgResult, error) {
+	fun := "mq.WriteMsgsResult -->"
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "mq.WriteMsgsResult")
+	defer span.Finish()
+	span.LogFields(
+		log.String(spanLogKeyTopic, topic))
+
+	writer := getTopicWriter(ctx, topic)
+	if writer == nil {
+		statProduceErr(topic, produceErrNoWriter, len(msgs))
+		slog.Errorf(ctx, "%s getWriter err, topic: %s", fun, topic)
+		return nil, fmt.Errorf("%s, getWriter err, topic: %s", fun, topic)
+	}
+	return writeWriterMsgsResult(ctx, writer, topic, msgs...)
+}
+
+// writeWriterMsgsResult 编码后写入 writer 并返回每条消息的结果，NewTxnWriter 返回的 writer 也使用
+func writeWriterMsgsResult(ctx context.Context, writer Writer, topic string, msgs ...Message) ([]MsgResult, error) {
+	fun := "mq.WriteMsgsResult -->"
+
+	nmsgs, err := generateMsgsPayload(ctx, topic, msgs...)
+	if err != nil {
+		statProduceErr(topic, produceErrEncode, len(msgs))
+		slog.Errorf(ctx, "%s generateMsgsPayload err, topic: %s", fun, topic)
+		return nil, fmt.Errorf("%s, generateMsgsPayload err, topic: %s", fun, topic)
+	}
+
+	st := stime.NewTimeStat()
+	results := writeMsgsResult(ctx, writer, nmsgs)
+	statProduceResults(topic, results, st.Duration())
+	var failed int
+	var firstErr error
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = r.Err
+			}
+		}
+	}
+	if failed > 0 {
+		slog.Errorf(ctx, "%s %d/%d msgs failed, err: %v, topic: %s", fun, failed, len(results), firstErr, topic)
+		return results, fmt.Errorf("%s, %d/%d msgs failed, err: %v, topic: %s", fun, failed, len(results), firstErr, topic)
+	}
+	return results, nil
+}
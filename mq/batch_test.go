@@ -0,0 +1,64 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+type failingWriter struct {
+	err error
+}
+
+func (m *failingWriter) WriteMsg(ctx context.Context, k string, v interface{}) error {
+	return m.err
+}
+
+func (m *failingWriter) WriteMsgs(ctx context.Context, msgs ...Message) error {
+	return m.err
+}
+
+func (m *failingWriter) Close() error {
+	return nil
+}
+
+func TestWriteMsgsResult(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.batch"
+	err := WriteMsg(context.TODO(), topic, "k0", &memoryTestMsg{ID: 0})
+	assert.Equal(t, err, nil)
+
+	results, err := WriteMsgsResult(context.TODO(), topic,
+		Message{Key: "k1", Value: &memoryTestMsg{ID: 1}},
+		Message{Key: "k2", Value: &memoryTestMsg{ID: 2}})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(results), 2)
+	assert.Equal(t, results[0].Key, "k1")
+	assert.Equal(t, results[0].Offset, int64(1))
+	assert.Equal(t, results[1].Offset, int64(2))
+	assert.Equal(t, results[1].Partition, 0)
+	assert.Equal(t, MemoryTopicLen(topic), 3)
+
+	var msg memoryTestMsg
+	_, err = ReadMsgByGroup(context.TODO(), topic, "g1", &msg)
+	assert.Equal(t, err, nil)
+	_, err = ReadMsgByGroup(context.TODO(), topic, "g1", &msg)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, msg.ID, 1)
+}
+
+func TestWriteMsgsResultFallback(t *testing.T) {
+	errWrite := errors.New("write failed")
+	msgs := []Message{{Key: "k1"}, {Key: "k2"}}
+	results := writeMsgsResult(context.TODO(), &failingWriter{err: errWrite}, msgs)
+	assert.Equal(t, len(results), 2)
+	for i, r := range results {
+		assert.Equal(t, r.Key, msgs[i].Key)
+		assert.Equal(t, r.Err, errWrite)
+		assert.Equal(t, r.Partition, unknownPartition)
+		assert.Equal(t, r.Offset, int64(unknownOffset))
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+const (
+	defaultBatchConsumeSize     = 100
+	defaultBatchConsumeInterval = time.Second
+
+	spanLogKeyBatchCount = "count"
+)
+
+// BatchConsumeFunc 返回 nil 时整批消息处理成功，返回错误时整批重试
+type BatchConsumeFunc func(ctx context.Context, msgs []*ConsumeMsg) error
+
+type BatchConsumeOptions struct {
+	// MaxAttempts、退避、Retryable、Filters、DLQTopic、Poison 与限速的含义与 ConsumeByGroup 相同，按整批处理；
+	// 不使用 Concurrency、KeyOrdered、ManualCommit、Interceptors、Checkpoint 与 partition 的回调
+	ConsumeOptions
+	// 一批最多的消息数，<= 0 时使用 defaultBatchConsumeSize
+	BatchSize int
+	// 读取到一批的第一条消息后最长的等待时间，<= 0 时使用 defaultBatchConsumeInterval
+	BatchInterval time.Duration
+}
+
+func (m *BatchConsumeOptions) batchSize() int {
+	if m.BatchSize <= 0 {
+		return defaultBatchConsumeSize
+	}
+	return m.BatchSize
+}
+
+func (m *BatchConsumeOptions) batchInterval() time.Duration {
+	if m.BatchInterval <= 0 {
+		return defaultBatchConsumeInterval
+	}
+	return m.BatchInterval
+}
+
+// ConsumeBatchByGroup 读取到 BatchSize 条消息或第一条消息读取后超过 BatchInterval 时交给 fn 一起处理，如批量写入 clickhouse，
+// 处理成功后按读取顺序提交整批消息；重试 MaxAttempts 次后仍然失败时整批的每条消息分别写入死信 topic，直到 ctx 结束，
+// ctx 结束时未处理的消息不会提交，之后会重新投递
+func ConsumeBatchByGroup(ctx context.Context, topic, groupId string, fn BatchConsumeFunc, opts *BatchConsumeOptions) error {
+	fun := "mq.ConsumeBatchByGroup -->"
+
+	if opts == nil {
+		opts = &BatchConsumeOptions{}
+	}
+	copts := withConfigOptions(ctx, topic, &opts.ConsumeOptions)
+	dlqTopic := copts.DLQTopic
+	if dlqTopic == "" {
+		dlqTopic = GetDLQTopic(ctx, topic)
+	}
+
+	conf := newGroupReaderConf(ctx, topic, groupId)
+	limiter := newConsumeLimiter(ctx, topic, copts)
+	defer limiter.close()
+	slog.Infof(ctx, "%s start topic: %s, groupId: %s, dlq: %s, batch: %d, interval: %s", fun, topic, groupId, dlqTopic, opts.batchSize(), opts.batchInterval())
+
+	for ctx.Err() == nil {
+		msgs := fetchBatch(ctx, conf, limiter, opts.batchSize(), opts.batchInterval())
+		if len(msgs) == 0 {
+			continue
+		}
+		if !consumeBatch(ctx, dlqTopic, copts, msgs, fn) {
+			break
+		}
+	}
+	slog.Infof(ctx, "%s stop topic: %s, groupId: %s", fun, topic, groupId)
+	return ctx.Err()
+}
+
+// fetchBatch 读取一批消息，ctx 结束时返回已读取的消息，由调用方丢弃
+func fetchBatch(ctx context.Context, conf *instanceConf, limiter *consumeLimiter, size int, interval time.Duration) []*ConsumeMsg {
+	var msgs []*ConsumeMsg
+	var deadline time.Time
+	for len(msgs) < size {
+		fetchCtx, cancel := ctx, context.CancelFunc(func() {})
+		if len(msgs) > 0 {
+			fetchCtx, cancel = context.WithDeadline(ctx, deadline)
+		}
+		msg, handler := fetchConsumeMsg(fetchCtx, conf)
+		timeout := fetchCtx.Err() != nil
+		cancel()
+
+		if msg == nil {
+			if timeout {
+				break
+			}
+			continue
+		}
+		msg.commit = handler.CommitMsg
+		if !limiter.wait(ctx, msg) {
+			break
+		}
+		if len(msgs) == 0 {
+			deadline = time.Now().Add(interval)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// consumeBatch 处理成功或写入死信 topic 后提交并返回 true，ctx 结束时返回 false
+func consumeBatch(ctx context.Context, dlqTopic string, opts *ConsumeOptions, msgs []*ConsumeMsg, fn BatchConsumeFunc) bool {
+	fun := "mq.consumeBatch -->"
+	if ctx.Err() != nil {
+		return false
+	}
+
+	span, bctx := opentracing.StartSpanFromContext(ctx, "mq.ConsumeBatchByGroup")
+	defer span.Finish()
+	span.LogFields(
+		log.String(spanLogKeyTopic, msgs[0].Topic),
+		log.String(spanLogKeyKafkaGroupID, msgs[0].GroupID),
+		log.Int(spanLogKeyBatchCount, len(msgs)))
+
+	now := time.Now()
+	batch := make([]*ConsumeMsg, 0, len(msgs))
+	for _, msg := range msgs {
+		statConsumeLatency(msg, now)
+		if !opts.filter(bctx, msg) {
+			statConsumeFiltered(msg.Topic, msg.GroupID)
+			continue
+		}
+		batch = append(batch, msg)
+	}
+
+	for i := 1; len(batch) > 0; i++ {
+		for _, msg := range batch {
+			msg.Attempts = msg.payload.Retries + 1
+		}
+		err := recoverConsume(bctx, msgs[0].Topic, func() error {
+			return fn(bctx, batch)
+		})
+		if err == nil {
+			break
+		}
+		for _, msg := range batch {
+			msg.payload.Retries++
+		}
+		slog.Warnf(bctx, "%s handle err: %v, topic: %s, count: %d, attempts: %d", fun, err, msgs[0].Topic, len(batch), i)
+
+		if i >= opts.maxAttempts() || !opts.retryable(err) {
+			if !poisonBatch(ctx, dlqTopic, opts, batch, err) {
+				return false
+			}
+			break
+		}
+		if !sleepContext(ctx, opts.backoff(i)) {
+			return false
+		}
+	}
+
+	for _, msg := range msgs {
+		if err := msg.Commit(ctx); err != nil {
+			slog.Errorf(bctx, "%s CommitMsg err: %v, topic: %s", fun, err, msg.Topic)
+		}
+	}
+	return true
+}
+
+// poisonBatch 整批失败的消息分别按 PoisonPolicy 处理，每条消息使用自己写入时的 trace
+func poisonBatch(ctx context.Context, dlqTopic string, opts *ConsumeOptions, batch []*ConsumeMsg, cause error) bool {
+	for _, msg := range batch {
+		mctx, _ := parsePayload(msg.payload, "mq.ConsumeBatchByGroup", &json.RawMessage{})
+		mspan := opentracing.SpanFromContext(mctx)
+		ok := handlePoison(ctx, mctx, mspan, dlqTopic, opts, msg, cause)
+		mspan.Finish()
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestConsumeBatchByGroup(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.batchconsume"
+	var msgs []Message
+	for i := 0; i < 5; i++ {
+		msgs = append(msgs, Message{Key: "k", Value: &memoryTestMsg{ID: i}})
+	}
+	assert.Equal(t, WriteMsgs(context.TODO(), topic, msgs...), nil)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	var sizes []int
+	var ids []int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ConsumeBatchByGroup(ctx, topic, "g1", func(ctx context.Context, msgs []*ConsumeMsg) error {
+			sizes = append(sizes, len(msgs))
+			for _, msg := range msgs {
+				var v memoryTestMsg
+				if err := msg.Unmarshal(&v); err != nil {
+					return err
+				}
+				ids = append(ids, v.ID)
+			}
+			if len(ids) == 5 {
+				cancel()
+			}
+			return nil
+		}, &BatchConsumeOptions{BatchSize: 2, BatchInterval: 50 * time.Millisecond})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("consume timeout")
+	}
+	// 最后一批按 BatchInterval 处理
+	assert.Equal(t, sizes, []int{2, 2, 1})
+	assert.Equal(t, ids, []int{0, 1, 2, 3, 4})
+}
+
+func TestConsumeBatchByGroupDLQ(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.batchconsumedlq"
+	assert.Equal(t, WriteMsgs(context.TODO(), topic,
+		Message{Key: "k1", Value: &memoryTestMsg{ID: 1}},
+		Message{Key: "k2", Value: &memoryTestMsg{ID: 2}}), nil)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	var attempts int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ConsumeBatchByGroup(ctx, topic, "g1", func(ctx context.Context, msgs []*ConsumeMsg) error {
+			attempts++
+			assert.Equal(t, msgs[0].Attempts, attempts)
+			return errors.New("clickhouse err")
+		}, &BatchConsumeOptions{
+			ConsumeOptions: ConsumeOptions{MaxAttempts: 2, BaseDelay: time.Millisecond},
+			BatchSize:      2,
+		})
+	}()
+
+	rctx, rcancel := context.WithTimeout(context.TODO(), 2*time.Second)
+	defer rcancel()
+	for i := 1; i <= 2; i++ {
+		_, msg, _, err := FetchDLQMsg(rctx, topic, "inspect")
+		assert.Equal(t, err, nil)
+		assert.Equal(t, msg.Attempts, 2)
+		assert.Equal(t, msg.Error, "clickhouse err")
+		var v memoryTestMsg
+		assert.Equal(t, msg.Unmarshal(&v), nil)
+		assert.Equal(t, v.ID, i)
+	}
+	cancel()
+	<-done
+	assert.Equal(t, attempts, 2)
+}
@@ -0,0 +1,251 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	redis2 "github.com/redis/go-redis/v9"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 设置 ConsumeOptions.Checkpoint 后按 exactly-once 写入支持事务的存储：ConsumeFunc 在同一个事务中写入结果与 msg.Offset，
+// 如 SQLCheckpoint.Save 或 RedisCheckpoint.Save，读取到 offset 小于存储中记录的消息说明已经处理过，直接提交跳过，
+// 从而 broker 上提交的 offset 丢失或落后时，从存储中记录的位置恢复，不会重复写入
+//
+//	cp := &mq.SQLCheckpoint{DB: db}
+//	mq.ConsumeByGroup(ctx, topic, group, func(ctx context.Context, msg *mq.ConsumeMsg) error {
+//		tx, err := db.BeginTx(ctx, nil)
+//		...
+//		if err := cp.Save(ctx, tx, msg); err != nil {
+//			tx.Rollback()
+//			return err
+//		}
+//		return tx.Commit()
+//	}, &mq.ConsumeOptions{Checkpoint: cp})
+//
+// NOTE: 按 offset 判断需要同一 partition 的消息依次处理，Concurrency 固定为 1；
+// 只支持能够获取 offset 的后端，目前为 kafka 与 memory，其他后端的消息按不可重试的错误处理
+const (
+	defaultCheckpointTable = "mq_checkpoint"
+
+	checkpointWrapper   = "mq"
+	checkpointKeyPrefix = "mq.checkpoint."
+)
+
+// ErrCheckpointStale 存储中记录的 offset 已经不小于当前消息，说明消息已被其他消费者处理，
+// Save 返回该错误时 ConsumeFunc 需要回滚事务并返回，ConsumeByGroup 按已处理提交
+var ErrCheckpointStale = errors.New("mq: checkpoint is ahead of message")
+
+var errCheckpointNoOffset = errors.New("mq: checkpoint needs message offset")
+
+// CheckpointStore 读取结果所在存储中记录的消费位置
+type CheckpointStore interface {
+	// Load 返回 partition 下一条待处理消息的 offset，没有记录时返回 0
+	Load(ctx context.Context, topic, groupId string, partition int) (int64, error)
+}
+
+// CheckpointFunc 使用函数实现 CheckpointStore，用于其他存储
+type CheckpointFunc func(ctx context.Context, topic, groupId string, partition int) (int64, error)
+
+func (f CheckpointFunc) Load(ctx context.Context, topic, groupId string, partition int) (int64, error) {
+	return f(ctx, topic, groupId, partition)
+}
+
+// checkpointer 一个 ConsumeByGroup 已加载的消费位置，rebalance 后重新加载，其他消费者可能已经处理了更多的消息
+type checkpointer struct {
+	store   CheckpointStore
+	topic   string
+	groupId string
+
+	mu sync.Mutex
+	// partition -> 下一条待处理消息的 offset
+	next map[int]int64
+}
+
+// withCheckpoint 在 interceptor 之外判断消息是否处理过，未设置 Checkpoint 时不变
+func withCheckpoint(ctx context.Context, topic, groupId string, fn ConsumeFunc, opts *ConsumeOptions) (ConsumeFunc, *ConsumeOptions) {
+	fun := "mq.withCheckpoint -->"
+
+	if opts.Checkpoint == nil {
+		return fn, opts
+	}
+	m := &checkpointer{
+		store:   opts.Checkpoint,
+		topic:   topic,
+		groupId: groupId,
+		next:    make(map[int]int64),
+	}
+
+	o := *opts
+	if o.Concurrency > 1 {
+		slog.Warnf(ctx, "%s checkpoint needs sequential handling, concurrency: %d -> 1, topic: %s", fun, o.Concurrency, topic)
+		o.Concurrency = 1
+	}
+	revoked := o.OnPartitionsRevoked
+	o.OnPartitionsRevoked = func(ctx context.Context, partitions []int) {
+		m.forget(partitions...)
+		if revoked != nil {
+			revoked(ctx, partitions)
+		}
+	}
+	return m.wrap(fn), &o
+}
+
+func (m *checkpointer) wrap(next ConsumeFunc) ConsumeFunc {
+	return func(ctx context.Context, msg *ConsumeMsg) error {
+		fun := "mq.checkpoint -->"
+
+		if msg.Offset == unknownOffset || msg.Partition == unknownPartition {
+			return Permanent(errCheckpointNoOffset)
+		}
+		offset, err := m.load(ctx, msg.Partition)
+		if err != nil {
+			slog.Errorf(ctx, "%s Load err: %v, topic: %s, partition: %d", fun, err, m.topic, msg.Partition)
+			return err
+		}
+		if msg.Offset < offset {
+			slog.Debugf(ctx, "%s skip handled msg, topic: %s, partition: %d, offset: %d, checkpoint: %d", fun, m.topic, msg.Partition, msg.Offset, offset)
+			return nil
+		}
+
+		err = next(ctx, msg)
+		if errors.Is(err, ErrCheckpointStale) {
+			slog.Infof(ctx, "%s stale checkpoint, topic: %s, partition: %d, offset: %d", fun, m.topic, msg.Partition, msg.Offset)
+			m.forget(msg.Partition)
+			return nil
+		}
+		if err == nil {
+			m.advance(msg.Partition, msg.Offset+1)
+		}
+		return err
+	}
+}
+
+func (m *checkpointer) load(ctx context.Context, partition int) (int64, error) {
+	m.mu.Lock()
+	offset, ok := m.next[partition]
+	m.mu.Unlock()
+	if ok {
+		return offset, nil
+	}
+
+	offset, err := m.store.Load(ctx, m.topic, m.groupId, partition)
+	if err != nil {
+		return 0, err
+	}
+	slog.Infof(ctx, "mq.checkpoint --> loaded topic: %s, groupId: %s, partition: %d, offset: %d", m.topic, m.groupId, partition, offset)
+	m.advance(partition, offset)
+	return offset, nil
+}
+
+func (m *checkpointer) advance(partition int, offset int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cur, ok := m.next[partition]; !ok || offset > cur {
+		m.next[partition] = offset
+	}
+}
+
+func (m *checkpointer) forget(partitions ...int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range partitions {
+		delete(m.next, p)
+	}
+}
+
+// SQLCheckpoint 把消费位置记录在 mysql 表中，表结构：
+//
+//	CREATE TABLE mq_checkpoint (
+//		topic        VARCHAR(255) NOT NULL,
+//		group_id     VARCHAR(255) NOT NULL,
+//		partition_id INT          NOT NULL,
+//		next_offset  BIGINT       NOT NULL,
+//		PRIMARY KEY (topic, group_id, partition_id)
+//	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+type SQLCheckpoint struct {
+	DB *sql.DB
+	// 表名，为空时使用 defaultCheckpointTable
+	Table string
+}
+
+func (m *SQLCheckpoint) table() string {
+	if m.Table == "" {
+		return defaultCheckpointTable
+	}
+	return m.Table
+}
+
+func (m *SQLCheckpoint) Load(ctx context.Context, topic, groupId string, partition int) (int64, error) {
+	query := fmt.Sprintf("SELECT next_offset FROM %s WHERE topic = ? AND group_id = ? AND partition_id = ?", m.table())
+	var offset int64
+	err := m.DB.QueryRowContext(ctx, query, topic, groupId, partition).Scan(&offset)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return offset, err
+}
+
+// Save 在写入结果的事务 tx 中记录 msg 已处理，锁定记录后检查，记录的 offset 不小于 msg 时返回 ErrCheckpointStale
+func (m *SQLCheckpoint) Save(ctx context.Context, tx *sql.Tx, msg *ConsumeMsg) error {
+	query := fmt.Sprintf("SELECT next_offset FROM %s WHERE topic = ? AND group_id = ? AND partition_id = ? FOR UPDATE", m.table())
+	var offset int64
+	err := tx.QueryRowContext(ctx, query, msg.Topic, msg.GroupID, msg.Partition).Scan(&offset)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return err
+	case offset > msg.Offset:
+		return ErrCheckpointStale
+	}
+
+	query = fmt.Sprintf("INSERT INTO %s (topic, group_id, partition_id, next_offset) VALUES (?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE next_offset = VALUES(next_offset)", m.table())
+	_, err = tx.ExecContext(ctx, query, msg.Topic, msg.GroupID, msg.Partition, msg.Offset+1)
+	return err
+}
+
+// RedisCheckpoint 把消费位置记录在 namespace 对应的 redis 中，每个 topic 与 group 为一个 hash，field 为 partition
+type RedisCheckpoint struct {
+	Namespace string
+}
+
+// Client 返回记录消费位置的 client，结果需要写入同一个 client，与 Save 在同一个 TxPipeline 中
+func (m *RedisCheckpoint) Client(ctx context.Context) (*redis.Client, error) {
+	return redis.DefaultInstanceManager.GetInstance(ctx, &redis.InstanceConf{
+		Group:     redis.RouteGroup(ctx),
+		Namespace: m.Namespace,
+		Wrapper:   checkpointWrapper,
+	})
+}
+
+func checkpointKey(topic, groupId string) string {
+	return checkpointKeyPrefix + topic + "." + groupId
+}
+
+func (m *RedisCheckpoint) Load(ctx context.Context, topic, groupId string, partition int) (int64, error) {
+	client, err := m.Client(ctx)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := client.HGet(ctx, checkpointKey(topic, groupId), strconv.Itoa(partition)).Int64()
+	if err == redis2.Nil {
+		return 0, nil
+	}
+	return offset, err
+}
+
+// Save 把 msg 已处理加入 pipe，pipe 需要由 Client 的 TxPipeline 创建并包含结果的写入，Exec 时一起原子执行；
+// NOTE: MULTI 中无法检查记录的 offset，rebalance 前后两个消费者同时处理同一条消息时可能重复写入
+func (m *RedisCheckpoint) Save(ctx context.Context, pipe *redis.Pipeline, msg *ConsumeMsg) {
+	pipe.HSet(ctx, checkpointKey(msg.Topic, msg.GroupID), strconv.Itoa(msg.Partition), msg.Offset+1)
+}
@@ -0,0 +1,72 @@
+package mq
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestConsumeByGroupCheckpoint(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.checkpoint"
+	var msgs []Message
+	for i := 0; i < 4; i++ {
+		msgs = append(msgs, Message{Key: "k", Value: &memoryTestMsg{ID: i}})
+	}
+	assert.Equal(t, WriteMsgs(context.TODO(), topic, msgs...), nil)
+
+	// 存储中记录已处理到 offset 1
+	var mu sync.Mutex
+	stored := map[int]int64{0: 2}
+	var loads int
+	store := CheckpointFunc(func(ctx context.Context, topic, groupId string, partition int) (int64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		loads++
+		return stored[partition], nil
+	})
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	var handled []int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ConsumeByGroup(ctx, topic, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+			if msg.Offset == 2 {
+				// 其他消费者已处理
+				return ErrCheckpointStale
+			}
+			mu.Lock()
+			handled = append(handled, msg.Offset)
+			stored[msg.Partition] = msg.Offset + 1
+			mu.Unlock()
+			cancel()
+			return nil
+		}, &ConsumeOptions{Checkpoint: store, Concurrency: 4})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("consume timeout")
+	}
+	assert.Equal(t, handled, []int64{3})
+	// ErrCheckpointStale 后重新加载
+	assert.Equal(t, loads, 2)
+}
+
+func TestCheckpointNoOffset(t *testing.T) {
+	fn, opts := withCheckpoint(context.TODO(), defaultTestTopic, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+		return nil
+	}, &ConsumeOptions{Checkpoint: CheckpointFunc(func(ctx context.Context, topic, groupId string, partition int) (int64, error) {
+		return 0, nil
+	})})
+	assert.NotEqual(t, opts.OnPartitionsRevoked, nil)
+	err := fn(context.TODO(), &ConsumeMsg{Partition: unknownPartition, Offset: unknownOffset})
+	assert.Equal(t, isPermanent(err), true)
+}
@@ -0,0 +1,183 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 调用 SetClaimCheck 的 topic，写入时编码后的 Payload.Value 超过 Threshold 的消息内容保存到 ClaimStore，
+// 消息中只保留引用，读取时根据引用取回原来的内容，对 ConsumeFunc 与 ReadMsgByGroup 等都透明，用于超过 broker 消息大小限制的消息
+//
+//	mq.SetClaimCheck(topic, &mq.ClaimCheckOptions{Store: mq.NewRedisClaimStore("base/mqclaim", 0)})
+//
+// NOTE: 消费者也需要设置相同的 Store；分级延迟 topic 与死信 topic 使用原 topic 的设置；
+// 多个 group 消费同一条消息，读取后不删除，由 Store 按过期时间清理，过期时间需要大于消息的保留时间
+const (
+	payloadCodecClaim = "claim"
+
+	// kafka 默认的 message.max.bytes 为 1MB，预留 trace 与 head 的空间
+	defaultClaimThreshold = 900 * 1024
+	defaultClaimTTL       = 7 * 24 * time.Hour
+
+	claimWrapper   = "mq"
+	claimKeyPrefix = "mq.claim."
+)
+
+// ClaimStore 保存超过大小限制的消息内容，可以按需实现为对象存储等
+type ClaimStore interface {
+	Put(ctx context.Context, key string, value []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+type ClaimCheckOptions struct {
+	Store ClaimStore
+	// 超过该字节数的 Payload.Value 保存到 Store，<= 0 时使用 defaultClaimThreshold
+	Threshold int
+}
+
+func (m *ClaimCheckOptions) threshold() int {
+	if m.Threshold <= 0 {
+		return defaultClaimThreshold
+	}
+	return m.Threshold
+}
+
+// topic -> *ClaimCheckOptions
+var claimChecks sync.Map
+
+// SetClaimCheck opts 为 nil 时取消设置，之后写入的消息不再保存到 Store
+func SetClaimCheck(topic string, opts *ClaimCheckOptions) {
+	if opts == nil || opts.Store == nil {
+		claimChecks.Delete(topic)
+		return
+	}
+	claimChecks.Store(topic, opts)
+}
+
+func claimConfigTopic(topic string) string {
+	return dlqBaseTopic(delayBaseTopic(topic))
+}
+
+func topicClaimCheck(topic string) (*ClaimCheckOptions, bool) {
+	v, ok := claimChecks.Load(claimConfigTopic(topic))
+	if !ok {
+		return nil, false
+	}
+	return v.(*ClaimCheckOptions), true
+}
+
+// claimRef 保存到 Store 后 Payload.Value 中的引用
+type claimRef struct {
+	Topic string `json:"t"`
+	Key   string `json:"k"`
+	// 原来的 Payload.Codec
+	Codec string `json:"e,omitempty"`
+	Size  int    `json:"n"`
+}
+
+func claimKey(topic, value string) string {
+	// 按内容生成，写入重试时不会重复保存
+	h := sha1.Sum([]byte(value))
+	return claimKeyPrefix + topic + "." + hex.EncodeToString(h[:])
+}
+
+// claimPayloadValue topic 设置了 claim check 并且 Payload.Value 超过大小限制时保存到 Store
+func claimPayloadValue(ctx context.Context, topic string, payload *Payload) error {
+	fun := "mq.claimPayloadValue -->"
+
+	opts, ok := topicClaimCheck(topic)
+	if !ok || len(payload.Value) <= opts.threshold() || payload.Codec == payloadCodecClaim {
+		return nil
+	}
+
+	configTopic := claimConfigTopic(topic)
+	ref := &claimRef{
+		Topic: configTopic,
+		Key:   claimKey(configTopic, payload.Value),
+		Codec: payload.Codec,
+		Size:  len(payload.Value),
+	}
+	if err := opts.Store.Put(ctx, ref.Key, []byte(payload.Value)); err != nil {
+		slog.Errorf(ctx, "%s Put err: %v, topic: %s, size: %d", fun, err, topic, ref.Size)
+		return err
+	}
+	body, err := json.Marshal(ref)
+	if err != nil {
+		return err
+	}
+	payload.Value = string(body)
+	payload.Codec = payloadCodecClaim
+	return nil
+}
+
+// resolveClaim 取回 claim check 保存的内容，payload 不是引用时不变
+func resolveClaim(ctx context.Context, payload *Payload) error {
+	if payload.Codec != payloadCodecClaim {
+		return nil
+	}
+
+	var ref claimRef
+	if err := json.Unmarshal([]byte(payload.Value), &ref); err != nil {
+		return err
+	}
+	opts, ok := topicClaimCheck(ref.Topic)
+	if !ok {
+		return fmt.Errorf("no claim store for topic: %s", ref.Topic)
+	}
+	body, err := opts.Store.Get(ctx, ref.Key)
+	if err != nil {
+		return fmt.Errorf("get claim err: %v, topic: %s, key: %s", err, ref.Topic, ref.Key)
+	}
+	payload.Value = string(body)
+	payload.Codec = ref.Codec
+	return nil
+}
+
+type redisClaimStore struct {
+	namespace string
+	ttl       time.Duration
+}
+
+// NewRedisClaimStore 保存到 namespace 对应的 redis，ttl <= 0 时使用 defaultClaimTTL
+func NewRedisClaimStore(namespace string, ttl time.Duration) ClaimStore {
+	if ttl <= 0 {
+		ttl = defaultClaimTTL
+	}
+	return &redisClaimStore{namespace: namespace, ttl: ttl}
+}
+
+func (m *redisClaimStore) client(ctx context.Context) (*redis.Client, error) {
+	return redis.DefaultInstanceManager.GetInstance(ctx, &redis.InstanceConf{
+		Group:     redis.RouteGroup(ctx),
+		Namespace: m.namespace,
+		Wrapper:   claimWrapper,
+	})
+}
+
+func (m *redisClaimStore) Put(ctx context.Context, key string, value []byte) error {
+	client, err := m.client(ctx)
+	if err != nil {
+		return err
+	}
+	return client.Set(ctx, key, value, m.ttl).Err()
+}
+
+func (m *redisClaimStore) Get(ctx context.Context, key string) ([]byte, error) {
+	client, err := m.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.Get(ctx, key).Bytes()
+}
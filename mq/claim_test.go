@@ -0,0 +1,90 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+type memoryClaimStore struct {
+	mu sync.Mutex
+	m  map[string][]byte
+}
+
+func (m *memoryClaimStore) Put(ctx context.Context, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.m[key] = value
+	return nil
+}
+
+func (m *memoryClaimStore) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.m[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return v, nil
+}
+
+func TestClaimCheck(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.claim"
+	store := &memoryClaimStore{m: make(map[string][]byte)}
+	SetClaimCheck(topic, &ClaimCheckOptions{Store: store, Threshold: 64})
+	defer SetClaimCheck(topic, nil)
+
+	big := strings.Repeat("x", 100)
+	err := WriteMsgs(context.TODO(), topic,
+		Message{Key: "k1", Value: &memoryTestMsg{ID: 1, Name: big}},
+		Message{Key: "k2", Value: &memoryTestMsg{ID: 2, Name: "small"}})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(store.m), 1)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 2*time.Second)
+	defer cancel()
+	var v memoryTestMsg
+	_, _, err = FetchMsgByGroup(ctx, topic, "g1", &v)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, v.Name, big)
+
+	msg, _ := fetchConsumeMsg(ctx, newGroupReaderConf(ctx, topic, "g2"))
+	assert.Equal(t, msg.payload.Codec, "")
+	assert.Equal(t, msg.size() > 100, true)
+	assert.Equal(t, msg.Unmarshal(&v), nil)
+	assert.Equal(t, v.Name, big)
+
+	// 死信 topic 使用原 topic 的设置
+	cctx, ccancel := context.WithCancel(context.TODO())
+	defer ccancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ConsumeByGroup(cctx, topic, "g3", func(ctx context.Context, msg *ConsumeMsg) error {
+			if msg.Key == "k2" {
+				ccancel()
+				return nil
+			}
+			return errors.New("bad msg")
+		}, &ConsumeOptions{MaxAttempts: 1})
+	}()
+	<-done
+	_, dlqMsg, _, err := FetchDLQMsg(ctx, topic, "inspect")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, dlqMsg.Unmarshal(&v), nil)
+	assert.Equal(t, v.Name, big)
+	assert.Equal(t, len(store.m), 2)
+}
+
+func TestResolveClaimNoStore(t *testing.T) {
+	payload := &Payload{Codec: payloadCodecClaim, Value: `{"t":"palfish.test.noclaim","k":"k","n":1}`}
+	assert.NotEqual(t, resolveClaim(context.TODO(), payload), nil)
+	assert.Equal(t, payload.Codec, payloadCodecClaim)
+}
@@ -0,0 +1,266 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	mqproto "github.com/shawnfeng/sutil/mq/pb"
+)
+
+// 调用 SetPayloadFormat(topic, PayloadFormatProtobuf) 的 topic，写入的消息为 1 字节的格式标记加 protobuf 编码的 Payload，
+// 值实现了 proto.Message 时 Value 也使用 protobuf 编码，否则仍为 json；
+// 读取时根据格式标记自动识别，json 编码的消息以 { 开头，不会与格式标记冲突
+const (
+	protobufFormatMarker = 0x01
+
+	payloadCodecProtobuf = "protobuf"
+)
+
+// Payload 的版本，v1 只有 trace、Value、Head、Control 与重试次数等，
+// v2 增加了 Version、ContentType 与 Timestamp；读取时两个版本都能解析，v1 的消息缺少的字段为零值，
+// 之后修改格式时增加版本，消费者按版本兼容处理还未消费完的旧消息
+const (
+	payloadVersion2 = 2
+
+	payloadVersion = payloadVersion2
+
+	contentTypeJSON     = "application/json"
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeAvro     = "avro/binary"
+)
+
+// contentType v1 的消息按 Codec 推断
+func (m *Payload) contentType() string {
+	if m.ContentType != "" {
+		return m.ContentType
+	}
+	return codecContentType(m.Codec)
+}
+
+func codecContentType(codec string) string {
+	switch codec {
+	case payloadCodecProtobuf:
+		return contentTypeProtobuf
+	case payloadCodecAvro:
+		return contentTypeAvro
+	default:
+		return contentTypeJSON
+	}
+}
+
+// produceTime v1 的消息返回零值
+func (m *Payload) produceTime() time.Time {
+	if m.Timestamp <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, m.Timestamp*int64(time.Millisecond))
+}
+
+type PayloadFormat int
+
+const (
+	PayloadFormatJSON PayloadFormat = iota
+	PayloadFormatProtobuf
+)
+
+func (f PayloadFormat) String() string {
+	switch f {
+	case PayloadFormatJSON:
+		return "json"
+	case PayloadFormatProtobuf:
+		return "protobuf"
+	default:
+		return ""
+	}
+}
+
+// topic -> PayloadFormat
+var payloadFormats sync.Map
+
+// SetPayloadFormat 设置之后写入 topic 的消息格式，消费者需要先升级到支持该格式的版本
+func SetPayloadFormat(topic string, format PayloadFormat) {
+	if format == PayloadFormatJSON {
+		payloadFormats.Delete(topic)
+		return
+	}
+	payloadFormats.Store(topic, format)
+}
+
+func topicPayloadFormat(topic string) PayloadFormat {
+	if v, ok := payloadFormats.Load(topic); ok {
+		return v.(PayloadFormat)
+	}
+	return PayloadFormatJSON
+}
+
+// marshalPayloadValue 按 topic 的设置编码 Payload.Value
+func marshalPayloadValue(topic string, payload *Payload, value interface{}) error {
+	payload.format = topicPayloadFormat(topic)
+	if pm, ok := value.(proto.Message); ok && payload.format == PayloadFormatProtobuf {
+		body, err := proto.Marshal(pm)
+		if err != nil {
+			return err
+		}
+		// NOTE: Value 需要能够 json 编码，如写入死信 topic 时，故保存 base64，写入时再解码
+		payload.Value = base64.StdEncoding.EncodeToString(body)
+		payload.Codec = payloadCodecProtobuf
+		payload.ContentType = contentTypeProtobuf
+		return nil
+	}
+
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	payload.Value = string(body)
+	if err = encodeAvroPayloadValue(topic, payload); err != nil {
+		return err
+	}
+	payload.ContentType = codecContentType(payload.Codec)
+	return nil
+}
+
+func payloadToProto(payload *Payload) (*mqproto.Payload, error) {
+	pb := &mqproto.Payload{
+		Carrier:     payload.Carrier,
+		Retries:     int32(payload.Retries),
+		Codec:       payload.Codec,
+		Version:     int32(payload.Version),
+		ContentType: payload.ContentType,
+		Timestamp:   payload.Timestamp,
+	}
+
+	var err error
+	if payload.Codec == payloadCodecProtobuf {
+		pb.Value, err = base64.StdEncoding.DecodeString(payload.Value)
+	} else {
+		pb.Value = []byte(payload.Value)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.Head != nil {
+		if pb.Head, err = json.Marshal(payload.Head); err != nil {
+			return nil, err
+		}
+	}
+	if payload.Control != nil {
+		if pb.Control, err = json.Marshal(payload.Control); err != nil {
+			return nil, err
+		}
+	}
+	return pb, nil
+}
+
+func payloadFromProto(pb *mqproto.Payload) (*Payload, error) {
+	payload := &Payload{
+		Carrier:     pb.Carrier,
+		Retries:     int(pb.Retries),
+		Codec:       pb.Codec,
+		Version:     int(pb.Version),
+		ContentType: pb.ContentType,
+		Timestamp:   pb.Timestamp,
+		format:      PayloadFormatProtobuf,
+	}
+
+	if pb.Codec == payloadCodecProtobuf {
+		payload.Value = base64.StdEncoding.EncodeToString(pb.Value)
+	} else {
+		payload.Value = string(pb.Value)
+	}
+
+	if len(pb.Head) > 0 {
+		if err := json.Unmarshal(pb.Head, &payload.Head); err != nil {
+			return nil, err
+		}
+	}
+	if len(pb.Control) > 0 {
+		if err := json.Unmarshal(pb.Control, &payload.Control); err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// marshalMsg 各后端写入消息时使用，Payload 按 topic 设置的格式编码，其他值使用 json
+func marshalMsg(v interface{}) ([]byte, error) {
+	payload, ok := v.(*Payload)
+	if !ok || payload.format != PayloadFormatProtobuf {
+		return json.Marshal(v)
+	}
+
+	pb, err := payloadToProto(payload)
+	if err != nil {
+		return nil, err
+	}
+	body, err := proto.Marshal(pb)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{protobufFormatMarker}, body...), nil
+}
+
+// unmarshalMsg 各后端读取消息时使用，protobuf 格式的消息解析到 Payload，
+// 目标不是 Payload 时解析 Payload.Value，与 json 格式时 ov 的行为一致
+func unmarshalMsg(data []byte, v interface{}) error {
+	if len(data) == 0 || data[0] != protobufFormatMarker {
+		return json.Unmarshal(data, v)
+	}
+
+	var pb mqproto.Payload
+	if err := proto.Unmarshal(data[1:], &pb); err != nil {
+		return err
+	}
+	payload, err := payloadFromProto(&pb)
+	if err != nil {
+		return err
+	}
+
+	if p, ok := v.(*Payload); ok {
+		*p = *payload
+		return nil
+	}
+	return unmarshalPayloadValue(payload, v)
+}
+
+// unmarshalPayloadValue 按 Payload.Codec 解析 Value
+func unmarshalPayloadValue(payload *Payload, value interface{}) error {
+	switch payload.Codec {
+	case "":
+		return json.Unmarshal([]byte(payload.Value), value)
+	case payloadCodecClaim:
+		resolved := *payload
+		if err := resolveClaim(context.TODO(), &resolved); err != nil {
+			return err
+		}
+		return unmarshalPayloadValue(&resolved, value)
+	case payloadCodecAvro:
+		body, err := decodeAvroValue(context.TODO(), payload.Value)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(body, value)
+	case payloadCodecProtobuf:
+		pm, ok := value.(proto.Message)
+		if !ok {
+			return fmt.Errorf("protobuf payload value needs proto.Message, got %T", value)
+		}
+		body, err := base64.StdEncoding.DecodeString(payload.Value)
+		if err != nil {
+			return err
+		}
+		return proto.Unmarshal(body, pm)
+	default:
+		return fmt.Errorf("unknown payload codec: %s", payload.Codec)
+	}
+}
@@ -0,0 +1,110 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+	mqproto "github.com/shawnfeng/sutil/mq/pb"
+)
+
+func TestMarshalMsgProtobuf(t *testing.T) {
+	payload := &Payload{
+		Carrier: map[string]string{"uber-trace-id": "1:2:3:1"},
+		Value:   `{"id":1,"name":"a"}`,
+		Head:    map[string]interface{}{"uid": float64(1)},
+		Retries: 2,
+		format:  PayloadFormatProtobuf,
+	}
+	body, err := marshalMsg(payload)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, body[0], byte(protobufFormatMarker))
+
+	jsonBody, err := json.Marshal(payload)
+	assert.Equal(t, err, nil)
+	assert.True(t, len(body) < len(jsonBody))
+
+	var p Payload
+	assert.Equal(t, unmarshalMsg(body, &p), nil)
+	assert.Equal(t, p.Value, payload.Value)
+	assert.Equal(t, p.Carrier["uber-trace-id"], "1:2:3:1")
+	assert.Equal(t, p.Head.(map[string]interface{})["uid"], float64(1))
+	assert.Equal(t, p.Control, nil)
+	assert.Equal(t, p.Retries, 2)
+
+	// 目标不是 Payload 时解析 Value
+	var msg memoryTestMsg
+	assert.Equal(t, unmarshalMsg(body, &msg), nil)
+	assert.Equal(t, msg.ID, 1)
+
+	// json 格式不受影响
+	payload.format = PayloadFormatJSON
+	body, err = marshalMsg(payload)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(body), string(jsonBody))
+	assert.Equal(t, unmarshalMsg(body, &p), nil)
+	assert.Equal(t, p.Value, payload.Value)
+}
+
+func TestProtobufPayload(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.protobuf"
+	SetPayloadFormat(topic, PayloadFormatProtobuf)
+	defer SetPayloadFormat(topic, PayloadFormatJSON)
+
+	value := &mqproto.Payload{Codec: "test", Retries: 3}
+	err := WriteMsg(context.TODO(), topic, "k1", value)
+	assert.Equal(t, err, nil)
+	err = WriteMsg(context.TODO(), topic, "k2", &memoryTestMsg{ID: 2, Name: "b"})
+	assert.Equal(t, err, nil)
+
+	raw := defaultMemoryBroker.topic(topic).msgs
+	assert.Equal(t, raw[0].value[0], byte(protobufFormatMarker))
+	assert.Equal(t, raw[1].value[0], byte(protobufFormatMarker))
+
+	var pv mqproto.Payload
+	_, err = ReadMsgByGroup(context.TODO(), topic, "g1", &pv)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, pv.Codec, "test")
+	assert.Equal(t, pv.Retries, int32(3))
+
+	var msg memoryTestMsg
+	_, err = ReadMsgByGroup(context.TODO(), topic, "g1", &msg)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, msg.ID, 2)
+
+	// protobuf 编码的 Value 只能解析到 proto.Message
+	_, err = ReadMsgByGroup(context.TODO(), topic, "g2", &msg)
+	assert.True(t, err != nil)
+}
+
+func TestPayloadVersion(t *testing.T) {
+	// v1 的消息
+	var v1 Payload
+	assert.Equal(t, unmarshalMsg([]byte(`{"c":{},"v":"{\"id\":1}","h":null,"t":null,"r":1}`), &v1), nil)
+	assert.Equal(t, v1.Version, 0)
+	assert.Equal(t, v1.contentType(), contentTypeJSON)
+	assert.Equal(t, v1.produceTime().IsZero(), true)
+	var msg memoryTestMsg
+	_, err := parsePayload(&v1, "test", &msg)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, msg.ID, 1)
+
+	payload, err := generatePayload(context.TODO(), defaultTestTopic, &memoryTestMsg{ID: 2})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, payload.Version, payloadVersion)
+	assert.Equal(t, payload.ContentType, contentTypeJSON)
+	assert.True(t, payload.Timestamp > 0)
+
+	// protobuf 格式保留 v2 的字段
+	payload.format = PayloadFormatProtobuf
+	body, err := marshalMsg(payload)
+	assert.Equal(t, err, nil)
+	var p Payload
+	assert.Equal(t, unmarshalMsg(body, &p), nil)
+	assert.Equal(t, p.Version, payload.Version)
+	assert.Equal(t, p.ContentType, payload.ContentType)
+	assert.Equal(t, p.produceTime(), payload.produceTime())
+}
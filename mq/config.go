@@ -22,6 +22,11 @@ type MQType int
 const (
 	MQTypeKafka MQType = iota
 	MQTypeDelay
+	MQTypeRabbitMQ
+	MQTypePulsar
+	MQTypeNSQ
+	MQTypeRedis
+	MQTypeMemory
 )
 
 func (t MQType) String() string {
@@ -30,6 +35,16 @@ func (t MQType) String() string {
 		return "kafka"
 	case MQTypeDelay:
 		return "delay"
+	case MQTypeRabbitMQ:
+		return "rabbitmq"
+	case MQTypePulsar:
+		return "pulsar"
+	case MQTypeNSQ:
+		return "nsq"
+	case MQTypeRedis:
+		return "redis"
+	case MQTypeMemory:
+		return "memory"
 	default:
 		return ""
 	}
@@ -41,6 +56,7 @@ const (
 	ConfigerTypeSimple ConfigerType = iota
 	ConfigerTypeEtcd
 	ConfigerTypeApollo
+	ConfigerTypeMemory
 )
 
 func (c ConfigerType) String() string {
@@ -51,7 +67,14 @@ func (c ConfigerType) String() string {
 		return "etcd"
 	case ConfigerTypeApollo:
 		return "apollo"
+	case ConfigerTypeMemory:
+		return "memory"
 	default:
+		configerFactories.RLock()
+		defer configerFactories.RUnlock()
+		if c, ok := configerFactories.m[c]; ok {
+			return c.name
+		}
 		return "unknown"
 	}
 }
@@ -71,9 +94,96 @@ type Config struct {
 	CommitInterval time.Duration
 	Offset         int64
 	OffsetAt       string
-	TTR            uint32 // time to run
-	TTL            uint32 // time to live
-	Tries          uint16 // delay tries
+	TTR            uint32        // time to run
+	TTL            uint32        // time to live
+	Tries          uint16        // delay tries
+	Subscription   string        // pulsar subscription type
+	Lookupds       []string      // nsqlookupd addresses
+	DLQTopic       string        // dead letter topic
+	BatchSize      int           // producer batch size
+	Linger         time.Duration // producer batch linger
+	Compression    string        // producer compression codec
+	HeaderCarrier  bool          // carry trace context and head in kafka headers
+	StartOffset    string        // initial offset of new consumer groups
+	Auth           AuthConfig    // kafka sasl and tls
+	Partitioner    string        // kafka partitioner: hash, roundrobin or sticky
+	AutoCreate     bool          // create missing topic in EnsureTopics
+	Partitions     int           // partitions of auto created topic
+	Replication    int           // replication factor of auto created topic
+	Retention      time.Duration // retention of auto created topic
+	Concurrency    int           // consumer concurrency when ConsumeOptions.Concurrency is 0
+	MaxAttempts    int           // consumer max attempts when ConsumeOptions.MaxAttempts is 0
+	RateLimit      float64       // consumer messages per second when ConsumeOptions.RateLimit is 0
+	ByteRateLimit  float64       // consumer bytes per second when ConsumeOptions.ByteRateLimit is 0
+	Idempotent     bool          // kafka idempotent producer
+	TxnID          string        // kafka transactional id prefix of NewTxnWriter, consumers read committed
+}
+
+// AuthConfig kafka 连接的认证配置，证书可以填写文件路径或 PEM 内容
+type AuthConfig struct {
+	SASLMechanism string // PLAIN, SCRAM-SHA-256 或 SCRAM-SHA-512
+	SASLUsername  string
+	SASLPassword  string
+	TLS           bool // 配置了证书时自动开启
+	TLSCert       string
+	TLSKey        string
+	TLSCA         string
+}
+
+const (
+	startOffsetEarliest = "earliest"
+	startOffsetLatest   = "latest"
+
+	startOffsetGroupSep = ":"
+)
+
+// groupStartOffset 没有提交过 offset 的 group 开始消费的位置，配置项 startoffset 为 earliest 或 latest 时对所有 group 生效，
+// 也可以按 group 配置，如 latest,g1:earliest，未配置或无法解析时返回 def
+func (m *Config) groupStartOffset(groupId string, def int64) int64 {
+	offset := def
+	for _, item := range splitApolloAddrs(m.StartOffset) {
+		val := item
+		if i := strings.LastIndex(item, startOffsetGroupSep); i >= 0 {
+			if strings.TrimSpace(item[:i]) != groupId {
+				continue
+			}
+			val = item[i+1:]
+		}
+
+		switch strings.ToLower(strings.TrimSpace(val)) {
+		case startOffsetEarliest:
+			offset = FirstOffset
+		case startOffsetLatest:
+			offset = LastOffset
+		default:
+			continue
+		}
+		// group 的配置优先于所有 group 的配置
+		if val != item {
+			return offset
+		}
+	}
+	return offset
+}
+
+// readWriteMQTypes 读写 topic 时依次查找的 mq 类型，topic 配置在哪个类型下即使用哪个后端
+var readWriteMQTypes = []MQType{MQTypeKafka, MQTypeRabbitMQ, MQTypePulsar, MQTypeNSQ, MQTypeRedis}
+
+// getReadWriteConfig 按 readWriteMQTypes 的顺序查找 topic 的配置，都没有时返回 kafka 配置的错误，
+// 分级延迟 topic 与默认的死信 topic 使用原 topic 的配置
+func getReadWriteConfig(ctx context.Context, topic string) (*Config, error) {
+	topic = dlqBaseTopic(delayBaseTopic(topic))
+	var firstErr error
+	for _, mqType := range readWriteMQTypes {
+		config, err := DefaultConfiger.GetConfig(ctx, topic, mqType)
+		if err == nil {
+			return config, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
 }
 
 type KeyParts struct {
@@ -98,11 +208,57 @@ func NewConfiger(configType ConfigerType) (Configer, error) {
 		return NewEtcdConfiger(), nil
 	case ConfigerTypeApollo:
 		return NewApolloConfiger(), nil
+	case ConfigerTypeMemory:
+		return NewMemoryConfiger(), nil
 	default:
+		configerFactories.RLock()
+		c, ok := configerFactories.m[configType]
+		configerFactories.RUnlock()
+		if ok {
+			return c.factory()
+		}
 		return nil, fmt.Errorf("configType %d error", configType)
 	}
 }
 
+// ConfigerFactory 创建自定义配置中心
+type ConfigerFactory func() (Configer, error)
+
+type customConfiger struct {
+	name    string
+	factory ConfigerFactory
+}
+
+var configerFactories = struct {
+	sync.RWMutex
+	m map[ConfigerType]customConfiger
+}{m: make(map[ConfigerType]customConfiger)}
+
+// RegisterConfiger 注册自定义配置中心（如 consul、nacos、本地文件），返回的类型可以传给 SetConfiger，
+// 同名重复注册时返回同一个类型并覆盖之前的 factory，不能覆盖内置类型
+func RegisterConfiger(name string, factory ConfigerFactory) (ConfigerType, error) {
+	for _, t := range []ConfigerType{ConfigerTypeSimple, ConfigerTypeEtcd, ConfigerTypeApollo, ConfigerTypeMemory} {
+		if t.String() == name {
+			return 0, fmt.Errorf("configer %s is builtin", name)
+		}
+	}
+	if factory == nil {
+		return 0, fmt.Errorf("configer %s factory is nil", name)
+	}
+
+	configerFactories.Lock()
+	defer configerFactories.Unlock()
+	for t, c := range configerFactories.m {
+		if c.name == name {
+			configerFactories.m[t] = customConfiger{name: name, factory: factory}
+			return t, nil
+		}
+	}
+	t := ConfigerTypeMemory + 1 + ConfigerType(len(configerFactories.m))
+	configerFactories.m[t] = customConfiger{name: name, factory: factory}
+	return t, nil
+}
+
 type SimpleConfig struct {
 	mqAddr []string
 }
@@ -146,42 +302,6 @@ func (m *SimpleConfig) Watch(ctx context.Context) <-chan *center.ChangeEvent {
 	return nil
 }
 
-type EtcdConfig struct {
-	etcdAddr []string
-}
-
-func NewEtcdConfiger() *EtcdConfig {
-	return &EtcdConfig{
-		etcdAddr: []string{}, //todo
-	}
-}
-
-func (m *EtcdConfig) Init(ctx context.Context) error {
-	fun := "EtcdConfig.Init-->"
-	slog.Infof(ctx, "%s start", fun)
-	// TODO
-	return nil
-}
-
-func (m *EtcdConfig) GetConfig(ctx context.Context, topic string, mqType MQType) (*Config, error) {
-	fun := "EtcdConfig.GetConfig-->"
-	slog.Infof(ctx, "%s get etcd config topic:%s", fun, topic)
-	// TODO
-	return nil, fmt.Errorf("%s etcd config not supported", fun)
-}
-
-func (m *EtcdConfig) ParseKey(ctx context.Context, k string) (*KeyParts, error) {
-	fun := "EtcdConfig.ParseKey-->"
-	return nil, fmt.Errorf("%s not implemented", fun)
-}
-
-func (m *EtcdConfig) Watch(ctx context.Context) <-chan *center.ChangeEvent {
-	fun := "EtcdConfig.Watch-->"
-	slog.Infof(ctx, "%s start", fun)
-	// TODO:
-	return nil
-}
-
 const (
 	apolloConfigSep   = "."
 	apolloBrokersSep  = ","
@@ -190,6 +310,32 @@ const (
 	apolloTTRKey      = "ttr"
 	apolloTTLKey      = "ttl"
 	apolloTriesKey    = "tries"
+	apolloSubKey      = "subscription"
+	apolloLookupdsKey = "lookupds"
+	apolloDLQKey      = "dlq"
+	apolloBatchKey    = "batchsize"
+	apolloLingerKey   = "linger"
+	apolloCompressKey = "compression"
+	apolloHeaderKey   = "headercarrier"
+	apolloStartKey    = "startoffset"
+	apolloSASLKey     = "saslmechanism"
+	apolloSASLUserKey = "saslusername"
+	apolloSASLPassKey = "saslpassword"
+	apolloTLSKey      = "tls"
+	apolloTLSCertKey  = "tlscert"
+	apolloTLSKeyKey   = "tlskey"
+	apolloTLSCAKey    = "tlsca"
+	apolloPartKey     = "partitioner"
+	apolloAutoKey     = "autocreate"
+	apolloPartsKey    = "partitions"
+	apolloReplKey     = "replication"
+	apolloRetainKey   = "retention"
+	apolloConcurKey   = "concurrency"
+	apolloAttemptsKey = "maxattempts"
+	apolloRateKey     = "ratelimit"
+	apolloByteRateKey = "byteratelimit"
+	apolloIdemKey     = "idempotent"
+	apolloTxnIDKey    = "transactionalid"
 )
 
 type ApolloConfig struct {
@@ -247,28 +393,33 @@ func (m *ApolloConfig) GetConfig(ctx context.Context, topic string, mqType MQTyp
 	fun := "ApolloConfig.GetConfig-->"
 	slog.Infof(ctx, "%s get mq config topic:%s", fun, topic)
 
-	brokersVal, ok := m.getConfigItemWithFallback(ctx, topic, apolloBrokersKey, mqType)
+	return buildConfig(ctx, fun, topic, mqType, func(name string) (string, bool) {
+		return m.getConfigItemWithFallback(ctx, topic, name, mqType)
+	})
+}
+
+// configItemGetter 返回 topic 的配置项 name，apollo 与 etcd 的配置项名称相同
+type configItemGetter func(name string) (string, bool)
+
+// buildConfig 按配置项生成 Config，fun 用于日志
+func buildConfig(ctx context.Context, fun, topic string, mqType MQType, get configItemGetter) (*Config, error) {
+	brokersVal, ok := get(apolloBrokersKey)
 	if !ok {
 		return nil, fmt.Errorf("%s no brokers config found", fun)
 	}
 
-	var brokers []string
-	for _, broker := range strings.Split(brokersVal, apolloBrokersSep) {
-		if broker != "" {
-			brokers = append(brokers, strings.TrimSpace(broker))
-		}
-	}
+	brokers := splitApolloAddrs(brokersVal)
 
 	slog.Infof(ctx, "%s got config brokers:%s", fun, brokers)
 
-	offsetAtVal, ok := m.getConfigItemWithFallback(ctx, topic, apolloOffsetAtKey, mqType)
+	offsetAtVal, ok := get(apolloOffsetAtKey)
 	if !ok {
 		slog.Infof(ctx, "%s no offsetAtVal config founds", fun)
 
 	}
 	slog.Infof(ctx, "%s got config offsetAt:%s", fun, offsetAtVal)
 
-	ttrVal, ok := m.getConfigItemWithFallback(ctx, topic, apolloTTRKey, mqType)
+	ttrVal, ok := get(apolloTTRKey)
 	if !ok {
 		slog.Infof(ctx, "%s no ttrVal config founds", fun)
 	}
@@ -278,7 +429,7 @@ func (m *ApolloConfig) GetConfig(ctx context.Context, topic string, mqType MQTyp
 	}
 	slog.Infof(ctx, "%s got config TTR:%d", fun, ttr)
 
-	ttlVal, ok := m.getConfigItemWithFallback(ctx, topic, apolloTTLKey, mqType)
+	ttlVal, ok := get(apolloTTLKey)
 	if !ok {
 		slog.Infof(ctx, "%s no ttlVal config founds", fun)
 	}
@@ -288,7 +439,7 @@ func (m *ApolloConfig) GetConfig(ctx context.Context, topic string, mqType MQTyp
 	}
 	slog.Infof(ctx, "%s got config TTL:%d", fun, ttl)
 
-	triesVal, ok := m.getConfigItemWithFallback(ctx, topic, apolloTriesKey, mqType)
+	triesVal, ok := get(apolloTriesKey)
 	if !ok {
 		slog.Infof(ctx, "%s no triesVal config founds", fun)
 	}
@@ -298,6 +449,47 @@ func (m *ApolloConfig) GetConfig(ctx context.Context, topic string, mqType MQTyp
 	}
 	slog.Infof(ctx, "%s got config triesVal:%s", fun, triesVal)
 
+	subVal, _ := get(apolloSubKey)
+	lookupdsVal, _ := get(apolloLookupdsKey)
+	dlqVal, _ := get(apolloDLQKey)
+
+	batchVal, _ := get(apolloBatchKey)
+	batchSize, _ := strconv.Atoi(batchVal)
+	lingerVal, _ := get(apolloLingerKey)
+	linger, _ := time.ParseDuration(lingerVal)
+	slog.Infof(ctx, "%s got config batchSize:%d linger:%s", fun, batchSize, linger)
+
+	compressionVal, _ := get(apolloCompressKey)
+	headerVal, _ := get(apolloHeaderKey)
+	headerCarrier, _ := strconv.ParseBool(headerVal)
+	startOffsetVal, _ := get(apolloStartKey)
+	auth := buildAuthConfig(get)
+	slog.Infof(ctx, "%s got config sasl:%s tls:%t", fun, auth.SASLMechanism, auth.TLS)
+	partitionerVal, _ := get(apolloPartKey)
+
+	autoCreateVal, _ := get(apolloAutoKey)
+	autoCreate, _ := strconv.ParseBool(autoCreateVal)
+	partitionsVal, _ := get(apolloPartsKey)
+	partitions, _ := strconv.Atoi(partitionsVal)
+	replicationVal, _ := get(apolloReplKey)
+	replication, _ := strconv.Atoi(replicationVal)
+	retentionVal, _ := get(apolloRetainKey)
+	retention, _ := time.ParseDuration(retentionVal)
+
+	concurrencyVal, _ := get(apolloConcurKey)
+	concurrency, _ := strconv.Atoi(concurrencyVal)
+	maxAttemptsVal, _ := get(apolloAttemptsKey)
+	maxAttempts, _ := strconv.Atoi(maxAttemptsVal)
+	rateVal, _ := get(apolloRateKey)
+	rate, _ := strconv.ParseFloat(rateVal, 64)
+	byteRateVal, _ := get(apolloByteRateKey)
+	byteRate, _ := strconv.ParseFloat(byteRateVal, 64)
+
+	idempotentVal, _ := get(apolloIdemKey)
+	idempotent, _ := strconv.ParseBool(idempotentVal)
+	txnIDVal, _ := get(apolloTxnIDKey)
+	slog.Infof(ctx, "%s got config idempotent:%t transactionalid:%s", fun, idempotent, txnIDVal)
+
 	return &Config{
 		MQType:         mqType,
 		MQAddr:         brokers,
@@ -309,9 +501,52 @@ func (m *ApolloConfig) GetConfig(ctx context.Context, topic string, mqType MQTyp
 		TTR:            uint32(ttr),
 		TTL:            uint32(ttl),
 		Tries:          uint16(tries),
+		Subscription:   subVal,
+		Lookupds:       splitApolloAddrs(lookupdsVal),
+		DLQTopic:       dlqVal,
+		BatchSize:      batchSize,
+		Linger:         linger,
+		Compression:    compressionVal,
+		HeaderCarrier:  headerCarrier,
+		StartOffset:    startOffsetVal,
+		Auth:           auth,
+		Partitioner:    partitionerVal,
+		AutoCreate:     autoCreate,
+		Partitions:     partitions,
+		Replication:    replication,
+		Retention:      retention,
+		Concurrency:    concurrency,
+		MaxAttempts:    maxAttempts,
+		RateLimit:      rate,
+		ByteRateLimit:  byteRate,
+		Idempotent:     idempotent,
+		TxnID:          txnIDVal,
 	}, nil
 }
 
+func buildAuthConfig(get configItemGetter) AuthConfig {
+	var auth AuthConfig
+	auth.SASLMechanism, _ = get(apolloSASLKey)
+	auth.SASLUsername, _ = get(apolloSASLUserKey)
+	auth.SASLPassword, _ = get(apolloSASLPassKey)
+	tlsVal, _ := get(apolloTLSKey)
+	auth.TLS, _ = strconv.ParseBool(tlsVal)
+	auth.TLSCert, _ = get(apolloTLSCertKey)
+	auth.TLSKey, _ = get(apolloTLSKeyKey)
+	auth.TLSCA, _ = get(apolloTLSCAKey)
+	return auth
+}
+
+func splitApolloAddrs(val string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(val, apolloBrokersSep) {
+		if addr != "" {
+			addrs = append(addrs, strings.TrimSpace(addr))
+		}
+	}
+	return addrs
+}
+
 func (m *ApolloConfig) ParseKey(ctx context.Context, key string) (*KeyParts, error) {
 	fun := "ApolloConfig.ParseKey-->"
 	parts := strings.Split(key, apolloConfigSep)
@@ -340,7 +575,9 @@ func (ob *apolloObserver) HandleChangeEvent(event *center.ChangeEvent) {
 	// TODO: filter different mq types
 	var changes = map[string]*center.Change{}
 	for k, ce := range event.Changes {
-		if strings.Contains(k, fmt.Sprint(MQTypeKafka)) || strings.Contains(k, fmt.Sprint(MQTypeDelay)) {
+		if strings.Contains(k, fmt.Sprint(MQTypeKafka)) || strings.Contains(k, fmt.Sprint(MQTypeDelay)) ||
+			strings.Contains(k, fmt.Sprint(MQTypeRabbitMQ)) || strings.Contains(k, fmt.Sprint(MQTypePulsar)) ||
+			strings.Contains(k, fmt.Sprint(MQTypeNSQ)) || strings.Contains(k, fmt.Sprint(MQTypeRedis)) {
 			changes[k] = ce
 		}
 	}
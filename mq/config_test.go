@@ -173,3 +173,44 @@ func TestApolloConfig_getConfigItemWithFallback(t *testing.T) {
 		slog.Infof(ctx, "got brokers:%s", brokersVal)
 	})
 }
+
+func TestRegisterConfiger(t *testing.T) {
+	_, err := RegisterConfiger("etcd", func() (Configer, error) {
+		return NewSimpleConfiger(), nil
+	})
+	assert.True(t, err != nil)
+
+	typ, err := RegisterConfiger("file", func() (Configer, error) {
+		return NewSimpleConfiger(), nil
+	})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, typ.String(), "file")
+
+	configer, err := NewConfiger(typ)
+	assert.Equal(t, err, nil)
+	_, ok := configer.(*SimpleConfig)
+	assert.True(t, ok)
+}
+
+func TestSplitApolloAddrs(t *testing.T) {
+	assert.Equal(t, splitApolloAddrs(""), []string(nil))
+	assert.Equal(t, splitApolloAddrs("nsqd1:4150, nsqd2:4150,"), []string{"nsqd1:4150", "nsqd2:4150"})
+}
+
+func TestConfig_groupStartOffset(t *testing.T) {
+	config := &Config{}
+	assert.Equal(t, config.groupStartOffset("g1", LastOffset), LastOffset)
+
+	config.StartOffset = "earliest"
+	assert.Equal(t, config.groupStartOffset("g1", LastOffset), int64(FirstOffset))
+
+	config.StartOffset = "Latest, g1:earliest"
+	assert.Equal(t, config.groupStartOffset("g1", FirstOffset), int64(FirstOffset))
+	assert.Equal(t, config.groupStartOffset("g2", FirstOffset), LastOffset)
+
+	config.StartOffset = "g1:earliest,latest"
+	assert.Equal(t, config.groupStartOffset("g1", LastOffset), int64(FirstOffset))
+
+	config.StartOffset = "g1:unknown"
+	assert.Equal(t, config.groupStartOffset("g1", LastOffset), LastOffset)
+}
@@ -0,0 +1,185 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// Consumer 在后台执行 ConsumeByGroup，退出时调用 Close 停止读取，处理完已读取的消息并提交后再关闭 reader，
+// kafka 的 reader 关闭时提交剩余的 offset 并发送 LeaveGroup，其他消费者无需等待 session 超时即可分配到 partition，
+// 避免退出时未提交的消息在 rebalance 后被重复处理
+type Consumer struct {
+	topic   string
+	groupId string
+	conf    *instanceConf
+
+	stopFetch  context.CancelFunc
+	stopHandle context.CancelFunc
+	done       chan struct{}
+	pauser     *consumePauser
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// StartConsumer 参数与 ConsumeByGroup 相同，ctx 结束时直接停止，与 ConsumeByGroup 的行为一致
+func StartConsumer(ctx context.Context, topic, groupId string, fn ConsumeFunc, opts *ConsumeOptions) *Consumer {
+	fetchCtx, stopFetch := context.WithCancel(ctx)
+	handleCtx, stopHandle := context.WithCancel(ctx)
+	m := &Consumer{
+		topic:      topic,
+		groupId:    groupId,
+		conf:       newGroupReaderConf(ctx, topic, groupId),
+		stopFetch:  stopFetch,
+		stopHandle: stopHandle,
+		done:       make(chan struct{}),
+		pauser:     newConsumePauser(),
+	}
+
+	go func() {
+		defer close(m.done)
+		consumeByGroup(fetchCtx, handleCtx, topic, groupId, fn, opts, m.pauser)
+	}()
+	return m
+}
+
+// Close 停止读取并等待处理中的消息完成，ctx 结束时不再等待，未处理完的消息不会提交，之后会重新投递；
+// 最后关闭 topic 与 group 对应的 reader，同一进程内使用相同 topic 与 group 读取的调用也会受影响，重复调用返回第一次的结果
+func (m *Consumer) Close(ctx context.Context) error {
+	m.closeOnce.Do(func() {
+		m.closeErr = m.close(ctx)
+	})
+	return m.closeErr
+}
+
+// Pause 停止读取消息，已读取的消息继续处理，用于下游不可用时暂停消费，避免消息不断失败重试
+func (m *Consumer) Pause() {
+	m.pauser.pause()
+}
+
+// Resume 恢复 Pause 暂停的读取，不影响 PausePartitions 暂停的 partition
+func (m *Consumer) Resume() {
+	m.pauser.resume()
+}
+
+// PausePartitions 暂停处理 partitions 的消息，已读取的这些 partition 的消息等待恢复后再处理，
+// NOTE: kafka 的 group reader 所有 partition 的消息按一个序列返回，无法只停止读取部分 partition，
+// 暂停的 partition 的消息占用未提交的消息数，达到上限后停止读取，Concurrency <= 1 时会立即停止读取，
+// 同时 kafka 等按 offset 提交的后端，之后读取的消息都要等待暂停的消息处理完成后才能提交
+func (m *Consumer) PausePartitions(partitions ...int) {
+	m.pauser.pausePartitions(partitions)
+}
+
+// ResumePartitions 恢复 PausePartitions 暂停的 partition
+func (m *Consumer) ResumePartitions(partitions ...int) {
+	m.pauser.resumePartitions(partitions)
+}
+
+func (m *Consumer) close(ctx context.Context) error {
+	fun := "Consumer.Close -->"
+
+	m.stopFetch()
+	var err error
+	select {
+	case <-m.done:
+	case <-ctx.Done():
+		err = fmt.Errorf("%s drain timeout: %v, topic: %s, groupId: %s", fun, ctx.Err(), m.topic, m.groupId)
+		slog.Errorf(ctx, "%s", err)
+	}
+	m.stopHandle()
+
+	if cerr := defaultInstanceManager.remove(ctx, m.conf); cerr != nil {
+		slog.Errorf(ctx, "%s close reader err: %v, topic: %s, groupId: %s", fun, cerr, m.topic, m.groupId)
+		if err == nil {
+			err = cerr
+		}
+	}
+	slog.Infof(ctx, "%s closed topic: %s, groupId: %s", fun, m.topic, m.groupId)
+	return err
+}
+
+// consumePauser 为 nil 时不暂停
+type consumePauser struct {
+	mu         sync.Mutex
+	paused     bool
+	partitions map[int]bool
+	// 状态变化时关闭并替换，用于通知等待的 goroutine
+	changed chan struct{}
+}
+
+func newConsumePauser() *consumePauser {
+	return &consumePauser{
+		partitions: make(map[int]bool),
+		changed:    make(chan struct{}),
+	}
+}
+
+// update 修改状态并通知等待的 goroutine
+func (m *consumePauser) update(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn()
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (m *consumePauser) pause() {
+	m.update(func() { m.paused = true })
+}
+
+func (m *consumePauser) resume() {
+	m.update(func() { m.paused = false })
+}
+
+func (m *consumePauser) pausePartitions(partitions []int) {
+	m.update(func() {
+		for _, p := range partitions {
+			m.partitions[p] = true
+		}
+	})
+}
+
+func (m *consumePauser) resumePartitions(partitions []int) {
+	m.update(func() {
+		for _, p := range partitions {
+			delete(m.partitions, p)
+		}
+	})
+}
+
+// waitFetch 暂停读取时阻塞，ctx 结束时返回 false
+func (m *consumePauser) waitFetch(ctx context.Context) bool {
+	return m.wait(ctx, func() bool { return m.paused }) && ctx.Err() == nil
+}
+
+// waitPartition partition 暂停时阻塞，暂停期间 ctx 结束时返回 false
+func (m *consumePauser) waitPartition(ctx context.Context, partition int) bool {
+	return m.wait(ctx, func() bool { return m.partitions[partition] })
+}
+
+func (m *consumePauser) wait(ctx context.Context, paused func() bool) bool {
+	if m == nil {
+		return true
+	}
+	for {
+		m.mu.Lock()
+		p, changed := paused(), m.changed
+		m.mu.Unlock()
+		if !p {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestConsumerClose(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.consumerclose"
+	const total = 20
+	for i := 0; i < total; i++ {
+		assert.Equal(t, WriteMsg(context.TODO(), topic, fmt.Sprintf("k%d", i), &memoryTestMsg{ID: i}), nil)
+	}
+
+	var mu sync.Mutex
+	var started, finished int
+	first := make(chan struct{}, total)
+	consumer := StartConsumer(context.TODO(), topic, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+		mu.Lock()
+		started++
+		mu.Unlock()
+		first <- struct{}{}
+
+		time.Sleep(20 * time.Millisecond)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		mu.Lock()
+		finished++
+		mu.Unlock()
+		return nil
+	}, &ConsumeOptions{Concurrency: 2})
+
+	select {
+	case <-first:
+	case <-time.After(time.Second):
+		t.Fatal("consume timeout")
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	assert.Equal(t, consumer.Close(ctx), nil)
+	assert.Equal(t, consumer.Close(ctx), nil)
+
+	// 已开始处理的消息都处理完成，之后不再读取
+	mu.Lock()
+	assert.Equal(t, started, finished)
+	assert.True(t, finished < total)
+	mu.Unlock()
+}
+
+func TestConsumerCloseTimeout(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.consumerclosetimeout"
+	assert.Equal(t, WriteMsg(context.TODO(), topic, "k1", &memoryTestMsg{ID: 1}), nil)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	consumer := StartConsumer(context.TODO(), topic, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+		close(started)
+		<-release
+		return nil
+	}, nil)
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("consume timeout")
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 20*time.Millisecond)
+	defer cancel()
+	assert.NotEqual(t, consumer.Close(ctx), nil)
+}
+
+func TestConsumePauser(t *testing.T) {
+	var nilPauser *consumePauser
+	assert.Equal(t, nilPauser.waitFetch(context.TODO()), true)
+	assert.Equal(t, nilPauser.waitPartition(context.TODO(), 0), true)
+
+	pauser := newConsumePauser()
+	pauser.pause()
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, pauser.waitFetch(ctx), false)
+	// 只暂停读取时不影响 partition
+	assert.Equal(t, pauser.waitPartition(ctx, 0), true)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		pauser.resume()
+	}()
+	assert.Equal(t, pauser.waitFetch(context.TODO()), true)
+
+	pauser.pausePartitions([]int{1, 2})
+	assert.Equal(t, pauser.waitPartition(context.TODO(), 0), true)
+	ctx, cancel = context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, pauser.waitPartition(ctx, 1), false)
+	pauser.resumePartitions([]int{1})
+	assert.Equal(t, pauser.waitPartition(context.TODO(), 1), true)
+	assert.Equal(t, pauser.waitFetch(context.TODO()), true)
+}
+
+func TestConsumerPausePartitions(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.consumerpause"
+	const total = 3
+	received := make(chan int, total)
+	consumer := StartConsumer(context.TODO(), topic, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+		received <- msg.Partition
+		return nil
+	}, nil)
+	defer consumer.Close(context.TODO())
+
+	consumer.PausePartitions(0)
+	for i := 0; i < total; i++ {
+		assert.Equal(t, WriteMsg(context.TODO(), topic, fmt.Sprintf("k%d", i), &memoryTestMsg{ID: i}), nil)
+	}
+	select {
+	case <-received:
+		t.Fatal("received msg of paused partition")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	consumer.ResumePartitions(0)
+	for i := 0; i < total; i++ {
+		select {
+		case partition := <-received:
+			assert.Equal(t, partition, 0)
+		case <-time.After(time.Second):
+			t.Fatal("consume timeout")
+		}
+	}
+}
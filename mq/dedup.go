@@ -0,0 +1,178 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	redis2 "github.com/redis/go-redis/v9"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 消费去重，at-least-once 投递时 rebalance、提交失败、死信重新投递等都会导致消息重复，
+// 支付等不能重复执行的处理通过 Dedup 在 redis 中记录处理过的消息，如
+//
+//	opts := &mq.ConsumeOptions{
+//		Interceptors: []mq.ConsumeInterceptor{mq.Dedup(mq.DedupOptions{Namespace: "base/mqdedup"})},
+//	}
+//
+// 处理前写入处理中的记录，成功后改为已处理并保留 TTL，失败时删除记录以便重试，
+// 进程在处理中退出时记录在 ProcessingTimeout 后过期，之后重新投递的消息可以再次处理
+const (
+	defaultDedupTTL               = 24 * time.Hour
+	defaultDedupProcessingTimeout = time.Minute
+
+	dedupWrapper = "mq"
+
+	dedupStatusProcessing = "processing"
+	dedupStatusDone       = "done"
+)
+
+// ErrDedupProcessing 相同的消息正在被其他消费者处理，返回给 ConsumeByGroup 按退避重试
+var ErrDedupProcessing = errors.New("mq: duplicate message is processing")
+
+type DedupOptions struct {
+	// 记录使用的 redis namespace
+	Namespace string
+	// 已处理记录的保留时间，需要大于消息可能重复投递的时间范围，<= 0 时使用 defaultDedupTTL
+	TTL time.Duration
+	// 处理中记录的过期时间，需要大于 ConsumeFunc 的处理时间，<= 0 时使用 defaultDedupProcessingTimeout
+	ProcessingTimeout time.Duration
+	// 消息的唯一标识，为空时使用 DedupKey；消息内容带有业务 id 时建议使用业务 id，
+	// 避免业务上相同的消息重复写入后内容不同
+	Key func(msg *ConsumeMsg) string
+}
+
+func (m *DedupOptions) ttl() time.Duration {
+	if m.TTL <= 0 {
+		return defaultDedupTTL
+	}
+	return m.TTL
+}
+
+func (m *DedupOptions) processingTimeout() time.Duration {
+	if m.ProcessingTimeout <= 0 {
+		return defaultDedupProcessingTimeout
+	}
+	return m.ProcessingTimeout
+}
+
+func (m *DedupOptions) key(msg *ConsumeMsg) string {
+	if m.Key != nil {
+		return m.Key(msg)
+	}
+	return DedupKey(msg)
+}
+
+// DedupKey 按 topic、group、消息的 key 与内容生成，重试次数等投递信息不影响结果
+func DedupKey(msg *ConsumeMsg) string {
+	h := sha1.New()
+	h.Write([]byte(msg.Key))
+	h.Write([]byte{0})
+	if msg.payload != nil {
+		h.Write([]byte(msg.payload.Value))
+	}
+	return msg.Topic + "." + msg.GroupID + "." + hex.EncodeToString(h.Sum(nil))
+}
+
+// dedupStore 记录消息的处理状态
+type dedupStore interface {
+	// claim 记录不存在时写入处理中并返回 true，否则返回当前的状态
+	claim(ctx context.Context, key string, timeout time.Duration) (bool, string, error)
+	done(ctx context.Context, key string, ttl time.Duration) error
+	release(ctx context.Context, key string) error
+}
+
+// Dedup 返回去重的 ConsumeInterceptor，已处理过的消息直接返回成功并提交，
+// 正在被处理的消息返回 ErrDedupProcessing，读写 redis 失败时返回错误重试，不会在无法确认时执行处理
+func Dedup(opts DedupOptions) ConsumeInterceptor {
+	return dedup(opts, &redisDedupStore{namespace: opts.Namespace})
+}
+
+func dedup(opts DedupOptions, store dedupStore) ConsumeInterceptor {
+	return func(next ConsumeFunc) ConsumeFunc {
+		return func(ctx context.Context, msg *ConsumeMsg) error {
+			fun := "mq.Dedup -->"
+
+			key := opts.key(msg)
+			ok, status, err := store.claim(ctx, key, opts.processingTimeout())
+			if err != nil {
+				slog.Errorf(ctx, "%s claim err: %v, topic: %s, key: %s", fun, err, msg.Topic, key)
+				return err
+			}
+			if !ok {
+				if status == dedupStatusDone {
+					slog.Infof(ctx, "%s skip duplicate msg, topic: %s, key: %s", fun, msg.Topic, key)
+					statConsumeDeduped(msg.Topic, msg.GroupID)
+					return nil
+				}
+				return ErrDedupProcessing
+			}
+
+			if err = next(ctx, msg); err != nil {
+				if rerr := store.release(ctx, key); rerr != nil {
+					slog.Errorf(ctx, "%s release err: %v, topic: %s, key: %s", fun, rerr, msg.Topic, key)
+				}
+				return err
+			}
+			// 处理已经成功，记录失败时不返回错误，之后的重复消息在处理中记录过期后会再次处理
+			if err = store.done(ctx, key, opts.ttl()); err != nil {
+				slog.Errorf(ctx, "%s done err: %v, topic: %s, key: %s", fun, err, msg.Topic, key)
+			}
+			return nil
+		}
+	}
+}
+
+type redisDedupStore struct {
+	namespace string
+}
+
+func (m *redisDedupStore) client(ctx context.Context) (*redis.Client, error) {
+	return redis.DefaultInstanceManager.GetInstance(ctx, &redis.InstanceConf{
+		Group:     redis.RouteGroup(ctx),
+		Namespace: m.namespace,
+		Wrapper:   dedupWrapper,
+	})
+}
+
+func (m *redisDedupStore) claim(ctx context.Context, key string, timeout time.Duration) (bool, string, error) {
+	client, err := m.client(ctx)
+	if err != nil {
+		return false, "", err
+	}
+	ok, err := client.SetNX(ctx, key, dedupStatusProcessing, timeout).Result()
+	if err != nil || ok {
+		return ok, "", err
+	}
+
+	status, err := client.Get(ctx, key).Result()
+	if err == redis2.Nil {
+		// 记录刚好过期，按处理中重试
+		return false, dedupStatusProcessing, nil
+	}
+	return false, status, err
+}
+
+func (m *redisDedupStore) done(ctx context.Context, key string, ttl time.Duration) error {
+	client, err := m.client(ctx)
+	if err != nil {
+		return err
+	}
+	return client.Set(ctx, key, dedupStatusDone, ttl).Err()
+}
+
+func (m *redisDedupStore) release(ctx context.Context, key string) error {
+	client, err := m.client(ctx)
+	if err != nil {
+		return err
+	}
+	return client.Del(ctx, key).Err()
+}
@@ -0,0 +1,75 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+type memoryDedupStore struct {
+	mu     sync.Mutex
+	status map[string]string
+}
+
+func (m *memoryDedupStore) claim(ctx context.Context, key string, timeout time.Duration) (bool, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if status, ok := m.status[key]; ok {
+		return false, status, nil
+	}
+	m.status[key] = dedupStatusProcessing
+	return true, "", nil
+}
+
+func (m *memoryDedupStore) done(ctx context.Context, key string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status[key] = dedupStatusDone
+	return nil
+}
+
+func (m *memoryDedupStore) release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.status, key)
+	return nil
+}
+
+func TestDedup(t *testing.T) {
+	store := &memoryDedupStore{status: make(map[string]string)}
+	var calls int
+	failed := errors.New("failed")
+	fail := true
+	fn := dedup(DedupOptions{}, store)(func(ctx context.Context, msg *ConsumeMsg) error {
+		calls++
+		if fail {
+			return failed
+		}
+		return nil
+	})
+
+	newMsg := func(retries int) *ConsumeMsg {
+		return &ConsumeMsg{Topic: "t", GroupID: "g", Key: "k", payload: &Payload{Value: "v", Retries: retries}}
+	}
+
+	// 失败时删除记录，可以重试
+	assert.Equal(t, fn(context.TODO(), newMsg(0)), failed)
+	fail = false
+	assert.Equal(t, fn(context.TODO(), newMsg(1)), nil)
+	assert.Equal(t, calls, 2)
+
+	// 已处理过的消息直接返回成功
+	assert.Equal(t, fn(context.TODO(), newMsg(0)), nil)
+	assert.Equal(t, calls, 2)
+
+	other := newMsg(0)
+	other.payload.Value = "v2"
+	assert.NotEqual(t, DedupKey(other), DedupKey(newMsg(0)))
+	store.status[DedupKey(other)] = dedupStatusProcessing
+	assert.Equal(t, fn(context.TODO(), other), ErrDedupProcessing)
+	assert.Equal(t, calls, 2)
+}
@@ -0,0 +1,273 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/shawnfeng/sutil/scontext"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// DelayWriter 由原生支持延迟投递的后端实现
+type DelayWriter interface {
+	WriteMsgDelay(ctx context.Context, key string, value interface{}, delay time.Duration) error
+}
+
+// 不支持原生延迟的后端，消息先写入 topic 对应的分级延迟 topic，如 palfish.test.test.__delay.10s，
+// 由 StartDelayScheduler 启动的调度协程到期后转发，剩余时间大于某一级时会继续写入该级 topic，
+// 同一级 topic 内消息的到期时间基本有序，不会互相阻塞；分级延迟 topic 使用原 topic 的配置
+const (
+	delayTopicSep       = ".__delay."
+	delaySchedulerGroup = "delay_scheduler"
+	delayRetryInterval  = time.Second
+)
+
+type delayLevel struct {
+	name     string
+	duration time.Duration
+}
+
+var delayLevels = []delayLevel{
+	{"1s", time.Second},
+	{"10s", 10 * time.Second},
+	{"1m", time.Minute},
+	{"10m", 10 * time.Minute},
+	{"1h", time.Hour},
+}
+
+// delayEnvelope 分级延迟 topic 中的消息，Payload 为原消息序列化后的 Payload，保留写入时的 trace
+type delayEnvelope struct {
+	Key       string          `json:"k"`
+	Payload   json.RawMessage `json:"p"`
+	DeliverAt int64           `json:"d"` // 投递时间，unix 毫秒
+	HopAt     int64           `json:"h"` // 在当前级别 topic 中的到期时间，unix 毫秒
+}
+
+func delayLevelTopic(topic string, level delayLevel) string {
+	return topic + delayTopicSep + level.name
+}
+
+// delayBaseTopic 分级延迟 topic 对应的原 topic，用于查找配置
+func delayBaseTopic(topic string) string {
+	if i := strings.Index(topic, delayTopicSep); i >= 0 {
+		return topic[:i]
+	}
+	return topic
+}
+
+// delayLevelFor 选择不超过 remaining 的最大级别，remaining 小于最小级别时使用最小级别
+func delayLevelFor(remaining time.Duration) delayLevel {
+	level := delayLevels[0]
+	for _, l := range delayLevels {
+		if l.duration <= remaining {
+			level = l
+		}
+	}
+	return level
+}
+
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// ceilUnixMilli 向上取整到毫秒，按毫秒记录的投递时间不会早于 t
+func ceilUnixMilli(t time.Time) int64 {
+	return (t.UnixNano() + int64(time.Millisecond) - 1) / int64(time.Millisecond)
+}
+
+func fromUnixMilli(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func getTopicWriter(ctx context.Context, topic string) Writer {
+	conf := &instanceConf{
+		group:     scontext.GetControlRouteGroupWithDefault(ctx, defaultRouteGroup),
+		role:      RoleTypeWriter,
+		topic:     topic,
+		groupId:   "",
+		partition: 0,
+	}
+	return defaultInstanceManager.getWriter(ctx, conf)
+}
+
+// WriteMsgDelay 延迟 delay 后将消息投递给 topic 的消费者，
+// 后端不支持原生延迟时需要在某个服务中调用 StartDelayScheduler(ctx, topic) 转发到期的消息
+func WriteMsgDelay(ctx context.Context, topic string, key string, value interface{}, delay time.Duration) error {
+	fun := "mq.WriteMsgDelay -->"
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "mq.WriteMsgDelay")
+	defer span.Finish()
+	span.LogFields(
+		log.String(spanLogKeyTopic, topic),
+		log.String(spanLogKeyKey, key))
+
+	writer := getTopicWriter(ctx, topic)
+	if writer == nil {
+		slog.Errorf(ctx, "%s getWriter err, topic: %s", fun, topic)
+		return fmt.Errorf("%s, getWriter err, topic: %s", fun, topic)
+	}
+
+	payload, err := generatePayload(ctx, topic, value)
+	if err != nil {
+		slog.Errorf(ctx, "%s generatePayload err, topic: %s", fun, topic)
+		return fmt.Errorf("%s, generatePayload err, topic: %s", fun, topic)
+	}
+
+	if delay <= 0 {
+		return writer.WriteMsg(ctx, key, payload)
+	}
+	if dw, ok := writer.(DelayWriter); ok {
+		return dw.WriteMsgDelay(ctx, key, payload, delay)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return writeDelayEnvelope(ctx, topic, &delayEnvelope{
+		Key:       key,
+		Payload:   body,
+		DeliverAt: ceilUnixMilli(time.Now().Add(delay)),
+	})
+}
+
+// writeDelayEnvelope 按剩余时间写入对应级别的延迟 topic
+func writeDelayEnvelope(ctx context.Context, topic string, env *delayEnvelope) error {
+	fun := "mq.writeDelayEnvelope -->"
+
+	now := time.Now()
+	remaining := fromUnixMilli(env.DeliverAt).Sub(now)
+	level := delayLevelFor(remaining)
+	hop := level.duration
+	if remaining < hop {
+		hop = remaining
+	}
+	env.HopAt = ceilUnixMilli(now.Add(hop))
+
+	levelTopic := delayLevelTopic(topic, level)
+	writer := getTopicWriter(ctx, levelTopic)
+	if writer == nil {
+		slog.Errorf(ctx, "%s getWriter err, topic: %s", fun, levelTopic)
+		return fmt.Errorf("%s, getWriter err, topic: %s", fun, levelTopic)
+	}
+	return writer.WriteMsg(ctx, env.Key, env)
+}
+
+// forwardDelayMsg 等到消息在当前级别到期后，投递到原 topic 或写入下一级延迟 topic
+func forwardDelayMsg(ctx context.Context, topic string, env *delayEnvelope) error {
+	fun := "mq.forwardDelayMsg -->"
+
+	if !sleepContext(ctx, time.Until(fromUnixMilli(env.HopAt))) {
+		return ctx.Err()
+	}
+
+	if time.Until(fromUnixMilli(env.DeliverAt)) > 0 {
+		return writeDelayEnvelope(ctx, topic, env)
+	}
+
+	writer := getTopicWriter(ctx, topic)
+	if writer == nil {
+		slog.Errorf(ctx, "%s getWriter err, topic: %s", fun, topic)
+		return fmt.Errorf("%s, getWriter err, topic: %s", fun, topic)
+	}
+	return writer.WriteMsg(ctx, env.Key, env.Payload)
+}
+
+// StartDelayScheduler 为 topic 的每一级延迟 topic 启动转发协程，ctx 结束时退出，
+// 使用 ctx 中的路由 group 读写；后端原生支持延迟时不需要调度，直接返回
+func StartDelayScheduler(ctx context.Context, topic string) error {
+	fun := "mq.StartDelayScheduler -->"
+
+	writer := getTopicWriter(ctx, topic)
+	if writer == nil {
+		slog.Errorf(ctx, "%s getWriter err, topic: %s", fun, topic)
+		return fmt.Errorf("%s, getWriter err, topic: %s", fun, topic)
+	}
+	if _, ok := writer.(DelayWriter); ok {
+		slog.Infof(ctx, "%s topic: %s support native delay", fun, topic)
+		return nil
+	}
+
+	startDelayLevels(ctx, topic)
+	return nil
+}
+
+func startDelayLevels(ctx context.Context, topic string) {
+	for _, level := range delayLevels {
+		go runDelayLevel(ctx, topic, level)
+	}
+}
+
+func runDelayLevel(ctx context.Context, topic string, level delayLevel) {
+	fun := "mq.runDelayLevel -->"
+
+	levelTopic := delayLevelTopic(topic, level)
+	conf := &instanceConf{
+		group:     scontext.GetControlRouteGroupWithDefault(ctx, defaultRouteGroup),
+		role:      RoleTypeReader,
+		topic:     levelTopic,
+		groupId:   delaySchedulerGroup,
+		partition: 0,
+	}
+	slog.Infof(ctx, "%s start topic: %s", fun, levelTopic)
+
+	for ctx.Err() == nil {
+		reader := defaultInstanceManager.getReader(ctx, conf)
+		if reader == nil {
+			slog.Errorf(ctx, "%s getReader err, topic: %s", fun, levelTopic)
+			sleepContext(ctx, delayRetryInterval)
+			continue
+		}
+
+		var env delayEnvelope
+		handler, err := reader.FetchMsg(ctx, &env, &env)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Errorf(ctx, "%s FetchMsg err: %v, topic: %s", fun, err, levelTopic)
+				sleepContext(ctx, delayRetryInterval)
+			}
+			continue
+		}
+
+		// NOTE: 转发成功后才提交，转发失败时一直重试，避免丢失消息
+		for {
+			err = forwardDelayMsg(ctx, topic, &env)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Errorf(ctx, "%s forward err: %v, topic: %s", fun, err, levelTopic)
+			sleepContext(ctx, delayRetryInterval)
+		}
+
+		if err = handler.CommitMsg(ctx); err != nil {
+			slog.Errorf(ctx, "%s CommitMsg err: %v, topic: %s", fun, err, levelTopic)
+		}
+	}
+	slog.Infof(ctx, "%s stop topic: %s", fun, levelTopic)
+}
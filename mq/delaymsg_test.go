@@ -0,0 +1,80 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestDelayLevelFor(t *testing.T) {
+	assert.Equal(t, delayLevelFor(100*time.Millisecond).name, "1s")
+	assert.Equal(t, delayLevelFor(15*time.Second).name, "10s")
+	assert.Equal(t, delayLevelFor(time.Minute).name, "1m")
+	assert.Equal(t, delayLevelFor(3*time.Hour).name, "1h")
+
+	topic := delayLevelTopic(defaultTestTopic, delayLevels[1])
+	assert.Equal(t, topic, "palfish.test.test.__delay.10s")
+	assert.Equal(t, delayBaseTopic(topic), defaultTestTopic)
+	assert.Equal(t, delayBaseTopic(defaultTestTopic), defaultTestTopic)
+}
+
+func TestCeilUnixMilli(t *testing.T) {
+	ts := time.Unix(1, 1)
+	assert.Equal(t, ceilUnixMilli(ts), int64(1001))
+	assert.Equal(t, unixMilli(ts), int64(1000))
+	assert.Equal(t, ceilUnixMilli(time.Unix(1, int64(time.Millisecond))), int64(1001))
+	assert.True(t, !fromUnixMilli(ceilUnixMilli(ts)).Before(ts))
+}
+
+func TestWriteMsgDelay(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.delay"
+	start := time.Now()
+	err := WriteMsgDelay(context.TODO(), topic, "k", &memoryTestMsg{ID: 1}, 100*time.Millisecond)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, MemoryTopicLen(topic), 0)
+
+	var msg memoryTestMsg
+	ctx, cancel := context.WithTimeout(context.TODO(), 2*time.Second)
+	defer cancel()
+	_, err = ReadMsgByGroup(ctx, topic, "g1", &msg)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, msg.ID, 1)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestDelayScheduler(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	topic := "palfish.test.delayscheduler"
+	payload, err := generatePayload(ctx, topic, &memoryTestMsg{ID: 2})
+	assert.Equal(t, err, nil)
+	body, err := json.Marshal(payload)
+	assert.Equal(t, err, nil)
+
+	start := time.Now()
+	err = writeDelayEnvelope(ctx, topic, &delayEnvelope{
+		Key:       "k",
+		Payload:   body,
+		DeliverAt: ceilUnixMilli(start.Add(100 * time.Millisecond)),
+	})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, MemoryTopicLen(delayLevelTopic(topic, delayLevels[0])), 1)
+
+	startDelayLevels(ctx, topic)
+
+	var msg memoryTestMsg
+	rctx, rcancel := context.WithTimeout(ctx, 2*time.Second)
+	defer rcancel()
+	_, err = ReadMsgByGroup(rctx, topic, "g1", &msg)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, msg.ID, 2)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+}
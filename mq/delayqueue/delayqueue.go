@@ -0,0 +1,453 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package delayqueue 基于 redis sorted set 的延迟队列，score 为任务的执行时间，
+// 适用于任务量不大、不值得为其部署 kafka 分级延迟 topic 的场景
+//
+// 每个队列使用同一个 hash tag 下的几个 key，兼容 redis cluster：
+//
+//	{name}.delayed  等待执行的任务，score 为执行时间
+//	{name}.reserved 已取出未确认的任务，score 为可见性超时的时间，超时后重新放回 delayed
+//	{name}.dead     重试次数用尽的任务，score 为失败时间，可以通过 RetryDead 重新投递
+//	{name}.jobs     任务内容
+//	{name}.attempts 任务已取出的次数
+package delayqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/shawnfeng/sutil/cache/redis"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+const (
+	redisWrapper = "delayqueue"
+
+	defaultVisibilityTimeout = 30 * time.Second
+	defaultPollInterval      = time.Second
+	defaultBatchSize         = 10
+	defaultMaxAttempts       = 3
+	defaultRetryDelay        = 5 * time.Second
+
+	spanLogKeyQueue = "queue"
+	spanLogKeyJobID = "jobid"
+)
+
+// 参数的含义见各 key 的说明，ARGV 中的时间均为 unix 毫秒
+const (
+	// KEYS: delayed, jobs  ARGV: id, at, body
+	pushScript = `
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1`
+
+	// KEYS: delayed, reserved, jobs, attempts  ARGV: now, visible until, limit
+	reserveScript = `
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+local res = {}
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	local body = redis.call('HGET', KEYS[3], id)
+	if body then
+		redis.call('ZADD', KEYS[2], ARGV[2], id)
+		local n = redis.call('HINCRBY', KEYS[4], id, 1)
+		table.insert(res, id)
+		table.insert(res, body)
+		table.insert(res, n)
+	end
+end
+return res`
+
+	// 从 KEYS[1] 移动到 KEYS[2]，只移动 score 不超过 ARGV[1] 的任务
+	// KEYS: from, to  ARGV: max score, limit, new score
+	moveScript = `
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('ZADD', KEYS[2], ARGV[3], id)
+end
+return #ids`
+
+	// dead 中的任务放回 delayed 并清空取出次数，重新获得 MaxAttempts 次处理机会
+	// KEYS: dead, delayed, attempts  ARGV: limit, score
+	retryDeadScript = `
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', '+inf', 'LIMIT', 0, ARGV[1])
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('ZADD', KEYS[2], ARGV[2], id)
+	redis.call('HDEL', KEYS[3], id)
+end
+return #ids`
+
+	// 只移动已取出的任务，可见性超时后已被放回 delayed 的任务不处理
+	// KEYS: reserved, to  ARGV: id, score
+	releaseScript = `
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 1 then
+	redis.call('ZADD', KEYS[2], ARGV[2], ARGV[1])
+	return 1
+end
+return 0`
+
+	// KEYS: delayed, reserved, dead, jobs, attempts  ARGV: id
+	removeScript = `
+local n = redis.call('ZREM', KEYS[1], ARGV[1]) + redis.call('ZREM', KEYS[2], ARGV[1]) + redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('HDEL', KEYS[4], ARGV[1])
+redis.call('HDEL', KEYS[5], ARGV[1])
+return n`
+)
+
+// Options 为空或字段为零值时使用默认值
+type Options struct {
+	// 任务取出后超过该时间未确认时重新投递，需要大于任务的处理时间
+	VisibilityTimeout time.Duration
+	// 没有到期的任务时的轮询间隔
+	PollInterval time.Duration
+	// 每次最多取出的任务数
+	BatchSize int
+	// Consume 时最多处理次数，用尽后移入 dead
+	MaxAttempts int
+	// Consume 处理失败后第 n 次重试前等待 n 倍的 RetryDelay
+	RetryDelay time.Duration
+}
+
+// Queue namespace 为 cache/redis 的 namespace，与缓存共用连接池与配置
+type Queue struct {
+	namespace string
+	name      string
+	opts      Options
+}
+
+func NewQueue(namespace, name string, opts *Options) *Queue {
+	m := &Queue{
+		namespace: namespace,
+		name:      name,
+	}
+	if opts != nil {
+		m.opts = *opts
+	}
+	if m.opts.VisibilityTimeout <= 0 {
+		m.opts.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	if m.opts.PollInterval <= 0 {
+		m.opts.PollInterval = defaultPollInterval
+	}
+	if m.opts.BatchSize <= 0 {
+		m.opts.BatchSize = defaultBatchSize
+	}
+	if m.opts.MaxAttempts <= 0 {
+		m.opts.MaxAttempts = defaultMaxAttempts
+	}
+	if m.opts.RetryDelay <= 0 {
+		m.opts.RetryDelay = defaultRetryDelay
+	}
+	return m
+}
+
+func (m *Queue) key(name string) string {
+	return "{" + m.name + "}." + name
+}
+
+func (m *Queue) delayedKey() string  { return m.key("delayed") }
+func (m *Queue) reservedKey() string { return m.key("reserved") }
+func (m *Queue) deadKey() string     { return m.key("dead") }
+func (m *Queue) jobsKey() string     { return m.key("jobs") }
+func (m *Queue) attemptsKey() string { return m.key("attempts") }
+
+func (m *Queue) client(ctx context.Context) (*redis.Client, error) {
+	return redis.DefaultInstanceManager.GetInstance(ctx, &redis.InstanceConf{
+		Group:     redis.RouteGroup(ctx),
+		Namespace: m.namespace,
+		Wrapper:   redisWrapper,
+	})
+}
+
+// eval Client.Eval 会修改 keys，故每次传入新的 slice
+func (m *Queue) eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	client, err := m.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.Eval(ctx, script, keys, args...).Result()
+}
+
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// jobBody 写入 redis 的任务内容
+type jobBody struct {
+	Carrier opentracing.TextMapCarrier `json:"c,omitempty"`
+	Value   json.RawMessage            `json:"v"`
+}
+
+func newJobBody(ctx context.Context, value interface{}) ([]byte, error) {
+	v, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	body := &jobBody{Value: v}
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		body.Carrier = opentracing.TextMapCarrier{}
+		if err := opentracing.GlobalTracer().Inject(span.Context(), opentracing.TextMap, body.Carrier); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(body)
+}
+
+// Push delay 后执行，返回任务 id
+func (m *Queue) Push(ctx context.Context, value interface{}, delay time.Duration) (string, error) {
+	return m.PushAt(ctx, value, time.Now().Add(delay))
+}
+
+// PushAt at 时刻执行，返回任务 id
+func (m *Queue) PushAt(ctx context.Context, value interface{}, at time.Time) (string, error) {
+	fun := "Queue.PushAt -->"
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "delayqueue.Push")
+	defer span.Finish()
+	span.LogFields(log.String(spanLogKeyQueue, m.name))
+
+	id, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+	body, err := newJobBody(ctx, value)
+	if err != nil {
+		slog.Errorf(ctx, "%s marshal err: %v, queue: %s", fun, err, m.name)
+		return "", err
+	}
+
+	_, err = m.eval(ctx, pushScript, []string{m.delayedKey(), m.jobsKey()}, id, unixMilli(at), body)
+	if err != nil {
+		slog.Errorf(ctx, "%s push err: %v, queue: %s", fun, err, m.name)
+		return "", err
+	}
+	span.LogFields(log.String(spanLogKeyJobID, id))
+	return id, nil
+}
+
+// Remove 删除任务，取消未执行的任务或确认已取出的任务，任务不存在时返回 false
+func (m *Queue) Remove(ctx context.Context, id string) (bool, error) {
+	res, err := m.eval(ctx, removeScript,
+		[]string{m.delayedKey(), m.reservedKey(), m.deadKey(), m.jobsKey(), m.attemptsKey()}, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.(int64)
+	return n > 0, nil
+}
+
+// Fetch 取出最多 BatchSize 个到期的任务，没有到期的任务时返回空，
+// 取出的任务需要在 VisibilityTimeout 内调用 Job.CommitMsg 确认，否则会重新投递
+func (m *Queue) Fetch(ctx context.Context) ([]*Job, error) {
+	now := time.Now()
+	res, err := m.eval(ctx, reserveScript,
+		[]string{m.delayedKey(), m.reservedKey(), m.jobsKey(), m.attemptsKey()},
+		unixMilli(now), unixMilli(now.Add(m.opts.VisibilityTimeout)), m.opts.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	return m.parseJobs(res)
+}
+
+func (m *Queue) parseJobs(res interface{}) ([]*Job, error) {
+	items, ok := res.([]interface{})
+	if !ok || len(items)%3 != 0 {
+		return nil, fmt.Errorf("invalid reserve result: %v, queue: %s", res, m.name)
+	}
+
+	var jobs []*Job
+	for i := 0; i < len(items); i += 3 {
+		id, _ := items[i].(string)
+		data, _ := items[i+1].(string)
+		attempts, _ := items[i+2].(int64)
+
+		var body jobBody
+		if err := json.Unmarshal([]byte(data), &body); err != nil {
+			return nil, fmt.Errorf("invalid job: %s, err: %v, queue: %s", id, err, m.name)
+		}
+		jobs = append(jobs, &Job{
+			ID:       id,
+			Attempts: int(attempts),
+			queue:    m,
+			body:     &body,
+		})
+	}
+	return jobs, nil
+}
+
+// requeueExpired 可见性超时的任务放回 delayed 立即执行
+func (m *Queue) requeueExpired(ctx context.Context) (int, error) {
+	now := unixMilli(time.Now())
+	res, err := m.eval(ctx, moveScript, []string{m.reservedKey(), m.delayedKey()}, now, m.opts.BatchSize, now)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.(int64)
+	return int(n), nil
+}
+
+// RetryDead 重新投递最多 limit 个重试次数用尽的任务，返回重新投递的任务数，
+// 任务的取出次数从 0 重新开始计算
+func (m *Queue) RetryDead(ctx context.Context, limit int) (int, error) {
+	now := unixMilli(time.Now())
+	res, err := m.eval(ctx, retryDeadScript, []string{m.deadKey(), m.delayedKey(), m.attemptsKey()}, limit, now)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.(int64)
+	return int(n), nil
+}
+
+// release 将已取出的任务移到 key，score 为 at
+func (m *Queue) release(ctx context.Context, id, key string, at time.Time) error {
+	_, err := m.eval(ctx, releaseScript, []string{m.reservedKey(), key}, id, unixMilli(at))
+	return err
+}
+
+// Job 取出的任务，实现 mq.Handler
+type Job struct {
+	ID string
+	// 包含本次在内取出的次数，从 1 开始
+	Attempts int
+
+	queue *Queue
+	body  *jobBody
+}
+
+// Unmarshal 解析写入时的任务内容
+func (m *Job) Unmarshal(v interface{}) error {
+	return json.Unmarshal(m.body.Value, v)
+}
+
+// CommitMsg 确认任务已处理完成并删除
+func (m *Job) CommitMsg(ctx context.Context) error {
+	_, err := m.queue.Remove(ctx, m.ID)
+	return err
+}
+
+// Retry 任务在 delay 后重新投递
+func (m *Job) Retry(ctx context.Context, delay time.Duration) error {
+	return m.queue.release(ctx, m.ID, m.queue.delayedKey(), time.Now().Add(delay))
+}
+
+// context 使用写入时的 trace
+func (m *Job) context(ctx context.Context, queue string) (context.Context, opentracing.Span) {
+	var opts []opentracing.StartSpanOption
+	if len(m.body.Carrier) > 0 {
+		if sc, err := opentracing.GlobalTracer().Extract(opentracing.TextMap, m.body.Carrier); err == nil {
+			opts = append(opts, opentracing.FollowsFrom(sc))
+		}
+	}
+	span := opentracing.StartSpan("delayqueue.Consume", opts...)
+	span.LogFields(
+		log.String(spanLogKeyQueue, queue),
+		log.String(spanLogKeyJobID, m.ID))
+	return opentracing.ContextWithSpan(ctx, span), span
+}
+
+// HandleFunc 返回 error 表示处理失败
+type HandleFunc func(ctx context.Context, job *Job) error
+
+// Consume 循环取出到期的任务交给 fn 处理，直到 ctx 结束，
+// fn 成功时确认任务，失败时按 RetryDelay 延迟重试，达到 MaxAttempts 后移入 dead；
+// 进程退出时未确认的任务在 VisibilityTimeout 后重新投递，即 at-least-once
+func (m *Queue) Consume(ctx context.Context, fn HandleFunc) error {
+	fun := "Queue.Consume -->"
+	slog.Infof(ctx, "%s start queue: %s", fun, m.name)
+
+	for ctx.Err() == nil {
+		if _, err := m.requeueExpired(ctx); err != nil {
+			slog.Errorf(ctx, "%s requeue err: %v, queue: %s", fun, err, m.name)
+		}
+
+		jobs, err := m.Fetch(ctx)
+		if err != nil {
+			slog.Errorf(ctx, "%s fetch err: %v, queue: %s", fun, err, m.name)
+		}
+		for _, job := range jobs {
+			m.handle(ctx, job, fn)
+		}
+		if len(jobs) < m.opts.BatchSize {
+			sleepContext(ctx, m.opts.PollInterval)
+		}
+	}
+	slog.Infof(ctx, "%s stop queue: %s", fun, m.name)
+	return ctx.Err()
+}
+
+func (m *Queue) handle(ctx context.Context, job *Job, fn HandleFunc) {
+	fun := "Queue.handle -->"
+
+	jctx, span := job.context(ctx, m.name)
+	defer span.Finish()
+
+	err := fn(jctx, job)
+	if err == nil {
+		if err := job.CommitMsg(jctx); err != nil {
+			slog.Errorf(jctx, "%s commit err: %v, queue: %s, id: %s", fun, err, m.name, job.ID)
+		}
+		return
+	}
+
+	slog.Warnf(jctx, "%s handle err: %v, queue: %s, id: %s, attempts: %d", fun, err, m.name, job.ID, job.Attempts)
+	if job.Attempts >= m.opts.MaxAttempts {
+		if err := m.release(jctx, job.ID, m.deadKey(), time.Now()); err != nil {
+			slog.Errorf(jctx, "%s move to dead err: %v, queue: %s, id: %s", fun, err, m.name, job.ID)
+			return
+		}
+		slog.Errorf(jctx, "%s job moved to dead, queue: %s, id: %s", fun, m.name, job.ID)
+		return
+	}
+	if err := job.Retry(jctx, m.retryDelay(job.Attempts)); err != nil {
+		// NOTE: 重试失败时任务在可见性超时后重新投递
+		slog.Errorf(jctx, "%s retry err: %v, queue: %s, id: %s", fun, err, m.name, job.ID)
+	}
+}
+
+func (m *Queue) retryDelay(attempts int) time.Duration {
+	return time.Duration(attempts) * m.opts.RetryDelay
+}
+
+// Len 返回等待执行与已取出未确认的任务数
+func (m *Queue) Len(ctx context.Context) (delayed, reserved int64, err error) {
+	client, err := m.client(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	if delayed, err = client.ZCard(ctx, m.delayedKey()).Result(); err != nil {
+		return 0, 0, err
+	}
+	if reserved, err = client.ZCard(ctx, m.reservedKey()).Result(); err != nil {
+		return 0, 0, err
+	}
+	return delayed, reserved, nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
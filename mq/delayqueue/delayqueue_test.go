@@ -0,0 +1,57 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestNewQueue(t *testing.T) {
+	q := NewQueue("base/test", "jobs", nil)
+	assert.Equal(t, q.opts.VisibilityTimeout, defaultVisibilityTimeout)
+	assert.Equal(t, q.opts.MaxAttempts, defaultMaxAttempts)
+	assert.Equal(t, q.delayedKey(), "{jobs}.delayed")
+	assert.Equal(t, q.attemptsKey(), "{jobs}.attempts")
+	assert.Equal(t, q.retryDelay(2), 2*defaultRetryDelay)
+
+	q = NewQueue("base/test", "jobs", &Options{BatchSize: 5, RetryDelay: time.Second})
+	assert.Equal(t, q.opts.BatchSize, 5)
+	assert.Equal(t, q.opts.PollInterval, defaultPollInterval)
+	assert.Equal(t, q.retryDelay(3), 3*time.Second)
+}
+
+func TestParseJobs(t *testing.T) {
+	q := NewQueue("base/test", "jobs", nil)
+	body, err := newJobBody(context.TODO(), map[string]int{"id": 1})
+	assert.Equal(t, err, nil)
+
+	jobs, err := q.parseJobs([]interface{}{"a1", string(body), int64(2)})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(jobs), 1)
+	assert.Equal(t, jobs[0].ID, "a1")
+	assert.Equal(t, jobs[0].Attempts, 2)
+	var v struct {
+		ID int `json:"id"`
+	}
+	assert.Equal(t, jobs[0].Unmarshal(&v), nil)
+	assert.Equal(t, v.ID, 1)
+
+	jobs, err = q.parseJobs([]interface{}{})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(jobs), 0)
+
+	_, err = q.parseJobs([]interface{}{"a1"})
+	assert.NotEqual(t, err, nil)
+	_, err = q.parseJobs([]interface{}{"a1", "{", int64(1)})
+	assert.NotEqual(t, err, nil)
+}
+
+func TestNewJobID(t *testing.T) {
+	a, err := newJobID()
+	assert.Equal(t, err, nil)
+	b, _ := newJobID()
+	assert.Equal(t, len(a), 32)
+	assert.NotEqual(t, a, b)
+}
@@ -0,0 +1,402 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/shawnfeng/sutil/scontext"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 处理失败达到最大次数的消息写入死信 topic 后提交，死信 topic 通过配置项 dlq 指定，
+// 未配置时为原 topic 加 .__dlq 后缀，如 palfish.test.test.__dlq，使用原 topic 的配置
+const (
+	dlqTopicSuffix        = ".__dlq"
+	defaultDLQMaxAttempts = 3
+	consumeRetryInterval  = time.Second
+
+	spanLogKeyDLQTopic = "dlq"
+)
+
+// ConsumeMsg ConsumeByGroup 交给 ConsumeFunc 的消息
+type ConsumeMsg struct {
+	Topic     string
+	GroupID   string
+	Key       string    // 消息的 key，nsq 等没有 key 的后端为空
+	Partition int       // 消息所在的 partition，无法获取时为 -1
+	Attempts  int       // 当前是第几次处理，从 1 开始，包含之前投递时的失败次数
+	Time      time.Time // 消息写入的时间，后端无法获取时使用 Payload 中的写入时间，v1 的消息为零值
+	Offset    int64     // 消息在 partition 中的 offset，无法获取时为 -1
+
+	payload *Payload
+	// FilterField 解析的消息内容
+	decoded   map[string]json.RawMessage
+	decodeErr error
+
+	commit     func(ctx context.Context) error
+	commitOnce sync.Once
+	commitErr  error
+}
+
+// Commit 提交消息，ManualCommit 时由 ConsumeFunc 在消息处理完成后调用，可以在 ConsumeFunc 返回后异步调用，
+// 重复调用只提交一次；消息写入死信 topic 后会自动提交
+func (m *ConsumeMsg) Commit(ctx context.Context) error {
+	m.commitOnce.Do(func() {
+		m.commitErr = m.commit(ctx)
+	})
+	return m.commitErr
+}
+
+// size 消息内容的字节数，用于 ByteRateLimit
+func (m *ConsumeMsg) size() int {
+	if m.payload == nil {
+		return 0
+	}
+	return len(m.payload.Value)
+}
+
+// ContentType 消息内容的类型，如 application/json
+func (m *ConsumeMsg) ContentType() string {
+	if m.payload == nil {
+		return ""
+	}
+	return m.payload.contentType()
+}
+
+// Unmarshal 解析写入时的消息内容
+func (m *ConsumeMsg) Unmarshal(v interface{}) error {
+	return unmarshalPayloadValue(m.payload, v)
+}
+
+// ConsumeFunc 返回 error 表示处理失败
+type ConsumeFunc func(ctx context.Context, msg *ConsumeMsg) error
+
+type ConsumeOptions struct {
+	// 每次投递最多处理次数，<= 0 时使用 defaultDLQMaxAttempts
+	MaxAttempts int
+	// 第一次重试前的等待时间，之后每次翻倍，<= 0 时使用 defaultRetryBaseDelay
+	BaseDelay time.Duration
+	// 重试等待时间的上限，<= 0 时使用 defaultRetryMaxDelay
+	MaxDelay time.Duration
+	// 重试等待时间的随机浮动比例，取值 [0, 1]
+	Jitter float64
+	// 判断错误是否需要重试，为空时除 Permanent 包装的错误外都重试
+	Retryable func(err error) bool
+	// 死信 topic，为空时使用配置项 dlq 或默认的死信 topic
+	DLQTopic string
+	// 同时处理消息的 goroutine 数，<= 1 时逐条处理
+	Concurrency int
+	// Concurrency > 1 时相同 key 的消息按读取顺序依次处理，按 key 的 hash 交给固定的 goroutine，重试也在该 goroutine 中进行，
+	// 前一条消息处理成功或写入死信 topic 之前不会处理之后的消息，用于状态机等需要按实体顺序处理的场景；
+	// key 为空的消息没有顺序要求，轮流交给各 goroutine
+	KeyOrdered bool
+	// 为 true 时 ConsumeFunc 返回成功后不自动提交，需要调用 ConsumeMsg.Commit，
+	// 用于处理结果异步落地后再提交的场景；kafka 等按 offset 提交的后端，提交之后的消息会同时提交之前的消息，
+	// Concurrency > 1 时未提交的消息会阻塞之后消息的提交，未提交的消息数达到上限后停止读取
+	ManualCommit bool
+	// 处理前按顺序执行，任一返回 false 时丢弃消息并提交，不再执行之后的 filter 与 ConsumeFunc，见 filter.go
+	Filters []ConsumeFilter
+	// 在 UseConsumeInterceptors 注册的 interceptor 之内执行，见 interceptor.go
+	Interceptors []ConsumeInterceptor
+	// 每秒最多处理的消息数与消息内容的字节数，为零值时使用配置项 ratelimit 与 byteratelimit，都没有时不限制，见 ratelimit.go
+	RateLimit     float64
+	ByteRateLimit float64
+	// 处理失败达到 MaxAttempts 后的处理方式，默认写入死信 topic，见 poison.go
+	Poison PoisonPolicy
+	// partition 分配给当前 ConsumeByGroup 与 rebalance 收回时的回调，见 rebalance.go
+	OnPartitionsAssigned PartitionsFunc
+	OnPartitionsRevoked  PartitionsFunc
+	// 在结果所在的存储中记录消费位置，按 exactly-once 处理，见 checkpoint.go
+	Checkpoint CheckpointStore
+}
+
+func (m *ConsumeOptions) maxAttempts() int {
+	if m.MaxAttempts <= 0 {
+		return defaultDLQMaxAttempts
+	}
+	return m.MaxAttempts
+}
+
+// DLQMsg 死信 topic 中的消息，Payload 为原消息的 Payload，Payload.Retries 为累计的失败次数
+type DLQMsg struct {
+	Topic    string   `json:"topic"`
+	GroupID  string   `json:"groupid"`
+	Key      string   `json:"key,omitempty"` // 原消息的 key
+	Error    string   `json:"error"`
+	Attempts int      `json:"attempts"`  // 累计处理次数
+	FailedAt int64    `json:"failed_at"` // unix 毫秒
+	Payload  *Payload `json:"payload"`
+}
+
+// Unmarshal 解析原消息的内容
+func (m *DLQMsg) Unmarshal(v interface{}) error {
+	if m.Payload == nil {
+		return fmt.Errorf("dlq msg has no payload, topic: %s", m.Topic)
+	}
+	return unmarshalPayloadValue(m.Payload, v)
+}
+
+// SetValue 替换原消息的内容，按原 topic 的格式编码，用于重新投递前修正消息
+func (m *DLQMsg) SetValue(v interface{}) error {
+	if m.Payload == nil {
+		return fmt.Errorf("dlq msg has no payload, topic: %s", m.Topic)
+	}
+	m.Payload.Codec = ""
+	return marshalPayloadValue(m.Topic, m.Payload, v)
+}
+
+// RedeliverDLQMsg 把死信消息的原消息按原来的 key 重新写入原 topic，保留写入时的 trace 与 context 信息，累计的失败次数清零
+func RedeliverDLQMsg(ctx context.Context, msg *DLQMsg) error {
+	if msg.Payload == nil {
+		return fmt.Errorf("dlq msg has no payload, topic: %s", msg.Topic)
+	}
+	writer := getTopicWriter(ctx, msg.Topic)
+	if writer == nil {
+		return fmt.Errorf("getWriter err, topic: %s", msg.Topic)
+	}
+	payload := *msg.Payload
+	payload.Retries = 0
+	payload.format = topicPayloadFormat(msg.Topic)
+	return writer.WriteMsg(ctx, msg.Key, &payload)
+}
+
+// dlqBaseTopic 默认死信 topic 对应的原 topic，用于查找配置
+func dlqBaseTopic(topic string) string {
+	return strings.TrimSuffix(topic, dlqTopicSuffix)
+}
+
+// GetDLQTopic 返回 topic 的死信 topic
+func GetDLQTopic(ctx context.Context, topic string) string {
+	config, err := getReadWriteConfig(ctx, topic)
+	if err == nil && config.DLQTopic != "" {
+		return config.DLQTopic
+	}
+	return topic + dlqTopicSuffix
+}
+
+// ConsumeByGroup 循环读取 topic 的消息交给 fn 处理，直到 ctx 结束，
+// fn 失败时按指数退避重试，达到 MaxAttempts 或错误不可重试时将原消息与失败信息写入死信 topic 并提交，
+// 写入死信 topic 失败时一直重试，不会提交也不会丢弃消息，即 at-least-once，进程退出时未处理完的消息会重新投递；
+// Concurrency > 1 时由多个 goroutine 并发处理，见 consumeConcurrently；需要退出前处理完已读取的消息时使用 StartConsumer
+func ConsumeByGroup(ctx context.Context, topic, groupId string, fn ConsumeFunc, opts *ConsumeOptions) error {
+	return consumeByGroup(ctx, ctx, topic, groupId, fn, opts, nil)
+}
+
+// withConfigOptions Concurrency 与 MaxAttempts 为零值时使用配置项 concurrency 与 maxattempts，
+// 在开始消费时读取，配置变化后对新开始的 ConsumeByGroup 生效
+func withConfigOptions(ctx context.Context, topic string, opts *ConsumeOptions) *ConsumeOptions {
+	if opts.Concurrency != 0 && opts.MaxAttempts != 0 {
+		return opts
+	}
+	config, err := getReadWriteConfig(ctx, topic)
+	if err != nil {
+		return opts
+	}
+	o := *opts
+	if o.Concurrency == 0 {
+		o.Concurrency = config.Concurrency
+	}
+	if o.MaxAttempts == 0 {
+		o.MaxAttempts = config.MaxAttempts
+	}
+	return &o
+}
+
+// consumeByGroup fetchCtx 结束时停止读取，已读取的消息使用 handleCtx 处理与提交，handleCtx 结束时不再处理，
+// 暂停的 partition 的消息在 fetchCtx 结束后不再等待，也不会提交
+func consumeByGroup(fetchCtx, handleCtx context.Context, topic, groupId string, fn ConsumeFunc, opts *ConsumeOptions, pauser *consumePauser) error {
+	fun := "mq.ConsumeByGroup -->"
+
+	if opts == nil {
+		opts = &ConsumeOptions{}
+	}
+	opts = withConfigOptions(fetchCtx, topic, opts)
+	dlqTopic := opts.DLQTopic
+	if dlqTopic == "" {
+		dlqTopic = GetDLQTopic(fetchCtx, topic)
+	}
+
+	fn = interceptConsume(fn, opts.Interceptors)
+	fn, opts = withCheckpoint(fetchCtx, topic, groupId, fn, opts)
+	conf := newGroupReaderConf(fetchCtx, topic, groupId)
+	limiter := newConsumeLimiter(fetchCtx, topic, opts)
+	defer limiter.close()
+	tracker := newPartitionTracker(topic, opts)
+	defer tracker.revoke(handleCtx)
+	slog.Infof(fetchCtx, "%s start topic: %s, groupId: %s, dlq: %s, concurrency: %d", fun, topic, groupId, dlqTopic, opts.Concurrency)
+
+	if opts.Concurrency > 1 {
+		consumeConcurrently(fetchCtx, handleCtx, conf, dlqTopic, opts, fn, pauser, limiter, tracker)
+	} else {
+		drained := func() bool { return true }
+		for pauser.waitFetch(fetchCtx) {
+			msg, handler := fetchConsumeMsg(fetchCtx, conf)
+			if msg == nil {
+				continue
+			}
+			msg.commit = handler.CommitMsg
+			if !tracker.observe(handleCtx, conf, msg, drained) {
+				break
+			}
+			if !limiter.wait(fetchCtx, msg) || !pauser.waitPartition(fetchCtx, msg.Partition) || !consumeMsg(handleCtx, dlqTopic, opts, msg, fn) {
+				break
+			}
+
+			if opts.ManualCommit {
+				continue
+			}
+			if err := msg.Commit(handleCtx); err != nil {
+				slog.Errorf(handleCtx, "%s CommitMsg err: %v, topic: %s", fun, err, topic)
+			}
+		}
+	}
+	slog.Infof(fetchCtx, "%s stop topic: %s, groupId: %s", fun, topic, groupId)
+	return fetchCtx.Err()
+}
+
+func newGroupReaderConf(ctx context.Context, topic, groupId string) *instanceConf {
+	return &instanceConf{
+		group:     scontext.GetControlRouteGroupWithDefault(ctx, defaultRouteGroup),
+		role:      RoleTypeReader,
+		topic:     topic,
+		groupId:   groupId,
+		partition: 0,
+	}
+}
+
+// keyedHandler 由能够获取消息 key 的后端的 Handler 实现
+type keyedHandler interface {
+	msgKey() string
+}
+
+// partitionedHandler 由能够获取消息 partition 的后端的 Handler 实现
+type partitionedHandler interface {
+	msgPartition() int
+}
+
+// timedHandler 由能够获取消息写入时间的后端的 Handler 实现
+type timedHandler interface {
+	msgTime() time.Time
+}
+
+// offsetHandler 由能够获取消息 offset 的后端的 Handler 实现
+type offsetHandler interface {
+	msgOffset() int64
+}
+
+// fetchConsumeMsg 读取失败时等待 consumeRetryInterval 后返回 nil
+func fetchConsumeMsg(ctx context.Context, conf *instanceConf) (*ConsumeMsg, Handler) {
+	fun := "mq.fetchConsumeMsg -->"
+
+	reader := defaultInstanceManager.getReader(ctx, conf)
+	if reader == nil {
+		slog.Errorf(ctx, "%s getReader err, topic: %s", fun, conf.topic)
+		sleepContext(ctx, consumeRetryInterval)
+		return nil, nil
+	}
+
+	var payload Payload
+	handler, err := reader.FetchMsg(ctx, &payload, &payload)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Errorf(ctx, "%s FetchMsg err: %v, topic: %s", fun, err, conf.topic)
+			sleepContext(ctx, consumeRetryInterval)
+		}
+		return nil, nil
+	}
+
+	// 先取回 claim check 保存的内容，失败时保留引用，解析时再次取回
+	if err = resolveClaim(ctx, &payload); err != nil {
+		slog.Errorf(ctx, "%s resolveClaim err: %v, topic: %s", fun, err, conf.topic)
+	}
+
+	msg := &ConsumeMsg{
+		Topic:     conf.topic,
+		GroupID:   conf.groupId,
+		Partition: unknownPartition,
+		Offset:    unknownOffset,
+		payload:   &payload,
+	}
+	if h, ok := handler.(keyedHandler); ok {
+		msg.Key = h.msgKey()
+	}
+	if h, ok := handler.(partitionedHandler); ok {
+		msg.Partition = h.msgPartition()
+	}
+	if h, ok := handler.(timedHandler); ok {
+		msg.Time = h.msgTime()
+	}
+	if msg.Time.IsZero() {
+		msg.Time = payload.produceTime()
+	}
+	if h, ok := handler.(offsetHandler); ok {
+		msg.Offset = h.msgOffset()
+	}
+	return msg, handler
+}
+
+// consumeMsg 处理成功或写入死信 topic 后返回 true，ctx 结束时返回 false
+func consumeMsg(ctx context.Context, dlqTopic string, opts *ConsumeOptions, msg *ConsumeMsg, fn ConsumeFunc) bool {
+	fun := "mq.consumeMsg -->"
+	statConsumeLatency(msg, time.Now())
+
+	// NOTE: 每次处理都使用写入时的 trace 与 context 信息，Value 无法解析时交给 fn 处理
+	mctx, _ := parsePayload(msg.payload, "mq.ConsumeByGroup", &json.RawMessage{})
+	mspan := opentracing.SpanFromContext(mctx)
+	defer mspan.Finish()
+	mspan.LogFields(
+		log.String(spanLogKeyTopic, msg.Topic),
+		log.String(spanLogKeyKafkaGroupID, msg.GroupID))
+
+	if !opts.filter(mctx, msg) {
+		statConsumeFiltered(msg.Topic, msg.GroupID)
+		if err := msg.Commit(ctx); err != nil {
+			slog.Errorf(mctx, "%s CommitMsg err: %v, topic: %s", fun, err, msg.Topic)
+		}
+		return true
+	}
+
+	var err error
+	for i := 1; ; i++ {
+		msg.Attempts = msg.payload.Retries + 1
+		if err = callConsumeFunc(mctx, msg, fn); err == nil {
+			return true
+		}
+		msg.payload.Retries++
+		slog.Warnf(mctx, "%s handle err: %v, topic: %s, attempts: %d", fun, err, msg.Topic, msg.Attempts)
+
+		if i >= opts.maxAttempts() || !opts.retryable(err) {
+			break
+		}
+		if !sleepContext(ctx, opts.backoff(i)) {
+			return false
+		}
+	}
+
+	return handlePoison(ctx, mctx, mspan, dlqTopic, opts, msg, err)
+}
+
+// FetchDLQMsg 读取 topic 的死信消息用于排查或重新投递，需要手动调用 Handler.CommitMsg 提交
+func FetchDLQMsg(ctx context.Context, topic, groupId string) (context.Context, *DLQMsg, Handler, error) {
+	var msg DLQMsg
+	mctx, handler, err := FetchMsgByGroup(ctx, GetDLQTopic(ctx, topic), groupId, &msg)
+	if err != nil {
+		return mctx, nil, nil, err
+	}
+	return mctx, &msg, handler, nil
+}
+
+// CloseGroupReader 关闭 FetchMsgByGroup、FetchDLQMsg 等使用的 topic 与 group 的 reader，不再读取时调用
+func CloseGroupReader(ctx context.Context, topic, groupId string) error {
+	return defaultInstanceManager.remove(ctx, newGroupReaderConf(ctx, topic, groupId))
+}
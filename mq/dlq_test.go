@@ -0,0 +1,94 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestDLQBaseTopic(t *testing.T) {
+	assert.Equal(t, dlqBaseTopic(defaultTestTopic+dlqTopicSuffix), defaultTestTopic)
+	assert.Equal(t, dlqBaseTopic(defaultTestTopic), defaultTestTopic)
+	assert.Equal(t, GetDLQTopic(context.TODO(), defaultTestTopic), defaultTestTopic+dlqTopicSuffix)
+}
+
+func TestConsumeByGroupDLQ(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.consume"
+	err := WriteMsgs(context.TODO(), topic,
+		Message{Key: "k1", Value: &memoryTestMsg{ID: 1, Name: "bad"}},
+		Message{Key: "k2", Value: &memoryTestMsg{ID: 2, Name: "good"}})
+	assert.Equal(t, err, nil)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var mu sync.Mutex
+	attempts := map[int]int{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ConsumeByGroup(ctx, topic, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+			var v memoryTestMsg
+			if err := msg.Unmarshal(&v); err != nil {
+				return err
+			}
+			mu.Lock()
+			attempts[v.ID]++
+			mu.Unlock()
+			if v.Name == "bad" {
+				return errors.New("bad msg")
+			}
+			cancel()
+			return nil
+		}, &ConsumeOptions{MaxAttempts: 2})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("consume timeout")
+	}
+	assert.Equal(t, attempts[1], 2)
+	assert.Equal(t, attempts[2], 1)
+
+	rctx, rcancel := context.WithTimeout(context.TODO(), 2*time.Second)
+	defer rcancel()
+	_, msg, handler, err := FetchDLQMsg(rctx, topic, "inspect")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, msg.Topic, topic)
+	assert.Equal(t, msg.GroupID, "g1")
+	assert.Equal(t, msg.Attempts, 2)
+	assert.Equal(t, msg.Error, "bad msg")
+	assert.Equal(t, handler.CommitMsg(rctx), nil)
+
+	var v memoryTestMsg
+	assert.Equal(t, msg.Unmarshal(&v), nil)
+	assert.Equal(t, v.ID, 1)
+	assert.Equal(t, MemoryTopicLen(topic+dlqTopicSuffix), 1)
+	assert.Equal(t, msg.Key, "k1")
+
+	assert.Equal(t, msg.SetValue(&memoryTestMsg{ID: 1, Name: "fixed"}), nil)
+	assert.Equal(t, RedeliverDLQMsg(rctx, msg), nil)
+	assert.Equal(t, msg.Payload.Retries, 2)
+	assert.Equal(t, MemoryTopicLen(topic), 3)
+	assert.Equal(t, CloseGroupReader(rctx, GetDLQTopic(rctx, topic), "inspect"), nil)
+}
+
+func TestConsumeMsgCommit(t *testing.T) {
+	var commits int
+	msg := &ConsumeMsg{
+		commit: func(ctx context.Context) error {
+			commits++
+			return errors.New("commit err")
+		},
+	}
+	assert.Equal(t, msg.Commit(context.TODO()).Error(), "commit err")
+	assert.Equal(t, msg.Commit(context.TODO()).Error(), "commit err")
+	assert.Equal(t, commits, 1)
+}
@@ -0,0 +1,187 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dlqreplay 故障恢复后把死信 topic 中的消息重新投递到原 topic，如
+//
+//	res, err := dlqreplay.Run(ctx, "palfish.test.test", &dlqreplay.Options{
+//		Filter:    func(ctx context.Context, msg *mq.DLQMsg) bool { return strings.Contains(msg.Error, "timeout") },
+//		RateLimit: 100,
+//		DryRun:    true,
+//	})
+//
+// 使用单独的 group 逐条读取死信消息，经过 Filter 与 Transform 后写入原 topic 再提交，
+// 被 Filter 丢弃的消息同样提交，之后不会再次读取；写入失败时停止并返回错误，未提交的消息下次 Run 时重新读取，
+// 写入成功但提交失败时消息会再次投递，即 at-least-once
+package dlqreplay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shawnfeng/sutil/mq"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+const (
+	defaultGroupID     = "dlqreplay"
+	defaultIdleTimeout = 10 * time.Second
+)
+
+// Options 为空或字段为零值时使用默认值
+type Options struct {
+	// 读取死信 topic 使用的 group，为空时使用 defaultGroupID，提交的位置在多次 Run 之间保留
+	GroupID string
+	// 返回 false 时不重新投递，为空时全部重新投递
+	Filter func(ctx context.Context, msg *mq.DLQMsg) bool
+	// 重新投递前修改消息，如通过 DLQMsg.SetValue 修正内容，返回错误时停止
+	Transform func(ctx context.Context, msg *mq.DLQMsg) error
+	// 每秒最多重新投递的消息数，<= 0 时不限制
+	RateLimit float64
+	// 为 true 时只读取、过滤与转换并打印日志，不写入原 topic 也不提交
+	DryRun bool
+	// 超过该时间没有读取到消息时结束，<= 0 时使用 defaultIdleTimeout
+	IdleTimeout time.Duration
+	// 最多读取的消息数，<= 0 时不限制
+	Limit int
+}
+
+// Result Run 处理的消息数，DryRun 时 Redelivered 为需要重新投递的消息数
+type Result struct {
+	Read        int
+	Filtered    int
+	Redelivered int
+}
+
+type replayer struct {
+	topic string
+	opts  Options
+
+	// 测试时替换
+	fetch     func(ctx context.Context, topic, groupId string) (context.Context, *mq.DLQMsg, mq.Handler, error)
+	redeliver func(ctx context.Context, msg *mq.DLQMsg) error
+}
+
+func newReplayer(topic string, opts *Options) *replayer {
+	m := &replayer{
+		topic:     topic,
+		fetch:     mq.FetchDLQMsg,
+		redeliver: mq.RedeliverDLQMsg,
+	}
+	if opts != nil {
+		m.opts = *opts
+	}
+	if m.opts.GroupID == "" {
+		m.opts.GroupID = defaultGroupID
+	}
+	if m.opts.IdleTimeout <= 0 {
+		m.opts.IdleTimeout = defaultIdleTimeout
+	}
+	return m
+}
+
+// interval 两次重新投递之间的最小间隔
+func (m *replayer) interval() time.Duration {
+	if m.opts.RateLimit <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / m.opts.RateLimit)
+}
+
+// Run 读取 topic 的死信 topic 直到 IdleTimeout 内没有新消息、达到 Limit 或 ctx 结束，
+// 把消息重新投递到原 topic，返回处理的消息数，结束时关闭 reader
+func Run(ctx context.Context, topic string, opts *Options) (*Result, error) {
+	m := newReplayer(topic, opts)
+	defer func() {
+		if err := mq.CloseGroupReader(ctx, mq.GetDLQTopic(ctx, topic), m.opts.GroupID); err != nil {
+			slog.Warnf(ctx, "dlqreplay.Run --> close reader err: %v, topic: %s", err, topic)
+		}
+	}()
+	return m.run(ctx)
+}
+
+func (m *replayer) run(ctx context.Context) (*Result, error) {
+	fun := "dlqreplay.Run -->"
+	slog.Infof(ctx, "%s start topic: %s, groupId: %s, dryrun: %v", fun, m.topic, m.opts.GroupID, m.opts.DryRun)
+
+	res := &Result{}
+	var last time.Time
+	for m.opts.Limit <= 0 || res.Read < m.opts.Limit {
+		fetchCtx, cancel := context.WithTimeout(ctx, m.opts.IdleTimeout)
+		mctx, msg, handler, err := m.fetch(fetchCtx, m.topic, m.opts.GroupID)
+		idle := errors.Is(fetchCtx.Err(), context.DeadlineExceeded)
+		cancel()
+
+		if ctx.Err() != nil {
+			return res, ctx.Err()
+		}
+		if err != nil {
+			if idle {
+				break
+			}
+			slog.Errorf(ctx, "%s fetch err: %v, topic: %s", fun, err, m.topic)
+			return res, err
+		}
+		res.Read++
+
+		if m.opts.Filter != nil && !m.opts.Filter(mctx, msg) {
+			res.Filtered++
+			if err = m.commit(mctx, handler); err != nil {
+				return res, err
+			}
+			continue
+		}
+		if m.opts.Transform != nil {
+			if err = m.opts.Transform(mctx, msg); err != nil {
+				slog.Errorf(mctx, "%s transform err: %v, topic: %s, key: %s", fun, err, msg.Topic, msg.Key)
+				return res, fmt.Errorf("%s transform err: %v, topic: %s", fun, err, msg.Topic)
+			}
+		}
+
+		if m.opts.DryRun {
+			slog.Infof(mctx, "%s dryrun redeliver topic: %s, key: %s, groupId: %s, attempts: %d, err: %s",
+				fun, msg.Topic, msg.Key, msg.GroupID, msg.Attempts, msg.Error)
+			res.Redelivered++
+			continue
+		}
+
+		if d := m.interval() - time.Since(last); d > 0 && !sleepContext(ctx, d) {
+			return res, ctx.Err()
+		}
+		last = time.Now()
+		if err = m.redeliver(mctx, msg); err != nil {
+			slog.Errorf(mctx, "%s redeliver err: %v, topic: %s, key: %s", fun, err, msg.Topic, msg.Key)
+			return res, err
+		}
+		res.Redelivered++
+		if err = m.commit(mctx, handler); err != nil {
+			return res, err
+		}
+	}
+	slog.Infof(ctx, "%s done topic: %s, read: %d, filtered: %d, redelivered: %d", fun, m.topic, res.Read, res.Filtered, res.Redelivered)
+	return res, nil
+}
+
+func (m *replayer) commit(ctx context.Context, handler mq.Handler) error {
+	if m.opts.DryRun {
+		return nil
+	}
+	if err := handler.CommitMsg(ctx); err != nil {
+		slog.Errorf(ctx, "dlqreplay.Run --> CommitMsg err: %v, topic: %s", err, m.topic)
+		return err
+	}
+	return nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,106 @@
+package dlqreplay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+	"github.com/shawnfeng/sutil/mq"
+)
+
+type testHandler struct {
+	commits *int
+}
+
+func (m testHandler) CommitMsg(ctx context.Context) error {
+	*m.commits++
+	return nil
+}
+
+// newTestReplayer 依次读取 msgs，读完后阻塞到 ctx 结束
+func newTestReplayer(opts *Options, msgs ...*mq.DLQMsg) (*replayer, *int, *[]*mq.DLQMsg) {
+	commits := 0
+	var redelivered []*mq.DLQMsg
+	m := newReplayer("palfish.test.test", opts)
+	m.fetch = func(ctx context.Context, topic, groupId string) (context.Context, *mq.DLQMsg, mq.Handler, error) {
+		if len(msgs) == 0 {
+			<-ctx.Done()
+			return ctx, nil, nil, ctx.Err()
+		}
+		msg := msgs[0]
+		msgs = msgs[1:]
+		return ctx, msg, testHandler{commits: &commits}, nil
+	}
+	m.redeliver = func(ctx context.Context, msg *mq.DLQMsg) error {
+		redelivered = append(redelivered, msg)
+		return nil
+	}
+	return m, &commits, &redelivered
+}
+
+func TestNewReplayer(t *testing.T) {
+	m := newReplayer("a", nil)
+	assert.Equal(t, m.opts.GroupID, defaultGroupID)
+	assert.Equal(t, m.opts.IdleTimeout, defaultIdleTimeout)
+	assert.Equal(t, m.interval(), time.Duration(0))
+
+	m = newReplayer("a", &Options{GroupID: "g1", RateLimit: 100})
+	assert.Equal(t, m.opts.GroupID, "g1")
+	assert.Equal(t, m.interval(), 10*time.Millisecond)
+}
+
+func TestRun(t *testing.T) {
+	msgs := []*mq.DLQMsg{
+		{Topic: "palfish.test.test", Key: "k1", Error: "timeout"},
+		{Topic: "palfish.test.test", Key: "k2", Error: "bad msg"},
+		{Topic: "palfish.test.test", Key: "k3", Error: "timeout"},
+	}
+	opts := &Options{
+		IdleTimeout: 50 * time.Millisecond,
+		Filter: func(ctx context.Context, msg *mq.DLQMsg) bool {
+			return msg.Error == "timeout"
+		},
+		Transform: func(ctx context.Context, msg *mq.DLQMsg) error {
+			msg.Key += ".fixed"
+			return nil
+		},
+	}
+
+	m, commits, redelivered := newTestReplayer(opts, msgs...)
+	res, err := m.run(context.TODO())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, *res, Result{Read: 3, Filtered: 1, Redelivered: 2})
+	assert.Equal(t, *commits, 3)
+	assert.Equal(t, len(*redelivered), 2)
+	assert.Equal(t, (*redelivered)[1].Key, "k3.fixed")
+
+	// DryRun 不写入也不提交
+	opts.DryRun = true
+	opts.Transform = nil
+	m, commits, redelivered = newTestReplayer(opts, msgs...)
+	res, err = m.run(context.TODO())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, *res, Result{Read: 3, Filtered: 1, Redelivered: 2})
+	assert.Equal(t, *commits, 0)
+	assert.Equal(t, len(*redelivered), 0)
+
+	// Limit
+	m, _, _ = newTestReplayer(&Options{Limit: 2}, msgs...)
+	res, err = m.run(context.TODO())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, res.Read, 2)
+}
+
+func TestRunRedeliverErr(t *testing.T) {
+	m, commits, _ := newTestReplayer(&Options{IdleTimeout: 50 * time.Millisecond}, &mq.DLQMsg{Key: "k1"}, &mq.DLQMsg{Key: "k2"})
+	m.redeliver = func(ctx context.Context, msg *mq.DLQMsg) error {
+		return errors.New("write err")
+	}
+	res, err := m.run(context.TODO())
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, res.Read, 1)
+	assert.Equal(t, res.Redelivered, 0)
+	assert.Equal(t, *commits, 0)
+}
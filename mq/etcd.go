@@ -0,0 +1,202 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/client"
+	"github.com/shawnfeng/sutil/sconf/center"
+	"github.com/shawnfeng/sutil/scontext"
+	"github.com/shawnfeng/sutil/setcd"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+const (
+	// 每个 topic 在每个 group 下每种 mq 的配置为一个节点：/roc/mq/{topic}/{group}/{mqtype}，
+	// 值为 json，字段名与 apollo 配置项一致，如 {"brokers": "127.0.0.1:9092", "batchsize": 100}
+	etcdConfigPrefix = "/roc/mq"
+	etcdPathSep      = "/"
+
+	etcdInitTimeout = 5 * time.Second
+)
+
+var defaultEtcdAddrs = []string{"http://infra0.etcd.ibanyu.com:20002", "http://infra1.etcd.ibanyu.com:20002", "http://infra2.etcd.ibanyu.com:20002", "http://infra3.etcd.ibanyu.com:20002", "http://infra4.etcd.ibanyu.com:20002", "http://old0.etcd.ibanyu.com:20002", "http://old1.etcd.ibanyu.com:20002", "http://old2.etcd.ibanyu.com:20002"}
+
+type EtcdConfig struct {
+	etcdAddr []string
+	ch       chan *center.ChangeEvent
+
+	mu    sync.RWMutex
+	nodes map[string]string
+}
+
+func NewEtcdConfiger() *EtcdConfig {
+	return &EtcdConfig{
+		etcdAddr: defaultEtcdAddrs,
+		ch:       make(chan *center.ChangeEvent, 1),
+	}
+}
+
+// Init 建立对配置前缀的 watch，等待第一次读取完成，之后的变化通过 Watch 返回的 channel 通知
+func (m *EtcdConfig) Init(ctx context.Context) error {
+	fun := "EtcdConfig.Init-->"
+	slog.Infof(ctx, "%s start", fun)
+
+	etcdInstance, err := setcd.NewEtcdInstance(m.etcdAddr)
+	if err != nil {
+		slog.Errorf(ctx, "%s create etcd instance err:%v", fun, err)
+		return err
+	}
+
+	initCh := make(chan struct{}, 1)
+	var initOnce sync.Once
+	etcdInstance.Watch(ctx, etcdConfigPrefix, func(response *client.Response) {
+		nodes := map[string]string{}
+		flattenEtcdNode(response.Node, nodes)
+
+		if ce := m.setNodes(nodes); ce != nil && len(ce.Changes) > 0 {
+			m.ch <- ce
+		}
+
+		initOnce.Do(func() {
+			initCh <- struct{}{}
+		})
+	})
+
+	select {
+	case <-initCh:
+		return nil
+	case <-time.After(etcdInitTimeout):
+		return fmt.Errorf("%s wait etcd config timeout, path:%s", fun, etcdConfigPrefix)
+	}
+}
+
+func flattenEtcdNode(node *client.Node, nodes map[string]string) {
+	if node == nil {
+		return
+	}
+	if !node.Dir {
+		nodes[node.Key] = node.Value
+		return
+	}
+	for _, n := range node.Nodes {
+		flattenEtcdNode(n, nodes)
+	}
+}
+
+// setNodes 替换配置快照，返回与旧快照的差异，第一次载入时返回 nil
+func (m *EtcdConfig) setNodes(nodes map[string]string) *center.ChangeEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.nodes
+	m.nodes = nodes
+	if old == nil {
+		return nil
+	}
+
+	changes := map[string]*center.Change{}
+	for k, v := range nodes {
+		ov, ok := old[k]
+		if !ok {
+			changes[k] = &center.Change{NewValue: v, ChangeType: center.ADD}
+		} else if ov != v {
+			changes[k] = &center.Change{OldValue: ov, NewValue: v, ChangeType: center.MODIFY}
+		}
+	}
+	for k, ov := range old {
+		if _, ok := nodes[k]; !ok {
+			changes[k] = &center.Change{OldValue: ov, ChangeType: center.DELETE}
+		}
+	}
+
+	return &center.ChangeEvent{
+		Source:    center.Etcd,
+		Namespace: etcdConfigPrefix,
+		Changes:   changes,
+	}
+}
+
+func (m *EtcdConfig) buildKey(topic, group string, mqType MQType) string {
+	return strings.Join([]string{etcdConfigPrefix, topic, group, fmt.Sprint(mqType)}, etcdPathSep)
+}
+
+// getItems 返回节点中的配置项，数字与布尔值转换为字符串，与 apollo 的配置项一致
+func (m *EtcdConfig) getItems(key string) (map[string]string, bool, error) {
+	m.mu.RLock()
+	val, ok := m.nodes[key]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(val), &raw); err != nil {
+		return nil, true, err
+	}
+	items := make(map[string]string, len(raw))
+	for k, v := range raw {
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			items[k] = s
+		} else {
+			items[k] = string(v)
+		}
+	}
+	return items, true, nil
+}
+
+func (m *EtcdConfig) GetConfig(ctx context.Context, topic string, mqType MQType) (*Config, error) {
+	fun := "EtcdConfig.GetConfig-->"
+	slog.Infof(ctx, "%s get etcd config topic:%s", fun, topic)
+
+	group := scontext.GetControlRouteGroupWithDefault(ctx, defaultRouteGroup)
+	items, ok, err := m.getItems(m.buildKey(topic, group, mqType))
+	if err == nil && !ok {
+		items, ok, err = m.getItems(m.buildKey(topic, defaultRouteGroup, mqType))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s unmarshal config topic:%s err:%v", fun, topic, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s no config found, topic:%s group:%s", fun, topic, group)
+	}
+
+	return buildConfig(ctx, fun, topic, mqType, func(name string) (string, bool) {
+		val, ok := items[name]
+		return val, ok
+	})
+}
+
+// ParseKey key 格式为 /roc/mq/{topic}/{group}/{mqtype}
+func (m *EtcdConfig) ParseKey(ctx context.Context, key string) (*KeyParts, error) {
+	fun := "EtcdConfig.ParseKey-->"
+	if !strings.HasPrefix(key, etcdConfigPrefix+etcdPathSep) {
+		return nil, fmt.Errorf("%s invalid key:%s", fun, key)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(key, etcdConfigPrefix+etcdPathSep), etcdPathSep)
+	numParts := len(parts)
+	if numParts < 3 {
+		return nil, fmt.Errorf("%s invalid key:%s", fun, key)
+	}
+
+	return &KeyParts{
+		Topic: strings.Join(parts[:numParts-2], etcdPathSep),
+		Group: parts[numParts-2],
+	}, nil
+}
+
+func (m *EtcdConfig) Watch(ctx context.Context) <-chan *center.ChangeEvent {
+	fun := "EtcdConfig.Watch-->"
+	slog.Infof(ctx, "%s start", fun)
+	return m.ch
+}
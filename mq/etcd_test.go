@@ -0,0 +1,89 @@
+package mq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/client"
+	"github.com/kaneshin/go-pkg/testing/assert"
+	"github.com/shawnfeng/sutil/sconf/center"
+)
+
+func TestEtcdConfig_ParseKey(t *testing.T) {
+	m := &EtcdConfig{}
+	parts, err := m.ParseKey(context.TODO(), "/roc/mq/palfish.test/default/kafka")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, parts, &KeyParts{Topic: "palfish.test", Group: "default"})
+
+	_, err = m.ParseKey(context.TODO(), "/roc/mq/default/kafka")
+	assert.NotEqual(t, err, nil)
+	_, err = m.ParseKey(context.TODO(), "/roc/cache/redis/base/test/default")
+	assert.NotEqual(t, err, nil)
+}
+
+func TestEtcdConfig_GetConfig(t *testing.T) {
+	m := &EtcdConfig{}
+	nodes := map[string]string{}
+	flattenEtcdNode(&client.Node{
+		Key: "/roc/mq",
+		Dir: true,
+		Nodes: client.Nodes{
+			{Key: "/roc/mq/palfish.test", Dir: true, Nodes: client.Nodes{
+				{Key: "/roc/mq/palfish.test/default", Dir: true, Nodes: client.Nodes{
+					{Key: "/roc/mq/palfish.test/default/kafka", Value: `{"brokers":"k1:9092,k2:9092","batchsize":100,"headercarrier":true,"concurrency":4,"idempotent":true,"transactionalid":"orders"}`},
+				}},
+			}},
+		},
+	}, nodes)
+	assert.Equal(t, len(nodes), 1)
+	assert.Equal(t, m.setNodes(nodes), (*center.ChangeEvent)(nil))
+
+	config, err := m.GetConfig(context.TODO(), "palfish.test", MQTypeKafka)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, config.MQAddr, []string{"k1:9092", "k2:9092"})
+	assert.Equal(t, config.BatchSize, 100)
+	assert.Equal(t, config.HeaderCarrier, true)
+	assert.Equal(t, config.Concurrency, 4)
+	assert.Equal(t, config.Idempotent, true)
+	assert.Equal(t, config.TxnID, "orders")
+
+	_, err = m.GetConfig(context.TODO(), "palfish.test", MQTypePulsar)
+	assert.NotEqual(t, err, nil)
+
+	ce := m.setNodes(map[string]string{
+		"/roc/mq/palfish.test/default/kafka": `{"brokers":"k3:9092"}`,
+		"/roc/mq/palfish.new/default/redis":  `{"brokers":"base/mq"}`,
+	})
+	assert.Equal(t, ce.Changes["/roc/mq/palfish.test/default/kafka"].ChangeType, center.MODIFY)
+	assert.Equal(t, ce.Changes["/roc/mq/palfish.new/default/redis"].ChangeType, center.ADD)
+}
+
+func TestInstanceManager_reload(t *testing.T) {
+	etcdConfig := &EtcdConfig{}
+	etcdConfig.setNodes(map[string]string{
+		"/roc/mq/palfish.test.reload/default/kafka": `{"brokers":"k1:9092"}`,
+	})
+	old, oldDelay := DefaultConfiger, instanceCloseDelay
+	DefaultConfiger, instanceCloseDelay = etcdConfig, time.Millisecond
+	defer func() {
+		DefaultConfiger, instanceCloseDelay = old, oldDelay
+	}()
+
+	ctx := context.TODO()
+	m := NewInstanceManager()
+	conf := &instanceConf{group: defaultRouteGroup, role: RoleTypeWriter, topic: "palfish.test.reload"}
+	writer := m.getWriter(ctx, conf)
+	assert.NotEqual(t, writer, nil)
+
+	// 修改配置后替换为新实例
+	m.applyChangeEvent(ctx, etcdConfig.setNodes(map[string]string{
+		"/roc/mq/palfish.test.reload/default/kafka": `{"brokers":"k2:9092"}`,
+	}))
+	reloaded := m.getWriter(ctx, conf)
+	assert.True(t, reloaded != writer)
+
+	// 配置删除后新实例无法创建，保留旧实例
+	m.applyChangeEvent(ctx, etcdConfig.setNodes(map[string]string{}))
+	assert.True(t, m.getWriter(ctx, conf) == reloaded)
+}
@@ -0,0 +1,95 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// Subscription FanOut 中的一个订阅，不同 GroupID 的订阅各自消费 topic 的全部消息
+type Subscription struct {
+	GroupID string
+	Fn      ConsumeFunc
+	// 与 ConsumeByGroup 的 opts 相同，为 nil 时使用默认值
+	Opts *ConsumeOptions
+}
+
+// FanOut 同一进程内对一个 topic 的多个订阅，如一个事件同时用于更新缓存与发送通知，
+// 每个订阅在后台执行自己的 Consumer，Close 时一起停止
+type FanOut struct {
+	topic     string
+	consumers map[string]*Consumer
+	groupIds  []string
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// StartFanOut 订阅的 GroupID 为空或重复时返回错误，不启动任何订阅；ctx 结束时所有订阅直接停止
+func StartFanOut(ctx context.Context, topic string, subs ...Subscription) (*FanOut, error) {
+	fun := "mq.StartFanOut -->"
+
+	if len(subs) == 0 {
+		return nil, fmt.Errorf("%s no subscription, topic: %s", fun, topic)
+	}
+	for i, sub := range subs {
+		if sub.GroupID == "" || sub.Fn == nil {
+			return nil, fmt.Errorf("%s invalid subscription %d, topic: %s, groupId: %s", fun, i, topic, sub.GroupID)
+		}
+		for _, prev := range subs[:i] {
+			if prev.GroupID == sub.GroupID {
+				return nil, fmt.Errorf("%s duplicate groupId: %s, topic: %s", fun, sub.GroupID, topic)
+			}
+		}
+	}
+
+	m := &FanOut{
+		topic:     topic,
+		consumers: make(map[string]*Consumer, len(subs)),
+	}
+	for _, sub := range subs {
+		m.consumers[sub.GroupID] = StartConsumer(ctx, topic, sub.GroupID, sub.Fn, sub.Opts)
+		m.groupIds = append(m.groupIds, sub.GroupID)
+	}
+	slog.Infof(ctx, "%s started topic: %s, groupIds: %v", fun, topic, m.groupIds)
+	return m, nil
+}
+
+// Consumer 返回 groupId 对应订阅的 Consumer，用于单独暂停等，不存在时返回 nil
+func (m *FanOut) Consumer(groupId string) *Consumer {
+	return m.consumers[groupId]
+}
+
+// Close 同时关闭所有订阅，共用 ctx 的超时，返回第一个订阅的错误，重复调用返回第一次的结果
+func (m *FanOut) Close(ctx context.Context) error {
+	m.closeOnce.Do(func() {
+		m.closeErr = m.close(ctx)
+	})
+	return m.closeErr
+}
+
+func (m *FanOut) close(ctx context.Context) error {
+	errs := make([]error, len(m.groupIds))
+	var wg sync.WaitGroup
+	for i, groupId := range m.groupIds {
+		wg.Add(1)
+		go func(i int, consumer *Consumer) {
+			defer wg.Done()
+			errs[i] = consumer.Close(ctx)
+		}(i, m.consumers[groupId])
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package mq
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestStartFanOut(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.fanout"
+	assert.Equal(t, WriteMsg(context.TODO(), topic, "k1", &memoryTestMsg{ID: 1}), nil)
+
+	var mu sync.Mutex
+	handled := map[string]int{}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	handler := func(ctx context.Context, msg *ConsumeMsg) error {
+		mu.Lock()
+		handled[msg.GroupID]++
+		mu.Unlock()
+		wg.Done()
+		return nil
+	}
+	fanout, err := StartFanOut(context.TODO(), topic,
+		Subscription{GroupID: "cache", Fn: handler},
+		Subscription{GroupID: "notify", Fn: handler, Opts: &ConsumeOptions{Concurrency: 2}})
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, fanout.Consumer("cache"), nil)
+	assert.Equal(t, fanout.Consumer("unknown") == nil, true)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("consume timeout")
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	assert.Equal(t, fanout.Close(ctx), nil)
+	assert.Equal(t, fanout.Close(ctx), nil)
+	assert.Equal(t, handled, map[string]int{"cache": 1, "notify": 1})
+}
+
+func TestStartFanOutInvalid(t *testing.T) {
+	fn := func(ctx context.Context, msg *ConsumeMsg) error { return nil }
+	_, err := StartFanOut(context.TODO(), defaultTestTopic)
+	assert.NotEqual(t, err, nil)
+	_, err = StartFanOut(context.TODO(), defaultTestTopic, Subscription{GroupID: "g1"})
+	assert.NotEqual(t, err, nil)
+	_, err = StartFanOut(context.TODO(), defaultTestTopic, Subscription{GroupID: "g1", Fn: fn}, Subscription{GroupID: "g1", Fn: fn})
+	assert.NotEqual(t, err, nil)
+}
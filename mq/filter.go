@@ -0,0 +1,84 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// ConsumeFilter 返回 false 时丢弃消息，用于多种事件共用一个 topic 时只处理其中一部分，如
+//
+//	opts := &mq.ConsumeOptions{
+//		Filters: []mq.ConsumeFilter{mq.FilterField("type", "order_created", "order_paid")},
+//	}
+type ConsumeFilter func(ctx context.Context, msg *ConsumeMsg) bool
+
+func (m *ConsumeOptions) filter(ctx context.Context, msg *ConsumeMsg) bool {
+	for _, f := range m.Filters {
+		if !f(ctx, msg) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterKey 只保留 key 匹配 re 的消息
+func FilterKey(re *regexp.Regexp) ConsumeFilter {
+	return func(ctx context.Context, msg *ConsumeMsg) bool {
+		return re.MatchString(msg.Key)
+	}
+}
+
+// FilterHead 只保留写入时 context 中的 head 字段 field 为 values 之一的消息
+func FilterHead(field string, values ...string) ConsumeFilter {
+	return func(ctx context.Context, msg *ConsumeMsg) bool {
+		head, ok := msg.payload.Head.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		v, ok := head[field]
+		return ok && containsString(values, fmt.Sprint(v))
+	}
+}
+
+// FilterField 只保留消息内容的顶层字段 field 为 values 之一的消息，字段值不是字符串时按 json 编码比较，如数字 1 为 "1"；
+// 消息内容无法解析为 json object 时保留，交给 ConsumeFunc 处理
+func FilterField(field string, values ...string) ConsumeFilter {
+	return func(ctx context.Context, msg *ConsumeMsg) bool {
+		fields, err := msg.fields()
+		if err != nil {
+			return true
+		}
+		raw, ok := fields[field]
+		if !ok {
+			return false
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			s = string(raw)
+		}
+		return containsString(values, s)
+	}
+}
+
+// fields 多个 filter 共用解析结果
+func (m *ConsumeMsg) fields() (map[string]json.RawMessage, error) {
+	if m.decoded == nil && m.decodeErr == nil {
+		m.decodeErr = m.Unmarshal(&m.decoded)
+	}
+	return m.decoded, m.decodeErr
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
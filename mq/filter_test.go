@@ -0,0 +1,86 @@
+package mq
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestConsumeFilters(t *testing.T) {
+	msg := &ConsumeMsg{
+		Key: "order_1001",
+		payload: &Payload{
+			Value: `{"type":"order_created","id":1001}`,
+			Head:  map[string]interface{}{"source": "app", "uid": float64(1)},
+		},
+	}
+	ctx := context.TODO()
+
+	assert.Equal(t, FilterKey(regexp.MustCompile(`^order_`))(ctx, msg), true)
+	assert.Equal(t, FilterKey(regexp.MustCompile(`^user_`))(ctx, msg), false)
+
+	assert.Equal(t, FilterHead("source", "web", "app")(ctx, msg), true)
+	assert.Equal(t, FilterHead("uid", "1")(ctx, msg), true)
+	assert.Equal(t, FilterHead("source", "web")(ctx, msg), false)
+	assert.Equal(t, FilterHead("missing", "")(ctx, msg), false)
+
+	assert.Equal(t, FilterField("type", "order_created")(ctx, msg), true)
+	assert.Equal(t, FilterField("id", "1001")(ctx, msg), true)
+	assert.Equal(t, FilterField("type", "order_paid")(ctx, msg), false)
+	assert.Equal(t, FilterField("missing", "")(ctx, msg), false)
+
+	// 无法解析时交给 ConsumeFunc 处理
+	raw := &ConsumeMsg{payload: &Payload{Value: `"text"`}}
+	assert.Equal(t, FilterField("type", "order_created")(ctx, raw), true)
+
+	opts := &ConsumeOptions{Filters: []ConsumeFilter{
+		FilterKey(regexp.MustCompile(`^order_`)),
+		FilterField("type", "order_paid"),
+	}}
+	assert.Equal(t, opts.filter(ctx, msg), false)
+	assert.Equal(t, (&ConsumeOptions{}).filter(ctx, msg), true)
+}
+
+type filterTestMsg struct {
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+}
+
+func TestConsumeByGroupFilters(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.filter"
+	for i, typ := range []string{"a", "b", "a", "c", "a"} {
+		assert.Equal(t, WriteMsg(context.TODO(), topic, "", &filterTestMsg{Type: typ, ID: i}), nil)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var ids []int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ConsumeByGroup(ctx, topic, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+			var v filterTestMsg
+			if err := msg.Unmarshal(&v); err != nil {
+				return err
+			}
+			ids = append(ids, v.ID)
+			if v.ID == 4 {
+				cancel()
+			}
+			return nil
+		}, &ConsumeOptions{Filters: []ConsumeFilter{FilterField("type", "a")}})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("consume timeout")
+	}
+	assert.Equal(t, ids, []int{0, 2, 4})
+}
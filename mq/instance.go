@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/shawnfeng/sutil/sconf/center"
 	"github.com/shawnfeng/sutil/slog/slog"
@@ -19,6 +20,9 @@ import (
 
 var defaultInstanceManager = NewInstanceManager()
 
+// instanceCloseDelay 配置变化替换实例后，旧实例延迟关闭的时间
+var instanceCloseDelay = 5 * time.Second
+
 type MQRoleType int
 
 const (
@@ -202,17 +206,15 @@ func (m *InstanceManager) applyChange(ctx context.Context, k string, change *cen
 		//       为了逻辑简单，不论什么变化，都重新载入一次 instance, 不对不同的 ChangeType 单独处理
 		if (keyParts.Group == conf.group || keyParts.Group == defaultRouteGroup) && keyParts.Topic == conf.topic {
 			slog.Infof(ctx, "%s update instance:%v", fun, val)
-			// NOTE: 关闭旧实例，重新载入新实例，若旧实例关闭失败打印日志
-			if err = m.closeInstance(ctx, val, conf); err != nil {
-				slog.Errorf(ctx, "%s close instance err:%v", fun, err)
-			}
-
+			// NOTE: 先载入新实例再替换，新实例载入失败时保留旧实例，避免配置错误中断读写；
+			//       旧实例在 instanceCloseDelay 后关闭，等待已经取到旧实例的读写完成
 			in, err := m.newInstance(ctx, conf)
 			if err != nil {
-				m.instances.Delete(key)
+				slog.Errorf(ctx, "%s new instance err:%v, keep old instance", fun, err)
 				return
 			}
 			m.instances.Store(key, in)
+			m.closeLater(ctx, val, conf)
 		}
 		return
 	})
@@ -221,13 +223,22 @@ func (m *InstanceManager) applyChange(ctx context.Context, k string, change *cen
 func (m *InstanceManager) applyChangeEvent(ctx context.Context, ce *center.ChangeEvent) {
 	slog.Infoln(ctx, "got new change event:%v", ce)
 
+	// 配置发生变化的 topic
+	topics := make(map[string]bool)
 	for key, change := range ce.Changes {
-		// NOTE: 只需关心 MODIFY 与 DELETE 类型改变
-		if change.ChangeType != center.MODIFY && change.ChangeType != center.DELETE {
+		// NOTE: ADD 也需要处理，新增的配置项可能覆盖之前使用的默认值
+		if change.ChangeType != center.ADD && change.ChangeType != center.MODIFY && change.ChangeType != center.DELETE {
 			continue
 		}
 
 		m.applyChange(ctx, key, change)
+		if keyParts, err := DefaultConfiger.ParseKey(ctx, key); err == nil {
+			topics[keyParts.Topic] = true
+		}
+	}
+
+	for topic := range topics {
+		reloadConsumeLimiters(ctx, topic)
 	}
 }
 
@@ -340,6 +351,26 @@ func (m *InstanceManager) Close() {
 	})
 }
 
+// remove 关闭并删除 conf 对应的实例，之后使用该实例时重新创建
+func (m *InstanceManager) remove(ctx context.Context, conf *instanceConf) error {
+	key := m.buildKey(conf)
+	in, ok := m.instances.Load(key)
+	if !ok {
+		return nil
+	}
+	m.instances.Delete(key)
+	return m.closeInstance(ctx, in, conf)
+}
+
+func (m *InstanceManager) closeLater(ctx context.Context, instance interface{}, conf *instanceConf) {
+	fun := "InstanceManager.closeLater-->"
+	time.AfterFunc(instanceCloseDelay, func() {
+		if err := m.closeInstance(ctx, instance, conf); err != nil {
+			slog.Errorf(ctx, "%s close instance err:%v", fun, err)
+		}
+	})
+}
+
 func (m *InstanceManager) closeInstance(ctx context.Context, instance interface{}, conf *instanceConf) error {
 	fun := "InstanceManager.closeInstance-->"
 	if conf.role == RoleTypeReader {
@@ -0,0 +1,82 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"sync"
+)
+
+// 写入与消费的 interceptor，用于日志、统计、校验、补充消息内容等通用逻辑，如
+//
+//	mq.UsePublishInterceptors(func(next mq.PublishFunc) mq.PublishFunc {
+//		return func(ctx context.Context, topic string, msgs ...mq.Message) error {
+//			if len(msgs) == 0 {
+//				return errors.New("no msgs")
+//			}
+//			return next(ctx, topic, msgs...)
+//		}
+//	})
+//
+// 先注册的 interceptor 在外层，不调用 next 即可短路；写入的 interceptor 拿到的是编码前的消息，
+// 消费的 interceptor 每次重试都会执行，不会执行被 ConsumeOptions.Filters 丢弃的消息
+
+// PublishFunc WriteMsg、WriteMsgs 与 WriteMsgsResult 在 interceptor 之后的写入逻辑，WriteMsg 时 msgs 只有一条消息
+type PublishFunc func(ctx context.Context, topic string, msgs ...Message) error
+
+type PublishInterceptor func(next PublishFunc) PublishFunc
+
+type ConsumeInterceptor func(next ConsumeFunc) ConsumeFunc
+
+var interceptors struct {
+	mu      sync.RWMutex
+	publish []PublishInterceptor
+	consume []ConsumeInterceptor
+}
+
+// UsePublishInterceptors 注册全局的写入 interceptor，需要在写入前注册
+func UsePublishInterceptors(in ...PublishInterceptor) {
+	interceptors.mu.Lock()
+	defer interceptors.mu.Unlock()
+	interceptors.publish = append(interceptors.publish, in...)
+}
+
+// UseConsumeInterceptors 注册全局的消费 interceptor，对之后开始的 ConsumeByGroup 生效
+func UseConsumeInterceptors(in ...ConsumeInterceptor) {
+	interceptors.mu.Lock()
+	defer interceptors.mu.Unlock()
+	interceptors.consume = append(interceptors.consume, in...)
+}
+
+// resetInterceptors 用于测试
+func resetInterceptors() {
+	interceptors.mu.Lock()
+	defer interceptors.mu.Unlock()
+	interceptors.publish = nil
+	interceptors.consume = nil
+}
+
+func publish(ctx context.Context, topic string, msgs []Message, fn PublishFunc) error {
+	interceptors.mu.RLock()
+	in := interceptors.publish
+	interceptors.mu.RUnlock()
+
+	for i := len(in) - 1; i >= 0; i-- {
+		fn = in[i](fn)
+	}
+	return fn(ctx, topic, msgs...)
+}
+
+// interceptConsume 全局的 interceptor 在外层，local 在内层
+func interceptConsume(fn ConsumeFunc, local []ConsumeInterceptor) ConsumeFunc {
+	interceptors.mu.RLock()
+	in := append(append([]ConsumeInterceptor{}, interceptors.consume...), local...)
+	interceptors.mu.RUnlock()
+
+	for i := len(in) - 1; i >= 0; i-- {
+		fn = in[i](fn)
+	}
+	return fn
+}
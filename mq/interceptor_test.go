@@ -0,0 +1,88 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestPublishInterceptors(t *testing.T) {
+	defer useMemoryConfiger(t)()
+	defer resetInterceptors()
+
+	topic := "palfish.test.publishinterceptor"
+	var calls []string
+	UsePublishInterceptors(
+		func(next PublishFunc) PublishFunc {
+			return func(ctx context.Context, topic string, msgs ...Message) error {
+				calls = append(calls, fmt.Sprintf("outer:%d", len(msgs)))
+				return next(ctx, topic, msgs...)
+			}
+		},
+		func(next PublishFunc) PublishFunc {
+			return func(ctx context.Context, topic string, msgs ...Message) error {
+				calls = append(calls, "inner")
+				for _, msg := range msgs {
+					if msg.Key == "" {
+						return errors.New("empty key")
+					}
+				}
+				return next(ctx, topic, msgs...)
+			}
+		},
+	)
+
+	assert.Equal(t, WriteMsg(context.TODO(), topic, "k1", &memoryTestMsg{ID: 1}), nil)
+	assert.NotEqual(t, WriteMsgs(context.TODO(), topic, Message{Key: "k2", Value: &memoryTestMsg{ID: 2}}, Message{Value: &memoryTestMsg{ID: 3}}), nil)
+	results, err := WriteMsgsResult(context.TODO(), topic, Message{Key: "k4", Value: &memoryTestMsg{ID: 4}})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(results), 1)
+
+	assert.Equal(t, calls, []string{"outer:1", "inner", "outer:2", "inner", "outer:1", "inner"})
+	// 短路的消息没有写入
+	assert.Equal(t, MemoryTopicLen(topic), 2)
+}
+
+func TestConsumeInterceptors(t *testing.T) {
+	defer useMemoryConfiger(t)()
+	defer resetInterceptors()
+
+	topic := "palfish.test.consumeinterceptor"
+	assert.Equal(t, WriteMsg(context.TODO(), topic, "k1", &memoryTestMsg{ID: 1}), nil)
+
+	var calls []string
+	UseConsumeInterceptors(func(next ConsumeFunc) ConsumeFunc {
+		return func(ctx context.Context, msg *ConsumeMsg) error {
+			calls = append(calls, "global")
+			return next(ctx, msg)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ConsumeByGroup(ctx, topic, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+			calls = append(calls, "fn")
+			cancel()
+			return nil
+		}, &ConsumeOptions{Interceptors: []ConsumeInterceptor{func(next ConsumeFunc) ConsumeFunc {
+			return func(ctx context.Context, msg *ConsumeMsg) error {
+				calls = append(calls, "local")
+				return next(ctx, msg)
+			}
+		}}})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("consume timeout")
+	}
+	assert.Equal(t, calls, []string{"global", "local", "fn"})
+}
@@ -30,12 +30,26 @@ const (
 
 var mqOpDurationLimit = 10 * time.Millisecond
 
+// Message kafka 默认按 Key hash 选择 partition，相同 Key 的消息按写入顺序消费，见 partitioner.go
 type Message struct {
 	Key   string
 	Value interface{}
+	// 不为空时 WriteMsgs 使用该 ctx 的 trace 与 Head、Control，批量写入来自不同请求的消息时各自保留，
+	// 为空时使用 WriteMsgs 的 ctx
+	Ctx context.Context
 }
 
+// WriteMsg 依次经过 UsePublishInterceptors 注册的 interceptor 后写入
 func WriteMsg(ctx context.Context, topic string, key string, value interface{}) error {
+	return publish(ctx, topic, []Message{{Key: key, Value: value}}, func(ctx context.Context, topic string, msgs ...Message) error {
+		if len(msgs) == 1 {
+			return writeMsg(ctx, topic, msgs[0].Key, msgs[0].Value)
+		}
+		return writeMsgs(ctx, topic, msgs...)
+	})
+}
+
+func writeMsg(ctx context.Context, topic string, key string, value interface{}) error {
 	fun := "mq.WriteMsg -->"
 
 	span, ctx := opentracing.StartSpanFromContext(ctx, "mq.WriteMsg")
@@ -53,12 +67,14 @@ func WriteMsg(ctx context.Context, topic string, key string, value interface{})
 	}
 	writer := defaultInstanceManager.getWriter(ctx, conf)
 	if writer == nil {
+		statProduceErr(topic, produceErrNoWriter, 1)
 		slog.Errorf(ctx, "%s getWriter err, topic: %s", fun, topic)
 		return fmt.Errorf("%s, getWriter err, topic: %s", fun, topic)
 	}
 
-	payload, err := generatePayload(ctx, value)
+	payload, err := generatePayload(ctx, topic, value)
 	if err != nil {
+		statProduceErr(topic, produceErrEncode, 1)
 		slog.Errorf(ctx, "%s generatePayload err, topic: %s", fun, topic)
 		return fmt.Errorf("%s, generatePayload err, topic: %s", fun, topic)
 	}
@@ -71,10 +87,17 @@ func WriteMsg(ctx context.Context, topic string, key string, value interface{})
 		}
 	}()
 
-	return writer.WriteMsg(ctx, key, payload)
+	err = writer.WriteMsg(ctx, key, payload)
+	statProduce(topic, 1, st.Duration(), err)
+	return err
 }
 
+// WriteMsgs 依次经过 UsePublishInterceptors 注册的 interceptor 后写入
 func WriteMsgs(ctx context.Context, topic string, msgs ...Message) error {
+	return publish(ctx, topic, msgs, writeMsgs)
+}
+
+func writeMsgs(ctx context.Context, topic string, msgs ...Message) error {
 	fun := "mq.WriteMsgs -->"
 
 	span, ctx := opentracing.StartSpanFromContext(ctx, "mq.WriteMsgs")
@@ -90,12 +113,20 @@ func WriteMsgs(ctx context.Context, topic string, msgs ...Message) error {
 	}
 	writer := defaultInstanceManager.getWriter(ctx, conf)
 	if writer == nil {
+		statProduceErr(topic, produceErrNoWriter, len(msgs))
 		slog.Errorf(ctx, "%s getWriter err, topic: %s", fun, topic)
 		return fmt.Errorf("%s, getWriter err, topic: %s", fun, topic)
 	}
+	return writeWriterMsgs(ctx, writer, topic, msgs...)
+}
+
+// writeWriterMsgs 编码后写入 writer，NewTxnWriter 返回的 writer 也使用
+func writeWriterMsgs(ctx context.Context, writer Writer, topic string, msgs ...Message) error {
+	fun := "mq.WriteMsgs -->"
 
-	nmsgs, err := generateMsgsPayload(ctx, msgs...)
+	nmsgs, err := generateMsgsPayload(ctx, topic, msgs...)
 	if err != nil {
+		statProduceErr(topic, produceErrEncode, len(msgs))
 		slog.Errorf(ctx, "%s generateMsgsPayload err, topic: %s", fun, topic)
 		return fmt.Errorf("%s, generateMsgsPayload err, topic: %s", fun, topic)
 	}
@@ -108,10 +139,12 @@ func WriteMsgs(ctx context.Context, topic string, msgs ...Message) error {
 		}
 	}()
 
-	return writer.WriteMsgs(ctx, nmsgs...)
+	err = writer.WriteMsgs(ctx, nmsgs...)
+	statProduce(topic, len(nmsgs), st.Duration(), err)
+	return err
 }
 
-// 读完消息后会自动提交offset
+// 读完消息后会自动提交offset，处理完成前进程退出会丢失消息，需要 at-least-once 时使用 ConsumeByGroup 或 FetchMsgByGroup
 func ReadMsgByGroup(ctx context.Context, topic, groupId string, value interface{}) (context.Context, error) {
 	fun := "mq.ReadMsgByGroup -->"
 
@@ -264,6 +297,55 @@ func FetchMsgByGroup(ctx context.Context, topic, groupId string, value interface
 	return mctx, handler, err
 }
 
+// SeekByGroup 将 group 的消费位置设置为时间 t 之后的第一条消息，用于消费逻辑有问题时重新消费，
+// kafka 需要先停止该 group 的其他 consumer，见 KafkaReader.seekGroup
+func SeekByGroup(ctx context.Context, topic, groupId string, t time.Time) error {
+	fun := "mq.SeekByGroup -->"
+
+	reader, err := getGroupReader(ctx, topic, groupId)
+	if err != nil {
+		return err
+	}
+	if err = reader.SetOffsetAt(ctx, t); err != nil {
+		slog.Errorf(ctx, "%s SetOffsetAt err: %v, topic: %s, groupId: %s", fun, err, topic, groupId)
+		return fmt.Errorf("%s, SetOffsetAt err: %v, topic: %s", fun, err, topic)
+	}
+	slog.Infof(ctx, "%s topic: %s, groupId: %s, t: %s", fun, topic, groupId, t)
+	return nil
+}
+
+// SeekOffsetByGroup 将 group 的消费位置设置为 offset，FirstOffset 或 LastOffset 为最早或最新的消息，
+// 部分后端只支持这两个值
+func SeekOffsetByGroup(ctx context.Context, topic, groupId string, offset int64) error {
+	fun := "mq.SeekOffsetByGroup -->"
+
+	reader, err := getGroupReader(ctx, topic, groupId)
+	if err != nil {
+		return err
+	}
+	if err = reader.SetOffset(ctx, offset); err != nil {
+		slog.Errorf(ctx, "%s SetOffset err: %v, topic: %s, groupId: %s", fun, err, topic, groupId)
+		return fmt.Errorf("%s, SetOffset err: %v, topic: %s", fun, err, topic)
+	}
+	slog.Infof(ctx, "%s topic: %s, groupId: %s, offset: %d", fun, topic, groupId, offset)
+	return nil
+}
+
+func getGroupReader(ctx context.Context, topic, groupId string) (Reader, error) {
+	conf := &instanceConf{
+		group:     scontext.GetControlRouteGroupWithDefault(ctx, defaultRouteGroup),
+		role:      RoleTypeReader,
+		topic:     topic,
+		groupId:   groupId,
+		partition: 0,
+	}
+	reader := defaultInstanceManager.getReader(ctx, conf)
+	if reader == nil {
+		return nil, fmt.Errorf("getReader err, topic: %s", topic)
+	}
+	return reader, nil
+}
+
 func WriteDelayMsg(ctx context.Context, topic string, value interface{}, delaySeconds uint32) (jobID string, err error) {
 	fun := "mq.WriteDelayMsg -->"
 
@@ -286,7 +368,7 @@ func WriteDelayMsg(ctx context.Context, topic string, value interface{}, delaySe
 		return
 	}
 
-	payload, err := generatePayload(ctx, value)
+	payload, err := generatePayload(ctx, topic, value)
 	if err != nil {
 		slog.Errorf(ctx, "%s generatePayload err, topic: %s", fun, topic)
 		err = fmt.Errorf("%s, generatePayload err, topic: %s", fun, topic)
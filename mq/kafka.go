@@ -6,18 +6,45 @@ package mq
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/log"
 	kafka "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/gzip"
+	"github.com/segmentio/kafka-go/lz4"
+	"github.com/segmentio/kafka-go/snappy"
 	"strings"
+	"sync"
 	"time"
 )
 
+const defaultKafkaLinger = 10 * time.Millisecond
+
+// kafkaCompressionCodecs 配置项 compression 可选的压缩算法，引入的同时注册了 reader 解压使用的 codec，
+// zstd 依赖 cgo，见 kafka_zstd.go
+var kafkaCompressionCodecs = map[string]func() kafka.CompressionCodec{
+	"gzip":   func() kafka.CompressionCodec { return gzip.NewCompressionCodec() },
+	"snappy": func() kafka.CompressionCodec { return snappy.NewCompressionCodec() },
+	"lz4":    func() kafka.CompressionCodec { return lz4.NewCompressionCodec() },
+}
+
+// kafkaCompressionCodec 未配置或为 none 时不压缩
+func kafkaCompressionCodec(name string) (kafka.CompressionCodec, error) {
+	name = strings.ToLower(name)
+	if name == "" || name == "none" {
+		return nil, nil
+	}
+	newCodec, ok := kafkaCompressionCodecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown kafka compression: %s", name)
+	}
+	return newCodec(), nil
+}
+
 type KafkaHandler struct {
-	msg    kafka.Message
-	reader *kafka.Reader
+	msg     kafka.Message
+	reader  *kafka.Reader
+	offsets *kafkaOffsets
 }
 
 func NewKafkaHandler(reader *kafka.Reader, msg kafka.Message) *KafkaHandler {
@@ -28,28 +55,95 @@ func NewKafkaHandler(reader *kafka.Reader, msg kafka.Message) *KafkaHandler {
 }
 
 func (m *KafkaHandler) CommitMsg(ctx context.Context) error {
-	return m.reader.CommitMessages(ctx, m.msg)
+	err := m.reader.CommitMessages(ctx, m.msg)
+	if err == nil && m.offsets != nil {
+		m.offsets.commit(m.msg)
+	}
+	return err
+}
+
+func (m *KafkaHandler) msgKey() string {
+	return string(m.msg.Key)
+}
+
+func (m *KafkaHandler) msgPartition() int {
+	return m.msg.Partition
+}
+
+func (m *KafkaHandler) msgTime() time.Time {
+	return m.msg.Time
+}
+
+func (m *KafkaHandler) msgOffset() int64 {
+	return m.msg.Offset
+}
+
+// kafkaOffsets 记录 reader 提交过的 offset 用于计算 lag，
+// kafka-go v0.3.4 没有公开 OffsetFetch 请求，无法获取 group 在 broker 上提交的 offset，
+// 故只包含当前进程消费过的 partition
+type kafkaOffsets struct {
+	mu sync.Mutex
+	// partition -> 下一条待消费消息的 offset
+	committed map[int]int64
+}
+
+func newKafkaOffsets() *kafkaOffsets {
+	return &kafkaOffsets{
+		committed: make(map[int]int64),
+	}
+}
+
+func (m *kafkaOffsets) commit(msg kafka.Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if next := msg.Offset + 1; next > m.committed[msg.Partition] {
+		m.committed[msg.Partition] = next
+	}
+}
+
+func (m *kafkaOffsets) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.committed = make(map[int]int64)
+}
+
+func (m *kafkaOffsets) snapshot() map[int]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	committed := make(map[int]int64, len(m.committed))
+	for partition, offset := range m.committed {
+		committed[partition] = offset
+	}
+	return committed
 }
 
 type KafkaReader struct {
 	*kafka.Reader
+	offsets *kafkaOffsets
+	// 累计的 rebalance 次数，见 rebalance.go
+	rebalances int64
 }
 
-func NewKafkaReader(brokers []string, topic, groupId string, partition, minBytes, maxBytes int, commitInterval time.Duration) *KafkaReader {
+// NewKafkaReader startOffset 为没有提交过 offset 的 group 开始消费的位置，FirstOffset 或 LastOffset，
+// 读取事务 writer 写入的 topic 时 isolationLevel 需要为 kafka.ReadCommitted，dialer 为 nil 时使用 kafka.DefaultDialer
+func NewKafkaReader(brokers []string, topic, groupId string, partition, minBytes, maxBytes int, commitInterval time.Duration, startOffset int64, isolationLevel kafka.IsolationLevel, dialer *kafka.Dialer) *KafkaReader {
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:        brokers,
+		Dialer:         dialer,
 		Topic:          topic,
 		GroupID:        groupId,
 		Partition:      partition,
 		MinBytes:       minBytes,
 		MaxBytes:       maxBytes,
 		CommitInterval: commitInterval,
-		StartOffset:    kafka.LastOffset,
+		StartOffset:    startOffset,
+		IsolationLevel: isolationLevel,
 		//MaxWait:        30 * time.Second,
 	})
 
 	return &KafkaReader{
-		Reader: reader,
+		Reader:  reader,
+		offsets: newKafkaOffsets(),
 	}
 }
 
@@ -73,13 +167,17 @@ func (m *KafkaReader) ReadMsg(ctx context.Context, v interface{}, ov interface{}
 	if err != nil {
 		return err
 	}
+	// NOTE: group reader 的 ReadMessage 会自动提交
+	if m.Config().GroupID != "" {
+		m.offsets.commit(msg)
+	}
 
-	err = json.Unmarshal(msg.Value, v)
+	err = unmarshalKafkaMsg(msg, v)
 	if err != nil {
 		return err
 	}
 
-	err = json.Unmarshal(msg.Value, ov)
+	err = unmarshalKafkaMsg(msg, ov)
 	if err != nil {
 		return err
 	}
@@ -98,51 +196,188 @@ func (m *KafkaReader) FetchMsg(ctx context.Context, v interface{}, ov interface{
 		return nil, err
 	}
 
-	err = json.Unmarshal(msg.Value, v)
+	err = unmarshalKafkaMsg(msg, v)
 	if err != nil {
 		return nil, err
 	}
 
-	err = json.Unmarshal(msg.Value, ov)
+	err = unmarshalKafkaMsg(msg, ov)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewKafkaHandler(m.Reader, msg), nil
+	handler := NewKafkaHandler(m.Reader, msg)
+	handler.offsets = m.offsets
+	return handler, nil
 }
 
 func (m *KafkaReader) Close() error {
 	return m.Reader.Close()
 }
 
+// SetOffsetAt group reader 为所有 partition 提交时间 t 之后的第一条消息的 offset，见 seekGroup
 func (m *KafkaReader) SetOffsetAt(ctx context.Context, t time.Time) error {
-	return m.Reader.SetOffsetAt(ctx, t)
+	if m.Config().GroupID == "" {
+		return m.Reader.SetOffsetAt(ctx, t)
+	}
+	return m.seekGroup(ctx, func(conn *kafka.Conn) (int64, error) {
+		return conn.ReadOffset(t)
+	})
 }
 
+// SetOffset group reader 的 offset 为 FirstOffset 或 LastOffset 时为每个 partition 提交最早或最新的 offset，
+// 其他值对所有 partition 生效
 func (m *KafkaReader) SetOffset(ctx context.Context, offset int64) error {
-	return m.Reader.SetOffset(offset)
+	if m.Config().GroupID == "" {
+		return m.Reader.SetOffset(offset)
+	}
+	return m.seekGroup(ctx, func(conn *kafka.Conn) (int64, error) {
+		switch offset {
+		case FirstOffset:
+			return conn.ReadFirstOffset()
+		case LastOffset:
+			return conn.ReadLastOffset()
+		default:
+			return offset, nil
+		}
+	})
+}
+
+// seekGroup kafka-go 的 group reader 不支持 SetOffset，关闭 reader 退出 group 后，
+// 以新成员加入 group 为每个 partition 提交 partitionOffset 返回的 offset，再重新创建 reader 从提交的位置消费；
+// 与 kafka-consumer-groups --reset-offsets 一样，需要先停止该 group 的其他 consumer，否则会被其提交的 offset 覆盖，
+// 且不能与读取并发调用
+func (m *KafkaReader) seekGroup(ctx context.Context, partitionOffset func(conn *kafka.Conn) (int64, error)) error {
+	fun := "KafkaReader.seekGroup -->"
+
+	config := m.Config()
+	if len(config.Brokers) == 0 {
+		return fmt.Errorf("%s no brokers, topic: %s", fun, config.Topic)
+	}
+
+	partitions, err := config.Dialer.LookupPartitions(ctx, "tcp", config.Brokers[0], config.Topic)
+	if err != nil {
+		return fmt.Errorf("%s lookup partitions err: %v, topic: %s", fun, err, config.Topic)
+	}
+	offsets := make(map[int]int64, len(partitions))
+	for _, p := range partitions {
+		conn, err := config.Dialer.DialPartition(ctx, "tcp", config.Brokers[0], p)
+		if err != nil {
+			return fmt.Errorf("%s dial partition %d err: %v, topic: %s", fun, p.ID, err, config.Topic)
+		}
+		offset, err := partitionOffset(conn)
+		conn.Close()
+		if err != nil {
+			return fmt.Errorf("%s read partition %d offset err: %v, topic: %s", fun, p.ID, err, config.Topic)
+		}
+		offsets[p.ID] = offset
+	}
+
+	if err = m.Reader.Close(); err != nil {
+		return err
+	}
+	m.offsets.reset()
+	// NOTE: 无论提交是否成功都重新创建 reader，保证 KafkaReader 可以继续使用
+	defer func() {
+		m.Reader = kafka.NewReader(config)
+	}()
+
+	group, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:      config.GroupID,
+		Brokers: config.Brokers,
+		Dialer:  config.Dialer,
+		Topics:  []string{config.Topic},
+	})
+	if err != nil {
+		return err
+	}
+	defer group.Close()
+
+	gen, err := group.Next(ctx)
+	if err != nil {
+		return fmt.Errorf("%s join group err: %v, group: %s", fun, err, config.GroupID)
+	}
+	err = gen.CommitOffsets(map[string]map[int]int64{config.Topic: offsets})
+	if err != nil {
+		return fmt.Errorf("%s commit offsets err: %v, group: %s", fun, err, config.GroupID)
+	}
+	return nil
+}
+
+// lags HighWatermark 从各 partition 的 leader 获取
+func (m *KafkaReader) lags(ctx context.Context) ([]PartitionLag, error) {
+	config := m.Config()
+	if config.GroupID == "" || len(config.Brokers) == 0 {
+		return nil, nil
+	}
+
+	var lags []PartitionLag
+	for partition, committed := range m.offsets.snapshot() {
+		conn, err := config.Dialer.DialLeader(ctx, "tcp", config.Brokers[0], config.Topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		hw, err := conn.ReadLastOffset()
+		conn.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		lag := hw - committed
+		if lag < 0 {
+			lag = 0
+		}
+		lags = append(lags, PartitionLag{
+			Partition:     partition,
+			Committed:     committed,
+			HighWatermark: hw,
+			Lag:           lag,
+		})
+	}
+	return lags, nil
 }
 
+// KafkaWriter 不支持幂等与事务，配置了 idempotent 或 transactionalid 时使用幂等的 KafkaTxnWriter
 type KafkaWriter struct {
 	*kafka.Writer
 	// NOTE: KafkaWriter 没有 config 的 getter，故在此保留一份
 	config kafka.WriterConfig
+	// trace 的 carrier 与 Head 等放在 kafka header 中，见 kafka_header.go
+	headerCarrier bool
+	balancer      *partitionRecorder
 }
 
-func NewKafkaWriter(brokers []string, topic string) *KafkaWriter {
+// NewKafkaWriter batchSize <= 1 时每条消息单独发送，否则最多等待 linger 攒批，linger 未配置时使用 defaultKafkaLinger，
+// codec 为 nil 时不压缩，balancer 为 nil 时按 key hash，dialer 为 nil 时使用 kafka.DefaultDialer
+func NewKafkaWriter(brokers []string, topic string, batchSize int, linger time.Duration, codec kafka.CompressionCodec, headerCarrier bool, balancer kafka.Balancer, dialer *kafka.Dialer) *KafkaWriter {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	if linger <= 0 && batchSize > 1 {
+		linger = defaultKafkaLinger
+	}
+	if balancer == nil {
+		balancer = &kafka.Hash{}
+	}
+	recorder := &partitionRecorder{Balancer: balancer}
 	config := kafka.WriterConfig{
-		Brokers:   brokers,
-		Topic:     topic,
-		Balancer:  &kafka.Hash{},
-		BatchSize: 1,
+		Brokers:          brokers,
+		Topic:            topic,
+		Dialer:           dialer,
+		Balancer:         recorder,
+		BatchSize:        batchSize,
+		BatchTimeout:     linger,
+		CompressionCodec: codec,
 		//RequiredAcks: 1,
 		//Async:        true,
 	}
 	writer := kafka.NewWriter(config)
 
 	return &KafkaWriter{
-		Writer: writer,
-		config: config,
+		Writer:        writer,
+		config:        config,
+		headerCarrier: headerCarrier,
+		balancer:      recorder,
 	}
 }
 
@@ -160,15 +395,12 @@ func (m *KafkaWriter) WriteMsg(ctx context.Context, k string, v interface{}) err
 		m.logConfigToSpan(span)
 	}
 
-	msg, err := json.Marshal(v)
+	msg, err := newKafkaMessage(k, v, m.headerCarrier)
 	if err != nil {
 		return err
 	}
 
-	return m.WriteMessages(ctx, kafka.Message{
-		Key:   []byte(k),
-		Value: msg,
-	})
+	return m.WriteMessages(ctx, msg)
 }
 
 func (m *KafkaWriter) WriteMsgs(ctx context.Context, msgs ...Message) error {
@@ -179,19 +411,46 @@ func (m *KafkaWriter) WriteMsgs(ctx context.Context, msgs ...Message) error {
 
 	var kmsgs []kafka.Message
 	for _, msg := range msgs {
-		body, err := json.Marshal(msg.Value)
+		kmsg, err := newKafkaMessage(msg.Key, msg.Value, m.headerCarrier)
 		if err != nil {
 			return err
 		}
-		kmsgs = append(kmsgs, kafka.Message{
-			Key:   []byte(msg.Key),
-			Value: body,
-		})
+		kmsgs = append(kmsgs, kmsg)
 	}
 
 	return m.WriteMessages(ctx, kmsgs...)
 }
 
+// WriteMsgsResult msgs 按顺序在一次 WriteMessages 中写入，相同 key 的消息保持写入顺序，partition 由 balancer 记录；
+// kafka-go 不返回写入的 offset，也不区分一批中失败的消息，写入失败时所有消息的 Err 相同
+func (m *KafkaWriter) WriteMsgsResult(ctx context.Context, msgs ...Message) []MsgResult {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	results := newMsgResults(msgs, nil)
+	var kmsgs []kafka.Message
+	var indexes []int
+	for i, msg := range msgs {
+		kmsg, err := newKafkaMessage(msg.Key, msg.Value, m.headerCarrier)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		m.balancer.watch(kmsg)
+		kmsgs = append(kmsgs, kmsg)
+		indexes = append(indexes, i)
+	}
+
+	err := m.WriteMessages(ctx, kmsgs...)
+	for j, i := range indexes {
+		results[i].Err = err
+		results[i].Partition = m.balancer.partition(kmsgs[j])
+	}
+	return results
+}
+
 func (m *KafkaWriter) Close() error {
 	return m.Writer.Close()
 }
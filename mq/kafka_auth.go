@@ -0,0 +1,118 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+const (
+	saslMechanismPlain       = "PLAIN"
+	saslMechanismScramSHA256 = "SCRAM-SHA-256"
+	saslMechanismScramSHA512 = "SCRAM-SHA-512"
+
+	// 与 kafka.DefaultDialer 一致
+	kafkaDialTimeout = 10 * time.Second
+
+	pemBlockPrefix = "-----BEGIN"
+)
+
+// kafkaDialer 没有配置认证时返回 nil，使用 kafka.DefaultDialer
+func kafkaDialer(auth AuthConfig) (*kafka.Dialer, error) {
+	mechanism, err := saslMechanism(auth)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := kafkaTLSConfig(auth)
+	if err != nil {
+		return nil, err
+	}
+	if mechanism == nil && tlsConfig == nil {
+		return nil, nil
+	}
+
+	return &kafka.Dialer{
+		Timeout:       kafkaDialTimeout,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}, nil
+}
+
+func saslMechanism(auth AuthConfig) (sasl.Mechanism, error) {
+	switch strings.ToUpper(auth.SASLMechanism) {
+	case "":
+		return nil, nil
+	case saslMechanismPlain:
+		return plain.Mechanism{
+			Username: auth.SASLUsername,
+			Password: auth.SASLPassword,
+		}, nil
+	case saslMechanismScramSHA256:
+		return scram.Mechanism(scram.SHA256, auth.SASLUsername, auth.SASLPassword)
+	case saslMechanismScramSHA512:
+		return scram.Mechanism(scram.SHA512, auth.SASLUsername, auth.SASLPassword)
+	default:
+		return nil, fmt.Errorf("unknown sasl mechanism: %s", auth.SASLMechanism)
+	}
+}
+
+// kafkaTLSConfig 配置了 CA 时只信任该 CA，配置了 cert 与 key 时使用双向认证
+func kafkaTLSConfig(auth AuthConfig) (*tls.Config, error) {
+	if !auth.TLS && auth.TLSCert == "" && auth.TLSKey == "" && auth.TLSCA == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{}
+	if auth.TLSCA != "" {
+		ca, err := readPEM(auth.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("invalid tls ca")
+		}
+		config.RootCAs = pool
+	}
+
+	if auth.TLSCert != "" || auth.TLSKey != "" {
+		if auth.TLSCert == "" || auth.TLSKey == "" {
+			return nil, fmt.Errorf("tls cert and key must be set together")
+		}
+		cert, err := readPEM(auth.TLSCert)
+		if err != nil {
+			return nil, err
+		}
+		key, err := readPEM(auth.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	return config, nil
+}
+
+// readPEM s 为 PEM 内容时直接使用，否则作为文件路径读取
+func readPEM(s string) ([]byte, error) {
+	if strings.Contains(s, pemBlockPrefix) {
+		return []byte(s), nil
+	}
+	return ioutil.ReadFile(s)
+}
@@ -0,0 +1,86 @@
+package mq
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func newTestPEM(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, err, nil)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "mq-test"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Equal(t, err, nil)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Equal(t, err, nil)
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return string(cert), string(keyPEM)
+}
+
+func TestKafkaDialer(t *testing.T) {
+	dialer, err := kafkaDialer(AuthConfig{})
+	assert.Equal(t, err, nil)
+	assert.True(t, dialer == nil)
+
+	dialer, err = kafkaDialer(AuthConfig{SASLMechanism: "plain", SASLUsername: "u", SASLPassword: "p"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, dialer.SASLMechanism.Name(), saslMechanismPlain)
+	assert.True(t, dialer.TLS == nil)
+
+	dialer, err = kafkaDialer(AuthConfig{SASLMechanism: "SCRAM-SHA-512", SASLUsername: "u", SASLPassword: "p", TLS: true})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, dialer.SASLMechanism.Name(), saslMechanismScramSHA512)
+	assert.True(t, dialer.TLS != nil)
+
+	_, err = kafkaDialer(AuthConfig{SASLMechanism: "GSSAPI"})
+	assert.True(t, err != nil)
+}
+
+func TestKafkaTLSConfig(t *testing.T) {
+	cert, key := newTestPEM(t)
+
+	dir, err := ioutil.TempDir("", "mqtls")
+	assert.Equal(t, err, nil)
+	defer os.RemoveAll(dir)
+	certPath := filepath.Join(dir, "cert.pem")
+	assert.Equal(t, ioutil.WriteFile(certPath, []byte(cert), 0600), nil)
+
+	// 路径与 PEM 内容混用
+	config, err := kafkaTLSConfig(AuthConfig{TLSCA: certPath, TLSCert: certPath, TLSKey: key})
+	assert.Equal(t, err, nil)
+	assert.True(t, config.RootCAs != nil)
+	assert.Equal(t, len(config.Certificates), 1)
+
+	config, err = kafkaTLSConfig(AuthConfig{TLSCA: cert})
+	assert.Equal(t, err, nil)
+	assert.True(t, config.RootCAs != nil)
+	assert.Equal(t, len(config.Certificates), 0)
+
+	_, err = kafkaTLSConfig(AuthConfig{TLSCert: cert})
+	assert.True(t, err != nil)
+	_, err = kafkaTLSConfig(AuthConfig{TLSCA: filepath.Join(dir, "missing.pem")})
+	assert.True(t, err != nil)
+	_, err = kafkaTLSConfig(AuthConfig{TLSCA: "-----BEGIN CERTIFICATE-----\ninvalid"})
+	assert.True(t, err != nil)
+}
@@ -0,0 +1,165 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// 配置项 headercarrier 为 true 时，kafka 消息体只包含序列化后的值，trace 的 carrier 直接作为 kafka header，
+// Head、Control 等放在 sutil- 前缀的 header 中，便于非 sutil 的消费者直接解析消息体；
+// 读取时根据 sutil-codec header 自动识别，需要 kafka 0.11 及以上的版本
+const (
+	kafkaHeaderPrefix  = "sutil-"
+	kafkaHeaderCodec   = kafkaHeaderPrefix + "codec"
+	kafkaHeaderHead    = kafkaHeaderPrefix + "head"
+	kafkaHeaderControl = kafkaHeaderPrefix + "control"
+	kafkaHeaderRetries = kafkaHeaderPrefix + "retries"
+	// v2 的字段，见 payloadVersion
+	kafkaHeaderVersion     = kafkaHeaderPrefix + "version"
+	kafkaHeaderContentType = kafkaHeaderPrefix + "content-type"
+	kafkaHeaderTimestamp   = kafkaHeaderPrefix + "timestamp"
+
+	kafkaHeaderCodecJSON = "json"
+)
+
+// newKafkaMessage headerCarrier 为 false 或 v 不是 Payload 时整体序列化为消息体
+func newKafkaMessage(key string, v interface{}, headerCarrier bool) (kafka.Message, error) {
+	payload, ok := v.(*Payload)
+	if !headerCarrier || !ok {
+		body, err := marshalMsg(v)
+		if err != nil {
+			return kafka.Message{}, err
+		}
+		return kafka.Message{
+			Key:   []byte(key),
+			Value: body,
+		}, nil
+	}
+	return payloadToKafkaMessage(key, payload)
+}
+
+func payloadToKafkaMessage(key string, payload *Payload) (kafka.Message, error) {
+	// avro 与 protobuf 编码的 Value 为 base64，消息体使用原始的字节，avro 即为 confluent 的 wire format
+	body := []byte(payload.Value)
+	codec := payload.Codec
+	if codec == "" {
+		codec = kafkaHeaderCodecJSON
+	} else {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(payload.Value); err != nil {
+			return kafka.Message{}, err
+		}
+	}
+
+	headers := []kafka.Header{{Key: kafkaHeaderCodec, Value: []byte(codec)}}
+	for k, v := range payload.Carrier {
+		headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	if payload.Head != nil {
+		head, err := json.Marshal(payload.Head)
+		if err != nil {
+			return kafka.Message{}, err
+		}
+		headers = append(headers, kafka.Header{Key: kafkaHeaderHead, Value: head})
+	}
+	if payload.Control != nil {
+		control, err := json.Marshal(payload.Control)
+		if err != nil {
+			return kafka.Message{}, err
+		}
+		headers = append(headers, kafka.Header{Key: kafkaHeaderControl, Value: control})
+	}
+	if payload.Retries > 0 {
+		headers = append(headers, kafka.Header{Key: kafkaHeaderRetries, Value: []byte(strconv.Itoa(payload.Retries))})
+	}
+	if payload.Version > 0 {
+		headers = append(headers, kafka.Header{Key: kafkaHeaderVersion, Value: []byte(strconv.Itoa(payload.Version))})
+	}
+	if payload.ContentType != "" {
+		headers = append(headers, kafka.Header{Key: kafkaHeaderContentType, Value: []byte(payload.ContentType)})
+	}
+	if payload.Timestamp > 0 {
+		headers = append(headers, kafka.Header{Key: kafkaHeaderTimestamp, Value: []byte(strconv.FormatInt(payload.Timestamp, 10))})
+	}
+
+	return kafka.Message{
+		Key:     []byte(key),
+		Value:   body,
+		Headers: headers,
+	}, nil
+}
+
+// kafkaMessageToPayload 消息没有 sutil-codec header 时返回 nil
+func kafkaMessageToPayload(msg kafka.Message) (*Payload, error) {
+	var codec []byte
+	for _, h := range msg.Headers {
+		if h.Key == kafkaHeaderCodec {
+			codec = h.Value
+			break
+		}
+	}
+	if codec == nil {
+		return nil, nil
+	}
+
+	payload := &Payload{
+		Carrier: make(map[string]string),
+		Value:   string(msg.Value),
+	}
+	if c := string(codec); c != kafkaHeaderCodecJSON {
+		payload.Codec = c
+		payload.Value = base64.StdEncoding.EncodeToString(msg.Value)
+	}
+
+	for _, h := range msg.Headers {
+		var err error
+		switch h.Key {
+		case kafkaHeaderCodec:
+		case kafkaHeaderHead:
+			err = json.Unmarshal(h.Value, &payload.Head)
+		case kafkaHeaderControl:
+			err = json.Unmarshal(h.Value, &payload.Control)
+		case kafkaHeaderRetries:
+			payload.Retries, err = strconv.Atoi(string(h.Value))
+		case kafkaHeaderVersion:
+			payload.Version, err = strconv.Atoi(string(h.Value))
+		case kafkaHeaderContentType:
+			payload.ContentType = string(h.Value)
+		case kafkaHeaderTimestamp:
+			payload.Timestamp, err = strconv.ParseInt(string(h.Value), 10, 64)
+		default:
+			if !strings.HasPrefix(h.Key, kafkaHeaderPrefix) {
+				payload.Carrier[h.Key] = string(h.Value)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// unmarshalKafkaMsg 与 unmarshalMsg 一致，目标不是 Payload 时解析 Payload.Value
+func unmarshalKafkaMsg(msg kafka.Message, v interface{}) error {
+	payload, err := kafkaMessageToPayload(msg)
+	if err != nil {
+		return err
+	}
+	if payload == nil {
+		return unmarshalMsg(msg.Value, v)
+	}
+
+	if p, ok := v.(*Payload); ok {
+		*p = *payload
+		return nil
+	}
+	return unmarshalPayloadValue(payload, v)
+}
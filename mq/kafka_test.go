@@ -0,0 +1,111 @@
+package mq
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func TestKafkaCompressionCodec(t *testing.T) {
+	codec, err := kafkaCompressionCodec("")
+	assert.Equal(t, err, nil)
+	assert.True(t, codec == nil)
+
+	codec, err = kafkaCompressionCodec("none")
+	assert.Equal(t, err, nil)
+	assert.True(t, codec == nil)
+
+	for _, name := range []string{"gzip", "Snappy", "lz4"} {
+		codec, err = kafkaCompressionCodec(name)
+		assert.Equal(t, err, nil)
+		assert.NotEqual(t, codec, nil)
+	}
+
+	_, err = kafkaCompressionCodec("brotli")
+	assert.True(t, err != nil)
+}
+
+func TestKafkaHeaderCarrier(t *testing.T) {
+	payload := &Payload{
+		Carrier: map[string]string{"uber-trace-id": "1:2:3:1"},
+		Value:   `{"id":1,"name":"a"}`,
+		Head:    map[string]interface{}{"uid": float64(1)},
+		Retries: 2,
+
+		Version:     payloadVersion,
+		ContentType: contentTypeJSON,
+		Timestamp:   1600000000000,
+	}
+	msg, err := newKafkaMessage("k1", payload, true)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(msg.Key), "k1")
+	assert.Equal(t, string(msg.Value), payload.Value)
+
+	headers := make(map[string]string)
+	for _, h := range msg.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	assert.Equal(t, headers["uber-trace-id"], "1:2:3:1")
+	assert.Equal(t, headers[kafkaHeaderCodec], kafkaHeaderCodecJSON)
+	assert.Equal(t, headers[kafkaHeaderHead], `{"uid":1}`)
+	assert.Equal(t, headers[kafkaHeaderRetries], "2")
+	_, ok := headers[kafkaHeaderControl]
+	assert.Equal(t, ok, false)
+
+	var p Payload
+	assert.Equal(t, unmarshalKafkaMsg(msg, &p), nil)
+	assert.Equal(t, p.Value, payload.Value)
+	assert.Equal(t, p.Codec, "")
+	assert.Equal(t, len(p.Carrier), 1)
+	assert.Equal(t, p.Carrier["uber-trace-id"], "1:2:3:1")
+	assert.Equal(t, p.Head.(map[string]interface{})["uid"], float64(1))
+	assert.Equal(t, p.Control, nil)
+	assert.Equal(t, p.Retries, 2)
+	assert.Equal(t, p.Version, payloadVersion)
+	assert.Equal(t, p.ContentType, contentTypeJSON)
+	assert.Equal(t, p.Timestamp, int64(1600000000000))
+
+	var v memoryTestMsg
+	assert.Equal(t, unmarshalKafkaMsg(msg, &v), nil)
+	assert.Equal(t, v.ID, 1)
+
+	// 非 json 编码的 Value 消息体为原始字节
+	value := base64.StdEncoding.EncodeToString([]byte{0, 0, 0, 0, 1, 2})
+	msg, err = newKafkaMessage("k2", &Payload{Value: value, Codec: payloadCodecAvro}, true)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, msg.Value, []byte{0, 0, 0, 0, 1, 2})
+	assert.Equal(t, unmarshalKafkaMsg(msg, &p), nil)
+	assert.Equal(t, p.Value, value)
+	assert.Equal(t, p.Codec, payloadCodecAvro)
+
+	// 未开启时与原来的格式一致
+	msg, err = newKafkaMessage("k3", payload, false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(msg.Headers), 0)
+	p = Payload{}
+	assert.Equal(t, unmarshalKafkaMsg(msg, &p), nil)
+	assert.Equal(t, p.Value, payload.Value)
+	assert.Equal(t, p.Retries, 2)
+
+	// 其他 producer 写入的消息
+	p = Payload{}
+	assert.Equal(t, unmarshalKafkaMsg(kafka.Message{Value: []byte(`{"id":1}`)}, &p), nil)
+	assert.Equal(t, p.Value, "")
+}
+
+func TestKafkaOffsets(t *testing.T) {
+	offsets := newKafkaOffsets()
+	offsets.commit(kafka.Message{Partition: 0, Offset: 9})
+	offsets.commit(kafka.Message{Partition: 0, Offset: 3})
+	offsets.commit(kafka.Message{Partition: 1, Offset: 0})
+
+	committed := offsets.snapshot()
+	assert.Equal(t, len(committed), 2)
+	assert.Equal(t, committed[0], int64(10))
+	assert.Equal(t, committed[1], int64(1))
+
+	offsets.reset()
+	assert.Equal(t, len(offsets.snapshot()), 0)
+}
@@ -0,0 +1,396 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/xdg/scram"
+)
+
+// ErrProducerFenced 相同 transactionalid 的新 producer 初始化后，旧的 producer 被 broker fence，
+// 之后的写入与事务操作都会失败，需要 Close 后重新创建 writer
+var ErrProducerFenced = errors.New("kafka producer fenced")
+
+// TxnWriter 事务 writer，BeginTxn 之后写入的消息在 CommitTxn 后才对 read_committed 的消费者可见，
+// AbortTxn 丢弃事务中的消息；没有调用 BeginTxn 时 WriteMsg、WriteMsgs 与 WriteMsgsResult 各自在一个事务中提交
+type TxnWriter interface {
+	Writer
+	BatchWriter
+	BeginTxn() error
+	CommitTxn() error
+	AbortTxn() error
+}
+
+// KafkaTxnWriter segmentio/kafka-go 的 produce 请求固定使用 producerID -1，不支持幂等与事务，故使用 sarama 的 SyncProducer；
+// 幂等 producer 保证重试不会产生重复消息，配置了 transactionalID 时同时支持事务，
+// 一个 transactionalID 同一时间只能有一个 writer，后创建的 writer 会 fence 之前的
+type KafkaTxnWriter struct {
+	producer      sarama.SyncProducer
+	brokers       []string
+	topic         string
+	headerCarrier bool
+
+	// 事务内的写入与 BeginTxn/CommitTxn/AbortTxn 互斥
+	mu    sync.Mutex
+	inTxn bool
+}
+
+// NewKafkaTxnWriter transactionalID 为空时只开启幂等，codec 为 compression 配置项，
+// balancer 为 nil 时按 key hash，与 KafkaWriter 的分区方式一致
+func NewKafkaTxnWriter(brokers []string, topic, transactionalID, codec string, headerCarrier bool, balancer kafka.Balancer, auth AuthConfig) (*KafkaTxnWriter, error) {
+	config, err := kafkaTxnConfig(transactionalID, codec, balancer, auth)
+	if err != nil {
+		return nil, err
+	}
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	return newKafkaTxnWriter(producer, brokers, topic, headerCarrier), nil
+}
+
+// kafkaTxnID 配置项 transactionalid 由同一服务的所有实例共享，追加调用方指定的 instance 使各实例的 id 不同，
+// instance 在重启前后需要保持不变，新的 producer 才能 fence 重启前未结束的事务
+func kafkaTxnID(id, instance string) string {
+	if instance == "" {
+		return id
+	}
+	return id + "." + instance
+}
+
+// kafkaIsolationLevel 配置了 transactionalid 的 topic 只消费已提交的消息
+func kafkaIsolationLevel(config *Config) kafka.IsolationLevel {
+	if config.TxnID != "" {
+		return kafka.ReadCommitted
+	}
+	return kafka.ReadUncommitted
+}
+
+func newKafkaTxnWriter(producer sarama.SyncProducer, brokers []string, topic string, headerCarrier bool) *KafkaTxnWriter {
+	return &KafkaTxnWriter{
+		producer:      producer,
+		brokers:       brokers,
+		topic:         topic,
+		headerCarrier: headerCarrier,
+	}
+}
+
+func kafkaTxnConfig(transactionalID, codec string, balancer kafka.Balancer, auth AuthConfig) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	// 幂等与事务需要 kafka 0.11 及以上的版本
+	config.Version = sarama.V0_11_0_0
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	config.Net.MaxOpenRequests = 1
+	if transactionalID != "" {
+		config.Producer.Transaction.ID = transactionalID
+	}
+
+	if codec != "" {
+		if err := config.Producer.Compression.UnmarshalText([]byte(strings.ToLower(codec))); err != nil {
+			return nil, fmt.Errorf("unknown kafka compression: %s", codec)
+		}
+		if config.Producer.Compression == sarama.CompressionZSTD {
+			config.Version = sarama.V2_1_0_0
+		}
+	}
+
+	if balancer == nil {
+		balancer = &kafka.Hash{}
+	}
+	config.Producer.Partitioner = func(string) sarama.Partitioner {
+		return &saramaBalancer{balancer: balancer}
+	}
+
+	if err := saramaAuth(config, auth); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// saramaAuth 与 kafkaDialer 使用相同的认证配置
+func saramaAuth(config *sarama.Config, auth AuthConfig) error {
+	tlsConfig, err := kafkaTLSConfig(auth)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	mechanism := strings.ToUpper(auth.SASLMechanism)
+	switch mechanism {
+	case "":
+		return nil
+	case saslMechanismPlain:
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case saslMechanismScramSHA256:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &saramaSCRAMClient{HashGeneratorFcn: sha256.New}
+		}
+	case saslMechanismScramSHA512:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &saramaSCRAMClient{HashGeneratorFcn: sha512.New}
+		}
+	default:
+		return fmt.Errorf("unknown sasl mechanism: %s", auth.SASLMechanism)
+	}
+	config.Net.SASL.Enable = true
+	config.Net.SASL.User = auth.SASLUsername
+	config.Net.SASL.Password = auth.SASLPassword
+	return nil
+}
+
+// saramaSCRAMClient sarama 没有内置 SCRAM 的实现
+type saramaSCRAMClient struct {
+	scram.HashGeneratorFcn
+	conversation *scram.ClientConversation
+}
+
+func (m *saramaSCRAMClient) Begin(userName, password, authzID string) error {
+	client, err := m.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	m.conversation = client.NewConversation()
+	return nil
+}
+
+func (m *saramaSCRAMClient) Step(challenge string) (string, error) {
+	return m.conversation.Step(challenge)
+}
+
+func (m *saramaSCRAMClient) Done() bool {
+	return m.conversation.Done()
+}
+
+// saramaBalancer 使用 kafka-go 的 balancer 选择分区，相同 key 写入的分区与 KafkaWriter 一致
+type saramaBalancer struct {
+	balancer kafka.Balancer
+}
+
+func (m *saramaBalancer) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	var key []byte
+	if msg.Key != nil {
+		var err error
+		if key, err = msg.Key.Encode(); err != nil {
+			return 0, err
+		}
+	}
+	partitions := make([]int, numPartitions)
+	for i := range partitions {
+		partitions[i] = i
+	}
+	return int32(m.balancer.Balance(kafka.Message{Key: key}, partitions...)), nil
+}
+
+func (m *saramaBalancer) RequiresConsistency() bool {
+	return true
+}
+
+func (m *KafkaTxnWriter) logConfigToSpan(span opentracing.Span) {
+	span.LogFields(
+		log.String(spanLogKeyMQType, fmt.Sprint(MQTypeKafka)),
+		log.String(spanLogKeyKafkaBrokers, strings.Join(m.brokers, apolloBrokersSep)),
+	)
+}
+
+func (m *KafkaTxnWriter) newProducerMessage(key string, v interface{}) (*sarama.ProducerMessage, error) {
+	kmsg, err := newKafkaMessage(key, v, m.headerCarrier)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic: m.topic,
+		Key:   sarama.ByteEncoder(kmsg.Key),
+		Value: sarama.ByteEncoder(kmsg.Value),
+	}
+	for _, h := range kmsg.Headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(h.Key), Value: h.Value})
+	}
+	return msg, nil
+}
+
+func (m *KafkaTxnWriter) newProducerMessages(msgs []Message) ([]*sarama.ProducerMessage, error) {
+	var pmsgs []*sarama.ProducerMessage
+	for _, msg := range msgs {
+		pmsg, err := m.newProducerMessage(msg.Key, msg.Value)
+		if err != nil {
+			return nil, err
+		}
+		pmsgs = append(pmsgs, pmsg)
+	}
+	return pmsgs, nil
+}
+
+func (m *KafkaTxnWriter) WriteMsg(ctx context.Context, k string, v interface{}) error {
+	return m.WriteMsgs(ctx, Message{Key: k, Value: v})
+}
+
+// WriteMsgs 事务 writer 在事务外调用时，msgs 在同一个事务中写入，全部成功或全部丢弃
+func (m *KafkaTxnWriter) WriteMsgs(ctx context.Context, msgs ...Message) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	pmsgs, err := m.newProducerMessages(msgs)
+	if err != nil {
+		return err
+	}
+	return m.writeMessages(pmsgs)
+}
+
+// WriteMsgsResult 成功的消息返回 broker 确认的 partition 与 offset，事务 writer 的一批消息全部成功或全部失败，
+// 只开启幂等时逐条返回失败的原因
+func (m *KafkaTxnWriter) WriteMsgsResult(ctx context.Context, msgs ...Message) []MsgResult {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	pmsgs, err := m.newProducerMessages(msgs)
+	if err != nil {
+		return newMsgResults(msgs, err)
+	}
+	err = m.writeMessages(pmsgs)
+
+	var perrs sarama.ProducerErrors
+	if err != nil && (m.producer.IsTransactional() || !errors.As(err, &perrs)) {
+		return newMsgResults(msgs, err)
+	}
+	failed := make(map[*sarama.ProducerMessage]error, len(perrs))
+	for _, perr := range perrs {
+		failed[perr.Msg] = perr.Err
+	}
+
+	results := make([]MsgResult, len(msgs))
+	for i, pmsg := range pmsgs {
+		results[i] = MsgResult{
+			Key:       msgs[i].Key,
+			Partition: int(pmsg.Partition),
+			Offset:    pmsg.Offset,
+		}
+		if err, ok := failed[pmsg]; ok {
+			results[i].Partition = unknownPartition
+			results[i].Offset = unknownOffset
+			results[i].Err = err
+		}
+	}
+	return results
+}
+
+func (m *KafkaTxnWriter) writeMessages(pmsgs []*sarama.ProducerMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.producer.IsTransactional() || m.inTxn {
+		return m.txnError(m.sendMessages(pmsgs))
+	}
+
+	if err := m.producer.BeginTxn(); err != nil {
+		return m.txnError(err)
+	}
+	if err := m.sendMessages(pmsgs); err != nil {
+		m.abortTxn()
+		return m.txnError(err)
+	}
+	if err := m.producer.CommitTxn(); err != nil {
+		m.abortTxn()
+		return m.txnError(err)
+	}
+	return nil
+}
+
+func (m *KafkaTxnWriter) sendMessages(msgs []*sarama.ProducerMessage) error {
+	if len(msgs) == 1 {
+		_, _, err := m.producer.SendMessage(msgs[0])
+		return err
+	}
+	return m.producer.SendMessages(msgs)
+}
+
+func (m *KafkaTxnWriter) BeginTxn() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.producer.BeginTxn(); err != nil {
+		return m.txnError(err)
+	}
+	m.inTxn = true
+	return nil
+}
+
+// CommitTxn 提交失败时事务已经 abort
+func (m *KafkaTxnWriter) CommitTxn() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inTxn = false
+	if err := m.producer.CommitTxn(); err != nil {
+		m.abortTxn()
+		return m.txnError(err)
+	}
+	return nil
+}
+
+func (m *KafkaTxnWriter) AbortTxn() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inTxn = false
+	return m.txnError(m.producer.AbortTxn())
+}
+
+// abortTxn 被 fence 等不可恢复的错误无法 abort，由 txnError 返回 ErrProducerFenced
+func (m *KafkaTxnWriter) abortTxn() {
+	if m.producer.TxnStatus()&sarama.ProducerTxnFlagFatalError == 0 {
+		_ = m.producer.AbortTxn()
+	}
+}
+
+// txnError 被 fence 时返回 ErrProducerFenced
+func (m *KafkaTxnWriter) txnError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if isProducerFenced(err) {
+		return fmt.Errorf("%w: %v", ErrProducerFenced, err)
+	}
+	return err
+}
+
+func isProducerFenced(err error) bool {
+	var perrs sarama.ProducerErrors
+	if errors.As(err, &perrs) {
+		for _, perr := range perrs {
+			if isProducerFenced(perr.Err) {
+				return true
+			}
+		}
+		return false
+	}
+	return errors.Is(err, sarama.ErrProducerFenced) || errors.Is(err, sarama.ErrInvalidProducerEpoch)
+}
+
+func (m *KafkaTxnWriter) Close() error {
+	return m.producer.Close()
+}
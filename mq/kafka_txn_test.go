@@ -0,0 +1,225 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/kaneshin/go-pkg/testing/assert"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// txnProducer 记录事务的提交与回滚次数
+type txnProducer struct {
+	*mocks.SyncProducer
+	commits int
+	aborts  int
+}
+
+func (m *txnProducer) CommitTxn() error {
+	m.commits++
+	return m.SyncProducer.CommitTxn()
+}
+
+func (m *txnProducer) AbortTxn() error {
+	m.aborts++
+	return m.SyncProducer.AbortTxn()
+}
+
+func newTestTxnWriter(t *testing.T, txnID string) (*KafkaTxnWriter, *txnProducer) {
+	config, err := kafkaTxnConfig(txnID, "", nil, AuthConfig{})
+	assert.Equal(t, err, nil)
+	producer := &txnProducer{SyncProducer: mocks.NewSyncProducer(t, config)}
+	return newKafkaTxnWriter(producer, []string{"k1:9092"}, "palfish.test", true), producer
+}
+
+func TestKafkaTxnConfig(t *testing.T) {
+	config, err := kafkaTxnConfig("", "", nil, AuthConfig{})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, config.Producer.Idempotent, true)
+	assert.Equal(t, config.Producer.RequiredAcks, sarama.WaitForAll)
+	assert.Equal(t, config.Net.MaxOpenRequests, 1)
+	assert.Equal(t, config.Producer.Transaction.ID, "")
+	assert.Equal(t, config.Validate(), nil)
+
+	config, err = kafkaTxnConfig("orders", "Snappy", nil, AuthConfig{SASLMechanism: saslMechanismScramSHA512, SASLUsername: "u", SASLPassword: "p"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, config.Producer.Transaction.ID, "orders")
+	assert.Equal(t, config.Producer.Compression, sarama.CompressionSnappy)
+	assert.Equal(t, config.Net.SASL.Mechanism, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512))
+	assert.Equal(t, config.Validate(), nil)
+
+	_, err = kafkaTxnConfig("", "brotli", nil, AuthConfig{})
+	assert.True(t, err != nil)
+	_, err = kafkaTxnConfig("", "", nil, AuthConfig{SASLMechanism: "GSSAPI"})
+	assert.True(t, err != nil)
+}
+
+func TestKafkaTxnID(t *testing.T) {
+	assert.Equal(t, kafkaTxnID("orders", ""), "orders")
+	assert.Equal(t, kafkaTxnID("orders", "pod-0"), "orders.pod-0")
+
+	assert.Equal(t, kafkaIsolationLevel(&Config{}), kafka.ReadUncommitted)
+	assert.Equal(t, kafkaIsolationLevel(&Config{TxnID: "orders"}), kafka.ReadCommitted)
+}
+
+func TestSaramaBalancer(t *testing.T) {
+	balancer := &saramaBalancer{balancer: &kafka.Hash{}}
+	partitions := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	for _, key := range []string{"k1", "k2", "k3", "order-100"} {
+		p, err := balancer.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder(key)}, int32(len(partitions)))
+		assert.Equal(t, err, nil)
+		expected := (&kafka.Hash{}).Balance(kafka.Message{Key: []byte(key)}, partitions...)
+		assert.Equal(t, int(p), expected)
+	}
+}
+
+func TestKafkaTxnWriter_WriteMsg(t *testing.T) {
+	ctx := context.TODO()
+	w, producer := newTestTxnWriter(t, "orders")
+
+	// 事务外的写入各自在一个事务中提交
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		key, _ := msg.Key.Encode()
+		if string(key) != "k1" || msg.Topic != "palfish.test" {
+			return errors.New("unexpected message")
+		}
+		for _, h := range msg.Headers {
+			if string(h.Key) == kafkaHeaderCodec {
+				return nil
+			}
+		}
+		return errors.New("no codec header")
+	})
+	assert.Equal(t, w.WriteMsg(ctx, "k1", &Payload{Value: `{"id":1}`}), nil)
+	assert.Equal(t, producer.commits, 1)
+	assert.Equal(t, producer.aborts, 0)
+
+	// 写入失败时回滚
+	producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+	err := w.WriteMsg(ctx, "k2", &Payload{Value: `{"id":2}`})
+	assert.True(t, errors.Is(err, sarama.ErrNotEnoughReplicas))
+	assert.False(t, errors.Is(err, ErrProducerFenced))
+	assert.Equal(t, producer.commits, 1)
+	assert.Equal(t, producer.aborts, 1)
+
+	assert.Equal(t, w.Close(), nil)
+}
+
+func TestKafkaTxnWriter_Txn(t *testing.T) {
+	ctx := context.TODO()
+	w, producer := newTestTxnWriter(t, "orders")
+
+	assert.Equal(t, w.BeginTxn(), nil)
+	producer.ExpectSendMessageAndSucceed()
+	producer.ExpectSendMessageAndSucceed()
+	producer.ExpectSendMessageAndSucceed()
+	assert.Equal(t, w.WriteMsg(ctx, "k1", &Payload{Value: `{"id":1}`}), nil)
+	assert.Equal(t, w.WriteMsgs(ctx, Message{Key: "k2", Value: &Payload{Value: `{"id":2}`}}, Message{Key: "k3", Value: &Payload{Value: `{"id":3}`}}), nil)
+	assert.Equal(t, producer.commits, 0)
+	assert.Equal(t, w.CommitTxn(), nil)
+	assert.Equal(t, producer.commits, 1)
+
+	assert.Equal(t, w.BeginTxn(), nil)
+	producer.ExpectSendMessageAndSucceed()
+	assert.Equal(t, w.WriteMsg(ctx, "k4", &Payload{Value: `{"id":4}`}), nil)
+	assert.Equal(t, w.AbortTxn(), nil)
+	assert.Equal(t, producer.commits, 1)
+	assert.Equal(t, producer.aborts, 1)
+
+	assert.Equal(t, w.Close(), nil)
+}
+
+func TestKafkaTxnWriter_fenced(t *testing.T) {
+	ctx := context.TODO()
+	w, producer := newTestTxnWriter(t, "orders")
+
+	producer.ExpectSendMessageAndFail(sarama.ErrProducerFenced)
+	assert.True(t, errors.Is(w.WriteMsg(ctx, "k1", &Payload{Value: `{"id":1}`}), ErrProducerFenced))
+
+	producer.ExpectSendMessageAndFail(sarama.ProducerErrors{
+		{Msg: &sarama.ProducerMessage{Topic: "palfish.test"}, Err: sarama.ErrInvalidProducerEpoch},
+	})
+	producer.ExpectSendMessageAndSucceed()
+	err := w.WriteMsgs(ctx, Message{Key: "k2", Value: &Payload{Value: `{"id":2}`}}, Message{Key: "k3", Value: &Payload{Value: `{"id":3}`}})
+	assert.True(t, errors.Is(err, ErrProducerFenced))
+	assert.Equal(t, producer.commits, 0)
+}
+
+func TestKafkaTxnWriter_idempotent(t *testing.T) {
+	ctx := context.TODO()
+	w, producer := newTestTxnWriter(t, "")
+
+	// 没有 transactionalID 时不开启事务
+	producer.ExpectSendMessageAndSucceed()
+	assert.Equal(t, w.WriteMsg(ctx, "k1", &Payload{Value: `{"id":1}`}), nil)
+	assert.Equal(t, producer.commits, 0)
+}
+
+func TestKafkaTxnWriter_WriteMsgsResult(t *testing.T) {
+	ctx := context.TODO()
+	w, producer := newTestTxnWriter(t, "")
+
+	producer.ExpectSendMessageAndSucceed()
+	producer.ExpectSendMessageAndSucceed()
+	results := w.WriteMsgsResult(ctx, Message{Key: "k1", Value: &Payload{Value: `{"id":1}`}}, Message{Key: "k2", Value: &Payload{Value: `{"id":2}`}})
+	assert.Equal(t, len(results), 2)
+	for i, r := range results {
+		assert.Equal(t, r.Err, nil)
+		assert.Equal(t, r.Offset, int64(i+1))
+		assert.True(t, r.Partition >= 0)
+	}
+
+	// 事务中任意一条失败时整批失败
+	w, producer = newTestTxnWriter(t, "orders")
+	producer.ExpectSendMessageAndSucceed()
+	producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+	results = w.WriteMsgsResult(ctx, Message{Key: "k1", Value: &Payload{Value: `{"id":1}`}}, Message{Key: "k2", Value: &Payload{Value: `{"id":2}`}})
+	for _, r := range results {
+		assert.True(t, errors.Is(r.Err, sarama.ErrNotEnoughReplicas))
+		assert.Equal(t, r.Offset, int64(unknownOffset))
+	}
+	assert.Equal(t, producer.aborts, 1)
+}
+
+func TestTxnWriter_publish(t *testing.T) {
+	defer resetInterceptors()
+	ctx := context.TODO()
+	kw, producer := newTestTxnWriter(t, "orders")
+	w := &txnWriter{writer: kw, topic: "test"}
+
+	var published []string
+	UsePublishInterceptors(func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, topic string, msgs ...Message) error {
+			for _, msg := range msgs {
+				published = append(published, msg.Key)
+			}
+			return next(ctx, topic, msgs...)
+		}
+	})
+
+	// 写入 writer 的是编码后的 Payload，header carrier 时消息体为 Payload.Value
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		value, _ := msg.Value.Encode()
+		if string(value) != `{"id":1}` {
+			return errors.New("unexpected payload")
+		}
+		for _, h := range msg.Headers {
+			if string(h.Key) == kafkaHeaderCodec {
+				return nil
+			}
+		}
+		return errors.New("no codec header")
+	})
+	assert.Equal(t, w.WriteMsg(ctx, "k1", map[string]int{"id": 1}), nil)
+
+	producer.ExpectSendMessageAndSucceed()
+	producer.ExpectSendMessageAndSucceed()
+	results := w.WriteMsgsResult(ctx, Message{Key: "k2", Value: 2}, Message{Key: "k3", Value: 3})
+	assert.Equal(t, len(results), 2)
+	assert.Equal(t, results[1].Offset, int64(3))
+	assert.Equal(t, published, []string{"k1", "k2", "k3"})
+	assert.Equal(t, producer.commits, 2)
+}
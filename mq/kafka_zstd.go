@@ -0,0 +1,17 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package mq
+
+import (
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/zstd"
+)
+
+func init() {
+	kafkaCompressionCodecs["zstd"] = func() kafka.CompressionCodec { return zstd.NewCompressionCodec() }
+}
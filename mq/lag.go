@@ -0,0 +1,104 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+const defaultLagInterval = 30 * time.Second
+
+// PartitionLag group 在一个 partition 上的消费进度，Committed 为下一条待消费消息的 offset，
+// HighWatermark 为下一条写入消息的 offset
+type PartitionLag struct {
+	Topic         string
+	GroupID       string
+	Partition     int
+	Committed     int64
+	HighWatermark int64
+	Lag           int64
+}
+
+// lagReader 由能够获取 group 消费进度的 reader 实现
+type lagReader interface {
+	lags(ctx context.Context) ([]PartitionLag, error)
+}
+
+// LagCallback 每次计算 lag 后调用，用于接入告警
+type LagCallback func(ctx context.Context, lags []PartitionLag)
+
+// CollectLags 计算当前进程中所有 group reader 的 lag 并更新 consumer_lag gauge，
+// 只包含支持的后端，见各 reader 的 lags
+func CollectLags(ctx context.Context) []PartitionLag {
+	fun := "mq.CollectLags -->"
+
+	var lags []PartitionLag
+	defaultInstanceManager.instances.Range(func(key, val interface{}) bool {
+		sk, ok := key.(string)
+		if !ok {
+			return true
+		}
+		conf, err := defaultInstanceManager.confFromKey(sk)
+		if err != nil || conf.role != RoleTypeReader || conf.groupId == "" {
+			return true
+		}
+		reader, ok := val.(lagReader)
+		if !ok {
+			return true
+		}
+
+		plags, err := reader.lags(ctx)
+		if err != nil {
+			slog.Warnf(ctx, "%s get lags err: %v, topic: %s, groupId: %s", fun, err, conf.topic, conf.groupId)
+			return true
+		}
+		for _, l := range plags {
+			l.Topic = conf.topic
+			l.GroupID = conf.groupId
+			_metricConsumerLag.With("topic", l.Topic, "group", l.GroupID, "partition", strconv.Itoa(l.Partition)).Set(float64(l.Lag))
+			lags = append(lags, l)
+		}
+		return true
+	})
+	return lags
+}
+
+// StartLagMonitor 每 interval 调用一次 CollectLags，直到 ctx 结束，interval <= 0 时使用 defaultLagInterval，callback 可以为 nil
+func StartLagMonitor(ctx context.Context, interval time.Duration, callback LagCallback) {
+	if interval <= 0 {
+		interval = defaultLagInterval
+	}
+	go monitorLags(ctx, interval, callback)
+}
+
+func monitorLags(ctx context.Context, interval time.Duration, callback LagCallback) {
+	fun := "mq.monitorLags -->"
+	defer func() {
+		if err := recover(); err != nil {
+			buf := make([]byte, 4096)
+			buf = buf[:runtime.Stack(buf, false)]
+			slog.Errorf(ctx, "%s recover err: %v, stack: %s", fun, err, string(buf))
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			lags := CollectLags(ctx)
+			if callback != nil {
+				callback(ctx, lags)
+			}
+		}
+	}
+}
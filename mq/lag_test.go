@@ -0,0 +1,58 @@
+package mq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func findLag(lags []PartitionLag, topic, groupId string) (PartitionLag, bool) {
+	for _, l := range lags {
+		if l.Topic == topic && l.GroupID == groupId {
+			return l, true
+		}
+	}
+	return PartitionLag{}, false
+}
+
+func TestCollectLags(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	ctx := context.TODO()
+	topic := "palfish.test.lag"
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, WriteMsg(ctx, topic, "", &memoryTestMsg{ID: i}), nil)
+	}
+	var v memoryTestMsg
+	for i := 0; i < 2; i++ {
+		_, err := ReadMsgByGroup(ctx, topic, "g1", &v)
+		assert.Equal(t, err, nil)
+	}
+
+	l, ok := findLag(CollectLags(ctx), topic, "g1")
+	assert.Equal(t, ok, true)
+	assert.Equal(t, l.Partition, 0)
+	assert.Equal(t, l.Committed, int64(2))
+	assert.Equal(t, l.HighWatermark, int64(5))
+	assert.Equal(t, l.Lag, int64(3))
+
+	mctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	got := make(chan []PartitionLag, 1)
+	StartLagMonitor(mctx, 10*time.Millisecond, func(ctx context.Context, lags []PartitionLag) {
+		select {
+		case got <- lags:
+		default:
+		}
+	})
+	select {
+	case lags := <-got:
+		l, ok = findLag(lags, topic, "g1")
+		assert.Equal(t, ok, true)
+		assert.Equal(t, l.Lag, int64(3))
+	case <-time.After(time.Second):
+		t.Fatal("lag monitor timeout")
+	}
+}
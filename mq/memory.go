@@ -0,0 +1,411 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/shawnfeng/sutil/sconf/center"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 进程内的 mq 实现，用于单元测试，消息同样经过 Payload 包装与 json 序列化，
+// 每个 topic 保留全部消息，新的 group 从第一条消息开始消费，同一 group 的多个 reader 共享消费位置
+//
+//	mq.SetConfiger(ctx, mq.ConfigerTypeMemory)
+//	defer mq.ResetMemoryBroker()
+
+type memoryMessage struct {
+	key   string
+	value []byte
+	time  time.Time
+	// 在 topic 中的位置，读取时设置
+	offset int64
+}
+
+type memoryTopic struct {
+	mu   sync.Mutex
+	msgs []memoryMessage
+	// 每次写入后关闭并替换，用于唤醒等待中的 reader
+	notify chan struct{}
+	// groupId -> 下一条待消费消息的下标
+	offsets map[string]int
+}
+
+func newMemoryTopic() *memoryTopic {
+	return &memoryTopic{
+		notify:  make(chan struct{}),
+		offsets: make(map[string]int),
+	}
+}
+
+// append 返回第一条消息的下标
+func (m *memoryTopic) append(msgs ...memoryMessage) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	offset := len(m.msgs)
+	m.msgs = append(m.msgs, msgs...)
+	close(m.notify)
+	m.notify = make(chan struct{})
+	return offset
+}
+
+// next 返回 group 的下一条消息并移动消费位置，没有消息时阻塞直到有新消息或 ctx 结束
+func (m *memoryTopic) next(ctx context.Context, group string) (memoryMessage, error) {
+	for {
+		m.mu.Lock()
+		offset := m.offsets[group]
+		if offset < len(m.msgs) {
+			msg := m.msgs[offset]
+			msg.offset = int64(offset)
+			m.offsets[group] = offset + 1
+			m.mu.Unlock()
+			return msg, nil
+		}
+		notify := m.notify
+		m.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return memoryMessage{}, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+func (m *memoryTopic) setOffset(group string, offset int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case offset == LastOffset:
+		m.offsets[group] = len(m.msgs)
+	case offset < 0:
+		m.offsets[group] = 0
+	case offset > int64(len(m.msgs)):
+		m.offsets[group] = len(m.msgs)
+	default:
+		m.offsets[group] = int(offset)
+	}
+}
+
+func (m *memoryTopic) setOffsetAt(group string, t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.offsets[group] = sort.Search(len(m.msgs), func(i int) bool {
+		return !m.msgs[i].time.Before(t)
+	})
+}
+
+func (m *memoryTopic) deleteGroup(group string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.offsets, group)
+}
+
+// lag 内存 topic 只有一个 partition
+func (m *memoryTopic) lag(group string) PartitionLag {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	committed := int64(m.offsets[group])
+	hw := int64(len(m.msgs))
+	return PartitionLag{
+		Committed:     committed,
+		HighWatermark: hw,
+		Lag:           hw - committed,
+	}
+}
+
+func (m *memoryTopic) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.msgs)
+}
+
+type memoryBroker struct {
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+	// 分区 reader 使用独立的消费位置
+	seq int
+}
+
+var defaultMemoryBroker = &memoryBroker{
+	topics: make(map[string]*memoryTopic),
+}
+
+func (m *memoryBroker) topic(name string) *memoryTopic {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.topics[name]
+	if !ok {
+		t = newMemoryTopic()
+		m.topics[name] = t
+	}
+	return t
+}
+
+func (m *memoryBroker) privateGroup() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seq++
+	return fmt.Sprintf("__partition.%d", m.seq)
+}
+
+// ResetMemoryBroker 清空内存 mq 的全部消息与消费位置，并关闭已创建的实例
+func ResetMemoryBroker() {
+	defaultInstanceManager.Close()
+
+	defaultMemoryBroker.mu.Lock()
+	defer defaultMemoryBroker.mu.Unlock()
+	defaultMemoryBroker.topics = make(map[string]*memoryTopic)
+}
+
+// MemoryTopicLen 返回内存 mq 中 topic 已写入的消息数，用于测试断言
+func MemoryTopicLen(topic string) int {
+	return defaultMemoryBroker.topic(topic).len()
+}
+
+type MemoryConfig struct{}
+
+func NewMemoryConfiger() *MemoryConfig {
+	return &MemoryConfig{}
+}
+
+func (m *MemoryConfig) Init(ctx context.Context) error {
+	fun := "MemoryConfig.Init-->"
+	slog.Infof(ctx, "%s start", fun)
+	return nil
+}
+
+// GetConfig 所有读写 topic 都使用内存 mq，不支持延迟队列
+func (m *MemoryConfig) GetConfig(ctx context.Context, topic string, mqType MQType) (*Config, error) {
+	fun := "MemoryConfig.GetConfig-->"
+	if mqType == MQTypeDelay {
+		return nil, fmt.Errorf("%s delay not supported, topic: %s", fun, topic)
+	}
+
+	return &Config{
+		MQType:         MQTypeMemory,
+		Topic:          topic,
+		TimeOut:        defaultTimeout,
+		CommitInterval: 0,
+		Offset:         FirstOffset,
+	}, nil
+}
+
+func (m *MemoryConfig) ParseKey(ctx context.Context, k string) (*KeyParts, error) {
+	fun := "MemoryConfig.ParseKey-->"
+	return nil, fmt.Errorf("%s not implemented", fun)
+}
+
+func (m *MemoryConfig) Watch(ctx context.Context) <-chan *center.ChangeEvent {
+	return nil
+}
+
+type MemoryHandler struct {
+	key    string
+	time   time.Time
+	offset int64
+}
+
+func (m *MemoryHandler) CommitMsg(ctx context.Context) error {
+	return nil
+}
+
+func (m *MemoryHandler) msgKey() string {
+	return m.key
+}
+
+// msgPartition 内存 topic 只有一个 partition
+func (m *MemoryHandler) msgPartition() int {
+	return 0
+}
+
+func (m *MemoryHandler) msgTime() time.Time {
+	return m.time
+}
+
+func (m *MemoryHandler) msgOffset() int64 {
+	return m.offset
+}
+
+type MemoryReader struct {
+	topic *memoryTopic
+	group string
+}
+
+func NewMemoryReader(topic, groupId string) *MemoryReader {
+	group := groupId
+	if len(group) == 0 {
+		group = defaultMemoryBroker.privateGroup()
+	}
+	return &MemoryReader{
+		topic: defaultMemoryBroker.topic(topic),
+		group: group,
+	}
+}
+
+func (m *MemoryReader) logConfigToSpan(span opentracing.Span) {
+	span.LogFields(
+		log.String(spanLogKeyMQType, fmt.Sprint(MQTypeMemory)),
+		log.String(spanLogKeyKafkaGroupID, m.group),
+	)
+}
+
+func (m *MemoryReader) ReadMsg(ctx context.Context, v interface{}, ov interface{}) error {
+	_, err := m.FetchMsg(ctx, v, ov)
+	return err
+}
+
+// FetchMsg 取出即移动消费位置，未提交的消息不会重新投递
+func (m *MemoryReader) FetchMsg(ctx context.Context, v interface{}, ov interface{}) (Handler, error) {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	msg, err := m.topic.next(ctx, m.group)
+	if err != nil {
+		return nil, err
+	}
+
+	err = unmarshalMsg(msg.value, v)
+	if err != nil {
+		return nil, err
+	}
+
+	err = unmarshalMsg(msg.value, ov)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemoryHandler{key: msg.key, time: msg.time, offset: msg.offset}, nil
+}
+
+func (m *MemoryReader) SetOffsetAt(ctx context.Context, t time.Time) error {
+	m.topic.setOffsetAt(m.group, t)
+	return nil
+}
+
+func (m *MemoryReader) SetOffset(ctx context.Context, offset int64) error {
+	m.topic.setOffset(m.group, offset)
+	return nil
+}
+
+func (m *MemoryReader) lags(ctx context.Context) ([]PartitionLag, error) {
+	return []PartitionLag{m.topic.lag(m.group)}, nil
+}
+
+func (m *MemoryReader) deleteGroup(ctx context.Context) error {
+	m.topic.deleteGroup(m.group)
+	return nil
+}
+
+func (m *MemoryReader) Close() error {
+	return nil
+}
+
+type MemoryWriter struct {
+	topic *memoryTopic
+}
+
+func NewMemoryWriter(topic string) *MemoryWriter {
+	return &MemoryWriter{
+		topic: defaultMemoryBroker.topic(topic),
+	}
+}
+
+func (m *MemoryWriter) logConfigToSpan(span opentracing.Span) {
+	span.LogFields(
+		log.String(spanLogKeyMQType, fmt.Sprint(MQTypeMemory)),
+	)
+}
+
+func (m *MemoryWriter) WriteMsg(ctx context.Context, k string, v interface{}) error {
+	return m.WriteMsgs(ctx, Message{Key: k, Value: v})
+}
+
+func (m *MemoryWriter) WriteMsgs(ctx context.Context, msgs ...Message) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	now := time.Now()
+	var mmsgs []memoryMessage
+	for _, msg := range msgs {
+		body, err := marshalMsg(msg.Value)
+		if err != nil {
+			return err
+		}
+		mmsgs = append(mmsgs, memoryMessage{
+			key:   msg.Key,
+			value: body,
+			time:  now,
+		})
+	}
+	if len(mmsgs) == 0 {
+		return nil
+	}
+
+	m.topic.append(mmsgs...)
+	return nil
+}
+
+// WriteMsgsResult 内存 mq 只有一个分区，offset 为消息在 topic 中的下标
+func (m *MemoryWriter) WriteMsgsResult(ctx context.Context, msgs ...Message) []MsgResult {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	results := newMsgResults(msgs, nil)
+	now := time.Now()
+	for i, msg := range msgs {
+		body, err := marshalMsg(msg.Value)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Partition = 0
+		results[i].Offset = int64(m.topic.append(memoryMessage{
+			key:   msg.Key,
+			value: body,
+			time:  now,
+		}))
+	}
+	return results
+}
+
+func (m *MemoryWriter) WriteMsgDelay(ctx context.Context, k string, v interface{}, delay time.Duration) error {
+	body, err := marshalMsg(v)
+	if err != nil {
+		return err
+	}
+
+	time.AfterFunc(delay, func() {
+		m.topic.append(memoryMessage{
+			key:   k,
+			value: body,
+			time:  time.Now(),
+		})
+	})
+	return nil
+}
+
+func (m *MemoryWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,126 @@
+package mq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+type memoryTestMsg struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func useMemoryConfiger(t *testing.T) func() {
+	old := DefaultConfiger
+	err := SetConfiger(context.TODO(), ConfigerTypeMemory)
+	assert.Equal(t, err, nil)
+	ResetMemoryBroker()
+	return func() {
+		ResetMemoryBroker()
+		DefaultConfiger = old
+	}
+}
+
+func TestMemoryMQ(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	tracer := mocktracer.New()
+	oldTracer := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(oldTracer)
+
+	topic := "palfish.test.memory"
+	span, ctx := opentracing.StartSpanFromContext(context.TODO(), "producer")
+	err := WriteMsg(ctx, topic, "k1", &memoryTestMsg{ID: 1, Name: "a"})
+	assert.Equal(t, err, nil)
+	err = WriteMsgs(ctx, topic, Message{Key: "k2", Value: &memoryTestMsg{ID: 2, Name: "b"}})
+	assert.Equal(t, err, nil)
+	span.Finish()
+	assert.Equal(t, MemoryTopicLen(topic), 2)
+
+	var msg memoryTestMsg
+	mctx, err := ReadMsgByGroup(context.TODO(), topic, "g1", &msg)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, msg.ID, 1)
+	mspan := opentracing.SpanFromContext(mctx)
+	assert.True(t, mspan != nil)
+	assert.Equal(t, mspan.(*mocktracer.MockSpan).SpanContext.TraceID, span.(*mocktracer.MockSpan).SpanContext.TraceID)
+
+	_, handler, err := FetchMsgByGroup(context.TODO(), topic, "g1", &msg)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, msg.ID, 2)
+	assert.Equal(t, handler.CommitMsg(context.TODO()), nil)
+
+	// 不同的 group 各自从头消费
+	_, err = ReadMsgByGroup(context.TODO(), topic, "g2", &msg)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, msg.ID, 1)
+
+	tctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	_, err = ReadMsgByGroup(tctx, topic, "g1", &msg)
+	assert.True(t, err != nil)
+}
+
+func TestMemoryReader_SetOffset(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	ctx := context.TODO()
+	writer := NewMemoryWriter("palfish.test.offset")
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, writer.WriteMsg(ctx, "", &Payload{Value: "1"}), nil)
+	}
+
+	reader := NewMemoryReader("palfish.test.offset", "")
+	var payload Payload
+	var ov map[string]interface{}
+	assert.Equal(t, reader.SetOffset(ctx, 2), nil)
+	assert.Equal(t, reader.ReadMsg(ctx, &payload, &ov), nil)
+
+	assert.Equal(t, reader.SetOffset(ctx, LastOffset), nil)
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	assert.True(t, reader.ReadMsg(tctx, &payload, &ov) != nil)
+
+	assert.Equal(t, reader.SetOffsetAt(ctx, time.Time{}), nil)
+	assert.Equal(t, reader.ReadMsg(ctx, &payload, &ov), nil)
+}
+
+func TestSeekByGroup(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	ctx := context.TODO()
+	topic := "palfish.test.seek"
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, WriteMsg(ctx, topic, "", &memoryTestMsg{ID: i}), nil)
+	}
+
+	var v memoryTestMsg
+	for i := 0; i < 3; i++ {
+		_, err := ReadMsgByGroup(ctx, topic, "g1", &v)
+		assert.Equal(t, err, nil)
+	}
+	assert.Equal(t, v.ID, 2)
+
+	assert.Equal(t, SeekOffsetByGroup(ctx, topic, "g1", 1), nil)
+	_, err := ReadMsgByGroup(ctx, topic, "g1", &v)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, v.ID, 1)
+
+	assert.Equal(t, SeekByGroup(ctx, topic, "g1", time.Time{}), nil)
+	_, err = ReadMsgByGroup(ctx, topic, "g1", &v)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, v.ID, 0)
+
+	assert.Equal(t, SeekByGroup(ctx, topic, "g1", time.Now().Add(time.Hour)), nil)
+	assert.Equal(t, MemoryTopicLen(topic), 3)
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = ReadMsgByGroup(tctx, topic, "g1", &v)
+	assert.True(t, err != nil)
+}
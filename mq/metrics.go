@@ -0,0 +1,208 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+	"gitlab.pri.ibanyu.com/middleware/seaweed/xstat/xmetric/xprometheus"
+)
+
+const (
+	namespace = "palfish"
+	subsystem = "mq"
+)
+
+// 写入失败的错误类型
+const (
+	produceErrTimeout     = "timeout"
+	produceErrUnavailable = "unavailable"
+	produceErrTooLarge    = "too_large"
+	produceErrEncode      = "encode"
+	produceErrNoWriter    = "no_writer"
+	produceErrOther       = "other"
+)
+
+var (
+	_metricConsumerLag = xprometheus.NewGauge(&xprometheus.GaugeVecOpts{
+		Namespace:  namespace,
+		Subsystem:  subsystem,
+		Name:       "consumer_lag",
+		Help:       "mq consumer group lag, high watermark minus committed offset",
+		LabelNames: []string{"topic", "group", "partition"},
+	})
+
+	_metricProduceMsgs = xprometheus.NewCounter(&xprometheus.CounterVecOpts{
+		Namespace:  namespace,
+		Subsystem:  subsystem,
+		Name:       "produce_msgs_total",
+		Help:       "mq messages written successfully",
+		LabelNames: []string{"topic"},
+	})
+
+	_metricProduceErr = xprometheus.NewCounter(&xprometheus.CounterVecOpts{
+		Namespace:  namespace,
+		Subsystem:  subsystem,
+		Name:       "produce_err_total",
+		Help:       "mq messages failed to write",
+		LabelNames: []string{"topic", "type"},
+	})
+
+	_metricProduceBatchSize = xprometheus.NewHistogram(&xprometheus.HistogramVecOpts{
+		Namespace:  namespace,
+		Subsystem:  subsystem,
+		Name:       "produce_batch_size",
+		Help:       "mq messages per write call",
+		LabelNames: []string{"topic"},
+		Buckets:    []float64{1, 5, 10, 50, 100, 500, 1000},
+	})
+
+	_metricProduceDuration = xprometheus.NewHistogram(&xprometheus.HistogramVecOpts{
+		Namespace:  namespace,
+		Subsystem:  subsystem,
+		Name:       "produce_duration_ms",
+		Help:       "mq write call duration(ms)",
+		LabelNames: []string{"topic"},
+		Buckets:    []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500},
+	})
+
+	// 写入到开始处理的时间，只统计第一次投递，重新投递与 Replay 的消息不统计，延迟消息包含延迟的时间
+	_metricConsumeLatency = xprometheus.NewHistogram(&xprometheus.HistogramVecOpts{
+		Namespace:  namespace,
+		Subsystem:  subsystem,
+		Name:       "consume_latency_ms",
+		Help:       "mq end-to-end latency(ms) from produce to consume",
+		LabelNames: []string{"topic", "group"},
+		Buckets:    []float64{10, 50, 100, 500, 1000, 5000, 10000, 60000, 300000, 1800000},
+	})
+
+	_metricConsumeFiltered = xprometheus.NewCounter(&xprometheus.CounterVecOpts{
+		Namespace:  namespace,
+		Subsystem:  subsystem,
+		Name:       "consume_filtered_total",
+		Help:       "mq messages dropped by consume filters",
+		LabelNames: []string{"topic", "group"},
+	})
+
+	_metricConsumePoison = xprometheus.NewCounter(&xprometheus.CounterVecOpts{
+		Namespace:  namespace,
+		Subsystem:  subsystem,
+		Name:       "consume_poison_total",
+		Help:       "mq messages that failed max attempts, by action: dlq or skip",
+		LabelNames: []string{"topic", "group", "action"},
+	})
+
+	_metricConsumeDeduped = xprometheus.NewCounter(&xprometheus.CounterVecOpts{
+		Namespace:  namespace,
+		Subsystem:  subsystem,
+		Name:       "consume_deduped_total",
+		Help:       "mq messages skipped because they were already processed",
+		LabelNames: []string{"topic", "group"},
+	})
+)
+
+// produceErrType 按 Cause 或 Unwrap 逐层查找错误的类型
+func produceErrType(err error) string {
+	for err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return produceErrTimeout
+		}
+		switch e := err.(type) {
+		case kafka.MessageTooLargeError:
+			return produceErrTooLarge
+		case kafka.Error:
+			if e == kafka.MessageSizeTooLarge {
+				return produceErrTooLarge
+			}
+			if e == kafka.NotLeaderForPartition {
+				return produceErrUnavailable
+			}
+		case *net.OpError:
+			if e.Timeout() {
+				return produceErrTimeout
+			}
+			return produceErrUnavailable
+		}
+		if e, ok := err.(interface{ Timeout() bool }); ok && e.Timeout() {
+			return produceErrTimeout
+		}
+		if e, ok := err.(interface{ Temporary() bool }); ok && e.Temporary() {
+			return produceErrUnavailable
+		}
+
+		if e, ok := err.(interface{ Cause() error }); ok {
+			err = e.Cause()
+		} else {
+			err = errors.Unwrap(err)
+		}
+	}
+	return produceErrOther
+}
+
+func statProduceErr(topic, errType string, n int) {
+	_metricProduceErr.With("topic", topic, "type", errType).Add(float64(n))
+}
+
+// statProduce n 条消息一次写入的结果，err 不为空时所有消息都失败
+func statProduce(topic string, n int, d time.Duration, err error) {
+	_metricProduceBatchSize.With("topic", topic).Observe(float64(n))
+	_metricProduceDuration.With("topic", topic).Observe(float64(d / time.Millisecond))
+	if err != nil {
+		statProduceErr(topic, produceErrType(err), n)
+		return
+	}
+	_metricProduceMsgs.With("topic", topic).Add(float64(n))
+}
+
+// statProduceResults WriteMsgsResult 的逐条结果
+func statProduceResults(topic string, results []MsgResult, d time.Duration) {
+	_metricProduceBatchSize.With("topic", topic).Observe(float64(len(results)))
+	_metricProduceDuration.With("topic", topic).Observe(float64(d / time.Millisecond))
+	var ok int
+	for _, r := range results {
+		if r.Err != nil {
+			statProduceErr(topic, produceErrType(r.Err), 1)
+		} else {
+			ok++
+		}
+	}
+	_metricProduceMsgs.With("topic", topic).Add(float64(ok))
+}
+
+// statConsumeLatency 使用 Payload 中的写入时间，v1 的消息使用后端的写入时间，都没有时不统计
+func statConsumeLatency(msg *ConsumeMsg, now time.Time) {
+	if msg.payload == nil || msg.payload.Retries > 0 {
+		return
+	}
+	produced := msg.payload.produceTime()
+	if produced.IsZero() {
+		produced = msg.Time
+	}
+	if produced.IsZero() {
+		return
+	}
+	d := now.Sub(produced)
+	if d < 0 {
+		// 写入方与消费方的时钟不一致
+		d = 0
+	}
+	_metricConsumeLatency.With("topic", msg.Topic, "group", msg.GroupID).Observe(float64(d / time.Millisecond))
+}
+
+func statConsumeFiltered(topic, group string) {
+	_metricConsumeFiltered.With("topic", topic, "group", group).Inc()
+}
+
+func statConsumePoison(topic, group, action string) {
+	_metricConsumePoison.With("topic", topic, "group", group, "action", action).Inc()
+}
+
+func statConsumeDeduped(topic, group string) {
+	_metricConsumeDeduped.With("topic", topic, "group", group).Inc()
+}
@@ -0,0 +1,31 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+type causeError struct {
+	err error
+}
+
+func (e *causeError) Error() string { return e.err.Error() }
+func (e *causeError) Cause() error  { return e.err }
+
+func TestProduceErrType(t *testing.T) {
+	assert.Equal(t, produceErrType(context.DeadlineExceeded), produceErrTimeout)
+	assert.Equal(t, produceErrType(fmt.Errorf("write: %w", context.DeadlineExceeded)), produceErrTimeout)
+	assert.Equal(t, produceErrType(kafka.RequestTimedOut), produceErrTimeout)
+	assert.Equal(t, produceErrType(kafka.LeaderNotAvailable), produceErrUnavailable)
+	assert.Equal(t, produceErrType(&causeError{kafka.NotLeaderForPartition}), produceErrUnavailable)
+	assert.Equal(t, produceErrType(&causeError{kafka.MessageSizeTooLarge}), produceErrTooLarge)
+	assert.Equal(t, produceErrType(kafka.MessageTooLargeError{}), produceErrTooLarge)
+	assert.Equal(t, produceErrType(&net.OpError{Op: "dial", Err: errors.New("connection refused")}), produceErrUnavailable)
+	assert.Equal(t, produceErrType(errors.New("unknown")), produceErrOther)
+}
@@ -0,0 +1,311 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	nsq "github.com/nsqio/go-nsq"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// groupId 对应 nsq 的 channel，brokers 为 nsqd 的 tcp 地址，
+// reader 配置了 lookupds 时通过 nsqlookupd 发现 nsqd，否则直接连接 brokers
+const (
+	spanLogKeyNSQChannel  = "channel"
+	spanLogKeyNSQLookupds = "lookupds"
+
+	nsqMaxInFlight = 100
+)
+
+type nsqLogger struct{}
+
+func (nsqLogger) Output(calldepth int, s string) error {
+	slog.Warnf(context.TODO(), "nsq --> %s", s)
+	return nil
+}
+
+type NSQHandler struct {
+	msg *nsq.Message
+}
+
+func NewNSQHandler(msg *nsq.Message) *NSQHandler {
+	return &NSQHandler{
+		msg: msg,
+	}
+}
+
+func (m *NSQHandler) CommitMsg(ctx context.Context) error {
+	m.msg.Finish()
+	return nil
+}
+
+type NSQReader struct {
+	consumer *nsq.Consumer
+
+	brokers  []string
+	lookupds []string
+	channel  string
+
+	msgs      chan *nsq.Message
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewNSQReader(brokers, lookupds []string, topic, groupId string) (*NSQReader, error) {
+	if len(groupId) == 0 {
+		return nil, fmt.Errorf("nsq reader need groupId, topic: %s", topic)
+	}
+
+	config := nsq.NewConfig()
+	config.MaxInFlight = nsqMaxInFlight
+	consumer, err := nsq.NewConsumer(topic, groupId, config)
+	if err != nil {
+		return nil, err
+	}
+	consumer.SetLogger(nsqLogger{}, nsq.LogLevelWarning)
+
+	reader := &NSQReader{
+		consumer: consumer,
+		brokers:  brokers,
+		lookupds: lookupds,
+		channel:  groupId,
+		msgs:     make(chan *nsq.Message),
+		stop:     make(chan struct{}),
+	}
+	consumer.AddHandler(nsq.HandlerFunc(reader.handleMessage))
+
+	if len(lookupds) > 0 {
+		err = consumer.ConnectToNSQLookupds(lookupds)
+	} else {
+		err = consumer.ConnectToNSQDs(brokers)
+	}
+	if err != nil {
+		consumer.Stop()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// handleMessage 在 nsq 的连接协程中执行，消息交给 ReadMsg/FetchMsg 后由调用方确认
+func (m *NSQReader) handleMessage(msg *nsq.Message) error {
+	msg.DisableAutoResponse()
+	select {
+	case m.msgs <- msg:
+	case <-m.stop:
+		msg.Requeue(0)
+	}
+	return nil
+}
+
+func (m *NSQReader) next(ctx context.Context) (*nsq.Message, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-m.stop:
+		return nil, fmt.Errorf("nsq reader closed, channel: %s", m.channel)
+	case msg := <-m.msgs:
+		return msg, nil
+	}
+}
+
+func (m *NSQReader) logConfigToSpan(span opentracing.Span) {
+	span.LogFields(
+		log.String(spanLogKeyMQType, fmt.Sprint(MQTypeNSQ)),
+		log.String(spanLogKeyKafkaBrokers, strings.Join(m.brokers, apolloBrokersSep)),
+		log.String(spanLogKeyNSQLookupds, strings.Join(m.lookupds, apolloBrokersSep)),
+		log.String(spanLogKeyNSQChannel, m.channel),
+	)
+}
+
+func (m *NSQReader) ReadMsg(ctx context.Context, v interface{}, ov interface{}) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	msg, err := m.next(ctx)
+	if err != nil {
+		return err
+	}
+	msg.Finish()
+
+	err = unmarshalMsg(msg.Body, v)
+	if err != nil {
+		return err
+	}
+
+	err = unmarshalMsg(msg.Body, ov)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *NSQReader) FetchMsg(ctx context.Context, v interface{}, ov interface{}) (Handler, error) {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	msg, err := m.next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: 无法解析的消息重新投递也无法处理，直接确认丢弃
+	err = unmarshalMsg(msg.Body, v)
+	if err != nil {
+		msg.Finish()
+		return nil, err
+	}
+
+	err = unmarshalMsg(msg.Body, ov)
+	if err != nil {
+		msg.Finish()
+		return nil, err
+	}
+
+	return NewNSQHandler(msg), nil
+}
+
+func (m *NSQReader) SetOffsetAt(ctx context.Context, t time.Time) error {
+	return fmt.Errorf("nsq reader does not support offset, channel: %s", m.channel)
+}
+
+func (m *NSQReader) SetOffset(ctx context.Context, offset int64) error {
+	return fmt.Errorf("nsq reader does not support offset, channel: %s", m.channel)
+}
+
+func (m *NSQReader) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.stop)
+		m.consumer.Stop()
+		<-m.consumer.StopChan
+	})
+	return nil
+}
+
+type NSQWriter struct {
+	producers []*nsq.Producer
+	topic     string
+
+	brokers []string
+	next    uint32
+}
+
+func NewNSQWriter(brokers []string, topic string) (*NSQWriter, error) {
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("no nsqd brokers, topic: %s", topic)
+	}
+
+	config := nsq.NewConfig()
+	writer := &NSQWriter{
+		topic:   topic,
+		brokers: brokers,
+	}
+	for _, broker := range brokers {
+		producer, err := nsq.NewProducer(broker, config)
+		if err != nil {
+			writer.Close()
+			return nil, err
+		}
+		producer.SetLogger(nsqLogger{}, nsq.LogLevelWarning)
+		writer.producers = append(writer.producers, producer)
+	}
+	return writer, nil
+}
+
+func (m *NSQWriter) logConfigToSpan(span opentracing.Span) {
+	span.LogFields(
+		log.String(spanLogKeyMQType, fmt.Sprint(MQTypeNSQ)),
+		log.String(spanLogKeyKafkaBrokers, strings.Join(m.brokers, apolloBrokersSep)),
+	)
+}
+
+// publish 轮询选择 nsqd，发送失败时依次尝试其余的 nsqd
+func (m *NSQWriter) publish(fn func(p *nsq.Producer) error) error {
+	start := atomic.AddUint32(&m.next, 1)
+	var err error
+	for i := 0; i < len(m.producers); i++ {
+		p := m.producers[(int(start)+i)%len(m.producers)]
+		if err = fn(p); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// WriteMsg nsq 没有消息 key 的概念，k 仅用于与其他后端保持接口一致
+func (m *NSQWriter) WriteMsg(ctx context.Context, k string, v interface{}) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	msg, err := marshalMsg(v)
+	if err != nil {
+		return err
+	}
+
+	return m.publish(func(p *nsq.Producer) error {
+		return p.Publish(m.topic, msg)
+	})
+}
+
+func (m *NSQWriter) WriteMsgs(ctx context.Context, msgs ...Message) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	var bodies [][]byte
+	for _, msg := range msgs {
+		body, err := marshalMsg(msg.Value)
+		if err != nil {
+			return err
+		}
+		bodies = append(bodies, body)
+	}
+	if len(bodies) == 0 {
+		return nil
+	}
+
+	return m.publish(func(p *nsq.Producer) error {
+		return p.MultiPublish(m.topic, bodies)
+	})
+}
+
+// WriteMsgDelay 使用 nsqd 的 DPUB，delay 不能超过 nsqd 的 --max-req-timeout（默认 1h）
+func (m *NSQWriter) WriteMsgDelay(ctx context.Context, k string, v interface{}, delay time.Duration) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	msg, err := marshalMsg(v)
+	if err != nil {
+		return err
+	}
+
+	return m.publish(func(p *nsq.Producer) error {
+		return p.DeferredPublish(m.topic, delay, msg)
+	})
+}
+
+func (m *NSQWriter) Close() error {
+	for _, p := range m.producers {
+		p.Stop()
+	}
+	return nil
+}
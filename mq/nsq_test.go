@@ -0,0 +1,33 @@
+package mq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+	nsq "github.com/nsqio/go-nsq"
+)
+
+func TestNSQReader_handleMessage(t *testing.T) {
+	reader := &NSQReader{
+		channel: "test",
+		msgs:    make(chan *nsq.Message),
+		stop:    make(chan struct{}),
+	}
+
+	go reader.handleMessage(&nsq.Message{Body: []byte(`{"v":"\"hello\""}`)})
+
+	var payload Payload
+	var value map[string]interface{}
+	handler, err := reader.FetchMsg(context.TODO(), &payload, &value)
+	assert.Equal(t, err, nil)
+	assert.True(t, handler != nil)
+	assert.Equal(t, payload.Value, `"hello"`)
+
+	close(reader.stop)
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+	defer cancel()
+	_, err = reader.next(ctx)
+	assert.True(t, err != nil)
+}
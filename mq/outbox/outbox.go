@@ -0,0 +1,331 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package outbox 事务性发件箱，解决同时写数据库与 mq 时一边成功一边失败的问题：
+// 业务在自己的事务中调用 Add 把消息写入 outbox 表，事务提交后由 Relay 读取并写入 mq，写入成功后删除
+//
+// 表结构，目前只支持 mysql：
+//
+//	CREATE TABLE mq_outbox (
+//		id         BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+//		topic      VARCHAR(255)    NOT NULL,
+//		msg_key    VARCHAR(255)    NOT NULL DEFAULT '',
+//		value      MEDIUMBLOB      NOT NULL,
+//		carrier    BLOB            NULL,
+//		head       BLOB            NULL,
+//		control    BLOB            NULL,
+//		created_at BIGINT          NOT NULL,
+//		PRIMARY KEY (id)
+//	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+//
+// head、control 保存写入时 context 中的 Head 与 Control，已有的表需要先增加这两列
+//
+// Relay 在一个事务中按 id 顺序 SELECT ... FOR UPDATE 读取一批消息，依次写入 mq 后删除再提交事务，
+// 多个进程同时运行 Relay 时只有一个能读取到消息。id 在 INSERT 时分配而不是在提交时，
+// 同一个事务中的消息按 Add 的顺序写入 mq，并发的事务之间不保证按提交的顺序，
+// 需要严格有序的消息应当在同一个事务中写入，或由业务按 key 自行排序；
+// 写入 mq 成功但删除失败时消息会再次写入，即 at-least-once，不能重复处理的消费者需要配合 mq.Dedup 使用
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/shawnfeng/sutil/mq"
+	"github.com/shawnfeng/sutil/scontext"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+const (
+	defaultTable        = "mq_outbox"
+	defaultBatchSize    = 100
+	defaultPollInterval = time.Second
+	// Relay 写入 mq 失败后的重试间隔
+	defaultRetryInterval = time.Second
+
+	spanLogKeyTopic = "topic"
+	spanLogKeyCount = "count"
+)
+
+// Execer *sql.Tx、*sqlx.Tx 等都实现了 Execer
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Options 为空或字段为零值时使用默认值
+type Options struct {
+	// outbox 表名
+	Table string
+	// Relay 每个事务最多读取的消息数
+	BatchSize int
+	// 没有消息时的轮询间隔
+	PollInterval time.Duration
+}
+
+type Outbox struct {
+	db   *sql.DB
+	opts Options
+
+	// 写入 mq，测试时替换
+	publish func(ctx context.Context, topic string, msgs ...mq.Message) error
+}
+
+// New db 为 outbox 表所在的数据库，Relay 使用
+func New(db *sql.DB, opts *Options) *Outbox {
+	m := &Outbox{
+		db:      db,
+		publish: mq.WriteMsgs,
+	}
+	if opts != nil {
+		m.opts = *opts
+	}
+	if m.opts.Table == "" {
+		m.opts.Table = defaultTable
+	}
+	if m.opts.BatchSize <= 0 {
+		m.opts.BatchSize = defaultBatchSize
+	}
+	if m.opts.PollInterval <= 0 {
+		m.opts.PollInterval = defaultPollInterval
+	}
+	return m
+}
+
+// row outbox 表中的一条消息，value、head、control 为 json 编码后的内容
+type row struct {
+	id      int64
+	topic   string
+	key     string
+	value   []byte
+	carrier []byte
+	head    []byte
+	control []byte
+}
+
+// newRow msg.Ctx 不为空时使用其中的 trace 与 Head、Control，与 mq.WriteMsgs 一致
+func newRow(ctx context.Context, topic string, msg mq.Message) (*row, error) {
+	value, err := json.Marshal(msg.Value)
+	if err != nil {
+		return nil, err
+	}
+	r := &row{
+		topic: topic,
+		key:   msg.Key,
+		value: value,
+	}
+	if msg.Ctx != nil {
+		ctx = msg.Ctx
+	}
+	if head := ctx.Value(scontext.ContextKeyHead); head != nil {
+		if r.head, err = json.Marshal(head); err != nil {
+			return nil, err
+		}
+	}
+	if control := ctx.Value(scontext.ContextKeyControl); control != nil {
+		if r.control, err = json.Marshal(control); err != nil {
+			return nil, err
+		}
+	}
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		carrier := opentracing.TextMapCarrier{}
+		if err := opentracing.GlobalTracer().Inject(span.Context(), opentracing.TextMap, carrier); err != nil {
+			return nil, err
+		}
+		if r.carrier, err = json.Marshal(carrier); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (m *row) spanContext() (opentracing.SpanContext, bool) {
+	if len(m.carrier) == 0 {
+		return nil, false
+	}
+	var carrier opentracing.TextMapCarrier
+	if err := json.Unmarshal(m.carrier, &carrier); err != nil {
+		return nil, false
+	}
+	sc, err := opentracing.GlobalTracer().Extract(opentracing.TextMap, carrier)
+	if err != nil {
+		return nil, false
+	}
+	return sc, true
+}
+
+// context 在 ctx 上恢复写入 outbox 时的 Head 与 Control，解码失败时忽略
+func (m *row) context(ctx context.Context) context.Context {
+	if len(m.head) > 0 {
+		var head interface{}
+		if err := json.Unmarshal(m.head, &head); err == nil {
+			ctx = context.WithValue(ctx, scontext.ContextKeyHead, head)
+		}
+	}
+	if len(m.control) > 0 {
+		var control interface{}
+		if err := json.Unmarshal(m.control, &control); err == nil {
+			ctx = context.WithValue(ctx, scontext.ContextKeyControl, control)
+		}
+	}
+	return ctx
+}
+
+// Add 在调用方的事务 tx 中写入消息，事务提交后才会被 Relay 写入 mq，
+// Value 按 json 编码，写入 mq 时作为 json.RawMessage，topic 需要使用 json 编码
+func (m *Outbox) Add(ctx context.Context, tx Execer, topic string, msgs ...mq.Message) error {
+	fun := "Outbox.Add -->"
+
+	if len(msgs) == 0 {
+		return nil
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	values := make([]string, 0, len(msgs))
+	args := make([]interface{}, 0, 7*len(msgs))
+	for _, msg := range msgs {
+		r, err := newRow(ctx, topic, msg)
+		if err != nil {
+			slog.Errorf(ctx, "%s encode err: %v, topic: %s", fun, err, topic)
+			return err
+		}
+		values = append(values, "(?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, r.topic, r.key, r.value, r.carrier, r.head, r.control, now)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (topic, msg_key, value, carrier, head, control, created_at) VALUES %s", m.opts.Table, strings.Join(values, ", "))
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		slog.Errorf(ctx, "%s insert err: %v, topic: %s", fun, err, topic)
+		return err
+	}
+	return nil
+}
+
+// Relay 循环把 outbox 表中的消息写入 mq，直到 ctx 结束，
+// 写入失败时等待后从同一条消息重试，之后的消息不会越过失败的消息写入
+func (m *Outbox) Relay(ctx context.Context) error {
+	fun := "Outbox.Relay -->"
+	slog.Infof(ctx, "%s start table: %s", fun, m.opts.Table)
+
+	for ctx.Err() == nil {
+		n, err := m.relayOnce(ctx)
+		if err != nil {
+			slog.Errorf(ctx, "%s relay err: %v, table: %s", fun, err, m.opts.Table)
+			sleepContext(ctx, defaultRetryInterval)
+			continue
+		}
+		if n < m.opts.BatchSize {
+			sleepContext(ctx, m.opts.PollInterval)
+		}
+	}
+	slog.Infof(ctx, "%s stop table: %s", fun, m.opts.Table)
+	return ctx.Err()
+}
+
+// relayOnce 返回写入 mq 的消息数
+func (m *Outbox) relayOnce(ctx context.Context) (int, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := m.lock(ctx, tx)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+	for _, run := range splitRuns(rows) {
+		if err = m.publishRun(ctx, run); err != nil {
+			return 0, err
+		}
+	}
+
+	ids := make([]interface{}, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.id)
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", m.opts.Table, placeholders(len(ids)))
+	if _, err = tx.ExecContext(ctx, query, ids...); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+func (m *Outbox) lock(ctx context.Context, tx *sql.Tx) ([]*row, error) {
+	query := fmt.Sprintf("SELECT id, topic, msg_key, value, carrier, head, control FROM %s ORDER BY id LIMIT ? FOR UPDATE", m.opts.Table)
+	rs, err := tx.QueryContext(ctx, query, m.opts.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+
+	var rows []*row
+	for rs.Next() {
+		r := &row{}
+		if err = rs.Scan(&r.id, &r.topic, &r.key, &r.value, &r.carrier, &r.head, &r.control); err != nil {
+			return nil, err
+		}
+		rows = append(rows, r)
+	}
+	return rows, rs.Err()
+}
+
+// publishRun 一次写入同一个 topic 的连续消息，span 关联每条消息写入 outbox 时的 trace，
+// 每条消息通过 Message.Ctx 带上各自的 Head 与 Control
+func (m *Outbox) publishRun(ctx context.Context, run []*row) error {
+	var opts []opentracing.StartSpanOption
+	for _, r := range run {
+		if sc, ok := r.spanContext(); ok {
+			opts = append(opts, opentracing.FollowsFrom(sc))
+		}
+	}
+
+	span := opentracing.StartSpan("outbox.Relay", opts...)
+	defer span.Finish()
+	span.LogFields(
+		log.String(spanLogKeyTopic, run[0].topic),
+		log.Int(spanLogKeyCount, len(run)))
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	msgs := make([]mq.Message, 0, len(run))
+	for _, r := range run {
+		msgs = append(msgs, mq.Message{Key: r.key, Value: json.RawMessage(r.value), Ctx: r.context(ctx)})
+	}
+	return m.publish(ctx, run[0].topic, msgs...)
+}
+
+// splitRuns 按 topic 把消息分成连续的几段，保持原来的顺序
+func splitRuns(rows []*row) [][]*row {
+	var runs [][]*row
+	start := 0
+	for i := 1; i <= len(rows); i++ {
+		if i == len(rows) || rows[i].topic != rows[start].topic {
+			runs = append(runs, rows[start:i])
+			start = i
+		}
+	}
+	return runs
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
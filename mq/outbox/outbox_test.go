@@ -0,0 +1,73 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+	"github.com/shawnfeng/sutil/mq"
+	"github.com/shawnfeng/sutil/scontext"
+)
+
+func TestNew(t *testing.T) {
+	m := New(nil, nil)
+	assert.Equal(t, m.opts.Table, defaultTable)
+	assert.Equal(t, m.opts.BatchSize, defaultBatchSize)
+	assert.Equal(t, m.opts.PollInterval, defaultPollInterval)
+
+	m = New(nil, &Options{Table: "order_outbox", BatchSize: 10})
+	assert.Equal(t, m.opts.Table, "order_outbox")
+	assert.Equal(t, m.opts.BatchSize, 10)
+}
+
+func TestSplitRuns(t *testing.T) {
+	rows := []*row{{id: 1, topic: "a"}, {id: 2, topic: "a"}, {id: 3, topic: "b"}, {id: 4, topic: "a"}}
+	runs := splitRuns(rows)
+	assert.Equal(t, len(runs), 3)
+	assert.Equal(t, len(runs[0]), 2)
+	assert.Equal(t, runs[1][0].id, int64(3))
+	assert.Equal(t, runs[2][0].id, int64(4))
+	assert.Equal(t, len(splitRuns(nil)), 0)
+
+	assert.Equal(t, placeholders(3), "?, ?, ?")
+}
+
+func TestPublishRun(t *testing.T) {
+	r, err := newRow(context.TODO(), "a", mq.Message{Key: "k1", Value: map[string]int{"id": 1}})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(r.value), `{"id":1}`)
+
+	m := New(nil, nil)
+	var got []mq.Message
+	m.publish = func(ctx context.Context, topic string, msgs ...mq.Message) error {
+		assert.Equal(t, topic, "a")
+		got = msgs
+		return nil
+	}
+	assert.Equal(t, m.publishRun(context.TODO(), []*row{r, r}), nil)
+	assert.Equal(t, len(got), 2)
+	assert.Equal(t, got[0].Key, "k1")
+	v, _ := json.Marshal(got[1].Value)
+	assert.Equal(t, string(v), `{"id":1}`)
+	assert.Equal(t, got[0].Ctx.Value(scontext.ContextKeyHead), nil)
+}
+
+func TestPublishRun_head(t *testing.T) {
+	ctx := context.WithValue(context.TODO(), scontext.ContextKeyHead, map[string]interface{}{"uid": "1"})
+	ctx = context.WithValue(ctx, scontext.ContextKeyControl, map[string]interface{}{"group": "g1"})
+	r, err := newRow(context.TODO(), "a", mq.Message{Key: "k1", Value: 1, Ctx: ctx})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(r.head), `{"uid":"1"}`)
+	assert.Equal(t, string(r.control), `{"group":"g1"}`)
+
+	m := New(nil, nil)
+	var got []mq.Message
+	m.publish = func(ctx context.Context, topic string, msgs ...mq.Message) error {
+		got = msgs
+		return nil
+	}
+	assert.Equal(t, m.publishRun(context.TODO(), []*row{r}), nil)
+	assert.Equal(t, got[0].Ctx.Value(scontext.ContextKeyHead), map[string]interface{}{"uid": "1"})
+	assert.Equal(t, got[0].Ctx.Value(scontext.ContextKeyControl), map[string]interface{}{"group": "g1"})
+}
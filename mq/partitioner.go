@@ -0,0 +1,183 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 配置项 partitioner 指定 kafka 写入时选择 partition 的方式，目前仅 kafka 支持：
+//
+//	hash       默认，相同 key 的消息写入同一个 partition，保证相同 key 的消息按写入顺序消费，key 为空时轮询
+//	roundrobin 忽略 key 轮询所有 partition，不保证相同 key 的顺序
+//	sticky     key 不为空时与 hash 相同，key 为空时连续 batchsize 条消息写入同一个 partition 后再随机切换，
+//	           使空 key 的消息也能攒满批次，提高吞吐
+//
+// 调用 SetPartitioner 设置的 Partitioner 优先于配置项
+const (
+	PartitionerHash       = "hash"
+	PartitionerRoundRobin = "roundrobin"
+	PartitionerSticky     = "sticky"
+)
+
+// Partitioner 由调用方实现的 partition 选择方式，partitions 为 topic 当前所有的 partition，
+// 返回值需要是 partitions 中的一个，否则使用配置项指定的方式
+type Partitioner interface {
+	Partition(key string, partitions []int) int
+}
+
+// PartitionerFunc 使普通函数实现 Partitioner
+type PartitionerFunc func(key string, partitions []int) int
+
+func (f PartitionerFunc) Partition(key string, partitions []int) int {
+	return f(key, partitions)
+}
+
+// topic -> Partitioner
+var partitioners sync.Map
+
+// SetPartitioner 设置 topic 写入时使用的 Partitioner，对已创建的 writer 同样生效，p 为 nil 时恢复为配置项指定的方式
+func SetPartitioner(topic string, p Partitioner) {
+	if p == nil {
+		partitioners.Delete(topic)
+		return
+	}
+	partitioners.Store(topic, p)
+}
+
+func topicPartitioner(topic string) Partitioner {
+	if v, ok := partitioners.Load(topic); ok {
+		return v.(Partitioner)
+	}
+	return nil
+}
+
+// kafkaBalancer 按配置项 partitioner 创建 kafka 的 balancer，未知的值使用 hash
+func kafkaBalancer(topic, name string, batchSize int) kafka.Balancer {
+	var balancer kafka.Balancer
+	switch name {
+	case PartitionerRoundRobin:
+		balancer = &kafka.RoundRobin{}
+	case PartitionerSticky:
+		balancer = newStickyBalancer(batchSize)
+	default:
+		balancer = &kafka.Hash{}
+	}
+	return &topicBalancer{
+		topic:    topic,
+		balancer: balancer,
+	}
+}
+
+// topicBalancer topic 设置了 Partitioner 时优先使用
+type topicBalancer struct {
+	topic    string
+	balancer kafka.Balancer
+}
+
+func (m *topicBalancer) Balance(msg kafka.Message, partitions ...int) int {
+	fun := "topicBalancer.Balance -->"
+
+	p := topicPartitioner(m.topic)
+	if p == nil {
+		return m.balancer.Balance(msg, partitions...)
+	}
+
+	partition := p.Partition(string(msg.Key), partitions)
+	if containsPartition(partitions, partition) {
+		return partition
+	}
+	slog.Errorf(context.TODO(), "%s invalid partition: %d, topic: %s, partitions: %v", fun, partition, m.topic, partitions)
+	return m.balancer.Balance(msg, partitions...)
+}
+
+// stickyBalancer key 为空的消息每 batchSize 条切换一次 partition
+type stickyBalancer struct {
+	hash      kafka.Hash
+	batchSize int
+
+	mu        sync.Mutex
+	partition int
+	count     int
+}
+
+func newStickyBalancer(batchSize int) *stickyBalancer {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	return &stickyBalancer{
+		batchSize: batchSize,
+		partition: -1,
+	}
+}
+
+func (m *stickyBalancer) Balance(msg kafka.Message, partitions ...int) int {
+	if len(msg.Key) > 0 {
+		return m.hash.Balance(msg, partitions...)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.count >= m.batchSize || !containsPartition(partitions, m.partition) {
+		m.partition = partitions[rand.Intn(len(partitions))]
+		m.count = 0
+	}
+	m.count++
+	return m.partition
+}
+
+func containsPartition(partitions []int, partition int) bool {
+	for _, v := range partitions {
+		if v == partition {
+			return true
+		}
+	}
+	return false
+}
+
+// partitionRecorder 记录 WriteMsgsResult 中每条消息选择的 partition，kafka-go 没有返回写入的 partition
+// NOTE: 以消息 Value 底层数组的地址标识消息，kafka writer 传递消息时不会复制 Value，
+// 只记录调用过 watch 的消息，避免其他写入方式的消息占用内存
+type partitionRecorder struct {
+	kafka.Balancer
+
+	// *byte -> int
+	partitions sync.Map
+}
+
+func (m *partitionRecorder) Balance(msg kafka.Message, partitions ...int) int {
+	partition := m.Balancer.Balance(msg, partitions...)
+	if len(msg.Value) > 0 {
+		if _, ok := m.partitions.Load(&msg.Value[0]); ok {
+			m.partitions.Store(&msg.Value[0], partition)
+		}
+	}
+	return partition
+}
+
+func (m *partitionRecorder) watch(msg kafka.Message) {
+	if len(msg.Value) > 0 {
+		m.partitions.Store(&msg.Value[0], unknownPartition)
+	}
+}
+
+// partition 返回消息选择的 partition 并停止记录，没有记录时返回 unknownPartition
+func (m *partitionRecorder) partition(msg kafka.Message) int {
+	if len(msg.Value) == 0 {
+		return unknownPartition
+	}
+	v, ok := m.partitions.Load(&msg.Value[0])
+	m.partitions.Delete(&msg.Value[0])
+	if !ok {
+		return unknownPartition
+	}
+	return v.(int)
+}
@@ -0,0 +1,71 @@
+package mq
+
+import (
+	"testing"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+func TestKafkaBalancer(t *testing.T) {
+	partitions := []int{0, 1, 2, 3}
+	keyed := kafka.Message{Key: []byte("k1"), Value: []byte("v")}
+	keyless := kafka.Message{Value: []byte("v")}
+
+	hash := kafkaBalancer("test", "", 0)
+	p := hash.Balance(keyed, partitions...)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, p, hash.Balance(keyed, partitions...))
+	}
+
+	rr := kafkaBalancer("test", PartitionerRoundRobin, 0)
+	seen := make(map[int]bool)
+	for i := 0; i < len(partitions); i++ {
+		seen[rr.Balance(keyed, partitions...)] = true
+	}
+	assert.Equal(t, len(partitions), len(seen))
+
+	sticky := kafkaBalancer("test", PartitionerSticky, 3)
+	assert.Equal(t, p, sticky.Balance(keyed, partitions...))
+	first := sticky.Balance(keyless, partitions...)
+	assert.Equal(t, first, sticky.Balance(keyless, partitions...))
+	assert.Equal(t, first, sticky.Balance(keyless, partitions...))
+}
+
+func TestSetPartitioner(t *testing.T) {
+	topic := "test_set_partitioner"
+	partitions := []int{0, 1, 2, 3}
+	msg := kafka.Message{Key: []byte("k1"), Value: []byte("v")}
+
+	balancer := kafkaBalancer(topic, PartitionerHash, 0)
+	def := balancer.Balance(msg, partitions...)
+
+	SetPartitioner(topic, PartitionerFunc(func(key string, partitions []int) int {
+		return partitions[len(partitions)-1]
+	}))
+	assert.Equal(t, 3, balancer.Balance(msg, partitions...))
+
+	// 不在 partitions 中时使用配置项指定的方式
+	SetPartitioner(topic, PartitionerFunc(func(key string, partitions []int) int {
+		return 10
+	}))
+	assert.Equal(t, def, balancer.Balance(msg, partitions...))
+
+	SetPartitioner(topic, nil)
+	assert.Equal(t, def, balancer.Balance(msg, partitions...))
+}
+
+func TestPartitionRecorder(t *testing.T) {
+	recorder := &partitionRecorder{Balancer: kafka.BalancerFunc(func(msg kafka.Message, partitions ...int) int {
+		return 2
+	})}
+	msg := kafka.Message{Value: []byte("v")}
+	other := kafka.Message{Value: []byte("v")}
+
+	recorder.watch(msg)
+	recorder.Balance(msg, 0, 1, 2)
+	recorder.Balance(other, 0, 1, 2)
+	assert.Equal(t, 2, recorder.partition(msg))
+	assert.Equal(t, unknownPartition, recorder.partition(msg))
+	assert.Equal(t, unknownPartition, recorder.partition(other))
+}
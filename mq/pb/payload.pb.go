@@ -0,0 +1,98 @@
+// Code generated by protoc-gen-go.
+// source: payload.proto
+// DO NOT EDIT!
+
+package mqproto
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// mq.Payload 的 protobuf 编码
+type Payload struct {
+	Carrier     map[string]string `protobuf:"bytes,1,rep,name=carrier,proto3" json:"carrier,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Value       []byte            `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	Head        []byte            `protobuf:"bytes,3,opt,name=head,proto3" json:"head,omitempty"`
+	Control     []byte            `protobuf:"bytes,4,opt,name=control,proto3" json:"control,omitempty"`
+	Retries     int32             `protobuf:"varint,5,opt,name=retries,proto3" json:"retries,omitempty"`
+	Codec       string            `protobuf:"bytes,6,opt,name=codec,proto3" json:"codec,omitempty"`
+	Version     int32             `protobuf:"varint,7,opt,name=version,proto3" json:"version,omitempty"`
+	ContentType string            `protobuf:"bytes,8,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Timestamp   int64             `protobuf:"varint,9,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (m *Payload) Reset()         { *m = Payload{} }
+func (m *Payload) String() string { return proto.CompactTextString(m) }
+func (*Payload) ProtoMessage()    {}
+
+func (m *Payload) GetCarrier() map[string]string {
+	if m != nil {
+		return m.Carrier
+	}
+	return nil
+}
+
+func (m *Payload) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *Payload) GetHead() []byte {
+	if m != nil {
+		return m.Head
+	}
+	return nil
+}
+
+func (m *Payload) GetControl() []byte {
+	if m != nil {
+		return m.Control
+	}
+	return nil
+}
+
+func (m *Payload) GetRetries() int32 {
+	if m != nil {
+		return m.Retries
+	}
+	return 0
+}
+
+func (m *Payload) GetCodec() string {
+	if m != nil {
+		return m.Codec
+	}
+	return ""
+}
+
+func (m *Payload) GetVersion() int32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *Payload) GetContentType() string {
+	if m != nil {
+		return m.ContentType
+	}
+	return ""
+}
+
+func (m *Payload) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*Payload)(nil), "mqproto.Payload")
+}
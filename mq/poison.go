@@ -0,0 +1,120 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 处理失败达到 MaxAttempts 次或错误不可重试的消息为毒消息，打印完整的 Payload 并统计后按 PoisonPolicy 处理，
+// 之后提交消息，避免一条无法处理的消息阻塞整个 partition；ConsumeFunc panic 时按不可重试的错误处理
+type PoisonPolicy int
+
+const (
+	// PoisonDLQ 默认，写入死信 topic，写入失败时一直重试，不会丢弃消息
+	PoisonDLQ PoisonPolicy = iota
+	// PoisonDLQOrSkip 写入死信 topic，连续失败 poisonDLQAttempts 次后跳过
+	PoisonDLQOrSkip
+	// PoisonSkip 不写入死信 topic，直接跳过
+	PoisonSkip
+)
+
+const (
+	poisonDLQAttempts = 3
+
+	poisonActionDLQ  = "dlq"
+	poisonActionSkip = "skip"
+)
+
+func (p PoisonPolicy) String() string {
+	switch p {
+	case PoisonDLQ:
+		return "dlq"
+	case PoisonDLQOrSkip:
+		return "dlq_or_skip"
+	case PoisonSkip:
+		return "skip"
+	default:
+		return ""
+	}
+}
+
+// callConsumeFunc fn panic 时返回不可重试的错误，避免同一条消息反复导致进程崩溃
+func callConsumeFunc(ctx context.Context, msg *ConsumeMsg, fn ConsumeFunc) error {
+	return recoverConsume(ctx, msg.Topic, func() error {
+		return fn(ctx, msg)
+	})
+}
+
+func recoverConsume(ctx context.Context, topic string, fn func() error) (err error) {
+	fun := "mq.recoverConsume -->"
+	defer func() {
+		if r := recover(); r != nil {
+			buf := make([]byte, 4096)
+			buf = buf[:runtime.Stack(buf, false)]
+			slog.Errorf(ctx, "%s panic: %v, topic: %s, stack: %s", fun, r, topic, string(buf))
+			err = Permanent(fmt.Errorf("consume panic: %v", r))
+		}
+	}()
+	return fn()
+}
+
+// handlePoison ctx 结束前一直重试写入死信 topic 时返回 false
+func handlePoison(ctx, mctx context.Context, mspan opentracing.Span, dlqTopic string, opts *ConsumeOptions, msg *ConsumeMsg, cause error) bool {
+	fun := "mq.handlePoison -->"
+
+	payload, _ := json.Marshal(msg.payload)
+	slog.Errorf(mctx, "%s poison msg, topic: %s, group: %s, key: %s, partition: %d, attempts: %d, policy: %s, err: %v, payload: %s",
+		fun, msg.Topic, msg.GroupID, msg.Key, msg.Partition, msg.payload.Retries, opts.Poison, cause, payload)
+
+	if opts.Poison != PoisonSkip {
+		dlqMsg := &DLQMsg{
+			Topic:    msg.Topic,
+			GroupID:  msg.GroupID,
+			Key:      msg.Key,
+			Error:    cause.Error(),
+			Attempts: msg.payload.Retries,
+			FailedAt: unixMilli(time.Now()),
+			Payload:  msg.payload,
+		}
+		mspan.LogFields(log.String(spanLogKeyDLQTopic, dlqTopic))
+		for i := 1; ; i++ {
+			err := WriteMsg(mctx, dlqTopic, "", dlqMsg)
+			if err == nil {
+				slog.Warnf(mctx, "%s msg moved to dlq: %s, topic: %s", fun, dlqTopic, msg.Topic)
+				statConsumePoison(msg.Topic, msg.GroupID, poisonActionDLQ)
+				commitPoison(ctx, mctx, msg)
+				return true
+			}
+			slog.Errorf(mctx, "%s write dlq err: %v, dlq: %s", fun, err, dlqTopic)
+			if opts.Poison == PoisonDLQOrSkip && i >= poisonDLQAttempts {
+				break
+			}
+			if !sleepContext(ctx, consumeRetryInterval) {
+				return false
+			}
+		}
+	}
+
+	slog.Errorf(mctx, "%s poison msg skipped, topic: %s, group: %s, key: %s", fun, msg.Topic, msg.GroupID, msg.Key)
+	statConsumePoison(msg.Topic, msg.GroupID, poisonActionSkip)
+	commitPoison(ctx, mctx, msg)
+	return true
+}
+
+func commitPoison(ctx, mctx context.Context, msg *ConsumeMsg) {
+	fun := "mq.commitPoison -->"
+	if err := msg.Commit(ctx); err != nil {
+		slog.Errorf(mctx, "%s CommitMsg err: %v, topic: %s", fun, err, msg.Topic)
+	}
+}
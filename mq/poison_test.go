@@ -0,0 +1,65 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestCallConsumeFunc(t *testing.T) {
+	msg := &ConsumeMsg{Topic: defaultTestTopic}
+	err := callConsumeFunc(context.TODO(), msg, func(ctx context.Context, msg *ConsumeMsg) error {
+		panic("bad msg")
+	})
+	assert.Equal(t, isPermanent(err), true)
+	assert.Equal(t, err.Error(), "consume panic: bad msg")
+
+	err = callConsumeFunc(context.TODO(), msg, func(ctx context.Context, msg *ConsumeMsg) error {
+		return errors.New("retry")
+	})
+	assert.Equal(t, isPermanent(err), false)
+}
+
+func TestConsumeByGroupPoisonSkip(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.poison"
+	err := WriteMsgs(context.TODO(), topic,
+		Message{Key: "k1", Value: &memoryTestMsg{ID: 1, Name: "bad"}},
+		Message{Key: "k2", Value: &memoryTestMsg{ID: 2, Name: "good"}})
+	assert.Equal(t, err, nil)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	attempts := map[int]int{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ConsumeByGroup(ctx, topic, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+			var v memoryTestMsg
+			if err := msg.Unmarshal(&v); err != nil {
+				return err
+			}
+			attempts[v.ID]++
+			if v.Name == "bad" {
+				panic("bad msg")
+			}
+			cancel()
+			return nil
+		}, &ConsumeOptions{MaxAttempts: 3, Poison: PoisonSkip})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("consume timeout")
+	}
+	// panic 不重试
+	assert.Equal(t, attempts[1], 1)
+	assert.Equal(t, attempts[2], 1)
+	assert.Equal(t, MemoryTopicLen(topic+dlqTopicSuffix), 0)
+}
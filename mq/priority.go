@@ -0,0 +1,167 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// PriorityGroup 按优先级划分的一组 topic，Topics[0] 优先级最高，每个 topic 需要单独配置，
+// 消费时每轮从各 topic 最多处理 Weights 条消息，优先级高的 topic 有积压时低优先级的 topic 仍能按比例消费，
+// 如 Weights 为 [8, 1] 时高优先级的 topic 有积压时每处理 8 条高优先级消息处理 1 条低优先级消息
+type PriorityGroup struct {
+	Topics []string
+	// 为空时按优先级从低到高依次为 1, 2, 4, ...
+	Weights []int
+}
+
+func NewPriorityGroup(topics ...string) *PriorityGroup {
+	return &PriorityGroup{
+		Topics: topics,
+	}
+}
+
+// topic priority 超出范围时使用最近的优先级
+func (m *PriorityGroup) topic(priority int) (string, error) {
+	if len(m.Topics) == 0 {
+		return "", fmt.Errorf("priority group has no topics")
+	}
+	if priority < 0 {
+		priority = 0
+	}
+	if priority >= len(m.Topics) {
+		priority = len(m.Topics) - 1
+	}
+	return m.Topics[priority], nil
+}
+
+func (m *PriorityGroup) weights() []int {
+	weights := make([]int, len(m.Topics))
+	for i := range weights {
+		if i < len(m.Weights) && m.Weights[i] > 0 {
+			weights[i] = m.Weights[i]
+		} else {
+			weights[i] = 1 << uint(len(m.Topics)-1-i)
+		}
+	}
+	return weights
+}
+
+// WriteMsg priority 为 0 时优先级最高
+func (m *PriorityGroup) WriteMsg(ctx context.Context, priority int, key string, value interface{}) error {
+	topic, err := m.topic(priority)
+	if err != nil {
+		return err
+	}
+	return WriteMsg(ctx, topic, key, value)
+}
+
+func (m *PriorityGroup) WriteMsgs(ctx context.Context, priority int, msgs ...Message) error {
+	topic, err := m.topic(priority)
+	if err != nil {
+		return err
+	}
+	return WriteMsgs(ctx, topic, msgs...)
+}
+
+// ConsumeByGroup 与 ConsumeByGroup 相同，每个 topic 由单独的 goroutine 预读一条消息，由一个 goroutine 按权重依次处理，
+// 忽略 opts.Concurrency，ConsumeMsg.Topic 为消息所在的 topic
+func (m *PriorityGroup) ConsumeByGroup(ctx context.Context, groupId string, fn ConsumeFunc, opts *ConsumeOptions) error {
+	fun := "PriorityGroup.ConsumeByGroup -->"
+
+	if len(m.Topics) == 0 {
+		return fmt.Errorf("%s priority group has no topics", fun)
+	}
+	if opts == nil {
+		opts = &ConsumeOptions{}
+	}
+	fn = interceptConsume(fn, opts.Interceptors)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// NOTE: 消息放入队列后再通知，处理的 goroutine 收到通知时一定能从队列中取到消息
+	ready := make(chan struct{}, 1)
+	queues := make([]chan *ConsumeMsg, len(m.Topics))
+	dlqTopics := make(map[string]string, len(m.Topics))
+	for i, topic := range m.Topics {
+		queues[i] = make(chan *ConsumeMsg, 1)
+		dlqTopics[topic] = opts.DLQTopic
+		if dlqTopics[topic] == "" {
+			dlqTopics[topic] = GetDLQTopic(ctx, topic)
+		}
+
+		go func(queue chan<- *ConsumeMsg, conf *instanceConf) {
+			for ctx.Err() == nil {
+				msg, handler := fetchConsumeMsg(ctx, conf)
+				if msg == nil {
+					continue
+				}
+				msg.commit = handler.CommitMsg
+				select {
+				case queue <- msg:
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case ready <- struct{}{}:
+				default:
+				}
+			}
+		}(queues[i], newGroupReaderConf(ctx, topic, groupId))
+	}
+	slog.Infof(ctx, "%s start topics: %v, groupId: %s, weights: %v", fun, m.Topics, groupId, m.weights())
+
+	weights := m.weights()
+	handle := func(msg *ConsumeMsg) bool {
+		if !consumeMsg(ctx, dlqTopics[msg.Topic], opts, msg, fn) {
+			return false
+		}
+		if opts.ManualCommit {
+			return true
+		}
+		if err := msg.Commit(ctx); err != nil {
+			slog.Errorf(ctx, "%s CommitMsg err: %v, topic: %s", fun, err, msg.Topic)
+		}
+		return true
+	}
+	for ctx.Err() == nil {
+		if drainPriorityRound(queues, weights, handle) > 0 {
+			continue
+		}
+		select {
+		case <-ready:
+		case <-ctx.Done():
+		}
+	}
+	slog.Infof(ctx, "%s stop topics: %v, groupId: %s", fun, m.Topics, groupId)
+	return ctx.Err()
+}
+
+// drainPriorityRound 按优先级从高到低，每个队列最多处理 weights[i] 条已读取的消息，返回处理的消息数，
+// handle 返回 false 时停止
+func drainPriorityRound(queues []chan *ConsumeMsg, weights []int, handle func(msg *ConsumeMsg) bool) int {
+	var handled int
+	for i, queue := range queues {
+		for n := 0; n < weights[i]; n++ {
+			var msg *ConsumeMsg
+			select {
+			case msg = <-queue:
+			default:
+			}
+			if msg == nil {
+				break
+			}
+			handled++
+			if !handle(msg) {
+				return handled
+			}
+		}
+	}
+	return handled
+}
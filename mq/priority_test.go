@@ -0,0 +1,88 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestPriorityGroup_topic(t *testing.T) {
+	group := NewPriorityGroup("p0", "p1", "p2")
+	for priority, want := range map[int]string{-1: "p0", 0: "p0", 1: "p1", 2: "p2", 5: "p2"} {
+		topic, err := group.topic(priority)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, topic, want)
+	}
+	assert.Equal(t, group.weights(), []int{4, 2, 1})
+
+	group.Weights = []int{8}
+	assert.Equal(t, group.weights(), []int{8, 2, 1})
+
+	_, err := NewPriorityGroup().topic(0)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestDrainPriorityRound(t *testing.T) {
+	queues := []chan *ConsumeMsg{make(chan *ConsumeMsg, 10), make(chan *ConsumeMsg, 10)}
+	for i := 0; i < 10; i++ {
+		queues[0] <- &ConsumeMsg{Topic: "high"}
+		queues[1] <- &ConsumeMsg{Topic: "low"}
+	}
+
+	var topics []string
+	handle := func(msg *ConsumeMsg) bool {
+		topics = append(topics, msg.Topic)
+		return true
+	}
+	assert.Equal(t, drainPriorityRound(queues, []int{3, 1}, handle), 4)
+	assert.Equal(t, topics, []string{"high", "high", "high", "low"})
+
+	// 高优先级没有消息时处理低优先级
+	for len(queues[0]) > 0 {
+		<-queues[0]
+	}
+	topics = nil
+	assert.Equal(t, drainPriorityRound(queues, []int{3, 1}, handle), 1)
+	assert.Equal(t, topics, []string{"low"})
+}
+
+func TestPriorityGroup_ConsumeByGroup(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	group := NewPriorityGroup("palfish.test.priority.high", "palfish.test.priority.low")
+	const total = 10
+	for i := 0; i < total; i++ {
+		assert.Equal(t, group.WriteMsg(context.TODO(), i%2, fmt.Sprintf("k%d", i), &memoryTestMsg{ID: i}), nil)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var mu sync.Mutex
+	counts := map[string]int{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		group.ConsumeByGroup(ctx, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+			mu.Lock()
+			defer mu.Unlock()
+			counts[msg.Topic]++
+			if counts[group.Topics[0]]+counts[group.Topics[1]] == total {
+				cancel()
+			}
+			return nil
+		}, nil)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("consume timeout")
+	}
+	assert.Equal(t, counts[group.Topics[0]], total/2)
+	assert.Equal(t, counts[group.Topics[1]], total/2)
+}
@@ -0,0 +1,406 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+const (
+	spanLogKeyPulsarSubscription = "subscription"
+
+	pulsarSchemeSep = "://"
+)
+
+// groupId 对应 pulsar 的 subscription，subscription 类型通过配置项 subscription 指定，默认为 shared
+var pulsarSubscriptionTypes = map[string]pulsar.SubscriptionType{
+	"exclusive":  pulsar.Exclusive,
+	"shared":     pulsar.Shared,
+	"failover":   pulsar.Failover,
+	"key_shared": pulsar.KeyShared,
+}
+
+func parsePulsarSubscriptionType(s string) (pulsar.SubscriptionType, error) {
+	if s == "" {
+		return pulsar.Shared, nil
+	}
+	t, ok := pulsarSubscriptionTypes[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown pulsar subscription type: %s", s)
+	}
+	return t, nil
+}
+
+// 配置项 compression 可选的压缩算法，pulsar 不支持 snappy
+var pulsarCompressionTypes = map[string]pulsar.CompressionType{
+	"":     pulsar.NoCompression,
+	"none": pulsar.NoCompression,
+	"lz4":  pulsar.LZ4,
+	"gzip": pulsar.ZLib,
+	"zlib": pulsar.ZLib,
+	"zstd": pulsar.ZSTD,
+}
+
+func parsePulsarCompressionType(s string) (pulsar.CompressionType, error) {
+	t, ok := pulsarCompressionTypes[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown pulsar compression: %s", s)
+	}
+	return t, nil
+}
+
+// pulsarServiceURL 将多个 broker 合并为 pulsar://host1:6650,host2:6650 形式的 service url
+func pulsarServiceURL(brokers []string) (string, error) {
+	if len(brokers) == 0 {
+		return "", fmt.Errorf("no pulsar brokers")
+	}
+
+	scheme := "pulsar"
+	hosts := make([]string, 0, len(brokers))
+	for _, broker := range brokers {
+		if i := strings.Index(broker, pulsarSchemeSep); i >= 0 {
+			scheme = broker[:i]
+			broker = broker[i+len(pulsarSchemeSep):]
+		}
+		hosts = append(hosts, strings.TrimSuffix(broker, "/"))
+	}
+	return scheme + pulsarSchemeSep + strings.Join(hosts, apolloBrokersSep), nil
+}
+
+func newPulsarClient(brokers []string) (pulsar.Client, string, error) {
+	serviceURL, err := pulsarServiceURL(brokers)
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := pulsar.NewClient(pulsar.ClientOptions{
+		URL:              serviceURL,
+		OperationTimeout: defaultTimeout * 10,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return client, serviceURL, nil
+}
+
+type PulsarHandler struct {
+	msg      pulsar.Message
+	consumer pulsar.Consumer
+}
+
+func NewPulsarHandler(consumer pulsar.Consumer, msg pulsar.Message) *PulsarHandler {
+	return &PulsarHandler{
+		msg:      msg,
+		consumer: consumer,
+	}
+}
+
+func (m *PulsarHandler) CommitMsg(ctx context.Context) error {
+	m.consumer.Ack(m.msg)
+	return nil
+}
+
+func (m *PulsarHandler) msgKey() string {
+	return m.msg.Key()
+}
+
+func (m *PulsarHandler) msgPartition() int {
+	return int(m.msg.ID().PartitionIdx())
+}
+
+func (m *PulsarHandler) msgTime() time.Time {
+	return m.msg.PublishTime()
+}
+
+type PulsarReader struct {
+	client   pulsar.Client
+	consumer pulsar.Consumer
+
+	serviceURL   string
+	subscription string
+}
+
+// NewPulsarReader startOffset 为新的 subscription 开始消费的位置，FirstOffset 或 LastOffset
+func NewPulsarReader(brokers []string, topic, groupId, subscriptionType string, startOffset int64) (*PulsarReader, error) {
+	if len(groupId) == 0 {
+		return nil, fmt.Errorf("pulsar reader need groupId, topic: %s", topic)
+	}
+	subType, err := parsePulsarSubscriptionType(subscriptionType)
+	if err != nil {
+		return nil, err
+	}
+
+	client, serviceURL, err := newPulsarClient(brokers)
+	if err != nil {
+		return nil, err
+	}
+
+	position := pulsar.SubscriptionPositionLatest
+	if startOffset == FirstOffset {
+		position = pulsar.SubscriptionPositionEarliest
+	}
+	consumer, err := client.Subscribe(pulsar.ConsumerOptions{
+		Topic:                       topic,
+		SubscriptionName:            groupId,
+		Type:                        subType,
+		SubscriptionInitialPosition: position,
+	})
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &PulsarReader{
+		client:       client,
+		consumer:     consumer,
+		serviceURL:   serviceURL,
+		subscription: groupId,
+	}, nil
+}
+
+func (m *PulsarReader) logConfigToSpan(span opentracing.Span) {
+	span.LogFields(
+		log.String(spanLogKeyMQType, fmt.Sprint(MQTypePulsar)),
+		log.String(spanLogKeyKafkaBrokers, m.serviceURL),
+		log.String(spanLogKeyPulsarSubscription, m.subscription),
+	)
+}
+
+func (m *PulsarReader) ReadMsg(ctx context.Context, v interface{}, ov interface{}) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	msg, err := m.consumer.Receive(ctx)
+	if err != nil {
+		return err
+	}
+	m.consumer.Ack(msg)
+
+	err = unmarshalMsg(msg.Payload(), v)
+	if err != nil {
+		return err
+	}
+
+	err = unmarshalMsg(msg.Payload(), ov)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *PulsarReader) FetchMsg(ctx context.Context, v interface{}, ov interface{}) (Handler, error) {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	msg, err := m.consumer.Receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = unmarshalMsg(msg.Payload(), v)
+	if err != nil {
+		return nil, err
+	}
+
+	err = unmarshalMsg(msg.Payload(), ov)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPulsarHandler(m.consumer, msg), nil
+}
+
+func (m *PulsarReader) SetOffsetAt(ctx context.Context, t time.Time) error {
+	return m.consumer.SeekByTime(t)
+}
+
+// SetOffset 只支持 FirstOffset 与 LastOffset，pulsar 的 message id 无法用 int64 表示
+func (m *PulsarReader) SetOffset(ctx context.Context, offset int64) error {
+	switch offset {
+	case FirstOffset:
+		return m.consumer.Seek(pulsar.EarliestMessageID())
+	case LastOffset:
+		return m.consumer.Seek(pulsar.LatestMessageID())
+	default:
+		return fmt.Errorf("pulsar reader does not support offset %d, subscription: %s", offset, m.subscription)
+	}
+}
+
+func (m *PulsarReader) deleteGroup(ctx context.Context) error {
+	return m.consumer.Unsubscribe()
+}
+
+func (m *PulsarReader) Close() error {
+	m.consumer.Close()
+	m.client.Close()
+	return nil
+}
+
+type PulsarWriter struct {
+	client   pulsar.Client
+	producer pulsar.Producer
+
+	serviceURL string
+}
+
+// NewPulsarWriter batchSize 与 linger 未配置时使用 pulsar producer 默认的攒批参数
+func NewPulsarWriter(brokers []string, topic string, batchSize int, linger time.Duration, compression string) (*PulsarWriter, error) {
+	compressionType, err := parsePulsarCompressionType(compression)
+	if err != nil {
+		return nil, err
+	}
+
+	client, serviceURL, err := newPulsarClient(brokers)
+	if err != nil {
+		return nil, err
+	}
+
+	options := pulsar.ProducerOptions{
+		Topic:           topic,
+		CompressionType: compressionType,
+	}
+	if batchSize > 0 {
+		options.BatchingMaxMessages = uint(batchSize)
+	}
+	if linger > 0 {
+		options.BatchingMaxPublishDelay = linger
+	}
+	producer, err := client.CreateProducer(options)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &PulsarWriter{
+		client:     client,
+		producer:   producer,
+		serviceURL: serviceURL,
+	}, nil
+}
+
+func (m *PulsarWriter) logConfigToSpan(span opentracing.Span) {
+	span.LogFields(
+		log.String(spanLogKeyMQType, fmt.Sprint(MQTypePulsar)),
+		log.String(spanLogKeyKafkaBrokers, m.serviceURL),
+	)
+}
+
+func (m *PulsarWriter) WriteMsg(ctx context.Context, k string, v interface{}) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	msg, err := marshalMsg(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.producer.Send(ctx, &pulsar.ProducerMessage{
+		Key:     k,
+		Payload: msg,
+	})
+	return err
+}
+
+func (m *PulsarWriter) WriteMsgs(ctx context.Context, msgs ...Message) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	var pmsgs []*pulsar.ProducerMessage
+	for _, msg := range msgs {
+		body, err := marshalMsg(msg.Value)
+		if err != nil {
+			return err
+		}
+		pmsgs = append(pmsgs, &pulsar.ProducerMessage{
+			Key:     msg.Key,
+			Payload: body,
+		})
+	}
+
+	for _, pmsg := range pmsgs {
+		if _, err := m.producer.Send(ctx, pmsg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteMsgsResult 异步发送后等待全部回调，同一批的消息由 producer 攒批发送
+func (m *PulsarWriter) WriteMsgsResult(ctx context.Context, msgs ...Message) []MsgResult {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	results := newMsgResults(msgs, nil)
+	var wg sync.WaitGroup
+	for i, msg := range msgs {
+		body, err := marshalMsg(msg.Value)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		wg.Add(1)
+		i := i
+		m.producer.SendAsync(ctx, &pulsar.ProducerMessage{
+			Key:     msg.Key,
+			Payload: body,
+		}, func(id pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+			defer wg.Done()
+			if err != nil {
+				results[i].Err = err
+				return
+			}
+			results[i].Partition = int(id.PartitionIdx())
+			results[i].Offset = id.EntryID()
+		})
+	}
+	m.producer.Flush()
+	wg.Wait()
+	return results
+}
+
+// WriteMsgDelay 使用 pulsar 原生的延迟投递，只对 shared 类型的 subscription 生效
+func (m *PulsarWriter) WriteMsgDelay(ctx context.Context, k string, v interface{}, delay time.Duration) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	msg, err := marshalMsg(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.producer.Send(ctx, &pulsar.ProducerMessage{
+		Key:          k,
+		Payload:      msg,
+		DeliverAfter: delay,
+	})
+	return err
+}
+
+func (m *PulsarWriter) Close() error {
+	m.producer.Close()
+	m.client.Close()
+	return nil
+}
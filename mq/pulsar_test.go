@@ -0,0 +1,61 @@
+package mq
+
+import (
+	"testing"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestPulsarServiceURL(t *testing.T) {
+	url, err := pulsarServiceURL([]string{"pulsar://pulsar1.ibanyu.com:6650", "pulsar2.ibanyu.com:6650/"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, url, "pulsar://pulsar1.ibanyu.com:6650,pulsar2.ibanyu.com:6650")
+
+	url, err = pulsarServiceURL([]string{"pulsar+ssl://pulsar1.ibanyu.com:6651"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, url, "pulsar+ssl://pulsar1.ibanyu.com:6651")
+
+	_, err = pulsarServiceURL(nil)
+	assert.True(t, err != nil)
+}
+
+func TestParsePulsarSubscriptionType(t *testing.T) {
+	cases := []struct {
+		s        string
+		expected pulsar.SubscriptionType
+		hasErr   bool
+	}{
+		{"", pulsar.Shared, false},
+		{"exclusive", pulsar.Exclusive, false},
+		{"Failover", pulsar.Failover, false},
+		{"key_shared", pulsar.KeyShared, false},
+		{"unknown", 0, true},
+	}
+
+	for _, c := range cases {
+		typ, err := parsePulsarSubscriptionType(c.s)
+		assert.Equal(t, err != nil, c.hasErr)
+		assert.Equal(t, typ, c.expected)
+	}
+}
+
+func TestParsePulsarCompressionType(t *testing.T) {
+	cases := []struct {
+		s        string
+		expected pulsar.CompressionType
+		hasErr   bool
+	}{
+		{"", pulsar.NoCompression, false},
+		{"LZ4", pulsar.LZ4, false},
+		{"gzip", pulsar.ZLib, false},
+		{"zstd", pulsar.ZSTD, false},
+		{"snappy", 0, true},
+	}
+
+	for _, c := range cases {
+		typ, err := parsePulsarCompressionType(c.s)
+		assert.Equal(t, err != nil, c.hasErr)
+		assert.Equal(t, typ, c.expected)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 消费限速，ConsumeOptions.RateLimit 与 ByteRateLimit 为零值时使用配置项 ratelimit 与 byteratelimit，
+// 配置中心修改配置项后正在运行的 ConsumeByGroup 立即生效，用于回放或积压时避免下游数据库被打满；
+// 按令牌桶实现，每秒补充 rate 个令牌，最多积攒 1 秒的令牌，消息读取后处理前等待令牌
+
+// tokenBucket rate <= 0 时不限制
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		tokens: rate,
+		last:   time.Now(),
+	}
+}
+
+func (m *tokenBucket) setRate(rate float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refill(time.Now())
+	if m.rate <= 0 {
+		// 从不限制改为限制时令牌桶是满的
+		m.tokens = rate
+	}
+	m.rate = rate
+	if m.tokens > rate {
+		m.tokens = rate
+	}
+}
+
+func (m *tokenBucket) refill(now time.Time) {
+	if m.rate > 0 {
+		m.tokens += now.Sub(m.last).Seconds() * m.rate
+		if m.tokens > m.rate {
+			m.tokens = m.rate
+		}
+	}
+	m.last = now
+}
+
+// reserve 取出 n 个令牌，返回需要等待的时间，令牌不足时预支，超过 1 秒令牌的大消息也能通过
+func (m *tokenBucket) reserve(n float64) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.rate <= 0 {
+		return 0
+	}
+	m.refill(time.Now())
+	m.tokens -= n
+	if m.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-m.tokens / m.rate * float64(time.Second))
+}
+
+// wait ctx 结束时返回 false
+func (m *tokenBucket) wait(ctx context.Context, n float64) bool {
+	if d := m.reserve(n); d > 0 {
+		return sleepContext(ctx, d)
+	}
+	return ctx.Err() == nil
+}
+
+// consumeLimiter 一个 ConsumeByGroup 的限速，nil 时不限制
+type consumeLimiter struct {
+	topic string
+	opts  *ConsumeOptions
+	msgs  *tokenBucket
+	bytes *tokenBucket
+}
+
+// 配置所在的 topic -> *consumeLimiter -> struct{}，分级延迟 topic 与死信 topic 使用原 topic 的配置
+var consumeLimiters = struct {
+	mu sync.Mutex
+	m  map[string]map[*consumeLimiter]struct{}
+}{m: make(map[string]map[*consumeLimiter]struct{})}
+
+func newConsumeLimiter(ctx context.Context, topic string, opts *ConsumeOptions) *consumeLimiter {
+	m := &consumeLimiter{
+		topic: topic,
+		opts:  opts,
+		msgs:  newTokenBucket(0),
+		bytes: newTokenBucket(0),
+	}
+	m.reload(ctx)
+
+	key := m.configTopic()
+	consumeLimiters.mu.Lock()
+	defer consumeLimiters.mu.Unlock()
+	if consumeLimiters.m[key] == nil {
+		consumeLimiters.m[key] = make(map[*consumeLimiter]struct{})
+	}
+	consumeLimiters.m[key][m] = struct{}{}
+	return m
+}
+
+func (m *consumeLimiter) configTopic() string {
+	return dlqBaseTopic(delayBaseTopic(m.topic))
+}
+
+// close ConsumeByGroup 结束时调用，之后不再随配置变化
+func (m *consumeLimiter) close() {
+	key := m.configTopic()
+	consumeLimiters.mu.Lock()
+	defer consumeLimiters.mu.Unlock()
+	delete(consumeLimiters.m[key], m)
+	if len(consumeLimiters.m[key]) == 0 {
+		delete(consumeLimiters.m, key)
+	}
+}
+
+// reload 按 opts 与配置项重新设置速率，读取配置失败时保持不变
+func (m *consumeLimiter) reload(ctx context.Context) {
+	fun := "consumeLimiter.reload -->"
+
+	rate, byteRate := m.opts.RateLimit, m.opts.ByteRateLimit
+	if rate == 0 || byteRate == 0 {
+		config, err := getReadWriteConfig(ctx, m.topic)
+		if err != nil {
+			return
+		}
+		if rate == 0 {
+			rate = config.RateLimit
+		}
+		if byteRate == 0 {
+			byteRate = config.ByteRateLimit
+		}
+	}
+	m.msgs.setRate(rate)
+	m.bytes.setRate(byteRate)
+	slog.Infof(ctx, "%s topic: %s, ratelimit: %v, byteratelimit: %v", fun, m.topic, rate, byteRate)
+}
+
+// wait 等待处理 msg 的令牌，ctx 结束时返回 false
+func (m *consumeLimiter) wait(ctx context.Context, msg *ConsumeMsg) bool {
+	if m == nil {
+		return true
+	}
+	if !m.msgs.wait(ctx, 1) {
+		return false
+	}
+	return m.bytes.wait(ctx, float64(msg.size()))
+}
+
+// reloadConsumeLimiters topic 的配置变化时由 InstanceManager 调用
+func reloadConsumeLimiters(ctx context.Context, topic string) {
+	consumeLimiters.mu.Lock()
+	limiters := make([]*consumeLimiter, 0, len(consumeLimiters.m[topic]))
+	for l := range consumeLimiters.m[topic] {
+		limiters = append(limiters, l)
+	}
+	consumeLimiters.mu.Unlock()
+
+	for _, l := range limiters {
+		l.reload(ctx)
+	}
+}
@@ -0,0 +1,80 @@
+package mq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(0)
+	assert.Equal(t, b.reserve(100), time.Duration(0))
+
+	b.setRate(10)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, b.reserve(1), time.Duration(0))
+	}
+	d := b.reserve(1)
+	assert.True(t, d > 50*time.Millisecond && d <= 100*time.Millisecond)
+
+	// 大于桶容量的请求预支令牌
+	b = newTokenBucket(100)
+	d = b.reserve(300)
+	assert.True(t, d > 1900*time.Millisecond && d <= 2*time.Second)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	assert.Equal(t, b.wait(ctx, 1), false)
+}
+
+func TestConsumeLimiterReload(t *testing.T) {
+	etcdConfig := &EtcdConfig{}
+	etcdConfig.setNodes(map[string]string{
+		"/roc/mq/palfish.test.ratelimit/default/kafka": `{"brokers":"k1:9092","ratelimit":"5"}`,
+	})
+	old := DefaultConfiger
+	DefaultConfiger = etcdConfig
+	defer func() {
+		DefaultConfiger = old
+	}()
+
+	ctx := context.TODO()
+	limiter := newConsumeLimiter(ctx, "palfish.test.ratelimit", &ConsumeOptions{ByteRateLimit: 1024})
+	defer limiter.close()
+	assert.Equal(t, limiter.msgs.rate, float64(5))
+	assert.Equal(t, limiter.bytes.rate, float64(1024))
+
+	// 配置变化后立即生效，ConsumeOptions 指定的值不变
+	NewInstanceManager().applyChangeEvent(ctx, etcdConfig.setNodes(map[string]string{
+		"/roc/mq/palfish.test.ratelimit/default/kafka": `{"brokers":"k1:9092","ratelimit":"50","byteratelimit":"10"}`,
+	}))
+	assert.Equal(t, limiter.msgs.rate, float64(50))
+	assert.Equal(t, limiter.bytes.rate, float64(1024))
+
+	// 死信 topic 使用原 topic 的配置
+	dlqLimiter := newConsumeLimiter(ctx, "palfish.test.ratelimit"+dlqTopicSuffix, &ConsumeOptions{})
+	dlqLimiter.close()
+	assert.Equal(t, dlqLimiter.msgs.rate, float64(50))
+	assert.Equal(t, len(consumeLimiters.m["palfish.test.ratelimit"]), 1)
+}
+
+func TestConsumeRateLimit(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.consumeratelimit"
+	for i := 0; i < 6; i++ {
+		assert.Equal(t, WriteMsg(context.TODO(), topic, "", &memoryTestMsg{ID: i}), nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 300*time.Millisecond)
+	defer cancel()
+	var n int
+	ConsumeByGroup(ctx, topic, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+		n++
+		return nil
+	}, &ConsumeOptions{RateLimit: 4})
+	// 开始时桶里有 4 个令牌，之后每 250ms 一个
+	assert.True(t, n >= 4 && n <= 5)
+}
@@ -25,7 +25,7 @@ type Reader interface {
 //CommitInterval indicates the interval at which offsets are committed to
 // the broker.  If 0, commits will be handled synchronously.
 func NewGroupReader(ctx context.Context, topic, groupId string) (Reader, error) {
-	config, err := DefaultConfiger.GetConfig(ctx, topic, MQTypeKafka)
+	config, err := getReadWriteConfig(ctx, topic)
 	if err != nil {
 		return nil, err
 	}
@@ -33,7 +33,42 @@ func NewGroupReader(ctx context.Context, topic, groupId string) (Reader, error)
 	mqType := config.MQType
 	switch mqType {
 	case MQTypeKafka:
-		return NewKafkaReader(config.MQAddr, wrapTopicFromContext(ctx, topic), groupId, 0, 1, 10e6, config.CommitInterval), nil
+		dialer, err := kafkaDialer(config.Auth)
+		if err != nil {
+			return nil, err
+		}
+		return NewKafkaReader(config.MQAddr, wrapTopicFromContext(ctx, topic), groupId, 0, 1, 10e6, config.CommitInterval, config.groupStartOffset(groupId, LastOffset), kafkaIsolationLevel(config), dialer), nil
+
+	case MQTypeRabbitMQ:
+		reader, err := NewRabbitMQReader(config.MQAddr, wrapTopicFromContext(ctx, topic), groupId)
+		if err != nil {
+			return nil, err
+		}
+		return reader, nil
+
+	case MQTypePulsar:
+		reader, err := NewPulsarReader(config.MQAddr, wrapTopicFromContext(ctx, topic), groupId, config.Subscription, config.groupStartOffset(groupId, LastOffset))
+		if err != nil {
+			return nil, err
+		}
+		return reader, nil
+
+	case MQTypeNSQ:
+		reader, err := NewNSQReader(config.MQAddr, config.Lookupds, wrapTopicFromContext(ctx, topic), groupId)
+		if err != nil {
+			return nil, err
+		}
+		return reader, nil
+
+	case MQTypeRedis:
+		reader, err := NewRedisStreamReader(ctx, config.MQAddr, wrapTopicFromContext(ctx, topic), groupId, config.groupStartOffset(groupId, LastOffset))
+		if err != nil {
+			return nil, err
+		}
+		return reader, nil
+
+	case MQTypeMemory:
+		return NewMemoryReader(wrapTopicFromContext(ctx, topic), groupId), nil
 
 	default:
 		return nil, fmt.Errorf("mqType %d error", mqType)
@@ -46,7 +81,7 @@ const (
 )
 
 func NewPartitionReader(ctx context.Context, topic string, partition int) (Reader, error) {
-	config, err := DefaultConfiger.GetConfig(ctx, topic, MQTypeKafka)
+	config, err := getReadWriteConfig(ctx, topic)
 	if err != nil {
 		return nil, err
 	}
@@ -55,7 +90,11 @@ func NewPartitionReader(ctx context.Context, topic string, partition int) (Reade
 	mqType := config.MQType
 	switch mqType {
 	case MQTypeKafka:
-		reader := NewKafkaReader(config.MQAddr, wrapTopicFromContext(ctx, topic), "", partition, 1, 10e6, 0)
+		dialer, err := kafkaDialer(config.Auth)
+		if err != nil {
+			return nil, err
+		}
+		reader := NewKafkaReader(config.MQAddr, wrapTopicFromContext(ctx, topic), "", partition, 1, 10e6, 0, LastOffset, kafkaIsolationLevel(config), dialer)
 		if len(offsetAt) == 0 {
 			return nil, fmt.Errorf("no offsetAt config found")
 		}
@@ -72,6 +111,12 @@ func NewPartitionReader(ctx context.Context, topic string, partition int) (Reade
 
 		return reader, err
 
+	case MQTypeMemory:
+		return NewMemoryReader(wrapTopicFromContext(ctx, topic), ""), nil
+
+	case MQTypeRabbitMQ, MQTypePulsar, MQTypeNSQ, MQTypeRedis:
+		return nil, fmt.Errorf("%s does not support partition reader, topic: %s", mqType, topic)
+
 	default:
 		return nil, fmt.Errorf("mqType %d error", mqType)
 	}
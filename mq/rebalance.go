@@ -0,0 +1,132 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// ConsumeOptions.OnPartitionsAssigned 与 OnPartitionsRevoked 用于在 rebalance 前后加载与保存按 partition 的本地状态，如聚合的缓冲；
+// kafka-go v0.3.4 在 reader 内部完成 partition 的分配，没有回调，故：
+//   - 一个 partition 第一次读取到消息时回调 OnPartitionsAssigned
+//   - 发现 rebalance 或 reader 被重新创建后，处理之后的消息前回调 OnPartitionsRevoked，参数为之前回调过 OnPartitionsAssigned 的 partition，
+//     并发处理时先等待已读取的消息处理完成
+//   - ConsumeByGroup 结束时对所有回调过 OnPartitionsAssigned 的 partition 回调 OnPartitionsRevoked
+//
+// NOTE: rebalance 在读取到下一条消息时才能发现，其他成员可能已经开始消费这些 partition，回调中保存的状态需要能够被重复处理；
+// 不返回 partition 的后端不会回调，pulsar 的 shared 订阅没有独占的 partition，只在结束时回调 OnPartitionsRevoked
+type PartitionsFunc func(ctx context.Context, partitions []int)
+
+const rebalanceDrainInterval = 10 * time.Millisecond
+
+// rebalancer 由有 consumer group rebalance 的后端的 Reader 实现，每次 rebalance 后 generation 增大
+type rebalancer interface {
+	generation() int64
+}
+
+// generation kafka-go 的 Stats 读取后清零计数，故累加，ReaderStats 的其他计数不再准确
+func (m *KafkaReader) generation() int64 {
+	return atomic.AddInt64(&m.rebalances, m.Stats().Rebalances)
+}
+
+// partitionTracker 一个 ConsumeByGroup 的 partition 分配，只在读取消息的 goroutine 中使用
+type partitionTracker struct {
+	topic    string
+	assigned PartitionsFunc
+	revoked  PartitionsFunc
+
+	reader     Reader
+	generation int64
+	partitions map[int]bool
+}
+
+// newPartitionTracker 没有设置回调时返回 nil
+func newPartitionTracker(topic string, opts *ConsumeOptions) *partitionTracker {
+	if opts.OnPartitionsAssigned == nil && opts.OnPartitionsRevoked == nil {
+		return nil
+	}
+	return &partitionTracker{
+		topic:      topic,
+		assigned:   opts.OnPartitionsAssigned,
+		revoked:    opts.OnPartitionsRevoked,
+		partitions: make(map[int]bool),
+	}
+}
+
+// observe 处理 msg 前调用，drain 等待已读取的消息处理完成，ctx 结束时返回 false
+func (m *partitionTracker) observe(ctx context.Context, conf *instanceConf, msg *ConsumeMsg, drain func() bool) bool {
+	if m == nil || msg.Partition == unknownPartition {
+		return true
+	}
+	return m.observeReader(ctx, defaultInstanceManager.getReader(ctx, conf), msg, drain)
+}
+
+func (m *partitionTracker) observeReader(ctx context.Context, reader Reader, msg *ConsumeMsg, drain func() bool) bool {
+	var generation int64
+	if r, ok := reader.(rebalancer); ok {
+		generation = r.generation()
+	}
+	if reader != m.reader || generation != m.generation {
+		if len(m.partitions) > 0 {
+			if !drain() {
+				return false
+			}
+			m.revoke(ctx)
+		}
+		m.reader = reader
+		m.generation = generation
+	}
+
+	if !m.partitions[msg.Partition] {
+		m.partitions[msg.Partition] = true
+		slog.Infof(ctx, "partitionTracker.observe --> assigned topic: %s, partition: %d", m.topic, msg.Partition)
+		if m.assigned != nil {
+			m.assigned(ctx, []int{msg.Partition})
+		}
+	}
+	return true
+}
+
+// revoke 回调 OnPartitionsRevoked 并清空分配
+func (m *partitionTracker) revoke(ctx context.Context) {
+	if m == nil || len(m.partitions) == 0 {
+		return
+	}
+
+	partitions := make([]int, 0, len(m.partitions))
+	for p := range m.partitions {
+		partitions = append(partitions, p)
+	}
+	sort.Ints(partitions)
+	m.partitions = make(map[int]bool)
+	slog.Infof(ctx, "partitionTracker.revoke --> revoked topic: %s, partitions: %v", m.topic, partitions)
+	if m.revoked != nil {
+		m.revoked(ctx, partitions)
+	}
+}
+
+// pendingJobs consumeConcurrently 已交给 goroutine 还未处理完成的消息数
+type pendingJobs struct {
+	n int64
+}
+
+func (m *pendingJobs) add(delta int64) {
+	atomic.AddInt64(&m.n, delta)
+}
+
+// drain 等待所有消息处理完成，ctx 结束时返回 false
+func (m *pendingJobs) drain(ctx context.Context) bool {
+	for atomic.LoadInt64(&m.n) > 0 {
+		if !sleepContext(ctx, rebalanceDrainInterval) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package mq
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+type rebalanceTestReader struct {
+	Reader
+	gen int64
+}
+
+func (m *rebalanceTestReader) generation() int64 {
+	return m.gen
+}
+
+func TestPartitionTracker(t *testing.T) {
+	var assigned, revoked [][]int
+	tracker := newPartitionTracker(defaultTestTopic, &ConsumeOptions{
+		OnPartitionsAssigned: func(ctx context.Context, partitions []int) { assigned = append(assigned, partitions) },
+		OnPartitionsRevoked:  func(ctx context.Context, partitions []int) { revoked = append(revoked, partitions) },
+	})
+	var drains int
+	drain := func() bool {
+		drains++
+		return true
+	}
+
+	reader := &rebalanceTestReader{gen: 1}
+	ctx := context.TODO()
+	assert.Equal(t, tracker.observeReader(ctx, reader, &ConsumeMsg{Partition: 1}, drain), true)
+	assert.Equal(t, tracker.observeReader(ctx, reader, &ConsumeMsg{Partition: 0}, drain), true)
+	assert.Equal(t, tracker.observeReader(ctx, reader, &ConsumeMsg{Partition: 1}, drain), true)
+	assert.Equal(t, assigned, [][]int{{1}, {0}})
+	assert.Equal(t, drains, 0)
+
+	reader.gen++
+	assert.Equal(t, tracker.observeReader(ctx, reader, &ConsumeMsg{Partition: 1}, drain), true)
+	assert.Equal(t, drains, 1)
+	assert.Equal(t, revoked, [][]int{{0, 1}})
+	assert.Equal(t, assigned, [][]int{{1}, {0}, {1}})
+
+	// reader 被重新创建
+	assert.Equal(t, tracker.observeReader(ctx, &rebalanceTestReader{gen: 1}, &ConsumeMsg{Partition: 1}, drain), true)
+	assert.Equal(t, revoked, [][]int{{0, 1}, {1}})
+
+	tracker.revoke(ctx)
+	assert.Equal(t, revoked, [][]int{{0, 1}, {1}, {1}})
+	tracker.revoke(ctx)
+	assert.Equal(t, len(revoked), 3)
+
+	assert.Equal(t, newPartitionTracker(defaultTestTopic, &ConsumeOptions{}) == nil, true)
+}
+
+func TestConsumeByGroupPartitionsRevoked(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.rebalance"
+	err := WriteMsgs(context.TODO(), topic, Message{Key: "k1", Value: &memoryTestMsg{ID: 1}})
+	assert.Equal(t, err, nil)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var mu sync.Mutex
+	var events []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ConsumeByGroup(ctx, topic, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+			mu.Lock()
+			events = append(events, "handle")
+			mu.Unlock()
+			cancel()
+			return nil
+		}, &ConsumeOptions{
+			Concurrency: 2,
+			OnPartitionsAssigned: func(ctx context.Context, partitions []int) {
+				mu.Lock()
+				events = append(events, "assigned")
+				mu.Unlock()
+			},
+			OnPartitionsRevoked: func(ctx context.Context, partitions []int) {
+				mu.Lock()
+				events = append(events, "revoked")
+				mu.Unlock()
+			},
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("consume timeout")
+	}
+	assert.Equal(t, events, []string{"assigned", "handle", "revoked"})
+}
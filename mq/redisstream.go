@@ -0,0 +1,455 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	redis2 "github.com/redis/go-redis/v9"
+	"github.com/shawnfeng/sutil/cache/redis"
+)
+
+// topic 对应 redis stream，groupId 对应 consumer group，brokers 配置项填写 cache/redis 的 namespace，
+// 实例由 redis.DefaultInstanceManager 管理，与缓存共用连接池与配置
+const (
+	redisStreamWrapper = "mq"
+
+	redisStreamFieldKey   = "k"
+	redisStreamFieldValue = "v"
+
+	// stream 近似保留的最大消息数
+	redisStreamMaxLen = 100000
+	redisStreamBlock  = 5 * time.Second
+	redisStreamCount  = 10
+
+	// 超过 claimIdle 未确认的消息会被其他 consumer 认领重新消费
+	redisStreamClaimIdle     = 5 * time.Minute
+	redisStreamClaimInterval = 30 * time.Second
+
+	spanLogKeyRedisStreamConsumer = "consumer"
+)
+
+func getRedisStreamClient(ctx context.Context, namespace string) (*redis.Client, error) {
+	return redis.DefaultInstanceManager.GetInstance(ctx, &redis.InstanceConf{
+		Group:     redis.RouteGroup(ctx),
+		Namespace: namespace,
+		Wrapper:   redisStreamWrapper,
+	})
+}
+
+func redisStreamNamespace(brokers []string, topic string) (string, error) {
+	if len(brokers) == 0 || brokers[0] == "" {
+		return "", fmt.Errorf("no redis namespace config, topic: %s", topic)
+	}
+	return brokers[0], nil
+}
+
+func redisStreamConsumerName() string {
+	host, _ := os.Hostname()
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
+
+// redisStreamIDAt 返回 t 时刻之前最后一条消息的 id，用于 XGROUP SETID
+func redisStreamIDAt(t time.Time) string {
+	ms := t.UnixNano() / int64(time.Millisecond)
+	if ms <= 0 {
+		return "0"
+	}
+	return strconv.FormatInt(ms-1, 10) + "-0"
+}
+
+func redisStreamValues(k string, body []byte) map[string]interface{} {
+	return map[string]interface{}{
+		redisStreamFieldKey:   k,
+		redisStreamFieldValue: body,
+	}
+}
+
+func redisStreamBody(msg redis2.XMessage) ([]byte, error) {
+	v, ok := msg.Values[redisStreamFieldValue].(string)
+	if !ok {
+		return nil, fmt.Errorf("redis stream message %s has no value", msg.ID)
+	}
+	return []byte(v), nil
+}
+
+type RedisStreamHandler struct {
+	reader *RedisStreamReader
+	id     string
+	key    string
+}
+
+func (m *RedisStreamHandler) CommitMsg(ctx context.Context) error {
+	return m.reader.ack(ctx, m.id)
+}
+
+func (m *RedisStreamHandler) msgKey() string {
+	return m.key
+}
+
+// msgTime 消息 id 的前半部分为写入时的毫秒时间戳
+func (m *RedisStreamHandler) msgTime() time.Time {
+	ms, err := strconv.ParseInt(strings.SplitN(m.id, "-", 2)[0], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+type RedisStreamReader struct {
+	namespace string
+	stream    string
+	group     string
+	consumer  string
+
+	mu        sync.Mutex
+	buf       []redis2.XMessage
+	lastClaim time.Time
+	claimFrom string
+}
+
+// NewRedisStreamReader startOffset 为新建的 group 开始消费的位置，FirstOffset 或 LastOffset
+func NewRedisStreamReader(ctx context.Context, brokers []string, topic, groupId string, startOffset int64) (*RedisStreamReader, error) {
+	if len(groupId) == 0 {
+		return nil, fmt.Errorf("redis stream reader need groupId, topic: %s", topic)
+	}
+	namespace, err := redisStreamNamespace(brokers, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &RedisStreamReader{
+		namespace: namespace,
+		stream:    topic,
+		group:     groupId,
+		consumer:  redisStreamConsumerName(),
+		claimFrom: "0",
+	}
+
+	client, err := getRedisStreamClient(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	start := "$"
+	if startOffset == FirstOffset {
+		start = "0"
+	}
+	err = client.XGroupCreateMkStream(ctx, topic, groupId, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (m *RedisStreamReader) logConfigToSpan(span opentracing.Span) {
+	span.LogFields(
+		log.String(spanLogKeyMQType, fmt.Sprint(MQTypeRedis)),
+		log.String(spanLogKeyKafkaBrokers, m.namespace),
+		log.String(spanLogKeyKafkaGroupID, m.group),
+		log.String(spanLogKeyRedisStreamConsumer, m.consumer),
+	)
+}
+
+// claim 定期认领其他 consumer 长时间未确认的消息，避免 consumer 下线后消息一直处于 pending 状态
+func (m *RedisStreamReader) claim(ctx context.Context, client *redis.Client) {
+	if time.Since(m.lastClaim) < redisStreamClaimInterval {
+		return
+	}
+	m.lastClaim = time.Now()
+
+	msgs, next, err := client.XAutoClaim(ctx, &redis2.XAutoClaimArgs{
+		Stream:   m.stream,
+		Group:    m.group,
+		MinIdle:  redisStreamClaimIdle,
+		Start:    m.claimFrom,
+		Count:    redisStreamCount,
+		Consumer: m.consumer,
+	}).Result()
+	if err != nil {
+		return
+	}
+	m.claimFrom = next
+	m.buf = append(m.buf, msgs...)
+}
+
+func (m *RedisStreamReader) next(ctx context.Context) (redis2.XMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for len(m.buf) == 0 {
+		if err := ctx.Err(); err != nil {
+			return redis2.XMessage{}, err
+		}
+
+		client, err := getRedisStreamClient(ctx, m.namespace)
+		if err != nil {
+			return redis2.XMessage{}, err
+		}
+
+		m.claim(ctx, client)
+		if len(m.buf) > 0 {
+			break
+		}
+
+		streams, err := client.XReadGroup(ctx, &redis2.XReadGroupArgs{
+			Group:    m.group,
+			Consumer: m.consumer,
+			Streams:  []string{m.stream, ">"},
+			Count:    redisStreamCount,
+			Block:    redisStreamBlock,
+		}).Result()
+		if err == redis2.Nil {
+			continue
+		}
+		if err != nil {
+			return redis2.XMessage{}, err
+		}
+		for _, stream := range streams {
+			m.buf = append(m.buf, stream.Messages...)
+		}
+	}
+
+	msg := m.buf[0]
+	m.buf = m.buf[1:]
+	return msg, nil
+}
+
+func (m *RedisStreamReader) ack(ctx context.Context, id string) error {
+	client, err := getRedisStreamClient(ctx, m.namespace)
+	if err != nil {
+		return err
+	}
+	return client.XAck(ctx, m.stream, m.group, id).Err()
+}
+
+func (m *RedisStreamReader) ReadMsg(ctx context.Context, v interface{}, ov interface{}) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	msg, err := m.next(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = m.ack(ctx, msg.ID)
+	if err != nil {
+		return err
+	}
+
+	body, err := redisStreamBody(msg)
+	if err != nil {
+		return err
+	}
+
+	err = unmarshalMsg(body, v)
+	if err != nil {
+		return err
+	}
+
+	err = unmarshalMsg(body, ov)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *RedisStreamReader) FetchMsg(ctx context.Context, v interface{}, ov interface{}) (Handler, error) {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	msg, err := m.next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: 无法解析的消息重新投递也无法处理，直接确认丢弃
+	body, err := redisStreamBody(msg)
+	if err == nil {
+		err = unmarshalMsg(body, v)
+	}
+	if err == nil {
+		err = unmarshalMsg(body, ov)
+	}
+	if err != nil {
+		m.ack(ctx, msg.ID)
+		return nil, err
+	}
+
+	key, _ := msg.Values[redisStreamFieldKey].(string)
+	return &RedisStreamHandler{reader: m, id: msg.ID, key: key}, nil
+}
+
+func (m *RedisStreamReader) setID(ctx context.Context, id string) error {
+	client, err := getRedisStreamClient(ctx, m.namespace)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.buf = nil
+	m.mu.Unlock()
+	return client.XGroupSetID(ctx, m.stream, m.group, id).Err()
+}
+
+func (m *RedisStreamReader) SetOffsetAt(ctx context.Context, t time.Time) error {
+	return m.setID(ctx, redisStreamIDAt(t))
+}
+
+// SetOffset 只支持 FirstOffset 与 LastOffset，stream 的消息 id 无法用 int64 表示
+func (m *RedisStreamReader) SetOffset(ctx context.Context, offset int64) error {
+	switch offset {
+	case FirstOffset:
+		return m.setID(ctx, "0")
+	case LastOffset:
+		return m.setID(ctx, "$")
+	default:
+		return fmt.Errorf("redis stream reader does not support offset %d, stream: %s", offset, m.stream)
+	}
+}
+
+func (m *RedisStreamReader) deleteGroup(ctx context.Context) error {
+	client, err := getRedisStreamClient(ctx, m.namespace)
+	if err != nil {
+		return err
+	}
+	return client.XGroupDestroy(ctx, m.stream, m.group).Err()
+}
+
+// Close 连接由 redis.DefaultInstanceManager 管理，这里不需要关闭
+func (m *RedisStreamReader) Close() error {
+	return nil
+}
+
+type RedisStreamWriter struct {
+	namespace string
+	stream    string
+}
+
+func NewRedisStreamWriter(brokers []string, topic string) (*RedisStreamWriter, error) {
+	namespace, err := redisStreamNamespace(brokers, topic)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStreamWriter{
+		namespace: namespace,
+		stream:    topic,
+	}, nil
+}
+
+func (m *RedisStreamWriter) logConfigToSpan(span opentracing.Span) {
+	span.LogFields(
+		log.String(spanLogKeyMQType, fmt.Sprint(MQTypeRedis)),
+		log.String(spanLogKeyKafkaBrokers, m.namespace),
+	)
+}
+
+func (m *RedisStreamWriter) xaddArgs(k string, body []byte) *redis2.XAddArgs {
+	return &redis2.XAddArgs{
+		Stream: m.stream,
+		MaxLen: redisStreamMaxLen,
+		Approx: true,
+		Values: redisStreamValues(k, body),
+	}
+}
+
+func (m *RedisStreamWriter) WriteMsg(ctx context.Context, k string, v interface{}) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	msg, err := marshalMsg(v)
+	if err != nil {
+		return err
+	}
+
+	client, err := getRedisStreamClient(ctx, m.namespace)
+	if err != nil {
+		return err
+	}
+	return client.XAdd(ctx, m.xaddArgs(k, msg)).Err()
+}
+
+func (m *RedisStreamWriter) WriteMsgs(ctx context.Context, msgs ...Message) error {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	var args []*redis2.XAddArgs
+	for _, msg := range msgs {
+		body, err := marshalMsg(msg.Value)
+		if err != nil {
+			return err
+		}
+		args = append(args, m.xaddArgs(msg.Key, body))
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	client, err := getRedisStreamClient(ctx, m.namespace)
+	if err != nil {
+		return err
+	}
+	pipe := client.Pipeline()
+	for _, a := range args {
+		pipe.XAdd(ctx, a)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// WriteMsgsResult 使用 pipeline 写入，每条消息对应一个 XADD 的结果，stream 的消息 id 无法用 offset 表示
+func (m *RedisStreamWriter) WriteMsgsResult(ctx context.Context, msgs ...Message) []MsgResult {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		m.logConfigToSpan(span)
+	}
+
+	results := newMsgResults(msgs, nil)
+	client, err := getRedisStreamClient(ctx, m.namespace)
+	if err != nil {
+		return newMsgResults(msgs, err)
+	}
+
+	pipe := client.Pipeline()
+	cmds := make([]*redis2.StringCmd, len(msgs))
+	for i, msg := range msgs {
+		body, err := marshalMsg(msg.Value)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		cmds[i] = pipe.XAdd(ctx, m.xaddArgs(msg.Key, body))
+	}
+	// NOTE: 每条命令的错误从 cmd 中获取，Exec 返回的是第一个错误
+	pipe.Exec(ctx)
+
+	for i, cmd := range cmds {
+		if cmd != nil {
+			results[i].Err = cmd.Err()
+		}
+	}
+	return results
+}
+
+// Close 连接由 redis.DefaultInstanceManager 管理，这里不需要关闭
+func (m *RedisStreamWriter) Close() error {
+	return nil
+}
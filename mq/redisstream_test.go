@@ -0,0 +1,29 @@
+package mq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+	redis2 "github.com/redis/go-redis/v9"
+)
+
+func TestRedisStreamIDAt(t *testing.T) {
+	assert.Equal(t, redisStreamIDAt(time.Unix(1, 0)), "999-0")
+	assert.Equal(t, redisStreamIDAt(time.Unix(0, 0)), "0")
+}
+
+func TestRedisStreamBody(t *testing.T) {
+	body, err := redisStreamBody(redis2.XMessage{
+		ID:     "1-0",
+		Values: map[string]interface{}{redisStreamFieldKey: "k", redisStreamFieldValue: `{"v":"1"}`},
+	})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, string(body), `{"v":"1"}`)
+
+	_, err = redisStreamBody(redis2.XMessage{ID: "1-0"})
+	assert.True(t, err != nil)
+
+	_, err = redisStreamNamespace(nil, defaultTestTopic)
+	assert.True(t, err != nil)
+}
@@ -0,0 +1,191 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+const (
+	defaultReplayIdleTimeout = 10 * time.Second
+)
+
+type ReplayOptions struct {
+	// MaxAttempts、退避、Filters 与 Interceptors 的含义与 ConsumeByGroup 相同，
+	// 不使用 DLQTopic、Concurrency、KeyOrdered 与 ManualCommit，消息逐条处理
+	ConsumeOptions
+	// 回放使用的 group，为空时生成临时的 group，结束后删除
+	GroupID string
+	// 超过该时间没有读取到消息，或所有读取过的 partition 都已超过结束时间且一直没有窗口内的消息时结束，
+	// <= 0 时使用 defaultReplayIdleTimeout
+	IdleTimeout time.Duration
+}
+
+func (m *ReplayOptions) idleTimeout() time.Duration {
+	if m.IdleTimeout <= 0 {
+		return defaultReplayIdleTimeout
+	}
+	return m.IdleTimeout
+}
+
+// groupDeleter 由能够删除 group 的后端的 Reader 实现，Replay 结束后删除临时的 group
+type groupDeleter interface {
+	deleteGroup(ctx context.Context) error
+}
+
+func replayGroupID(topic string) string {
+	return fmt.Sprintf("%s.replay.%d", topic, time.Now().UnixNano())
+}
+
+// Replay 使用单独的 group 从 from 开始重新消费 topic，依次交给 fn 处理写入时间在 [from, to] 内的消息，用于补数据与故障恢复，
+// fn 重试 MaxAttempts 次后仍然失败时停止回放并返回错误，不会写入死信 topic；正常读完或 ctx 结束时关闭 reader 并删除临时的 group
+// NOTE: 依赖消息的写入时间判断结束，nsq 等无法获取写入时间的后端只能在读完所有消息后按 IdleTimeout 结束；
+// segmentio/kafka-go v0.3.4 没有 DeleteGroups 请求，kafka 的临时 group 在 broker 的 offsets.retention 之后过期
+func Replay(ctx context.Context, topic string, from, to time.Time, fn ConsumeFunc, opts *ReplayOptions) error {
+	fun := "mq.Replay -->"
+
+	if opts == nil {
+		opts = &ReplayOptions{}
+	}
+	if !from.Before(to) {
+		return fmt.Errorf("%s invalid window, from: %s, to: %s", fun, from, to)
+	}
+	groupId := opts.GroupID
+	temporary := len(groupId) == 0
+	if temporary {
+		groupId = replayGroupID(topic)
+	}
+
+	reader, err := getGroupReader(ctx, topic, groupId)
+	if err != nil {
+		slog.Errorf(ctx, "%s getGroupReader err: %v, topic: %s, groupId: %s", fun, err, topic, groupId)
+		return err
+	}
+	conf := newGroupReaderConf(ctx, topic, groupId)
+	defer func() {
+		if deleter, ok := reader.(groupDeleter); ok && temporary {
+			if err := deleter.deleteGroup(ctx); err != nil {
+				slog.Warnf(ctx, "%s deleteGroup err: %v, topic: %s, groupId: %s", fun, err, topic, groupId)
+			}
+		}
+		if err := defaultInstanceManager.remove(ctx, conf); err != nil {
+			slog.Warnf(ctx, "%s close reader err: %v, topic: %s, groupId: %s", fun, err, topic, groupId)
+		}
+	}()
+
+	if err = reader.SetOffsetAt(ctx, from); err != nil {
+		slog.Errorf(ctx, "%s SetOffsetAt err: %v, topic: %s, groupId: %s", fun, err, topic, groupId)
+		return fmt.Errorf("%s, SetOffsetAt err: %v, topic: %s", fun, err, topic)
+	}
+
+	slog.Infof(ctx, "%s start, topic: %s, groupId: %s, from: %s, to: %s", fun, topic, groupId, from, to)
+	fn = interceptConsume(fn, opts.Interceptors)
+	state := newReplayState(to, opts.idleTimeout())
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, opts.idleTimeout())
+		msg, _ := fetchConsumeMsg(fetchCtx, conf)
+		idle := fetchCtx.Err() == context.DeadlineExceeded
+		cancel()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if msg == nil {
+			if idle {
+				break
+			}
+			continue
+		}
+
+		if !state.inWindow(msg) {
+			if state.done() {
+				break
+			}
+			continue
+		}
+		if err = replayMsg(ctx, &opts.ConsumeOptions, msg, fn); err != nil {
+			slog.Errorf(ctx, "%s handle err: %v, topic: %s, groupId: %s, handled: %d", fun, err, topic, groupId, state.handled)
+			return err
+		}
+		state.handled++
+	}
+	slog.Infof(ctx, "%s done, topic: %s, groupId: %s, handled: %d", fun, topic, groupId, state.handled)
+	return nil
+}
+
+// replayState 记录每个 partition 是否已读到结束时间之后的消息
+type replayState struct {
+	to      time.Time
+	idle    time.Duration
+	handled int
+
+	// partition -> 是否已超过结束时间
+	partitions   map[int]bool
+	lastInWindow time.Time
+}
+
+func newReplayState(to time.Time, idle time.Duration) *replayState {
+	return &replayState{
+		to:           to,
+		idle:         idle,
+		partitions:   make(map[int]bool),
+		lastInWindow: time.Now(),
+	}
+}
+
+// inWindow 无法获取写入时间的消息都交给 fn 处理
+func (m *replayState) inWindow(msg *ConsumeMsg) bool {
+	passed := !msg.Time.IsZero() && msg.Time.After(m.to)
+	m.partitions[msg.Partition] = passed
+	if !passed {
+		m.lastInWindow = time.Now()
+	}
+	return !passed
+}
+
+// done 所有读取过的 partition 都已超过结束时间，并且 idle 时间内没有窗口内的消息，
+// 避免还没有读取到的 partition 被遗漏
+func (m *replayState) done() bool {
+	for _, passed := range m.partitions {
+		if !passed {
+			return false
+		}
+	}
+	return time.Since(m.lastInWindow) >= m.idle
+}
+
+func replayMsg(ctx context.Context, opts *ConsumeOptions, msg *ConsumeMsg, fn ConsumeFunc) error {
+	mctx, _ := parsePayload(msg.payload, "mq.Replay", &json.RawMessage{})
+	mspan := opentracing.SpanFromContext(mctx)
+	defer mspan.Finish()
+	mspan.LogFields(
+		log.String(spanLogKeyTopic, msg.Topic),
+		log.String(spanLogKeyKafkaGroupID, msg.GroupID))
+
+	if !opts.filter(mctx, msg) {
+		return nil
+	}
+
+	for i := 1; ; i++ {
+		msg.Attempts = i
+		err := callConsumeFunc(mctx, msg, fn)
+		if err == nil {
+			return nil
+		}
+		if i >= opts.maxAttempts() || !opts.retryable(err) {
+			return err
+		}
+		if !sleepContext(ctx, opts.backoff(i)) {
+			return ctx.Err()
+		}
+	}
+}
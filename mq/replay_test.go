@@ -0,0 +1,64 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestReplay(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.replay"
+	write := func(from, to int) {
+		for i := from; i < to; i++ {
+			assert.Equal(t, WriteMsg(context.TODO(), topic, fmt.Sprintf("k%d", i), &memoryTestMsg{ID: i}), nil)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	write(0, 3)
+	from := time.Now()
+	write(3, 6)
+	to := time.Now()
+	write(6, 9)
+
+	var ids []int
+	err := Replay(context.TODO(), topic, from, to, func(ctx context.Context, msg *ConsumeMsg) error {
+		var v memoryTestMsg
+		assert.Equal(t, msg.Unmarshal(&v), nil)
+		assert.Equal(t, msg.Time.IsZero(), false)
+		ids = append(ids, v.ID)
+		return nil
+	}, &ReplayOptions{IdleTimeout: 50 * time.Millisecond})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ids, []int{3, 4, 5})
+
+	// 处理失败时停止回放
+	failed := errors.New("failed")
+	var attempts int
+	err = Replay(context.TODO(), topic, from, to, func(ctx context.Context, msg *ConsumeMsg) error {
+		attempts++
+		return failed
+	}, &ReplayOptions{
+		ConsumeOptions: ConsumeOptions{MaxAttempts: 2, BaseDelay: time.Millisecond},
+		IdleTimeout:    50 * time.Millisecond,
+	})
+	assert.Equal(t, err, failed)
+	assert.Equal(t, attempts, 2)
+}
+
+func TestReplayState(t *testing.T) {
+	to := time.Now()
+	state := newReplayState(to, 0)
+	assert.True(t, state.inWindow(&ConsumeMsg{Partition: 0, Time: to.Add(-time.Second)}))
+	assert.True(t, state.inWindow(&ConsumeMsg{Partition: 1}))
+	assert.Equal(t, state.inWindow(&ConsumeMsg{Partition: 0, Time: to.Add(time.Second)}), false)
+	assert.Equal(t, state.done(), false)
+	assert.Equal(t, state.inWindow(&ConsumeMsg{Partition: 1, Time: to.Add(time.Second)}), false)
+	assert.True(t, state.done())
+}
@@ -0,0 +1,197 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 基于 mq 的异步请求与响应：Requester 写入请求时带上 correlation id 与响应 topic，阻塞等待对应的响应直到 ctx 结束，
+// 服务端使用 Respond 包装处理函数后交给 ConsumeByGroup 消费请求 topic，处理函数的返回值写入响应 topic
+//
+//	requester := mq.StartRequester(ctx, "palfish.order.reply.host1")
+//	var resp OrderResp
+//	err := requester.Request(ctx, "palfish.order.request", key, &OrderReq{...}, &resp)
+//
+//	mq.ConsumeByGroup(ctx, "palfish.order.request", "order", mq.Respond(func(ctx context.Context, req *mq.Request) (interface{}, error) {
+//		var r OrderReq
+//		if err := req.Unmarshal(&r); err != nil {
+//			return nil, err
+//		}
+//		return handle(ctx, &r)
+//	}), nil)
+//
+// NOTE: 每个 Requester 使用单独的 group 读取响应 topic 的所有消息，只处理自己等待的响应，
+// 多个进程共用一个响应 topic 时每个进程都会读取全部响应，建议每个进程使用自己的响应 topic
+const requesterGroupSuffix = ".requester."
+
+// requestMsg 请求 topic 中的消息
+type requestMsg struct {
+	ID      string `json:"id"`
+	ReplyTo string `json:"reply_to"`
+	// 请求方 ctx 的截止时间，毫秒，超过后不再处理
+	Deadline int64           `json:"deadline,omitempty"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// replyMsg 响应 topic 中的消息
+type replyMsg struct {
+	ID    string          `json:"id"`
+	Error string          `json:"error,omitempty"`
+	Body  json.RawMessage `json:"body,omitempty"`
+}
+
+// ReplyError 处理函数返回的错误
+type ReplyError struct {
+	Message string
+}
+
+func (e *ReplyError) Error() string {
+	return "mq: reply error: " + e.Message
+}
+
+// Requester 写入请求并等待响应，并发安全
+type Requester struct {
+	replyTopic string
+	consumer   *Consumer
+
+	// id -> chan *replyMsg
+	pending sync.Map
+}
+
+// StartRequester 在后台消费 replyTopic 的响应，ctx 结束时停止，不再使用时调用 Close
+func StartRequester(ctx context.Context, replyTopic string) *Requester {
+	m := &Requester{
+		replyTopic: replyTopic,
+	}
+	m.consumer = StartConsumer(ctx, replyTopic, requesterGroupID(replyTopic), m.onReply, nil)
+	return m
+}
+
+func requesterGroupID(replyTopic string) string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s%s%s.%d.%d", replyTopic, requesterGroupSuffix, host, os.Getpid(), time.Now().UnixNano())
+}
+
+// Request 写入 req 到 topic 并等待响应解析到 resp，resp 为 nil 时不解析；
+// ctx 结束时返回 ctx.Err()，处理函数返回错误时返回 *ReplyError
+func (m *Requester) Request(ctx context.Context, topic, key string, req interface{}, resp interface{}) error {
+	fun := "Requester.Request -->"
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	msg := &requestMsg{
+		ID:      uuid.New().String(),
+		ReplyTo: m.replyTopic,
+		Body:    body,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.Deadline = unixMilli(deadline)
+	}
+
+	ch := make(chan *replyMsg, 1)
+	m.pending.Store(msg.ID, ch)
+	defer m.pending.Delete(msg.ID)
+
+	if err = WriteMsg(ctx, topic, key, msg); err != nil {
+		slog.Errorf(ctx, "%s write request err: %v, topic: %s, id: %s", fun, err, topic, msg.ID)
+		return err
+	}
+
+	select {
+	case reply := <-ch:
+		if reply.Error != "" {
+			return &ReplyError{Message: reply.Error}
+		}
+		if resp == nil {
+			return nil
+		}
+		return json.Unmarshal(reply.Body, resp)
+	case <-ctx.Done():
+		slog.Warnf(ctx, "%s wait reply err: %v, topic: %s, id: %s", fun, ctx.Err(), topic, msg.ID)
+		return ctx.Err()
+	}
+}
+
+// onReply 不是自己等待的响应直接忽略
+func (m *Requester) onReply(ctx context.Context, msg *ConsumeMsg) error {
+	var reply replyMsg
+	if err := msg.Unmarshal(&reply); err != nil {
+		slog.Errorf(ctx, "Requester.onReply --> unmarshal err: %v, topic: %s", err, msg.Topic)
+		return nil
+	}
+	if v, ok := m.pending.Load(reply.ID); ok {
+		select {
+		case v.(chan *replyMsg) <- &reply:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close 停止消费响应，等待中的 Request 在各自的 ctx 结束时返回
+func (m *Requester) Close(ctx context.Context) error {
+	return m.consumer.Close(ctx)
+}
+
+// Request Respond 的处理函数收到的请求
+type Request struct {
+	*ConsumeMsg
+	body json.RawMessage
+}
+
+// Unmarshal 解析请求的内容
+func (m *Request) Unmarshal(v interface{}) error {
+	return json.Unmarshal(m.body, v)
+}
+
+// RespondFunc 返回值按 json 编码后作为响应，返回错误时把错误信息返回给请求方
+type RespondFunc func(ctx context.Context, req *Request) (interface{}, error)
+
+// Respond 把 fn 包装为消费请求 topic 的 ConsumeFunc，请求方已超时的请求不再处理；
+// 响应写入失败时返回错误，按 ConsumeByGroup 的重试处理
+func Respond(fn RespondFunc) ConsumeFunc {
+	return func(ctx context.Context, msg *ConsumeMsg) error {
+		fun := "mq.Respond -->"
+
+		var req requestMsg
+		if err := msg.Unmarshal(&req); err != nil {
+			return Permanent(err)
+		}
+		if req.ID == "" || req.ReplyTo == "" {
+			return Permanent(fmt.Errorf("%s invalid request, topic: %s", fun, msg.Topic))
+		}
+		if req.Deadline > 0 && time.Now().After(time.Unix(0, req.Deadline*int64(time.Millisecond))) {
+			slog.Warnf(ctx, "%s skip expired request, topic: %s, id: %s", fun, msg.Topic, req.ID)
+			return nil
+		}
+
+		reply := &replyMsg{ID: req.ID}
+		value, err := fn(ctx, &Request{ConsumeMsg: msg, body: req.Body})
+		if err == nil {
+			reply.Body, err = json.Marshal(value)
+		}
+		if err != nil {
+			reply.Error = err.Error()
+			reply.Body = nil
+		}
+
+		if err = WriteMsg(ctx, req.ReplyTo, req.ID, reply); err != nil {
+			slog.Errorf(ctx, "%s write reply err: %v, replyTo: %s, id: %s", fun, err, req.ReplyTo, req.ID)
+			return err
+		}
+		return nil
+	}
+}
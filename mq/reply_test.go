@@ -0,0 +1,70 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestRequestRespond(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.request"
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	go ConsumeByGroup(ctx, topic, "g1", Respond(func(ctx context.Context, req *Request) (interface{}, error) {
+		var v memoryTestMsg
+		if err := req.Unmarshal(&v); err != nil {
+			return nil, err
+		}
+		if v.Name == "bad" {
+			return nil, errors.New("bad request")
+		}
+		return &memoryTestMsg{ID: v.ID + 1, Name: "reply"}, nil
+	}), nil)
+
+	requester := StartRequester(ctx, "palfish.test.reply")
+	defer requester.Close(context.TODO())
+
+	rctx, rcancel := context.WithTimeout(ctx, 2*time.Second)
+	defer rcancel()
+	var resp memoryTestMsg
+	assert.Equal(t, requester.Request(rctx, topic, "k1", &memoryTestMsg{ID: 1}, &resp), nil)
+	assert.Equal(t, resp, memoryTestMsg{ID: 2, Name: "reply"})
+
+	err := requester.Request(rctx, topic, "k2", &memoryTestMsg{ID: 2, Name: "bad"}, &resp)
+	assert.Equal(t, err, error(&ReplyError{Message: "bad request"}))
+}
+
+func TestRequestTimeout(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	requester := StartRequester(context.TODO(), "palfish.test.reply")
+	defer requester.Close(context.TODO())
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	err := requester.Request(ctx, "palfish.test.norespond", "k1", &memoryTestMsg{ID: 1}, nil)
+	assert.Equal(t, err, context.DeadlineExceeded)
+}
+
+func TestRespondExpired(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	var called bool
+	fn := Respond(func(ctx context.Context, req *Request) (interface{}, error) {
+		called = true
+		return nil, nil
+	})
+	msgs, err := generateMsgsPayload(context.TODO(), defaultTestTopic, Message{Value: &requestMsg{
+		ID: "id", ReplyTo: "palfish.test.reply", Deadline: unixMilli(time.Now().Add(-time.Second)),
+	}})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, fn(context.TODO(), &ConsumeMsg{Topic: defaultTestTopic, payload: msgs[0].Value.(*Payload)}), nil)
+	assert.Equal(t, called, false)
+	assert.Equal(t, MemoryTopicLen("palfish.test.reply"), 0)
+}
@@ -0,0 +1,82 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay  = 10 * time.Second
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent 包装不需要重试的错误，ConsumeFunc 返回后消息直接写入死信 topic
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// retryable 判断 ConsumeFunc 返回的错误是否需要重试
+func (m *ConsumeOptions) retryable(err error) bool {
+	if isPermanent(err) {
+		return false
+	}
+	if m.Retryable != nil {
+		return m.Retryable(err)
+	}
+	return true
+}
+
+// backoff 第 retries 次失败后的等待时间，BaseDelay 按 2 的指数增长，不超过 MaxDelay，
+// 再在 [1-Jitter, 1+Jitter] 范围内随机浮动，避免大量消费者同时重试
+func (m *ConsumeOptions) backoff(retries int) time.Duration {
+	base := m.BaseDelay
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	max := m.MaxDelay
+	if max <= 0 {
+		max = defaultRetryMaxDelay
+	}
+
+	delay := base
+	for i := 1; i < retries && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	jitter := m.Jitter
+	if jitter > 1 {
+		jitter = 1
+	}
+	if jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + jitter*(2*rand.Float64()-1)))
+	}
+	return delay
+}
@@ -0,0 +1,97 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+func TestConsumeOptionsBackoff(t *testing.T) {
+	opts := &ConsumeOptions{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	assert.Equal(t, opts.backoff(1), 10*time.Millisecond)
+	assert.Equal(t, opts.backoff(2), 20*time.Millisecond)
+	assert.Equal(t, opts.backoff(3), 40*time.Millisecond)
+	assert.Equal(t, opts.backoff(4), 50*time.Millisecond)
+	assert.Equal(t, opts.backoff(100), 50*time.Millisecond)
+
+	opts.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := opts.backoff(1)
+		assert.True(t, d >= 5*time.Millisecond && d <= 15*time.Millisecond)
+	}
+
+	assert.Equal(t, (&ConsumeOptions{}).backoff(1), defaultRetryBaseDelay)
+}
+
+func TestConsumeOptionsRetryable(t *testing.T) {
+	errTemp := errors.New("temporary")
+	opts := &ConsumeOptions{}
+	assert.True(t, opts.retryable(errTemp))
+	assert.True(t, !opts.retryable(Permanent(errTemp)))
+	assert.Equal(t, Permanent(nil), nil)
+	assert.Equal(t, Permanent(errTemp).Error(), "temporary")
+
+	opts.Retryable = func(err error) bool { return err != errTemp }
+	assert.True(t, !opts.retryable(errTemp))
+	assert.True(t, opts.retryable(errors.New("other")))
+}
+
+func TestConsumeByGroupRetry(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.retry"
+	err := WriteMsgs(context.TODO(), topic,
+		Message{Key: "k1", Value: &memoryTestMsg{ID: 1, Name: "flaky"}},
+		Message{Key: "k2", Value: &memoryTestMsg{ID: 2, Name: "permanent"}},
+		Message{Key: "k3", Value: &memoryTestMsg{ID: 3, Name: "last"}})
+	assert.Equal(t, err, nil)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	attempts := map[int][]int{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ConsumeByGroup(ctx, topic, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+			var v memoryTestMsg
+			if err := msg.Unmarshal(&v); err != nil {
+				return err
+			}
+			attempts[v.ID] = append(attempts[v.ID], msg.Attempts)
+			switch v.Name {
+			case "flaky":
+				if msg.Attempts < 3 {
+					return errors.New("flaky")
+				}
+			case "permanent":
+				return Permanent(errors.New("permanent"))
+			default:
+				cancel()
+			}
+			return nil
+		}, &ConsumeOptions{MaxAttempts: 5, BaseDelay: time.Millisecond})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("consume timeout")
+	}
+	assert.Equal(t, len(attempts[1]), 3)
+	assert.Equal(t, attempts[1][2], 3)
+	assert.Equal(t, len(attempts[2]), 1)
+	assert.Equal(t, len(attempts[3]), 1)
+
+	rctx, rcancel := context.WithTimeout(context.TODO(), 2*time.Second)
+	defer rcancel()
+	_, msg, _, err := FetchDLQMsg(rctx, topic, "inspect")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, msg.Error, "permanent")
+	assert.Equal(t, msg.Attempts, 1)
+	assert.Equal(t, msg.Payload.Retries, 1)
+	assert.Equal(t, MemoryTopicLen(topic+dlqTopicSuffix), 1)
+}
@@ -6,7 +6,8 @@ package mq
 
 import (
 	"context"
-	"encoding/json"
+	"time"
+
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/shawnfeng/sutil/scontext"
@@ -17,9 +18,23 @@ type Payload struct {
 	Value   string                     `json:"v"`
 	Head    interface{}                `json:"h"`
 	Control interface{}                `json:"t"`
+	// 消息已处理失败的次数，重新投递时延续
+	Retries int `json:"r,omitempty"`
+	// Value 的编码，为空时为 json
+	Codec string `json:"e,omitempty"`
+	// 消息格式的版本，v1 的消息没有以下的字段，见 payloadVersion
+	Version int `json:"ver,omitempty"`
+	// Value 解码后内容的类型，为空时按 Codec 推断
+	ContentType string `json:"ct,omitempty"`
+	// 写入的时间，毫秒，v1 的消息为 0
+	Timestamp int64 `json:"ts,omitempty"`
+
+	// 写入时的消息格式
+	format PayloadFormat
 }
 
-func generatePayload(ctx context.Context, value interface{}) (*Payload, error) {
+// payloadContext 取出 ctx 中写入 Payload 的 trace、Head 与 Control
+func payloadContext(ctx context.Context) (opentracing.TextMapCarrier, interface{}, interface{}) {
 	carrier := opentracing.TextMapCarrier(make(map[string]string))
 	span := opentracing.SpanFromContext(ctx)
 	if span != nil {
@@ -29,47 +44,57 @@ func generatePayload(ctx context.Context, value interface{}) (*Payload, error) {
 			carrier)
 	}
 
-	msg, err := json.Marshal(value)
-	if err != nil {
-		return nil, err
-	}
 	head := ctx.Value(scontext.ContextKeyHead)
 	control := ctx.Value(scontext.ContextKeyControl)
-
-	return &Payload{
-		Carrier: carrier,
-		Value:   string(msg),
-		Head:    head,
-		Control: control,
-	}, nil
+	return carrier, head, control
 }
 
-func generateMsgsPayload(ctx context.Context, msgs ...Message) ([]Message, error) {
-	carrier := opentracing.TextMapCarrier(make(map[string]string))
-	span := opentracing.SpanFromContext(ctx)
-	if span != nil {
-		opentracing.GlobalTracer().Inject(
-			span.Context(),
-			opentracing.TextMap,
-			carrier)
+func generatePayload(ctx context.Context, topic string, value interface{}) (*Payload, error) {
+	carrier, head, control := payloadContext(ctx)
+	payload := &Payload{
+		Carrier:   carrier,
+		Head:      head,
+		Control:   control,
+		Version:   payloadVersion,
+		Timestamp: unixMilli(time.Now()),
 	}
-	head := ctx.Value(scontext.ContextKeyHead)
-	control := ctx.Value(scontext.ContextKeyControl)
+	err := marshalPayloadValue(topic, payload, value)
+	if err != nil {
+		return nil, err
+	}
+	if err = claimPayloadValue(ctx, topic, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// generateMsgsPayload Message.Ctx 为空的消息使用 ctx 的 trace 与 Head
+func generateMsgsPayload(ctx context.Context, topic string, msgs ...Message) ([]Message, error) {
+	carrier, head, control := payloadContext(ctx)
+	now := unixMilli(time.Now())
 
 	var nmsgs []Message
 	for _, msg := range msgs {
-		body, err := json.Marshal(msg.Value)
+		payload := &Payload{
+			Carrier:   carrier,
+			Head:      head,
+			Control:   control,
+			Version:   payloadVersion,
+			Timestamp: now,
+		}
+		if msg.Ctx != nil {
+			payload.Carrier, payload.Head, payload.Control = payloadContext(msg.Ctx)
+		}
+		err := marshalPayloadValue(topic, payload, msg.Value)
 		if err != nil {
 			return nil, err
 		}
+		if err = claimPayloadValue(ctx, topic, payload); err != nil {
+			return nil, err
+		}
 		nmsgs = append(nmsgs, Message{
-			Key: msg.Key,
-			Value: &Payload{
-				Carrier: carrier,
-				Value:   string(body),
-				Head:    head,
-				Control: control,
-			},
+			Key:   msg.Key,
+			Value: payload,
 		})
 	}
 
@@ -90,7 +115,7 @@ func parsePayload(payload *Payload, opName string, value interface{}) (context.C
 	ctx = context.WithValue(ctx, scontext.ContextKeyHead, payload.Head)
 	ctx = context.WithValue(ctx, scontext.ContextKeyControl, payload.Control)
 
-	err = json.Unmarshal([]byte(payload.Value), value)
+	err = unmarshalPayloadValue(payload, value)
 	if err != nil {
 		return ctx, err
 	}
@@ -0,0 +1,23 @@
+package mq
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+	"github.com/shawnfeng/sutil/scontext"
+)
+
+func TestGenerateMsgsPayloadCtx(t *testing.T) {
+	ctx := context.WithValue(context.TODO(), scontext.ContextKeyHead, "batch")
+	mctx := context.WithValue(context.TODO(), scontext.ContextKeyHead, "request")
+
+	msgs, err := generateMsgsPayload(ctx, defaultTestTopic,
+		Message{Key: "k1", Value: 1},
+		Message{Key: "k2", Value: 2, Ctx: mctx})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(msgs), 2)
+	assert.Equal(t, msgs[0].Value.(*Payload).Head, "batch")
+	assert.Equal(t, msgs[1].Value.(*Payload).Head, "request")
+	assert.Equal(t, msgs[1].Ctx, nil)
+}
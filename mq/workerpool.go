@@ -0,0 +1,164 @@
+// Copyright 2014 The mqrouter Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mq
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+// 每个 goroutine 最多同时持有的已读取未提交的消息数
+const consumeInflightPerWorker = 2
+
+type consumeJob struct {
+	msg     *ConsumeMsg
+	handler Handler
+	done    bool
+}
+
+// consumeCommitter 消息并发处理完成的顺序与读取顺序不同，按读取顺序只提交连续处理完成的消息，
+// 避免 kafka 等按 offset 提交的后端跳过未处理完的消息；同时限制未提交的消息数
+type consumeCommitter struct {
+	mu       sync.Mutex
+	jobs     []*consumeJob
+	inflight chan struct{}
+}
+
+func newConsumeCommitter(size int) *consumeCommitter {
+	return &consumeCommitter{
+		inflight: make(chan struct{}, size),
+	}
+}
+
+// add 未提交的消息数达到上限时阻塞，ctx 结束时返回 false
+func (m *consumeCommitter) add(ctx context.Context, job *consumeJob) bool {
+	select {
+	case m.inflight <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs = append(m.jobs, job)
+	return true
+}
+
+// done 标记 job 处理完成，并依次提交之前都已处理完成的消息，返回第一个提交失败的错误
+func (m *consumeCommitter) done(ctx context.Context, job *consumeJob) error {
+	fun := "consumeCommitter.done -->"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.done = true
+	var n int
+	var firstErr error
+	for ; n < len(m.jobs) && m.jobs[n].done; n++ {
+		if err := m.jobs[n].handler.CommitMsg(ctx); err != nil {
+			slog.Errorf(ctx, "%s CommitMsg err: %v, topic: %s", fun, err, m.jobs[n].msg.Topic)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		m.jobs[n] = nil
+		<-m.inflight
+	}
+	m.jobs = m.jobs[n:]
+	return firstErr
+}
+
+// keyQueue KeyOrdered 时相同 key 的消息总是交给同一个 goroutine
+func keyQueue(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// keyDispatcher KeyOrdered 时选择消息的队列，key 为空的消息轮流交给各队列，避免都集中在同一个 goroutine
+type keyDispatcher struct {
+	n    int
+	next int
+}
+
+func (m *keyDispatcher) queue(key string) int {
+	if key != "" {
+		return keyQueue(key, m.n)
+	}
+	idx := m.next
+	m.next = (m.next + 1) % m.n
+	return idx
+}
+
+// consumeConcurrently 读取消息后交给 opts.Concurrency 个 goroutine 处理，直到 fetchCtx 结束，
+// KeyOrdered 时每个 goroutine 有自己的队列，否则共用一个队列；停止读取后继续处理队列中的消息，
+// handleCtx 结束后未处理的消息不会提交
+func consumeConcurrently(fetchCtx, handleCtx context.Context, conf *instanceConf, dlqTopic string, opts *ConsumeOptions, fn ConsumeFunc, pauser *consumePauser, limiter *consumeLimiter, tracker *partitionTracker) {
+	n := opts.Concurrency
+	size := n * consumeInflightPerWorker
+	committer := newConsumeCommitter(size)
+
+	dispatcher := &keyDispatcher{n: n}
+	queues := make([]chan *consumeJob, 1)
+	if opts.KeyOrdered {
+		queues = make([]chan *consumeJob, n)
+	}
+	for i := range queues {
+		// NOTE: 队列容量与未提交消息数的上限一致，读取时只会因为上限阻塞，不会因为某个 key 处理慢阻塞其他 key
+		queues[i] = make(chan *consumeJob, size)
+	}
+
+	var pending pendingJobs
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(queue <-chan *consumeJob) {
+			defer wg.Done()
+			for job := range queue {
+				if handleCtx.Err() == nil && pauser.waitPartition(fetchCtx, job.msg.Partition) &&
+					consumeMsg(handleCtx, dlqTopic, opts, job.msg, fn) && !opts.ManualCommit {
+					job.msg.Commit(handleCtx)
+				}
+				pending.add(-1)
+			}
+		}(queues[i%len(queues)])
+	}
+	drain := func() bool { return pending.drain(handleCtx) }
+
+	for pauser.waitFetch(fetchCtx) {
+		msg, handler := fetchConsumeMsg(fetchCtx, conf)
+		if msg == nil {
+			continue
+		}
+		if !tracker.observe(handleCtx, conf, msg, drain) || !limiter.wait(fetchCtx, msg) {
+			break
+		}
+		job := &consumeJob{
+			msg:     msg,
+			handler: handler,
+		}
+		msg.commit = func(ctx context.Context) error {
+			return committer.done(ctx, job)
+		}
+		if !committer.add(fetchCtx, job) {
+			break
+		}
+
+		var idx int
+		if opts.KeyOrdered {
+			idx = dispatcher.queue(msg.Key)
+		}
+		pending.add(1)
+		queues[idx] <- job
+	}
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,196 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaneshin/go-pkg/testing/assert"
+)
+
+type recordHandler struct {
+	id        int
+	committed *[]int
+}
+
+func (m *recordHandler) CommitMsg(ctx context.Context) error {
+	*m.committed = append(*m.committed, m.id)
+	return nil
+}
+
+func TestConsumeCommitterOrder(t *testing.T) {
+	committer := newConsumeCommitter(3)
+	var committed []int
+	var jobs []*consumeJob
+	for i := 0; i < 3; i++ {
+		job := &consumeJob{
+			msg:     &ConsumeMsg{},
+			handler: &recordHandler{id: i, committed: &committed},
+		}
+		assert.Equal(t, committer.add(context.TODO(), job), true)
+		jobs = append(jobs, job)
+	}
+
+	// 达到上限时阻塞
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, committer.add(ctx, &consumeJob{}), false)
+
+	committer.done(context.TODO(), jobs[2])
+	committer.done(context.TODO(), jobs[1])
+	assert.Equal(t, len(committed), 0)
+
+	committer.done(context.TODO(), jobs[0])
+	assert.Equal(t, fmt.Sprint(committed), "[0 1 2]")
+	assert.Equal(t, len(committer.jobs), 0)
+	assert.Equal(t, len(committer.inflight), 0)
+}
+
+func TestConsumeByGroupConcurrency(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.concurrency"
+	const keys, perKey = 4, 10
+	var msgs []Message
+	for i := 0; i < keys*perKey; i++ {
+		msgs = append(msgs, Message{
+			Key:   fmt.Sprintf("k%d", i%keys),
+			Value: &memoryTestMsg{ID: i},
+		})
+	}
+	assert.Equal(t, WriteMsgs(context.TODO(), topic, msgs...), nil)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var mu sync.Mutex
+	var running, maxRunning, total int
+	keyRunning := map[string]bool{}
+	lastID := map[string]int{}
+	ordered := true
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ConsumeByGroup(ctx, topic, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+			var v memoryTestMsg
+			if err := msg.Unmarshal(&v); err != nil {
+				return err
+			}
+
+			mu.Lock()
+			if keyRunning[msg.Key] {
+				ordered = false
+			}
+			if last, ok := lastID[msg.Key]; ok && last > v.ID {
+				ordered = false
+			}
+			keyRunning[msg.Key] = true
+			lastID[msg.Key] = v.ID
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			keyRunning[msg.Key] = false
+			running--
+			total++
+			if total == keys*perKey {
+				cancel()
+			}
+			mu.Unlock()
+			return nil
+		}, &ConsumeOptions{Concurrency: keys, KeyOrdered: true})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("consume timeout")
+	}
+	assert.Equal(t, total, keys*perKey)
+	assert.Equal(t, ordered, true)
+	assert.True(t, maxRunning > 1)
+	assert.True(t, maxRunning <= keys)
+}
+
+func TestKeyQueue(t *testing.T) {
+	assert.Equal(t, keyQueue("k1", 8), keyQueue("k1", 8))
+	for _, key := range []string{"", "k1", "k2", "user_1001"} {
+		idx := keyQueue(key, 3)
+		assert.True(t, idx >= 0 && idx < 3)
+	}
+}
+
+func TestKeyDispatcher(t *testing.T) {
+	d := &keyDispatcher{n: 3}
+	assert.Equal(t, d.queue("k1"), keyQueue("k1", 3))
+	assert.Equal(t, d.queue("k1"), keyQueue("k1", 3))
+
+	seen := map[int]bool{}
+	for i := 0; i < 3; i++ {
+		seen[d.queue("")] = true
+	}
+	assert.Equal(t, len(seen), 3)
+}
+
+func TestConsumeByGroupManualCommit(t *testing.T) {
+	defer useMemoryConfiger(t)()
+
+	topic := "palfish.test.manualcommit"
+	const total = 10
+	for i := 0; i < total; i++ {
+		assert.Equal(t, WriteMsg(context.TODO(), topic, fmt.Sprintf("k%d", i), &memoryTestMsg{ID: i}), nil)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	const concurrency = 2
+	received := make(chan *ConsumeMsg, total)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ConsumeByGroup(ctx, topic, "g1", func(ctx context.Context, msg *ConsumeMsg) error {
+			received <- msg
+			return nil
+		}, &ConsumeOptions{Concurrency: concurrency, ManualCommit: true})
+	}()
+
+	// 未提交的消息数达到上限后停止读取
+	var msgs []*ConsumeMsg
+	for len(msgs) < concurrency*consumeInflightPerWorker {
+		select {
+		case msg := <-received:
+			msgs = append(msgs, msg)
+		case <-time.After(time.Second):
+			t.Fatal("consume timeout")
+		}
+	}
+	select {
+	case <-received:
+		t.Fatal("received msg over inflight limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	for _, msg := range msgs {
+		assert.Equal(t, msg.Commit(ctx), nil)
+		assert.Equal(t, msg.Commit(ctx), nil)
+	}
+	for len(msgs) < total {
+		select {
+		case msg := <-received:
+			msgs = append(msgs, msg)
+			assert.Equal(t, msg.Commit(ctx), nil)
+		case <-time.After(time.Second):
+			t.Fatal("consume timeout")
+		}
+	}
+	cancel()
+	<-done
+}
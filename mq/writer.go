@@ -7,6 +7,9 @@ package mq
 import (
 	"context"
 	"fmt"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
 )
 
 type Writer interface {
@@ -16,7 +19,7 @@ type Writer interface {
 }
 
 func NewWriter(ctx context.Context, topic string) (Writer, error) {
-	config, err := DefaultConfiger.GetConfig(ctx, topic, MQTypeKafka)
+	config, err := getReadWriteConfig(ctx, topic)
 	if err != nil {
 		return nil, err
 	}
@@ -24,9 +27,132 @@ func NewWriter(ctx context.Context, topic string) (Writer, error) {
 	mqType := config.MQType
 	switch mqType {
 	case MQTypeKafka:
-		return NewKafkaWriter(config.MQAddr, wrapTopicFromContext(ctx, topic)), nil
+		codec, err := kafkaCompressionCodec(config.Compression)
+		if err != nil {
+			return nil, err
+		}
+		dialer, err := kafkaDialer(config.Auth)
+		if err != nil {
+			return nil, err
+		}
+		balancer := kafkaBalancer(topic, config.Partitioner, config.BatchSize)
+		// 共享的 writer 只开启幂等，事务使用 NewTxnWriter，避免与其使用相同的 transactionalid
+		if config.Idempotent || config.TxnID != "" {
+			writer, err := NewKafkaTxnWriter(config.MQAddr, wrapTopicFromContext(ctx, topic), "", config.Compression, config.HeaderCarrier, balancer, config.Auth)
+			if err != nil {
+				return nil, err
+			}
+			return writer, nil
+		}
+		return NewKafkaWriter(config.MQAddr, wrapTopicFromContext(ctx, topic), config.BatchSize, config.Linger, codec, config.HeaderCarrier, balancer, dialer), nil
+
+	case MQTypeRabbitMQ:
+		writer, err := NewRabbitMQWriter(config.MQAddr, wrapTopicFromContext(ctx, topic))
+		if err != nil {
+			return nil, err
+		}
+		return writer, nil
+
+	case MQTypePulsar:
+		writer, err := NewPulsarWriter(config.MQAddr, wrapTopicFromContext(ctx, topic), config.BatchSize, config.Linger, config.Compression)
+		if err != nil {
+			return nil, err
+		}
+		return writer, nil
+
+	case MQTypeNSQ:
+		writer, err := NewNSQWriter(config.MQAddr, wrapTopicFromContext(ctx, topic))
+		if err != nil {
+			return nil, err
+		}
+		return writer, nil
+
+	case MQTypeRedis:
+		writer, err := NewRedisStreamWriter(config.MQAddr, wrapTopicFromContext(ctx, topic))
+		if err != nil {
+			return nil, err
+		}
+		return writer, nil
+
+	case MQTypeMemory:
+		return NewMemoryWriter(wrapTopicFromContext(ctx, topic)), nil
 
 	default:
 		return nil, fmt.Errorf("mqType %d error", mqType)
 	}
 }
+
+// NewTxnWriter 创建 kafka 事务 writer，topic 需要配置 transactionalid，
+// 写入的消息只对 isolation level 为 read_committed 的消费者在提交后可见，配置了 transactionalid 的 topic 的 reader 默认为 read_committed；
+// transactional.id 为 transactionalid 加上 instance，instance 在同一服务的实例间唯一并且在重启后保持不变，
+// 如 statefulset 的 pod 名或者处理的输入分区，只有一个实例时可以为空
+func NewTxnWriter(ctx context.Context, topic, instance string) (TxnWriter, error) {
+	config, err := getReadWriteConfig(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	if config.MQType != MQTypeKafka || config.TxnID == "" {
+		return nil, fmt.Errorf("topic %s has no kafka transactionalid config", topic)
+	}
+
+	balancer := kafkaBalancer(topic, config.Partitioner, config.BatchSize)
+	writer, err := NewKafkaTxnWriter(config.MQAddr, wrapTopicFromContext(ctx, topic), kafkaTxnID(config.TxnID, instance), config.Compression, config.HeaderCarrier, balancer, config.Auth)
+	if err != nil {
+		return nil, err
+	}
+	return &txnWriter{writer: writer, topic: topic}, nil
+}
+
+// txnWriter 与 WriteMsgs 相同，消息依次经过 interceptor、编码与 claim check 后写入，并统计写入的结果
+type txnWriter struct {
+	writer *KafkaTxnWriter
+	topic  string
+}
+
+func (m *txnWriter) WriteMsg(ctx context.Context, key string, value interface{}) error {
+	return m.WriteMsgs(ctx, Message{Key: key, Value: value})
+}
+
+func (m *txnWriter) WriteMsgs(ctx context.Context, msgs ...Message) error {
+	return publish(ctx, m.topic, msgs, func(ctx context.Context, topic string, msgs ...Message) error {
+		span, ctx := opentracing.StartSpanFromContext(ctx, "mq.TxnWriter.WriteMsgs")
+		defer span.Finish()
+		span.LogFields(log.String(spanLogKeyTopic, topic))
+
+		return writeWriterMsgs(ctx, m.writer, topic, msgs...)
+	})
+}
+
+// WriteMsgsResult interceptor 没有调用 next 时所有消息的结果为 interceptor 返回的 error
+func (m *txnWriter) WriteMsgsResult(ctx context.Context, msgs ...Message) []MsgResult {
+	var results []MsgResult
+	err := publish(ctx, m.topic, msgs, func(ctx context.Context, topic string, msgs ...Message) error {
+		span, ctx := opentracing.StartSpanFromContext(ctx, "mq.TxnWriter.WriteMsgsResult")
+		defer span.Finish()
+		span.LogFields(log.String(spanLogKeyTopic, topic))
+
+		var err error
+		results, err = writeWriterMsgsResult(ctx, m.writer, topic, msgs...)
+		return err
+	})
+	if results == nil {
+		return newMsgResults(msgs, err)
+	}
+	return results
+}
+
+func (m *txnWriter) BeginTxn() error {
+	return m.writer.BeginTxn()
+}
+
+func (m *txnWriter) CommitTxn() error {
+	return m.writer.CommitTxn()
+}
+
+func (m *txnWriter) AbortTxn() error {
+	return m.writer.AbortTxn()
+}
+
+func (m *txnWriter) Close() error {
+	return m.writer.Close()
+}
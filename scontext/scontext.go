@@ -3,12 +3,14 @@ package scontext
 import (
 	"context"
 	"errors"
+	"sync"
 )
 
 // 由于请求的上下文信息的 thrift 定义在 util 项目中，本模块主要为了避免循环依赖
 const (
 	ContextKeyTraceID = "traceID"
 
+	// 字符串 key 容易与其他包冲突，新代码使用 NewHeadContext 与 HeadFromContext
 	ContextKeyHead        = "Head"
 	ContextKeyHeadUid     = "uid"
 	ContextKeyHeadSource  = "source"
@@ -28,6 +30,63 @@ type ContextHeader interface {
 	ToKV() map[string]interface{}
 }
 
+// contextKey 类型化的 key，不会与其他包使用的字符串 key 冲突
+type contextKey int
+
+const (
+	// HeadKey Head 在 context 中的 key，通过 NewHeadContext 与 HeadFromContext 读写
+	HeadKey contextKey = iota
+)
+
+// HeadConverter 把 ContextKeyHead 中不是 ContextHeader 的值转换为 ContextHeader，
+// 如 mq 等从消息中解析出的 map，无法转换时返回 false
+type HeadConverter func(v interface{}) (ContextHeader, bool)
+
+var headConverters struct {
+	mu         sync.RWMutex
+	converters []HeadConverter
+}
+
+// RegisterHeadConverter 注册自定义 Head 的转换，HeadFromContext 按注册的顺序尝试，一般在 init 中调用
+func RegisterHeadConverter(fn HeadConverter) {
+	headConverters.mu.Lock()
+	defer headConverters.mu.Unlock()
+	headConverters.converters = append(headConverters.converters, fn)
+}
+
+func convertHead(v interface{}) (ContextHeader, bool) {
+	headConverters.mu.RLock()
+	defer headConverters.mu.RUnlock()
+	for _, fn := range headConverters.converters {
+		if head, ok := fn(v); ok {
+			return head, true
+		}
+	}
+	return nil, false
+}
+
+// NewHeadContext 返回带有 head 的 ctx，同时写入 ContextKeyHead，兼容直接读取 ContextKeyHead 的代码
+func NewHeadContext(ctx context.Context, head ContextHeader) context.Context {
+	ctx = context.WithValue(ctx, HeadKey, head)
+	return context.WithValue(ctx, ContextKeyHead, head)
+}
+
+// HeadFromContext 返回最近写入的 Head：NewHeadContext 同时写入两个 key，ContextKeyHead 中总是最近的值，
+// 不是 ContextHeader 的值使用 RegisterHeadConverter 注册的转换，
+// 仍然无法使用时视为其他包写入的同名 key，读取 NewHeadContext 写入的 Head
+func HeadFromContext(ctx context.Context) (ContextHeader, bool) {
+	if value := ctx.Value(ContextKeyHead); value != nil {
+		if head, ok := value.(ContextHeader); ok {
+			return head, true
+		}
+		if head, ok := convertHead(value); ok {
+			return head, true
+		}
+	}
+	head, ok := ctx.Value(HeadKey).(ContextHeader)
+	return head, ok
+}
+
 type ContextControlRouter interface {
 	GetControlRouteGroup() (string, bool)
 	SetControlRouteGroup(string) error
@@ -80,14 +139,8 @@ func GetControlRouteGroupWithDefault(ctx context.Context, dv string) string {
 }
 
 func getHeaderByKey(ctx context.Context, key string) (val interface{}, ok bool) {
-	head := ctx.Value(ContextKeyHead)
-	if head == nil {
-		ok = false
-		return
-	}
-
-	var header ContextHeader
-	if header, ok = head.(ContextHeader); ok {
+	header, ok := HeadFromContext(ctx)
+	if ok {
 		val, ok = header.ToKV()[key]
 	}
 	return
@@ -205,3 +205,50 @@ func TestContextControlCaller(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, "GetRtcRuntimeLog", method)
 }
+
+type mapHead map[string]interface{}
+
+func (m mapHead) ToKV() map[string]interface{} {
+	return m
+}
+
+func TestHeadContext(t *testing.T) {
+	ctx := NewHeadContext(context.Background(), &testHead{Uid: int64(100)})
+	head, ok := HeadFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, int64(100), head.ToKV()["uid"])
+	_, ok = ctx.Value(ContextKeyHead).(ContextHeader)
+	assert.True(t, ok)
+
+	// 其他包使用相同的字符串 key 写入的值不影响类型化的 key
+	ctx = context.WithValue(ctx, ContextKeyHead, "other")
+	uid, ok := GetUid(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, int64(100), uid)
+
+	// 之后直接写入 ContextKeyHead 的 Head 优先
+	uid, ok = GetUid(context.WithValue(ctx, ContextKeyHead, &testHead{Uid: int64(200)}))
+	assert.True(t, ok)
+	assert.Equal(t, int64(200), uid)
+
+	_, ok = HeadFromContext(context.Background())
+	assert.False(t, ok)
+	_, ok = HeadFromContext(context.WithValue(context.Background(), ContextKeyHead, map[string]interface{}{"uid": int64(1)}))
+	assert.False(t, ok)
+
+	headConverters.mu.RLock()
+	converters := headConverters.converters
+	headConverters.mu.RUnlock()
+	t.Cleanup(func() {
+		headConverters.mu.Lock()
+		headConverters.converters = converters
+		headConverters.mu.Unlock()
+	})
+	RegisterHeadConverter(func(v interface{}) (ContextHeader, bool) {
+		m, ok := v.(map[string]interface{})
+		return mapHead(m), ok
+	})
+	uid, ok = GetUid(context.WithValue(context.Background(), ContextKeyHead, map[string]interface{}{"uid": int64(1)}))
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), uid)
+}
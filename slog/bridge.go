@@ -0,0 +1,172 @@
+// Copyright 2014 The sutil Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slog
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 其他 log 库的适配，使用 zap.Logger 的库通过 NewZapCore 输出，标准库 log/slog 见 slog/slog 的 NewHandler，
+// 都与 slog 输出到相同的文件与 sink，使用相同的级别
+
+// coreHolder atomic.Value 需要保存相同的类型
+type coreHolder struct {
+	core zapcore.Core
+}
+
+var (
+	// 默认的输出与所有 sink，Init 与 AddSink 后更新
+	currentCore atomic.Value
+)
+
+func loadCore() zapcore.Core {
+	return currentCore.Load().(coreHolder).core
+}
+
+// Enabled lv 的日志是否会输出到任一位置
+func Enabled(lv int) bool {
+	return loadCore().Enabled(zapLevel(lv))
+}
+
+// LogAt 按 pc 所在的调用位置输出，kv 为交替的字段名与值，供其他 log 库的适配使用，不做采样
+func LogAt(lv int, pc uintptr, msg string, kv ...interface{}) {
+	l := zapLevel(lv)
+	if m := loadModuleLevels(); m != nil && pc != 0 {
+		if !m.enabled(l, pcPackage(pc)) {
+			return
+		}
+	}
+
+	ent := zapcore.Entry{Level: l, Time: time.Now(), Message: msg}
+	if pc != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+		ent.Caller = zapcore.NewEntryCaller(pc, frame.File, frame.Line, true)
+	}
+	ce := loadCore().Check(ent, nil)
+	switch l {
+	case zap.FatalLevel:
+		ce = ce.Should(ent, zapcore.WriteThenFatal)
+	case zap.PanicLevel:
+		ce = ce.Should(ent, zapcore.WriteThenPanic)
+	}
+	if ce == nil {
+		return
+	}
+	count(lv, msg)
+	ce.Write(kvFields(kv)...)
+}
+
+func pcPackage(pc uintptr) string {
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		return funcPackage(fn.Name())
+	}
+	return ""
+}
+
+// kvFields 与 zap.SugaredLogger 相同，key 不是字符串时转换为字符串，奇数个时忽略最后一个
+func kvFields(kv []interface{}) []zapcore.Field {
+	fields := make([]zapcore.Field, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		fields = append(fields, zap.Any(key, kv[i+1]))
+	}
+	return fields
+}
+
+// count 与 Infof 等相同的计数
+func count(lv int, msg string) {
+	switch lv {
+	case LV_TRACE:
+		atomic.AddInt64(&cnTrace, 1)
+	case LV_DEBUG:
+		atomic.AddInt64(&cnDebug, 1)
+	case LV_WARN:
+		atomic.AddInt64(&cnWarn, 1)
+	case LV_ERROR:
+		atomic.AddInt64(&cnError, 1)
+		addLogs("ERROR " + msg)
+	case LV_FATAL:
+		atomic.AddInt64(&cnFatal, 1)
+		addLogs("FATAL " + msg)
+	case LV_PANIC:
+		atomic.AddInt64(&cnPanic, 1)
+		addLogs("PANIC " + msg)
+	default:
+		atomic.AddInt64(&cnInfo, 1)
+	}
+}
+
+func levelOf(l zapcore.Level) int {
+	switch l {
+	case zap.DebugLevel:
+		return LV_DEBUG
+	case zap.WarnLevel:
+		return LV_WARN
+	case zap.ErrorLevel:
+		return LV_ERROR
+	case zap.DPanicLevel, zap.PanicLevel:
+		return LV_PANIC
+	case zap.FatalLevel:
+		return LV_FATAL
+	}
+	return LV_INFO
+}
+
+// NewZapCore 输出到 slog 的 zapcore.Core，如 zap.New(slog.NewZapCore(), zap.AddCaller())，
+// Init 与 AddSink 之后自动使用新的输出，context 中的 traceID 与 uid 通过 slog/slog 的 ZapFields 添加
+func NewZapCore() zapcore.Core {
+	return &zapCore{}
+}
+
+type zapCore struct {
+	fields []zapcore.Field
+}
+
+func (m *zapCore) Enabled(l zapcore.Level) bool {
+	return loadCore().Enabled(l)
+}
+
+func (m *zapCore) With(fields []zapcore.Field) zapcore.Core {
+	return &zapCore{fields: append(append([]zapcore.Field{}, m.fields...), fields...)}
+}
+
+func (m *zapCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if m.Enabled(ent.Level) {
+		return ce.AddCore(ent, m)
+	}
+	return ce
+}
+
+// Write 按各输出自己的级别过滤，Fatal 与 Panic 由调用方的 zap.Logger 处理
+func (m *zapCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if mls := loadModuleLevels(); mls != nil && ent.Caller.Defined {
+		if !mls.enabled(ent.Level, pcPackage(ent.Caller.PC)) {
+			return nil
+		}
+	}
+	ce := loadCore().Check(ent, nil)
+	if ce == nil {
+		return nil
+	}
+	count(levelOf(ent.Level), ent.Message)
+	if len(m.fields) > 0 {
+		fields = append(append([]zapcore.Field{}, m.fields...), fields...)
+	}
+	ce.Write(fields...)
+	return nil
+}
+
+func (m *zapCore) Sync() error {
+	return loadCore().Sync()
+}
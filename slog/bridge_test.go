@@ -0,0 +1,63 @@
+package slog
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestZapCore(t *testing.T) {
+	var buf bytes.Buffer
+	setLogger(zapcore.AddSync(&buf), zap.InfoLevel, EncodingJSON)
+	defer Init("", "", "TRACE")
+
+	logger := zap.New(NewZapCore(), zap.AddCaller()).With(zap.String("lib", "x"))
+	logger.Debug("debug 1")
+	logger.Info("info 2", zap.Int("n", 2))
+
+	// Init 之后使用新的输出
+	var buf2 bytes.Buffer
+	setLogger(zapcore.AddSync(&buf2), zap.InfoLevel, EncodingJSON)
+	logger.Warn("warn 3")
+
+	if strings.Contains(buf.String(), "debug 1") || strings.Contains(buf.String(), "warn 3") {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("invalid json: %s, err: %v", buf.String(), err)
+	}
+	if m["msg"] != "info 2" || m["lib"] != "x" || m["n"] != float64(2) || !strings.Contains(m["caller"].(string), "bridge_test.go") {
+		t.Errorf("unexpected line: %v", m)
+	}
+	if !strings.Contains(buf2.String(), "warn 3") {
+		t.Errorf("unexpected output: %s", buf2.String())
+	}
+}
+
+func TestLogAt(t *testing.T) {
+	var buf bytes.Buffer
+	setLogger(zapcore.AddSync(&buf), zap.InfoLevel, EncodingJSON)
+	defer Init("", "", "TRACE")
+
+	pc, _, line, _ := runtime.Caller(0)
+	LogAt(LV_DEBUG, pc, "debug 1")
+	LogAt(LV_WARN, pc, "warn 2", "k", "v", 1, 2)
+	if !Enabled(LV_WARN) || Enabled(LV_DEBUG) {
+		t.Error("unexpected enabled")
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("invalid json: %s, err: %v", buf.String(), err)
+	}
+	if m["msg"] != "warn 2" || m["k"] != "v" || m["1"] != float64(2) || !strings.HasSuffix(m["caller"].(string), "bridge_test.go:"+strconv.Itoa(line)) {
+		t.Errorf("unexpected line: %v", m)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2014 The sutil Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slog
+
+import (
+	"runtime"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// CallerOptions 日志中记录的调用位置，json 格式与 sink 的 Entry.Caller 总是包含调用位置
+type CallerOptions struct {
+	// console 格式是否输出调用位置 pkg/file.go:line
+	Enable bool
+	// 是否在调用位置后输出函数名，如 pkg/file.go:line pkg.(*T).Method
+	Function bool
+	// 额外跳过的调用层数，业务通过自己封装的函数调用 slog 时设置，输出实际调用封装函数的位置
+	Skip int
+}
+
+// 当前的 CallerOptions
+var callerOptions atomic.Value
+
+func loadCallerOptions() CallerOptions {
+	opts, _ := callerOptions.Load().(CallerOptions)
+	return opts
+}
+
+// SetCaller 设置调用位置的输出，立即对默认的输出与已注册的 sink 生效
+func SetCaller(opts CallerOptions) {
+	if opts.Skip < 0 {
+		opts.Skip = 0
+	}
+
+	sinkMutex.Lock()
+	defer sinkMutex.Unlock()
+	callerOptions.Store(opts)
+	if mainCore != nil {
+		mainCore = zapcore.NewCore(
+			newEncoder(mainEncoding),
+			mainWriter,
+			levelEnabler{},
+		)
+	}
+	// 替换而不是修改 sinkCore，正在输出的日志仍使用原来的 encoder
+	for name, s := range sinks {
+		c := *s
+		c.enc = newEncoder(s.encoding)
+		sinks[name] = &c
+	}
+	buildLogger()
+}
+
+// callerEncoder json 格式保持输出完整路径，console 格式输出 pkg/file.go:line
+func callerEncoder(full, function bool) zapcore.CallerEncoder {
+	return func(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
+		s := caller.TrimmedPath()
+		if full {
+			s = caller.String()
+		}
+		if function && caller.Defined {
+			if fn := funcName(caller.PC); fn != "" {
+				s += " " + fn
+			}
+		}
+		enc.AppendString(s)
+	}
+}
+
+// funcName 去掉包路径中最后一个 / 之前的部分，如 mq.(*Reader).FetchMsg
+func funcName(pc uintptr) string {
+	f := runtime.FuncForPC(pc)
+	if f == nil {
+		return ""
+	}
+	name := f.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
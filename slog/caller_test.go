@@ -0,0 +1,49 @@
+package slog
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func logHelper(msg string) {
+	Infof("%s", msg)
+}
+
+func TestSetCaller(t *testing.T) {
+	var buf bytes.Buffer
+	setLogger(zapcore.AddSync(&buf), zap.InfoLevel, EncodingConsole)
+	defer func() {
+		SetCaller(CallerOptions{})
+		Init("", "", "TRACE")
+	}()
+
+	Infof("info 1")
+	if strings.Contains(buf.String(), "caller_test.go") {
+		t.Errorf("unexpected caller: %s", buf.String())
+	}
+
+	buf.Reset()
+	SetCaller(CallerOptions{Enable: true, Function: true})
+	_, _, line, _ := runtime.Caller(0)
+	Infof("info 2")
+	want := "slog/caller_test.go:" + strconv.Itoa(line+1) + " slog.TestSetCaller"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("want %s, got: %s", want, buf.String())
+	}
+
+	// 封装的函数跳过一层
+	buf.Reset()
+	SetCaller(CallerOptions{Enable: true, Skip: 1})
+	_, _, line, _ = runtime.Caller(0)
+	logHelper("info 3")
+	want = "slog/caller_test.go:" + strconv.Itoa(line+1) + "\t"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("want %s, got: %s", want, buf.String())
+	}
+}
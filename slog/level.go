@@ -0,0 +1,200 @@
+// Copyright 2014 The sutil Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slog
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 运行时修改 log 级别，SetLevel 修改整个服务的级别，SetModuleLevels 按调用方的包路径前缀单独设置，
+// 如 github.com/shawnfeng/sutil/mq 设置为 DEBUG 时只输出 mq 的调试日志；
+// 从配置中心读取并跟随修改见 slog/loglevel，重新 Init 时恢复为 Init 指定的级别，按包设置的级别不变
+
+var (
+	atomLevel = zap.NewAtomicLevel()
+	// *moduleLevels，没有按包设置时为 nil
+	modules atomic.Value
+)
+
+// 调用方所在的包为以下包时继续向上查找
+var slogPackages = []string{
+	"github.com/shawnfeng/sutil/slog",
+	"github.com/shawnfeng/sutil/slog/slog",
+}
+
+type moduleLevels struct {
+	// 按长度从长到短排列，优先匹配更具体的包
+	prefixes []string
+	levels   map[string]zapcore.Level
+	// 所有包中最低的级别
+	min zapcore.Level
+}
+
+// parseLevel 未知的级别返回 INFO 与 false
+func parseLevel(level string) (zapcore.Level, bool) {
+	switch strings.ToUpper(level) {
+	case "TRACE", "DEBUG":
+		return zap.DebugLevel, true
+	case "INFO":
+		return zap.InfoLevel, true
+	case "WARN":
+		return zap.WarnLevel, true
+	case "ERROR":
+		return zap.ErrorLevel, true
+	case "FATAL":
+		return zap.FatalLevel, true
+	case "PANIC":
+		return zap.PanicLevel, true
+	}
+	return zap.InfoLevel, false
+}
+
+func zapLevel(lv int) zapcore.Level {
+	switch lv {
+	case LV_TRACE, LV_DEBUG:
+		return zap.DebugLevel
+	case LV_WARN:
+		return zap.WarnLevel
+	case LV_ERROR:
+		return zap.ErrorLevel
+	case LV_FATAL:
+		return zap.FatalLevel
+	case LV_PANIC:
+		return zap.PanicLevel
+	}
+	return zap.InfoLevel
+}
+
+// SetLevel 修改整个服务的 log 级别，立即生效，level 为 TRACE、DEBUG、INFO、WARN、ERROR、FATAL 或 PANIC
+func SetLevel(level string) error {
+	l, ok := parseLevel(level)
+	if !ok {
+		return fmt.Errorf("unknown log level: %s", level)
+	}
+	atomLevel.SetLevel(l)
+	return nil
+}
+
+// GetLevel 当前整个服务的 log 级别，TRACE 返回 DEBUG
+func GetLevel() string {
+	return atomLevel.Level().CapitalString()
+}
+
+// SetModuleLevels 替换所有按包设置的级别，key 为包路径前缀，为空时清除，有未知的级别时不做修改
+func SetModuleLevels(levels map[string]string) error {
+	if len(levels) == 0 {
+		modules.Store((*moduleLevels)(nil))
+		return nil
+	}
+
+	m := &moduleLevels{
+		levels: make(map[string]zapcore.Level, len(levels)),
+		min:    zap.FatalLevel,
+	}
+	for module, level := range levels {
+		l, ok := parseLevel(level)
+		if !ok {
+			return fmt.Errorf("unknown log level: %s, module: %s", level, module)
+		}
+		module = strings.TrimSuffix(module, "/")
+		m.prefixes = append(m.prefixes, module)
+		m.levels[module] = l
+		if l < m.min {
+			m.min = l
+		}
+	}
+	sort.Slice(m.prefixes, func(i, j int) bool {
+		return len(m.prefixes[i]) > len(m.prefixes[j])
+	})
+	modules.Store(m)
+	return nil
+}
+
+func loadModuleLevels() *moduleLevels {
+	m, _ := modules.Load().(*moduleLevels)
+	return m
+}
+
+// level pkg 所在模块的级别，没有单独设置时返回 false
+func (m *moduleLevels) level(pkg string) (zapcore.Level, bool) {
+	for _, prefix := range m.prefixes {
+		if pkg == prefix || strings.HasPrefix(pkg, prefix+"/") {
+			return m.levels[prefix], true
+		}
+	}
+	return 0, false
+}
+
+// levelEnabler zap 按服务的级别与按包设置的最低级别过滤，按包的级别由 enabled 判断
+type levelEnabler struct{}
+
+func (levelEnabler) Enabled(l zapcore.Level) bool {
+	if atomLevel.Enabled(l) {
+		return true
+	}
+	m := loadModuleLevels()
+	return m != nil && l >= m.min
+}
+
+// enabled 输出日志前调用，没有按包设置时按服务与 sink 的级别判断，
+// 否则按调用方所在的包判断，只在按包设置时获取调用栈
+func enabled(l zapcore.Level) bool {
+	m := loadModuleLevels()
+	if m == nil {
+		return loadCore().Enabled(l)
+	}
+	return m.enabled(l, callerPackage())
+}
+
+// LevelEnabled 与 Enabled 不同，按包设置级别时按调用方所在的包判断，slog/slog 在采样与格式化之前调用
+func LevelEnabled(lv int) bool {
+	return enabled(zapLevel(lv))
+}
+
+func (m *moduleLevels) enabled(l zapcore.Level, pkg string) bool {
+	if ml, ok := m.level(pkg); ok {
+		return l >= ml
+	}
+	return atomLevel.Enabled(l)
+}
+
+// callerPackage 调用 slog 与 slog/slog 的包路径
+func callerPackage() string {
+	var pcs [8]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		pkg := funcPackage(frame.Function)
+		if !isSlogPackage(pkg) || !more {
+			return pkg
+		}
+	}
+}
+
+// funcPackage 如 github.com/shawnfeng/sutil/mq.(*KafkaReader).FetchMsg 返回 github.com/shawnfeng/sutil/mq
+func funcPackage(function string) string {
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return function
+}
+
+func isSlogPackage(pkg string) bool {
+	for _, p := range slogPackages {
+		if pkg == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package slog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestFuncPackage(t *testing.T) {
+	cases := map[string]string{
+		"github.com/shawnfeng/sutil/mq.(*KafkaReader).FetchMsg": "github.com/shawnfeng/sutil/mq",
+		"github.com/shawnfeng/sutil/slog/slog.Infof":            "github.com/shawnfeng/sutil/slog/slog",
+		"main.main":       "main",
+		"testing.tRunner": "testing",
+	}
+	for function, want := range cases {
+		if got := funcPackage(function); got != want {
+			t.Errorf("function: %s, want: %s, got: %s", function, want, got)
+		}
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	var buf bytes.Buffer
+	setLogger(zapcore.AddSync(&buf), zap.InfoLevel, EncodingConsole)
+	defer Init("", "", "TRACE")
+	defer SetModuleLevels(nil)
+
+	Debugf("debug 1")
+	if err := SetLevel("DEBUG"); err != nil {
+		t.Fatal(err)
+	}
+	Debugf("debug 2")
+	if GetLevel() != "DEBUG" {
+		t.Errorf("unexpected level: %s", GetLevel())
+	}
+	if err := SetLevel("VERBOSE"); err == nil {
+		t.Error("expect unknown level err")
+	}
+	if strings.Contains(buf.String(), "debug 1") || !strings.Contains(buf.String(), "debug 2") {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	// 测试函数在 slog 包中，调用方为 testing
+	if err := SetModuleLevels(map[string]string{"testing": "ERROR", "github.com/shawnfeng/sutil/mq/": "DEBUG"}); err != nil {
+		t.Fatal(err)
+	}
+	m := loadModuleLevels()
+	if l, ok := m.level("github.com/shawnfeng/sutil/mq/outbox"); !ok || l != zap.DebugLevel {
+		t.Errorf("unexpected mq level: %v %v", l, ok)
+	}
+	if _, ok := m.level("github.com/shawnfeng/sutil/mqx"); ok {
+		t.Error("unexpected mqx level")
+	}
+	Infof("info 3")
+	Errorf("error 4")
+	if strings.Contains(buf.String(), "info 3") || !strings.Contains(buf.String(), "error 4") {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	if err := SetModuleLevels(map[string]string{"testing": "VERBOSE"}); err == nil {
+		t.Error("expect unknown level err")
+	}
+	SetModuleLevels(nil)
+	SetLevel("WARN")
+	Infof("info 5")
+	if strings.Contains(buf.String(), "info 5") || loadModuleLevels() != nil {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
+
+// countStringer 记录被格式化的次数
+type countStringer struct {
+	n int
+}
+
+func (m *countStringer) String() string {
+	m.n++
+	return "count"
+}
+
+func TestLevelEnabled(t *testing.T) {
+	var buf bytes.Buffer
+	setLogger(zapcore.AddSync(&buf), zap.InfoLevel, EncodingConsole)
+	defer Init("", "", "TRACE")
+
+	if LevelEnabled(LV_DEBUG) || !LevelEnabled(LV_INFO) {
+		t.Error("unexpected level enabled")
+	}
+
+	// 级别未开启时不格式化
+	s := &countStringer{}
+	Logf(LV_DEBUG, "debug %s", s)
+	Logln(LV_DEBUG, "debug", s)
+	if s.n != 0 || buf.Len() != 0 {
+		t.Errorf("unexpected format: %d %s", s.n, buf.String())
+	}
+	Logf(LV_INFO, "info %s", s)
+	if s.n != 1 || !strings.Contains(buf.String(), "info count") {
+		t.Errorf("unexpected output: %d %s", s.n, buf.String())
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2014 The sutil Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package loglevel 从配置中心读取服务的 log 级别，修改配置后立即生效，不需要重新部署，
+// apollo 在服务的 namespace 中配置：
+//
+//	log.level = DEBUG
+//	log.level.github.com/shawnfeng/sutil/mq = DEBUG
+//
+// etcd 的 path 保存 json 格式的 Config，如 {"level": "INFO", "modules": {"github.com/shawnfeng/sutil/mq": "DEBUG"}}；
+// 配置删除后恢复为 WatchApollo 或 WatchEtcd 开始时的级别，级别无效时保持不变
+package loglevel
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/coreos/etcd/client"
+	"github.com/shawnfeng/sutil/sconf/center"
+	"github.com/shawnfeng/sutil/setcd"
+	baselog "github.com/shawnfeng/sutil/slog"
+	"github.com/shawnfeng/sutil/slog/slog"
+)
+
+const (
+	// apollo 中整个服务的级别
+	KeyLevel = "log.level"
+	// apollo 中按包设置的级别的前缀
+	KeyModuleLevelPrefix = KeyLevel + "."
+)
+
+// Config level 为空时使用开始跟随配置前的级别，modules 的 key 为包路径前缀
+type Config struct {
+	Level   string            `json:"level"`
+	Modules map[string]string `json:"modules"`
+}
+
+var (
+	mu sync.Mutex
+	// 开始跟随配置前的级别
+	initLevel string
+)
+
+// apply 设置 conf 中的级别
+func apply(ctx context.Context, conf *Config) {
+	fun := "loglevel.apply -->"
+
+	mu.Lock()
+	defer mu.Unlock()
+	if initLevel == "" {
+		initLevel = baselog.GetLevel()
+	}
+
+	level := conf.Level
+	if level == "" {
+		level = initLevel
+	}
+	if err := baselog.SetLevel(level); err != nil {
+		slog.Errorf(ctx, "%s set level err: %v", fun, err)
+	}
+	if err := baselog.SetModuleLevels(conf.Modules); err != nil {
+		slog.Errorf(ctx, "%s set module levels err: %v", fun, err)
+	}
+	slog.Infof(ctx, "%s level: %s, modules: %v", fun, baselog.GetLevel(), conf.Modules)
+}
+
+type apolloObserver struct {
+	c         center.ConfigCenter
+	namespace string
+}
+
+func (m *apolloObserver) HandleChangeEvent(event *center.ChangeEvent) {
+	if event.Namespace != m.namespace {
+		return
+	}
+	for key := range event.Changes {
+		if key == KeyLevel || strings.HasPrefix(key, KeyModuleLevelPrefix) {
+			m.reload(context.Background())
+			return
+		}
+	}
+}
+
+// reload 每次都读取 namespace 中的所有级别，删除的配置随之清除
+func (m *apolloObserver) reload(ctx context.Context) {
+	conf := &Config{Modules: map[string]string{}}
+	for _, key := range m.c.GetAllKeysWithNamespace(ctx, m.namespace) {
+		if key != KeyLevel && !strings.HasPrefix(key, KeyModuleLevelPrefix) {
+			continue
+		}
+		value, ok := m.c.GetStringWithNamespace(ctx, m.namespace, key)
+		if !ok {
+			continue
+		}
+		if key == KeyLevel {
+			conf.Level = value
+		} else {
+			conf.Modules[strings.TrimPrefix(key, KeyModuleLevelPrefix)] = value
+		}
+	}
+	apply(ctx, conf)
+}
+
+// WatchApollo 读取已初始化并开始 StartWatchUpdate 的配置中心中 namespace 的级别，之后跟随修改
+func WatchApollo(ctx context.Context, c center.ConfigCenter, namespace string) {
+	observer := &apolloObserver{c: c, namespace: namespace}
+	observer.reload(ctx)
+	c.RegisterObserver(ctx, observer)
+}
+
+// WatchEtcd 读取 etcd 中 path 的级别，之后跟随修改
+func WatchEtcd(ctx context.Context, etcd *setcd.EtcdInstance, path string) {
+	fun := "loglevel.WatchEtcd -->"
+	etcd.Watch(ctx, path, func(r *client.Response) {
+		conf := &Config{}
+		if r.Node != nil && r.Node.Value != "" && r.Action != "delete" {
+			if err := json.Unmarshal([]byte(r.Node.Value), conf); err != nil {
+				slog.Errorf(ctx, "%s unmarshal err: %v, path: %s, value: %s", fun, err, path, r.Node.Value)
+				return
+			}
+		}
+		apply(ctx, conf)
+	})
+}
@@ -0,0 +1,68 @@
+package loglevel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shawnfeng/sutil/sconf/center"
+	baselog "github.com/shawnfeng/sutil/slog"
+)
+
+type testCenter struct {
+	center.ConfigCenter
+	values map[string]string
+}
+
+func (m *testCenter) GetAllKeysWithNamespace(ctx context.Context, namespace string) []string {
+	var keys []string
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (m *testCenter) GetStringWithNamespace(ctx context.Context, namespace, key string) (string, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+func TestApolloObserver(t *testing.T) {
+	defer baselog.Init("", "", "TRACE")
+	defer baselog.SetModuleLevels(nil)
+	baselog.SetLevel("INFO")
+
+	c := &testCenter{values: map[string]string{
+		KeyLevel: "WARN",
+		KeyModuleLevelPrefix + "github.com/shawnfeng/sutil/mq": "DEBUG",
+		"other": "ERROR",
+	}}
+	observer := &apolloObserver{c: c, namespace: "application"}
+	observer.reload(context.TODO())
+	if baselog.GetLevel() != "WARN" {
+		t.Errorf("unexpected level: %s", baselog.GetLevel())
+	}
+
+	// 其他 namespace 与无关的配置不触发重新读取
+	c.values[KeyLevel] = "ERROR"
+	observer.HandleChangeEvent(&center.ChangeEvent{Namespace: "other", Changes: map[string]*center.Change{KeyLevel: {}}})
+	observer.HandleChangeEvent(&center.ChangeEvent{Namespace: "application", Changes: map[string]*center.Change{"other": {}}})
+	if baselog.GetLevel() != "WARN" {
+		t.Errorf("unexpected level: %s", baselog.GetLevel())
+	}
+	observer.HandleChangeEvent(&center.ChangeEvent{Namespace: "application", Changes: map[string]*center.Change{KeyLevel: {}}})
+	if baselog.GetLevel() != "ERROR" {
+		t.Errorf("unexpected level: %s", baselog.GetLevel())
+	}
+
+	// 无效的级别保持不变，删除后恢复为开始时的级别
+	c.values[KeyLevel] = "VERBOSE"
+	observer.reload(context.TODO())
+	if baselog.GetLevel() != "ERROR" {
+		t.Errorf("unexpected level: %s", baselog.GetLevel())
+	}
+	delete(c.values, KeyLevel)
+	observer.reload(context.TODO())
+	if baselog.GetLevel() != "INFO" {
+		t.Errorf("unexpected level: %s", baselog.GetLevel())
+	}
+}
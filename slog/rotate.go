@@ -0,0 +1,100 @@
+// Copyright 2014 The sutil Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slog
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/shawnfeng/lumberjack.v2"
+)
+
+// 日志文件的切分周期，按本地时间的整点或 0 点切分，
+// 写入与切分都在 lumberjack 的锁内进行，切分时关闭旧文件并改名后再打开新文件，期间的日志等待写入新文件，不会丢失；
+// 使用内置的切分时不需要配置外部的 logrotate，需要按信号切分时调用 Rotate
+const (
+	RotateNone   = ""
+	RotateHourly = "hourly"
+	RotateDaily  = "daily"
+)
+
+// RotateOptions 日志文件超过 MaxSize MB 或到达 Period 时切分，MaxSize 为 0 时为 100 MB，
+// 保留最近 MaxBackups 个与 MaxAge 天内的旧文件，为 0 时不限制
+type RotateOptions struct {
+	MaxSize    int
+	MaxAge     int
+	MaxBackups int
+	Period     string
+}
+
+var (
+	rotateMutex sync.Mutex
+	// 当前输出的日志文件，输出到标准输出时为 nil
+	rotateFile *lumberjack.Logger
+	// 关闭当前的按周期切分
+	rotateStop chan struct{}
+)
+
+// setRotateFile 重新 Init 时停止之前文件的按周期切分，filename 为空时只停止
+func setRotateFile(filename string, opts RotateOptions) *lumberjack.Logger {
+	rotateMutex.Lock()
+	defer rotateMutex.Unlock()
+
+	if rotateStop != nil {
+		close(rotateStop)
+		rotateStop = nil
+	}
+	rotateFile = nil
+	if filename == "" {
+		return nil
+	}
+
+	rotateFile = lumberjack.NewLogger(filename, opts.MaxSize, opts.MaxAge, opts.MaxBackups, true, false)
+	if opts.Period != RotateNone {
+		rotateStop = make(chan struct{})
+		go rotateLoop(rotateFile, opts.Period, rotateStop)
+	}
+	return rotateFile
+}
+
+func rotateLoop(l *lumberjack.Logger, period string, stop chan struct{}) {
+	for {
+		timer := time.NewTimer(time.Until(nextRotateTime(time.Now(), period)))
+		select {
+		case <-timer.C:
+			if err := l.Rotate(); err != nil {
+				fmt.Fprintf(os.Stderr, "slog.rotateLoop --> rotate err: %v\n", err)
+			}
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// nextRotateTime now 之后下一个切分的时间，未知的周期按小时
+func nextRotateTime(now time.Time, period string) time.Time {
+	if period == RotateDaily {
+		y, m, d := now.Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+	}
+	y, m, d := now.Date()
+	return time.Date(y, m, d, now.Hour()+1, 0, 0, 0, now.Location())
+}
+
+// Rotate 立即切分当前的日志文件，输出到标准输出时不做处理，
+// 用于收到 SIGHUP 等信号时切分，代替外部 logrotate 移动文件
+func Rotate() error {
+	rotateMutex.Lock()
+	l := rotateFile
+	rotateMutex.Unlock()
+
+	if l == nil {
+		return nil
+	}
+	return l.Rotate()
+}
@@ -0,0 +1,57 @@
+package slog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextRotateTime(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	now := time.Date(2019, 12, 31, 23, 30, 15, 0, loc)
+
+	cases := []struct {
+		period string
+		want   time.Time
+	}{
+		{RotateHourly, time.Date(2020, 1, 1, 0, 0, 0, 0, loc)},
+		{RotateDaily, time.Date(2020, 1, 1, 0, 0, 0, 0, loc)},
+		{"unknown", time.Date(2020, 1, 1, 0, 0, 0, 0, loc)},
+	}
+	for _, c := range cases {
+		if got := nextRotateTime(now, c.period); !got.Equal(c.want) {
+			t.Errorf("period: %s, want: %s, got: %s", c.period, c.want, got)
+		}
+	}
+
+	now = time.Date(2020, 3, 1, 8, 0, 0, 0, loc)
+	if got := nextRotateTime(now, RotateHourly); !got.Equal(time.Date(2020, 3, 1, 9, 0, 0, 0, loc)) {
+		t.Errorf("unexpected hourly: %s", got)
+	}
+	if got := nextRotateTime(now, RotateDaily); !got.Equal(time.Date(2020, 3, 2, 0, 0, 0, 0, loc)) {
+		t.Errorf("unexpected daily: %s", got)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	defer Init("", "", "TRACE")
+
+	dir := t.TempDir()
+	InitV4(dir, "tt", "TRACE", EncodingConsole, RotateOptions{Period: RotateDaily})
+	if rotateFile == nil || rotateStop == nil {
+		t.Fatal("expect rotate file")
+	}
+	stop := rotateStop
+	if err := Rotate(); err != nil {
+		t.Errorf("rotate err: %v", err)
+	}
+
+	Init("", "", "TRACE")
+	select {
+	case <-stop:
+	default:
+		t.Error("expect previous rotate loop stopped")
+	}
+	if rotateFile != nil || Rotate() != nil {
+		t.Error("expect no rotate file")
+	}
+}
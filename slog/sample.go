@@ -0,0 +1,134 @@
+// Copyright 2014 The sutil Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slog
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 按级别采样，相同模板的日志每个周期内输出前 First 条，之后每 Thereafter 条输出 1 条，
+// 避免循环中相同的 Infof 打满磁盘；模板为 f 系列的 format，ln 系列的第一个字符串参数，
+// 丢弃的条数记录在 LogStat 的 SAMPLED 中；FATAL 与 PANIC 不采样，默认不采样
+const (
+	defaultSampleTick = time.Second
+	// 一个周期内最多记录的模板数，超过后新的模板不采样
+	maxSampleTemplates = 10000
+)
+
+var (
+	cnSampled int64
+
+	samplerMutex sync.Mutex
+	// [LV_ERROR + 1]*sampler，未设置的级别为 nil
+	samplers atomic.Value
+)
+
+// SamplingOptions First <= 0 时关闭该级别的采样，Thereafter <= 0 时只输出前 First 条，Tick <= 0 时为 1 秒
+type SamplingOptions struct {
+	First      int
+	Thereafter int
+	Tick       time.Duration
+}
+
+type sampler struct {
+	opts SamplingOptions
+
+	mu     sync.Mutex
+	reset  time.Time
+	counts map[string]int
+}
+
+func newSampler(opts SamplingOptions) *sampler {
+	if opts.Tick <= 0 {
+		opts.Tick = defaultSampleTick
+	}
+	return &sampler{opts: opts}
+}
+
+func (m *sampler) allow(template string, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.reset) >= m.opts.Tick {
+		m.reset = now
+		m.counts = make(map[string]int)
+	}
+	n, ok := m.counts[template]
+	if !ok && len(m.counts) >= maxSampleTemplates {
+		return true
+	}
+	n++
+	m.counts[template] = n
+	if n <= m.opts.First {
+		return true
+	}
+	return m.opts.Thereafter > 0 && (n-m.opts.First)%m.opts.Thereafter == 0
+}
+
+// SetSampling 设置 level 的采样，level 为 TRACE、DEBUG、INFO、WARN 或 ERROR
+func SetSampling(level string, opts SamplingOptions) error {
+	lv, ok := samplingLevel(level)
+	if !ok {
+		return fmt.Errorf("unsupported sampling level: %s", level)
+	}
+
+	samplerMutex.Lock()
+	defer samplerMutex.Unlock()
+	var ss [LV_ERROR + 1]*sampler
+	if old, ok := samplers.Load().([LV_ERROR + 1]*sampler); ok {
+		ss = old
+	}
+	ss[lv] = nil
+	if opts.First > 0 {
+		ss[lv] = newSampler(opts)
+	}
+	samplers.Store(ss)
+	return nil
+}
+
+func samplingLevel(level string) (int, bool) {
+	switch level {
+	case "TRACE":
+		return LV_TRACE, true
+	case "DEBUG":
+		return LV_DEBUG, true
+	case "INFO":
+		return LV_INFO, true
+	case "WARN":
+		return LV_WARN, true
+	case "ERROR":
+		return LV_ERROR, true
+	}
+	return 0, false
+}
+
+// Sample 按 lv 的采样判断 template 的日志是否输出，丢弃时计数，slog/slog 在添加 context 信息前调用
+func Sample(lv int, template string) bool {
+	if lv < LV_TRACE || lv > LV_ERROR || template == "" {
+		return true
+	}
+	ss, ok := samplers.Load().([LV_ERROR + 1]*sampler)
+	if !ok || ss[lv] == nil {
+		return true
+	}
+	if ss[lv].allow(template, time.Now()) {
+		return true
+	}
+	atomic.AddInt64(&cnSampled, 1)
+	return false
+}
+
+// LnTemplate ln 系列按第一个字符串参数采样，slog/slog 也使用
+func LnTemplate(v []interface{}) string {
+	if len(v) > 0 {
+		if s, ok := v[0].(string); ok {
+			return s
+		}
+	}
+	return ""
+}
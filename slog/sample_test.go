@@ -0,0 +1,69 @@
+package slog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSampler(t *testing.T) {
+	m := newSampler(SamplingOptions{First: 2, Thereafter: 3})
+	now := time.Now()
+	var got []bool
+	for i := 0; i < 8; i++ {
+		got = append(got, m.allow("a", now))
+	}
+	want := []bool{true, true, false, false, true, false, false, true}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("unexpected allow: %v", got)
+		}
+	}
+	if !m.allow("b", now) {
+		t.Error("expect other template allowed")
+	}
+	if !m.allow("a", now.Add(time.Second)) {
+		t.Error("expect allowed after tick")
+	}
+
+	m = newSampler(SamplingOptions{First: 1})
+	if !m.allow("a", now) || m.allow("a", now) || m.allow("a", now) {
+		t.Error("expect only first allowed")
+	}
+}
+
+func TestSetSampling(t *testing.T) {
+	var buf bytes.Buffer
+	setLogger(zapcore.AddSync(&buf), zap.InfoLevel, EncodingConsole)
+	defer Init("", "", "TRACE")
+	defer SetSampling("INFO", SamplingOptions{})
+
+	if err := SetSampling("FATAL", SamplingOptions{First: 1}); err == nil {
+		t.Error("expect unsupported level err")
+	}
+	if err := SetSampling("INFO", SamplingOptions{First: 1, Tick: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	LogStat()
+	for i := 0; i < 3; i++ {
+		Infof("hot loop %d", i)
+		Warnf("warn %d", i)
+	}
+	if strings.Count(buf.String(), "hot loop") != 1 || strings.Count(buf.String(), "warn") != 3 {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+	st, _ := LogStat()
+	if st["SAMPLED"] != 2 || st["INFO"] != 1 {
+		t.Errorf("unexpected stat: %v", st)
+	}
+
+	SetSampling("INFO", SamplingOptions{})
+	Infof("hot loop %d", 3)
+	if strings.Count(buf.String(), "hot loop") != 2 {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
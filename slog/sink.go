@@ -0,0 +1,270 @@
+// Copyright 2014 The sutil Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slog
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shawnfeng/lumberjack.v2"
+	"go.uber.org/zap/zapcore"
+)
+
+// 除 Init 指定的文件或标准输出外，通过 AddSink 把日志同时输出到 kafka、syslog 等，
+// 每个 sink 有自己的级别与格式，不受 SetLevel 影响，SetModuleLevels 按包设置的级别同样生效，重新 Init 时保留；
+// 如 Init 输出所有级别到本地文件，同时 warn 以上输出到标准错误、error 以上输出到远程：
+//
+//	slog.AddSink("stderr", slog.NewWriterSink(os.Stderr), slog.SinkOptions{Level: "WARN"})
+//	slog.AddSink("remote", remoteSink, slog.SinkOptions{Level: "ERROR", Encoding: slog.EncodingJSON})
+//
+// 运行时通过 SetSinkLevel 修改级别，AddSink 与 RemoveSink 增删输出
+
+// Entry 交给 Sink 的一条日志
+type Entry struct {
+	Level   string // 如 INFO
+	Time    time.Time
+	Caller  string
+	Message string
+	// slog/slog 按 json 格式输出时的 traceID、uid 与 fields 等
+	Fields map[string]interface{}
+	// 按 SinkOptions.Encoding 编码后的一行日志，包含换行，Write 返回后不能再使用
+	Encoded []byte
+}
+
+// Sink 由多个 goroutine 同时调用 Write，需要自己保证并发安全，
+// Write 返回的错误只输出到标准错误，不影响其他 sink
+type Sink interface {
+	Write(entry *Entry) error
+	Flush() error
+	Close() error
+}
+
+// SinkOptions Level 为空时为 TRACE，Encoding 为空时为 EncodingConsole
+type SinkOptions struct {
+	Level    string
+	Encoding string
+}
+
+var (
+	sinkMutex sync.Mutex
+	// 默认的输出
+	mainCore zapcore.Core
+	// mainCore 的输出与格式，SetCaller 时重新生成 encoder
+	mainWriter   zapcore.WriteSyncer
+	mainEncoding string
+	// name -> *sinkCore
+	sinks = map[string]*sinkCore{}
+)
+
+// AddSink 注册名称为 name 的 sink，同名的 sink 存在时返回错误
+func AddSink(name string, sink Sink, opts SinkOptions) error {
+	level, err := parseSinkLevel(name, opts.Level)
+	if err != nil {
+		return err
+	}
+
+	sinkMutex.Lock()
+	defer sinkMutex.Unlock()
+	if _, ok := sinks[name]; ok {
+		return fmt.Errorf("sink already exists: %s", name)
+	}
+	sinks[name] = &sinkCore{
+		LevelEnabler: level,
+		encoding:     opts.Encoding,
+		enc:          newEncoder(opts.Encoding),
+		sink:         sink,
+	}
+	buildLogger()
+	return nil
+}
+
+// SetSinkLevel 修改已注册的 sink 的级别，立即生效，level 为空时为 TRACE，sink 不存在时返回错误
+func SetSinkLevel(name, level string) error {
+	l, err := parseSinkLevel(name, level)
+	if err != nil {
+		return err
+	}
+
+	sinkMutex.Lock()
+	defer sinkMutex.Unlock()
+	s, ok := sinks[name]
+	if !ok {
+		return fmt.Errorf("sink not found: %s", name)
+	}
+	// 替换而不是修改 sinkCore，与 SetCaller 相同
+	c := *s
+	c.LevelEnabler = l
+	sinks[name] = &c
+	buildLogger()
+	return nil
+}
+
+func parseSinkLevel(name, level string) (zapcore.Level, error) {
+	if level == "" {
+		return zapcore.DebugLevel, nil
+	}
+	l, ok := parseLevel(level)
+	if !ok {
+		return l, fmt.Errorf("unknown log level: %s, sink: %s", level, name)
+	}
+	return l, nil
+}
+
+// RemoveSink 不再输出到 name 并关闭 sink，不存在时不做处理
+func RemoveSink(name string) error {
+	sinkMutex.Lock()
+	s, ok := sinks[name]
+	if ok {
+		delete(sinks, name)
+		buildLogger()
+	}
+	sinkMutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+	s.sink.Flush()
+	return s.sink.Close()
+}
+
+// CloseSinks 关闭所有 sink，进程退出前调用，返回第一个错误
+func CloseSinks() error {
+	sinkMutex.Lock()
+	names := make([]string, 0, len(sinks))
+	for name := range sinks {
+		names = append(names, name)
+	}
+	sinkMutex.Unlock()
+
+	sort.Strings(names)
+	var first error
+	for _, name := range names {
+		if err := RemoveSink(name); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// sinkCore 把 zap 的日志交给 Sink
+type sinkCore struct {
+	zapcore.LevelEnabler
+	encoding string
+	enc      zapcore.Encoder
+	fields   []zapcore.Field
+	sink     Sink
+}
+
+func (m *sinkCore) With(fields []zapcore.Field) zapcore.Core {
+	c := *m
+	c.fields = append(append([]zapcore.Field{}, m.fields...), fields...)
+	return &c
+}
+
+func (m *sinkCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if m.Enabled(ent.Level) {
+		return ce.AddCore(ent, m)
+	}
+	return ce
+}
+
+func (m *sinkCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if len(m.fields) > 0 {
+		fields = append(append([]zapcore.Field{}, m.fields...), fields...)
+	}
+	buf, err := m.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	entry := &Entry{
+		Level:   ent.Level.CapitalString(),
+		Time:    ent.Time,
+		Message: ent.Message,
+		Encoded: buf.Bytes(),
+	}
+	if ent.Caller.Defined {
+		entry.Caller = ent.Caller.String()
+	}
+	if len(fields) > 0 {
+		menc := zapcore.NewMapObjectEncoder()
+		for _, f := range fields {
+			f.AddTo(menc)
+		}
+		entry.Fields = menc.Fields
+	}
+	return m.sink.Write(entry)
+}
+
+func (m *sinkCore) Sync() error {
+	return m.sink.Flush()
+}
+
+// writerSink 输出到 io.Writer
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink 把编码后的日志写入 w，用于标准输出、文件、syslog.Writer 等，Close 不会关闭 w
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+func (m *writerSink) Write(entry *Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.w.Write(entry.Encoded)
+	return err
+}
+
+func (m *writerSink) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+func (m *writerSink) Close() error {
+	return nil
+}
+
+// fileSink 输出到单独切分的文件
+type fileSink struct {
+	writerSink
+	file     *lumberjack.Logger
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewFileSink 把编码后的日志写入 filename，按 opts 切分与清理，与 Init 的文件相互独立，Close 时关闭文件
+func NewFileSink(filename string, opts RotateOptions) Sink {
+	file := lumberjack.NewLogger(filename, opts.MaxSize, opts.MaxAge, opts.MaxBackups, true, false)
+	m := &fileSink{
+		writerSink: writerSink{w: file},
+		file:       file,
+		stop:       make(chan struct{}),
+	}
+	if opts.Period != RotateNone {
+		go rotateLoop(file, opts.Period, m.stop)
+	}
+	return m
+}
+
+func (m *fileSink) Close() error {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+	// 与 Write、Flush 互斥，RemoveSink 时可能仍有日志在写
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.file.Close()
+}
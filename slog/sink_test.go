@@ -0,0 +1,233 @@
+package slog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type testSink struct {
+	mu      sync.Mutex
+	entries []Entry
+	encoded []string
+	closed  bool
+}
+
+func (m *testSink) Write(entry *Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, *entry)
+	m.encoded = append(m.encoded, string(entry.Encoded))
+	return nil
+}
+
+func (m *testSink) Flush() error {
+	return nil
+}
+
+func (m *testSink) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestSink(t *testing.T) {
+	var buf, wbuf bytes.Buffer
+	setLogger(zapcore.AddSync(&buf), zap.InfoLevel, EncodingConsole)
+	defer Init("", "", "TRACE")
+
+	sink := &testSink{}
+	if err := AddSink("test", sink, SinkOptions{Level: "WARN", Encoding: EncodingJSON}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddSink("test", sink, SinkOptions{}); err == nil {
+		t.Error("expect duplicate sink err")
+	}
+	if err := AddSink("bad", sink, SinkOptions{Level: "VERBOSE"}); err == nil {
+		t.Error("expect unknown level err")
+	}
+	if err := AddSink("writer", NewWriterSink(&wbuf), SinkOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	Debugf("debug 1")
+	Infof("info 2")
+	Logw(LV_ERROR, "error 3", "uid", int64(1234))
+
+	// 默认的输出不受 sink 影响，console 格式不输出 caller
+	if strings.Contains(buf.String(), "debug 1") || !strings.Contains(buf.String(), "info 2") || strings.Contains(buf.String(), "sink_test.go") {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+	if !strings.Contains(wbuf.String(), "debug 1") || !strings.Contains(wbuf.String(), "error 3") {
+		t.Errorf("unexpected writer output: %s", wbuf.String())
+	}
+
+	if len(sink.entries) != 1 {
+		t.Fatalf("expect 1 entry, got: %d", len(sink.entries))
+	}
+	entry := sink.entries[0]
+	if entry.Level != "ERROR" || entry.Message != "error 3" || entry.Fields["uid"] != int64(1234) {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(sink.encoded[0]), &m); err != nil || m["msg"] != "error 3" {
+		t.Errorf("unexpected encoded: %s, err: %v", sink.encoded[0], err)
+	}
+
+	// 重新 Init 时保留
+	setLogger(zapcore.AddSync(&buf), zap.InfoLevel, EncodingConsole)
+	Errorf("error 4")
+	if len(sink.entries) != 2 || !strings.Contains(sink.entries[1].Caller, "sink_test.go") {
+		t.Errorf("unexpected entries: %+v", sink.entries)
+	}
+
+	if err := CloseSinks(); err != nil {
+		t.Fatal(err)
+	}
+	Errorf("error 5")
+	if len(sink.entries) != 2 || !sink.closed || RemoveSink("test") != nil {
+		t.Errorf("unexpected entries after close: %+v", sink.entries)
+	}
+}
+
+func TestSinkConcurrent(t *testing.T) {
+	setLogger(zapcore.Lock(zapcore.AddSync(ioutil.Discard)), zap.InfoLevel, EncodingConsole)
+	defer Init("", "", "TRACE")
+	defer CloseSinks()
+
+	stop := make(chan struct{})
+	var wg, started sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		started.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					Infof("info %d", 1)
+					Logw(LV_WARN, "warn 2")
+				}
+			}
+		}()
+	}
+
+	started.Wait()
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("sink%d", i%3)
+		if err := AddSink(name, &testSink{}, SinkOptions{}); err != nil {
+			RemoveSink(name)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestSetSinkLevel(t *testing.T) {
+	var buf bytes.Buffer
+	setLogger(zapcore.AddSync(&buf), zap.DebugLevel, EncodingConsole)
+	defer Init("", "", "TRACE")
+
+	warn, errs := &testSink{}, &testSink{}
+	if err := AddSink("warn", warn, SinkOptions{Level: "WARN"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddSink("error", errs, SinkOptions{Level: "ERROR"}); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseSinks()
+
+	Infof("info 1")
+	Warnf("warn 2")
+	Errorf("error 3")
+	if len(warn.entries) != 2 || len(errs.entries) != 1 || strings.Count(buf.String(), "\n") != 3 {
+		t.Errorf("unexpected entries: %+v, %+v, output: %s", warn.entries, errs.entries, buf.String())
+	}
+
+	if err := SetSinkLevel("error", "INFO"); err != nil {
+		t.Fatal(err)
+	}
+	Infof("info 4")
+	if len(errs.entries) != 2 || errs.entries[1].Message != "info 4" {
+		t.Errorf("unexpected entries: %+v", errs.entries)
+	}
+
+	if SetSinkLevel("none", "INFO") == nil || SetSinkLevel("error", "x") == nil {
+		t.Error("expect err")
+	}
+}
+
+func TestSetSinkLevelConcurrent(t *testing.T) {
+	setLogger(zapcore.Lock(zapcore.AddSync(ioutil.Discard)), zap.InfoLevel, EncodingConsole)
+	defer Init("", "", "TRACE")
+
+	sink := &testSink{}
+	if err := AddSink("level", sink, SinkOptions{Level: "ERROR"}); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "slog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := AddSink("file", NewFileSink(filepath.Join(dir, "sink.log"), RotateOptions{MaxSize: 1}), SinkOptions{Level: "ERROR"}); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseSinks()
+
+	stop := make(chan struct{})
+	var wg, started sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		started.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					Infof("info %d", 1)
+					Logw(LV_ERROR, "error 2")
+				}
+			}
+		}()
+	}
+
+	started.Wait()
+	levels := []string{"INFO", "WARN", "ERROR"}
+	for i := 0; i < 1000; i++ {
+		if err := SetSinkLevel("level", levels[i%len(levels)]); err != nil {
+			t.Fatal(err)
+		}
+		if err := SetSinkLevel("file", levels[(i+1)%len(levels)]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	// 并发修改后最后一次设置立即生效
+	if err := SetSinkLevel("level", "INFO"); err != nil {
+		t.Fatal(err)
+	}
+	sink.mu.Lock()
+	n := len(sink.entries)
+	sink.mu.Unlock()
+	Infof("info 3")
+	if len(sink.entries) != n+1 {
+		t.Errorf("expect %d entries, got: %d", n+1, len(sink.entries))
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	//"github.com/shawnfeng/sutil/stime"
-	"github.com/shawnfeng/lumberjack.v2"
 	"io"
 	"os"
 	"sync"
@@ -28,6 +27,13 @@ const (
 	LV_PANIC int = 6
 )
 
+// log 输出格式，json 格式每行一个对象，包含 level、ts、caller、msg 以及 slog/slog 从 context 中取出的 traceID、uid 与 fields，
+// 用于 ELK、Loki 等直接按字段采集
+const (
+	EncodingConsole = "console"
+	EncodingJSON    = "json"
+)
+
 var (
 	// log count
 	cnTrace int64
@@ -41,11 +47,24 @@ var (
 	cnStamp int64
 
 	slogMutex sync.Mutex
-	lg        *zap.SugaredLogger
+	// 保存 loggerHolder，Init、AddSink 与 SetSinkLevel 时整体替换，输出日志时不加锁读取
+	currentLoggers atomic.Value
+	// 1 表示 json 格式
+	jsonEncoding int32
 
 	logs []string
 )
 
+// loggerHolder lg 供 Infof 等使用，ctxLg 供 logw 使用，caller 为调用 slog/slog 的位置
+type loggerHolder struct {
+	lg    *zap.SugaredLogger
+	ctxLg *zap.SugaredLogger
+}
+
+func loadLoggers() loggerHolder {
+	return currentLoggers.Load().(loggerHolder)
+}
+
 func addLogs(log string) {
 	slogMutex.Lock()
 	defer slogMutex.Unlock()
@@ -75,7 +94,7 @@ func CapitalLevelEncoder(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
 }
 
 func Sync() {
-	lg.Sync()
+	loadLoggers().lg.Sync()
 }
 
 func Init(logdir string, logpref string, level string) {
@@ -83,24 +102,22 @@ func Init(logdir string, logpref string, level string) {
 }
 
 func InitV2(logDir, logPref string, level string, maxSize int, maxAge, maxBackups int) {
-	logLevel := zap.InfoLevel
-	if level == "TRACE" {
-		logLevel = zap.DebugLevel
-	} else if level == "DEBUG" {
-		logLevel = zap.DebugLevel
-	} else if level == "INFO" {
-		logLevel = zap.InfoLevel
-	} else if level == "WARN" {
-		logLevel = zap.WarnLevel
-	} else if level == "ERROR" {
-		logLevel = zap.ErrorLevel
-	} else if level == "FATAL" {
-		logLevel = zap.FatalLevel
-	} else if level == "PANIC" {
-		logLevel = zap.PanicLevel
-	} else {
-		logLevel = zap.InfoLevel
-	}
+	InitV3(logDir, logPref, level, maxSize, maxAge, maxBackups, EncodingConsole)
+}
+
+// InitV3 encoding 为 EncodingConsole 或 EncodingJSON，其他值按 EncodingConsole 处理
+func InitV3(logDir, logPref string, level string, maxSize int, maxAge, maxBackups int, encoding string) {
+	InitV4(logDir, logPref, level, encoding, RotateOptions{
+		MaxSize:    maxSize,
+		MaxAge:     maxAge,
+		MaxBackups: maxBackups,
+		Period:     RotateHourly,
+	})
+}
+
+// InitV4 日志文件按 rotate 切分与清理，见 rotate.go
+func InitV4(logDir, logPref string, level string, encoding string, rotate RotateOptions) {
+	logLevel, _ := parseLevel(level)
 
 	logfile := ""
 	if logDir != "" && logPref != "" {
@@ -109,39 +126,75 @@ func InitV2(logDir, logPref string, level string, maxSize int, maxAge, maxBackup
 
 	var out io.Writer
 	if len(logfile) > 0 {
-		var ljlogger *lumberjack.Logger
-		ljlogger = lumberjack.NewLogger(logfile, maxSize, maxAge, maxBackups, true, false)
-
-		go func() {
-			for {
-				now := time.Now().Unix()
-				duration := 3600 - now%3600
-				select {
-				case <-time.After(time.Second * time.Duration(duration)):
-					ljlogger.Rotate()
-				}
-			}
-		}()
-
-		out = ljlogger
+		out = setRotateFile(logfile, rotate)
 	} else {
+		setRotateFile("", rotate)
 		out = os.Stdout
 	}
-	w := zapcore.AddSync(out)
+	setLogger(zapcore.AddSync(out), logLevel, encoding)
+}
 
+func setLogger(w zapcore.WriteSyncer, logLevel zapcore.Level, encoding string) {
+	if encoding == EncodingJSON {
+		atomic.StoreInt32(&jsonEncoding, 1)
+	} else {
+		atomic.StoreInt32(&jsonEncoding, 0)
+	}
+	atomLevel.SetLevel(logLevel)
+
+	sinkMutex.Lock()
+	defer sinkMutex.Unlock()
+	mainWriter, mainEncoding = w, encoding
+	mainCore = zapcore.NewCore(
+		newEncoder(encoding),
+		w,
+		levelEnabler{},
+	)
+	buildLogger()
+}
+
+// newEncoder console 格式只在 SetCaller 开启时输出 caller，否则与没有 caller 时的格式相同
+func newEncoder(encoding string) zapcore.Encoder {
+	opts := loadCallerOptions()
 	enconf := zap.NewProductionEncoderConfig()
 	enconf.EncodeTime = TimeEncoder
 	enconf.CallerKey = "caller"
-	enconf.EncodeCaller = zapcore.FullCallerEncoder
+	enconf.EncodeCaller = callerEncoder(encoding == EncodingJSON, opts.Function)
 	enconf.EncodeLevel = CapitalLevelEncoder
-	core := zapcore.NewCore(
-		//zapcore.NewJSONEncoder(enconf),
-		zapcore.NewConsoleEncoder(enconf),
-		w,
-		logLevel,
-	)
-	logger := zap.New(core)
-	lg = logger.Sugar()
+	if encoding == EncodingJSON {
+		enconf.EncodeTime = zapcore.ISO8601TimeEncoder
+		return zapcore.NewJSONEncoder(enconf)
+	}
+	if !opts.Enable {
+		enconf.CallerKey = ""
+	}
+	return zapcore.NewConsoleEncoder(enconf)
+}
+
+// buildLogger 按默认的输出与注册的 sink 重新生成 logger，需要持有 sinkMutex
+func buildLogger() {
+	cores := []zapcore.Core{mainCore}
+	for _, s := range sinks {
+		cores = append(cores, s)
+	}
+	var opts []zap.Option
+	// 只在需要时获取 caller
+	copts := loadCallerOptions()
+	if copts.Enable || IsJSON() || len(sinks) > 0 {
+		opts = append(opts, zap.AddCaller())
+	}
+	core := zapcore.NewTee(cores...)
+	currentCore.Store(coreHolder{core})
+	logger := zap.New(core, opts...)
+	currentLoggers.Store(loggerHolder{
+		lg:    logger.WithOptions(zap.AddCallerSkip(1 + copts.Skip)).Sugar(),
+		ctxLg: logger.WithOptions(zap.AddCallerSkip(3 + copts.Skip)).Sugar(),
+	})
+}
+
+// IsJSON 是否按 EncodingJSON 输出
+func IsJSON() bool {
+	return atomic.LoadInt32(&jsonEncoding) == 1
 }
 
 func init() {
@@ -151,81 +204,166 @@ func init() {
 }
 
 func Tracef(format string, v ...interface{}) {
-	lg.Debugf(format, v...)
+	if !enabled(zap.DebugLevel) || !Sample(LV_TRACE, format) {
+		return
+	}
+	loadLoggers().lg.Debugf(format, v...)
 	atomic.AddInt64(&cnTrace, 1)
 }
 
 func Traceln(v ...interface{}) {
-	lg.Debug(v...)
+	if !enabled(zap.DebugLevel) || !Sample(LV_TRACE, LnTemplate(v)) {
+		return
+	}
+	loadLoggers().lg.Debug(v...)
 	atomic.AddInt64(&cnTrace, 1)
 }
 
 func Debugf(format string, v ...interface{}) {
-	lg.Debugf(format, v...)
+	if !enabled(zap.DebugLevel) || !Sample(LV_DEBUG, format) {
+		return
+	}
+	loadLoggers().lg.Debugf(format, v...)
 	atomic.AddInt64(&cnDebug, 1)
 }
 
 func Debugln(v ...interface{}) {
-	lg.Debug(v...)
+	if !enabled(zap.DebugLevel) || !Sample(LV_DEBUG, LnTemplate(v)) {
+		return
+	}
+	loadLoggers().lg.Debug(v...)
 	atomic.AddInt64(&cnDebug, 1)
 }
 
 func Infof(format string, v ...interface{}) {
-	lg.Infof(format, v...)
+	if !enabled(zap.InfoLevel) || !Sample(LV_INFO, format) {
+		return
+	}
+	loadLoggers().lg.Infof(format, v...)
 	atomic.AddInt64(&cnInfo, 1)
 }
 
 func Infoln(v ...interface{}) {
-	lg.Info(v...)
+	if !enabled(zap.InfoLevel) || !Sample(LV_INFO, LnTemplate(v)) {
+		return
+	}
+	loadLoggers().lg.Info(v...)
 	atomic.AddInt64(&cnInfo, 1)
 }
 
 func Warnf(format string, v ...interface{}) {
-	lg.Warnf(format, v...)
+	if !enabled(zap.WarnLevel) || !Sample(LV_WARN, format) {
+		return
+	}
+	loadLoggers().lg.Warnf(format, v...)
 	atomic.AddInt64(&cnWarn, 1)
 }
 
 func Warnln(v ...interface{}) {
-	lg.Warn(v...)
+	if !enabled(zap.WarnLevel) || !Sample(LV_WARN, LnTemplate(v)) {
+		return
+	}
+	loadLoggers().lg.Warn(v...)
 	atomic.AddInt64(&cnWarn, 1)
 }
 
 func Errorf(format string, v ...interface{}) {
-	lg.Errorf(format, v...)
+	if !enabled(zap.ErrorLevel) || !Sample(LV_ERROR, format) {
+		return
+	}
+	loadLoggers().lg.Errorw(fmt.Sprintf(format, v...), StackFields(LV_ERROR, v)...)
 	atomic.AddInt64(&cnError, 1)
 	addLogs("ERROR " + fmt.Sprintf(format, v...))
 }
 
 func Errorln(v ...interface{}) {
-	lg.Error(v...)
+	if !enabled(zap.ErrorLevel) || !Sample(LV_ERROR, LnTemplate(v)) {
+		return
+	}
+	loadLoggers().lg.Errorw(fmt.Sprint(v...), StackFields(LV_ERROR, v)...)
 	atomic.AddInt64(&cnError, 1)
 	addLogs("ERROR " + fmt.Sprintln(v...))
 }
 
 func Fatalf(format string, v ...interface{}) {
-	lg.Fatalf(format, v...)
+	if !enabled(zap.FatalLevel) {
+		return
+	}
+	loadLoggers().lg.Fatalw(fmt.Sprintf(format, v...), StackFields(LV_FATAL, v)...)
 	atomic.AddInt64(&cnFatal, 1)
 	addLogs("FATAL " + fmt.Sprintf(format, v...))
 }
 
 func Fatalln(v ...interface{}) {
-	lg.Fatal(v...)
+	if !enabled(zap.FatalLevel) {
+		return
+	}
+	loadLoggers().lg.Fatalw(fmt.Sprint(v...), StackFields(LV_FATAL, v)...)
 	atomic.AddInt64(&cnFatal, 1)
 	addLogs("FATAL " + fmt.Sprintln(v...))
 }
 
 func Panicf(format string, v ...interface{}) {
-	lg.Panicf(format, v...)
+	if !enabled(zap.PanicLevel) {
+		return
+	}
+	loadLoggers().lg.Panicf(format, v...)
 	atomic.AddInt64(&cnPanic, 1)
 	addLogs("PANIC " + fmt.Sprintf(format, v...))
 }
 
 func Panicln(v ...interface{}) {
-	lg.Panic(v...)
+	if !enabled(zap.PanicLevel) {
+		return
+	}
+	loadLoggers().lg.Panic(v...)
 	atomic.AddInt64(&cnPanic, 1)
 	addLogs("PANIC " + fmt.Sprintln(v...))
 }
 
+// Logw 输出 msg，kv 为交替的字段名与值，json 格式时作为单独的字段输出，console 格式时追加在 msg 之后；
+// Logw、Logf 与 Logln 供 slog/slog 调用，caller 为调用 slog/slog 的位置，不做采样
+func Logw(lv int, msg string, kv ...interface{}) {
+	if !enabled(zapLevel(lv)) {
+		return
+	}
+	logw(lv, msg, kv...)
+}
+
+// Logf 级别未开启时不格式化
+func Logf(lv int, format string, v ...interface{}) {
+	if !enabled(zapLevel(lv)) {
+		return
+	}
+	logw(lv, fmt.Sprintf(format, v...), StackFields(lv, v)...)
+}
+
+func Logln(lv int, v ...interface{}) {
+	if !enabled(zapLevel(lv)) {
+		return
+	}
+	logw(lv, fmt.Sprint(v...), StackFields(lv, v)...)
+}
+
+func logw(lv int, msg string, kv ...interface{}) {
+	count(lv, msg)
+	ctxLg := loadLoggers().ctxLg
+	switch lv {
+	case LV_TRACE, LV_DEBUG:
+		ctxLg.Debugw(msg, kv...)
+	case LV_WARN:
+		ctxLg.Warnw(msg, kv...)
+	case LV_ERROR:
+		ctxLg.Errorw(msg, kv...)
+	case LV_FATAL:
+		ctxLg.Fatalw(msg, kv...)
+	case LV_PANIC:
+		ctxLg.Panicw(msg, kv...)
+	default:
+		ctxLg.Infow(msg, kv...)
+	}
+}
+
 func LogStat() (map[string]int64, []string) {
 
 	st := map[string]int64{
@@ -236,6 +374,8 @@ func LogStat() (map[string]int64, []string) {
 		"ERROR": atomic.SwapInt64(&cnError, 0),
 		"FATAL": atomic.SwapInt64(&cnFatal, 0),
 		"PANIC": atomic.SwapInt64(&cnPanic, 0),
+		// 采样丢弃的条数
+		"SAMPLED": atomic.SwapInt64(&cnSampled, 0),
 
 		"STAMP": atomic.SwapInt64(&cnStamp, time.Now().Unix()),
 	}
@@ -0,0 +1,22 @@
+// Copyright 2014 The sutil Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slog
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// ZapFields ctx 中的 traceID、uid 与 ContextWithFields 添加的字段，
+// 与 slog.NewZapCore 一起使用，如 logger.Info("msg", slog.ZapFields(ctx)...)
+func ZapFields(ctx context.Context) []zap.Field {
+	kv := extractContextAsFields(ctx, false)
+	fields := make([]zap.Field, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		fields = append(fields, zap.Any(kv[i].(string), kv[i+1]))
+	}
+	return fields
+}
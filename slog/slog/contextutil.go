@@ -7,6 +7,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/shawnfeng/sutil/scontext"
 	"github.com/uber/jaeger-client-go"
+	"sort"
 	"strings"
 )
 
@@ -20,6 +21,21 @@ var errorHeadKVNotFound = errors.New("valid context head not found")
 
 type contextKV map[string]interface{}
 
+// fieldsKey ContextWithFields 添加的字段在 context 中的 key
+type fieldsKey struct{}
+
+// contextFields ContextWithFields 添加的字段，console 格式按字段名排序输出
+type contextFields map[string]interface{}
+
+func (m contextFields) String() string {
+	parts := make([]string, 0, len(m))
+	for k, v := range m {
+		parts = append(parts, fmt.Sprintf("%s:%v", k, v))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
 func newContextKV() contextKV {
 	return contextKV{}
 }
@@ -63,8 +79,7 @@ func extractTraceID(ctx context.Context) (error, contextKV) {
 }
 
 func extractHead(ctx context.Context, fullHead bool) (error, contextKV) {
-	head := ctx.Value(scontext.ContextKeyHead)
-	if chd, ok := head.(scontext.ContextHeader); ok {
+	if chd, ok := scontext.HeadFromContext(ctx); ok {
 		kv := chd.ToKV()
 		if fullHead {
 			return nil, contextKV(chd.ToKV())
@@ -74,7 +89,36 @@ func extractHead(ctx context.Context, fullHead bool) (error, contextKV) {
 	return errorHeadKVNotFound, nil
 }
 
+// ContextWithFields kv 为交替的字段名与值，如 order_id、tenant 等，之后使用返回的 ctx 的日志都会在 traceID 与 uid 之后输出这些字段，
+// 与 ctx 中已有的字段合并，相同的字段名使用新的值，kv 为奇数个时忽略最后一个
+func ContextWithFields(ctx context.Context, kv ...interface{}) context.Context {
+	fields := contextFields{}
+	for k, v := range fieldsFromContext(ctx) {
+		fields[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		fields[fmt.Sprint(kv[i])] = kv[i+1]
+	}
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+func fieldsFromContext(ctx context.Context) contextFields {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).(contextFields)
+	return fields
+}
+
 func extractContext(ctx context.Context, fullHead bool) (v []interface{}) {
+	v = extractTraceAndHead(ctx, fullHead)
+	if fields := fieldsFromContext(ctx); len(fields) > 0 {
+		v = append(v, fields)
+	}
+	return
+}
+
+func extractTraceAndHead(ctx context.Context, fullHead bool) (v []interface{}) {
 	if ctx == nil {
 		return
 	}
@@ -101,3 +145,27 @@ func extractContextAsString(ctx context.Context, fullHead bool) (s string) {
 	}
 	return strings.Join(parts, "\t") + "\t"
 }
+
+// extractContextAsFields json 格式时使用，traceID 与 uid 作为单独的字段，head 中的其他字段与 ContextWithFields 添加的字段放在 fields 中
+func extractContextAsFields(ctx context.Context, fullHead bool) (kv []interface{}) {
+	fields := map[string]interface{}{}
+	for _, ckv := range extractTraceAndHead(ctx, fullHead) {
+		for k, v := range ckv.(contextKV) {
+			switch k {
+			case scontext.ContextKeyTraceID:
+				kv = append(kv, k, fmt.Sprint(v))
+			case scontext.ContextKeyHeadUid:
+				kv = append(kv, k, v)
+			default:
+				fields[k] = v
+			}
+		}
+	}
+	for k, v := range fieldsFromContext(ctx) {
+		fields[k] = v
+	}
+	if len(fields) > 0 {
+		kv = append(kv, "fields", fields)
+	}
+	return
+}
@@ -26,73 +26,171 @@ func vFromContext(ctx context.Context, includeHead bool, v ...interface{}) []int
 }
 
 func Tracef(ctx context.Context, format string, v ...interface{}) {
+	if !slog.LevelEnabled(slog.LV_TRACE) || !slog.Sample(slog.LV_TRACE, format) {
+		return
+	}
+	if slog.IsJSON() {
+		slog.Logw(slog.LV_TRACE, fmt.Sprintf(format, v...), extractContextAsFields(ctx, false)...)
+		return
+	}
 	format = formatFromContext(ctx, false, format)
-	slog.Tracef(format, v...)
+	slog.Logf(slog.LV_TRACE, format, v...)
 }
 
 func Traceln(ctx context.Context, v ...interface{}) {
+	if !slog.LevelEnabled(slog.LV_TRACE) || !slog.Sample(slog.LV_TRACE, slog.LnTemplate(v)) {
+		return
+	}
+	if slog.IsJSON() {
+		slog.Logw(slog.LV_TRACE, fmt.Sprint(v...), extractContextAsFields(ctx, false)...)
+		return
+	}
 	v = vFromContext(ctx, false, v...)
-	slog.Traceln(v...)
+	slog.Logln(slog.LV_TRACE, v...)
 }
 
 func Debugf(ctx context.Context, format string, v ...interface{}) {
+	if !slog.LevelEnabled(slog.LV_DEBUG) || !slog.Sample(slog.LV_DEBUG, format) {
+		return
+	}
+	if slog.IsJSON() {
+		slog.Logw(slog.LV_DEBUG, fmt.Sprintf(format, v...), extractContextAsFields(ctx, false)...)
+		return
+	}
 	format = formatFromContext(ctx, false, format)
-	slog.Debugf(format, v...)
+	slog.Logf(slog.LV_DEBUG, format, v...)
 }
 
 func Debugln(ctx context.Context, v ...interface{}) {
+	if !slog.LevelEnabled(slog.LV_DEBUG) || !slog.Sample(slog.LV_DEBUG, slog.LnTemplate(v)) {
+		return
+	}
+	if slog.IsJSON() {
+		slog.Logw(slog.LV_DEBUG, fmt.Sprint(v...), extractContextAsFields(ctx, false)...)
+		return
+	}
 	v = vFromContext(ctx, false, v...)
-	slog.Debugln(v...)
+	slog.Logln(slog.LV_DEBUG, v...)
 }
 
 func Infof(ctx context.Context, format string, v ...interface{}) {
+	if !slog.LevelEnabled(slog.LV_INFO) || !slog.Sample(slog.LV_INFO, format) {
+		return
+	}
+	if slog.IsJSON() {
+		slog.Logw(slog.LV_INFO, fmt.Sprintf(format, v...), extractContextAsFields(ctx, false)...)
+		return
+	}
 	format = formatFromContext(ctx, false, format)
-	slog.Infof(format, v...)
+	slog.Logf(slog.LV_INFO, format, v...)
 }
 
 func Infoln(ctx context.Context, v ...interface{}) {
+	if !slog.LevelEnabled(slog.LV_INFO) || !slog.Sample(slog.LV_INFO, slog.LnTemplate(v)) {
+		return
+	}
+	if slog.IsJSON() {
+		slog.Logw(slog.LV_INFO, fmt.Sprint(v...), extractContextAsFields(ctx, false)...)
+		return
+	}
 	v = vFromContext(ctx, false, v...)
-	slog.Infoln(v...)
+	slog.Logln(slog.LV_INFO, v...)
 }
 
 func Warnf(ctx context.Context, format string, v ...interface{}) {
+	if !slog.LevelEnabled(slog.LV_WARN) || !slog.Sample(slog.LV_WARN, format) {
+		return
+	}
+	if slog.IsJSON() {
+		slog.Logw(slog.LV_WARN, fmt.Sprintf(format, v...), extractContextAsFields(ctx, false)...)
+		return
+	}
 	format = formatFromContext(ctx, false, format)
-	slog.Warnf(format, v...)
+	slog.Logf(slog.LV_WARN, format, v...)
 }
 
 func Warnln(ctx context.Context, v ...interface{}) {
+	if !slog.LevelEnabled(slog.LV_WARN) || !slog.Sample(slog.LV_WARN, slog.LnTemplate(v)) {
+		return
+	}
+	if slog.IsJSON() {
+		slog.Logw(slog.LV_WARN, fmt.Sprint(v...), extractContextAsFields(ctx, false)...)
+		return
+	}
 	v = vFromContext(ctx, false, v...)
-	slog.Warnln(v...)
+	slog.Logln(slog.LV_WARN, v...)
 }
 
 func Errorf(ctx context.Context, format string, v ...interface{}) {
+	if !slog.LevelEnabled(slog.LV_ERROR) || !slog.Sample(slog.LV_ERROR, format) {
+		return
+	}
+	if slog.IsJSON() {
+		slog.Logw(slog.LV_ERROR, fmt.Sprintf(format, v...), append(extractContextAsFields(ctx, true), slog.StackFields(slog.LV_ERROR, v)...)...)
+		return
+	}
 	format = formatFromContext(ctx, true, format)
-	slog.Errorf(format, v...)
+	slog.Logf(slog.LV_ERROR, format, v...)
 }
 
 func Errorln(ctx context.Context, v ...interface{}) {
+	if !slog.LevelEnabled(slog.LV_ERROR) || !slog.Sample(slog.LV_ERROR, slog.LnTemplate(v)) {
+		return
+	}
+	if slog.IsJSON() {
+		slog.Logw(slog.LV_ERROR, fmt.Sprint(v...), append(extractContextAsFields(ctx, true), slog.StackFields(slog.LV_ERROR, v)...)...)
+		return
+	}
 	v = vFromContext(ctx, true, v...)
-	slog.Errorln(v...)
+	slog.Logln(slog.LV_ERROR, v...)
 }
 
 func Fatalf(ctx context.Context, format string, v ...interface{}) {
+	if !slog.LevelEnabled(slog.LV_FATAL) || !slog.Sample(slog.LV_FATAL, format) {
+		return
+	}
+	if slog.IsJSON() {
+		slog.Logw(slog.LV_FATAL, fmt.Sprintf(format, v...), append(extractContextAsFields(ctx, true), slog.StackFields(slog.LV_FATAL, v)...)...)
+		return
+	}
 	format = formatFromContext(ctx, true, format)
-	slog.Fatalf(format, v...)
+	slog.Logf(slog.LV_FATAL, format, v...)
 }
 
 func Fatalln(ctx context.Context, v ...interface{}) {
+	if !slog.LevelEnabled(slog.LV_FATAL) || !slog.Sample(slog.LV_FATAL, slog.LnTemplate(v)) {
+		return
+	}
+	if slog.IsJSON() {
+		slog.Logw(slog.LV_FATAL, fmt.Sprint(v...), append(extractContextAsFields(ctx, true), slog.StackFields(slog.LV_FATAL, v)...)...)
+		return
+	}
 	v = vFromContext(ctx, true, v...)
-	slog.Fatalln(v...)
+	slog.Logln(slog.LV_FATAL, v...)
 }
 
 func Panicf(ctx context.Context, format string, v ...interface{}) {
+	if !slog.LevelEnabled(slog.LV_PANIC) || !slog.Sample(slog.LV_PANIC, format) {
+		return
+	}
+	if slog.IsJSON() {
+		slog.Logw(slog.LV_PANIC, fmt.Sprintf(format, v...), extractContextAsFields(ctx, true)...)
+		return
+	}
 	format = formatFromContext(ctx, true, format)
-	slog.Panicf(format, v...)
+	slog.Logf(slog.LV_PANIC, format, v...)
 }
 
 func Panicln(ctx context.Context, v ...interface{}) {
+	if !slog.LevelEnabled(slog.LV_PANIC) || !slog.Sample(slog.LV_PANIC, slog.LnTemplate(v)) {
+		return
+	}
+	if slog.IsJSON() {
+		slog.Logw(slog.LV_PANIC, fmt.Sprint(v...), extractContextAsFields(ctx, true)...)
+		return
+	}
 	v = vFromContext(ctx, true, v...)
-	slog.Panicln(v...)
+	slog.Logln(slog.LV_PANIC, v...)
 }
 
 type Logger struct {}
@@ -0,0 +1,107 @@
+// Copyright 2014 The sutil Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package slog
+
+import (
+	"context"
+	stdslog "log/slog"
+
+	"github.com/shawnfeng/sutil/slog"
+)
+
+// Handler 输出到 slog 的标准库 log/slog.Handler，使用标准库 slog.Logger 的库通过
+//
+//	stdslog.SetDefault(stdslog.New(slog.NewHandler()))
+//
+// 与 slog/slog 输出到相同的位置，使用 InfoContext 等时输出 ctx 中的 traceID 与 uid，
+// attr 作为单独的字段，group 的 attr 按 group.key 命名
+type Handler struct {
+	attrs  []interface{}
+	prefix string
+}
+
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+func (m *Handler) Enabled(ctx context.Context, level stdslog.Level) bool {
+	return slog.Enabled(stdLevel(level))
+}
+
+func (m *Handler) Handle(ctx context.Context, r stdslog.Record) error {
+	lv := stdLevel(r.Level)
+	if !slog.Sample(lv, r.Message) {
+		return nil
+	}
+
+	kv := make([]interface{}, 0, len(m.attrs)+2*r.NumAttrs()+6)
+	msg := r.Message
+	if slog.IsJSON() {
+		kv = append(kv, extractContextAsFields(ctx, lv >= slog.LV_ERROR)...)
+	} else {
+		msg = formatFromContext(ctx, lv >= slog.LV_ERROR, msg)
+	}
+	kv = append(kv, m.attrs...)
+	r.Attrs(func(a stdslog.Attr) bool {
+		kv = appendAttr(kv, m.prefix, a)
+		return true
+	})
+	slog.LogAt(lv, r.PC, msg, kv...)
+	return nil
+}
+
+func (m *Handler) WithAttrs(attrs []stdslog.Attr) stdslog.Handler {
+	h := &Handler{
+		attrs:  append([]interface{}{}, m.attrs...),
+		prefix: m.prefix,
+	}
+	for _, a := range attrs {
+		h.attrs = appendAttr(h.attrs, m.prefix, a)
+	}
+	return h
+}
+
+func (m *Handler) WithGroup(name string) stdslog.Handler {
+	if name == "" {
+		return m
+	}
+	return &Handler{
+		attrs:  m.attrs,
+		prefix: m.prefix + name + ".",
+	}
+}
+
+// appendAttr 展开 group，忽略空的 attr
+func appendAttr(kv []interface{}, prefix string, a stdslog.Attr) []interface{} {
+	a.Value = a.Value.Resolve()
+	if a.Equal(stdslog.Attr{}) {
+		return kv
+	}
+	if a.Value.Kind() == stdslog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			kv = appendAttr(kv, prefix, ga)
+		}
+		return kv
+	}
+	return append(kv, prefix+a.Key, a.Value.Any())
+}
+
+func stdLevel(level stdslog.Level) int {
+	switch {
+	case level >= stdslog.LevelError:
+		return slog.LV_ERROR
+	case level >= stdslog.LevelWarn:
+		return slog.LV_WARN
+	case level >= stdslog.LevelInfo:
+		return slog.LV_INFO
+	}
+	return slog.LV_DEBUG
+}
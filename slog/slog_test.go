@@ -4,7 +4,15 @@
 
 package slog
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
 
 func TestShowLog(t *testing.T) {
 	t0(t)
@@ -51,3 +59,43 @@ func t1(t *testing.T) {
 	Infoln("std out")
 
 }
+
+func TestJSONEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	setLogger(zapcore.AddSync(&buf), zap.DebugLevel, EncodingJSON)
+	defer Init("", "", "TRACE")
+	if !IsJSON() {
+		t.Fatal("expect json encoding")
+	}
+
+	Infof("Infof %s", "TT")
+	Logw(LV_ERROR, "Logw TT", "traceID", "abc", "uid", int64(1234), "fields", map[string]interface{}{"region": "asia"})
+
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("invalid json line: %s, err: %v", line, err)
+		}
+		lines = append(lines, m)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 lines, got: %d", len(lines))
+	}
+
+	if lines[0]["level"] != "INFO" || lines[0]["msg"] != "Infof TT" {
+		t.Errorf("unexpected line: %v", lines[0])
+	}
+	if caller, _ := lines[0]["caller"].(string); !strings.Contains(caller, "slog_test.go") {
+		t.Errorf("unexpected caller: %v", lines[0]["caller"])
+	}
+	fields, _ := lines[1]["fields"].(map[string]interface{})
+	if lines[1]["level"] != "ERROR" || lines[1]["traceID"] != "abc" || lines[1]["uid"] != float64(1234) || fields["region"] != "asia" {
+		t.Errorf("unexpected line: %v", lines[1])
+	}
+
+	Init("", "", "TRACE")
+	if IsJSON() {
+		t.Error("expect console encoding")
+	}
+}
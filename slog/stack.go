@@ -0,0 +1,71 @@
+// Copyright 2014 The sutil Author. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package slog
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// StackKey Error 与 Fatal 级别日志中 error 调用栈的字段名
+const StackKey = "stack"
+
+// 1 表示输出 error 的调用栈
+var errorStack int32
+
+// SetErrorStack 开启后 Error 与 Fatal 级别的日志参数中有 github.com/pkg/errors 创建的 error 时，
+// 包括通过 errors.Wrap 或 fmt.Errorf("%w") 包装的，把最内层的调用栈作为 StackKey 字段输出
+func SetErrorStack(enable bool) {
+	if enable {
+		atomic.StoreInt32(&errorStack, 1)
+	} else {
+		atomic.StoreInt32(&errorStack, 0)
+	}
+}
+
+type stackTracer interface {
+	StackTrace() errors.StackTrace
+}
+
+// StackFields lv 为 Error 或 Fatal 并已开启 SetErrorStack 时，返回 v 中第一个带调用栈的 error 的 StackKey 字段，否则返回 nil
+func StackFields(lv int, v []interface{}) []interface{} {
+	if (lv != LV_ERROR && lv != LV_FATAL) || atomic.LoadInt32(&errorStack) == 0 {
+		return nil
+	}
+	for _, a := range v {
+		err, ok := a.(error)
+		if !ok {
+			continue
+		}
+		if st := ErrorStack(err); st != "" {
+			return []interface{}{StackKey, st}
+		}
+	}
+	return nil
+}
+
+// ErrorStack 沿 Cause 与 Unwrap 查找最内层带调用栈的 error，返回格式化后的调用栈，没有时返回空
+func ErrorStack(err error) string {
+	var tracer stackTracer
+	for err != nil {
+		if t, ok := err.(stackTracer); ok {
+			tracer = t
+		}
+		switch e := err.(type) {
+		case interface{ Cause() error }:
+			err = e.Cause()
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			err = nil
+		}
+	}
+	if tracer == nil {
+		return ""
+	}
+	return fmt.Sprintf("%+v", tracer.StackTrace())
+}
@@ -0,0 +1,58 @@
+package slog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newStackErr() error {
+	return errors.New("origin")
+}
+
+func TestErrorStack(t *testing.T) {
+	err := fmt.Errorf("outer: %w", errors.Wrap(newStackErr(), "wrap"))
+	if st := ErrorStack(err); !strings.Contains(st, "slog.newStackErr") {
+		t.Errorf("unexpected stack: %s", st)
+	}
+	if st := ErrorStack(fmt.Errorf("plain")); st != "" {
+		t.Errorf("unexpected stack: %s", st)
+	}
+
+	if kv := StackFields(LV_ERROR, []interface{}{err}); kv != nil {
+		t.Errorf("unexpected fields: %v", kv)
+	}
+	SetErrorStack(true)
+	defer SetErrorStack(false)
+	if kv := StackFields(LV_WARN, []interface{}{err}); kv != nil {
+		t.Errorf("unexpected fields: %v", kv)
+	}
+	if kv := StackFields(LV_ERROR, []interface{}{"a", err}); len(kv) != 2 || kv[0] != StackKey {
+		t.Errorf("unexpected fields: %v", kv)
+	}
+}
+
+func TestErrorfStack(t *testing.T) {
+	var buf bytes.Buffer
+	setLogger(zapcore.AddSync(&buf), zap.InfoLevel, EncodingJSON)
+	SetErrorStack(true)
+	defer func() {
+		SetErrorStack(false)
+		Init("", "", "TRACE")
+	}()
+
+	Errorf("get instance err: %v", newStackErr())
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("invalid json: %s, err: %v", buf.String(), err)
+	}
+	if m["msg"] != "get instance err: origin" || !strings.Contains(m[StackKey].(string), "slog.newStackErr") {
+		t.Errorf("unexpected line: %v", m)
+	}
+}
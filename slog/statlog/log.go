@@ -78,7 +78,7 @@ func InitV2(logDir, logPref string, service string, maxSize int, maxAge, maxBack
 
 func LogKV(ctx context.Context, name string, keysAndValues ...interface{}) {
 	headKV := emptyHeadKV
-	if chd, ok := ctx.Value(scontext.ContextKeyHead).(scontext.ContextHeader); ok {
+	if chd, ok := scontext.HeadFromContext(ctx); ok {
 		headKV = chd.ToKV()
 	}
 